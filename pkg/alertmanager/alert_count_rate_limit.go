@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const alertCountRateLimitWindow = time.Minute
+
+// AlertCountRateLimit limits the number of new unique alerts, identified by their fingerprint, that a tenant
+// can create per minute. The rate is tracked with a sliding window counter: the count of the previous fixed
+// window is weighted by how much it overlaps the sliding window ending now.
+type AlertCountRateLimit struct {
+	tenant string
+	limits Limits
+	logger log.Logger
+	now    func() time.Time
+
+	droppedTotal prometheus.Counter
+
+	mtx           sync.Mutex
+	windowStart   time.Time
+	previousCount int
+	currentCount  int
+	lastWarning   time.Time
+}
+
+func NewAlertCountRateLimit(tenant string, limits Limits, logger log.Logger, reg prometheus.Registerer) *AlertCountRateLimit {
+	return &AlertCountRateLimit{
+		tenant: tenant,
+		limits: limits,
+		logger: logger,
+		now:    time.Now,
+		droppedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "alertmanager_unique_alerts_dropped_total",
+			Help: "Number of new unique alerts dropped because of hitting the limit of new unique alerts per minute.",
+		}),
+	}
+}
+
+// Allow returns whether a new unique alert can be created, counting it if so. When the limit is hit,
+// the dropped alert is counted in the metrics, and a warning is logged at most once per window.
+func (l *AlertCountRateLimit) Allow() (allowed bool, limit int) {
+	limit = l.limits.AlertmanagerMaxUniqueAlertsPerMinute(l.tenant)
+	if limit <= 0 {
+		return true, limit
+	}
+
+	now := l.now()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.advance(now)
+
+	overlap := 1 - float64(now.Sub(l.windowStart))/float64(alertCountRateLimitWindow)
+	if float64(l.previousCount)*overlap+float64(l.currentCount) >= float64(limit) {
+		l.droppedTotal.Inc()
+		if now.Sub(l.lastWarning) >= alertCountRateLimitWindow {
+			level.Warn(l.logger).Log("msg", "dropping new unique alerts because the tenant hit the limit of new unique alerts per minute", "user", l.tenant, "limit", limit)
+			l.lastWarning = now
+		}
+		return false, limit
+	}
+
+	l.currentCount++
+	return true, limit
+}
+
+// advance moves the fixed windows forward so that the current one includes now. Must be called with the lock held.
+func (l *AlertCountRateLimit) advance(now time.Time) {
+	if l.windowStart.IsZero() {
+		l.windowStart = now.Truncate(alertCountRateLimitWindow)
+		return
+	}
+
+	elapsed := now.Sub(l.windowStart)
+	switch {
+	case elapsed < alertCountRateLimitWindow:
+		return
+	case elapsed < 2*alertCountRateLimitWindow:
+		l.previousCount = l.currentCount
+	default:
+		l.previousCount = 0
+	}
+
+	l.currentCount = 0
+	l.windowStart = now.Truncate(alertCountRateLimitWindow)
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertCountRateLimit(t *testing.T) {
+	now := time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC)
+	limiter := NewAlertCountRateLimit("test", &mockAlertManagerLimits{maxUniqueAlertsPerMinute: 10}, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	limiter.now = func() time.Time { return now }
+
+	allowN := func(n int) (allowed int) {
+		for i := 0; i < n; i++ {
+			if ok, _ := limiter.Allow(); ok {
+				allowed++
+			}
+		}
+		return allowed
+	}
+
+	// The limit is enforced within the first window.
+	assert.Equal(t, 10, allowN(15))
+	assert.Equal(t, float64(5), testutil.ToFloat64(limiter.droppedTotal))
+
+	// At 15s into the next window, the previous window still weights 75%.
+	now = now.Add(75 * time.Second)
+	assert.Equal(t, 3, allowN(10))
+
+	// At 45s into the window, the previous window weights 25%.
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 5, allowN(10))
+
+	// After two windows without alerts, the full limit is available again.
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 10, allowN(15))
+	assert.Equal(t, float64(5+7+5+5), testutil.ToFloat64(limiter.droppedTotal))
+}
+
+func TestAlertCountRateLimit_Disabled(t *testing.T) {
+	limiter := NewAlertCountRateLimit("test", &mockAlertManagerLimits{}, log.NewNopLogger(), nil)
+	for i := 0; i < 1000; i++ {
+		ok, _ := limiter.Allow()
+		require.True(t, ok)
+	}
+	assert.Equal(t, float64(0), testutil.ToFloat64(limiter.droppedTotal))
+}
+
+func TestAlertsLimiterWithUniqueAlertsPerMinuteLimit(t *testing.T) {
+	// Updates of existing alerts are not limited, and a dropped alert is not counted.
+	testLimiter(t, &mockAlertManagerLimits{maxUniqueAlertsPerMinute: 1}, []callbackOp{
+		{alert: &types.Alert{Alert: alert1}, existing: false, expectedCount: 1, expectedTotalSize: alert1Size},
+		{alert: &types.Alert{Alert: alert1}, existing: true, expectedCount: 1, expectedTotalSize: alert1Size},
+		{alert: &types.Alert{Alert: alert2}, existing: false, expectedInsertError: fmt.Errorf(errTooManyUniqueAlerts, 1), expectedCount: 1, expectedTotalSize: alert1Size},
+		{alert: &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "other"}}}, existing: false, expectedInsertError: fmt.Errorf(errTooManyUniqueAlerts, 1), expectedCount: 1, expectedTotalSize: alert1Size},
+	})
+}
@@ -85,6 +85,11 @@ type Config struct {
 	Replicator        Replicator
 	Store             alertstore.AlertStore
 	PersisterConfig   PersisterConfig
+
+	// Silences garbage collection. If the interval is 0, the silences maintenance runs at the default period.
+	// If the retention after expiry is 0, Retention is used for the silences too.
+	SilenceGCInterval           time.Duration
+	SilenceRetentionAfterExpiry time.Duration
 }
 
 // An Alertmanager manages the alerts for one user.
@@ -118,7 +123,11 @@ type Alertmanager struct {
 	// hence we need to generate the metric ourselves.
 	configHashMetric prometheus.Gauge
 
-	rateLimitedNotifications *prometheus.CounterVec
+	rateLimitedNotifications  *prometheus.CounterVec
+	deduplicatedNotifications *prometheus.CounterVec
+
+	// The alerts sent by the receivers with a deduplication window. They're kept across ApplyConfig calls.
+	deduplication *deduplicationStates
 }
 
 var (
@@ -179,7 +188,11 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 			Name: "alertmanager_notification_rate_limited_total",
 			Help: "Number of rate-limited notifications per integration.",
 		}, []string{"integration"}), // "integration" is consistent with other alertmanager metrics.
-
+		deduplicatedNotifications: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "alertmanager_notification_alerts_deduplicated_total",
+			Help: "Number of alerts not sent because already sent within the receiver deduplication window, per integration.",
+		}, []string{"integration"}),
+		deduplication: newDeduplicationStates(),
 	}
 
 	am.registry = reg
@@ -204,10 +217,15 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 
 	am.marker = types.NewMarker(am.registry)
 
+	silencesRetention := cfg.Retention
+	if cfg.SilenceRetentionAfterExpiry > 0 {
+		silencesRetention = cfg.SilenceRetentionAfterExpiry
+	}
+
 	silencesFile := filepath.Join(cfg.TenantDataDir, silencesSnapshot)
 	am.silences, err = silence.New(silence.Options{
 		SnapshotFile: silencesFile,
-		Retention:    cfg.Retention,
+		Retention:    silencesRetention,
 		Logger:       log.With(am.logger, "component", "silences"),
 		Metrics:      am.registry,
 	})
@@ -229,15 +247,21 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 
 	am.pipelineBuilder = notify.NewPipelineBuilder(am.registry)
 
+	// The silences maintenance removes the expired silences and snapshots the remaining ones.
+	silencesMaintenancePeriod := maintenancePeriod
+	if cfg.SilenceGCInterval > 0 {
+		silencesMaintenancePeriod = cfg.SilenceGCInterval
+	}
+
 	am.wg.Add(1)
 	go func() {
-		am.silences.Maintenance(maintenancePeriod, silencesFile, am.stop, nil)
+		am.silences.Maintenance(silencesMaintenancePeriod, silencesFile, am.stop, nil)
 		am.wg.Done()
 	}()
 
 	var callback mem.AlertStoreCallback
 	if am.cfg.Limits != nil {
-		callback = newAlertsLimiter(am.cfg.UserID, am.cfg.Limits, reg)
+		callback = newAlertsLimiter(am.cfg.UserID, am.cfg.Limits, am.logger, reg)
 	}
 
 	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, 30*time.Minute, callback, am.logger, reg)
@@ -299,8 +323,9 @@ func clusterWait(position func() int, timeout time.Duration) func() time.Duratio
 	}
 }
 
-// ApplyConfig applies a new configuration to an Alertmanager.
-func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg string) error {
+// ApplyConfig applies a new configuration to an Alertmanager. The Mimir-specific fields of the config
+// are the ones returned by loadAlertmanagerConfig.
+func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, ext configExtensions, rawCfg string) error {
 	templateFiles := make([]string, len(conf.Templates))
 	for i, t := range conf.Templates {
 		templateFilepath, err := safeTemplateFilepath(filepath.Join(am.cfg.TenantDataDir, templatesDir), t)
@@ -317,6 +342,12 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 	}
 	tmpl.ExternalURL = am.cfg.ExternalURL
 
+	routes := dispatch.NewRoute(conf.Route, nil)
+	jitterRoutes, err := resolveGroupWaitJitterRoutes(routes, ext.groupWaitJitters)
+	if err != nil {
+		return err
+	}
+
 	am.api.Update(conf, func(_ model.LabelSet) {})
 
 	// Ensure inhibitor is set before being called
@@ -343,7 +374,14 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 	// Create a firewall binded to the per-tenant config.
 	firewallDialer := util_net.NewFirewallDialer(newFirewallDialerConfigProvider(userID, am.cfg.Limits))
 
-	integrationsMap, err := buildIntegrationsMap(conf.Receivers, tmpl, firewallDialer, am.logger, func(integrationName string, notifier notify.Notifier) notify.Notifier {
+	deduplicationKeys := map[deduplicationStateKey]struct{}{}
+	integrationsMap, err := buildIntegrationsMap(conf.Receivers, tmpl, firewallDialer, am.logger, func(receiverName, integrationName string, idx int, notifier notify.Notifier) notify.Notifier {
+		if window := ext.deduplicationWindows[receiverName]; window > 0 {
+			key := deduplicationStateKey{receiver: receiverName, integration: integrationName, idx: idx}
+			deduplicationKeys[key] = struct{}{}
+			notifier = newDeduplicatingNotifier(notifier, window, am.deduplicatedNotifications.WithLabelValues(integrationName), am.deduplication.get(key))
+		}
+
 		if am.cfg.Limits != nil {
 			rl := &tenantRateLimits{
 				tenant:      userID,
@@ -358,6 +396,7 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 	if err != nil {
 		return nil
 	}
+	am.deduplication.retain(deduplicationKeys)
 
 	timeIntervals := make(map[string][]timeinterval.TimeInterval, len(conf.MuteTimeIntervals)+len(conf.TimeIntervals))
 	for _, ti := range conf.MuteTimeIntervals {
@@ -378,10 +417,16 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 		am.state,
 	)
 	am.lastPipeline = pipeline
+
+	var stage notify.Stage = pipeline
+	if len(jitterRoutes) > 0 {
+		stage = newGroupWaitJitterStage(pipeline, jitterRoutes)
+	}
+
 	am.dispatcher = dispatch.NewDispatcher(
 		am.alerts,
-		dispatch.NewRoute(conf.Route, nil),
-		pipeline,
+		routes,
+		stage,
 		am.marker,
 		timeoutFunc,
 		&dispatcherLimits{tenant: am.cfg.UserID, limits: am.cfg.Limits},
@@ -437,7 +482,7 @@ func (am *Alertmanager) getFullState() (*clusterpb.FullState, error) {
 
 // buildIntegrationsMap builds a map of name to the list of integration notifiers off of a
 // list of receiver config.
-func buildIntegrationsMap(nc []*config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, notifierWrapper func(string, notify.Notifier) notify.Notifier) (map[string][]notify.Integration, error) {
+func buildIntegrationsMap(nc []*config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, notifierWrapper func(string, string, int, notify.Notifier) notify.Notifier) (map[string][]notify.Integration, error) {
 	integrationsMap := make(map[string][]notify.Integration, len(nc))
 	for _, rcv := range nc {
 		integrations, err := buildReceiverIntegrations(rcv, tmpl, firewallDialer, logger, notifierWrapper)
@@ -452,7 +497,7 @@ func buildIntegrationsMap(nc []*config.Receiver, tmpl *template.Template, firewa
 // buildReceiverIntegrations builds a list of integration notifiers off of a
 // receiver config.
 // Taken from https://github.com/prometheus/alertmanager/blob/94d875f1227b29abece661db1a68c001122d1da5/cmd/alertmanager/main.go#L112-L159.
-func buildReceiverIntegrations(nc *config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, wrapper func(string, notify.Notifier) notify.Notifier) ([]notify.Integration, error) {
+func buildReceiverIntegrations(nc *config.Receiver, tmpl *template.Template, firewallDialer *util_net.FirewallDialer, logger log.Logger, wrapper func(string, string, int, notify.Notifier) notify.Notifier) ([]notify.Integration, error) {
 	var (
 		errs         types.MultiError
 		integrations []notify.Integration
@@ -462,7 +507,7 @@ func buildReceiverIntegrations(nc *config.Receiver, tmpl *template.Template, fir
 				errs.Add(err)
 				return
 			}
-			n = wrapper(name, n)
+			n = wrapper(nc.Name, name, i, n)
 			integrations = append(integrations, notify.NewIntegration(n, rs, name, i))
 		}
 	)
@@ -570,11 +615,13 @@ func (g *dispatcherLimits) MaxNumberOfAggregationGroups() int {
 }
 
 var (
-	errTooManyAlerts = "too many alerts, limit: %d"
-	errAlertsTooBig  = "alerts too big, total size limit: %d bytes"
+	errTooManyAlerts       = "too many alerts, limit: %d"
+	errAlertsTooBig        = "alerts too big, total size limit: %d bytes"
+	errTooManyUniqueAlerts = "too many new unique alerts, limit: %d per minute"
 )
 
-// alertsLimiter limits the number and size of alerts being received by the Alertmanager.
+// alertsLimiter limits the number and size of alerts being received by the Alertmanager,
+// and the rate of new unique alerts.
 // We consider an alert unique based on its fingerprint (a hash of its labels) and
 // its size it's determined by the sum of bytes of its labels, annotations, and generator URL.
 type alertsLimiter struct {
@@ -582,6 +629,7 @@ type alertsLimiter struct {
 	limits Limits
 
 	failureCounter prometheus.Counter
+	uniqueAlerts   *AlertCountRateLimit
 
 	mx        sync.Mutex
 	sizes     map[model.Fingerprint]int
@@ -589,11 +637,12 @@ type alertsLimiter struct {
 	totalSize int
 }
 
-func newAlertsLimiter(tenant string, limits Limits, reg prometheus.Registerer) *alertsLimiter {
+func newAlertsLimiter(tenant string, limits Limits, logger log.Logger, reg prometheus.Registerer) *alertsLimiter {
 	limiter := &alertsLimiter{
-		tenant: tenant,
-		limits: limits,
-		sizes:  map[model.Fingerprint]int{},
+		tenant:       tenant,
+		limits:       limits,
+		sizes:        map[model.Fingerprint]int{},
+		uniqueAlerts: NewAlertCountRateLimit(tenant, limits, logger, reg),
 		failureCounter: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name: "alertmanager_alerts_insert_limited_total",
 			Help: "Number of failures to insert new alerts to in-memory alert store.",
@@ -648,6 +697,14 @@ func (a *alertsLimiter) PreStore(alert *types.Alert, existing bool) error {
 		return fmt.Errorf(errAlertsTooBig, sizeLimit)
 	}
 
+	// Checked last, so that only the new alerts which are going to be stored are counted.
+	if !existing {
+		if allowed, limit := a.uniqueAlerts.Allow(); !allowed {
+			a.failureCounter.Inc()
+			return fmt.Errorf(errTooManyUniqueAlerts, limit)
+		}
+	}
+
 	return nil
 }
 
@@ -65,8 +65,10 @@ type alertmanagerMetrics struct {
 	persistFailed           *prometheus.Desc
 
 	notificationRateLimited                 *prometheus.Desc
+	notificationAlertsDeduplicated          *prometheus.Desc
 	dispatcherAggregationGroupsLimitReached *prometheus.Desc
 	insertAlertFailures                     *prometheus.Desc
+	uniqueAlertsDropped                     *prometheus.Desc
 	alertsLimiterAlertsCount                *prometheus.Desc
 	alertsLimiterAlertsSize                 *prometheus.Desc
 }
@@ -218,6 +220,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_notification_rate_limited_total",
 			"Total number of rate-limited notifications per integration.",
 			[]string{"user", "integration"}, nil),
+		notificationAlertsDeduplicated: prometheus.NewDesc(
+			"cortex_alertmanager_notification_alerts_deduplicated_total",
+			"Total number of alerts not sent because already sent within the receiver deduplication window, per integration.",
+			[]string{"user", "integration"}, nil),
 		dispatcherAggregationGroupsLimitReached: prometheus.NewDesc(
 			"cortex_alertmanager_dispatcher_aggregation_group_limit_reached_total",
 			"Number of times when dispatcher failed to create new aggregation group due to limit.",
@@ -226,6 +232,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_alerts_insert_limited_total",
 			"Total number of failures to store alert due to hitting alertmanager limits.",
 			[]string{"user"}, nil),
+		uniqueAlertsDropped: prometheus.NewDesc(
+			"cortex_alertmanager_unique_alerts_dropped_total",
+			"Total number of new unique alerts dropped due to hitting the limit of new unique alerts per minute.",
+			[]string{"user"}, nil),
 		alertsLimiterAlertsCount: prometheus.NewDesc(
 			"cortex_alertmanager_alerts_limiter_current_alerts",
 			"Number of alerts tracked by alerts limiter.",
@@ -284,8 +294,10 @@ func (m *alertmanagerMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.persistTotal
 	out <- m.persistFailed
 	out <- m.notificationRateLimited
+	out <- m.notificationAlertsDeduplicated
 	out <- m.dispatcherAggregationGroupsLimitReached
 	out <- m.insertAlertFailures
+	out <- m.uniqueAlertsDropped
 	out <- m.alertsLimiterAlertsCount
 	out <- m.alertsLimiterAlertsSize
 }
@@ -335,8 +347,10 @@ func (m *alertmanagerMetrics) Collect(out chan<- prometheus.Metric) {
 	data.SendSumOfCounters(out, m.persistFailed, "alertmanager_state_persist_failed_total")
 
 	data.SendSumOfCountersPerUser(out, m.notificationRateLimited, "alertmanager_notification_rate_limited_total", util.WithLabels("integration"), util.WithSkipZeroValueMetrics)
+	data.SendSumOfCountersPerUser(out, m.notificationAlertsDeduplicated, "alertmanager_notification_alerts_deduplicated_total", util.WithLabels("integration"), util.WithSkipZeroValueMetrics)
 	data.SendSumOfCountersPerUser(out, m.dispatcherAggregationGroupsLimitReached, "alertmanager_dispatcher_aggregation_group_limit_reached_total")
 	data.SendSumOfCountersPerUser(out, m.insertAlertFailures, "alertmanager_alerts_insert_limited_total")
+	data.SendSumOfCountersPerUser(out, m.uniqueAlertsDropped, "alertmanager_unique_alerts_dropped_total")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsCount, "alertmanager_alerts_limiter_current_alerts")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsSize, "alertmanager_alerts_limiter_current_alerts_size_bytes")
 }
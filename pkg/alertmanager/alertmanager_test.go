@@ -18,6 +18,8 @@ import (
 	"github.com/grafana/dskit/test"
 	"github.com/prometheus/alertmanager/cluster/clusterpb"
 	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -85,7 +87,7 @@ route:
 
 	cfg, err := config.Load(cfgRaw)
 	require.NoError(t, err)
-	require.NoError(t, am.ApplyConfig(user, cfg, cfgRaw))
+	require.NoError(t, am.ApplyConfig(user, cfg, configExtensions{}, cfgRaw))
 
 	now := time.Now()
 
@@ -168,7 +170,7 @@ route:
 
 	cfg, err := config.Load(cfgRaw)
 	require.NoError(t, err)
-	require.NoError(t, am.ApplyConfig(user, cfg, cfgRaw))
+	require.NoError(t, am.ApplyConfig(user, cfg, configExtensions{}, cfgRaw))
 
 	now := time.Now()
 	inputAlerts := []*types.Alert{
@@ -197,6 +199,53 @@ route:
 	})
 }
 
+func TestSilencesGarbageCollection(t *testing.T) {
+	am, err := New(&Config{
+		UserID:                      "test",
+		Logger:                      log.NewNopLogger(),
+		Limits:                      &mockAlertManagerLimits{},
+		TenantDataDir:               t.TempDir(),
+		ExternalURL:                 &url.URL{Path: "/am"},
+		ShardingEnabled:             true,
+		Store:                       prepareInMemoryAlertStore(),
+		Replicator:                  &stubReplicator{},
+		ReplicationFactor:           2,
+		PersisterConfig:             PersisterConfig{Interval: time.Hour},
+		Retention:                   time.Hour,
+		SilenceGCInterval:           10 * time.Millisecond,
+		SilenceRetentionAfterExpiry: 10 * time.Millisecond,
+	}, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	defer am.StopAndWait()
+
+	// The silences are replicated once the state replication is running. The replication factor
+	// is greater than 1, otherwise the replication stops after the first replicated silence.
+	require.NoError(t, am.state.AwaitRunning(context.Background()))
+
+	newSilence := func() string {
+		id, err := am.silences.Set(&silencepb.Silence{
+			Matchers: []*silencepb.Matcher{{Name: "alertname", Pattern: "test"}},
+			StartsAt: time.Now(),
+			EndsAt:   time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	expiredID := newSilence()
+	activeID := newSilence()
+	require.NoError(t, am.silences.Expire(expiredID))
+
+	// The expired silence is removed by the silences maintenance once its retention has elapsed.
+	test.Poll(t, 3*time.Second, silence.ErrNotFound, func() interface{} {
+		_, err := am.silences.QueryOne(silence.QIDs(expiredID))
+		return err
+	})
+
+	_, err = am.silences.QueryOne(silence.QIDs(activeID))
+	assert.NoError(t, err)
+}
+
 var (
 	alert1 = model.Alert{
 		Labels:       model.LabelSet{"alert": "first"},
@@ -301,7 +350,7 @@ func TestAlertsLimiterWithSizeLimitAndAnnotationUpdate(t *testing.T) {
 func testLimiter(t *testing.T, limits Limits, ops []callbackOp) {
 	reg := prometheus.NewPedanticRegistry()
 
-	limiter := newAlertsLimiter("test", limits, reg)
+	limiter := newAlertsLimiter("test", limits, log.NewNopLogger(), reg)
 
 	for ix, op := range ops {
 		if op.delete {
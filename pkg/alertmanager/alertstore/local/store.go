@@ -30,6 +30,10 @@ var (
 // StoreConfig configures a static file alertmanager store
 type StoreConfig struct {
 	Path string `yaml:"path"`
+
+	// Allow the Alertmanager to inject the validation of the configs, because its config format
+	// extends the upstream one. If not set, the configs are validated with the upstream loader.
+	ValidateConfig func(rawCfg string) error `yaml:"-"`
 }
 
 // RegisterFlags registers flags related to the alertmanager local storage.
@@ -125,6 +129,15 @@ func (f *Store) DeleteFullState(ctx context.Context, user string) error {
 	return errState
 }
 
+func (f *Store) validateConfig(rawCfg string) error {
+	if f.cfg.ValidateConfig != nil {
+		return f.cfg.ValidateConfig(rawCfg)
+	}
+
+	_, err := config.Load(rawCfg)
+	return err
+}
+
 func (f *Store) reloadConfigs() (map[string]alertspb.AlertConfigDesc, error) {
 	configs := map[string]alertspb.AlertConfigDesc{}
 	err := filepath.Walk(f.cfg.Path, func(path string, info os.FileInfo, err error) error {
@@ -138,18 +151,17 @@ func (f *Store) reloadConfigs() (map[string]alertspb.AlertConfigDesc, error) {
 			return nil
 		}
 
-		// Ensure the file is a valid Alertmanager Config.
-		_, err = config.LoadFile(path)
-		if err != nil {
-			return errors.Wrapf(err, "unable to load alertmanager config %s", path)
-		}
-
 		// Load the file to be returned by the store.
 		content, err := os.ReadFile(path)
 		if err != nil {
 			return errors.Wrapf(err, "unable to read alertmanager config %s", path)
 		}
 
+		// Ensure the file is a valid Alertmanager Config.
+		if err := f.validateConfig(string(content)); err != nil {
+			return errors.Wrapf(err, "unable to load alertmanager config %s", path)
+		}
+
 		// The file name must correspond to the user tenant ID
 		user := strings.TrimSuffix(info.Name(), ext)
 
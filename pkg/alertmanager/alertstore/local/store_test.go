@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -107,6 +108,32 @@ func TestStore_GetAlertConfigs(t *testing.T) {
 	}
 }
 
+func TestStore_ShouldValidateConfigsWithTheConfiguredValidation(t *testing.T) {
+	ctx := context.Background()
+	storeDir := t.TempDir()
+
+	// The deduplication window is not supported by the upstream config.
+	userCfg := strings.Replace(prepareAlertmanagerConfig("user-1"), "  - name: send-email\n", "  - name: send-email\n    deduplication_window: 5m\n", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(storeDir, "user-1.yaml"), []byte(userCfg), os.ModePerm))
+
+	store, err := NewStore(StoreConfig{Path: storeDir})
+	require.NoError(t, err)
+	_, err = store.ListAllUsers(ctx)
+	require.Error(t, err)
+
+	var validated []string
+	store, err = NewStore(StoreConfig{Path: storeDir, ValidateConfig: func(rawCfg string) error {
+		validated = append(validated, rawCfg)
+		return nil
+	}})
+	require.NoError(t, err)
+
+	users, err := store.ListAllUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-1"}, users)
+	assert.Equal(t, []string{userCfg}, validated)
+}
+
 func TestStore_FullState(t *testing.T) {
 	ctx := context.Background()
 	store, _ := prepareLocalStore(t)
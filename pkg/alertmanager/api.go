@@ -33,6 +33,7 @@ import (
 const (
 	errMarshallingYAML       = "error marshalling YAML Alertmanager config"
 	errValidatingConfig      = "error validating Alertmanager config"
+	errConfigViolatesPolicy  = "the Alertmanager config violates the config validation schema"
 	errReadingConfiguration  = "unable to read the Alertmanager config"
 	errStoringConfiguration  = "unable to store the Alertmanager config"
 	errDeletingConfiguration = "unable to delete the Alertmanager config"
@@ -147,6 +148,14 @@ func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if am.configValidationSchema != nil {
+		if err := am.configValidationSchema.Validate(cfgDesc.RawConfig); err != nil {
+			level.Warn(logger).Log("msg", errConfigViolatesPolicy, "err", err.Error())
+			http.Error(w, fmt.Sprintf("%s: %s", errConfigViolatesPolicy, err.Error()), http.StatusBadRequest)
+			return
+		}
+	}
+
 	err = am.store.SetAlertConfig(r.Context(), cfgDesc)
 	if err != nil {
 		level.Error(logger).Log("msg", errStoringConfiguration, "err", err.Error())
@@ -188,7 +197,7 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 		return fmt.Errorf("configuration provided is empty, if you'd like to remove your configuration please use the delete configuration endpoint")
 	}
 
-	amCfg, err := config.Load(cfg.RawConfig)
+	amCfg, _, err := loadAlertmanagerConfig(cfg.RawConfig)
 	if err != nil {
 		return err
 	}
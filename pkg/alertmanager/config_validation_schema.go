@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/inhibit"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigValidationSchema is an organizational policy the tenants Alertmanager configs must comply with,
+// on top of being valid configs. It's loaded from a YAML file.
+type ConfigValidationSchema struct {
+	// Fields which must be set in the root route, like group_by or repeat_interval.
+	RequiredRouteFields []string `yaml:"required_route_fields"`
+	// Label names every route but the root one must have a matcher on.
+	RequiredRouteMatchers []string `yaml:"required_route_matchers"`
+	// Receiver integrations which can't be used, like webhook or email.
+	ForbiddenReceiverIntegrations []string `yaml:"forbidden_receiver_integrations"`
+	// Regular expressions the values of the routes and inhibit rules label matchers must match, by label name.
+	MatcherValueConstraints map[string]string `yaml:"matcher_value_constraints"`
+
+	matcherValueConstraints map[string]*regexp.Regexp
+}
+
+// LoadConfigValidationSchema loads the config validation schema from the input YAML file.
+func LoadConfigValidationSchema(filename string) (*ConfigValidationSchema, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfigValidationSchema(content)
+}
+
+func parseConfigValidationSchema(content []byte) (*ConfigValidationSchema, error) {
+	schema := &ConfigValidationSchema{}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(schema); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	schema.matcherValueConstraints = make(map[string]*regexp.Regexp, len(schema.MatcherValueConstraints))
+	for name, expr := range schema.MatcherValueConstraints {
+		// The constraints are anchored, like the Alertmanager regular expression matchers.
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid matcher value constraint for label %q", name)
+		}
+		schema.matcherValueConstraints[name] = re
+	}
+
+	return schema, nil
+}
+
+// Validate returns an error if the input Alertmanager config doesn't comply with the schema.
+// The input config is expected to be valid.
+func (s *ConfigValidationSchema) Validate(rawCfg string) error {
+	root := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(rawCfg), &root); err != nil {
+		return err
+	}
+
+	if err := s.validateRequiredRouteFields(&root); err != nil {
+		return err
+	}
+	if err := s.validateReceiverIntegrations(&root); err != nil {
+		return err
+	}
+
+	cfg, _, err := loadAlertmanagerConfig(rawCfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Route != nil {
+		if err := s.validateRoutes(dispatch.NewRoute(cfg.Route, nil)); err != nil {
+			return err
+		}
+	}
+
+	for i := range cfg.InhibitRules {
+		rule := inhibit.NewInhibitRule(cfg.InhibitRules[i])
+		for _, matchers := range []labels.Matchers{rule.SourceMatchers, rule.TargetMatchers} {
+			for _, m := range matchers {
+				if err := s.validateMatcherValue(m); err != nil {
+					return fmt.Errorf("inhibit rule %d: %w", i, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *ConfigValidationSchema) validateRequiredRouteFields(root *yaml.Node) error {
+	route := yamlMappingValue(root, "route")
+
+	for _, field := range s.RequiredRouteFields {
+		if route == nil || yamlMappingValue(route, field) == nil {
+			return fmt.Errorf("the root route must set the %s field", field)
+		}
+	}
+	return nil
+}
+
+func (s *ConfigValidationSchema) validateReceiverIntegrations(root *yaml.Node) error {
+	if len(s.ForbiddenReceiverIntegrations) == 0 {
+		return nil
+	}
+
+	receivers := yamlMappingValue(root, "receivers")
+	if receivers == nil || receivers.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	for _, receiver := range receivers.Content {
+		if receiver.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(receiver.Content); i += 2 {
+			// The receiver integrations are configured in the <integration>_configs fields.
+			integration := strings.TrimSuffix(receiver.Content[i].Value, "_configs")
+			if integration == receiver.Content[i].Value || len(receiver.Content[i+1].Content) == 0 {
+				continue
+			}
+
+			for _, forbidden := range s.ForbiddenReceiverIntegrations {
+				if integration == forbidden {
+					name := ""
+					if n := yamlMappingValue(receiver, "name"); n != nil {
+						name = n.Value
+					}
+					return fmt.Errorf("receiver %q uses the %s integration, which is not allowed", name, integration)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ConfigValidationSchema) validateRoutes(root *dispatch.Route) error {
+	var err error
+	root.Walk(func(route *dispatch.Route) {
+		if err != nil {
+			return
+		}
+
+		// The root route matches all alerts, so it has no matchers.
+		if route != root {
+			for _, name := range s.RequiredRouteMatchers {
+				if !hasMatcherOn(route.Matchers, name) {
+					err = fmt.Errorf("route %s must have a matcher on the %s label", route.Key(), name)
+					return
+				}
+			}
+		}
+
+		for _, m := range route.Matchers {
+			if verr := s.validateMatcherValue(m); verr != nil {
+				err = fmt.Errorf("route %s: %w", route.Key(), verr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// validateMatcherValue returns an error if the input matcher value doesn't match the constraint of its label, if any.
+// The value of regular expression matchers is validated as is.
+func (s *ConfigValidationSchema) validateMatcherValue(m *labels.Matcher) error {
+	re, ok := s.matcherValueConstraints[m.Name]
+	if !ok {
+		return nil
+	}
+
+	value := m.Value
+	if m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp {
+		// The regular expressions of the deprecated match_re fields are anchored when converted to matchers.
+		if strings.HasPrefix(value, "^(?:") && strings.HasSuffix(value, ")$") {
+			value = value[len("^(?:") : len(value)-len(")$")]
+		}
+	}
+
+	if re.MatchString(value) {
+		return nil
+	}
+	return fmt.Errorf("the value %q of the matcher on the %s label doesn't match the %q constraint", value, m.Name, s.MatcherValueConstraints[m.Name])
+}
+
+func hasMatcherOn(matchers labels.Matchers, name string) bool {
+	for _, m := range matchers {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+const testConfigValidationSchema = `
+required_route_fields: [group_by]
+required_route_matchers: [team]
+forbidden_receiver_integrations: [webhook]
+matcher_value_constraints:
+  team: payments|search
+`
+
+func TestConfigValidationSchema_Validate(t *testing.T) {
+	tests := map[string]struct {
+		config      string
+		expectedErr string
+	}{
+		"compliant config": {
+			config: `
+route:
+  receiver: default
+  group_by: [alertname]
+  routes:
+    - receiver: default
+      matchers: [team="payments"]
+    - receiver: default
+      match_re:
+        team: search
+      routes:
+        - receiver: default
+          matchers: [team="search", severity="critical"]
+inhibit_rules:
+  - source_matchers: [team="payments"]
+    target_matchers: [severity="warning"]
+receivers:
+  - name: default
+    email_configs:
+      - to: oncall@example.com
+        from: alertmanager@example.com
+        smarthost: smtp.example.com:25
+`,
+		},
+		"missing required root route field": {
+			config: `
+route:
+  receiver: default
+receivers:
+  - name: default
+`,
+			expectedErr: "the root route must set the group_by field",
+		},
+		"route without a required matcher": {
+			config: `
+route:
+  receiver: default
+  group_by: [alertname]
+  routes:
+    - receiver: default
+      matchers: [team="payments"]
+      routes:
+        - receiver: default
+          matchers: [severity="critical"]
+receivers:
+  - name: default
+`,
+			expectedErr: `route {}/{team="payments"}/{severity="critical"} must have a matcher on the team label`,
+		},
+		"route matcher violating a constraint": {
+			config: `
+route:
+  receiver: default
+  group_by: [alertname]
+  routes:
+    - receiver: default
+      match:
+        team: marketing
+receivers:
+  - name: default
+`,
+			expectedErr: `the value "marketing" of the matcher on the team label doesn't match the "payments|search" constraint`,
+		},
+		"inhibit rule matcher violating a constraint": {
+			config: `
+route:
+  receiver: default
+  group_by: [alertname]
+inhibit_rules:
+  - source_matchers: [team="payments-eu"]
+    target_matchers: [severity="warning"]
+receivers:
+  - name: default
+`,
+			expectedErr: `inhibit rule 0: the value "payments-eu" of the matcher on the team label doesn't match the "payments|search" constraint`,
+		},
+		"forbidden receiver integration": {
+			config: `
+route:
+  receiver: default
+  group_by: [alertname]
+receivers:
+  - name: default
+  - name: hook
+    webhook_configs:
+      - url: http://example.com/hook
+`,
+			expectedErr: `receiver "hook" uses the webhook integration, which is not allowed`,
+		},
+	}
+
+	schema, err := parseConfigValidationSchema([]byte(testConfigValidationSchema))
+	require.NoError(t, err)
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := schema.Validate(testData.config)
+			if testData.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testData.expectedErr)
+		})
+	}
+}
+
+func TestConfigValidationSchema_EmptySchemaAcceptsAllConfigs(t *testing.T) {
+	schema, err := parseConfigValidationSchema([]byte(""))
+	require.NoError(t, err)
+
+	require.NoError(t, schema.Validate(`
+route:
+  receiver: hook
+  routes:
+    - receiver: hook
+      matchers: [team="marketing"]
+receivers:
+  - name: hook
+    webhook_configs:
+      - url: http://example.com/hook
+`))
+}
+
+func TestLoadConfigValidationSchema(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.yaml")
+	require.NoError(t, os.WriteFile(valid, []byte(testConfigValidationSchema), 0600))
+
+	schema, err := LoadConfigValidationSchema(valid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group_by"}, schema.RequiredRouteFields)
+	assert.Equal(t, []string{"team"}, schema.RequiredRouteMatchers)
+	assert.Equal(t, []string{"webhook"}, schema.ForbiddenReceiverIntegrations)
+	assert.Equal(t, map[string]string{"team": "payments|search"}, schema.MatcherValueConstraints)
+
+	unknownField := filepath.Join(dir, "unknown.yaml")
+	require.NoError(t, os.WriteFile(unknownField, []byte("required_receivers: [default]"), 0600))
+	_, err = LoadConfigValidationSchema(unknownField)
+	require.Error(t, err)
+
+	invalidRegexp := filepath.Join(dir, "regexp.yaml")
+	require.NoError(t, os.WriteFile(invalidRegexp, []byte("matcher_value_constraints:\n  team: '('"), 0600))
+	_, err = LoadConfigValidationSchema(invalidRegexp)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid matcher value constraint for label "team"`)
+
+	_, err = LoadConfigValidationSchema(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestMultitenantAlertmanager_SetUserConfig_ConfigValidationSchema(t *testing.T) {
+	schema, err := parseConfigValidationSchema([]byte(testConfigValidationSchema))
+	require.NoError(t, err)
+
+	store := prepareInMemoryAlertStore()
+	am := &MultitenantAlertmanager{
+		store:                  store,
+		logger:                 util_log.Logger,
+		limits:                 &mockAlertManagerLimits{},
+		configValidationSchema: schema,
+	}
+
+	setConfig := func(cfg string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://alertmanager/api/v1/alerts", bytes.NewReader([]byte(cfg)))
+		w := httptest.NewRecorder()
+		am.SetUserConfig(w, req.WithContext(user.InjectOrgID(req.Context(), "user-1")))
+		return w
+	}
+
+	// A config violating the schema is rejected, and not stored.
+	resp := setConfig(`
+alertmanager_config: |
+  route:
+    receiver: default
+  receivers:
+    - name: default
+`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, errConfigViolatesPolicy+": the root route must set the group_by field\n", resp.Body.String())
+
+	_, err = store.GetAlertConfig(context.Background(), "user-1")
+	require.Error(t, err)
+
+	// A config complying with the schema is stored.
+	resp = setConfig(`
+alertmanager_config: |
+  route:
+    receiver: default
+    group_by: [alertname]
+  receivers:
+    - name: default
+`)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+	_, err = store.GetAlertConfig(context.Background(), "user-1")
+	require.NoError(t, err)
+}
@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// deduplicationWindowField is the receiver config field used to set the receiver deduplication window.
+// It's not supported by the upstream Alertmanager config, so it's removed from the config before loading it.
+const deduplicationWindowField = "deduplication_window"
+
+// ValidateConfig returns an error if the input Alertmanager config is not valid, including the
+// Mimir-specific extensions of the upstream config format.
+func ValidateConfig(rawCfg string) error {
+	_, _, err := loadAlertmanagerConfig(rawCfg)
+	return err
+}
+
+// configExtensions holds the Mimir-specific fields of an Alertmanager config, which are not supported by
+// the upstream config and are removed from it before loading it.
+type configExtensions struct {
+	// deduplicationWindows is the deduplication window of each receiver which has one.
+	deduplicationWindows map[string]time.Duration
+
+	// groupWaitJitters is the group wait jitter of each route which has one, keyed by the route path.
+	groupWaitJitters map[string]time.Duration
+}
+
+// loadAlertmanagerConfig loads the input Alertmanager config, and returns it along with its Mimir-specific
+// fields. The routes group wait jitter is validated.
+func loadAlertmanagerConfig(rawCfg string) (*config.Config, configExtensions, error) {
+	stripped, windows, err := extractDeduplicationWindows(rawCfg)
+	if err != nil {
+		return nil, configExtensions{}, err
+	}
+
+	stripped, jitters, err := extractGroupWaitJitters(stripped)
+	if err != nil {
+		return nil, configExtensions{}, err
+	}
+
+	cfg, err := config.Load(stripped)
+	if err != nil {
+		return nil, configExtensions{}, err
+	}
+
+	if err := validateGroupWaitJitters(cfg, jitters); err != nil {
+		return nil, configExtensions{}, err
+	}
+
+	return cfg, configExtensions{deduplicationWindows: windows, groupWaitJitters: jitters}, nil
+}
+
+// extractDeduplicationWindows returns the input config without the receivers deduplication window, along
+// with the deduplication window of each receiver which has one. The input config is returned as is if no
+// receiver has a deduplication window.
+func extractDeduplicationWindows(rawCfg string) (string, map[string]time.Duration, error) {
+	root := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(rawCfg), &root); err != nil {
+		// Let the config loading report the error.
+		return rawCfg, nil, nil
+	}
+
+	receivers := yamlMappingValue(&root, "receivers")
+	if receivers == nil || receivers.Kind != yaml.SequenceNode {
+		return rawCfg, nil, nil
+	}
+
+	windows := map[string]time.Duration{}
+	for _, receiver := range receivers.Content {
+		if receiver.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(receiver.Content); i += 2 {
+			if receiver.Content[i].Value != deduplicationWindowField {
+				continue
+			}
+
+			name := ""
+			if n := yamlMappingValue(receiver, "name"); n != nil {
+				name = n.Value
+			}
+
+			window, err := model.ParseDuration(receiver.Content[i+1].Value)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid %s for receiver %q: %w", deduplicationWindowField, name, err)
+			}
+			if window > 0 {
+				windows[name] = time.Duration(window)
+			}
+
+			receiver.Content = append(receiver.Content[:i], receiver.Content[i+2:]...)
+			break
+		}
+	}
+
+	if len(windows) == 0 {
+		return rawCfg, nil, nil
+	}
+
+	stripped, err := yaml.Marshal(&root)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(stripped), windows, nil
+}
+
+// yamlMappingValue returns the value of the input key in the mapping node, or in the mapping node
+// wrapped by the input document node. Returns nil if not found.
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// deduplicatingNotifier drops the alerts which have already been sent by the upstream notifier within
+// the deduplication window, regardless of the route repeat interval. Firing and resolved alerts are
+// deduplicated separately, so that an alert resolution is never dropped because the alert was firing.
+//
+// The alerts sent are tracked by a deduplicationState, which outlives the notifier so that the
+// deduplication isn't reset each time the config is applied. The state is kept in memory by each
+// Alertmanager replica and it's not replicated: the replicas of a tenant don't send a notification
+// already sent by another replica because of the replicated notification log, but a replica taking
+// over from another one doesn't know which alerts the other replica has deduplicated.
+type deduplicatingNotifier struct {
+	upstream notify.Notifier
+	window   time.Duration
+	counter  prometheus.Counter
+	state    *deduplicationState
+}
+
+type deduplicationKey struct {
+	fingerprint model.Fingerprint
+	resolved    bool
+}
+
+func newDeduplicatingNotifier(upstream notify.Notifier, window time.Duration, counter prometheus.Counter, state *deduplicationState) *deduplicatingNotifier {
+	return &deduplicatingNotifier{
+		upstream: upstream,
+		window:   window,
+		counter:  counter,
+		state:    state,
+	}
+}
+
+func (d *deduplicatingNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	now := time.Now()
+
+	d.state.mtx.Lock()
+	d.state.removeExpired(now, d.window)
+
+	toSend := make([]*types.Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if _, ok := d.state.lastSent[newDeduplicationKey(alert)]; ok {
+			continue
+		}
+		toSend = append(toSend, alert)
+	}
+	d.state.mtx.Unlock()
+
+	if dropped := len(alerts) - len(toSend); dropped > 0 {
+		d.counter.Add(float64(dropped))
+	}
+
+	// Nothing to do if all alerts have already been sent within the window.
+	if len(toSend) == 0 {
+		return false, nil
+	}
+
+	retry, err := d.upstream.Notify(ctx, toSend...)
+	if err != nil {
+		return retry, err
+	}
+
+	d.state.mtx.Lock()
+	for _, alert := range toSend {
+		d.state.lastSent[newDeduplicationKey(alert)] = now
+	}
+	d.state.mtx.Unlock()
+
+	return retry, nil
+}
+
+// deduplicationState holds the alerts sent by a receiver integration with a deduplication window.
+type deduplicationState struct {
+	mtx      sync.Mutex
+	lastSent map[deduplicationKey]time.Time
+}
+
+// removeExpired removes the alerts sent before the deduplication window. Must be called with the lock held.
+func (s *deduplicationState) removeExpired(now time.Time, window time.Duration) {
+	for key, sentAt := range s.lastSent {
+		if now.Sub(sentAt) >= window {
+			delete(s.lastSent, key)
+		}
+	}
+}
+
+// deduplicationStateKey identifies a receiver integration: the integration name is its type, and the
+// index is its position among the integrations of the same type in the receiver.
+type deduplicationStateKey struct {
+	receiver    string
+	integration string
+	idx         int
+}
+
+// deduplicationStates holds the deduplicationState of each receiver integration with a deduplication window.
+type deduplicationStates struct {
+	mtx    sync.Mutex
+	states map[deduplicationStateKey]*deduplicationState
+}
+
+func newDeduplicationStates() *deduplicationStates {
+	return &deduplicationStates{states: map[deduplicationStateKey]*deduplicationState{}}
+}
+
+// get returns the state of the input receiver integration, creating it if it doesn't exist.
+func (s *deduplicationStates) get(key deduplicationStateKey) *deduplicationState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	state, ok := s.states[key]
+	if !ok {
+		state = &deduplicationState{lastSent: map[deduplicationKey]time.Time{}}
+		s.states[key] = state
+	}
+	return state
+}
+
+// retain removes the states of the receiver integrations not in the input set.
+func (s *deduplicationStates) retain(keys map[deduplicationStateKey]struct{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for key := range s.states {
+		if _, ok := keys[key]; !ok {
+			delete(s.states, key)
+		}
+	}
+}
+
+func newDeduplicationKey(alert *types.Alert) deduplicationKey {
+	return deduplicationKey{
+		fingerprint: alert.Fingerprint(),
+		resolved:    alert.Resolved(),
+	}
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAlertmanagerConfig(t *testing.T) {
+	tests := map[string]struct {
+		config          string
+		expectedWindows map[string]time.Duration
+		expectedErr     string
+	}{
+		"no deduplication window": {
+			config: `
+route:
+  receiver: slack
+receivers:
+  - name: slack
+`,
+		},
+		"deduplication window on some receivers": {
+			config: `
+route:
+  receiver: slack
+  routes:
+    - receiver: email
+receivers:
+  - name: slack
+    deduplication_window: 1h
+    slack_configs:
+      - api_url: http://localhost/slack
+        channel: alerts
+  - name: email
+`,
+			expectedWindows: map[string]time.Duration{"slack": time.Hour},
+		},
+		"invalid deduplication window": {
+			config: `
+route:
+  receiver: slack
+receivers:
+  - name: slack
+    deduplication_window: invalid
+`,
+			expectedErr: `invalid deduplication_window for receiver "slack"`,
+		},
+		"unknown receiver field": {
+			config: `
+route:
+  receiver: slack
+receivers:
+  - name: slack
+    unknown: 1h
+`,
+			expectedErr: "field unknown not found",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg, ext, err := loadAlertmanagerConfig(testData.config)
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedWindows, ext.deduplicationWindows)
+
+			// The rest of the config should be preserved.
+			assert.Equal(t, "slack", cfg.Route.Receiver)
+			if ext.deduplicationWindows["slack"] > 0 {
+				require.Len(t, cfg.Receivers, 2)
+				require.Len(t, cfg.Receivers[0].SlackConfigs, 1)
+				assert.Equal(t, "alerts", cfg.Receivers[0].SlackConfigs[0].Channel)
+			}
+		})
+	}
+}
+
+func TestDeduplicatingNotifier(t *testing.T) {
+	upstream := &recordingNotifier{}
+	counter := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	states := newDeduplicationStates()
+	key := deduplicationStateKey{receiver: "receiver", integration: "webhook"}
+	notifier := newDeduplicatingNotifier(upstream, 200*time.Millisecond, counter, states.get(key))
+
+	newAlert := func(name string, resolved bool) *types.Alert {
+		alert := &types.Alert{}
+		alert.Labels = model.LabelSet{"alertname": model.LabelValue(name)}
+		alert.StartsAt = time.Now().Add(-time.Hour)
+		if resolved {
+			alert.EndsAt = time.Now().Add(-time.Minute)
+		}
+		return alert
+	}
+
+	notify := func(alerts ...*types.Alert) {
+		_, err := notifier.Notify(context.Background(), alerts...)
+		require.NoError(t, err)
+	}
+
+	// The first notification is sent as is.
+	notify(newAlert("a", false), newAlert("b", false))
+	assert.Equal(t, [][]string{{"a", "b"}}, upstream.sent)
+
+	// The alerts already sent within the window are dropped.
+	notify(newAlert("a", false), newAlert("b", false), newAlert("c", false))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, upstream.sent)
+	assert.Equal(t, float64(2), testutil.ToFloat64(counter))
+
+	// Nothing is sent if all alerts have already been sent within the window.
+	notify(newAlert("a", false))
+	assert.Len(t, upstream.sent, 2)
+	assert.Equal(t, float64(3), testutil.ToFloat64(counter))
+
+	// The resolution of an alert is not dropped because the alert was firing.
+	notify(newAlert("a", true))
+	assert.Equal(t, []string{"a"}, upstream.sent[2])
+
+	// The alerts failed to be sent are not deduplicated.
+	upstream.err = errors.New("failed")
+	_, err := notifier.Notify(context.Background(), newAlert("d", false))
+	require.Error(t, err)
+
+	upstream.err = nil
+	notify(newAlert("d", false))
+	assert.Equal(t, []string{"d"}, upstream.sent[len(upstream.sent)-1])
+
+	// The state is kept when the notifier is rebuilt for the same receiver integration, like when the config is applied again.
+	notifier = newDeduplicatingNotifier(upstream, 200*time.Millisecond, counter, states.get(key))
+	notify(newAlert("d", false))
+	assert.Equal(t, []string{"d"}, upstream.sent[len(upstream.sent)-1])
+	assert.Equal(t, float64(4), testutil.ToFloat64(counter))
+
+	// Other integrations of the receiver have their own state.
+	other := newDeduplicatingNotifier(upstream, 200*time.Millisecond, counter, states.get(deduplicationStateKey{receiver: "receiver", integration: "webhook", idx: 1}))
+	_, err = other.Notify(context.Background(), newAlert("d", false))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, upstream.sent[len(upstream.sent)-1])
+	assert.Equal(t, float64(4), testutil.ToFloat64(counter))
+
+	// The alerts are sent again once the window has elapsed.
+	time.Sleep(250 * time.Millisecond)
+	notify(newAlert("a", false))
+	assert.Equal(t, []string{"a"}, upstream.sent[len(upstream.sent)-1])
+	assert.Equal(t, float64(4), testutil.ToFloat64(counter))
+
+	// The states of the receiver integrations removed from the config are dropped.
+	states.retain(map[deduplicationStateKey]struct{}{key: {}})
+	assert.Len(t, states.states, 1)
+	assert.Contains(t, states.states, key)
+}
+
+// recordingNotifier records the names of the alerts sent by each notification.
+type recordingNotifier struct {
+	sent [][]string
+	err  error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alerts ...*types.Alert) (bool, error) {
+	if n.err != nil {
+		return true, n.err
+	}
+
+	names := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		names = append(names, alert.Name())
+	}
+	n.sent = append(n.sent, names)
+	return false, nil
+}
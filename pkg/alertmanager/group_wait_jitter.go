@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// groupWaitJitterField is the route config field used to set the route group wait jitter.
+// It's not supported by the upstream Alertmanager config, so it's removed from the config before loading it.
+const groupWaitJitterField = "group_wait_jitter"
+
+// extractGroupWaitJitters returns the input config without the routes group wait jitter, along with the
+// group wait jitter of each route which has one, keyed by the route path in the routing tree (see routePath).
+// The input config is returned as is if no route has a group wait jitter.
+func extractGroupWaitJitters(rawCfg string) (string, map[string]time.Duration, error) {
+	root := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(rawCfg), &root); err != nil {
+		// Let the config loading report the error.
+		return rawCfg, nil, nil
+	}
+
+	route := yamlMappingValue(&root, "route")
+	if route == nil {
+		return rawCfg, nil, nil
+	}
+
+	jitters := map[string]time.Duration{}
+	if err := extractRouteGroupWaitJitters(route, "", jitters); err != nil {
+		return "", nil, err
+	}
+
+	if len(jitters) == 0 {
+		return rawCfg, nil, nil
+	}
+
+	stripped, err := yaml.Marshal(&root)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(stripped), jitters, nil
+}
+
+// extractRouteGroupWaitJitters removes the group wait jitter from the input route node and its child
+// routes, and adds it to jitters.
+func extractRouteGroupWaitJitters(route *yaml.Node, path string, jitters map[string]time.Duration) error {
+	if route.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(route.Content); i += 2 {
+		if route.Content[i].Value != groupWaitJitterField {
+			continue
+		}
+
+		jitter, err := model.ParseDuration(route.Content[i+1].Value)
+		if err != nil {
+			return fmt.Errorf("invalid %s for route %q: %w", groupWaitJitterField, path, err)
+		}
+		if jitter > 0 {
+			jitters[path] = time.Duration(jitter)
+		}
+
+		route.Content = append(route.Content[:i], route.Content[i+2:]...)
+		break
+	}
+
+	routes := yamlMappingValue(route, "routes")
+	if routes == nil || routes.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	for i, child := range routes.Content {
+		if err := extractRouteGroupWaitJitters(child, routePath(path, i), jitters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routePath returns the path of the i-th child of the route at the input path. The root route path
+// is the empty string, and the path of a child route is the slash-separated list of the indexes of
+// the route and its parents among their siblings (e.g. "0/2").
+func routePath(parent string, i int) string {
+	if parent == "" {
+		return strconv.Itoa(i)
+	}
+	return parent + "/" + strconv.Itoa(i)
+}
+
+// groupWaitJitterRoute is a route of the routing tree with a group wait jitter.
+type groupWaitJitterRoute struct {
+	key           string
+	jitter        time.Duration
+	groupInterval time.Duration
+}
+
+// resolveGroupWaitJitterRoutes returns the routes of the routing tree which have a group wait jitter,
+// with the jitters keyed by the route path as returned by extractGroupWaitJitters. Returns an error
+// if a route jitter is greater than half of the route group interval: the jitter delays the notification
+// within the notification pipeline, whose timeout is the group interval, so the cap leaves at least half
+// of the timeout to send the notification.
+func resolveGroupWaitJitterRoutes(root *dispatch.Route, jitters map[string]time.Duration) ([]groupWaitJitterRoute, error) {
+	var routes []groupWaitJitterRoute
+
+	var walk func(route *dispatch.Route, path string) error
+	walk = func(route *dispatch.Route, path string) error {
+		if jitter, ok := jitters[path]; ok {
+			if jitter > route.RouteOpts.GroupInterval/2 {
+				return fmt.Errorf("%s for route %q must be at most half of the route group_interval (%s)", groupWaitJitterField, path, route.RouteOpts.GroupInterval)
+			}
+
+			routes = append(routes, groupWaitJitterRoute{
+				key:           route.Key(),
+				jitter:        jitter,
+				groupInterval: route.RouteOpts.GroupInterval,
+			})
+		}
+
+		for i, child := range route.Routes {
+			if err := walk(child, routePath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, ""); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// groupWaitJitterStage delays the first notification of each aggregation group of the routes with a group
+// wait jitter by a duration up to the route jitter, on top of the route group wait. The delay is derived
+// from the aggregation group key, so that it's the same for a given group across Alertmanager replicas.
+// The delay counts towards the notification timeout, which is why the jitter is capped by
+// resolveGroupWaitJitterRoutes.
+type groupWaitJitterStage struct {
+	upstream notify.Stage
+	routes   []groupWaitJitterRoute
+
+	mtx sync.Mutex
+	// lastFlush is the time of the last notification of each aggregation group with a jitter.
+	lastFlush map[string]time.Time
+}
+
+func newGroupWaitJitterStage(upstream notify.Stage, routes []groupWaitJitterRoute) *groupWaitJitterStage {
+	return &groupWaitJitterStage{
+		upstream:  upstream,
+		routes:    routes,
+		lastFlush: map[string]time.Time{},
+	}
+}
+
+func (s *groupWaitJitterStage) Exec(ctx context.Context, l log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	groupKey, ok := notify.GroupKey(ctx)
+	if !ok {
+		return s.upstream.Exec(ctx, l, alerts...)
+	}
+
+	route, ok := s.routeOf(groupKey)
+	if !ok {
+		return s.upstream.Exec(ctx, l, alerts...)
+	}
+
+	now, ok := notify.Now(ctx)
+	if !ok {
+		now = time.Now()
+	}
+
+	// An aggregation group notifies every group interval for as long as it exists, so a group
+	// which hasn't notified in the last two group intervals is a new one.
+	s.mtx.Lock()
+	s.removeExpired(now)
+	_, flushed := s.lastFlush[groupKey]
+	s.lastFlush[groupKey] = now
+	s.mtx.Unlock()
+
+	if !flushed {
+		if delay := groupWaitJitter(groupKey, route.jitter); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx, nil, ctx.Err()
+			}
+		}
+	}
+
+	return s.upstream.Exec(ctx, l, alerts...)
+}
+
+// routeOf returns the route of the aggregation group with the input key, if the route has a jitter.
+func (s *groupWaitJitterStage) routeOf(groupKey string) (groupWaitJitterRoute, bool) {
+	// The aggregation group key is the route key followed by the group labels.
+	for _, route := range s.routes {
+		if strings.HasPrefix(groupKey, route.key+":") {
+			return route, true
+		}
+	}
+	return groupWaitJitterRoute{}, false
+}
+
+// removeExpired removes the aggregation groups which haven't notified in the last two group intervals.
+// Must be called with the lock held.
+func (s *groupWaitJitterStage) removeExpired(now time.Time) {
+	for groupKey, flushedAt := range s.lastFlush {
+		route, ok := s.routeOf(groupKey)
+		if !ok || now.Sub(flushedAt) > 2*route.groupInterval {
+			delete(s.lastFlush, groupKey)
+		}
+	}
+}
+
+// groupWaitJitter returns the jitter of the aggregation group with the input key, which is
+// deterministic and lower than the input max jitter.
+func groupWaitJitter(groupKey string, maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(groupKey))
+	return time.Duration(h.Sum64() % uint64(maxJitter))
+}
+
+// validateGroupWaitJitters validates the routes group wait jitter of the input config, loaded from the
+// config stripped by extractGroupWaitJitters.
+func validateGroupWaitJitters(cfg *config.Config, jitters map[string]time.Duration) error {
+	if len(jitters) == 0 || cfg.Route == nil {
+		return nil
+	}
+
+	_, err := resolveGroupWaitJitterRoutes(dispatch.NewRoute(cfg.Route, nil), jitters)
+	return err
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/alertmanager/dispatch"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAlertmanagerConfig_GroupWaitJitter(t *testing.T) {
+	tests := map[string]struct {
+		config          string
+		expectedJitters map[string]time.Duration
+		expectedErr     string
+	}{
+		"no group wait jitter": {
+			config: `
+route:
+  receiver: slack
+receivers:
+  - name: slack
+`,
+		},
+		"group wait jitter on some routes": {
+			config: `
+route:
+  receiver: slack
+  group_wait_jitter: 10s
+  routes:
+    - receiver: slack
+      matchers: [team="a"]
+    - receiver: slack
+      matchers: [team="b"]
+      routes:
+        - receiver: slack
+          matchers: [severity="critical"]
+          group_wait_jitter: 1m
+receivers:
+  - name: slack
+`,
+			expectedJitters: map[string]time.Duration{"": 10 * time.Second, "1/0": time.Minute},
+		},
+		"invalid group wait jitter": {
+			config: `
+route:
+  receiver: slack
+  routes:
+    - receiver: slack
+      group_wait_jitter: invalid
+receivers:
+  - name: slack
+`,
+			expectedErr: `invalid group_wait_jitter for route "0"`,
+		},
+		"group wait jitter equal to half of the group interval": {
+			config: `
+route:
+  receiver: slack
+  group_interval: 1m
+  routes:
+    - receiver: slack
+      group_wait_jitter: 30s
+receivers:
+  - name: slack
+`,
+			expectedJitters: map[string]time.Duration{"0": 30 * time.Second},
+		},
+		"group wait jitter greater than half of the group interval": {
+			config: `
+route:
+  receiver: slack
+  group_interval: 1m
+  routes:
+    - receiver: slack
+      group_wait_jitter: 31s
+receivers:
+  - name: slack
+`,
+			expectedErr: `group_wait_jitter for route "0" must be at most half of the route group_interval (1m0s)`,
+		},
+		"unknown route field": {
+			config: `
+route:
+  receiver: slack
+  unknown: 1m
+receivers:
+  - name: slack
+`,
+			expectedErr: "field unknown not found",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg, ext, err := loadAlertmanagerConfig(testData.config)
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, cfg.Route)
+			assert.Equal(t, testData.expectedJitters, ext.groupWaitJitters)
+		})
+	}
+}
+
+func TestGroupWaitJitter(t *testing.T) {
+	const maxJitter = time.Minute
+
+	first := groupWaitJitter(`{}:{alertname="a"}`, maxJitter)
+	assert.Equal(t, first, groupWaitJitter(`{}:{alertname="a"}`, maxJitter), "the jitter should be deterministic")
+	assert.Less(t, first, maxJitter)
+	assert.GreaterOrEqual(t, first, time.Duration(0))
+
+	assert.Equal(t, time.Duration(0), groupWaitJitter(`{}:{alertname="a"}`, 0))
+
+	// Different groups should be spread over the jitter.
+	jitters := map[time.Duration]struct{}{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		jitters[groupWaitJitter(`{}:{alertname="`+name+`"}`, maxJitter)] = struct{}{}
+	}
+	assert.Greater(t, len(jitters), 1)
+}
+
+func TestGroupWaitJitterStage(t *testing.T) {
+	cfg, _, err := loadAlertmanagerConfig(`
+route:
+  receiver: slack
+  group_interval: 5m
+  routes:
+    - receiver: slack
+      matchers: [team="a"]
+      group_wait_jitter: 200ms
+receivers:
+  - name: slack
+`)
+	require.NoError(t, err)
+
+	root := dispatch.NewRoute(cfg.Route, nil)
+	routes, err := resolveGroupWaitJitterRoutes(root, map[string]time.Duration{"0": 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	upstream := &countingStage{}
+	stage := newGroupWaitJitterStage(upstream, routes)
+
+	jitteredKey := root.Routes[0].Key() + `:{alertname="a"}`
+	expectedDelay := groupWaitJitter(jitteredKey, 200*time.Millisecond)
+
+	exec := func(groupKey string, now time.Time) time.Duration {
+		ctx := notify.WithGroupKey(context.Background(), groupKey)
+		ctx = notify.WithNow(ctx, now)
+
+		start := time.Now()
+		_, _, err := stage.Exec(ctx, log.NewNopLogger(), &types.Alert{})
+		require.NoError(t, err)
+		return time.Since(start)
+	}
+
+	now := time.Now()
+
+	// The first notification of a group of a route with a jitter is delayed.
+	assert.GreaterOrEqual(t, exec(jitteredKey, now), expectedDelay)
+
+	// The following notifications of the group are not delayed.
+	assert.Less(t, exec(jitteredKey, now.Add(5*time.Minute)), expectedDelay)
+
+	// A group which hasn't notified in the last two group intervals is a new one.
+	assert.GreaterOrEqual(t, exec(jitteredKey, now.Add(20*time.Minute)), expectedDelay)
+
+	// The notifications of the routes without a jitter are never delayed.
+	exec(root.Key()+`:{alertname="a"}`, now)
+
+	assert.Equal(t, 4, upstream.calls)
+}
+
+func TestGroupWaitJitterStage_ContextCanceled(t *testing.T) {
+	upstream := &countingStage{}
+	stage := newGroupWaitJitterStage(upstream, []groupWaitJitterRoute{{key: "{}", jitter: time.Hour, groupInterval: 2 * time.Hour}})
+
+	// Find a group with a non-zero jitter.
+	groupKey := `{}:{alertname="a"}`
+	require.Greater(t, groupWaitJitter(groupKey, time.Hour), time.Duration(0))
+
+	ctx, cancel := context.WithCancel(notify.WithGroupKey(context.Background(), groupKey))
+	cancel()
+
+	_, _, err := stage.Exec(ctx, log.NewNopLogger(), &types.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "a"}}})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, upstream.calls)
+}
+
+type countingStage struct {
+	calls int
+}
+
+func (s *countingStage) Exec(ctx context.Context, _ log.Logger, alerts ...*types.Alert) (context.Context, []*types.Alert, error) {
+	s.calls++
+	return ctx, alerts, nil
+}
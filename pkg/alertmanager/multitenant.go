@@ -60,6 +60,9 @@ var (
 	errInvalidExternalURLMissingHostname   = errors.New("the configured external URL is invalid because it's missing the hostname")
 	errZoneAwarenessEnabledWithoutZoneInfo = errors.New("the configured alertmanager has zone awareness enabled but zone is not set")
 	errNotUploadingFallback                = errors.New("not uploading fallback configuration")
+	errInvalidSilenceGCInterval            = errors.New("the silences garbage collection interval must be greater than or equal to 0")
+	errInvalidSilenceRetentionAfterExpiry  = errors.New("the silences retention after expiry must be greater than or equal to 0")
+	errSilenceGCIntervalAboveRetention     = errors.New("the silences garbage collection interval must not be greater than the silences retention")
 )
 
 // MultitenantAlertmanagerConfig is the configuration for a multitenant Alertmanager.
@@ -86,6 +89,11 @@ type MultitenantAlertmanagerConfig struct {
 
 	// For the state persister.
 	Persister PersisterConfig `yaml:",inline"`
+
+	SilenceGCInterval           time.Duration `yaml:"silence_gc_interval" category:"experimental"`
+	SilenceRetentionAfterExpiry time.Duration `yaml:"silence_retention_after_expiry" category:"experimental"`
+
+	ConfigValidationSchemaFile string `yaml:"config_validation_schema_file" category:"experimental"`
 }
 
 const (
@@ -112,6 +120,10 @@ func (cfg *MultitenantAlertmanagerConfig) RegisterFlags(f *flag.FlagSet, logger
 	cfg.ShardingRing.RegisterFlags(f, logger)
 
 	f.DurationVar(&cfg.PeerTimeout, "alertmanager.peer-timeout", defaultPeerTimeout, "Time to wait between peers to send notifications.")
+
+	f.DurationVar(&cfg.SilenceGCInterval, "alertmanager.silence-gc-interval", 0, "How frequently to run the silences maintenance, which removes the expired silences from the Alertmanager state once their retention after expiry has elapsed, and snapshots the remaining ones. The removed silences are removed from the object storage the next time the state is persisted. Must not be greater than the silences retention. 0 to run it every 15 minutes.")
+	f.DurationVar(&cfg.SilenceRetentionAfterExpiry, "alertmanager.silence-retention-after-expiry", 0, "How long expired silences are retained before being removed. Applies to the silences created or updated after it has been set. 0 to use -alertmanager.storage.retention.")
+	f.StringVar(&cfg.ConfigValidationSchemaFile, "alertmanager.config-validation-schema-file", "", "Filename of the config validation schema, defining the policy the Alertmanager configs uploaded by the tenants must comply with. Configs which don't comply are rejected by the config API.")
 }
 
 // Validate config and returns error on failure
@@ -139,6 +151,22 @@ func (cfg *MultitenantAlertmanagerConfig) Validate() error {
 		return err
 	}
 
+	if cfg.SilenceGCInterval < 0 {
+		return errInvalidSilenceGCInterval
+	}
+
+	if cfg.SilenceRetentionAfterExpiry < 0 {
+		return errInvalidSilenceRetentionAfterExpiry
+	}
+
+	silencesRetention := cfg.Retention
+	if cfg.SilenceRetentionAfterExpiry > 0 {
+		silencesRetention = cfg.SilenceRetentionAfterExpiry
+	}
+	if cfg.SilenceGCInterval > silencesRetention {
+		return errSilenceGCIntervalAboveRetention
+	}
+
 	if cfg.ShardingRing.ZoneAwarenessEnabled && cfg.ShardingRing.InstanceZone == "" {
 		return errZoneAwarenessEnabledWithoutZoneInfo
 	}
@@ -219,6 +247,13 @@ type Limits interface {
 	// AlertmanagerMaxAlertsSizeBytes returns total max size of alerts that tenant can have active at the same time. 0 = no limit.
 	// Size of the alert is computed from alert labels, annotations and generator URL.
 	AlertmanagerMaxAlertsSizeBytes(tenant string) int
+
+	// AlertmanagerMaxUniqueAlertsPerMinute returns max number of new unique alerts that tenant can create per minute. 0 = no limit.
+	AlertmanagerMaxUniqueAlertsPerMinute(tenant string) int
+
+	// AlertmanagerWebhookSignatureSecret returns the secret used to verify the signature of the inbound webhook
+	// requests. If empty, the signature is not verified.
+	AlertmanagerWebhookSignatureSecret(tenant string) string
 }
 
 // A MultitenantAlertmanager manages Alertmanager instances for multiple
@@ -239,6 +274,9 @@ type MultitenantAlertmanager struct {
 	distributor    *Distributor
 	grpcServer     *server.Server
 
+	// Handler of the requests received by ServeHTTP(), distributing them to the Alertmanager replicas.
+	distributorHandler http.Handler
+
 	// Last ring state. This variable is not protected with a mutex because it's always
 	// accessed by a single goroutine at a time.
 	ringLastState ring.ReplicationSet
@@ -254,6 +292,9 @@ type MultitenantAlertmanager struct {
 	// effect here.
 	fallbackConfig string
 
+	// Policy the configs uploaded through the config API must comply with, nil if disabled.
+	configValidationSchema *ConfigValidationSchema
+
 	alertmanagersMtx sync.Mutex
 	alertmanagers    map[string]*Alertmanager
 	// Stores the current set of configurations we're running in each tenant's Alertmanager.
@@ -289,12 +330,20 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, store alerts
 		if err != nil {
 			return nil, fmt.Errorf("unable to read fallback config %q: %s", cfg.FallbackConfigFile, err)
 		}
-		_, err = amconfig.LoadFile(cfg.FallbackConfigFile)
+		_, _, err = loadAlertmanagerConfig(string(fallbackConfig))
 		if err != nil {
 			return nil, fmt.Errorf("unable to load fallback config %q: %s", cfg.FallbackConfigFile, err)
 		}
 	}
 
+	var configValidationSchema *ConfigValidationSchema
+	if cfg.ConfigValidationSchemaFile != "" {
+		configValidationSchema, err = LoadConfigValidationSchema(cfg.ConfigValidationSchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load config validation schema %q: %s", cfg.ConfigValidationSchemaFile, err)
+		}
+	}
+
 	ringStore, err := kv.NewClient(
 		cfg.ShardingRing.KVStore,
 		ring.GetCodec(),
@@ -305,7 +354,13 @@ func NewMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, store alerts
 		return nil, errors.Wrap(err, "create KV store client")
 	}
 
-	return createMultitenantAlertmanager(cfg, fallbackConfig, store, ringStore, limits, logger, registerer)
+	am, err := createMultitenantAlertmanager(cfg, fallbackConfig, store, ringStore, limits, logger, registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	am.configValidationSchema = configValidationSchema
+	return am, nil
 }
 
 func createMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, fallbackConfig []byte, store alertstore.AlertStore, ringStore kv.Client, limits Limits, logger log.Logger, registerer prometheus.Registerer) (*MultitenantAlertmanager, error) {
@@ -376,6 +431,7 @@ func createMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, fallbackC
 	if err != nil {
 		return nil, errors.Wrap(err, "create distributor")
 	}
+	am.distributorHandler = NewWebhookSignatureVerifier(limits, logger, am.registry).Wrap(http.HandlerFunc(am.distributor.DistributeRequest))
 
 	if registerer != nil {
 		registerer.MustRegister(am.alertmanagerMetrics)
@@ -626,7 +682,10 @@ func (am *MultitenantAlertmanager) syncConfigs(cfgs map[string]alertspb.AlertCon
 // setConfig applies the given configuration to the alertmanager for `userID`,
 // creating an alertmanager if it doesn't already exist.
 func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error {
-	var userAmConfig *amconfig.Config
+	var (
+		userAmConfig *amconfig.Config
+		userAmExt    configExtensions
+	)
 	var err error
 	var hasTemplateChanges bool
 	var userTemplateDir = filepath.Join(am.getTenantDirectory(cfg.User), templatesDir)
@@ -677,13 +736,13 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 			return fmt.Errorf("blank Alertmanager configuration for %v", cfg.User)
 		}
 		level.Debug(am.logger).Log("msg", "blank Alertmanager configuration; using fallback", "user", cfg.User)
-		userAmConfig, err = amconfig.Load(am.fallbackConfig)
+		userAmConfig, userAmExt, err = loadAlertmanagerConfig(am.fallbackConfig)
 		if err != nil {
 			return fmt.Errorf("unable to load fallback configuration for %v: %v", cfg.User, err)
 		}
 		rawCfg = am.fallbackConfig
 	} else {
-		userAmConfig, err = amconfig.Load(cfg.RawConfig)
+		userAmConfig, userAmExt, err = loadAlertmanagerConfig(cfg.RawConfig)
 		if err != nil && hasExisting {
 			// This means that if a user has a working config and
 			// they submit a broken one, the Manager will keep running the last known
@@ -703,7 +762,7 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 	// If no Alertmanager instance exists for this user yet, start one.
 	if !hasExisting {
 		level.Debug(am.logger).Log("msg", "initializing new per-tenant alertmanager", "user", cfg.User)
-		newAM, err := am.newAlertmanager(cfg.User, userAmConfig, rawCfg)
+		newAM, err := am.newAlertmanager(cfg.User, userAmConfig, userAmExt, rawCfg)
 		if err != nil {
 			return err
 		}
@@ -711,7 +770,7 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 	} else if am.cfgs[cfg.User].RawConfig != cfg.RawConfig || hasTemplateChanges {
 		level.Info(am.logger).Log("msg", "updating new per-tenant alertmanager", "user", cfg.User)
 		// If the config changed, apply the new one.
-		err := existing.ApplyConfig(cfg.User, userAmConfig, rawCfg)
+		err := existing.ApplyConfig(cfg.User, userAmConfig, userAmExt, rawCfg)
 		if err != nil {
 			return fmt.Errorf("unable to apply Alertmanager config for user %v: %v", cfg.User, err)
 		}
@@ -725,7 +784,7 @@ func (am *MultitenantAlertmanager) getTenantDirectory(userID string) string {
 	return filepath.Join(am.cfg.DataDir, userID)
 }
 
-func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amconfig.Config, rawCfg string) (*Alertmanager, error) {
+func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amconfig.Config, amExt configExtensions, rawCfg string) (*Alertmanager, error) {
 	reg := prometheus.NewRegistry()
 
 	tenantDir := am.getTenantDirectory(userID)
@@ -747,12 +806,14 @@ func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amco
 		Store:                             am.store,
 		PersisterConfig:                   am.cfg.Persister,
 		Limits:                            am.limits,
+		SilenceGCInterval:                 am.cfg.SilenceGCInterval,
+		SilenceRetentionAfterExpiry:       am.cfg.SilenceRetentionAfterExpiry,
 	}, reg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to start Alertmanager for user %v: %v", userID, err)
 	}
 
-	if err := newAM.ApplyConfig(userID, amConfig, rawCfg); err != nil {
+	if err := newAM.ApplyConfig(userID, amConfig, amExt, rawCfg); err != nil {
 		return nil, fmt.Errorf("unable to apply initial config for user %v: %v", userID, err)
 	}
 
@@ -793,7 +854,7 @@ func (am *MultitenantAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	am.distributor.DistributeRequest(w, req)
+	am.distributorHandler.ServeHTTP(w, req)
 }
 
 // HandleRequest implements gRPC Alertmanager service, which receives request from AlertManager-Distributor.
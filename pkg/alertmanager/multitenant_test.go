@@ -171,6 +171,26 @@ func TestMultitenantAlertmanagerConfig_Validate(t *testing.T) {
 			},
 			expected: errInvalidExternalURLMissingHostname,
 		},
+		"should fail if the silences GC interval is greater than the retention": {
+			setup: func(t *testing.T, cfg *MultitenantAlertmanagerConfig) {
+				cfg.SilenceGCInterval = cfg.Retention + time.Hour
+			},
+			expected: errSilenceGCIntervalAboveRetention,
+		},
+		"should fail if the silences GC interval is greater than the silences retention after expiry": {
+			setup: func(t *testing.T, cfg *MultitenantAlertmanagerConfig) {
+				cfg.SilenceGCInterval = 2 * time.Hour
+				cfg.SilenceRetentionAfterExpiry = time.Hour
+			},
+			expected: errSilenceGCIntervalAboveRetention,
+		},
+		"should pass if the silences GC interval is not greater than the silences retention after expiry": {
+			setup: func(t *testing.T, cfg *MultitenantAlertmanagerConfig) {
+				cfg.SilenceGCInterval = time.Hour
+				cfg.SilenceRetentionAfterExpiry = time.Hour
+			},
+			expected: nil,
+		},
 		"should fail if zone aware is enabled but zone is not set": {
 			setup: func(t *testing.T, cfg *MultitenantAlertmanagerConfig) {
 				cfg.ShardingRing.ZoneAwarenessEnabled = true
@@ -606,6 +626,86 @@ receivers:
 	}
 }
 
+func TestMultitenantAlertmanager_ShouldPassRulerSourceLabelsThroughToReceivers(t *testing.T) {
+	ctx := context.Background()
+	userID := "user-1"
+
+	// Create a local HTTP server to receive the webhook notifications.
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		select {
+		case received <- body:
+		default:
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	store := prepareInMemoryAlertStore()
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User: userID,
+		RawConfig: fmt.Sprintf(`
+route:
+  receiver: webhook
+  group_wait: 0s
+  group_interval: 1s
+
+receivers:
+  - name: webhook
+    webhook_configs:
+      - url: http://%s
+`, server.Listener.Addr().String()),
+	}))
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	cfg := mockAlertmanagerConfig(t)
+	am := setupSingleMultitenantAlertmanager(t, cfg, store, overrides, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	// Push an alert with the labels injected by the ruler.
+	sourceLabels := model.LabelSet{
+		model.AlertNameLabel:   "test",
+		"__ruler_tenant__":     "user-1",
+		"__ruler_rule_group__": "group-1",
+		"__ruler_rule_name__":  "test",
+	}
+	alertsPayload, err := json.Marshal(types.Alerts(&types.Alert{
+		Alert: model.Alert{
+			Labels:   sourceLabels,
+			StartsAt: time.Now().Add(-time.Minute),
+			EndsAt:   time.Now().Add(time.Minute),
+		},
+		UpdatedAt: time.Now(),
+	}))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, cfg.ExternalURL.String()+"/api/v1/alerts", bytes.NewReader(alertsPayload))
+	req.Header.Set("content-type", "application/json")
+	w := httptest.NewRecorder()
+	am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The notification payload should include the ruler source labels.
+	var notification struct {
+		Alerts []struct {
+			Labels model.LabelSet `json:"labels"`
+		} `json:"alerts"`
+	}
+	select {
+	case body := <-received:
+		require.NoError(t, json.Unmarshal(body, &notification))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the webhook notification has not been received")
+	}
+
+	require.Len(t, notification.Alerts, 1)
+	assert.Equal(t, sourceLabels, notification.Alerts[0].Labels)
+}
+
 func fileExists(t *testing.T, path string) bool {
 	return checkExists(t, path, false)
 }
@@ -2137,6 +2237,8 @@ type mockAlertManagerLimits struct {
 	maxDispatcherAggregationGroups int
 	maxAlertsCount                 int
 	maxAlertsSizeBytes             int
+	maxUniqueAlertsPerMinute       int
+	webhookSignatureSecret         string
 }
 
 func (m *mockAlertManagerLimits) AlertmanagerMaxConfigSize(tenant string) int {
@@ -2178,3 +2280,11 @@ func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsCount(_ string) int {
 func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsSizeBytes(_ string) int {
 	return m.maxAlertsSizeBytes
 }
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxUniqueAlertsPerMinute(_ string) int {
+	return m.maxUniqueAlertsPerMinute
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerWebhookSignatureSecret(_ string) string {
+	return m.webhookSignatureSecret
+}
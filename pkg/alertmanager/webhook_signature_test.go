@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package alertmanager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestWebhookSignatureVerifier(t *testing.T) {
+	const (
+		secret = "my-secret"
+		body   = `{"matchers":[{"name":"alertname","value":"test"}],"comment":"acknowledged"}`
+	)
+
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write([]byte(body))
+		return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := map[string]struct {
+		method         string
+		path           string
+		secret         string
+		signature      string
+		expectedStatus int
+		expectedFailed int
+	}{
+		"valid signature": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/silences",
+			secret:         secret,
+			signature:      sign(secret, body),
+			expectedStatus: http.StatusOK,
+		},
+		"missing signature": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/silences",
+			secret:         secret,
+			expectedStatus: http.StatusUnauthorized,
+			expectedFailed: 1,
+		},
+		"signature computed with another secret": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/silences",
+			secret:         secret,
+			signature:      sign("another-secret", body),
+			expectedStatus: http.StatusUnauthorized,
+			expectedFailed: 1,
+		},
+		"signature without the algorithm prefix": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v1/silences",
+			secret:         secret,
+			signature:      strings.TrimPrefix(sign(secret, body), webhookSignaturePrefix),
+			expectedStatus: http.StatusUnauthorized,
+			expectedFailed: 1,
+		},
+		"signature not hex-encoded": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/silences",
+			secret:         secret,
+			signature:      webhookSignaturePrefix + "xyz",
+			expectedStatus: http.StatusUnauthorized,
+			expectedFailed: 1,
+		},
+		"no secret configured for the tenant": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/silences",
+			expectedStatus: http.StatusOK,
+		},
+		"not a webhook request": {
+			method:         http.MethodGet,
+			path:           "/alertmanager/api/v2/silences",
+			secret:         secret,
+			expectedStatus: http.StatusOK,
+		},
+		"alerts are not verified": {
+			method:         http.MethodPost,
+			path:           "/alertmanager/api/v2/alerts",
+			secret:         secret,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			verifier := NewWebhookSignatureVerifier(&mockAlertManagerLimits{webhookSignatureSecret: testData.secret}, log.NewNopLogger(), reg)
+
+			var receivedBody string
+			handler := verifier.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				receivedBody = string(b)
+			}))
+
+			req := httptest.NewRequest(testData.method, testData.path, strings.NewReader(body))
+			req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+			if testData.signature != "" {
+				req.Header.Set(webhookSignatureHeader, testData.signature)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, testData.expectedStatus, rec.Code)
+			if testData.expectedStatus == http.StatusOK {
+				// The body must be fully available to the next handler.
+				assert.Equal(t, body, receivedBody)
+			}
+			assert.Equal(t, float64(testData.expectedFailed), testutil.ToFloat64(verifier.verificationFailures))
+		})
+	}
+}
+
+func TestWebhookSignatureVerifier_ShouldRejectRequestsWithoutTenant(t *testing.T) {
+	verifier := NewWebhookSignatureVerifier(&mockAlertManagerLimits{webhookSignatureSecret: "secret"}, log.NewNopLogger(), nil)
+	handler := verifier.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("the next handler should not be called")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/alertmanager/api/v2/silences", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
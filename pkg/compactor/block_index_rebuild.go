@@ -0,0 +1,301 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+const (
+	// indexSeriesAlignment is the alignment of the series entries in the index, since the series
+	// references are their offset divided by 16.
+	indexSeriesAlignment = 16
+
+	// indexTOCLen is the length of the table of contents at the end of the index.
+	indexTOCLen = 6*8 + crc32.Size
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// BlockIndexRebuildJob rebuilds the corrupted index of a block downloaded for compaction, so that the
+// block can be compacted instead of halting the compaction of the tenant.
+type BlockIndexRebuildJob struct {
+	rebuilds        prometheus.Counter
+	rebuildFailures prometheus.Counter
+	droppedSeries   prometheus.Counter
+}
+
+// NewBlockIndexRebuildJob makes a new BlockIndexRebuildJob.
+func NewBlockIndexRebuildJob(reg prometheus.Registerer) *BlockIndexRebuildJob {
+	return &BlockIndexRebuildJob{
+		rebuilds: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_block_index_rebuilds_total",
+			Help: "Total number of corrupted block indexes rebuilt before compaction.",
+		}),
+		rebuildFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_block_index_rebuilds_failed_total",
+			Help: "Total number of corrupted block indexes which failed to be rebuilt before compaction.",
+		}),
+		droppedSeries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_block_index_rebuild_dropped_series_total",
+			Help: "Total number of series read from corrupted block indexes but dropped while rebuilding them, because none of their chunks could be read.",
+		}),
+	}
+}
+
+// Run rebuilds the index of the block downloaded into blockDir, which has been detected as corrupted
+// because of corruptionErr, and returns the health stats of the rebuilt index.
+func (j *BlockIndexRebuildJob) Run(ctx context.Context, logger log.Logger, meta *metadata.Meta, blockDir string, corruptionErr error) (block.HealthStats, error) {
+	level.Warn(logger).Log("msg", "block index is corrupted, rebuilding it", "block", meta.ULID, "err", corruptionErr)
+
+	stats, err := rebuildIndex(ctx, blockDir)
+	if err != nil {
+		j.rebuildFailures.Inc()
+		return block.HealthStats{}, errors.Wrapf(err, "rebuild corrupted index of block %s (corruption: %v)", meta.ULID, corruptionErr)
+	}
+
+	j.rebuilds.Inc()
+	j.droppedSeries.Add(float64(stats.droppedSeries))
+	level.Info(logger).Log("msg", "rebuilt corrupted block index", "block", meta.ULID, "series", stats.series, "chunks", stats.chunks, "dropped_series", stats.droppedSeries, "dropped_chunks", stats.droppedChunks)
+
+	return block.GatherIndexHealthStats(logger, filepath.Join(blockDir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+}
+
+// RebuildIndex rebuilds the corrupted index of the block in blockDir from the chunk files.
+//
+// The chunk files don't hold the series labels, so the series are salvaged from the corrupted index:
+// its series entries are scanned one by one, skipping the ones failing the checksum verification and
+// the chunks which can't be read from the chunk files. The series list and the postings lists are then
+// reconstructed from the salvaged series, and written to a new index replacing the corrupted one.
+func RebuildIndex(ctx context.Context, blockDir string) error {
+	_, err := rebuildIndex(ctx, blockDir)
+	return err
+}
+
+type indexRebuildStats struct {
+	series, chunks, samples      int
+	droppedSeries, droppedChunks int
+}
+
+type salvagedSeries struct {
+	lset labels.Labels
+	chks []chunks.Meta
+}
+
+func rebuildIndex(ctx context.Context, blockDir string) (indexRebuildStats, error) {
+	chunkReader, err := chunks.NewDirReader(filepath.Join(blockDir, block.ChunksDirname), nil)
+	if err != nil {
+		return indexRebuildStats{}, errors.Wrap(err, "open chunks")
+	}
+	defer chunkReader.Close()
+
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	b, err := os.ReadFile(indexPath)
+	if err != nil {
+		return indexRebuildStats{}, errors.Wrap(err, "read index")
+	}
+
+	series, stats, err := salvageSeries(b, chunkReader)
+	if err != nil {
+		return indexRebuildStats{}, err
+	}
+	if len(series) == 0 {
+		return indexRebuildStats{}, errors.New("no series could be salvaged from the corrupted index")
+	}
+
+	// Write the new index aside, and replace the corrupted one only once it's complete.
+	tmpPath := indexPath + ".tmp"
+	if err := writeIndex(ctx, tmpPath, series); err != nil {
+		_ = os.Remove(tmpPath)
+		return indexRebuildStats{}, errors.Wrap(err, "write rebuilt index")
+	}
+	if err := os.Rename(tmpPath, indexPath); err != nil {
+		return indexRebuildStats{}, errors.Wrap(err, "replace corrupted index")
+	}
+
+	meta, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return indexRebuildStats{}, errors.Wrap(err, "read meta")
+	}
+	meta.Stats.NumSeries = uint64(stats.series)
+	meta.Stats.NumChunks = uint64(stats.chunks)
+	meta.Stats.NumSamples = uint64(stats.samples)
+	if err := meta.WriteToDir(log.NewNopLogger(), blockDir); err != nil {
+		return indexRebuildStats{}, errors.Wrap(err, "write meta")
+	}
+
+	return stats, nil
+}
+
+// salvageSeries returns the series which can be read from the input index, sorted by labels, keeping
+// only their chunks which can be read from the chunk files.
+func salvageSeries(b []byte, chunkReader *chunks.Reader) ([]salvagedSeries, indexRebuildStats, error) {
+	stats := indexRebuildStats{}
+
+	if len(b) < index.HeaderLen || binary.BigEndian.Uint32(b[0:4]) != index.MagicIndex {
+		return nil, stats, errors.New("invalid index magic number")
+	}
+	if version := int(b[4]); version != index.FormatV2 {
+		return nil, stats, errors.Errorf("unsupported index format version %d", version)
+	}
+
+	bs := indexByteSlice(b)
+
+	// The symbols table is required to resolve the series labels, so it must not be corrupted.
+	symbols, err := index.NewSymbols(bs, index.FormatV2, index.HeaderLen)
+	if err != nil {
+		return nil, stats, errors.Wrap(err, "read symbols table")
+	}
+
+	start, end := seriesSectionRange(bs)
+	dec := index.Decoder{LookupSymbol: symbols.Lookup}
+
+	var result []salvagedSeries
+	for off := start; off < end; {
+		d := encoding.NewDecbufUvarintAt(bs, off, castagnoliTable)
+		if d.Err() != nil || d.Len() == 0 {
+			// The entry is corrupted, so its length can't be trusted: look for the next
+			// valid entry at the next aligned offset.
+			off += indexSeriesAlignment
+			continue
+		}
+
+		var (
+			entryLen = uvarintLen(d.Len()) + d.Len() + crc32.Size
+			lset     labels.Labels
+			chks     []chunks.Meta
+		)
+		if err := dec.Series(d.Get(), &lset, &chks); err != nil || len(lset) == 0 || !sort.IsSorted(lset) {
+			off += indexSeriesAlignment
+			continue
+		}
+		off = alignOffset(off+entryLen, indexSeriesAlignment)
+
+		valid := make([]chunks.Meta, 0, len(chks))
+		for _, chk := range chks {
+			c, err := chunkReader.Chunk(chk)
+			if err != nil {
+				stats.droppedChunks++
+				continue
+			}
+			stats.samples += c.NumSamples()
+			valid = append(valid, chk)
+		}
+		if len(valid) == 0 {
+			stats.droppedSeries++
+			continue
+		}
+
+		result = append(result, salvagedSeries{lset: lset, chks: valid})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return labels.Compare(result[i].lset, result[j].lset) < 0
+	})
+
+	// Remove duplicated series, which could only be salvaged from a corrupted area of the index.
+	deduped := result[:0]
+	for _, s := range result {
+		if len(deduped) > 0 && labels.Equal(deduped[len(deduped)-1].lset, s.lset) {
+			stats.droppedSeries++
+			continue
+		}
+		deduped = append(deduped, s)
+		stats.series++
+		stats.chunks += len(s.chks)
+	}
+
+	return deduped, stats, nil
+}
+
+// seriesSectionRange returns the range of the series section in the index. If the table of contents
+// is corrupted, the series section is assumed to span from the end of the symbols table to the end of
+// the index, since the series are always written right after the symbols.
+func seriesSectionRange(bs indexByteSlice) (start, end int) {
+	symbolsLen := int(binary.BigEndian.Uint32(bs.Range(index.HeaderLen, index.HeaderLen+4)))
+	start = alignOffset(index.HeaderLen+4+symbolsLen+crc32.Size, indexSeriesAlignment)
+	end = bs.Len() - indexTOCLen
+
+	if toc, err := index.NewTOCFromByteSlice(bs); err == nil && toc.Series == uint64(start) && toc.LabelIndices > toc.Series && toc.LabelIndices <= uint64(end) {
+		end = int(toc.LabelIndices)
+	}
+	return start, end
+}
+
+func writeIndex(ctx context.Context, path string, series []salvagedSeries) error {
+	w, err := index.NewWriter(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	symbols := map[string]struct{}{}
+	for _, s := range series {
+		for _, l := range s.lset {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(symbols))
+	for sym := range symbols {
+		sorted = append(sorted, sym)
+	}
+	sort.Strings(sorted)
+
+	for _, sym := range sorted {
+		if err := w.AddSymbol(sym); err != nil {
+			_ = w.Close()
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+
+	// The postings lists are built by the index writer from the added series.
+	for i, s := range series {
+		if err := w.AddSeries(storage.SeriesRef(i), s.lset, s.chks...); err != nil {
+			_ = w.Close()
+			return errors.Wrap(err, "add series")
+		}
+	}
+
+	return w.Close()
+}
+
+func alignOffset(off, alignment int) int {
+	if rem := off % alignment; rem != 0 {
+		return off + alignment - rem
+	}
+	return off
+}
+
+func uvarintLen(x int) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], uint64(x))
+}
+
+// indexByteSlice implements index.ByteSlice over an in-memory index.
+type indexByteSlice []byte
+
+func (b indexByteSlice) Len() int {
+	return len(b)
+}
+
+func (b indexByteSlice) Range(start, end int) []byte {
+	return b[start:end]
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBlockIndexRebuildJob(t *testing.T) {
+	seriesA := labels.FromStrings("__name__", "metric", "series", "a")
+	seriesB := labels.FromStrings("__name__", "metric", "series", "b")
+	seriesC := labels.FromStrings("__name__", "metric", "series", "c")
+
+	newBlock := func(t *testing.T) (*metadata.Meta, string) {
+		return createBlockWithSamples(t, t.TempDir(), 1, []storage.Series{
+			storage.NewListSeries(seriesA, []tsdbutil.Sample{newSample(10, 1), newSample(20, 2)}),
+			storage.NewListSeries(seriesB, []tsdbutil.Sample{newSample(10, 3), newSample(20, 4)}),
+			storage.NewListSeries(seriesC, []tsdbutil.Sample{newSample(10, 5), newSample(20, 6)}),
+		})
+	}
+
+	t.Run("should rebuild the index from the series which can be salvaged", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+		indexPath := filepath.Join(blockDir, block.IndexFilename)
+		refs := readSeriesRefs(t, indexPath)
+
+		// Corrupt the entry of the series B in the index.
+		corruptFile(t, indexPath, int(refs[seriesB.String()].ref)*indexSeriesAlignment+2)
+
+		// Corrupt the chunk of the series C.
+		segment, offset := chunks.BlockChunkRef(refs[seriesC.String()].chks[0].Ref).Unpack()
+		corruptFile(t, filepath.Join(blockDir, block.ChunksDirname, fmt.Sprintf("%0.6d", segment+1)), offset+3)
+
+		// Corrupt the table of contents, so that the index can't be opened at all.
+		info, err := os.Stat(indexPath)
+		require.NoError(t, err)
+		corruptFile(t, indexPath, int(info.Size())-10)
+
+		_, err = block.GatherIndexHealthStats(log.NewNopLogger(), indexPath, meta.MinTime, meta.MaxTime)
+		require.Error(t, err)
+
+		job := NewBlockIndexRebuildJob(nil)
+		stats, err := job.Run(context.Background(), log.NewNopLogger(), meta, blockDir, err)
+		require.NoError(t, err)
+		require.NoError(t, stats.CriticalErr())
+
+		assert.Equal(t, map[string][]float64{seriesA.String(): {1, 2}}, readBlockSamples(t, blockDir))
+		assert.Equal(t, float64(1), testutil.ToFloat64(job.rebuilds))
+		assert.Equal(t, float64(0), testutil.ToFloat64(job.rebuildFailures))
+		assert.Equal(t, float64(1), testutil.ToFloat64(job.droppedSeries))
+
+		// The block stats should match the rebuilt index.
+		rebuiltMeta, err := metadata.ReadFromDir(blockDir)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), rebuiltMeta.Stats.NumSeries)
+		assert.Equal(t, uint64(1), rebuiltMeta.Stats.NumChunks)
+		assert.Equal(t, uint64(2), rebuiltMeta.Stats.NumSamples)
+	})
+
+	t.Run("should rebuild an index which is not corrupted to an equivalent one", func(t *testing.T) {
+		_, blockDir := newBlock(t)
+
+		require.NoError(t, RebuildIndex(context.Background(), blockDir))
+		assert.Equal(t, map[string][]float64{
+			seriesA.String(): {1, 2},
+			seriesB.String(): {3, 4},
+			seriesC.String(): {5, 6},
+		}, readBlockSamples(t, blockDir))
+	})
+
+	t.Run("should fail if the symbols table is corrupted", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+		indexPath := filepath.Join(blockDir, block.IndexFilename)
+		original, err := os.ReadFile(indexPath)
+		require.NoError(t, err)
+
+		corruptFile(t, indexPath, index.HeaderLen+10)
+
+		job := NewBlockIndexRebuildJob(nil)
+		_, err = job.Run(context.Background(), log.NewNopLogger(), meta, blockDir, nil)
+		require.Error(t, err)
+		assert.Equal(t, float64(0), testutil.ToFloat64(job.rebuilds))
+		assert.Equal(t, float64(1), testutil.ToFloat64(job.rebuildFailures))
+
+		// The corrupted index should be left untouched.
+		actual, err := os.ReadFile(indexPath)
+		require.NoError(t, err)
+		original[index.HeaderLen+10] ^= 0xff
+		assert.Equal(t, original, actual)
+	})
+}
+
+type seriesRef struct {
+	ref  storage.SeriesRef
+	chks []chunks.Meta
+}
+
+// readSeriesRefs returns the reference and the chunks of each series in the index, by series labels.
+func readSeriesRefs(t *testing.T, indexPath string) map[string]seriesRef {
+	reader, err := index.NewFileReader(indexPath)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, reader.Close()) }()
+
+	k, v := index.AllPostingsKey()
+	postings, err := reader.Postings(k, v)
+	require.NoError(t, err)
+
+	result := map[string]seriesRef{}
+	for postings.Next() {
+		var (
+			lset labels.Labels
+			chks []chunks.Meta
+		)
+		require.NoError(t, reader.Series(postings.At(), &lset, &chks))
+		result[lset.String()] = seriesRef{ref: postings.At(), chks: chks}
+	}
+	require.NoError(t, postings.Err())
+
+	return result
+}
+
+// corruptFile flips the bits of the byte at the input offset of the file.
+func corruptFile(t *testing.T, path string, offset int) {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	b[offset] ^= 0xff
+	require.NoError(t, os.WriteFile(path, b, 0666))
+}
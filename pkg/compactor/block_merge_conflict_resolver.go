@@ -0,0 +1,329 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"math"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// BlockMergeConflictResolver resolves the conflicts between overlapping blocks produced by different compaction
+// jobs (e.g. because of a race between compactors), before they're merged together. Two blocks conflict when
+// they contain a sample for the same series and timestamp, but with a different value: in that case the sample
+// written last wins. The write time of a block is the upload time recorded in its meta.json, falling back
+// to the time encoded in its ULID for the blocks uploaded without it: the ULID time is the time
+// the compaction started, which isn't the time the block was flushed by a slow or retried job.
+//
+// The samples losing the conflict are deleted from the downloaded source block through tombstones, which are
+// honored by the compaction, so that the merged block only contains the winning samples.
+type BlockMergeConflictResolver struct {
+	conflictingSamples prometheus.Counter
+}
+
+// NewBlockMergeConflictResolver makes a new BlockMergeConflictResolver.
+func NewBlockMergeConflictResolver(reg prometheus.Registerer) *BlockMergeConflictResolver {
+	return &BlockMergeConflictResolver{
+		conflictingSamples: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_merge_conflicting_samples_resolved_total",
+			Help: "Total number of conflicting samples between overlapping compacted blocks resolved with the last-write-wins rule.",
+		}),
+	}
+}
+
+// Resolve resolves the conflicts between the input blocks, which have been downloaded into the given
+// directories and uploaded to the bucket at the given times (zero if unknown). metas, dirs and
+// uploadTimes must have the same length and order.
+func (r *BlockMergeConflictResolver) Resolve(logger log.Logger, metas []*metadata.Meta, dirs []string, uploadTimes []time.Time) error {
+	if len(metas) != len(dirs) || len(metas) != len(uploadTimes) {
+		return errors.Errorf("mismatching number of blocks (%d), directories (%d) and upload times (%d)", len(metas), len(dirs), len(uploadTimes))
+	}
+
+	writeTimes := make([]time.Time, len(metas))
+	for i, meta := range metas {
+		writeTimes[i] = blockWriteTime(meta, uploadTimes[i])
+	}
+
+	// Blocks uploaded by ingesters overlap by design, and their duplicated samples are expected to be
+	// identical, so only the blocks produced by compaction jobs are checked for conflicts.
+	var candidates []int
+	for i, meta := range metas {
+		if meta.Compaction.Level > 1 {
+			candidates = append(candidates, i)
+		}
+	}
+
+	deletions := map[int]*tombstones.MemTombstones{}
+
+	for x := 0; x < len(candidates); x++ {
+		for y := x + 1; y < len(candidates); y++ {
+			winner, loser := candidates[x], candidates[y]
+			if !blocksOverlap(metas[winner], metas[loser]) {
+				continue
+			}
+			if writtenBefore(writeTimes[winner], metas[winner].ULID, writeTimes[loser], metas[loser].ULID) {
+				winner, loser = loser, winner
+			}
+
+			if deletions[loser] == nil {
+				deletions[loser] = tombstones.NewMemTombstones()
+			}
+
+			series, samples, err := findConflictingSamples(logger, dirs[winner], dirs[loser], deletions[loser])
+			if err != nil {
+				return errors.Wrapf(err, "find conflicting samples between blocks %s and %s", metas[winner].ULID, metas[loser].ULID)
+			}
+			if samples == 0 {
+				continue
+			}
+
+			r.conflictingSamples.Add(float64(samples))
+			level.Warn(logger).Log(
+				"msg", "resolved conflicting samples between overlapping blocks using last-write-wins",
+				"winner", metas[winner].ULID,
+				"winner_write_time", writeTimes[winner],
+				"loser", metas[loser].ULID,
+				"loser_write_time", writeTimes[loser],
+				"conflicting_series", series,
+				"conflicting_samples", samples)
+		}
+	}
+
+	for idx, deleted := range deletions {
+		if deleted.Total() == 0 {
+			continue
+		}
+		if err := addBlockTombstones(logger, dirs[idx], deleted); err != nil {
+			return errors.Wrapf(err, "write tombstones for block %s", metas[idx].ULID)
+		}
+	}
+
+	return nil
+}
+
+func blocksOverlap(a, b *metadata.Meta) bool {
+	return a.MinTime < b.MaxTime && b.MinTime < a.MaxTime
+}
+
+// blockWriteTime returns the time the block has been written, which is its upload time if known,
+// or the time encoded in its ULID otherwise.
+func blockWriteTime(meta *metadata.Meta, uploadTime time.Time) time.Time {
+	if !uploadTime.IsZero() {
+		return uploadTime.UTC()
+	}
+	return time.UnixMilli(int64(meta.ULID.Time())).UTC()
+}
+
+// writtenBefore returns whether block a, written at aTime, has been written before block b, written at bTime.
+// Blocks written at the same time are ordered by ULID, to get a deterministic result.
+func writtenBefore(aTime time.Time, a ulid.ULID, bTime time.Time, b ulid.ULID) bool {
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	return a.Compare(b) < 0
+}
+
+// findConflictingSamples adds to deleted the samples of the loser block having the same series and
+// timestamp as a sample in the winner block, but a different value. Returns the number of conflicting
+// series and samples.
+func findConflictingSamples(logger log.Logger, winnerDir, loserDir string, deleted *tombstones.MemTombstones) (conflictingSeries, conflictingSamples int, err error) {
+	winner, err := openBlockSeries(logger, winnerDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer winner.close()
+
+	loser, err := openBlockSeries(logger, loserDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer loser.close()
+
+	// Both iterators return the series sorted by labels.
+	winnerOk, loserOk := winner.next(), loser.next()
+	for winnerOk && loserOk {
+		switch cmp := labels.Compare(winner.lset, loser.lset); {
+		case cmp < 0:
+			winnerOk = winner.next()
+		case cmp > 0:
+			loserOk = loser.next()
+		default:
+			winnerSamples, err := winner.samples()
+			if err != nil {
+				return 0, 0, err
+			}
+			loserSamples, err := loser.samples()
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if n := addConflictingSamples(loser.ref, winnerSamples, loserSamples, deleted); n > 0 {
+				conflictingSeries++
+				conflictingSamples += n
+			}
+
+			winnerOk, loserOk = winner.next(), loser.next()
+		}
+	}
+
+	if err := winner.err(); err != nil {
+		return 0, 0, err
+	}
+	if err := loser.err(); err != nil {
+		return 0, 0, err
+	}
+	return conflictingSeries, conflictingSamples, nil
+}
+
+// addConflictingSamples adds to deleted the loser samples conflicting with the winner ones, and returns their number.
+// Both the input slices must be sorted by timestamp.
+func addConflictingSamples(loserRef storage.SeriesRef, winner, loser []blockSample, deleted *tombstones.MemTombstones) int {
+	conflicts := 0
+	for w, l := 0, 0; w < len(winner) && l < len(loser); {
+		switch {
+		case winner[w].t < loser[l].t:
+			w++
+		case winner[w].t > loser[l].t:
+			l++
+		default:
+			if math.Float64bits(winner[w].v) != math.Float64bits(loser[l].v) {
+				deleted.AddInterval(loserRef, tombstones.Interval{Mint: loser[l].t, Maxt: loser[l].t})
+				conflicts++
+			}
+			w++
+			l++
+		}
+	}
+	return conflicts
+}
+
+// addBlockTombstones adds the input deletions to the tombstones of the block in dir.
+func addBlockTombstones(logger log.Logger, dir string, deleted *tombstones.MemTombstones) error {
+	existing, _, err := tombstones.ReadTombstones(dir)
+	if err != nil {
+		return err
+	}
+
+	err = existing.Iter(func(ref storage.SeriesRef, ivs tombstones.Intervals) error {
+		deleted.AddInterval(ref, ivs...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tombstones.WriteFile(logger, dir, deleted)
+	return err
+}
+
+type blockSample struct {
+	t int64
+	v float64
+}
+
+// blockSeries iterates the series of a block, sorted by labels.
+type blockSeries struct {
+	block    *tsdb.Block
+	indexr   tsdb.IndexReader
+	chunkr   tsdb.ChunkReader
+	postings index.Postings
+
+	ref  storage.SeriesRef
+	lset labels.Labels
+	chks []chunks.Meta
+
+	iterErr error
+}
+
+func openBlockSeries(logger log.Logger, dir string) (_ *blockSeries, err error) {
+	s := &blockSeries{}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	if s.block, err = tsdb.OpenBlock(logger, dir, nil); err != nil {
+		return nil, err
+	}
+	if s.indexr, err = s.block.Index(); err != nil {
+		return nil, err
+	}
+	if s.chunkr, err = s.block.Chunks(); err != nil {
+		return nil, err
+	}
+
+	k, v := index.AllPostingsKey()
+	all, err := s.indexr.Postings(k, v)
+	if err != nil {
+		return nil, err
+	}
+	s.postings = s.indexr.SortedPostings(all)
+	return s, nil
+}
+
+func (s *blockSeries) next() bool {
+	if s.iterErr != nil || !s.postings.Next() {
+		return false
+	}
+
+	s.ref = s.postings.At()
+	if err := s.indexr.Series(s.ref, &s.lset, &s.chks); err != nil {
+		s.iterErr = err
+		return false
+	}
+	return true
+}
+
+// samples returns the samples of the current series, sorted by timestamp.
+func (s *blockSeries) samples() ([]blockSample, error) {
+	var result []blockSample
+	for _, meta := range s.chks {
+		chk, err := s.chunkr.Chunk(meta)
+		if err != nil {
+			return nil, err
+		}
+
+		it := chk.Iterator(nil)
+		for it.Next() {
+			t, v := it.At()
+			result = append(result, blockSample{t: t, v: v})
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *blockSeries) err() error {
+	if s.iterErr != nil {
+		return s.iterErr
+	}
+	return s.postings.Err()
+}
+
+func (s *blockSeries) close() {
+	if s.chunkr != nil {
+		_ = s.chunkr.Close()
+	}
+	if s.indexr != nil {
+		_ = s.indexr.Close()
+	}
+	if s.block != nil {
+		_ = s.block.Close()
+	}
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBlockMergeConflictResolver(t *testing.T) {
+	seriesA := labels.FromStrings("__name__", "metric", "series", "a")
+	seriesB := labels.FromStrings("__name__", "metric", "series", "b")
+
+	tests := map[string]struct {
+		olderLevel, newerLevel     int
+		olderUploadedLast          bool
+		uploadTimesUnknown         bool
+		expectedConflictingSamples int
+		expected                   map[string][]float64
+	}{
+		"conflicts between compacted blocks are resolved with last-write-wins": {
+			olderLevel:                 2,
+			newerLevel:                 2,
+			expectedConflictingSamples: 1,
+			expected: map[string][]float64{
+				seriesA.String(): {1, 20, 3, 40},
+				seriesB.String(): {5, 6},
+			},
+		},
+		"the block uploaded last wins even if its ULID is older": {
+			olderLevel:                 2,
+			newerLevel:                 2,
+			olderUploadedLast:          true,
+			expectedConflictingSamples: 1,
+			expected: map[string][]float64{
+				seriesA.String(): {1, 2, 3, 40},
+				seriesB.String(): {5, 6},
+			},
+		},
+		"the ULID time is used when the upload time is unknown": {
+			olderLevel:                 2,
+			newerLevel:                 2,
+			uploadTimesUnknown:         true,
+			expectedConflictingSamples: 1,
+			expected: map[string][]float64{
+				seriesA.String(): {1, 20, 3, 40},
+				seriesB.String(): {5, 6},
+			},
+		},
+		"blocks uploaded by ingesters are not checked for conflicts": {
+			olderLevel:                 1,
+			newerLevel:                 2,
+			expectedConflictingSamples: 0,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			olderMeta, olderDir := createBlockWithSamples(t, dir, testData.olderLevel, []storage.Series{
+				storage.NewListSeries(seriesA, []tsdbutil.Sample{newSample(10, 1), newSample(20, 2), newSample(30, 3)}),
+				storage.NewListSeries(seriesB, []tsdbutil.Sample{newSample(10, 5), newSample(20, 6)}),
+			})
+
+			// Make sure the blocks have different ULID times.
+			time.Sleep(5 * time.Millisecond)
+
+			newerMeta, newerDir := createBlockWithSamples(t, dir, testData.newerLevel, []storage.Series{
+				storage.NewListSeries(seriesA, []tsdbutil.Sample{newSample(20, 20), newSample(30, 3), newSample(40, 40)}),
+				storage.NewListSeries(seriesB, []tsdbutil.Sample{newSample(20, 6)}),
+			})
+
+			now := time.Now()
+			olderUploadTime, newerUploadTime := now.Add(-time.Minute), now
+			if testData.olderUploadedLast {
+				olderUploadTime, newerUploadTime = newerUploadTime, olderUploadTime
+			}
+			if testData.uploadTimesUnknown {
+				olderUploadTime, newerUploadTime = time.Time{}, time.Time{}
+			}
+
+			resolver := NewBlockMergeConflictResolver(nil)
+
+			// Pass the newer block first, to check the input order doesn't matter.
+			metas := []*metadata.Meta{newerMeta, olderMeta}
+			dirs := []string{newerDir, olderDir}
+			uploadTimes := []time.Time{newerUploadTime, olderUploadTime}
+			require.NoError(t, resolver.Resolve(log.NewNopLogger(), metas, dirs, uploadTimes))
+			assert.Equal(t, float64(testData.expectedConflictingSamples), testutil.ToFloat64(resolver.conflictingSamples))
+
+			if testData.expected == nil {
+				return
+			}
+
+			// Merge the blocks, and check the conflicting samples of the block written last won.
+			compactor, err := tsdb.NewLeveledCompactor(context.Background(), nil, log.NewNopLogger(), []int64{1000}, nil, nil, true)
+			require.NoError(t, err)
+
+			outDir := t.TempDir()
+			id, err := compactor.Compact(outDir, dirs, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, testData.expected, readBlockSamples(t, filepath.Join(outDir, id.String())))
+		})
+	}
+}
+
+func createBlockWithSamples(t *testing.T, dir string, level int, series []storage.Series) (*metadata.Meta, string) {
+	blockDir, err := tsdb.CreateBlock(series, dir, 1000, log.NewNopLogger())
+	require.NoError(t, err)
+
+	meta, err := metadata.ReadFromDir(blockDir)
+	require.NoError(t, err)
+
+	meta.Compaction.Level = level
+	require.NoError(t, meta.WriteToDir(log.NewNopLogger(), blockDir))
+
+	return meta, blockDir
+}
+
+func readBlockSamples(t *testing.T, dir string) map[string][]float64 {
+	block, err := tsdb.OpenBlock(log.NewNopLogger(), dir, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, block.Close()) })
+
+	querier, err := tsdb.NewBlockQuerier(block, 0, 1000)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, querier.Close()) })
+
+	result := map[string][]float64{}
+	set := querier.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+	for set.Next() {
+		it := set.At().Iterator()
+		for it.Next() {
+			_, v := it.At()
+			result[set.At().Labels().String()] = append(result[set.At().Labels().String()], v)
+		}
+		require.NoError(t, it.Err())
+	}
+	require.NoError(t, set.Err())
+
+	return result
+}
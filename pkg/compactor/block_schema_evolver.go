@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// blockSchema is the version of the formats used by a block.
+type blockSchema struct {
+	// Version of the meta.json format.
+	metaVersion int
+	// Version of the index format, read from the index header since it's not recorded in meta.json.
+	indexVersion int
+}
+
+// blockSchemaEvolutionStep upgrades a block from a deprecated format.
+type blockSchemaEvolutionStep struct {
+	name string
+	// needed returns whether the step must be applied to a block with the input schema.
+	needed func(schema blockSchema) bool
+	// apply upgrades the block in blockDir. The changes to the input meta are written by the caller once
+	// all the steps have been applied.
+	apply func(ctx context.Context, blockDir string, meta *metadata.Meta) error
+}
+
+// blockSchemaEvolutionSteps are applied in order, so each step can rely on the previous ones.
+var blockSchemaEvolutionSteps = []blockSchemaEvolutionStep{
+	{
+		name:   "index-v1-to-v2",
+		needed: func(schema blockSchema) bool { return schema.indexVersion == index.FormatV1 },
+		apply: func(ctx context.Context, blockDir string, _ *metadata.Meta) error {
+			return rewriteIndex(ctx, blockDir)
+		},
+	},
+}
+
+// BlockSchemaEvolver upgrades the blocks downloaded for compaction which use deprecated formats, written by
+// older versions, so that the compacted block only uses the current formats.
+type BlockSchemaEvolver struct {
+	steps []blockSchemaEvolutionStep
+
+	evolutions        *prometheus.CounterVec
+	evolutionFailures prometheus.Counter
+}
+
+// NewBlockSchemaEvolver makes a new BlockSchemaEvolver.
+func NewBlockSchemaEvolver(reg prometheus.Registerer) *BlockSchemaEvolver {
+	return &BlockSchemaEvolver{
+		steps: blockSchemaEvolutionSteps,
+		evolutions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_compactor_block_schema_evolutions_total",
+			Help: "Total number of schema upgrade steps applied to the blocks to compact.",
+		}, []string{"step"}),
+		evolutionFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_block_schema_evolutions_failed_total",
+			Help: "Total number of blocks to compact whose schema failed to be upgraded.",
+		}),
+	}
+}
+
+// Evolve applies the schema upgrade steps needed by the block downloaded into blockDir, in place, and updates
+// the input meta accordingly. The block is left untouched if it already uses the current formats.
+func (e *BlockSchemaEvolver) Evolve(ctx context.Context, logger log.Logger, meta *metadata.Meta, blockDir string) error {
+	schema, err := readBlockSchema(meta, blockDir)
+	if err != nil {
+		e.evolutionFailures.Inc()
+		return errors.Wrapf(err, "detect schema of block %s", meta.ULID)
+	}
+
+	var applied []string
+	for _, step := range e.steps {
+		if !step.needed(schema) {
+			continue
+		}
+
+		if err := step.apply(ctx, blockDir, meta); err != nil {
+			e.evolutionFailures.Inc()
+			return errors.Wrapf(err, "apply schema upgrade step %s to block %s", step.name, meta.ULID)
+		}
+		applied = append(applied, step.name)
+	}
+
+	if len(applied) == 0 {
+		return nil
+	}
+
+	if err := meta.WriteToDir(logger, blockDir); err != nil {
+		e.evolutionFailures.Inc()
+		return errors.Wrapf(err, "write meta of block %s", meta.ULID)
+	}
+
+	for _, step := range applied {
+		e.evolutions.WithLabelValues(step).Inc()
+	}
+	level.Info(logger).Log("msg", "upgraded block schema", "block", meta.ULID, "steps", strings.Join(applied, ","))
+
+	return nil
+}
+
+// readBlockSchema detects the schema of the block in blockDir from its meta and index header.
+func readBlockSchema(meta *metadata.Meta, blockDir string) (blockSchema, error) {
+	if meta.Version != metadata.TSDBVersion1 {
+		return blockSchema{}, errors.Errorf("unsupported meta version %d", meta.Version)
+	}
+
+	f, err := os.Open(filepath.Join(blockDir, block.IndexFilename))
+	if err != nil {
+		return blockSchema{}, errors.Wrap(err, "open index")
+	}
+	defer f.Close()
+
+	header := make([]byte, index.HeaderLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return blockSchema{}, errors.Wrap(err, "read index header")
+	}
+	if binary.BigEndian.Uint32(header[0:4]) != index.MagicIndex {
+		return blockSchema{}, errors.New("invalid index magic number")
+	}
+
+	return blockSchema{
+		metaVersion:  meta.Version,
+		indexVersion: int(header[4]),
+	}, nil
+}
+
+// rewriteIndex rewrites the index of the block in blockDir using the current index format. The chunk references
+// are the same across the index formats, so the chunk files are left untouched.
+func rewriteIndex(ctx context.Context, blockDir string) error {
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	tmpPath := indexPath + ".tmp"
+
+	if err := writeRewrittenIndex(ctx, indexPath, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return errors.Wrap(os.Rename(tmpPath, indexPath), "replace index")
+}
+
+func writeRewrittenIndex(ctx context.Context, indexPath, tmpPath string) error {
+	reader, err := index.NewFileReader(indexPath)
+	if err != nil {
+		return errors.Wrap(err, "open index")
+	}
+	// The series labels may reference the reader memory, so it's closed once the new index is written.
+	defer reader.Close()
+
+	k, v := index.AllPostingsKey()
+	postings, err := reader.Postings(k, v)
+	if err != nil {
+		return errors.Wrap(err, "read postings")
+	}
+
+	var series []salvagedSeries
+	for postings.Next() {
+		s := salvagedSeries{}
+		if err := reader.Series(postings.At(), &s.lset, &s.chks); err != nil {
+			return errors.Wrap(err, "read series")
+		}
+		series = append(series, s)
+	}
+	if err := postings.Err(); err != nil {
+		return errors.Wrap(err, "read postings")
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return labels.Compare(series[i].lset, series[j].lset) < 0
+	})
+
+	return errors.Wrap(writeIndex(ctx, tmpPath, series), "write index")
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestBlockSchemaEvolver_Evolve(t *testing.T) {
+	newBlock := func(t *testing.T) (*metadata.Meta, string) {
+		return createBlockWithSamples(t, t.TempDir(), 1, []storage.Series{
+			storage.NewListSeries(labels.FromStrings("__name__", "metric", "series", "a"), []tsdbutil.Sample{newSample(10, 1), newSample(20, 2)}),
+			storage.NewListSeries(labels.FromStrings("__name__", "metric", "series", "b"), []tsdbutil.Sample{newSample(10, 3)}),
+		})
+	}
+
+	t.Run("should leave the block untouched if it uses the current formats", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+		original, err := os.ReadFile(filepath.Join(blockDir, block.IndexFilename))
+		require.NoError(t, err)
+
+		evolver := NewBlockSchemaEvolver(prometheus.NewPedanticRegistry())
+		require.NoError(t, evolver.Evolve(context.Background(), log.NewNopLogger(), meta, blockDir))
+
+		actual, err := os.ReadFile(filepath.Join(blockDir, block.IndexFilename))
+		require.NoError(t, err)
+		assert.Equal(t, original, actual)
+		assert.Equal(t, 0, testutil.CollectAndCount(evolver.evolutions))
+		assert.Equal(t, float64(0), testutil.ToFloat64(evolver.evolutionFailures))
+	})
+
+	t.Run("should apply the needed steps in order, and write the updated meta", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+
+		var applied []string
+		step := func(name string, needed bool) blockSchemaEvolutionStep {
+			return blockSchemaEvolutionStep{
+				name:   name,
+				needed: func(schema blockSchema) bool { return needed && schema.indexVersion == index.FormatV2 },
+				apply: func(_ context.Context, _ string, meta *metadata.Meta) error {
+					applied = append(applied, name)
+					meta.Thanos.Labels["step"] = name
+					return nil
+				},
+			}
+		}
+
+		evolver := NewBlockSchemaEvolver(prometheus.NewPedanticRegistry())
+		evolver.steps = []blockSchemaEvolutionStep{step("first", true), step("skipped", false), step("second", true)}
+		require.NoError(t, evolver.Evolve(context.Background(), log.NewNopLogger(), meta, blockDir))
+
+		assert.Equal(t, []string{"first", "second"}, applied)
+		assert.Equal(t, float64(1), testutil.ToFloat64(evolver.evolutions.WithLabelValues("first")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(evolver.evolutions.WithLabelValues("second")))
+
+		written, err := metadata.ReadFromDir(blockDir)
+		require.NoError(t, err)
+		assert.Equal(t, "second", written.Thanos.Labels["step"])
+	})
+
+	t.Run("should fail if a step fails", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+
+		evolver := NewBlockSchemaEvolver(prometheus.NewPedanticRegistry())
+		evolver.steps = []blockSchemaEvolutionStep{{
+			name:   "failing",
+			needed: func(blockSchema) bool { return true },
+			apply: func(context.Context, string, *metadata.Meta) error {
+				return errors.New("step failed")
+			},
+		}}
+
+		err := evolver.Evolve(context.Background(), log.NewNopLogger(), meta, blockDir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "apply schema upgrade step failing")
+		assert.Equal(t, float64(1), testutil.ToFloat64(evolver.evolutionFailures))
+	})
+
+	t.Run("should fail if the block schema can't be detected", func(t *testing.T) {
+		meta, blockDir := newBlock(t)
+		corruptFile(t, filepath.Join(blockDir, block.IndexFilename), 0)
+
+		evolver := NewBlockSchemaEvolver(prometheus.NewPedanticRegistry())
+		err := evolver.Evolve(context.Background(), log.NewNopLogger(), meta, blockDir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid index magic number")
+		assert.Equal(t, float64(1), testutil.ToFloat64(evolver.evolutionFailures))
+	})
+}
+
+func TestReadBlockSchema(t *testing.T) {
+	meta, blockDir := createBlockWithSamples(t, t.TempDir(), 1, []storage.Series{
+		storage.NewListSeries(labels.FromStrings("__name__", "metric"), []tsdbutil.Sample{newSample(10, 1)}),
+	})
+
+	schema, err := readBlockSchema(meta, blockDir)
+	require.NoError(t, err)
+	assert.Equal(t, blockSchema{metaVersion: metadata.TSDBVersion1, indexVersion: index.FormatV2}, schema)
+
+	// The index version is read from the index header.
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	b, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+	b[4] = index.FormatV1
+	require.NoError(t, os.WriteFile(indexPath, b, 0o666))
+
+	schema, err = readBlockSchema(meta, blockDir)
+	require.NoError(t, err)
+	assert.Equal(t, index.FormatV1, schema.indexVersion)
+}
+
+func TestRewriteIndex(t *testing.T) {
+	_, blockDir := createBlockWithSamples(t, t.TempDir(), 1, []storage.Series{
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "series", "a"), []tsdbutil.Sample{newSample(10, 1), newSample(20, 2)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "series", "b"), []tsdbutil.Sample{newSample(10, 3)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "other"), []tsdbutil.Sample{newSample(30, 4)}),
+	})
+	indexPath := filepath.Join(blockDir, block.IndexFilename)
+	original := readSeriesRefs(t, indexPath)
+
+	require.NoError(t, rewriteIndex(context.Background(), blockDir))
+
+	// The series and their chunks are preserved, and the chunks can still be read.
+	rewritten := readSeriesRefs(t, indexPath)
+	require.Len(t, rewritten, len(original))
+	for lset, ref := range original {
+		require.Contains(t, rewritten, lset)
+		assert.Equal(t, ref.chks, rewritten[lset].chks)
+	}
+	assert.Len(t, readBlockSamples(t, blockDir), 3)
+
+	_, err := os.Stat(indexPath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -53,6 +53,7 @@ type BlocksCleaner struct {
 	bucketClient objstore.Bucket
 	usersScanner *mimir_tsdb.UsersScanner
 	ownUser      func(userID string) (bool, error)
+	scheduler    *GarbageCollectionScheduler
 
 	// Keep track of the last owned users.
 	lastOwnedUsers []string
@@ -78,6 +79,7 @@ func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Bucket, own
 		bucketClient: bucketClient,
 		usersScanner: mimir_tsdb.NewUsersScanner(bucketClient, ownUser, logger),
 		ownUser:      ownUser,
+		scheduler:    NewGarbageCollectionScheduler(),
 		cfgProvider:  cfgProvider,
 		logger:       log.With(logger, "component", "cleaner"),
 		runsStarted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
@@ -191,11 +193,13 @@ func (c *BlocksCleaner) cleanUsers(ctx context.Context) error {
 			c.tenantMarkedBlocks.DeleteLabelValues(userID)
 			c.tenantPartialBlocks.DeleteLabelValues(userID)
 			c.tenantBucketIndexLastUpdate.DeleteLabelValues(userID)
+			c.scheduler.RemoveUser(userID)
 		}
 	}
 	c.lastOwnedUsers = allUsers
 
-	return concurrency.ForEachUser(ctx, allUsers, c.cfg.CleanupConcurrency, func(ctx context.Context, userID string) error {
+	// Clean up the largest tenants first, to free the storage space faster.
+	return c.scheduler.ForEachUser(ctx, allUsers, c.cfg.CleanupConcurrency, func(ctx context.Context, userID string) error {
 		own, err := c.ownUser(userID)
 		if err != nil || !own {
 			// This returns error only if err != nil. ForEachUser keeps working for other users.
@@ -264,6 +268,7 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 	}
 
 	// Given all blocks have been deleted, we can also remove the metrics.
+	c.scheduler.RemoveUser(userID)
 	c.tenantBlocks.DeleteLabelValues(userID)
 	c.tenantMarkedBlocks.DeleteLabelValues(userID)
 	c.tenantPartialBlocks.DeleteLabelValues(userID)
@@ -373,6 +378,7 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string) (returnErr
 		return err
 	}
 
+	c.scheduler.UpdateEstimatedSize(userID, idx)
 	c.tenantBlocks.WithLabelValues(userID).Set(float64(len(idx.Blocks)))
 	c.tenantMarkedBlocks.WithLabelValues(userID).Set(float64(len(idx.BlockDeletionMarks)))
 	c.tenantPartialBlocks.WithLabelValues(userID).Set(float64(len(partials)))
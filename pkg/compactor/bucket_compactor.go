@@ -313,8 +313,27 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 			return errors.Wrapf(err, "download block %s", meta.ULID)
 		}
 
+		// Upgrade the block if it uses deprecated formats, before checking it.
+		if c.schemaEvolver != nil {
+			if err := c.schemaEvolver.Evolve(ctx, jobLogger, meta, bdir); err != nil {
+				return err
+			}
+		}
+
 		// Ensure all input blocks are valid.
 		stats, err := block.GatherIndexHealthStats(jobLogger, filepath.Join(bdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+
+		// Try to rebuild the index of the block if it's corrupted.
+		if c.indexRebuildJob != nil {
+			corruptionErr := err
+			if corruptionErr == nil {
+				corruptionErr = stats.CriticalErr()
+			}
+			if corruptionErr != nil {
+				stats, err = c.indexRebuildJob.Run(ctx, jobLogger, meta, bdir, corruptionErr)
+			}
+		}
+
 		if err != nil {
 			return errors.Wrapf(err, "gather index issues for block %s", bdir)
 		}
@@ -345,6 +364,16 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 		blocksToCompactDirs[ix] = filepath.Join(subDir, meta.ULID.String())
 	}
 
+	if c.conflictResolver != nil {
+		uploadTimes, err := blocksUploadTime(toCompact, blocksToCompactDirs)
+		if err != nil {
+			return false, nil, err
+		}
+		if err := c.conflictResolver.Resolve(jobLogger, toCompact, blocksToCompactDirs, uploadTimes); err != nil {
+			return false, nil, errors.Wrap(err, "resolve conflicts between overlapping blocks")
+		}
+	}
+
 	elapsed := time.Since(downloadBegin)
 	level.Info(jobLogger).Log("msg", "downloaded and verified blocks; compacting blocks", "blocks", len(blocksToCompactDirs), "plan", fmt.Sprintf("%v", blocksToCompactDirs), "duration", elapsed, "duration_ms", elapsed.Milliseconds())
 
@@ -443,6 +472,20 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 	return true, compIDs, nil
 }
 
+// blocksUploadTime returns the time each block has been uploaded to the bucket, read from the meta.json
+// of the blocks downloaded into the given directories. The time is zero for the blocks uploaded without it.
+func blocksUploadTime(metas []*metadata.Meta, dirs []string) ([]time.Time, error) {
+	uploadTimes := make([]time.Time, len(metas))
+	for i, meta := range metas {
+		uploadTime, err := mimit_tsdb.ReadUploadTime(dirs[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "read upload time of block %s", meta.ULID)
+		}
+		uploadTimes[i] = uploadTime
+	}
+	return uploadTimes, nil
+}
+
 // convertCompactionResultToForEachJobs filters out empty ULIDs.
 // When handling result of split compactions, shard index is index in the slice returned by compaction.
 func convertCompactionResultToForEachJobs(compactedBlocks []ulid.ULID, splitJob bool, jobLogger log.Logger) []ulidWithShardIndex {
@@ -643,26 +686,39 @@ type BucketCompactor struct {
 	sortJobs                       JobsOrderFunc
 	blockSyncConcurrency           int
 	metrics                        *BucketCompactorMetrics
+	conflictResolver               *BlockMergeConflictResolver
+	indexRebuildJob                *BlockIndexRebuildJob
+	schemaEvolver                  *BlockSchemaEvolver
+}
+
+// BucketCompactorConfig holds the config of a BucketCompactor.
+type BucketCompactorConfig struct {
+	CompactDir                     string
+	Concurrency                    int
+	BlockSyncConcurrency           int
+	SkipBlocksWithOutOfOrderChunks bool
+
+	// Optional processing of the blocks to compact, disabled if nil.
+	ConflictResolver *BlockMergeConflictResolver
+	IndexRebuildJob  *BlockIndexRebuildJob
+	SchemaEvolver    *BlockSchemaEvolver
 }
 
 // NewBucketCompactor creates a new bucket compactor.
 func NewBucketCompactor(
+	cfg BucketCompactorConfig,
 	logger log.Logger,
 	sy *Syncer,
 	grouper Grouper,
 	planner Planner,
 	comp Compactor,
-	compactDir string,
 	bkt objstore.Bucket,
-	concurrency int,
-	skipBlocksWithOutOfOrderChunks bool,
 	ownJob ownCompactionJobFunc,
 	sortJobs JobsOrderFunc,
-	blockSyncConcurrency int,
 	metrics *BucketCompactorMetrics,
 ) (*BucketCompactor, error) {
-	if concurrency <= 0 {
-		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", concurrency)
+	if cfg.Concurrency <= 0 {
+		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", cfg.Concurrency)
 	}
 	return &BucketCompactor{
 		logger:                         logger,
@@ -670,14 +726,17 @@ func NewBucketCompactor(
 		grouper:                        grouper,
 		planner:                        planner,
 		comp:                           comp,
-		compactDir:                     compactDir,
+		compactDir:                     cfg.CompactDir,
 		bkt:                            bkt,
-		concurrency:                    concurrency,
-		skipBlocksWithOutOfOrderChunks: skipBlocksWithOutOfOrderChunks,
+		concurrency:                    cfg.Concurrency,
+		skipBlocksWithOutOfOrderChunks: cfg.SkipBlocksWithOutOfOrderChunks,
 		ownJob:                         ownJob,
 		sortJobs:                       sortJobs,
-		blockSyncConcurrency:           blockSyncConcurrency,
+		blockSyncConcurrency:           cfg.BlockSyncConcurrency,
 		metrics:                        metrics,
+		conflictResolver:               cfg.ConflictResolver,
+		indexRebuildJob:                cfg.IndexRebuildJob,
+		schemaEvolver:                  cfg.SchemaEvolver,
 	}, nil
 }
 
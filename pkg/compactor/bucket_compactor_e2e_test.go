@@ -248,7 +248,12 @@ func TestGroupCompactE2E(t *testing.T) {
 		planner := NewSplitAndMergePlanner([]int64{1000, 3000})
 		grouper := NewSplitAndMergeGrouper("user-1", []int64{1000, 3000}, 0, 0, logger)
 		metrics := NewBucketCompactorMetrics(blocksMarkedForDeletion, prometheus.NewPedanticRegistry())
-		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, true, ownAllJobs, sortJobsByNewestBlocksFirst, 4, metrics)
+		bComp, err := NewBucketCompactor(BucketCompactorConfig{
+			CompactDir:                     dir,
+			Concurrency:                    2,
+			BlockSyncConcurrency:           4,
+			SkipBlocksWithOutOfOrderChunks: true,
+		}, logger, sy, grouper, planner, comp, bkt, ownAllJobs, sortJobsByNewestBlocksFirst, metrics)
 		require.NoError(t, err)
 
 		// Compaction on empty should not fail.
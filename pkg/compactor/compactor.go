@@ -102,6 +102,12 @@ type Config struct {
 
 	CompactionJobsOrder string `yaml:"compaction_jobs_order" category:"advanced"`
 
+	MergeConflictResolutionEnabled bool `yaml:"merge_conflict_resolution_enabled" category:"experimental"`
+
+	RebuildCorruptIndexes bool `yaml:"rebuild_corrupt_indexes" category:"experimental"`
+
+	EvolveBlockSchemas bool `yaml:"evolve_block_schemas" category:"experimental"`
+
 	// No need to add options to customize the retry backoff,
 	// given the defaults should be fine, but allow to override
 	// it in tests.
@@ -144,6 +150,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 
 	f.Var(&cfg.EnabledTenants, "compactor.enabled-tenants", "Comma separated list of tenants that can be compacted. If specified, only these tenants will be compacted by compactor, otherwise all tenants can be compacted. Subject to sharding.")
 	f.Var(&cfg.DisabledTenants, "compactor.disabled-tenants", "Comma separated list of tenants that cannot be compacted by this compactor. If specified, and compactor would normally pick given tenant for compaction (via -compactor.enabled-tenants or sharding), it will be ignored instead.")
+
+	f.BoolVar(&cfg.MergeConflictResolutionEnabled, "compactor.merge-conflict-resolution-enabled", false, "If enabled, before merging overlapping blocks produced by different compaction jobs, the samples with the same series and timestamp but a different value are resolved by keeping the sample from the block written last.")
+	f.BoolVar(&cfg.RebuildCorruptIndexes, "compactor.rebuild-corrupt-indexes", false, "If enabled, when the index of a block to compact is detected as corrupted, the compactor rebuilds it from the series which can still be read from the corrupted index and the chunk files, and compacts the block with the rebuilt index. The series which can't be read are dropped.")
+	f.BoolVar(&cfg.EvolveBlockSchemas, "compactor.evolve-block-schemas", false, "If enabled, the blocks to compact which use deprecated formats, written by older versions, are upgraded to the current formats before being compacted.")
 }
 
 func (cfg *Config) Validate() error {
@@ -248,6 +258,15 @@ type MultitenantCompactor struct {
 	// Metrics shared across all BucketCompactor instances.
 	bucketCompactorMetrics *BucketCompactorMetrics
 
+	// Resolver of the conflicts between overlapping blocks. Nil if disabled.
+	conflictResolver *BlockMergeConflictResolver
+
+	// Rebuilds the corrupted indexes of the blocks to compact. Nil if disabled.
+	indexRebuildJob *BlockIndexRebuildJob
+
+	// Upgrades the blocks to compact which use deprecated formats. Nil if disabled.
+	schemaEvolver *BlockSchemaEvolver
+
 	// TSDB syncer metrics
 	syncerMetrics *aggregatedSyncerMetrics
 }
@@ -343,6 +362,18 @@ func newMultitenantCompactor(
 
 	c.bucketCompactorMetrics = NewBucketCompactorMetrics(c.blocksMarkedForDeletion, registerer)
 
+	if compactorCfg.MergeConflictResolutionEnabled {
+		c.conflictResolver = NewBlockMergeConflictResolver(registerer)
+	}
+
+	if compactorCfg.RebuildCorruptIndexes {
+		c.indexRebuildJob = NewBlockIndexRebuildJob(registerer)
+	}
+
+	if compactorCfg.EvolveBlockSchemas {
+		c.schemaEvolver = NewBlockSchemaEvolver(registerer)
+	}
+
 	if len(compactorCfg.EnabledTenants) > 0 {
 		level.Info(c.logger).Log("msg", "compactor using enabled users", "enabled", strings.Join(compactorCfg.EnabledTenants, ", "))
 	}
@@ -678,18 +709,24 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 	}
 
 	compactor, err := NewBucketCompactor(
+		BucketCompactorConfig{
+			CompactDir:           path.Join(c.compactorCfg.DataDir, "compact"),
+			Concurrency:          c.compactorCfg.CompactionConcurrency,
+			BlockSyncConcurrency: c.compactorCfg.BlockSyncConcurrency,
+			// Skip blocks with out of order chunks, and mark them for no-compaction.
+			SkipBlocksWithOutOfOrderChunks: true,
+			ConflictResolver:               c.conflictResolver,
+			IndexRebuildJob:                c.indexRebuildJob,
+			SchemaEvolver:                  c.schemaEvolver,
+		},
 		ulogger,
 		syncer,
 		c.blocksGrouperFactory(ctx, c.compactorCfg, c.cfgProvider, userID, ulogger, reg),
 		c.blocksPlanner,
 		c.blocksCompactor,
-		path.Join(c.compactorCfg.DataDir, "compact"),
 		bucket,
-		c.compactorCfg.CompactionConcurrency,
-		true, // Skip blocks with out of order chunks, and mark them for no-compaction.
 		c.shardingStrategy.ownJob,
 		c.jobsOrder,
-		c.compactorCfg.BlockSyncConcurrency,
 		c.bucketCompactorMetrics,
 	)
 	if err != nil {
@@ -0,0 +1,403 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util/listblocks"
+)
+
+// CrossTenantDeduplication removes the blocks of a tenant whose series are all duplicated in another tenant,
+// for setups where the same series are written both under a tenant and under a "global" tenant.
+//
+// A block is considered duplicated only if, for each of its series, the blocks of the other tenant containing
+// the same series fully cover its time range, and contain all the samples of the series with the same values.
+type CrossTenantDeduplication struct {
+	bkt         objstore.Bucket
+	cfgProvider bucket.TenantConfigProvider
+	dryRun      bool
+	tempDir     string
+	logger      log.Logger
+
+	blocksMarkedForDeletion prometheus.Counter
+}
+
+// NewCrossTenantDeduplication makes a new CrossTenantDeduplication. If dryRun is true, the duplicated blocks
+// are only reported, and not marked for deletion. The blocks are downloaded into tempDir.
+func NewCrossTenantDeduplication(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, dryRun bool, tempDir string, logger log.Logger, reg prometheus.Registerer) *CrossTenantDeduplication {
+	return &CrossTenantDeduplication{
+		bkt:         bkt,
+		cfgProvider: cfgProvider,
+		dryRun:      dryRun,
+		tempDir:     tempDir,
+		logger:      logger,
+		blocksMarkedForDeletion: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name:        blocksMarkedForDeletionName,
+			Help:        blocksMarkedForDeletionHelp,
+			ConstLabels: prometheus.Labels{"reason": "cross-tenant-deduplication"},
+		}),
+	}
+}
+
+// CrossTenantDedup finds the series present in both tenantA and tenantB within timeRange, and marks for
+// deletion the blocks of tenantB fully within timeRange whose series are all present in tenantA. The
+// storage recovered by deleting the duplicated blocks is reported in the logs. The blocks are downloaded
+// to disk, and their series are streamed, so that the memory usage doesn't depend on the number of series.
+func (d *CrossTenantDeduplication) CrossTenantDedup(ctx context.Context, tenantA, tenantB string, timeRange model.Interval) error {
+	if tenantA == tenantB {
+		return errors.New("the tenants to deduplicate must be different")
+	}
+	if timeRange.End <= timeRange.Start {
+		return errors.New("the end of the time range must be after its start")
+	}
+
+	logger := log.With(d.logger, "tenantA", tenantA, "tenantB", tenantB, "dryRun", d.dryRun)
+
+	metasA, _, err := listblocks.LoadMetaFilesAndDeletionMarkers(ctx, d.bkt, tenantA, false, time.Time{})
+	if err != nil {
+		return errors.Wrapf(err, "list blocks of tenant %s", tenantA)
+	}
+	metasB, _, err := listblocks.LoadMetaFilesAndDeletionMarkers(ctx, d.bkt, tenantB, false, time.Time{})
+	if err != nil {
+		return errors.Wrapf(err, "list blocks of tenant %s", tenantB)
+	}
+
+	// Only the blocks of tenantB fully within the time range can be deleted, otherwise the samples
+	// outside the time range would be deleted too.
+	var candidates []*metadata.Meta
+	for _, meta := range listblocks.SortBlocks(metasB) {
+		if meta.MinTime >= int64(timeRange.Start) && meta.MaxTime <= int64(timeRange.End) {
+			candidates = append(candidates, meta)
+		}
+	}
+
+	var sourceMetas []*metadata.Meta
+	for _, meta := range listblocks.SortBlocks(metasA) {
+		if meta.MinTime < int64(timeRange.End) && meta.MaxTime > int64(timeRange.Start) {
+			sourceMetas = append(sourceMetas, meta)
+		}
+	}
+
+	level.Info(logger).Log("msg", "looking for duplicated blocks", "candidates", len(candidates), "sourceBlocks", len(sourceMetas))
+
+	userBktA := bucket.NewUserBucketClient(tenantA, d.bkt, d.cfgProvider)
+	userBktB := bucket.NewUserBucketClient(tenantB, d.bkt, d.cfgProvider)
+
+	dir, err := os.MkdirTemp(d.tempDir, "cross-tenant-dedup-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove temporary directory", "dir", dir, "err", err)
+		}
+	}()
+
+	// The tenantA blocks, downloaded lazily and shared among the candidates. The series are streamed
+	// from the block files, so that they're never all held in memory.
+	blocksA := map[ulid.ULID]string{}
+
+	var duplicatedBlocks, recoveredBytes uint64
+
+	for _, candidate := range candidates {
+		// The candidates are sorted by min time, so the tenantA blocks ending before the candidate
+		// can't overlap any of the next candidates.
+		for _, meta := range sourceMetas {
+			if blockDir, ok := blocksA[meta.ULID]; ok && meta.MaxTime <= candidate.MinTime {
+				if err := os.RemoveAll(blockDir); err != nil {
+					return err
+				}
+				delete(blocksA, meta.ULID)
+			}
+		}
+
+		overlapping := overlappingBlocks(sourceMetas, candidate.MinTime, candidate.MaxTime)
+		if !blocksCoverRange(overlapping, candidate.MinTime, candidate.MaxTime) {
+			continue
+		}
+
+		sourceDirs := make([]string, 0, len(overlapping))
+		for _, meta := range overlapping {
+			blockDir, ok := blocksA[meta.ULID]
+			if !ok {
+				blockDir = filepath.Join(dir, tenantA, meta.ULID.String())
+				if err := block.Download(ctx, d.logger, userBktA, meta.ULID, blockDir); err != nil {
+					return errors.Wrapf(err, "download block %s of tenant %s", meta.ULID, tenantA)
+				}
+				blocksA[meta.ULID] = blockDir
+			}
+			sourceDirs = append(sourceDirs, blockDir)
+		}
+
+		candidateDir := filepath.Join(dir, tenantB, candidate.ULID.String())
+		if err := block.Download(ctx, d.logger, userBktB, candidate.ULID, candidateDir); err != nil {
+			return errors.Wrapf(err, "download block %s of tenant %s", candidate.ULID, tenantB)
+		}
+
+		duplicated, err := isBlockDuplicated(candidate, candidateDir, overlapping, sourceDirs)
+		if rmErr := os.RemoveAll(candidateDir); err == nil {
+			err = rmErr
+		}
+		if err != nil {
+			return errors.Wrapf(err, "check series of block %s of tenant %s", candidate.ULID, tenantB)
+		}
+		if !duplicated {
+			continue
+		}
+
+		size := listblocks.GetBlockSizeBytes(candidate)
+		duplicatedBlocks++
+		recoveredBytes += size
+
+		level.Info(logger).Log("msg", "found block with all series duplicated", "block", candidate.ULID, "minTime", candidate.MinTime, "maxTime", candidate.MaxTime, "bytes", size)
+		if d.dryRun {
+			continue
+		}
+
+		details := fmt.Sprintf("all series duplicated in tenant %s", tenantA)
+		if err := block.MarkForDeletion(ctx, logger, userBktB, candidate.ULID, details, d.blocksMarkedForDeletion); err != nil {
+			return errors.Wrapf(err, "mark block %s of tenant %s for deletion", candidate.ULID, tenantB)
+		}
+	}
+
+	level.Info(logger).Log("msg", "cross-tenant deduplication completed", "duplicatedBlocks", duplicatedBlocks, "recoveredBytes", recoveredBytes)
+	return nil
+}
+
+// isBlockDuplicated returns whether, for each series of the block, the source blocks containing the same series
+// cover the block time range and contain all the samples of the series with the same values. The series of the
+// block and of the sources are read from the block directories at the given paths, and merged in a single pass,
+// given the series of an index are sorted by labels.
+func isBlockDuplicated(meta *metadata.Meta, blockDir string, sources []*metadata.Meta, sourceDirs []string) (_ bool, err error) {
+	series, err := newBlockSeriesIterator(blockDir)
+	if err != nil {
+		return false, err
+	}
+	defer runutil.CloseWithErrCapture(&err, series, "close block")
+
+	sourceSeries := make([]*blockSeriesIterator, 0, len(sources))
+	sourceOk := make([]bool, 0, len(sources))
+	defer func() {
+		for _, it := range sourceSeries {
+			runutil.CloseWithErrCapture(&err, it, "close block")
+		}
+	}()
+
+	for _, sourceDir := range sourceDirs {
+		it, err := newBlockSeriesIterator(sourceDir)
+		if err != nil {
+			return false, err
+		}
+		sourceSeries = append(sourceSeries, it)
+		sourceOk = append(sourceOk, it.Next())
+	}
+
+	var (
+		containing      = make([]*metadata.Meta, 0, len(sources))
+		containingIters = make([]*blockSeriesIterator, 0, len(sources))
+		sourceSamples   = map[int64]uint64{}
+	)
+
+	for series.Next() {
+		lset := series.At()
+
+		containing = containing[:0]
+		containingIters = containingIters[:0]
+		for i, it := range sourceSeries {
+			for sourceOk[i] && labels.Compare(it.At(), lset) < 0 {
+				sourceOk[i] = it.Next()
+			}
+			if sourceOk[i] && labels.Equal(it.At(), lset) {
+				containing = append(containing, sources[i])
+				containingIters = append(containingIters, it)
+			}
+		}
+
+		if !blocksCoverRange(containing, meta.MinTime, meta.MaxTime) {
+			return false, nil
+		}
+
+		// Compare the samples, given the same series could have different samples in the two tenants.
+		// The values are compared by their bits, so that the NaN values, such as the stale markers, match.
+		for k := range sourceSamples {
+			delete(sourceSamples, k)
+		}
+		for _, it := range containingIters {
+			if err := it.ForEachSample(meta.MinTime, meta.MaxTime, func(t int64, v float64) bool {
+				sourceSamples[t] = math.Float64bits(v)
+				return true
+			}); err != nil {
+				return false, err
+			}
+		}
+
+		matching := true
+		if err := series.ForEachSample(meta.MinTime, meta.MaxTime, func(t int64, v float64) bool {
+			sourceValue, ok := sourceSamples[t]
+			matching = ok && sourceValue == math.Float64bits(v)
+			return matching
+		}); err != nil {
+			return false, err
+		}
+		if !matching {
+			return false, nil
+		}
+	}
+	if err := series.Err(); err != nil {
+		return false, err
+	}
+
+	for _, it := range sourceSeries {
+		if err := it.Err(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// blockSeriesIterator iterates the series of a block, sorted by labels.
+type blockSeriesIterator struct {
+	index    *index.Reader
+	chunks   *chunks.Reader
+	postings index.Postings
+
+	lset labels.Labels
+	chks []chunks.Meta
+	err  error
+}
+
+func newBlockSeriesIterator(blockDir string) (*blockSeriesIterator, error) {
+	indexReader, err := index.NewFileReader(filepath.Join(blockDir, block.IndexFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "open index")
+	}
+
+	chunksReader, err := chunks.NewDirReader(filepath.Join(blockDir, block.ChunksDirname), nil)
+	if err != nil {
+		_ = indexReader.Close()
+		return nil, errors.Wrap(err, "open chunks")
+	}
+
+	postings, err := indexReader.Postings(index.AllPostingsKey())
+	if err != nil {
+		_ = indexReader.Close()
+		_ = chunksReader.Close()
+		return nil, errors.Wrap(err, "read postings")
+	}
+
+	return &blockSeriesIterator{index: indexReader, chunks: chunksReader, postings: postings}, nil
+}
+
+// Next moves the iterator to the next series, returning false once there are no more series or on error.
+func (it *blockSeriesIterator) Next() bool {
+	if it.err != nil || !it.postings.Next() {
+		return false
+	}
+	if err := it.index.Series(it.postings.At(), &it.lset, &it.chks); err != nil {
+		it.err = errors.Wrap(err, "read series")
+		return false
+	}
+	return true
+}
+
+// At returns the labels of the current series, which are only valid until the iterator is closed.
+func (it *blockSeriesIterator) At() labels.Labels {
+	return it.lset
+}
+
+// ForEachSample calls f for each sample of the current series in the [minTime, maxTime) range, until f returns false.
+func (it *blockSeriesIterator) ForEachSample(minTime, maxTime int64, f func(t int64, v float64) bool) error {
+	for _, meta := range it.chks {
+		if meta.MaxTime < minTime || meta.MinTime >= maxTime {
+			continue
+		}
+
+		chk, err := it.chunks.Chunk(meta)
+		if err != nil {
+			return errors.Wrap(err, "read chunk")
+		}
+
+		samples := chk.Iterator(nil)
+		for samples.Next() {
+			t, v := samples.At()
+			if t < minTime || t >= maxTime {
+				continue
+			}
+			if !f(t, v) {
+				return nil
+			}
+		}
+		if err := samples.Err(); err != nil {
+			return errors.Wrap(err, "iterate chunk")
+		}
+	}
+	return nil
+}
+
+func (it *blockSeriesIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.postings.Err()
+}
+
+func (it *blockSeriesIterator) Close() error {
+	return tsdb_errors.NewMulti(it.index.Close(), it.chunks.Close()).Err()
+}
+
+// overlappingBlocks returns the blocks overlapping the [minTime, maxTime) range.
+func overlappingBlocks(metas []*metadata.Meta, minTime, maxTime int64) []*metadata.Meta {
+	var result []*metadata.Meta
+	for _, meta := range metas {
+		if meta.MinTime < maxTime && meta.MaxTime > minTime {
+			result = append(result, meta)
+		}
+	}
+	return result
+}
+
+// blocksCoverRange returns whether the union of the blocks time ranges covers the [minTime, maxTime) range.
+func blocksCoverRange(metas []*metadata.Meta, minTime, maxTime int64) bool {
+	sorted := append([]*metadata.Meta(nil), metas...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinTime < sorted[j].MinTime
+	})
+
+	covered := minTime
+	for _, meta := range sorted {
+		if meta.MinTime > covered {
+			return false
+		}
+		if meta.MaxTime > covered {
+			covered = meta.MaxTime
+		}
+		if covered >= maxTime {
+			return true
+		}
+	}
+	return covered >= maxTime
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+func TestCrossTenantDeduplication(t *testing.T) {
+	seriesX := labels.FromStrings("__name__", "metric", "series", "x")
+	seriesY := labels.FromStrings("__name__", "metric", "series", "y")
+	seriesZ := labels.FromStrings("__name__", "metric", "series", "z")
+
+	// The series have a sample every 10ms, whose value is the timestamp plus the given offset.
+	newSeriesWithOffset := func(lset labels.Labels, minT, maxT int64, offset float64) storage.Series {
+		var samples []tsdbutil.Sample
+		for ts := minT; ts <= maxT; ts += 10 {
+			samples = append(samples, newSample(ts, float64(ts)+offset))
+		}
+		return storage.NewListSeries(lset, samples)
+	}
+	newSeries := func(lset labels.Labels, minT, maxT int64) storage.Series {
+		return newSeriesWithOffset(lset, minT, maxT, 0)
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dry run: %t", dryRun), func(t *testing.T) {
+			ctx := context.Background()
+			bkt := objstore.NewInMemBucket()
+
+			uploadBlock := func(tenantID string, series ...storage.Series) ulid.ULID {
+				meta, blockDir := createBlockWithSamples(t, t.TempDir(), 1, series)
+				require.NoError(t, mimir_tsdb.UploadBlock(ctx, log.NewNopLogger(), bucket.NewUserBucketClient(tenantID, bkt, nil), blockDir, nil))
+				return meta.ULID
+			}
+
+			// The global tenant has all the series in the [0, 100] time range.
+			uploadBlock("global", newSeries(seriesX, 0, 100), newSeries(seriesY, 0, 100), newSeries(seriesZ, 0, 100))
+			// The global tenant has seriesX in the [300, 400) time range, and seriesY in the [400, 500) time range.
+			uploadBlock("global", newSeries(seriesX, 300, 390))
+			uploadBlock("global", newSeries(seriesY, 400, 490))
+
+			// All series are duplicated.
+			duplicated := uploadBlock("user-1", newSeries(seriesX, 10, 50), newSeries(seriesY, 10, 50))
+			// Some series are not duplicated.
+			partial := uploadBlock("user-1", newSeries(seriesX, 10, 50), newSeries(labels.FromStrings("__name__", "metric", "series", "w"), 10, 50))
+			// The time range is not covered by the global tenant.
+			notCovered := uploadBlock("user-1", newSeries(seriesX, 200, 250))
+			// The block is not fully within the deduplicated time range.
+			outOfRange := uploadBlock("user-1", newSeries(seriesX, 10, 2000))
+			// The time range is covered by the global tenant blocks, but not by the ones containing the series.
+			seriesNotCovered := uploadBlock("user-1", newSeries(seriesX, 350, 450))
+			// The series and time range are covered by the global tenant, but the samples have different values.
+			differentValues := uploadBlock("user-1", newSeriesWithOffset(seriesX, 10, 50, 1), newSeries(seriesY, 10, 50))
+			// The series and time range are covered by the global tenant, but there are samples at other timestamps.
+			differentTimestamps := uploadBlock("user-1", newSeries(seriesX, 15, 55), newSeries(seriesY, 10, 50))
+
+			tempDir := t.TempDir()
+			d := NewCrossTenantDeduplication(bkt, nil, dryRun, tempDir, log.NewNopLogger(), nil)
+			require.NoError(t, d.CrossTenantDedup(ctx, "global", "user-1", model.Interval{Start: 0, End: 1000}))
+
+			// The downloaded blocks should have been removed.
+			entries, err := os.ReadDir(tempDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			userBkt := bucket.NewUserBucketClient("user-1", bkt, nil)
+			isMarkedForDeletion := func(id ulid.ULID) bool {
+				ok, err := userBkt.Exists(ctx, path.Join(id.String(), metadata.DeletionMarkFilename))
+				require.NoError(t, err)
+				return ok
+			}
+
+			assert.Equal(t, !dryRun, isMarkedForDeletion(duplicated))
+			assert.False(t, isMarkedForDeletion(partial))
+			assert.False(t, isMarkedForDeletion(notCovered))
+			assert.False(t, isMarkedForDeletion(outOfRange))
+			assert.False(t, isMarkedForDeletion(seriesNotCovered))
+			assert.False(t, isMarkedForDeletion(differentValues))
+			assert.False(t, isMarkedForDeletion(differentTimestamps))
+
+			expectedMarked := float64(1)
+			if dryRun {
+				expectedMarked = 0
+			}
+			assert.Equal(t, expectedMarked, testutil.ToFloat64(d.blocksMarkedForDeletion))
+		})
+	}
+}
+
+func TestCrossTenantDeduplication_ShouldFailOnInvalidInput(t *testing.T) {
+	d := NewCrossTenantDeduplication(objstore.NewInMemBucket(), nil, true, t.TempDir(), log.NewNopLogger(), nil)
+
+	require.Error(t, d.CrossTenantDedup(context.Background(), "user-1", "user-1", model.Interval{Start: 0, End: 1000}))
+	require.Error(t, d.CrossTenantDedup(context.Background(), "global", "user-1", model.Interval{Start: 1000, End: 1000}))
+}
+
+func TestBlocksCoverRange(t *testing.T) {
+	newMeta := func(minTime, maxTime int64) *metadata.Meta {
+		return &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: minTime, MaxTime: maxTime}}
+	}
+
+	tests := map[string]struct {
+		metas    []*metadata.Meta
+		expected bool
+	}{
+		"no blocks": {
+			expected: false,
+		},
+		"single block covering the range": {
+			metas:    []*metadata.Meta{newMeta(0, 100)},
+			expected: true,
+		},
+		"adjacent blocks covering the range": {
+			metas:    []*metadata.Meta{newMeta(50, 100), newMeta(0, 50)},
+			expected: true,
+		},
+		"gap between blocks": {
+			metas:    []*metadata.Meta{newMeta(0, 40), newMeta(50, 100)},
+			expected: false,
+		},
+		"blocks not covering the end of the range": {
+			metas:    []*metadata.Meta{newMeta(0, 90)},
+			expected: false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, blocksCoverRange(testData.metas, 10, 100))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/grafana/dskit/concurrency"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+// GarbageCollectionScheduler schedules the blocks cleanup of the tenants, processing the tenants with the
+// largest estimated storage size first, in order to free storage space faster. The estimated size of each
+// tenant is cached from the bucket index read during its previous cleanup: tenants whose size is unknown
+// yet are processed last, in the input order.
+type GarbageCollectionScheduler struct {
+	mtx            sync.Mutex
+	estimatedSizes map[string]int64
+}
+
+// NewGarbageCollectionScheduler makes a new GarbageCollectionScheduler.
+func NewGarbageCollectionScheduler() *GarbageCollectionScheduler {
+	return &GarbageCollectionScheduler{
+		estimatedSizes: map[string]int64{},
+	}
+}
+
+// ForEachUser runs userFunc for each user, with the given concurrency, starting from the users with the largest
+// estimated storage size. The scheduling is interrupted as soon as the context is canceled (e.g. because the
+// compactor is restarting): in that case the users not processed yet are skipped, and the context error is returned.
+func (s *GarbageCollectionScheduler) ForEachUser(ctx context.Context, userIDs []string, concurrencyLimit int, userFunc func(ctx context.Context, userID string) error) error {
+	return concurrency.ForEachUser(ctx, s.sortUsers(userIDs), concurrencyLimit, userFunc)
+}
+
+// UpdateEstimatedSize updates the estimated storage size of the user, based on its bucket index.
+func (s *GarbageCollectionScheduler) UpdateEstimatedSize(userID string, idx *bucketindex.Index) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.estimatedSizes[userID] = estimatedStorageSize(idx)
+}
+
+// RemoveUser removes the cached estimated storage size of the user.
+func (s *GarbageCollectionScheduler) RemoveUser(userID string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.estimatedSizes, userID)
+}
+
+// sortUsers returns a copy of the input users, sorted by estimated storage size in descending order.
+func (s *GarbageCollectionScheduler) sortUsers(userIDs []string) []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sorted := append([]string(nil), userIDs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return s.estimatedSizes[sorted[i]] > s.estimatedSizes[sorted[j]]
+	})
+	return sorted
+}
+
+// estimatedStorageSize returns an estimation of the storage size of the blocks in the index. Given the size
+// of the blocks is not tracked in the bucket index, the number of chunks segment files is used instead, each
+// one accounting for the max segment size.
+func estimatedStorageSize(idx *bucketindex.Index) int64 {
+	var segments int64
+	for _, b := range idx.Blocks {
+		if b.SegmentsNum > 0 {
+			segments += int64(b.SegmentsNum)
+		} else {
+			// The segments are unknown, so at least one is assumed.
+			segments++
+		}
+	}
+	return segments * chunks.DefaultChunkSegmentSize
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+func TestGarbageCollectionScheduler_ForEachUser(t *testing.T) {
+	s := NewGarbageCollectionScheduler()
+	s.UpdateEstimatedSize("small", &bucketindex.Index{Blocks: bucketindex.Blocks{{SegmentsNum: 1}}})
+	s.UpdateEstimatedSize("large", &bucketindex.Index{Blocks: bucketindex.Blocks{{SegmentsNum: 3}, {SegmentsNum: 2}}})
+	s.UpdateEstimatedSize("medium", &bucketindex.Index{Blocks: bucketindex.Blocks{{}, {}}})
+	s.UpdateEstimatedSize("removed", &bucketindex.Index{Blocks: bucketindex.Blocks{{SegmentsNum: 10}}})
+	s.RemoveUser("removed")
+
+	var processed []string
+	users := []string{"unknown-1", "small", "removed", "medium", "unknown-2", "large"}
+	require.NoError(t, s.ForEachUser(context.Background(), users, 1, func(_ context.Context, userID string) error {
+		processed = append(processed, userID)
+		return nil
+	}))
+
+	// Users with unknown size are processed last, in the input order.
+	assert.Equal(t, []string{"large", "medium", "small", "unknown-1", "removed", "unknown-2"}, processed)
+
+	// The input slice is not modified.
+	assert.Equal(t, []string{"unknown-1", "small", "removed", "medium", "unknown-2", "large"}, users)
+}
+
+func TestGarbageCollectionScheduler_ShouldBeInterruptedOnContextCancellation(t *testing.T) {
+	s := NewGarbageCollectionScheduler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var processed []string
+	err := s.ForEachUser(ctx, []string{"user-1", "user-2", "user-3"}, 1, func(_ context.Context, userID string) error {
+		processed = append(processed, userID)
+		cancel()
+		return nil
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"user-1"}, processed)
+}
+
+func TestEstimatedStorageSize(t *testing.T) {
+	idx := &bucketindex.Index{Blocks: bucketindex.Blocks{{SegmentsNum: 2}, {}}}
+	assert.Equal(t, int64(3*chunks.DefaultChunkSegmentSize), estimatedStorageSize(idx))
+}
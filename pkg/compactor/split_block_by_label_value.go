@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// SplitBlockByLabelValue splits the block in blockDir into one block per unique value of the labelName
+// label, and returns the directories of the output blocks, sorted by label value. The series which don't
+// have the label are written to the same output block, as if the label value was empty.
+//
+// The output blocks are written next to the input block, which is left untouched. They have the same
+// time range as the input block, and list it as their parent.
+func SplitBlockByLabelValue(ctx context.Context, blockDir, labelName string) ([]string, error) {
+	meta, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read meta")
+	}
+	if meta.Stats.NumTombstones > 0 {
+		return nil, errors.Errorf("block %s has tombstones, which are not supported when splitting a block", meta.ULID)
+	}
+
+	indexReader, err := index.NewFileReader(filepath.Join(blockDir, block.IndexFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "open index")
+	}
+	defer indexReader.Close()
+
+	chunkReader, err := chunks.NewDirReader(filepath.Join(blockDir, block.ChunksDirname), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "open chunks")
+	}
+	defer chunkReader.Close()
+
+	groups, err := groupSeriesByLabelValue(indexReader, labelName)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(groups))
+	for value := range groups {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	outDirs := make([]string, 0, len(values))
+	for _, value := range values {
+		outDir, err := writeSplitBlock(ctx, filepath.Dir(blockDir), meta, chunkReader, groups[value])
+		if err != nil {
+			for _, dir := range outDirs {
+				_ = os.RemoveAll(dir)
+			}
+			return nil, errors.Wrapf(err, "write block for %s=%q", labelName, value)
+		}
+		outDirs = append(outDirs, outDir)
+	}
+
+	return outDirs, nil
+}
+
+// groupSeriesByLabelValue returns the series of the input index grouped by the value of the labelName
+// label. The series of each group are sorted by labels, like in the index.
+func groupSeriesByLabelValue(indexReader *index.Reader, labelName string) (map[string][]salvagedSeries, error) {
+	k, v := index.AllPostingsKey()
+	postings, err := indexReader.Postings(k, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "read postings")
+	}
+
+	groups := map[string][]salvagedSeries{}
+	for postings.Next() {
+		s := salvagedSeries{}
+		if err := indexReader.Series(postings.At(), &s.lset, &s.chks); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+
+		value := s.lset.Get(labelName)
+		groups[value] = append(groups[value], s)
+	}
+	if err := postings.Err(); err != nil {
+		return nil, errors.Wrap(err, "read postings")
+	}
+
+	return groups, nil
+}
+
+// writeSplitBlock writes a new block in parentDir with the input series of the source block,
+// copying their chunks from the source block chunk files, and returns the new block directory.
+func writeSplitBlock(ctx context.Context, parentDir string, source *metadata.Meta, chunkReader *chunks.Reader, series []salvagedSeries) (string, error) {
+	id := ulid.MustNew(ulid.Now(), rand.Reader)
+	outDir := filepath.Join(parentDir, id.String())
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	stats, err := writeSplitBlockData(ctx, outDir, chunkReader, series)
+	if err != nil {
+		_ = os.RemoveAll(outDir)
+		return "", err
+	}
+
+	meta := *source
+	meta.ULID = id
+	meta.Stats = stats
+	meta.Compaction.Parents = []tsdb.BlockDesc{{ULID: source.ULID, MinTime: source.MinTime, MaxTime: source.MaxTime}}
+	meta.Thanos.Files = nil
+
+	if err := meta.WriteToDir(log.NewNopLogger(), outDir); err != nil {
+		_ = os.RemoveAll(outDir)
+		return "", errors.Wrap(err, "write meta")
+	}
+
+	return outDir, nil
+}
+
+func writeSplitBlockData(ctx context.Context, outDir string, chunkReader *chunks.Reader, series []salvagedSeries) (tsdb.BlockStats, error) {
+	stats := tsdb.BlockStats{}
+
+	chunkWriter, err := chunks.NewWriter(filepath.Join(outDir, block.ChunksDirname))
+	if err != nil {
+		return stats, errors.Wrap(err, "create chunks writer")
+	}
+
+	for i, s := range series {
+		if err := ctx.Err(); err != nil {
+			_ = chunkWriter.Close()
+			return stats, err
+		}
+
+		chks := make([]chunks.Meta, 0, len(s.chks))
+		for _, chk := range s.chks {
+			c, err := chunkReader.Chunk(chk)
+			if err != nil {
+				_ = chunkWriter.Close()
+				return stats, errors.Wrapf(err, "read chunk of series %s", s.lset)
+			}
+			chks = append(chks, chunks.Meta{MinTime: chk.MinTime, MaxTime: chk.MaxTime, Chunk: c})
+			stats.NumSamples += uint64(c.NumSamples())
+		}
+
+		// The chunks references are set by the writer.
+		if err := chunkWriter.WriteChunks(chks...); err != nil {
+			_ = chunkWriter.Close()
+			return stats, errors.Wrap(err, "write chunks")
+		}
+		for j := range chks {
+			chks[j].Chunk = nil
+		}
+
+		series[i].chks = chks
+		stats.NumSeries++
+		stats.NumChunks += uint64(len(chks))
+	}
+
+	if err := chunkWriter.Close(); err != nil {
+		return stats, errors.Wrap(err, "close chunks writer")
+	}
+
+	if err := writeIndex(ctx, filepath.Join(outDir, block.IndexFilename), series); err != nil {
+		return stats, errors.Wrap(err, "write index")
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestSplitBlockByLabelValue(t *testing.T) {
+	dir := t.TempDir()
+
+	sourceMeta, sourceDir := createBlockWithSamples(t, dir, 2, []storage.Series{
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "team", "a", "pod", "1"), []tsdbutil.Sample{newSample(10, 1), newSample(20, 2)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "team", "a", "pod", "2"), []tsdbutil.Sample{newSample(10, 3)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "team", "b", "pod", "1"), []tsdbutil.Sample{newSample(30, 4)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "pod", "3"), []tsdbutil.Sample{newSample(40, 5)}),
+	})
+
+	outDirs, err := SplitBlockByLabelValue(context.Background(), sourceDir, "team")
+	require.NoError(t, err)
+	require.Len(t, outDirs, 3)
+
+	// The output blocks are sorted by label value, and the series without the label come first.
+	expected := []map[string][]float64{
+		{`{__name__="metric", pod="3"}`: {5}},
+		{`{__name__="metric", pod="1", team="a"}`: {1, 2}, `{__name__="metric", pod="2", team="a"}`: {3}},
+		{`{__name__="metric", pod="1", team="b"}`: {4}},
+	}
+
+	for i, outDir := range outDirs {
+		assert.Equal(t, dir, filepath.Dir(outDir))
+		assert.Equal(t, expected[i], readBlockSamples(t, outDir))
+
+		meta, err := metadata.ReadFromDir(outDir)
+		require.NoError(t, err)
+		assert.NotEqual(t, sourceMeta.ULID, meta.ULID)
+		assert.Equal(t, sourceMeta.MinTime, meta.MinTime)
+		assert.Equal(t, sourceMeta.MaxTime, meta.MaxTime)
+		assert.Equal(t, sourceMeta.Compaction.Level, meta.Compaction.Level)
+		require.Len(t, meta.Compaction.Parents, 1)
+		assert.Equal(t, sourceMeta.ULID, meta.Compaction.Parents[0].ULID)
+		assert.Equal(t, uint64(len(expected[i])), meta.Stats.NumSeries)
+	}
+
+	// The source block is left untouched.
+	assert.Len(t, readBlockSamples(t, sourceDir), 4)
+}
+
+func TestSplitBlockByLabelValue_LabelNotFound(t *testing.T) {
+	dir := t.TempDir()
+
+	_, sourceDir := createBlockWithSamples(t, dir, 1, []storage.Series{
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "pod", "1"), []tsdbutil.Sample{newSample(10, 1)}),
+		storage.NewListSeries(labels.FromStrings("__name__", "metric", "pod", "2"), []tsdbutil.Sample{newSample(10, 2)}),
+	})
+
+	outDirs, err := SplitBlockByLabelValue(context.Background(), sourceDir, "team")
+	require.NoError(t, err)
+	require.Len(t, outDirs, 1)
+	assert.Len(t, readBlockSamples(t, outDirs[0]), 2)
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"sort"
 	"sync"
 	"time"
@@ -59,7 +60,10 @@ const (
 
 var (
 	// Validation errors.
-	errInvalidTenantShardSize = errors.New("invalid tenant shard size, the value must be greater or equal to zero")
+	errInvalidTenantShardSize        = errors.New("invalid tenant shard size, the value must be greater or equal to zero")
+	errInvalidExemplarStorageBackend = errors.New("invalid exemplar storage backend, the value must be an http or https URL")
+	errInvalidMaxLabelNameLength     = errors.New("invalid max label name length, the value must be greater or equal to zero")
+	errInvalidMaxLabelValueLength    = fmt.Errorf("invalid max label value length, the value must be zero or greater than the length of the %q suffix", truncatedLabelValueSuffix)
 
 	// Distributor instance limits errors.
 	errMaxInflightRequestsReached      = errors.New(globalerror.DistributorMaxInflightPushRequests.MessageWithPerInstanceLimitConfig("the write request has been rejected because the distributor exceeded the allowed number of inflight push requests", maxInflightPushRequestsFlag))
@@ -92,6 +96,18 @@ type Distributor struct {
 	limits        *validation.Overrides
 	forwarder     forwarding.Forwarder
 
+	// Forwards exemplars to the exemplar storage backend. Nil if exemplars are stored in ingesters.
+	exemplarForwarder *ExemplarForwarder
+
+	// Truncates overly long label names and values. Nil if disabled.
+	labelLengthNormalizer *LabelLengthNormalizer
+
+	// Writes an event to the throttle events sink each time a tenant is rate limited. Nil if disabled.
+	throttleReporter *TenantThrottleReporter
+
+	// Writes the push requests of the tenant being debugged to a file. Nil if disabled.
+	pushRequestLogger *PushRequestLogger
+
 	// The global rate limiter requires a distributors ring to count
 	// the number of healthy instances
 	distributorsLifecycler *ring.BasicLifecycler
@@ -175,6 +191,17 @@ type Config struct {
 
 	// Configuration for forwarding of metrics to alternative ingestion endpoint.
 	Forwarding forwarding.Config
+
+	ExemplarStorageBackend string `yaml:"exemplar_storage_backend" category:"experimental"`
+
+	MaxLabelNameLength  int `yaml:"max_label_name_length" category:"experimental"`
+	MaxLabelValueLength int `yaml:"max_label_value_length" category:"experimental"`
+
+	ThrottleEventsSink string `yaml:"throttle_events_sink" category:"experimental"`
+
+	ZoneAwareWriteQuorum bool `yaml:"zone_aware_write_quorum" category:"experimental"`
+
+	DebugLogFile string `yaml:"debug_log_file" category:"experimental"`
 }
 
 type InstanceLimits struct {
@@ -192,6 +219,12 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 
 	f.IntVar(&cfg.MaxRecvMsgSize, "distributor.max-recv-msg-size", 100<<20, "Max message size in bytes that the distributors will accept for incoming push requests to the remote write API. If exceeded, the request will be rejected.")
 	f.DurationVar(&cfg.RemoteTimeout, "distributor.remote-timeout", 2*time.Second, "Timeout for downstream ingesters.")
+	f.StringVar(&cfg.ExemplarStorageBackend, "distributor.exemplar-storage-backend", "", "URL of the HTTP endpoint of a Jaeger-compatible collector used as exemplar storage backend, accepting spans in the Jaeger Thrift format, for example http://jaeger-collector:14268/api/traces. When set, exemplars are removed from write requests accepted by ingesters and forwarded to this endpoint as spans of the trace referenced by their trace_id label, instead of being stored in ingesters. Exemplars without a valid trace ID are dropped. Requests to the backend time out after -distributor.remote-timeout. If empty, exemplars are stored in ingesters.")
+	f.IntVar(&cfg.MaxLabelNameLength, "distributor.max-label-name-length", 0, "Label names longer than this number of bytes are truncated to this length. Truncation is applied before the label length validation. 0 to disable.")
+	f.IntVar(&cfg.MaxLabelValueLength, "distributor.max-label-value-length", 0, fmt.Sprintf("Label values longer than this number of bytes are truncated to this length. Truncation is applied before the label length validation. Truncated values end with the %q suffix, which is included in the length. 0 to disable.", truncatedLabelValueSuffix))
+	f.StringVar(&cfg.ThrottleEventsSink, "distributor.throttle-events-sink", "", "URL of the sink where an event is written each time a tenant is rate limited. Each event contains the tenant ID, the limit name and value, the per-second rate requested by the tenant over the last 10 seconds and the timestamp. Supported URLs are http and https, where events are sent as a JSON array in the body of a POST request timing out after -distributor.remote-timeout, and file, where events are appended as JSON lines to the file at the URL path. If empty, throttle events are not reported.")
+	f.BoolVar(&cfg.ZoneAwareWriteQuorum, "distributor.zone-aware-write-quorum", false, "When enabled and the ingesters ring is zone-aware, a write succeeds only once, in addition to the quorum, at least one ingester in each zone the series is replicated to has acknowledged it. This guarantees that written data survives the loss of a whole zone, but writes fail while all ingesters in a zone are failing.")
+	f.StringVar(&cfg.DebugLogFile, "distributor.debug-log-file", "", "Path of the file the push requests of the tenants with push_requests_debug_log_until set in the runtime config overrides are appended to. Empty to disable.")
 	f.Float64Var(&cfg.InstanceLimits.MaxIngestionRate, maxIngestionRateFlag, 0, "Max ingestion rate (samples/sec) that this distributor will accept. This limit is per-distributor, not per-tenant. Additional push requests will be rejected. Current ingestion rate is computed as exponentially weighted moving average, updated every second. 0 = unlimited.")
 	f.IntVar(&cfg.InstanceLimits.MaxInflightPushRequests, maxInflightPushRequestsFlag, 2000, "Max inflight push requests that this distributor can handle. This limit is per-distributor, not per-tenant. Additional requests will be rejected. 0 = unlimited.")
 	f.IntVar(&cfg.InstanceLimits.MaxInflightPushRequestsBytes, maxInflightPushRequestsBytesFlag, 0, "The sum of the request sizes in bytes of inflight push requests that this distributor can handle. This limit is per-distributor, not per-tenant. Additional requests will be rejected. 0 = unlimited.")
@@ -208,6 +241,25 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		return err
 	}
 
+	if cfg.MaxLabelNameLength < 0 {
+		return errInvalidMaxLabelNameLength
+	}
+	if cfg.MaxLabelValueLength < 0 || (cfg.MaxLabelValueLength > 0 && cfg.MaxLabelValueLength <= len(truncatedLabelValueSuffix)) {
+		return errInvalidMaxLabelValueLength
+	}
+
+	if cfg.ExemplarStorageBackend != "" {
+		if u, err := url.Parse(cfg.ExemplarStorageBackend); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errInvalidExemplarStorageBackend
+		}
+	}
+
+	if cfg.ThrottleEventsSink != "" {
+		if err := validateThrottleEventsSink(cfg.ThrottleEventsSink); err != nil {
+			return err
+		}
+	}
+
 	return cfg.Forwarding.Validate()
 }
 
@@ -409,6 +461,9 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		}
 
 		subservices = append(subservices, distributorsLifecycler, distributorsRing)
+
+		// The HA tracker state is exported by a single distributor, selected through the ring.
+		haTracker.setStateExportRing(distributorsRing, distributorsLifecycler.GetInstanceAddr())
 		requestRateStrategy = newGlobalRateStrategy(newRequestRateStrategy(limits), d)
 		ingestionRateStrategy = newGlobalRateStrategy(newIngestionRateStrategy(limits), d)
 	}
@@ -427,6 +482,28 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		subservices = append(subservices, d.forwarder)
 	}
 
+	if cfg.ExemplarStorageBackend != "" {
+		d.exemplarForwarder = NewExemplarForwarder(cfg.ExemplarStorageBackend, cfg.RemoteTimeout, reg, log)
+		subservices = append(subservices, d.exemplarForwarder)
+	}
+
+	if cfg.MaxLabelNameLength > 0 || cfg.MaxLabelValueLength > 0 {
+		d.labelLengthNormalizer = NewLabelLengthNormalizer(cfg.MaxLabelNameLength, cfg.MaxLabelValueLength, reg, log)
+	}
+
+	if cfg.ThrottleEventsSink != "" {
+		sink, err := NewThrottleEventSink(cfg.ThrottleEventsSink, cfg.RemoteTimeout)
+		if err != nil {
+			return nil, err
+		}
+		d.throttleReporter = NewTenantThrottleReporter(sink, reg, log)
+		subservices = append(subservices, d.throttleReporter)
+	}
+
+	if cfg.DebugLogFile != "" {
+		d.pushRequestLogger = NewPushRequestLogger(cfg.DebugLogFile, limits, log)
+	}
+
 	d.PushWithMiddlewares = d.wrapPushWithMiddlewares(d.PushWithCleanup)
 
 	subservices = append(subservices, d.ingesterPool, d.activeUsers)
@@ -536,6 +613,12 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.exemplarValidationMetrics.DeleteUserMetrics(userID)
 	d.metadataValidationMetrics.DeleteUserMetrics(userID)
 
+	if d.exemplarForwarder != nil {
+		d.exemplarForwarder.deleteMetricsForUser(userID)
+	}
+	if d.labelLengthNormalizer != nil {
+		d.labelLengthNormalizer.deleteMetricsForUser(userID)
+	}
 	if d.forwarder != nil {
 		d.forwarder.DeleteMetricsForUser(userID)
 	}
@@ -543,9 +626,29 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 
 // Called after distributor is asked to stop via StopAsync.
 func (d *Distributor) stopping(_ error) error {
+	if d.pushRequestLogger != nil {
+		if err := d.pushRequestLogger.Close(); err != nil {
+			level.Warn(d.log).Log("msg", "failed to close push requests debug log file", "err", err)
+		}
+	}
+
 	return services.StopManagerAndAwaitStopped(context.Background(), d.subservices)
 }
 
+// observeThrottle records the amount requested by the input tenant for the limit, if throttle events are reported.
+func (d *Distributor) observeThrottle(userID, limitName string, n float64, now time.Time) {
+	if d.throttleReporter != nil {
+		d.throttleReporter.Observe(userID, limitName, n, now)
+	}
+}
+
+// reportThrottle writes a throttle event for the input tenant to the throttle events sink, if configured.
+func (d *Distributor) reportThrottle(userID, limitName string, limitValue float64, now time.Time) {
+	if d.throttleReporter != nil {
+		d.throttleReporter.Report(userID, limitName, limitValue, now)
+	}
+}
+
 func (d *Distributor) tokenForLabels(userID string, labels []mimirpb.LabelAdapter) (uint32, error) {
 	return shardByAllLabels(userID, labels), nil
 }
@@ -674,8 +777,10 @@ func (d *Distributor) wrapPushWithMiddlewares(next push.Func) push.Func {
 	// result from previous call.
 	middlewares = append(middlewares, d.instanceLimitsMiddleware) // should run first
 	middlewares = append(middlewares, d.metricsMiddleware)
+	middlewares = append(middlewares, d.prePushDebugLogMiddleware)
 	middlewares = append(middlewares, d.prePushHaDedupeMiddleware)
 	middlewares = append(middlewares, d.prePushRelabelMiddleware)
+	middlewares = append(middlewares, d.prePushLabelLengthNormalizerMiddleware)
 	middlewares = append(middlewares, d.prePushForwardingMiddleware)
 
 	for ix := len(middlewares) - 1; ix >= 0; ix-- {
@@ -919,7 +1024,7 @@ func (d *Distributor) forwardSamples(ctx context.Context, userID string, ts []mi
 	forwardingErrCh := make(chan error)
 	forwardingRules := d.limits.ForwardingRules(userID)
 	endpoint := d.limits.ForwardingEndpoint(userID)
-	if endpoint == "" || len(forwardingRules) == 0 {
+	if (endpoint == "" || len(forwardingRules) == 0) && d.cfg.Forwarding.RulesFile == "" {
 		close(forwardingErrCh)
 		return ts, forwardingErrCh
 	}
@@ -964,8 +1069,10 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	}
 
 	now := mtime.Now()
+	d.observeThrottle(userID, throttleLimitRequestRate, 1, now)
 	if !d.requestRateLimiter.AllowN(now, userID, 1) {
 		d.discardedRequestsRateLimited.WithLabelValues(userID).Add(1)
+		d.reportThrottle(userID, throttleLimitRequestRate, d.limits.RequestRate(userID), now)
 
 		// Return a 429 here to tell the client it is going too fast.
 		// Client may discard the data or slow down and re-send.
@@ -1071,10 +1178,12 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	}
 
 	totalN := validatedSamples + validatedExemplars + len(validatedMetadata)
+	d.observeThrottle(userID, throttleLimitIngestionRate, float64(totalN), now)
 	if !d.ingestionRateLimiter.AllowN(now, userID, totalN) {
 		d.discardedSamplesRateLimited.WithLabelValues(userID).Add(float64(validatedSamples))
 		d.discardedExemplarsRateLimited.WithLabelValues(userID).Add(float64(validatedExemplars))
 		d.discardedMetadataRateLimited.WithLabelValues(userID).Add(float64(len(validatedMetadata)))
+		d.reportThrottle(userID, throttleLimitIngestionRate, d.limits.IngestionRate(userID), now)
 		// Return a 429 here to tell the client it is going too fast.
 		// Client may discard the data or slow down and re-send.
 		// Prometheus v2.26 added a remote-write option 'retry_on_http_429'.
@@ -1084,6 +1193,17 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	// totalN included samples and metadata. Ingester follows this pattern when computing its ingestion rate.
 	d.ingestionRate.Add(int64(totalN))
 
+	// Exemplars forwarded to the exemplar storage backend are not sent to ingesters. They're extracted only once
+	// the request has been validated and rate limited, and before calling ingesters because the series buffers
+	// are released once all ingesters have been called.
+	var forwardedExemplars *exemplarSpans
+	if d.exemplarForwarder != nil && validatedExemplars > 0 {
+		forwardedExemplars, err = d.exemplarForwarder.Extract(userID, validatedTimeseries)
+		if err != nil {
+			level.Warn(d.log).Log("msg", "failed to extract exemplars to forward to the exemplar storage backend", "user", userID, "err", err)
+		}
+	}
+
 	// Get a subring if tenant has shuffle shard size configured.
 	subRing := d.ingestersRing.ShuffleShard(userID, d.limits.IngestionTenantShardSize(userID))
 
@@ -1103,7 +1223,12 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	// so set this flag false and pass cleanup() to DoBatch.
 	cleanupInDefer = false
 
-	err = ring.DoBatch(ctx, ring.WriteNoExtend, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+	doBatch := ring.DoBatch
+	if d.cfg.ZoneAwareWriteQuorum {
+		doBatch = doBatchWithMultiZoneWriteQuorum
+	}
+
+	err = doBatch(ctx, ring.WriteNoExtend, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
 		timeseries := make([]mimirpb.PreallocTimeseries, 0, len(indexes))
 		var metadata []*mimirpb.MetricMetadata
 
@@ -1121,6 +1246,14 @@ func (d *Distributor) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReq
 	if err != nil {
 		return nil, err
 	}
+
+	// Exemplars are forwarded only once the request has been accepted by ingesters, so that they're not
+	// forwarded multiple times when the client retries a failed request. They're forwarded asynchronously,
+	// so failing to forward exemplars neither slows down nor fails the request.
+	if forwardedExemplars != nil {
+		d.exemplarForwarder.Enqueue(forwardedExemplars)
+	}
+
 	return &mimirpb.WriteResponse{}, firstPartialErr
 }
 
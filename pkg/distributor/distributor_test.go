@@ -63,6 +63,7 @@ var (
 
 func TestConfig_Validate(t *testing.T) {
 	tests := map[string]struct {
+		initConfig func(*Config)
 		initLimits func(*validation.Limits)
 		expected   error
 	}{
@@ -82,6 +83,42 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expected: nil,
 		},
+		"should pass if the exemplar storage backend is a valid URL": {
+			initConfig: func(cfg *Config) {
+				cfg.ExemplarStorageBackend = "http://exemplars:8080/api/v1/push"
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   nil,
+		},
+		"should fail if the exemplar storage backend is not an http URL": {
+			initConfig: func(cfg *Config) {
+				cfg.ExemplarStorageBackend = "exemplars:8080"
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidExemplarStorageBackend,
+		},
+		"should fail if the max label name length is negative": {
+			initConfig: func(cfg *Config) {
+				cfg.MaxLabelNameLength = -1
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidMaxLabelNameLength,
+		},
+		"should fail if the max label value length is not greater than the truncated suffix length": {
+			initConfig: func(cfg *Config) {
+				cfg.MaxLabelValueLength = len(truncatedLabelValueSuffix)
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidMaxLabelValueLength,
+		},
+		"should pass if the max label name and value lengths are positive": {
+			initConfig: func(cfg *Config) {
+				cfg.MaxLabelNameLength = 128
+				cfg.MaxLabelValueLength = 1024
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   nil,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -90,6 +127,9 @@ func TestConfig_Validate(t *testing.T) {
 			limits := validation.Limits{}
 			flagext.DefaultValues(&cfg, &limits)
 
+			if testData.initConfig != nil {
+				testData.initConfig(&cfg)
+			}
 			testData.initLimits(&limits)
 
 			assert.Equal(t, testData.expected, cfg.Validate(limits))
@@ -1184,7 +1224,8 @@ func TestDistributor_QueryStream_ShouldReturnErrorIfMaxChunkBytesPerQueryLimitIs
 	// a query running on all series to fail.
 	_, err = ds[0].QueryStream(ctx, math.MinInt32, math.MaxInt32, allSeriesMatchers...)
 	require.Error(t, err)
-	assert.ErrorContains(t, err, fmt.Sprintf(limiter.MaxChunkBytesHitMsgFormat, maxBytesLimit))
+	// The actual size depends on the order the ingesters responses are received, so only the limit is checked.
+	assert.ErrorContains(t, err, fmt.Sprintf("the query exceeded the aggregated chunks size limit (limit: %d bytes, actual: ", maxBytesLimit))
 }
 
 func TestDistributor_Push_LabelRemoval(t *testing.T) {
@@ -3255,6 +3296,8 @@ type prepConfig struct {
 	zonesResponseDelay           map[string]time.Duration
 	forwarding                   bool
 	getForwarder                 func() forwarding.Forwarder
+	throttleEventsSink           string
+	exemplarStorageBackend       string
 }
 
 func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*prometheus.Registry) {
@@ -3358,6 +3401,8 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, []*p
 		distributorCfg.InstanceLimits.MaxInflightPushRequestsBytes = cfg.maxInflightRequestsBytes
 		distributorCfg.InstanceLimits.MaxIngestionRate = cfg.maxIngestionRate
 		distributorCfg.ShuffleShardingLookbackPeriod = time.Hour
+		distributorCfg.ThrottleEventsSink = cfg.throttleEventsSink
+		distributorCfg.ExemplarStorageBackend = cfg.exemplarStorageBackend
 
 		if cfg.forwarding {
 			distributorCfg.Forwarding.Enabled = true
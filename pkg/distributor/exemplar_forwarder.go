@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	jaegerclient "github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/thrift"
+	"github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+const (
+	// exemplarSpansServiceName is the service name of the spans sent to the exemplar storage backend.
+	exemplarSpansServiceName = "mimir-exemplars"
+
+	// exemplarTagPrefix is the prefix of the span tags holding the exemplar labels and value,
+	// to not clash with the tags holding the series labels.
+	exemplarTagPrefix = "exemplar."
+
+	// exemplarForwarderQueueSize is the max number of batches of exemplars buffered before being sent to
+	// the exemplar storage backend. Batches enqueued while the queue is full are dropped.
+	exemplarForwarderQueueSize = 1024
+
+	// exemplarForwarderConcurrency is the number of concurrent requests to the exemplar storage backend.
+	exemplarForwarderConcurrency = 4
+)
+
+var (
+	// exemplarTraceIDLabels are the exemplar label names the trace ID is read from.
+	exemplarTraceIDLabels = []string{"trace_id", "traceID", "traceId"}
+
+	// exemplarSpanIDLabels are the exemplar label names the span ID is read from.
+	exemplarSpanIDLabels = []string{"span_id", "spanID", "spanId"}
+)
+
+// ExemplarForwarder sends the exemplars of write requests to a dedicated exemplar storage backend,
+// instead of ingesters. The backend must be a Jaeger-compatible collector accepting spans in the
+// Jaeger Thrift format over HTTP. Each exemplar is sent as a span of the trace it references.
+// Exemplars are buffered and sent asynchronously, so that a slow backend never slows down the write path:
+// exemplars enqueued while the buffer is full are dropped.
+type ExemplarForwarder struct {
+	services.Service
+
+	endpoint string
+	timeout  time.Duration
+	client   http.Client
+	logger   log.Logger
+	queue    chan *exemplarSpans
+
+	forwardedExemplars *prometheus.CounterVec
+	skippedExemplars   *prometheus.CounterVec
+	droppedExemplars   *prometheus.CounterVec
+	failedRequests     prometheus.Counter
+}
+
+// NewExemplarForwarder makes a new ExemplarForwarder sending exemplars to the input endpoint.
+func NewExemplarForwarder(endpoint string, timeout time.Duration, reg prometheus.Registerer, logger log.Logger) *ExemplarForwarder {
+	f := &ExemplarForwarder{
+		endpoint: endpoint,
+		timeout:  timeout,
+		logger:   logger,
+		queue:    make(chan *exemplarSpans, exemplarForwarderQueueSize),
+		forwardedExemplars: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_exemplar_storage_forwarded_exemplars_total",
+			Help: "The total number of exemplars forwarded to the exemplar storage backend.",
+		}, []string{"user"}),
+		skippedExemplars: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_exemplar_storage_skipped_exemplars_total",
+			Help: "The total number of exemplars not forwarded to the exemplar storage backend because they have no valid trace ID.",
+		}, []string{"user"}),
+		droppedExemplars: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_exemplar_storage_dropped_exemplars_total",
+			Help: "The total number of exemplars not forwarded to the exemplar storage backend because the buffer was full.",
+		}, []string{"user"}),
+		failedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_distributor_exemplar_storage_failed_requests_total",
+			Help: "The total number of requests to the exemplar storage backend which failed.",
+		}),
+	}
+
+	f.Service = services.NewBasicService(nil, f.running, f.stopping)
+	return f
+}
+
+// exemplarSpans is a batch of exemplars encoded as Jaeger spans, ready to be sent to the exemplar storage backend.
+type exemplarSpans struct {
+	userID       string
+	body         []byte
+	numExemplars int
+}
+
+// Extract removes the exemplars from the input series and returns them encoded as a Jaeger Thrift batch
+// of spans. The batch is encoded before returning, so the input series can be safely modified or released
+// once this function returns. Exemplars without a valid trace ID label are dropped. Returns nil if there
+// are no exemplars to forward. If the encoding fails, the exemplars are left in the input series.
+func (f *ExemplarForwarder) Extract(userID string, series []mimirpb.PreallocTimeseries) (*exemplarSpans, error) {
+	var spans []*jaeger.Span
+	skipped := 0
+
+	for _, ts := range series {
+		if len(ts.Exemplars) == 0 {
+			continue
+		}
+
+		seriesLabels := mimirpb.FromLabelAdaptersToLabels(ts.Labels)
+		seriesTags := make([]*jaeger.Tag, 0, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == labels.MetricName {
+				continue
+			}
+			seriesTags = append(seriesTags, stringTag(l.Name, l.Value))
+		}
+
+		for _, e := range ts.Exemplars {
+			span, ok := exemplarToSpan(seriesLabels, seriesTags, e)
+			if !ok {
+				skipped++
+				continue
+			}
+			spans = append(spans, span)
+		}
+	}
+
+	if skipped > 0 {
+		f.skippedExemplars.WithLabelValues(userID).Add(float64(skipped))
+	}
+	if len(spans) == 0 {
+		removeExemplars(series)
+		return nil, nil
+	}
+
+	batch := &jaeger.Batch{
+		Process: &jaeger.Process{
+			ServiceName: exemplarSpansServiceName,
+			Tags:        []*jaeger.Tag{stringTag("tenant", userID)},
+		},
+		Spans: spans,
+	}
+
+	body, err := thrift.NewTSerializer().Write(context.Background(), batch)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode exemplars")
+	}
+
+	removeExemplars(series)
+
+	return &exemplarSpans{userID: userID, body: body, numExemplars: len(spans)}, nil
+}
+
+// removeExemplars removes the exemplars from the input series, so that they're not sent to ingesters.
+func removeExemplars(series []mimirpb.PreallocTimeseries) {
+	for _, ts := range series {
+		ts.Exemplars = ts.Exemplars[:0]
+	}
+}
+
+// Enqueue buffers the input exemplars, previously extracted with Extract, to be sent to the exemplar
+// storage backend. It never blocks.
+func (f *ExemplarForwarder) Enqueue(exemplars *exemplarSpans) {
+	select {
+	case f.queue <- exemplars:
+	default:
+		f.droppedExemplars.WithLabelValues(exemplars.userID).Add(float64(exemplars.numExemplars))
+	}
+}
+
+func (f *ExemplarForwarder) running(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	wg.Add(exemplarForwarderConcurrency)
+
+	for i := 0; i < exemplarForwarderConcurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case exemplars := <-f.queue:
+					f.forward(context.Background(), exemplars)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (f *ExemplarForwarder) stopping(_ error) error {
+	// Send the exemplars still buffered, giving up once the remote timeout expires so that a slow
+	// backend can't hold the shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	for {
+		select {
+		case exemplars := <-f.queue:
+			if ctx.Err() != nil {
+				f.droppedExemplars.WithLabelValues(exemplars.userID).Add(float64(exemplars.numExemplars))
+				continue
+			}
+			f.forward(ctx, exemplars)
+		default:
+			return nil
+		}
+	}
+}
+
+func (f *ExemplarForwarder) forward(ctx context.Context, exemplars *exemplarSpans) {
+	if err := f.Forward(user.InjectOrgID(ctx, exemplars.userID), exemplars.userID, exemplars); err != nil {
+		level.Warn(f.logger).Log("msg", "failed to forward exemplars to the exemplar storage backend", "user", exemplars.userID, "err", err)
+	}
+}
+
+// Forward sends the input exemplars, previously extracted with Extract, to the exemplar storage backend.
+func (f *ExemplarForwarder) Forward(ctx context.Context, userID string, exemplars *exemplarSpans) error {
+	if err := f.send(ctx, userID, exemplars.body); err != nil {
+		f.failedRequests.Inc()
+		return err
+	}
+
+	f.forwardedExemplars.WithLabelValues(userID).Add(float64(exemplars.numExemplars))
+	return nil
+}
+
+func (f *ExemplarForwarder) send(ctx context.Context, userID string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create HTTP request to the exemplar storage backend")
+	}
+
+	httpReq.Header.Set("Content-Type", "application/x-thrift")
+	httpReq.Header.Set(user.OrgIDHeaderName, userID)
+
+	httpResp, err := f.client.Do(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "failed to send HTTP request to the exemplar storage backend")
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+		_ = httpResp.Body.Close()
+	}()
+
+	if httpResp.StatusCode/100 != 2 {
+		scanner := bufio.NewScanner(io.LimitReader(httpResp.Body, 1024))
+		line := ""
+		if scanner.Scan() {
+			line = scanner.Text()
+		}
+		return errors.Errorf("exemplar storage backend returned HTTP status %d: %s", httpResp.StatusCode, line)
+	}
+
+	return nil
+}
+
+func (f *ExemplarForwarder) deleteMetricsForUser(userID string) {
+	f.forwardedExemplars.DeleteLabelValues(userID)
+	f.skippedExemplars.DeleteLabelValues(userID)
+	f.droppedExemplars.DeleteLabelValues(userID)
+}
+
+// exemplarToSpan converts the exemplar to a zero-duration span named after the metric, tagged with the series
+// labels, the exemplar labels and the exemplar value. Returns false if the exemplar has no valid trace ID.
+// If the exemplar has no span ID, a span ID is derived from the series labels and the exemplar timestamp.
+func exemplarToSpan(seriesLabels labels.Labels, seriesTags []*jaeger.Tag, e mimirpb.Exemplar) (*jaeger.Span, bool) {
+	var (
+		traceID jaegerclient.TraceID
+		spanID  jaegerclient.SpanID
+	)
+
+	tags := make([]*jaeger.Tag, 0, len(seriesTags)+len(e.Labels)+1)
+	tags = append(tags, seriesTags...)
+
+	for _, l := range e.Labels {
+		switch {
+		case isOneOf(l.Name, exemplarTraceIDLabels):
+			if id, err := jaegerclient.TraceIDFromString(l.Value); err == nil && !traceID.IsValid() {
+				traceID = id
+			}
+		case isOneOf(l.Name, exemplarSpanIDLabels):
+			if id, err := jaegerclient.SpanIDFromString(l.Value); err == nil && spanID == 0 {
+				spanID = id
+			}
+		default:
+			tags = append(tags, stringTag(exemplarTagPrefix+l.Name, l.Value))
+		}
+	}
+
+	if !traceID.IsValid() {
+		return nil, false
+	}
+
+	if spanID == 0 {
+		h := fnv.New64a()
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], seriesLabels.Hash())
+		_, _ = h.Write(buf[:])
+		binary.LittleEndian.PutUint64(buf[:], uint64(e.TimestampMs))
+		_, _ = h.Write(buf[:])
+		spanID = jaegerclient.SpanID(h.Sum64())
+	}
+
+	value := e.Value
+	tags = append(tags, &jaeger.Tag{Key: exemplarTagPrefix + "value", VType: jaeger.TagType_DOUBLE, VDouble: &value})
+
+	return &jaeger.Span{
+		TraceIdLow:    int64(traceID.Low),
+		TraceIdHigh:   int64(traceID.High),
+		SpanId:        int64(spanID),
+		OperationName: seriesLabels.Get(labels.MetricName),
+		Flags:         1, // Sampled.
+		StartTime:     e.TimestampMs * 1000,
+		Tags:          tags,
+	}, true
+}
+
+func stringTag(key, value string) *jaeger.Tag {
+	return &jaeger.Tag{Key: key, VType: jaeger.TagType_STRING, VStr: &value}
+}
+
+func isOneOf(name string, names []string) bool {
+	for _, n := range names {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go/thrift"
+	"github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// mockExemplarStorageBackend is a Jaeger collector HTTP endpoint recording the received batches.
+type mockExemplarStorageBackend struct {
+	t      *testing.T
+	status int
+
+	mtx     sync.Mutex
+	tenants []string
+	batches []*jaeger.Batch
+}
+
+func newMockExemplarStorageBackend(t *testing.T, status int) (*mockExemplarStorageBackend, *httptest.Server) {
+	backend := &mockExemplarStorageBackend{t: t, status: status}
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	return backend, server
+}
+
+func (b *mockExemplarStorageBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(b.t, "application/x-thrift", r.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(b.t, err)
+
+	transport := thrift.NewTMemoryBufferLen(len(body))
+	_, err = transport.Write(body)
+	require.NoError(b.t, err)
+	batch := &jaeger.Batch{}
+	require.NoError(b.t, batch.Read(context.Background(), thrift.NewTBinaryProtocolTransport(transport)))
+
+	b.mtx.Lock()
+	b.tenants = append(b.tenants, r.Header.Get(user.OrgIDHeaderName))
+	b.batches = append(b.batches, batch)
+	b.mtx.Unlock()
+
+	if b.status != http.StatusOK {
+		http.Error(w, "backend failure", b.status)
+	}
+}
+
+func (b *mockExemplarStorageBackend) received() ([]string, []*jaeger.Batch) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.tenants, b.batches
+}
+
+func TestExemplarForwarder(t *testing.T) {
+	series := func() []mimirpb.PreallocTimeseries {
+		return []mimirpb.PreallocTimeseries{
+			{TimeSeries: &mimirpb.TimeSeries{
+				Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "series_1"}, {Name: "job", Value: "test"}},
+				Samples: []mimirpb.Sample{{Value: 1, TimestampMs: 1000}},
+				Exemplars: []mimirpb.Exemplar{
+					{Labels: []mimirpb.LabelAdapter{{Name: "pod", Value: "pod-1"}, {Name: "span_id", Value: "2"}, {Name: "trace_id", Value: "10000000000000001"}}, Value: 1.5, TimestampMs: 1000},
+					{Labels: []mimirpb.LabelAdapter{{Name: "traceID", Value: "abc"}}, Value: 2, TimestampMs: 2000},
+					{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "not-a-trace-id"}}, Value: 3, TimestampMs: 3000},
+				},
+			}},
+			{TimeSeries: &mimirpb.TimeSeries{
+				Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "series_2"}},
+				Samples: []mimirpb.Sample{{Value: 2, TimestampMs: 1000}},
+			}},
+		}
+	}
+
+	t.Run("should extract the exemplars as Jaeger spans and forward them", func(t *testing.T) {
+		backend, server := newMockExemplarStorageBackend(t, http.StatusOK)
+
+		reg := prometheus.NewPedanticRegistry()
+		f := NewExemplarForwarder(server.URL, time.Second, reg, log.NewNopLogger())
+
+		input := series()
+		exemplars, err := f.Extract("user-1", input)
+		require.NoError(t, err)
+		require.NotNil(t, exemplars)
+
+		// Exemplars are removed from the series right away.
+		assert.Empty(t, input[0].Exemplars)
+		assert.Len(t, input[0].Samples, 1)
+
+		require.NoError(t, f.Forward(context.Background(), "user-1", exemplars))
+
+		tenants, batches := backend.received()
+		require.Equal(t, []string{"user-1"}, tenants)
+		require.Len(t, batches, 1)
+
+		batch := batches[0]
+		assert.Equal(t, exemplarSpansServiceName, batch.Process.ServiceName)
+		require.Len(t, batch.Process.Tags, 1)
+		assert.Equal(t, "tenant", batch.Process.Tags[0].Key)
+		assert.Equal(t, "user-1", batch.Process.Tags[0].GetVStr())
+
+		// The exemplar without a valid trace ID is skipped.
+		require.Len(t, batch.Spans, 2)
+
+		first := batch.Spans[0]
+		assert.Equal(t, int64(1), first.TraceIdHigh)
+		assert.Equal(t, int64(1), first.TraceIdLow)
+		assert.Equal(t, int64(2), first.SpanId)
+		assert.Equal(t, "series_1", first.OperationName)
+		assert.Equal(t, int64(1000000), first.StartTime)
+		assert.Equal(t, map[string]interface{}{"job": "test", "exemplar.pod": "pod-1", "exemplar.value": 1.5}, spanTags(first))
+
+		second := batch.Spans[1]
+		assert.Equal(t, int64(0), second.TraceIdHigh)
+		assert.Equal(t, int64(0xabc), second.TraceIdLow)
+		assert.NotZero(t, second.SpanId)
+		assert.Equal(t, int64(2000000), second.StartTime)
+		assert.Equal(t, map[string]interface{}{"job": "test", "exemplar.value": float64(2)}, spanTags(second))
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_distributor_exemplar_storage_forwarded_exemplars_total The total number of exemplars forwarded to the exemplar storage backend.
+			# TYPE cortex_distributor_exemplar_storage_forwarded_exemplars_total counter
+			cortex_distributor_exemplar_storage_forwarded_exemplars_total{user="user-1"} 2
+			# HELP cortex_distributor_exemplar_storage_skipped_exemplars_total The total number of exemplars not forwarded to the exemplar storage backend because they have no valid trace ID.
+			# TYPE cortex_distributor_exemplar_storage_skipped_exemplars_total counter
+			cortex_distributor_exemplar_storage_skipped_exemplars_total{user="user-1"} 1
+			# HELP cortex_distributor_exemplar_storage_failed_requests_total The total number of requests to the exemplar storage backend which failed.
+			# TYPE cortex_distributor_exemplar_storage_failed_requests_total counter
+			cortex_distributor_exemplar_storage_failed_requests_total 0
+		`)))
+	})
+
+	t.Run("should not extract anything if there are no exemplars", func(t *testing.T) {
+		f := NewExemplarForwarder("http://localhost", time.Second, nil, log.NewNopLogger())
+		exemplars, err := f.Extract("user-1", series()[1:])
+		require.NoError(t, err)
+		assert.Nil(t, exemplars)
+	})
+
+	t.Run("should return error if the backend returns a non 2xx status code", func(t *testing.T) {
+		_, server := newMockExemplarStorageBackend(t, http.StatusInternalServerError)
+
+		f := NewExemplarForwarder(server.URL, time.Second, nil, log.NewNopLogger())
+		exemplars, err := f.Extract("user-1", series())
+		require.NoError(t, err)
+
+		err = f.Forward(context.Background(), "user-1", exemplars)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exemplar storage backend returned HTTP status 500: backend failure")
+	})
+
+	t.Run("should forward the enqueued exemplars asynchronously", func(t *testing.T) {
+		backend, server := newMockExemplarStorageBackend(t, http.StatusOK)
+
+		f := NewExemplarForwarder(server.URL, time.Second, nil, log.NewNopLogger())
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), f))
+		t.Cleanup(func() {
+			require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+		})
+
+		exemplars, err := f.Extract("user-1", series())
+		require.NoError(t, err)
+		f.Enqueue(exemplars)
+
+		test.Poll(t, time.Second, []string{"user-1"}, func() interface{} {
+			tenants, _ := backend.received()
+			return tenants
+		})
+		assert.Equal(t, float64(2), testutil.ToFloat64(f.forwardedExemplars.WithLabelValues("user-1")))
+	})
+
+	t.Run("should drop the enqueued exemplars when the buffer is full", func(t *testing.T) {
+		// The forwarder is not started, so exemplars are never consumed from the buffer.
+		f := NewExemplarForwarder("http://localhost", time.Second, nil, log.NewNopLogger())
+		for i := 0; i < exemplarForwarderQueueSize+10; i++ {
+			exemplars, err := f.Extract("user-1", series())
+			require.NoError(t, err)
+			f.Enqueue(exemplars)
+		}
+
+		assert.Equal(t, float64(20), testutil.ToFloat64(f.droppedExemplars.WithLabelValues("user-1")))
+	})
+}
+
+func TestDistributor_Push_ShouldForwardExemplarsOnlyAfterTheRequestIsAccepted(t *testing.T) {
+	makeRequest := func() *mimirpb.WriteRequest {
+		nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+		return &mimirpb.WriteRequest{Timeseries: []mimirpb.PreallocTimeseries{{TimeSeries: &mimirpb.TimeSeries{
+			Labels:    []mimirpb.LabelAdapter{{Name: "__name__", Value: "series_1"}},
+			Samples:   []mimirpb.Sample{{Value: 1, TimestampMs: nowMs}},
+			Exemplars: []mimirpb.Exemplar{{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "abc"}}, Value: 1, TimestampMs: nowMs}},
+		}}}}
+	}
+
+	tests := map[string]struct {
+		happyIngesters     int
+		ingestionRate      float64
+		backendStatus      int
+		expectedStatusCode int32
+		expectedForwarded  bool
+	}{
+		"should forward exemplars if the request is accepted": {
+			happyIngesters:    3,
+			backendStatus:     http.StatusOK,
+			expectedForwarded: true,
+		},
+		"should not fail the request if forwarding exemplars fails": {
+			happyIngesters:    3,
+			backendStatus:     http.StatusInternalServerError,
+			expectedForwarded: true,
+		},
+		"should not forward exemplars if the request is rate limited": {
+			happyIngesters:     3,
+			ingestionRate:      1,
+			backendStatus:      http.StatusOK,
+			expectedStatusCode: http.StatusTooManyRequests,
+		},
+		"should not forward exemplars if the request fails to be pushed to ingesters": {
+			happyIngesters: 0,
+			backendStatus:  http.StatusOK,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			backend, server := newMockExemplarStorageBackend(t, testData.backendStatus)
+
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			limits.MaxGlobalExemplarsPerUser = 10
+			if testData.ingestionRate > 0 {
+				limits.IngestionRate = testData.ingestionRate
+				limits.IngestionBurstSize = 1
+			}
+
+			ds, _, _ := prepare(t, prepConfig{
+				numIngesters:           3,
+				happyIngesters:         testData.happyIngesters,
+				numDistributors:        1,
+				limits:                 limits,
+				exemplarStorageBackend: server.URL,
+			})
+
+			_, err := ds[0].Push(user.InjectOrgID(context.Background(), "user-1"), makeRequest())
+			if testData.happyIngesters == 0 {
+				require.Error(t, err)
+			} else if testData.expectedStatusCode != 0 {
+				resp, ok := httpgrpc.HTTPResponseFromError(err)
+				require.True(t, ok)
+				assert.Equal(t, testData.expectedStatusCode, resp.Code)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if !testData.expectedForwarded {
+				_, batches := backend.received()
+				assert.Empty(t, batches)
+				return
+			}
+
+			// Exemplars are forwarded asynchronously.
+			test.Poll(t, time.Second, []string{"user-1"}, func() interface{} {
+				tenants, _ := backend.received()
+				return tenants
+			})
+			_, batches := backend.received()
+			require.Len(t, batches, 1)
+			require.Len(t, batches[0].Spans, 1)
+			assert.Equal(t, int64(0xabc), batches[0].Spans[0].TraceIdLow)
+		})
+	}
+}
+
+func spanTags(span *jaeger.Span) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for _, tag := range span.Tags {
+		switch tag.VType {
+		case jaeger.TagType_STRING:
+			tags[tag.Key] = tag.GetVStr()
+		case jaeger.TagType_DOUBLE:
+			tags[tag.Key] = tag.GetVDouble()
+		}
+	}
+	return tags
+}
@@ -15,6 +15,8 @@ type Config struct {
 	RequestConcurrency int           `yaml:"request_concurrency" category:"experimental"`
 	RequestTimeout     time.Duration `yaml:"request_timeout" category:"experimental"`
 	PropagateErrors    bool          `yaml:"propagate_errors" category:"experimental"`
+	RulesFile          string        `yaml:"rules_file" category:"experimental"`
+	RulesReloadPeriod  time.Duration `yaml:"rules_reload_period" category:"experimental"`
 
 	GRPCClientConfig grpcclient.Config `yaml:"grpc_client" doc:"description=Configures the gRPC client used to communicate between the distributors and the configured remote write endpoints used by the metrics forwarding feature."`
 }
@@ -24,6 +26,8 @@ func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&c.RequestConcurrency, "distributor.forwarding.request-concurrency", 10, "Maximum concurrency at which forwarding requests get performed.")
 	f.DurationVar(&c.RequestTimeout, "distributor.forwarding.request-timeout", 2*time.Second, "Timeout for requests to ingestion endpoints to which we forward metrics.")
 	f.BoolVar(&c.PropagateErrors, "distributor.forwarding.propagate-errors", true, "If disabled then forwarding requests are always considered to be successful, errors are ignored.")
+	f.StringVar(&c.RulesFile, "distributor.forwarding.rules-file", "", "Path to a YAML file containing forwarding rules applied to the series of all tenants, in addition to the per-tenant forwarding rules. Each rule forwards the series matching a series selector (matcher) to a remote_write endpoint (target_url), and optionally doesn't push them to the ingesters (drop_locally). The file is reloaded every -distributor.forwarding.rules-reload-period.")
+	f.DurationVar(&c.RulesReloadPeriod, "distributor.forwarding.rules-reload-period", 10*time.Second, "How often the forwarding rules file is reloaded.")
 	c.GRPCClientConfig.RegisterFlagsWithPrefix("distributor.forwarding.grpc-client", f)
 }
 
@@ -31,5 +35,8 @@ func (c *Config) Validate() error {
 	if c.RequestConcurrency < 1 {
 		return errors.New("distributor.forwarding.request-concurrency must be greater than 0")
 	}
+	if c.RulesFile != "" && c.RulesReloadPeriod <= 0 {
+		return errors.New("distributor.forwarding.rules-reload-period must be greater than 0")
+	}
 	return nil
 }
@@ -60,6 +60,11 @@ type forwarder struct {
 	reqCh              chan *request
 	httpGrpcClientPool *client.Pool
 
+	// rulesEngine is nil if the forwarding rules file is not configured.
+	rulesEngine     *ForwardingRulesEngine
+	rulesReloadStop chan struct{}
+	rulesReloadDone chan struct{}
+
 	requestsTotal           prometheus.Counter
 	errorsTotal             *prometheus.CounterVec
 	samplesTotal            prometheus.Counter
@@ -126,6 +131,11 @@ func NewForwarder(cfg Config, reg prometheus.Registerer, log log.Logger) Forward
 	}
 
 	f.httpGrpcClientPool = f.newHTTPGrpcClientsPool()
+	if cfg.RulesFile != "" {
+		f.rulesEngine = NewForwardingRulesEngine(cfg.RulesFile, log, reg)
+		f.rulesReloadStop = make(chan struct{})
+		f.rulesReloadDone = make(chan struct{})
+	}
 	f.Service = services.NewIdleService(f.start, f.stop)
 
 	return f
@@ -181,6 +191,12 @@ func (f *forwarder) createHTTPGrpcClient(addr string) (client.PoolClient, error)
 }
 
 func (f *forwarder) start(ctx context.Context) error {
+	if f.rulesEngine != nil {
+		if err := f.rulesEngine.Reload(); err != nil {
+			return err
+		}
+	}
+
 	if err := services.StartAndAwaitRunning(ctx, f.httpGrpcClientPool); err != nil {
 		return errors.Wrap(err, "failed to start grpc client pool")
 	}
@@ -191,10 +207,21 @@ func (f *forwarder) start(ctx context.Context) error {
 		go f.worker()
 	}
 
+	// The rules are periodically reloaded only once the forwarder has successfully started, because stop()
+	// isn't called if start() fails.
+	if f.rulesEngine != nil {
+		go f.reloadRulesLoop()
+	}
+
 	return nil
 }
 
 func (f *forwarder) stop(_ error) error {
+	if f.rulesEngine != nil {
+		close(f.rulesReloadStop)
+		<-f.rulesReloadDone
+	}
+
 	close(f.reqCh)
 	f.workerWg.Wait()
 
@@ -204,6 +231,25 @@ func (f *forwarder) stop(_ error) error {
 	return nil
 }
 
+// reloadRulesLoop periodically reloads the forwarding rules file, until the forwarder is stopped.
+func (f *forwarder) reloadRulesLoop() {
+	defer close(f.rulesReloadDone)
+
+	ticker := time.NewTicker(f.cfg.RulesReloadPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.rulesEngine.Reload(); err != nil {
+				level.Warn(f.log).Log("msg", "failed to reload forwarding rules, keeping the previous rules", "err", err)
+			}
+		case <-f.rulesReloadStop:
+			return
+		}
+	}
+}
+
 // worker is a worker go routine which performs the forwarding requests that it receives through a channel.
 func (f *forwarder) worker() {
 	defer f.workerWg.Done()
@@ -222,14 +268,16 @@ func (f *forwarder) worker() {
 // The slice of time series which gets passed into this function must not be returned to the pool by the caller, the
 // returned slice of time series must be returned to the pool by the caller once it is done using it.
 //
-// Endpoint must be non-empty.
+// The time series are forwarded to the endpoint according to the given rules, and to the targets of the forwarding
+// rules loaded from the rules file, if configured. If the endpoint is empty, the time series are only forwarded
+// according to the rules file.
 //
 // The return values are:
 //   - A slice of time series which should be sent to the ingesters, based on the given rule set.
 //     The Forward() method does not send the time series to the ingesters itself, it expects the caller to do that.
 //   - A chan of errors which resulted from forwarding the time series, the chan gets closed when all forwarding requests have completed.
 func (f *forwarder) Forward(ctx context.Context, endpoint string, dontForwardBefore int64, rules validation.ForwardingRules, in []mimirpb.PreallocTimeseries, user string) ([]mimirpb.PreallocTimeseries, chan error) {
-	if !f.cfg.Enabled || endpoint == "" {
+	if !f.cfg.Enabled || (endpoint == "" && f.rulesEngine == nil) {
 		errCh := make(chan error)
 		close(errCh)
 		return in, errCh
@@ -243,17 +291,19 @@ func (f *forwarder) Forward(ctx context.Context, endpoint string, dontForwardBef
 		}
 	}()
 
-	toIngest, toForward, counts, err := f.splitToIngestedAndForwardedTimeseries(in, rules, dontForwardBefore, user)
-	errCh := make(chan error, 2) // 1 for result of forwarding, 1 for possible error
+	toIngest, toForward, counts, err := f.splitToIngestedAndForwardedTimeseries(in, endpoint, rules, dontForwardBefore, user)
+	errCh := make(chan error, len(toForward)+1) // 1 for the result of each forwarding request, 1 for possible error
 	if err != nil {
 		errCh <- err
 	}
 
 	if len(toForward) > 0 {
 		var requestWg sync.WaitGroup
-		requestWg.Add(1)
+		requestWg.Add(len(toForward))
 
-		f.submitForwardingRequest(ctx, endpoint, toForward, counts, &requestWg, errCh)
+		for target, ts := range toForward {
+			f.submitForwardingRequest(ctx, target, ts, counts[target], &requestWg, errCh)
+		}
 
 		// keep span running until goroutine finishes.
 		finishSpanlogInDefer = false
@@ -266,7 +316,6 @@ func (f *forwarder) Forward(ctx context.Context, endpoint string, dontForwardBef
 			spanlog.Finish()
 		}()
 	} else {
-		f.pools.putTsSlice(toForward)
 		close(errCh)
 	}
 
@@ -312,27 +361,31 @@ func (t *TimeseriesCounts) count(ts mimirpb.PreallocTimeseries) {
 }
 
 // splitToIngestedAndForwardedTimeseries takes a slice of time series and a set of forwarding rules, then it divides
-// the given time series into series that should be ingested and series that should be forwarded.
+// the given time series into series that should be ingested and series that should be forwarded to each target.
+// The series matching the given rules are forwarded to the given endpoint, while the series matching the rules
+// of the rules engine are forwarded to the rule targets.
 //
 // It returns the following values:
 //   - A slice of time series to ingest into the ingesters.
-//   - A slice of time series to forward
-//   - TimeseriesCounts
+//   - The slices of time series to forward, by target.
+//   - TimeseriesCounts by target.
 //   - An error if any occurred.
-func (f *forwarder) splitToIngestedAndForwardedTimeseries(tsSliceIn []mimirpb.PreallocTimeseries, rules validation.ForwardingRules, dontForwardBefore int64, user string) (tsToIngest, tsToForward []mimirpb.PreallocTimeseries, _ TimeseriesCounts, _ error) {
+func (f *forwarder) splitToIngestedAndForwardedTimeseries(tsSliceIn []mimirpb.PreallocTimeseries, endpoint string, rules validation.ForwardingRules, dontForwardBefore int64, user string) (tsToIngest []mimirpb.PreallocTimeseries, tsToForward map[string][]mimirpb.PreallocTimeseries, _ map[string]TimeseriesCounts, _ error) {
 	// This functions copies all the entries of tsSliceIn into new slices so tsSliceIn can be recycled,
 	// we adjust the length of the slice to 0 to prevent that the contained *mimirpb.TimeSeries objects that have been
 	// reassigned (not deep copied) get returned while they are still referred to by another slice.
 	defer f.pools.putTsSlice(tsSliceIn[:0])
 
 	tsToIngest = f.pools.getTsSlice()
-	tsToForward = f.pools.getTsSlice()
-	counts := TimeseriesCounts{}
+	tsToForward = map[string][]mimirpb.PreallocTimeseries{}
+	counts := map[string]TimeseriesCounts{}
 	var err error
+	var targets []string
 
 	for _, ts := range tsSliceIn {
-		forward, ingest := shouldForwardAndIngest(ts.Labels, rules)
-		if forward {
+		var ingest bool
+		targets, ingest = f.forwardingTargets(ts.Labels, endpoint, rules, targets[:0])
+		if len(targets) > 0 {
 			tsCopy, filteredSamples := f.filterAndCopyTimeseries(ts, dontForwardBefore)
 			if filteredSamples > 0 {
 				err = errSamplesTooOld
@@ -342,8 +395,23 @@ func (f *forwarder) splitToIngestedAndForwardedTimeseries(tsSliceIn []mimirpb.Pr
 			}
 
 			if len(tsCopy.TimeSeries.Samples) > 0 {
-				tsToForward = append(tsToForward, tsCopy)
-				counts.count(tsCopy)
+				for idx, target := range targets {
+					// Each forwarding request returns its time series to the pool once done,
+					// so each target needs its own copy.
+					targetTs := tsCopy
+					if idx > 0 {
+						targetTs = mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{TimeSeries: f.pools.getTs()}, tsCopy, false)
+					}
+
+					if _, ok := tsToForward[target]; !ok {
+						tsToForward[target] = f.pools.getTsSlice()
+					}
+					tsToForward[target] = append(tsToForward[target], targetTs)
+
+					targetCounts := counts[target]
+					targetCounts.count(targetTs)
+					counts[target] = targetCounts
+				}
 			} else {
 				// We're not going to use this timeseries, put it back to pool.
 				f.pools.putTs(tsCopy.TimeSeries)
@@ -364,6 +432,32 @@ func (f *forwarder) splitToIngestedAndForwardedTimeseries(tsSliceIn []mimirpb.Pr
 	return tsToIngest, tsToForward, counts, err
 }
 
+// forwardingTargets appends to the input targets the endpoints the series must be forwarded to, according to
+// the given rules and the rules engine, and returns whether the series must be ingested.
+func (f *forwarder) forwardingTargets(labels []mimirpb.LabelAdapter, endpoint string, rules validation.ForwardingRules, targets []string) (_ []string, ingest bool) {
+	ingest = true
+
+	if endpoint != "" {
+		var forward bool
+		forward, ingest = shouldForwardAndIngest(labels, rules)
+		if forward {
+			targets = append(targets, endpoint)
+		}
+	}
+
+	if f.rulesEngine != nil {
+		engineTargets, dropLocally := f.rulesEngine.Route(labels)
+		for _, target := range engineTargets {
+			if !containsString(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+		ingest = ingest && !dropLocally
+	}
+
+	return targets, ingest
+}
+
 // dropSamplesBefore filters a given slice of samples to only contain samples that have timestamps newer or equal to
 // the given timestamp. It relies on the samples being sorted by timestamp.
 func dropSamplesBefore(samples []mimirpb.Sample, ts int64) []mimirpb.Sample {
@@ -116,6 +116,88 @@ func TestForwardingSamplesSuccessfullyToSingleTarget(t *testing.T) {
 	))
 }
 
+func TestForwardingSamplesToRulesFileTargets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+
+	tenantURL, _, tenantBodiesFn := newTestServer(t, 200, true)
+	target1URL, _, target1BodiesFn := newTestServer(t, 200, true)
+	target2URL, _, target2BodiesFn := newTestServer(t, 200, true)
+
+	cfg := testConfig
+	cfg.RulesReloadPeriod = time.Minute
+	cfg.RulesFile = writeForwardingRulesFile(t, `
+rules:
+  - matcher: '{__name__="metric1"}'
+    target_url: `+target1URL+`
+  - matcher: '{__name__=~"metric1|metric2", some_label="foo"}'
+    target_url: `+target2URL+`
+    drop_locally: true
+`)
+	forwarder, reg := newForwarder(t, cfg, true)
+
+	rules := validation.ForwardingRules{
+		"metric3": validation.ForwardingRule{Ingest: true},
+	}
+
+	ts := []mimirpb.PreallocTimeseries{
+		newSample(t, now, 1, 100, "__name__", "metric1", "some_label", "foo"),
+		newSample(t, now, 2, 200, "__name__", "metric1", "some_label", "bar"),
+		newSample(t, now, 3, 300, "__name__", "metric2", "some_label", "foo"),
+		newSample(t, now, 4, 400, "__name__", "metric3", "some_label", "foo"),
+	}
+	tsToIngest, errCh := forwarder.Forward(ctx, tenantURL, 0, rules, ts, "user")
+
+	// The series matching a rule with drop_locally should not be ingested.
+	require.Len(t, tsToIngest, 2)
+	requireLabelsEqual(t, tsToIngest[0].Labels, "__name__", "metric1", "some_label", "bar")
+	requireLabelsEqual(t, tsToIngest[1].Labels, "__name__", "metric3", "some_label", "foo")
+
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+
+	tenantBodies := tenantBodiesFn()
+	require.Len(t, tenantBodies, 1)
+	tenantReq := decodeBody(t, tenantBodies[0])
+	require.Len(t, tenantReq.Timeseries, 1)
+	requireLabelsEqual(t, tenantReq.Timeseries[0].Labels, "__name__", "metric3", "some_label", "foo")
+
+	target1Bodies := target1BodiesFn()
+	require.Len(t, target1Bodies, 1)
+	target1Req := decodeBody(t, target1Bodies[0])
+	require.Len(t, target1Req.Timeseries, 2)
+	requireLabelsEqual(t, target1Req.Timeseries[0].Labels, "__name__", "metric1", "some_label", "foo")
+	requireSamplesEqual(t, target1Req.Timeseries[0].Samples, now, 1)
+	requireLabelsEqual(t, target1Req.Timeseries[1].Labels, "__name__", "metric1", "some_label", "bar")
+	requireSamplesEqual(t, target1Req.Timeseries[1].Samples, now, 2)
+
+	target2Bodies := target2BodiesFn()
+	require.Len(t, target2Bodies, 1)
+	target2Req := decodeBody(t, target2Bodies[0])
+	require.Len(t, target2Req.Timeseries, 2)
+	requireLabelsEqual(t, target2Req.Timeseries[0].Labels, "__name__", "metric1", "some_label", "foo")
+	requireSamplesEqual(t, target2Req.Timeseries[0].Samples, now, 1)
+	requireLabelsEqual(t, target2Req.Timeseries[1].Labels, "__name__", "metric2", "some_label", "foo")
+	requireSamplesEqual(t, target2Req.Timeseries[1].Samples, now, 3)
+
+	expectedMetrics := `
+	# HELP cortex_distributor_forward_requests_total The total number of requests the Distributor made to forward samples.
+	# TYPE cortex_distributor_forward_requests_total counter
+	cortex_distributor_forward_requests_total{} 3
+	# HELP cortex_distributor_forward_samples_total The total number of samples the Distributor forwarded.
+	# TYPE cortex_distributor_forward_samples_total counter
+	cortex_distributor_forward_samples_total{} 5
+`
+
+	require.NoError(t, testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(expectedMetrics),
+		"cortex_distributor_forward_requests_total",
+		"cortex_distributor_forward_samples_total",
+	))
+}
+
 func TestForwardingOmitOldSamples(t *testing.T) {
 	ctx := context.Background()
 
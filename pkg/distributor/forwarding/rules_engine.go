@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package forwarding
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// ForwardingRule forwards the series matching a series selector to a remote_write endpoint.
+type ForwardingRule struct {
+	// Matcher is a series selector, such as {__name__="up",job="legacy"}.
+	Matcher string `yaml:"matcher"`
+
+	// TargetURL is the remote_write endpoint the matching series are forwarded to.
+	TargetURL string `yaml:"target_url"`
+
+	// DropLocally defines whether the matching series are not pushed to the ingesters.
+	DropLocally bool `yaml:"drop_locally"`
+}
+
+// forwardingRulesFile is the content of the file the forwarding rules are loaded from.
+type forwardingRulesFile struct {
+	Rules []ForwardingRule `yaml:"rules"`
+}
+
+type compiledForwardingRule struct {
+	matchers    []*labels.Matcher
+	targetURL   string
+	dropLocally bool
+}
+
+func (r compiledForwardingRule) matches(series labels.Labels) bool {
+	for _, m := range r.matchers {
+		if !m.Matches(series.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForwardingRulesEngine routes the series to the remote_write endpoints of the forwarding rules they match,
+// regardless of the tenant. The rules are loaded from a file and can be reloaded while running: when the
+// reload fails, the previous rules are kept.
+type ForwardingRulesEngine struct {
+	path   string
+	logger log.Logger
+
+	mtx         sync.RWMutex
+	rules       []compiledForwardingRule
+	lastContent []byte
+
+	lastReloadSuccessful prometheus.Gauge
+}
+
+// NewForwardingRulesEngine makes a new ForwardingRulesEngine loading the rules from the input file. The rules
+// are not loaded until Reload() is called.
+func NewForwardingRulesEngine(path string, logger log.Logger, reg prometheus.Registerer) *ForwardingRulesEngine {
+	return &ForwardingRulesEngine{
+		path:   path,
+		logger: logger,
+		lastReloadSuccessful: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_distributor_forwarding_rules_last_reload_successful",
+			Help: "Whether the last reload of the distributor forwarding rules file has been successful.",
+		}),
+	}
+}
+
+// Reload loads the rules from the file, if changed since the last reload.
+func (e *ForwardingRulesEngine) Reload() error {
+	content, err := os.ReadFile(e.path)
+	if err != nil {
+		e.lastReloadSuccessful.Set(0)
+		return errors.Wrap(err, "read forwarding rules file")
+	}
+
+	e.mtx.RLock()
+	unchanged := e.lastContent != nil && bytes.Equal(content, e.lastContent)
+	e.mtx.RUnlock()
+	if unchanged {
+		e.lastReloadSuccessful.Set(1)
+		return nil
+	}
+
+	rules, err := parseForwardingRules(content)
+	if err != nil {
+		e.lastReloadSuccessful.Set(0)
+		return errors.Wrapf(err, "load forwarding rules file %s", e.path)
+	}
+
+	e.mtx.Lock()
+	e.rules = rules
+	e.lastContent = content
+	e.mtx.Unlock()
+
+	e.lastReloadSuccessful.Set(1)
+	level.Info(e.logger).Log("msg", "loaded forwarding rules", "file", e.path, "rules", len(rules))
+	return nil
+}
+
+// Route returns the remote_write endpoints the input series must be forwarded to, and whether the series
+// must not be pushed to the ingesters because a matching rule drops it locally.
+func (e *ForwardingRulesEngine) Route(series []mimirpb.LabelAdapter) (targets []string, dropLocally bool) {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+
+	lbls := mimirpb.FromLabelAdaptersToLabels(series)
+	for _, r := range e.rules {
+		if !r.matches(lbls) {
+			continue
+		}
+
+		if !containsString(targets, r.targetURL) {
+			targets = append(targets, r.targetURL)
+		}
+		dropLocally = dropLocally || r.dropLocally
+	}
+
+	return targets, dropLocally
+}
+
+func parseForwardingRules(content []byte) ([]compiledForwardingRule, error) {
+	file := forwardingRulesFile{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	rules := make([]compiledForwardingRule, 0, len(file.Rules))
+	for idx, r := range file.Rules {
+		matchers, err := parser.ParseMetricSelector(r.Matcher)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher of rule %d: %w", idx, err)
+		}
+
+		if r.TargetURL == "" {
+			return nil, fmt.Errorf("missing target URL of rule %d", idx)
+		}
+		if _, err := url.Parse(r.TargetURL); err != nil {
+			return nil, fmt.Errorf("invalid target URL of rule %d: %w", idx, err)
+		}
+
+		rules = append(rules, compiledForwardingRule{
+			matchers:    matchers,
+			targetURL:   r.TargetURL,
+			dropLocally: r.DropLocally,
+		})
+	}
+
+	return rules, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package forwarding
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestForwardingRulesEngine_Route(t *testing.T) {
+	path := writeForwardingRulesFile(t, `
+rules:
+  - matcher: '{__name__="metric1"}'
+    target_url: http://target-1/push
+  - matcher: '{__name__=~"metric.*", job="legacy"}'
+    target_url: http://target-2/push
+    drop_locally: true
+  - matcher: '{job="legacy"}'
+    target_url: http://target-1/push
+`)
+
+	engine := NewForwardingRulesEngine(path, log.NewNopLogger(), nil)
+	require.NoError(t, engine.Reload())
+
+	tests := map[string]struct {
+		series              []mimirpb.LabelAdapter
+		expectedTargets     []string
+		expectedDropLocally bool
+	}{
+		"no matching rule": {
+			series: []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric2"}},
+		},
+		"single matching rule": {
+			series:          []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric1"}},
+			expectedTargets: []string{"http://target-1/push"},
+		},
+		"multiple matching rules with the same target and drop locally": {
+			series:              []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric1"}, {Name: "job", Value: "legacy"}},
+			expectedTargets:     []string{"http://target-1/push", "http://target-2/push"},
+			expectedDropLocally: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			targets, dropLocally := engine.Route(testData.series)
+			assert.Equal(t, testData.expectedTargets, targets)
+			assert.Equal(t, testData.expectedDropLocally, dropLocally)
+		})
+	}
+}
+
+func TestForwardingRulesEngine_Reload(t *testing.T) {
+	path := writeForwardingRulesFile(t, `
+rules:
+  - matcher: '{__name__="metric1"}'
+    target_url: http://target-1/push
+`)
+
+	reg := prometheus.NewPedanticRegistry()
+	engine := NewForwardingRulesEngine(path, log.NewNopLogger(), reg)
+	series := []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric1"}}
+
+	// No rules before the first reload.
+	targets, _ := engine.Route(series)
+	assert.Empty(t, targets)
+
+	require.NoError(t, engine.Reload())
+	targets, _ = engine.Route(series)
+	assert.Equal(t, []string{"http://target-1/push"}, targets)
+
+	// Rules are replaced on reload.
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - matcher: '{__name__="metric1"}'
+    target_url: http://target-2/push
+`), 0644))
+	require.NoError(t, engine.Reload())
+	targets, _ = engine.Route(series)
+	assert.Equal(t, []string{"http://target-2/push"}, targets)
+
+	// Previous rules are kept if the reload fails.
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - matcher: '{__name__="metric1"'
+    target_url: http://target-3/push
+`), 0644))
+	require.Error(t, engine.Reload())
+	targets, _ = engine.Route(series)
+	assert.Equal(t, []string{"http://target-2/push"}, targets)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_forwarding_rules_last_reload_successful Whether the last reload of the distributor forwarding rules file has been successful.
+		# TYPE cortex_distributor_forwarding_rules_last_reload_successful gauge
+		cortex_distributor_forwarding_rules_last_reload_successful 0
+	`), "cortex_distributor_forwarding_rules_last_reload_successful"))
+}
+
+func TestParseForwardingRules(t *testing.T) {
+	tests := map[string]struct {
+		content       string
+		expectedRules int
+		expectedErr   string
+	}{
+		"empty file": {
+			content: "",
+		},
+		"valid rules": {
+			content: `
+rules:
+  - matcher: '{__name__="metric1"}'
+    target_url: http://target-1/push
+  - matcher: 'metric2'
+    target_url: httpgrpc://target-2:9095/api/v1/push
+    drop_locally: true
+`,
+			expectedRules: 2,
+		},
+		"unknown field": {
+			content: `
+rules:
+  - matcher: '{__name__="metric1"}'
+    target: http://target-1/push
+`,
+			expectedErr: "field target not found",
+		},
+		"invalid matcher": {
+			content: `
+rules:
+  - matcher: '{__name__=}'
+    target_url: http://target-1/push
+`,
+			expectedErr: "invalid matcher of rule 0",
+		},
+		"missing target URL": {
+			content: `
+rules:
+  - matcher: '{__name__="metric1"}'
+`,
+			expectedErr: "missing target URL of rule 0",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			rules, err := parseForwardingRules([]byte(testData.content))
+			if testData.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, rules, testData.expectedRules)
+		})
+	}
+}
+
+func writeForwardingRulesFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
@@ -20,12 +20,14 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/kv/codec"
+	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/timestamp"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/bucket"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -37,6 +39,14 @@ var (
 	errMemberlistUnsupported          = errors.New("memberlist is not supported by the HA tracker since gossip propagation is too slow for HA purposes")
 )
 
+var (
+	// haTrackerStateExportRingOp is the operation used to find the distributor exporting the HA tracker state.
+	haTrackerStateExportRingOp = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
+
+	// haTrackerStateExportRingKey is the ring key of the distributor exporting the HA tracker state.
+	haTrackerStateExportRingKey = shardByUser(HATrackerStateFilename)
+)
+
 type haTrackerLimits interface {
 	// MaxHAClusters returns max number of clusters that HA tracker should track for a user.
 	// Samples from additional clusters are rejected.
@@ -69,6 +79,8 @@ type HATrackerConfig struct {
 	FailoverTimeout time.Duration `yaml:"ha_tracker_failover_timeout" category:"advanced"`
 
 	KVStore kv.Config `yaml:"kvstore" doc:"description=Backend storage to use for the ring. Please be aware that memberlist is not supported by the HA tracker since gossip propagation is too slow for HA purposes."`
+
+	StateExport HATrackerStateExportConfig `yaml:"state_export"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -83,6 +95,8 @@ func (cfg *HATrackerConfig) RegisterFlags(f *flag.FlagSet) {
 	// order to not clash with the ring key if they both share the same KVStore
 	// backend (ie. run on the same consul cluster).
 	cfg.KVStore.RegisterFlagsWithPrefix("distributor.ha-tracker.", "ha-tracker/", f)
+
+	cfg.StateExport.RegisterFlags(f)
 }
 
 // Validate config and returns error on failure
@@ -100,7 +114,7 @@ func (cfg *HATrackerConfig) Validate() error {
 		return errMemberlistUnsupported
 	}
 
-	return nil
+	return cfg.StateExport.Validate()
 }
 
 func GetReplicaDescCodec() codec.Proto {
@@ -121,6 +135,14 @@ type haTracker struct {
 	electedLock sync.RWMutex                         // protects clusters maps
 	clusters    map[string]map[string]*haClusterInfo // Known clusters with elected replicas per user. First key = user, second key = cluster name.
 
+	// Exports the elected replicas to the object storage. Nil if disabled.
+	stateExporter *HATrackerStateExporter
+
+	// Returns whether the state is exported by this distributor. Nil if the state is always
+	// exported by this distributor.
+	stateExportOwnerMtx sync.RWMutex
+	stateExportOwner    func() bool
+
 	electedReplicaChanges         *prometheus.CounterVec
 	electedReplicaTimestamp       *prometheus.GaugeVec
 	electedReplicaPropagationTime prometheus.Histogram
@@ -202,12 +224,106 @@ func newHATracker(cfg HATrackerConfig, limits haTrackerLimits, reg prometheus.Re
 			return nil, err
 		}
 		t.client = client
+
+		if cfg.StateExport.Enabled {
+			bkt, err := bucket.NewClient(context.Background(), cfg.StateExport.Bucket, "ha-tracker-state-export", logger, reg)
+			if err != nil {
+				return nil, err
+			}
+			// Exported replicas older than the failover timeout are not imported, so their receive
+			// timestamp is refreshed well before.
+			t.stateExporter = NewHATrackerStateExporter(bkt, cfg.FailoverTimeout/2, logger, reg)
+		}
 	}
 
-	t.Service = services.NewBasicService(nil, t.loop, nil)
+	t.Service = services.NewBasicService(t.starting, t.loop, nil)
 	return t, nil
 }
 
+func (h *haTracker) starting(ctx context.Context) error {
+	if h.stateExporter == nil {
+		return nil
+	}
+
+	// Import the last exported state, so that the replicas elected before a restart keep being accepted
+	// without a re-election. Failing to import it is not fatal, because it's just an optimization.
+	state, err := h.stateExporter.Import(ctx)
+	if err != nil {
+		level.Warn(h.logger).Log("msg", "failed to import HA tracker state", "err", err)
+		return nil
+	}
+
+	h.importState(state, time.Now())
+	return nil
+}
+
+// importState adds the input elected replicas, keyed by user and cluster, to the cache. Replicas marked
+// for deletion, or not updated since more than the failover timeout, are skipped because they may not be
+// elected anymore. Clusters already in the cache are skipped too.
+func (h *haTracker) importState(state map[string]map[string]ReplicaDesc, now time.Time) {
+	h.electedLock.Lock()
+	defer h.electedLock.Unlock()
+
+	imported := 0
+	for userID, clusters := range state {
+		for cluster, desc := range clusters {
+			if desc.DeletedAt > 0 || now.Sub(timestamp.Time(desc.ReceivedAt)) >= h.cfg.FailoverTimeout {
+				continue
+			}
+			if h.clusters[userID][cluster] != nil {
+				continue
+			}
+
+			desc := desc
+			h.updateCache(userID, cluster, &desc)
+			imported++
+		}
+	}
+
+	level.Info(h.logger).Log("msg", "imported HA tracker state", "clusters", imported)
+}
+
+// setStateExportRing makes the distributor export the state only if it owns the state export key in the
+// input ring, so that the state is exported by a single distributor.
+func (h *haTracker) setStateExportRing(r ring.ReadRing, instanceAddr string) {
+	h.stateExportOwnerMtx.Lock()
+	defer h.stateExportOwnerMtx.Unlock()
+
+	h.stateExportOwner = func() bool {
+		set, err := r.Get(haTrackerStateExportRingKey, haTrackerStateExportRingOp, nil, nil, nil)
+		if err != nil {
+			level.Warn(h.logger).Log("msg", "failed to check the HA tracker state export owner", "err", err)
+			return false
+		}
+		return set.Includes(instanceAddr)
+	}
+}
+
+// exportState exports the elected replicas currently in the cache, if this distributor is the one exporting them.
+func (h *haTracker) exportState(ctx context.Context) {
+	h.stateExportOwnerMtx.RLock()
+	isOwner := h.stateExportOwner
+	h.stateExportOwnerMtx.RUnlock()
+
+	if isOwner != nil && !isOwner() {
+		return
+	}
+
+	h.electedLock.RLock()
+	state := make(map[string]map[string]ReplicaDesc, len(h.clusters))
+	for userID, clusters := range h.clusters {
+		state[userID] = make(map[string]ReplicaDesc, len(clusters))
+		for cluster, entry := range clusters {
+			state[userID][cluster] = entry.elected
+		}
+	}
+	h.electedLock.RUnlock()
+
+	if err := h.stateExporter.Export(ctx, state); err != nil {
+		level.Warn(h.logger).Log("msg", "failed to export HA tracker state", "err", err)
+	}
+}
+
 // Follows pattern used by ring for WatchKey.
 func (h *haTracker) loop(ctx context.Context) error {
 	if !h.cfg.EnableHATracker {
@@ -282,12 +398,22 @@ func (h *haTracker) updateKVLoop(ctx context.Context) {
 	tick := time.NewTicker(h.cfg.UpdateTimeout)
 	defer tick.Stop()
 
+	// The export ticker channel is nil, and never selected, if the state export is disabled.
+	var exportTickC <-chan time.Time
+	if h.stateExporter != nil {
+		exportTick := time.NewTicker(h.cfg.StateExport.Interval)
+		defer exportTick.Stop()
+		exportTickC = exportTick.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case t := <-tick.C:
 			h.updateKVStoreAll(ctx, t)
+		case <-exportTickC:
+			h.exportState(ctx)
 		case t := <-cleanupTick.C:
 			h.cleanupRuns.Inc()
 			h.cleanupOldReplicas(ctx, t.Add(-deletionTimeout))
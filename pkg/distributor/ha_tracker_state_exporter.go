@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/runutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// HATrackerStateFilename is the name of the object, under the Mimir internals prefix of the blocks storage,
+	// where the HA tracker elected replicas of all the tenants are exported.
+	HATrackerStateFilename = "ha-tracker-state.json"
+)
+
+// haTrackerStateObjectName is the full name of the object where the HA tracker state is exported.
+var haTrackerStateObjectName = path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)
+
+var errInvalidHATrackerStateExportInterval = errors.New("the HA tracker state export interval must be greater than 0")
+
+// HATrackerStateExportConfig configures the HATrackerStateExporter.
+type HATrackerStateExportConfig struct {
+	Enabled  bool          `yaml:"enabled" category:"experimental"`
+	Interval time.Duration `yaml:"interval" category:"experimental"`
+
+	// Injected internally.
+	Bucket bucket.Config `yaml:"-"`
+}
+
+func (cfg *HATrackerStateExportConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "distributor.ha-tracker.state-export.enabled", false, "When enabled, the elected replicas of all the tenants are periodically exported to the "+bucket.MimirInternalsPrefix+"/"+HATrackerStateFilename+" object in the blocks storage, and imported on startup, to avoid re-electing replicas during rolling restarts. The state is exported only by a single distributor, selected through the distributors ring, and only when the elected replicas changed.")
+	f.DurationVar(&cfg.Interval, "distributor.ha-tracker.state-export.interval", 30*time.Second, "How frequently the elected replicas are exported to the blocks storage.")
+}
+
+func (cfg *HATrackerStateExportConfig) Validate() error {
+	if cfg.Enabled && cfg.Interval <= 0 {
+		return errInvalidHATrackerStateExportInterval
+	}
+	return nil
+}
+
+// haTrackerState is the HA tracker state of all the tenants, as exported to the object storage.
+type haTrackerState struct {
+	// The elected replica of each cluster, by tenant and cluster name.
+	Tenants map[string]map[string]ReplicaDesc `json:"tenants"`
+}
+
+// HATrackerStateExporter exports the elected replicas of all the tenants to a single object in the object storage
+// and imports them back, so that a restarted distributor doesn't need to wait for the KV store, or re-elect replicas
+// if the KV store doesn't persist them. The state is only uploaded when the elected replicas change, or when the
+// exported receive timestamps are older than the refresh interval.
+type HATrackerStateExporter struct {
+	bucket          objstore.Bucket
+	refreshInterval time.Duration
+	logger          log.Logger
+
+	// Last state exported, so that unchanged state is not uploaded again.
+	exportedMtx sync.Mutex
+	exported    map[string]map[string]ReplicaDesc
+
+	failedExports       prometheus.Counter
+	lastExportTimestamp prometheus.Gauge
+}
+
+// NewHATrackerStateExporter makes a new HATrackerStateExporter storing the state under the Mimir internals prefix of
+// the input bucket. The state is uploaded again once per refreshInterval even if the elected replicas didn't change,
+// so that the exported receive timestamps don't get too old to be imported.
+func NewHATrackerStateExporter(bkt objstore.Bucket, refreshInterval time.Duration, logger log.Logger, reg prometheus.Registerer) *HATrackerStateExporter {
+	return &HATrackerStateExporter{
+		bucket:          bkt,
+		refreshInterval: refreshInterval,
+		logger:          logger,
+		failedExports: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ha_tracker_state_export_failed_total",
+			Help: "Total number of times the HA tracker state failed to be exported to the object storage.",
+		}),
+		lastExportTimestamp: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_ha_tracker_state_last_successful_export_timestamp_seconds",
+			Help: "Unix timestamp of the last successful export of the HA tracker state.",
+		}),
+	}
+}
+
+// Export writes the elected replicas of all the tenants, keyed by tenant and cluster, to the object storage,
+// replacing the previously exported state. The state is not uploaded if it didn't change since the last export.
+// The caller must ensure that a single distributor exports the state at a time.
+func (e *HATrackerStateExporter) Export(ctx context.Context, state map[string]map[string]ReplicaDesc) error {
+	e.exportedMtx.Lock()
+	defer e.exportedMtx.Unlock()
+
+	if e.exported != nil && !e.hasChanged(e.exported, state) {
+		return nil
+	}
+
+	data, err := json.Marshal(haTrackerState{Tenants: state})
+	if err != nil {
+		e.failedExports.Inc()
+		return errors.Wrap(err, "marshal HA tracker state")
+	}
+	if err := e.bucket.Upload(ctx, haTrackerStateObjectName, bytes.NewReader(data)); err != nil {
+		// The previously exported state is kept, so that the upload is retried on the next export.
+		e.failedExports.Inc()
+		return errors.Wrap(err, "upload HA tracker state")
+	}
+
+	e.exported = state
+	e.lastExportTimestamp.SetToCurrentTime()
+	return nil
+}
+
+// Import reads the elected replicas of all the tenants, keyed by tenant and cluster, from the object storage.
+// An empty state is returned if the state has never been exported.
+func (e *HATrackerStateExporter) Import(ctx context.Context) (map[string]map[string]ReplicaDesc, error) {
+	r, err := e.bucket.Get(ctx, haTrackerStateObjectName)
+	if e.bucket.IsObjNotFoundErr(err) {
+		return map[string]map[string]ReplicaDesc{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read HA tracker state")
+	}
+	defer runutil.CloseWithLogOnErr(e.logger, r, "close HA tracker state reader")
+
+	state := haTrackerState{}
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, errors.Wrap(err, "decode HA tracker state")
+	}
+	if state.Tenants == nil {
+		state.Tenants = map[string]map[string]ReplicaDesc{}
+	}
+
+	// The imported state is tracked, so that it's not uploaded again if it didn't change.
+	e.exportedMtx.Lock()
+	e.exported = state.Tenants
+	e.exportedMtx.Unlock()
+
+	return state.Tenants, nil
+}
+
+// hasChanged returns whether the elected replicas changed since they've been exported,
+// or the exported receive timestamps need to be refreshed.
+func (e *HATrackerStateExporter) hasChanged(exported, current map[string]map[string]ReplicaDesc) bool {
+	if len(exported) != len(current) {
+		return true
+	}
+
+	for userID, clusters := range current {
+		prevClusters, ok := exported[userID]
+		if !ok || len(prevClusters) != len(clusters) {
+			return true
+		}
+
+		for cluster, desc := range clusters {
+			prev, ok := prevClusters[cluster]
+			if !ok || prev.Replica != desc.Replica || prev.DeletedAt != desc.DeletedAt {
+				return true
+			}
+			if time.Duration(desc.ReceivedAt-prev.ReceivedAt)*time.Millisecond >= e.refreshInterval {
+				return true
+			}
+		}
+	}
+
+	return false
+}
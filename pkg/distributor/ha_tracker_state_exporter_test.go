@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
+)
+
+func TestHATrackerStateExporter_ExportAndImport(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	exporter := NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	// Nothing is imported if the state has never been exported.
+	imported, err := exporter.Import(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, imported)
+
+	state := map[string]map[string]ReplicaDesc{
+		"user-1": {
+			"cluster-1": {Replica: "replica-1", ReceivedAt: 1000},
+			"cluster-2": {Replica: "replica-2", ReceivedAt: 2000},
+		},
+		"user-2": {
+			"cluster-1": {Replica: "replica-3", ReceivedAt: 3000},
+		},
+	}
+	require.NoError(t, exporter.Export(ctx, state))
+
+	// The state of all the tenants is stored in a single object under the Mimir internals prefix.
+	var objects []string
+	require.NoError(t, bkt.Iter(ctx, "", func(name string) error {
+		objects = append(objects, name)
+		return nil
+	}, objstore.WithRecursiveIter))
+	assert.Equal(t, []string{path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)}, objects)
+
+	imported, err = NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry()).Import(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, state, imported)
+
+	// The state of the tenants no longer tracked is removed.
+	state = map[string]map[string]ReplicaDesc{
+		"user-1": state["user-1"],
+	}
+	require.NoError(t, exporter.Export(ctx, state))
+
+	imported, err = NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry()).Import(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, state, imported)
+}
+
+func TestHATrackerStateExporter_Export(t *testing.T) {
+	ctx := context.Background()
+
+	exists := func(t *testing.T, bkt objstore.Bucket) bool {
+		ok, err := bkt.Exists(ctx, path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename))
+		require.NoError(t, err)
+		return ok
+	}
+
+	t.Run("should upload the state only if it changed", func(t *testing.T) {
+		bkt := objstore.NewInMemBucket()
+		exporter := NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+		state := map[string]map[string]ReplicaDesc{"user-1": {"cluster-1": {Replica: "replica-1", ReceivedAt: 1000}}}
+		require.NoError(t, exporter.Export(ctx, state))
+		require.True(t, exists(t, bkt))
+
+		// The state is not uploaded again if the elected replica didn't change.
+		require.NoError(t, bkt.Delete(ctx, path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)))
+		state = map[string]map[string]ReplicaDesc{"user-1": {"cluster-1": ReplicaDesc{Replica: "replica-1", ReceivedAt: 2000}}}
+		require.NoError(t, exporter.Export(ctx, state))
+		require.False(t, exists(t, bkt))
+
+		// The state is uploaded again once the receive timestamp is older than the refresh interval.
+		state = map[string]map[string]ReplicaDesc{"user-1": {"cluster-1": ReplicaDesc{Replica: "replica-1", ReceivedAt: 1000 + time.Minute.Milliseconds()}}}
+		require.NoError(t, exporter.Export(ctx, state))
+		require.True(t, exists(t, bkt))
+
+		// The state is uploaded again if the elected replica changed.
+		require.NoError(t, bkt.Delete(ctx, path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)))
+		state = map[string]map[string]ReplicaDesc{"user-1": {"cluster-1": ReplicaDesc{Replica: "replica-2", ReceivedAt: 1000 + time.Minute.Milliseconds()}}}
+		require.NoError(t, exporter.Export(ctx, state))
+		require.True(t, exists(t, bkt))
+
+		// The state is uploaded again if a tenant is added.
+		require.NoError(t, bkt.Delete(ctx, path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)))
+		state = map[string]map[string]ReplicaDesc{
+			"user-1": state["user-1"],
+			"user-2": {"cluster-1": {Replica: "replica-1", ReceivedAt: 1000}},
+		}
+		require.NoError(t, exporter.Export(ctx, state))
+		require.True(t, exists(t, bkt))
+	})
+
+	t.Run("should not upload the imported state again if it didn't change", func(t *testing.T) {
+		bkt := objstore.NewInMemBucket()
+		state := map[string]map[string]ReplicaDesc{"user-1": {"cluster-1": {Replica: "replica-1", ReceivedAt: 1000}}}
+		require.NoError(t, NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry()).Export(ctx, state))
+
+		exporter := NewHATrackerStateExporter(bkt, time.Minute, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+		_, err := exporter.Import(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, bkt.Delete(ctx, path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename)))
+		require.NoError(t, exporter.Export(ctx, state))
+		require.False(t, exists(t, bkt))
+	})
+}
+
+func TestHATracker_ShouldImportTheExportedStateOnStartup(t *testing.T) {
+	bucketCfg := bucket.Config{StorageBackendConfig: bucket.StorageBackendConfig{
+		Backend:    bucket.Filesystem,
+		Filesystem: filesystem.Config{Directory: t.TempDir()},
+	}}
+
+	newTracker := func(t *testing.T) *haTracker {
+		// Each tracker uses its own KV store, like a KV store not persisting the state across restarts.
+		kvStore, closer := consul.NewInMemoryClient(GetReplicaDescCodec(), log.NewNopLogger(), nil)
+		t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+		tracker, err := newHATracker(HATrackerConfig{
+			EnableHATracker: true,
+			KVStore:         kv.Config{Mock: kvStore},
+			UpdateTimeout:   time.Second,
+			FailoverTimeout: time.Minute,
+			StateExport: HATrackerStateExportConfig{
+				Enabled:  true,
+				Interval: 10 * time.Millisecond,
+				Bucket:   bucketCfg,
+			},
+		}, trackerLimits{maxClusters: 100}, nil, log.NewNopLogger())
+		require.NoError(t, err)
+		return tracker
+	}
+
+	now := time.Now()
+
+	first := newTracker(t)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), first))
+	require.NoError(t, first.checkReplica(context.Background(), "user", "cluster", "replica-1", now))
+
+	bkt, err := bucket.NewClient(context.Background(), bucketCfg, "test", log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		exists, err := bkt.Exists(context.Background(), path.Join(bucket.MimirInternalsPrefix, HATrackerStateFilename))
+		return err == nil && exists
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), first))
+
+	// The restarted tracker keeps accepting the samples from the replica elected before the restart.
+	second := newTracker(t)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), second))
+	t.Cleanup(func() { assert.NoError(t, services.StopAndAwaitTerminated(context.Background(), second)) })
+
+	checkReplicaTimestamp(t, time.Second, second, "user", "cluster", "replica-1", timestamp.Time(timestamp.FromTime(now)))
+	assert.NoError(t, second.checkReplica(context.Background(), "user", "cluster", "replica-1", now))
+	assert.ErrorIs(t, second.checkReplica(context.Background(), "user", "cluster", "replica-2", now), replicasNotMatchError{})
+}
+
+func TestHATracker_ShouldNotImportStaleReplicas(t *testing.T) {
+	tracker, err := newHATracker(HATrackerConfig{
+		EnableHATracker: true,
+		KVStore:         kv.Config{Store: "inmemory"},
+		UpdateTimeout:   time.Second,
+		FailoverTimeout: time.Minute,
+	}, trackerLimits{maxClusters: 100}, nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	now := time.Now()
+	tracker.importState(map[string]map[string]ReplicaDesc{
+		"user": {
+			"recent":  {Replica: "replica-1", ReceivedAt: timestamp.FromTime(now.Add(-time.Second))},
+			"stale":   {Replica: "replica-1", ReceivedAt: timestamp.FromTime(now.Add(-2 * time.Minute))},
+			"deleted": {Replica: "replica-1", ReceivedAt: timestamp.FromTime(now), DeletedAt: timestamp.FromTime(now)},
+		},
+	}, now)
+
+	require.Len(t, tracker.clusters["user"], 1)
+	assert.Equal(t, "replica-1", tracker.clusters["user"]["recent"].elected.Replica)
+}
@@ -126,6 +126,17 @@ func TestHATrackerConfig_Validate(t *testing.T) {
 			}(),
 			expectedErr: errMemberlistUnsupported,
 		},
+		"should fail if the state export is enabled and the export interval is not positive": {
+			cfg: func() HATrackerConfig {
+				cfg := HATrackerConfig{}
+				flagext.DefaultValues(&cfg)
+				cfg.StateExport.Enabled = true
+				cfg.StateExport.Interval = 0
+
+				return cfg
+			}(),
+			expectedErr: errInvalidHATrackerStateExportInterval,
+		},
 	}
 
 	for testName, testData := range tests {
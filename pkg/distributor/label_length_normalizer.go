@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/push"
+)
+
+const (
+	// truncatedLabelValueSuffix is appended to truncated label values.
+	truncatedLabelValueSuffix = "_truncated"
+
+	// labelLengthNormalizerLogInterval is the min interval between two warnings logged by the LabelLengthNormalizer.
+	labelLengthNormalizerLogInterval = 10 * time.Second
+)
+
+// LabelLengthNormalizer truncates the label names and values longer than the configured max lengths.
+// Truncated label values end with the "_truncated" suffix, which is included in the max length.
+type LabelLengthNormalizer struct {
+	maxNameLength  int
+	maxValueLength int
+	logger         log.Logger
+
+	truncatedLabels *prometheus.CounterVec
+}
+
+// NewLabelLengthNormalizer makes a new LabelLengthNormalizer. A max length of 0 disables the truncation.
+func NewLabelLengthNormalizer(maxNameLength, maxValueLength int, reg prometheus.Registerer, logger log.Logger) *LabelLengthNormalizer {
+	return &LabelLengthNormalizer{
+		maxNameLength:  maxNameLength,
+		maxValueLength: maxValueLength,
+		logger:         util_log.NewRateLimitedLogger(labelLengthNormalizerLogInterval, logger, time.Now),
+		truncatedLabels: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_labels_truncated_total",
+			Help: "The total number of label names and values truncated because exceeding the max length.",
+		}, []string{"user"}),
+	}
+}
+
+// Normalize truncates the label names and values of the input series exceeding the max lengths, and
+// returns the number of truncated label names and values. The reserved label names, starting with "__",
+// are never truncated. If truncating the label names would make two of them equal, the names of the
+// series are kept as is, so that the series is not turned into an invalid one.
+func (n *LabelLengthNormalizer) Normalize(userID string, ts *mimirpb.TimeSeries) int {
+	truncated := n.truncateNames(userID, ts.Labels)
+
+	for i := range ts.Labels {
+		l := &ts.Labels[i]
+
+		if n.maxValueLength > 0 && len(l.Value) > n.maxValueLength {
+			l.Value = truncateUTF8(l.Value, n.maxValueLength-len(truncatedLabelValueSuffix)) + truncatedLabelValueSuffix
+			truncated++
+		}
+	}
+
+	if truncated > 0 {
+		n.truncatedLabels.WithLabelValues(userID).Add(float64(truncated))
+		level.Warn(n.logger).Log("msg", "truncated label names or values exceeding the max length", "user", userID, "series", mimirpb.FromLabelAdaptersToLabels(ts.Labels).String())
+	}
+
+	return truncated
+}
+
+// truncateNames truncates the label names exceeding the max length, unless it introduces duplicated
+// label names, and returns the number of truncated label names.
+func (n *LabelLengthNormalizer) truncateNames(userID string, labels []mimirpb.LabelAdapter) int {
+	if n.maxNameLength <= 0 {
+		return 0
+	}
+
+	var names []string
+	for i, l := range labels {
+		if len(l.Name) <= n.maxNameLength || strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+			continue
+		}
+		if names == nil {
+			names = make([]string, len(labels))
+			for j := range labels {
+				names[j] = labels[j].Name
+			}
+		}
+		names[i] = truncateUTF8(l.Name, n.maxNameLength)
+	}
+	if names == nil {
+		return 0
+	}
+
+	// The labels are sorted by name, and truncating preserves the order, so duplicated names are adjacent.
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			level.Warn(n.logger).Log("msg", "label names exceeding the max length have not been truncated because it would introduce duplicated label names", "user", userID, "label", names[i], "series", mimirpb.FromLabelAdaptersToLabels(labels).String())
+			return 0
+		}
+	}
+
+	truncated := 0
+	for i := range labels {
+		if labels[i].Name != names[i] {
+			labels[i].Name = names[i]
+			truncated++
+		}
+	}
+	return truncated
+}
+
+func (n *LabelLengthNormalizer) deleteMetricsForUser(userID string) {
+	n.truncatedLabels.DeleteLabelValues(userID)
+}
+
+// truncateUTF8 truncates the input string to the max length in bytes, without splitting multi-byte characters.
+func truncateUTF8(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	for maxLength > 0 && !utf8.RuneStart(s[maxLength]) {
+		maxLength--
+	}
+	return s[:maxLength]
+}
+
+// prePushLabelLengthNormalizerMiddleware is used as push.Func middleware in front of PushWithCleanup method.
+// It truncates the label names and values exceeding the max lengths, if configured.
+func (d *Distributor) prePushLabelLengthNormalizerMiddleware(next push.Func) push.Func {
+	if d.labelLengthNormalizer == nil {
+		// Truncation is disabled, no need to wrap "next".
+		return next
+	}
+
+	return func(ctx context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		for _, ts := range req.Timeseries {
+			d.labelLengthNormalizer.Normalize(userID, ts.TimeSeries)
+		}
+
+		return next(ctx, req, cleanup)
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestLabelLengthNormalizer_Normalize(t *testing.T) {
+	tests := map[string]struct {
+		maxNameLength     int
+		maxValueLength    int
+		input             []mimirpb.LabelAdapter
+		expected          []mimirpb.LabelAdapter
+		expectedTruncated int
+	}{
+		"should not truncate labels within the max lengths": {
+			maxNameLength:  8,
+			maxValueLength: 16,
+			input:          []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "pod", Value: "0123456789abcdef"}},
+			expected:       []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "pod", Value: "0123456789abcdef"}},
+		},
+		"should truncate label names and values exceeding the max lengths": {
+			maxNameLength:     8,
+			maxValueLength:    16,
+			input:             []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "stacktrace", Value: "0123456789abcdefg"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "stacktra", Value: "012345_truncated"}},
+			expectedTruncated: 2,
+		},
+		"should not truncate label names if the max name length is disabled": {
+			maxValueLength:    16,
+			input:             []mimirpb.LabelAdapter{{Name: "stacktrace", Value: "0123456789abcdefg"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "stacktrace", Value: "012345_truncated"}},
+			expectedTruncated: 1,
+		},
+		"should not truncate label values if the max value length is disabled": {
+			maxNameLength:     8,
+			input:             []mimirpb.LabelAdapter{{Name: "stacktrace", Value: "0123456789abcdefg"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "stacktra", Value: "0123456789abcdefg"}},
+			expectedTruncated: 1,
+		},
+		"should not truncate reserved label names": {
+			maxNameLength:     4,
+			input:             []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "stacktrace", Value: "value"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "stac", Value: "value"}},
+			expectedTruncated: 1,
+		},
+		"should not truncate label names if it introduces duplicated label names": {
+			maxNameLength:     4,
+			maxValueLength:    16,
+			input:             []mimirpb.LabelAdapter{{Name: "pod", Value: "0123456789abcdefg"}, {Name: "stack_a", Value: "1"}, {Name: "stack_b", Value: "2"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "pod", Value: "012345_truncated"}, {Name: "stack_a", Value: "1"}, {Name: "stack_b", Value: "2"}},
+			expectedTruncated: 1,
+		},
+		"should not truncate label names if it collides with an existing label name": {
+			maxNameLength: 4,
+			input:         []mimirpb.LabelAdapter{{Name: "stac", Value: "1"}, {Name: "stack", Value: "2"}},
+			expected:      []mimirpb.LabelAdapter{{Name: "stac", Value: "1"}, {Name: "stack", Value: "2"}},
+		},
+		"should not split multi-byte characters": {
+			maxValueLength:    13,
+			input:             []mimirpb.LabelAdapter{{Name: "name", Value: "aa€€€€"}},
+			expected:          []mimirpb.LabelAdapter{{Name: "name", Value: "aa_truncated"}},
+			expectedTruncated: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			n := NewLabelLengthNormalizer(testData.maxNameLength, testData.maxValueLength, reg, log.NewNopLogger())
+
+			ts := &mimirpb.TimeSeries{Labels: testData.input}
+			assert.Equal(t, testData.expectedTruncated, n.Normalize("user-1", ts))
+			assert.Equal(t, testData.expected, ts.Labels)
+
+			if testData.expectedTruncated > 0 {
+				assert.Equal(t, float64(testData.expectedTruncated), testutil.ToFloat64(n.truncatedLabels.WithLabelValues("user-1")))
+			}
+		})
+	}
+}
+
+func TestDistributor_prePushLabelLengthNormalizerMiddleware(t *testing.T) {
+	d := &Distributor{
+		labelLengthNormalizer: NewLabelLengthNormalizer(4, 16, nil, log.NewNopLogger()),
+	}
+
+	var nextReq *mimirpb.WriteRequest
+	next := func(_ context.Context, req *mimirpb.WriteRequest, _ func()) (*mimirpb.WriteResponse, error) {
+		nextReq = req
+		return &mimirpb.WriteResponse{}, nil
+	}
+
+	req := &mimirpb.WriteRequest{Timeseries: []mimirpb.PreallocTimeseries{
+		makeWriteRequestTimeseries([]mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "a_aaaa", Value: "2"}, {Name: "a_z", Value: "0123456789abcdefg"}}, 1000, 1),
+	}}
+
+	_, err := d.prePushLabelLengthNormalizerMiddleware(next)(user.InjectOrgID(context.Background(), "user-1"), req, func() {})
+	require.NoError(t, err)
+	require.Len(t, nextReq.Timeseries, 1)
+	assert.Equal(t, []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "a_aa", Value: "2"}, {Name: "a_z", Value: "012345_truncated"}}, nextReq.Timeseries[0].Labels)
+}
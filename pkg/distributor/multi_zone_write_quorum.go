@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/dskit/ring"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/status"
+)
+
+// maxWriteQuorumZones is the max number of distinct zones tracked for each item by the multi-zone write quorum.
+const maxWriteQuorumZones = 64
+
+// zoneQuorumItemTracker tracks the outcome of writing a single item (series or metadata) to its replicas.
+type zoneQuorumItemTracker struct {
+	minSuccess  int
+	maxFailures int
+	succeeded   atomic.Int32
+	failed4xx   atomic.Int32
+	failed5xx   atomic.Int32
+	remaining   atomic.Int32
+	completed   atomic.Bool
+	err         atomic.Error
+
+	// zonesMask has a bit set for each zone which the item has been replicated to.
+	zonesMask uint64
+	// zonesSucceeded has a bit set for each zone where at least one replica succeeded.
+	zonesSucceeded atomic.Uint64
+	// zonesRemaining is the number of replicas still pending, per zone.
+	zonesRemaining []atomic.Int32
+}
+
+func (i *zoneQuorumItemTracker) recordError(err error) int32 {
+	i.err.Store(err)
+
+	if s, ok := status.FromError(err); ok && s.Code()/100 == 4 {
+		return i.failed4xx.Inc()
+	}
+
+	return i.failed5xx.Inc()
+}
+
+// recordZoneSuccess marks the input zone as succeeded.
+func (i *zoneQuorumItemTracker) recordZoneSuccess(zone int) {
+	for {
+		prev := i.zonesSucceeded.Load()
+		next := prev | 1<<zone
+		if prev == next || i.zonesSucceeded.CAS(prev, next) {
+			return
+		}
+	}
+}
+
+type zoneQuorumInstance struct {
+	desc         ring.InstanceDesc
+	itemTrackers []*zoneQuorumItemTracker
+	// zones is the index of the instance zone in each item tracker.
+	zones   []int
+	indexes []int
+}
+
+type zoneQuorumBatchTracker struct {
+	rpcsPending atomic.Int32
+	rpcsFailed  atomic.Int32
+	done        chan struct{}
+	err         chan error
+}
+
+// doBatchWithMultiZoneWriteQuorum is like ring.DoBatch(), but an item is successfully written only once, in
+// addition to the quorum, at least one replica in each zone the item is replicated to has succeeded. The write
+// fails as soon as all the replicas in a zone have failed. This guarantees that each successfully written item
+// survives the loss of a whole zone, at the cost of failing writes while any zone is unable to ingest.
+//
+// Instances without a zone are not subject to the per-zone requirement, so this behaves like ring.DoBatch()
+// when the ring is not zone-aware.
+func doBatchWithMultiZoneWriteQuorum(ctx context.Context, op ring.Operation, r ring.ReadRing, keys []uint32, callback func(ring.InstanceDesc, []int) error, cleanup func()) error {
+	if r.InstancesCount() <= 0 {
+		cleanup()
+		return fmt.Errorf("DoBatch: InstancesCount <= 0")
+	}
+	expectedTrackers := len(keys) * (r.ReplicationFactor() + 1) / r.InstancesCount()
+	itemTrackers := make([]zoneQuorumItemTracker, len(keys))
+	instances := make(map[string]zoneQuorumInstance, r.InstancesCount())
+
+	var (
+		bufDescs [ring.GetBufferSize]ring.InstanceDesc
+		bufHosts [ring.GetBufferSize]string
+		bufZones [ring.GetBufferSize]string
+	)
+	for i, key := range keys {
+		replicationSet, err := r.Get(key, op, bufDescs[:0], bufHosts[:0], bufZones[:0])
+		if err != nil {
+			cleanup()
+			return err
+		}
+
+		tracker := &itemTrackers[i]
+		tracker.minSuccess = len(replicationSet.Instances) - replicationSet.MaxErrors
+		tracker.maxFailures = replicationSet.MaxErrors
+		tracker.remaining.Store(int32(len(replicationSet.Instances)))
+
+		var zones []string
+		instanceZones := make([]int, len(replicationSet.Instances))
+		for idx, desc := range replicationSet.Instances {
+			instanceZones[idx] = -1
+			if desc.Zone == "" {
+				continue
+			}
+
+			zone := indexOf(zones, desc.Zone)
+			if zone < 0 {
+				if len(zones) == maxWriteQuorumZones {
+					cleanup()
+					return fmt.Errorf("DoBatch: the number of zones exceeds the max supported by the multi-zone write quorum (%d)", maxWriteQuorumZones)
+				}
+				zone = len(zones)
+				zones = append(zones, desc.Zone)
+			}
+			instanceZones[idx] = zone
+		}
+
+		tracker.zonesRemaining = make([]atomic.Int32, len(zones))
+		for idx, desc := range replicationSet.Instances {
+			if zone := instanceZones[idx]; zone >= 0 {
+				tracker.zonesMask |= 1 << zone
+				tracker.zonesRemaining[zone].Inc()
+			}
+
+			curr, found := instances[desc.Addr]
+			if !found {
+				curr.itemTrackers = make([]*zoneQuorumItemTracker, 0, expectedTrackers)
+				curr.zones = make([]int, 0, expectedTrackers)
+				curr.indexes = make([]int, 0, expectedTrackers)
+			}
+			instances[desc.Addr] = zoneQuorumInstance{
+				desc:         desc,
+				itemTrackers: append(curr.itemTrackers, tracker),
+				zones:        append(curr.zones, instanceZones[idx]),
+				indexes:      append(curr.indexes, i),
+			}
+		}
+	}
+
+	tracker := zoneQuorumBatchTracker{
+		done: make(chan struct{}, 1),
+		err:  make(chan error, 1),
+	}
+	tracker.rpcsPending.Store(int32(len(itemTrackers)))
+
+	var wg sync.WaitGroup
+
+	wg.Add(len(instances))
+	for _, i := range instances {
+		go func(i zoneQuorumInstance) {
+			err := callback(i.desc, i.indexes)
+			tracker.record(i, err)
+			wg.Done()
+		}(i)
+	}
+
+	// Perform cleanup at the end.
+	go func() {
+		wg.Wait()
+
+		cleanup()
+	}()
+
+	select {
+	case err := <-tracker.err:
+		return err
+	case <-tracker.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *zoneQuorumBatchTracker) record(instance zoneQuorumInstance, err error) {
+	// The remaining number of instances to try is decremented last, so that the last instance recording
+	// the outcome of an item observes the outcome recorded by all the other instances.
+	for idx, item := range instance.itemTrackers {
+		zone := instance.zones[idx]
+
+		if err != nil {
+			errCount := item.recordError(err)
+			zoneFailed := zone >= 0 && item.zonesRemaining[zone].Dec() == 0 && item.zonesSucceeded.Load()&(1<<zone) == 0
+			remaining := item.remaining.Dec()
+
+			// Fail if the quorum can't be reached anymore, all replicas in a zone have failed, or there
+			// are no remaining instances to try.
+			if !item.completed.Load() && (errCount > int32(item.maxFailures) || zoneFailed || remaining == 0) {
+				b.fail(err)
+			}
+			continue
+		}
+
+		item.succeeded.Inc()
+		if zone >= 0 {
+			item.recordZoneSuccess(zone)
+			item.zonesRemaining[zone].Dec()
+		}
+
+		// The item is done once both the quorum and the per-zone requirements are honored.
+		if item.succeeded.Load() >= int32(item.minSuccess) && item.zonesSucceeded.Load() == item.zonesMask {
+			if item.completed.CAS(false, true) && b.rpcsPending.Dec() == 0 {
+				b.done <- struct{}{}
+			}
+		}
+
+		// If we successfully called this particular instance, but we don't have any remaining instances
+		// to try, and the item is not done, then we need to return the last error.
+		if item.remaining.Dec() == 0 && !item.completed.Load() {
+			b.fail(item.err.Load())
+		}
+	}
+}
+
+// fail reports the input error, unless an error has already been reported.
+func (b *zoneQuorumBatchTracker) fail(err error) {
+	if b.rpcsFailed.Inc() == 1 {
+		b.err <- err
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for idx, v := range values {
+		if v == value {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/grafana/dskit/ring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"go.uber.org/atomic"
+)
+
+// staticReplicationSetRing is a ring.ReadRing returning the same replication set for any key.
+type staticReplicationSetRing struct {
+	ring.ReadRing
+
+	set ring.ReplicationSet
+}
+
+func (r staticReplicationSetRing) Get(_ uint32, _ ring.Operation, _ []ring.InstanceDesc, _, _ []string) (ring.ReplicationSet, error) {
+	return r.set, nil
+}
+
+func (r staticReplicationSetRing) InstancesCount() int {
+	return len(r.set.Instances)
+}
+
+func (r staticReplicationSetRing) ReplicationFactor() int {
+	return len(r.set.Instances)
+}
+
+func TestDoBatchWithMultiZoneWriteQuorum(t *testing.T) {
+	errFailure := errors.New("ingester failure")
+	errClientFailure := httpgrpc.Errorf(http.StatusBadRequest, "invalid series")
+
+	instance := func(addr, zone string) ring.InstanceDesc {
+		return ring.InstanceDesc{Addr: addr, Zone: zone}
+	}
+
+	tests := map[string]struct {
+		instances   []ring.InstanceDesc
+		maxErrors   int
+		failures    map[string]error
+		expectedErr error
+	}{
+		"should succeed if all ingesters succeed": {
+			instances: []ring.InstanceDesc{instance("a-1", "a"), instance("b-1", "b"), instance("c-1", "c")},
+			maxErrors: 1,
+		},
+		"should fail if the only ingester in a zone fails, even if the quorum is reached": {
+			instances:   []ring.InstanceDesc{instance("a-1", "a"), instance("b-1", "b"), instance("c-1", "c")},
+			maxErrors:   1,
+			failures:    map[string]error{"b-1": errFailure},
+			expectedErr: errFailure,
+		},
+		"should succeed if an ingester fails but another one in the same zone succeeds": {
+			instances: []ring.InstanceDesc{instance("a-1", "a"), instance("a-2", "a"), instance("b-1", "b"), instance("c-1", "c")},
+			maxErrors: 1,
+			failures:  map[string]error{"a-1": errFailure},
+		},
+		"should fail if the quorum is not reached": {
+			instances:   []ring.InstanceDesc{instance("a-1", "a"), instance("a-2", "a"), instance("b-1", "b"), instance("c-1", "c")},
+			maxErrors:   1,
+			failures:    map[string]error{"a-1": errFailure, "a-2": errFailure},
+			expectedErr: errFailure,
+		},
+		"should return the client error if the only ingester in a zone rejects the write": {
+			instances:   []ring.InstanceDesc{instance("a-1", "a"), instance("b-1", "b"), instance("c-1", "c")},
+			maxErrors:   1,
+			failures:    map[string]error{"c-1": errClientFailure},
+			expectedErr: errClientFailure,
+		},
+		"should honor only the quorum if the ring is not zone-aware": {
+			instances: []ring.InstanceDesc{instance("1", ""), instance("2", ""), instance("3", "")},
+			maxErrors: 1,
+			failures:  map[string]error{"2": errFailure},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			r := staticReplicationSetRing{set: ring.ReplicationSet{Instances: testData.instances, MaxErrors: testData.maxErrors}}
+			keys := []uint32{1, 2, 3}
+
+			cleanupCalls := atomic.NewInt32(0)
+			cleanupDone := make(chan struct{})
+
+			err := doBatchWithMultiZoneWriteQuorum(context.Background(), ring.WriteNoExtend, r, keys, func(desc ring.InstanceDesc, indexes []int) error {
+				assert.Equal(t, []int{0, 1, 2}, indexes)
+				return testData.failures[desc.Addr]
+			}, func() {
+				if cleanupCalls.Inc() == 1 {
+					close(cleanupDone)
+				}
+			})
+
+			if testData.expectedErr != nil {
+				require.Equal(t, testData.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			<-cleanupDone
+			assert.Equal(t, int32(1), cleanupCalls.Load())
+		})
+	}
+}
+
+func TestDoBatchWithMultiZoneWriteQuorum_ShouldFailOnEmptyRing(t *testing.T) {
+	cleanupCalled := false
+	err := doBatchWithMultiZoneWriteQuorum(context.Background(), ring.WriteNoExtend, staticReplicationSetRing{}, []uint32{1}, func(ring.InstanceDesc, []int) error {
+		return nil
+	}, func() { cleanupCalled = true })
+
+	require.Error(t, err)
+	assert.True(t, cleanupCalled)
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/push"
+)
+
+// pushRequestRecord is the record written by the PushRequestLogger for each push request.
+type pushRequestRecord struct {
+	Timestamp time.Time                 `json:"timestamp"`
+	TenantID  string                    `json:"tenant_id"`
+	Source    string                    `json:"source"`
+	Series    []pushRequestSeriesRecord `json:"series"`
+	Metadata  int                       `json:"metadata,omitempty"`
+}
+
+type pushRequestSeriesRecord struct {
+	Labels     string  `json:"labels"`
+	Samples    int     `json:"samples"`
+	Timestamps []int64 `json:"timestamps,omitempty"`
+	Exemplars  int     `json:"exemplars,omitempty"`
+}
+
+// pushRequestLoggerLimits is the subset of the limits used by the PushRequestLogger.
+type pushRequestLoggerLimits interface {
+	PushRequestsDebugLogUntil(userID string) time.Time
+}
+
+// PushRequestLogger writes a record of each push request received for the tenants with debug logging
+// enabled in the runtime config overrides, with the labels, the number of samples and the sample timestamps
+// of each series, as JSON lines to a file. It's meant to investigate data loss or duplication for a tenant,
+// so it stops logging the tenant requests once the configured end time is reached. The end time is absolute,
+// so that all the distributors log the same time window, and a restart doesn't extend it.
+type PushRequestLogger struct {
+	path   string
+	limits pushRequestLoggerLimits
+	logger log.Logger
+
+	// The mutex is only taken to write the records of the tenants with debug logging enabled.
+	mtx    sync.Mutex
+	file   io.WriteCloser // Opened on the first record.
+	closed bool
+}
+
+// NewPushRequestLogger makes a new PushRequestLogger appending the push requests of the tenants
+// with debug logging enabled to the file at the input path.
+func NewPushRequestLogger(path string, limits pushRequestLoggerLimits, logger log.Logger) *PushRequestLogger {
+	return &PushRequestLogger{
+		path:   path,
+		limits: limits,
+		logger: logger,
+	}
+}
+
+// Log writes a record of the input push request to the file, if debug logging is enabled for the tenant
+// and its end time has not been reached yet.
+func (l *PushRequestLogger) Log(userID string, req *mimirpb.WriteRequest, now time.Time) {
+	if !now.Before(l.limits.PushRequestsDebugLogUntil(userID)) {
+		return
+	}
+
+	record := pushRequestRecord{
+		Timestamp: now,
+		TenantID:  userID,
+		Source:    req.Source.String(),
+		Series:    make([]pushRequestSeriesRecord, 0, len(req.Timeseries)),
+		Metadata:  len(req.Metadata),
+	}
+	for _, ts := range req.Timeseries {
+		series := pushRequestSeriesRecord{
+			Labels:    mimirpb.FromLabelAdaptersToLabels(ts.Labels).String(),
+			Samples:   len(ts.Samples),
+			Exemplars: len(ts.Exemplars),
+		}
+		for _, s := range ts.Samples {
+			series.Timestamps = append(series.Timestamps, s.TimestampMs)
+		}
+		record.Series = append(record.Series, series)
+	}
+
+	buf := bytes.Buffer{}
+	if err := json.NewEncoder(&buf).Encode(record); err != nil {
+		level.Warn(l.logger).Log("msg", "failed to marshal push request debug log record", "user", userID, "err", err)
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.closed {
+		return
+	}
+	if l.file == nil {
+		f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			level.Warn(l.logger).Log("msg", "failed to open push requests debug log file", "file", l.path, "err", err)
+			return
+		}
+		l.file = f
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		level.Warn(l.logger).Log("msg", "failed to write push request debug log record", "user", userID, "err", err)
+	}
+}
+
+// Close stops logging and closes the file.
+func (l *PushRequestLogger) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (d *Distributor) prePushDebugLogMiddleware(next push.Func) push.Func {
+	if d.pushRequestLogger == nil {
+		// Debug logging is disabled, no need to wrap "next".
+		return next
+	}
+
+	return func(ctx context.Context, req *mimirpb.WriteRequest, cleanup func()) (*mimirpb.WriteResponse, error) {
+		// The request is logged as is, before the tenant ID is validated.
+		if userID, err := user.ExtractOrgID(ctx); err == nil {
+			d.pushRequestLogger.Log(userID, req, time.Now())
+		}
+
+		return next(ctx, req, cleanup)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestPushRequestLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-requests.log")
+	now := time.Unix(1000, 0).UTC()
+
+	limits := &mockPushRequestLoggerLimits{until: map[string]time.Time{"user-1": now.Add(time.Hour)}}
+	l := NewPushRequestLogger(path, limits, log.NewNopLogger())
+
+	req := &mimirpb.WriteRequest{
+		Source: mimirpb.API,
+		Timeseries: []mimirpb.PreallocTimeseries{{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "up"}, {Name: "job", Value: "test"}},
+			Samples: []mimirpb.Sample{{TimestampMs: 10, Value: 1}, {TimestampMs: 20, Value: 1}},
+		}}},
+		Metadata: []*mimirpb.MetricMetadata{{MetricFamilyName: "up"}},
+	}
+
+	l.Log("user-1", req, now)
+	l.Log("user-2", req, now)
+	require.NoError(t, l.Close())
+
+	// Requests received once the logger is closed are not logged.
+	l.Log("user-1", req, now)
+
+	records := readPushRequestRecords(t, path)
+	require.Equal(t, []pushRequestRecord{{
+		Timestamp: now,
+		TenantID:  "user-1",
+		Source:    "API",
+		Series:    []pushRequestSeriesRecord{{Labels: `{__name__="up", job="test"}`, Samples: 2, Timestamps: []int64{10, 20}}},
+		Metadata:  1,
+	}}, records)
+
+	// Closing the logger twice is a no-op.
+	require.NoError(t, l.Close())
+}
+
+func TestPushRequestLogger_ShouldStopLoggingAtTheEndTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-requests.log")
+	start := time.Unix(1000, 0).UTC()
+
+	limits := &mockPushRequestLoggerLimits{until: map[string]time.Time{}}
+	l := NewPushRequestLogger(path, limits, log.NewNopLogger())
+	t.Cleanup(func() { _ = l.Close() })
+
+	// Debug logging is disabled by default, so the file is not even created.
+	l.Log("user-1", &mimirpb.WriteRequest{}, start)
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// The requests are logged until the end time, regardless of when it was set.
+	limits.until["user-1"] = start.Add(time.Minute)
+	l.Log("user-1", &mimirpb.WriteRequest{}, start)
+	l.Log("user-1", &mimirpb.WriteRequest{}, start.Add(30*time.Second))
+	l.Log("user-1", &mimirpb.WriteRequest{}, start.Add(time.Minute))
+	assert.Len(t, readPushRequestRecords(t, path), 2)
+
+	// Moving the end time forward enables debug logging again.
+	limits.until["user-1"] = start.Add(time.Hour)
+	l.Log("user-1", &mimirpb.WriteRequest{}, start.Add(2*time.Minute))
+	assert.Len(t, readPushRequestRecords(t, path), 3)
+
+	// An end time in the past disables debug logging.
+	limits.until["user-1"] = start
+	l.Log("user-1", &mimirpb.WriteRequest{}, start.Add(3*time.Minute))
+	assert.Len(t, readPushRequestRecords(t, path), 3)
+}
+
+type mockPushRequestLoggerLimits struct {
+	until map[string]time.Time
+}
+
+func (m *mockPushRequestLoggerLimits) PushRequestsDebugLogUntil(userID string) time.Time {
+	return m.until[userID]
+}
+
+func readPushRequestRecords(t *testing.T, path string) []pushRequestRecord {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	var records []pushRequestRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := pushRequestRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// Names of the limits reported in throttle events.
+	throttleLimitRequestRate   = "request_rate"
+	throttleLimitIngestionRate = "ingestion_rate"
+
+	// throttleEventsQueueSize is the max number of throttle events buffered before being written to the sink.
+	// Events reported while the queue is full are dropped.
+	throttleEventsQueueSize = 1024
+
+	// throttleEventsMaxBatchSize is the max number of throttle events written to the sink at once.
+	throttleEventsMaxBatchSize = 100
+
+	// throttleRateWindow is the sliding window over which the rate requested by a tenant is observed.
+	throttleRateWindow = 10 * time.Second
+)
+
+var errInvalidThrottleEventsSink = errors.New("invalid throttle events sink, the value must be an http, https or file URL")
+
+// ThrottleEvent is a structured event describing a tenant being throttled.
+type ThrottleEvent struct {
+	TenantID   string  `json:"tenant_id"`
+	LimitName  string  `json:"limit_name"`
+	LimitValue float64 `json:"limit_value"`
+	// CurrentValue is the per-second rate requested by the tenant, including the rejected requests, observed
+	// over the last 10 seconds: requests per second for the request rate limit, and samples, exemplars and
+	// metadata per second for the ingestion rate limit. It's comparable with LimitValue.
+	CurrentValue float64   `json:"current_value"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// ThrottleEventSink is the destination where throttle events are written to.
+type ThrottleEventSink interface {
+	// Write writes the input events to the sink.
+	Write(ctx context.Context, events []ThrottleEvent) error
+
+	// Close releases the resources held by the sink.
+	Close() error
+}
+
+// NewThrottleEventSink makes a new ThrottleEventSink from the input URL. Events are sent as a JSON
+// array in the body of a POST request for http and https URLs, and appended as JSON lines to the file
+// at the URL path for file URLs.
+func NewThrottleEventSink(rawURL string, timeout time.Duration) (ThrottleEventSink, error) {
+	if err := validateThrottleEventsSink(rawURL); err != nil {
+		return nil, err
+	}
+
+	u, _ := url.Parse(rawURL)
+	if u.Scheme == "file" {
+		f, err := os.OpenFile(u.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open throttle events file")
+		}
+		return &fileThrottleEventSink{file: f}, nil
+	}
+
+	return &httpThrottleEventSink{endpoint: rawURL, timeout: timeout}, nil
+}
+
+// validateThrottleEventsSink returns an error if the input URL is not a supported throttle events sink.
+func validateThrottleEventsSink(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errInvalidThrottleEventsSink
+	}
+
+	if ((u.Scheme == "http" || u.Scheme == "https") && u.Host != "") || (u.Scheme == "file" && u.Path != "") {
+		return nil
+	}
+	return errInvalidThrottleEventsSink
+}
+
+type httpThrottleEventSink struct {
+	endpoint string
+	timeout  time.Duration
+	client   http.Client
+}
+
+func (s *httpThrottleEventSink) Write(ctx context.Context, events []ThrottleEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal throttle events")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create HTTP request to the throttle events sink")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "failed to send HTTP request to the throttle events sink")
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+		_ = httpResp.Body.Close()
+	}()
+
+	if httpResp.StatusCode/100 != 2 {
+		scanner := bufio.NewScanner(io.LimitReader(httpResp.Body, 1024))
+		line := ""
+		if scanner.Scan() {
+			line = scanner.Text()
+		}
+		return errors.Errorf("throttle events sink returned HTTP status %d: %s", httpResp.StatusCode, line)
+	}
+
+	return nil
+}
+
+func (s *httpThrottleEventSink) Close() error {
+	return nil
+}
+
+type fileThrottleEventSink struct {
+	file *os.File
+}
+
+func (s *fileThrottleEventSink) Write(_ context.Context, events []ThrottleEvent) error {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return errors.Wrap(err, "failed to marshal throttle event")
+		}
+	}
+
+	_, err := s.file.Write(buf.Bytes())
+	return errors.Wrap(err, "failed to write throttle events")
+}
+
+func (s *fileThrottleEventSink) Close() error {
+	return s.file.Close()
+}
+
+// TenantThrottleReporter writes an event to a ThrottleEventSink each time a tenant is throttled, so that
+// throttling can be alerted on per-tenant without polling Prometheus. Events are buffered and written
+// asynchronously, so that reporting never slows down the write path: events reported while the buffer
+// is full are dropped.
+type TenantThrottleReporter struct {
+	services.Service
+
+	sink   ThrottleEventSink
+	logger log.Logger
+	events chan ThrottleEvent
+
+	ratesMx sync.Mutex
+	rates   map[throttleRateKey]*observedRate
+
+	writtenEvents prometheus.Counter
+	droppedEvents prometheus.Counter
+}
+
+// NewTenantThrottleReporter makes a new TenantThrottleReporter writing events to the input sink.
+func NewTenantThrottleReporter(sink ThrottleEventSink, reg prometheus.Registerer, logger log.Logger) *TenantThrottleReporter {
+	r := &TenantThrottleReporter{
+		sink:   sink,
+		logger: logger,
+		events: make(chan ThrottleEvent, throttleEventsQueueSize),
+		rates:  map[throttleRateKey]*observedRate{},
+		writtenEvents: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_distributor_throttle_events_written_total",
+			Help: "The total number of tenant throttle events written to the throttle events sink.",
+		}),
+		droppedEvents: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_distributor_throttle_events_dropped_total",
+			Help: "The total number of tenant throttle events dropped because the buffer was full or writing to the throttle events sink failed.",
+		}),
+	}
+
+	r.Service = services.NewBasicService(nil, r.running, r.stopping)
+	return r
+}
+
+// Observe records the amount requested by a tenant for the input limit, whether the request is then
+// throttled or not, so that the events report the rate requested by the tenant.
+func (r *TenantThrottleReporter) Observe(userID, limitName string, n float64, now time.Time) {
+	key := throttleRateKey{userID: userID, limitName: limitName}
+
+	r.ratesMx.Lock()
+	defer r.ratesMx.Unlock()
+
+	rate, ok := r.rates[key]
+	if !ok {
+		rate = &observedRate{windowStart: now}
+		r.rates[key] = rate
+	}
+	rate.add(n, now)
+}
+
+// Report enqueues a throttle event for the input tenant and limit. It never blocks.
+func (r *TenantThrottleReporter) Report(userID, limitName string, limitValue float64, now time.Time) {
+	var currentValue float64
+
+	r.ratesMx.Lock()
+	if rate, ok := r.rates[throttleRateKey{userID: userID, limitName: limitName}]; ok {
+		currentValue = rate.perSecond(now)
+	}
+	r.ratesMx.Unlock()
+
+	event := ThrottleEvent{
+		TenantID:     userID,
+		LimitName:    limitName,
+		LimitValue:   limitValue,
+		CurrentValue: currentValue,
+		Timestamp:    now,
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.droppedEvents.Inc()
+	}
+}
+
+func (r *TenantThrottleReporter) running(ctx context.Context) error {
+	cleanupTicker := time.NewTicker(time.Minute)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-r.events:
+			r.write(ctx, r.collectBatch(event))
+		case now := <-cleanupTicker.C:
+			r.cleanupRates(now)
+		}
+	}
+}
+
+// cleanupRates removes the rates of the tenants which haven't sent any request within the last window.
+func (r *TenantThrottleReporter) cleanupRates(now time.Time) {
+	r.ratesMx.Lock()
+	defer r.ratesMx.Unlock()
+
+	for key, rate := range r.rates {
+		if now.Sub(rate.windowStart) >= 2*throttleRateWindow {
+			delete(r.rates, key)
+		}
+	}
+}
+
+func (r *TenantThrottleReporter) stopping(_ error) error {
+	// Write the events still buffered before closing the sink.
+	for {
+		select {
+		case event := <-r.events:
+			r.write(context.Background(), r.collectBatch(event))
+		default:
+			return r.sink.Close()
+		}
+	}
+}
+
+// collectBatch returns a batch made of the input event and the events already buffered, up to the max batch size.
+func (r *TenantThrottleReporter) collectBatch(first ThrottleEvent) []ThrottleEvent {
+	batch := []ThrottleEvent{first}
+	for len(batch) < throttleEventsMaxBatchSize {
+		select {
+		case event := <-r.events:
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (r *TenantThrottleReporter) write(ctx context.Context, batch []ThrottleEvent) {
+	if err := r.sink.Write(ctx, batch); err != nil {
+		r.droppedEvents.Add(float64(len(batch)))
+		level.Warn(r.logger).Log("msg", "failed to write tenant throttle events", "events", len(batch), "err", err)
+		return
+	}
+
+	r.writtenEvents.Add(float64(len(batch)))
+}
+
+type throttleRateKey struct {
+	userID    string
+	limitName string
+}
+
+// observedRate approximates the per-second rate of the amounts added over a sliding window, weighting the
+// total of the previous fixed window by its overlap with the sliding one.
+type observedRate struct {
+	windowStart time.Time
+	current     float64
+	previous    float64
+}
+
+func (o *observedRate) add(n float64, now time.Time) {
+	o.advance(now)
+	o.current += n
+}
+
+func (o *observedRate) perSecond(now time.Time) float64 {
+	o.advance(now)
+	overlap := 1 - float64(now.Sub(o.windowStart))/float64(throttleRateWindow)
+	return (o.previous*overlap + o.current) / throttleRateWindow.Seconds()
+}
+
+// advance moves the fixed window forward to the one including now.
+func (o *observedRate) advance(now time.Time) {
+	elapsed := now.Sub(o.windowStart)
+	if elapsed < throttleRateWindow {
+		return
+	}
+
+	if elapsed < 2*throttleRateWindow {
+		o.previous = o.current
+	} else {
+		o.previous = 0
+	}
+	o.current = 0
+	o.windowStart = o.windowStart.Add(elapsed.Truncate(throttleRateWindow))
+}
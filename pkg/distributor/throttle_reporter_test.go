@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestNewThrottleEventSink(t *testing.T) {
+	for _, rawURL := range []string{"", "kafka://broker:9092/topic", "http://", "file://", "localhost:8080"} {
+		_, err := NewThrottleEventSink(rawURL, time.Second)
+		assert.Equal(t, errInvalidThrottleEventsSink, err, rawURL)
+	}
+
+	sink, err := NewThrottleEventSink("http://localhost:8080/events", time.Second)
+	require.NoError(t, err)
+	assert.IsType(t, &httpThrottleEventSink{}, sink)
+
+	sink, err = NewThrottleEventSink("file://"+filepath.Join(t.TempDir(), "events.jsonl"), time.Second)
+	require.NoError(t, err)
+	assert.IsType(t, &fileThrottleEventSink{}, sink)
+	require.NoError(t, sink.Close())
+}
+
+func TestTenantThrottleReporter_HTTPSink(t *testing.T) {
+	var (
+		receivedMx sync.Mutex
+		received   []ThrottleEvent
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []ThrottleEvent
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		receivedMx.Lock()
+		received = append(received, events...)
+		receivedMx.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	sink, err := NewThrottleEventSink(server.URL, time.Second)
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	r := NewTenantThrottleReporter(sink, reg, log.NewNopLogger())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+
+	now := time.Unix(1000, 0).UTC()
+	r.Observe("user-1", throttleLimitRequestRate, 10, now)
+	r.Observe("user-2", throttleLimitIngestionRate, 2000, now)
+	r.Report("user-1", throttleLimitRequestRate, 10, now)
+	r.Report("user-2", throttleLimitIngestionRate, 1000, now)
+
+	test.Poll(t, time.Second, 2, func() interface{} {
+		receivedMx.Lock()
+		defer receivedMx.Unlock()
+		return len(received)
+	})
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), r))
+
+	assert.Equal(t, []ThrottleEvent{
+		{TenantID: "user-1", LimitName: "request_rate", LimitValue: 10, CurrentValue: 1, Timestamp: now},
+		{TenantID: "user-2", LimitName: "ingestion_rate", LimitValue: 1000, CurrentValue: 200, Timestamp: now},
+	}, received)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_throttle_events_dropped_total The total number of tenant throttle events dropped because the buffer was full or writing to the throttle events sink failed.
+		# TYPE cortex_distributor_throttle_events_dropped_total counter
+		cortex_distributor_throttle_events_dropped_total 0
+		# HELP cortex_distributor_throttle_events_written_total The total number of tenant throttle events written to the throttle events sink.
+		# TYPE cortex_distributor_throttle_events_written_total counter
+		cortex_distributor_throttle_events_written_total 2
+	`)))
+}
+
+func TestTenantThrottleReporter_SinkFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "sink failure", http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	sink, err := NewThrottleEventSink(server.URL, time.Second)
+	require.NoError(t, err)
+
+	err = sink.Write(context.Background(), []ThrottleEvent{{TenantID: "user-1"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "throttle events sink returned HTTP status 500: sink failure")
+
+	reg := prometheus.NewPedanticRegistry()
+	r := NewTenantThrottleReporter(sink, reg, log.NewNopLogger())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), r))
+	})
+
+	r.Report("user-1", throttleLimitRequestRate, 10, time.Now())
+
+	test.Poll(t, time.Second, float64(1), func() interface{} {
+		return testutil.ToFloat64(r.droppedEvents)
+	})
+	assert.Equal(t, float64(0), testutil.ToFloat64(r.writtenEvents))
+}
+
+func TestTenantThrottleReporter_ShouldDropEventsWhenBufferIsFull(t *testing.T) {
+	sink, err := NewThrottleEventSink("file://"+filepath.Join(t.TempDir(), "events.jsonl"), time.Second)
+	require.NoError(t, err)
+
+	// The reporter is not started, so events are never consumed from the buffer.
+	r := NewTenantThrottleReporter(sink, nil, log.NewNopLogger())
+	for i := 0; i < throttleEventsQueueSize+10; i++ {
+		r.Report("user-1", throttleLimitRequestRate, 10, time.Now())
+	}
+
+	assert.Equal(t, float64(10), testutil.ToFloat64(r.droppedEvents))
+	require.NoError(t, sink.Close())
+}
+
+func TestTenantThrottleReporter_ShouldReportTheObservedRate(t *testing.T) {
+	r := NewTenantThrottleReporter(nil, nil, log.NewNopLogger())
+	start := time.Unix(1000, 0)
+
+	// 10 requests per second for 20 seconds.
+	for i := 0; i < 200; i++ {
+		r.Observe("user-1", throttleLimitRequestRate, 1, start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+
+	rateAt := func(now time.Time) float64 {
+		r.Report("user-1", throttleLimitRequestRate, 5, now)
+		return (<-r.events).CurrentValue
+	}
+
+	assert.InDelta(t, 10, rateAt(start.Add(20*time.Second)), 0.01)
+
+	// Half of the sliding window has no requests.
+	assert.InDelta(t, 5, rateAt(start.Add(25*time.Second)), 0.01)
+
+	// The whole sliding window has no requests.
+	assert.Equal(t, float64(0), rateAt(start.Add(time.Minute)))
+
+	// The rate of an unknown tenant or limit is 0.
+	r.Report("user-1", throttleLimitIngestionRate, 5, start)
+	assert.Equal(t, float64(0), (<-r.events).CurrentValue)
+
+	// The rates of the tenants without recent requests are removed.
+	r.cleanupRates(start.Add(2 * time.Minute))
+	assert.Empty(t, r.rates)
+}
+
+func TestDistributor_ShouldReportThrottleEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.RequestRate = 1
+	limits.RequestBurstSize = 1
+
+	distributors, _, _ := prepare(t, prepConfig{
+		numIngesters:       3,
+		happyIngesters:     3,
+		numDistributors:    1,
+		limits:             limits,
+		throttleEventsSink: "file://" + path,
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	_, err := distributors[0].Push(ctx, makeWriteRequest(0, 1, 1, false))
+	require.NoError(t, err)
+	_, err = distributors[0].Push(ctx, makeWriteRequest(0, 1, 1, false))
+	require.Error(t, err)
+
+	// Stopping the distributor writes the buffered events to the sink.
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), distributors[0]))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	var events []ThrottleEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := ThrottleEvent{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, "user", events[0].TenantID)
+	assert.Equal(t, throttleLimitRequestRate, events[0].LimitName)
+	assert.Equal(t, float64(1), events[0].LimitValue)
+	// Both the accepted and the rejected requests count towards the requested rate.
+	assert.Equal(t, float64(2)/throttleRateWindow.Seconds(), events[0].CurrentValue)
+	assert.False(t, events[0].Timestamp.IsZero())
+}
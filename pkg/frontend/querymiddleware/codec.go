@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"sort"
@@ -23,6 +24,7 @@ import (
 	"github.com/gogo/status"
 	"github.com/opentracing/opentracing-go"
 	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
 	"github.com/weaveworks/common/httpgrpc"
 
@@ -51,6 +53,9 @@ const (
 
 	// Instant query specific options
 	instantSplitControlHeader = "Instant-Split-Control"
+
+	jsonMimeType     = "application/json"
+	protobufMimeType = "application/vnd.google.protobuf"
 )
 
 // Codec is used to encode/decode query range requests and responses so they can be passed down to middlewares.
@@ -64,8 +69,8 @@ type Codec interface {
 	DecodeResponse(context.Context, *http.Response, Request, log.Logger) (Response, error)
 	// EncodeRequest encodes a Request into an http request.
 	EncodeRequest(context.Context, Request) (*http.Request, error)
-	// EncodeResponse encodes a Response into an http response.
-	EncodeResponse(context.Context, Response) (*http.Response, error)
+	// EncodeResponse encodes a Response into an http response, in the format accepted by the input http request.
+	EncodeResponse(context.Context, *http.Request, Response) (*http.Response, error)
 }
 
 // Merger is used by middlewares making multiple requests to merge back all responses into a single one.
@@ -314,7 +319,7 @@ func (prometheusCodec) DecodeResponse(ctx context.Context, r *http.Response, _ R
 	}
 	return &resp, nil
 }
-func (prometheusCodec) EncodeResponse(ctx context.Context, res Response) (*http.Response, error) {
+func (prometheusCodec) EncodeResponse(ctx context.Context, req *http.Request, res Response) (*http.Response, error) {
 	sp, _ := opentracing.StartSpanFromContext(ctx, "APIResponse.ToHTTPResponse")
 	defer sp.Finish()
 
@@ -326,24 +331,93 @@ func (prometheusCodec) EncodeResponse(ctx context.Context, res Response) (*http.
 		sp.LogFields(otlog.Int("series", len(a.Data.Result)))
 	}
 
-	b, err := json.Marshal(a)
+	contentType := negotiateContentType(req, isOpenMetricsResult(a))
+
+	var b []byte
+	var err error
+	switch contentType {
+	case protobufMimeType:
+		// The headers are not part of the response body, like in the JSON format.
+		withoutHeaders := *a
+		withoutHeaders.Headers = nil
+		b, err = withoutHeaders.Marshal()
+	case string(expfmt.FmtOpenMetrics):
+		b, err = encodeOpenMetrics(a, metricsMetadataFromContext(ctx))
+	default:
+		b, err = json.Marshal(a)
+	}
 	if err != nil {
 		return nil, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
 	}
 
-	sp.LogFields(otlog.Int("bytes", len(b)))
+	sp.LogFields(otlog.Int("bytes", len(b)), otlog.String("content_type", contentType))
 
 	resp := http.Response{
 		Header: http.Header{
-			"Content-Type": []string{"application/json"},
+			"Content-Type": []string{contentType},
 		},
 		Body:          io.NopCloser(bytes.NewBuffer(b)),
 		StatusCode:    http.StatusOK,
 		ContentLength: int64(len(b)),
 	}
+	for _, v := range getHeaderValuesWithName(a, truncatedResponseHeader) {
+		resp.Header.Add(truncatedResponseHeader, v)
+	}
 	return &resp, nil
 }
 
+// negotiateContentType returns the content type of the response preferred by the client, according to the
+// q-values of the Accept header. The JSON format is the default if none of the supported formats is accepted,
+// and it's preferred over protobuf, which is preferred over OpenMetrics, when accepted with the same q-value.
+// The OpenMetrics format is negotiated only if supported by the query result.
+func negotiateContentType(req *http.Request, openMetricsSupported bool) string {
+	if req == nil {
+		return jsonMimeType
+	}
+
+	qualities := map[string]float64{}
+	for _, header := range req.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+
+			var contentType string
+			switch {
+			case mediaType == protobufMimeType:
+				contentType = protobufMimeType
+			case mediaType == expfmt.OpenMetricsType && openMetricsSupported && (params["version"] == "" || params["version"] == expfmt.OpenMetricsVersion):
+				contentType = string(expfmt.FmtOpenMetrics)
+			case mediaType == jsonMimeType || mediaType == "application/*" || mediaType == "*/*":
+				contentType = jsonMimeType
+			default:
+				continue
+			}
+
+			if current, ok := qualities[contentType]; !ok || quality > current {
+				qualities[contentType] = quality
+			}
+		}
+	}
+
+	// The supported content types are listed by preference, to break the ties.
+	best, bestQuality := jsonMimeType, 0.0
+	for _, contentType := range []string{jsonMimeType, protobufMimeType, string(expfmt.FmtOpenMetrics)} {
+		if quality := qualities[contentType]; quality > bestQuality {
+			best, bestQuality = contentType, quality
+		}
+	}
+	return best
+}
+
 func matrixMerge(resps []*PrometheusResponse) []SampleStream {
 	output := map[string]*SampleStream{}
 	for _, resp := range resps {
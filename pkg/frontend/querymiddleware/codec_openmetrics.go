@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// unnamedSeriesMetricName is the metric name given to the query results without a metric
+// name, like aggregations and scalars, because OpenMetrics requires each sample to have one.
+const unnamedSeriesMetricName = "query_result"
+
+// metadataSuffixes are the suffixes stripped from the series metric names to find the HELP
+// of the metric family they belong to, when there's no metadata for the series metric name.
+var metadataSuffixes = []string{"_total", "_bucket", "_sum", "_count"}
+
+type metricsMetadataContextKey int
+
+const metricsMetadataKey = metricsMetadataContextKey(0)
+
+// metricMetadata is the metadata of a metric, as returned by the metadata API.
+type metricMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+}
+
+// contextWithMetricsMetadata returns a context with the metadata of the metrics in the query result,
+// used to source the TYPE and HELP of each metric when the result is encoded in the OpenMetrics format.
+func contextWithMetricsMetadata(ctx context.Context, metadata map[string]metricMetadata) context.Context {
+	return context.WithValue(ctx, metricsMetadataKey, metadata)
+}
+
+func metricsMetadataFromContext(ctx context.Context) map[string]metricMetadata {
+	metadata, _ := ctx.Value(metricsMetadataKey).(map[string]metricMetadata)
+	return metadata
+}
+
+// acceptsOpenMetrics returns whether the client prefers the response encoded in the OpenMetrics text format.
+func acceptsOpenMetrics(req *http.Request) bool {
+	return negotiateContentType(req, true) == string(expfmt.FmtOpenMetrics)
+}
+
+// isOpenMetricsResult returns whether the query result can be represented in the OpenMetrics format.
+// String results can't.
+func isOpenMetricsResult(resp *PrometheusResponse) bool {
+	if resp.Data == nil {
+		return false
+	}
+
+	switch resp.Data.ResultType {
+	case model.ValVector.String(), model.ValMatrix.String(), model.ValScalar.String():
+		return true
+	default:
+		return false
+	}
+}
+
+// openMetricsMetadataNames returns the metric names whose metadata is used to encode the query result
+// in the OpenMetrics format: the metric names in the result, and the names of the metric families
+// they may belong to.
+func openMetricsMetadataNames(resp Response) []string {
+	promResp, ok := resp.(*PrometheusResponse)
+	if !ok || !isOpenMetricsResult(promResp) {
+		return nil
+	}
+
+	names := map[string]struct{}{}
+	for _, stream := range promResp.Data.Result {
+		name := mimirpb.FromLabelAdaptersToLabels(stream.Labels).Get(model.MetricNameLabel)
+		if name == "" {
+			continue
+		}
+
+		names[name] = struct{}{}
+		for _, suffix := range metadataSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				names[strings.TrimSuffix(name, suffix)] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// fetchMetricsMetadata fetches the metadata of the input metric names from the metadata API, through
+// the input round tripper. The metadata API is expected to be exposed next to the query API.
+func fetchMetricsMetadata(ctx context.Context, next http.RoundTripper, queryPath string, names []string) (map[string]metricMetadata, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	u := &url.URL{
+		Path:     path.Join(path.Dir(queryPath), "metadata"),
+		RawQuery: url.Values{"metric": names}.Encode(),
+	}
+	req := &http.Request{
+		Method:     "GET",
+		RequestURI: u.String(), // This is what the httpgrpc code looks at.
+		URL:        u,
+		Body:       http.NoBody,
+		Header:     http.Header{},
+	}
+	req = req.WithContext(ctx)
+
+	if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := bodyBuffer(resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching the metrics metadata", resp.StatusCode)
+	}
+
+	result := struct {
+		Status string                      `json:"status"`
+		Data   map[string][]metricMetadata `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]metricMetadata, len(result.Data))
+	for name, entries := range result.Data {
+		if len(entries) > 0 {
+			metadata[name] = entries[0]
+		}
+	}
+	return metadata, nil
+}
+
+// encodeOpenMetrics encodes the input query result in the OpenMetrics text format. The TYPE and HELP of
+// each metric are taken from the input metadata.
+func encodeOpenMetrics(resp *PrometheusResponse, metadata map[string]metricMetadata) ([]byte, error) {
+	out := bytes.Buffer{}
+	enc := expfmt.NewEncoder(&out, expfmt.FmtOpenMetrics)
+	for _, family := range buildMetricFamilies(resp.Data.Result, metadata) {
+		if err := enc.Encode(family); err != nil {
+			return nil, err
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// buildMetricFamilies groups the input series in metric families by metric name, sorted by name.
+func buildMetricFamilies(streams []SampleStream, metadata map[string]metricMetadata) []*dto.MetricFamily {
+	families := map[string]*dto.MetricFamily{}
+	for _, stream := range streams {
+		name := ""
+		labelPairs := make([]*dto.LabelPair, 0, len(stream.Labels))
+		for _, l := range stream.Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			labelPairs = append(labelPairs, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+		}
+		sort.Slice(labelPairs, func(i, j int) bool { return labelPairs[i].GetName() < labelPairs[j].GetName() })
+
+		if name == "" {
+			name = unnamedSeriesMetricName
+		}
+
+		family, ok := families[name]
+		if !ok {
+			family = newMetricFamily(name, metadata)
+			families[name] = family
+		}
+
+		// The samples of the same series are contiguous, because each series is a single stream.
+		for _, s := range stream.Samples {
+			metric := &dto.Metric{Label: labelPairs, TimestampMs: proto.Int64(s.TimestampMs)}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				metric.Counter = &dto.Counter{Value: proto.Float64(s.Value)}
+			case dto.MetricType_GAUGE:
+				metric.Gauge = &dto.Gauge{Value: proto.Float64(s.Value)}
+			default:
+				metric.Untyped = &dto.Untyped{Value: proto.Float64(s.Value)}
+			}
+			family.Metric = append(family.Metric, metric)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		sort.SliceStable(family.Metric, func(i, j int) bool {
+			return labelPairsString(family.Metric[i].Label) < labelPairsString(family.Metric[j].Label)
+		})
+		result = append(result, family)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result
+}
+
+// newMetricFamily makes a new empty metric family with the input name, and the TYPE and HELP taken
+// from the metadata. Only counters and gauges are typed, because the series of histograms and
+// summaries are not guaranteed to be all part of the query result.
+func newMetricFamily(name string, metadata map[string]metricMetadata) *dto.MetricFamily {
+	family := &dto.MetricFamily{
+		Name: proto.String(name),
+		Type: dto.MetricType_UNTYPED.Enum(),
+	}
+
+	m, ok := metadata[name]
+	if ok {
+		switch textparse.MetricType(m.Type) {
+		case textparse.MetricTypeCounter:
+			family.Type = dto.MetricType_COUNTER.Enum()
+		case textparse.MetricTypeGauge:
+			family.Type = dto.MetricType_GAUGE.Enum()
+		}
+	} else {
+		for _, suffix := range metadataSuffixes {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			if m, ok = metadata[strings.TrimSuffix(name, suffix)]; ok {
+				if suffix == "_total" && textparse.MetricType(m.Type) == textparse.MetricTypeCounter {
+					family.Type = dto.MetricType_COUNTER.Enum()
+				}
+				break
+			}
+		}
+	}
+
+	if ok && m.Help != "" {
+		family.Help = proto.String(m.Help)
+	}
+	return family
+}
+
+func labelPairsString(pairs []*dto.LabelPair) string {
+	sb := strings.Builder{}
+	for _, p := range pairs {
+		sb.WriteString(p.GetName())
+		sb.WriteByte(0xff)
+		sb.WriteString(p.GetValue())
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestPrometheusCodec_EncodeResponse_OpenMetrics(t *testing.T) {
+	metadata := map[string]metricMetadata{
+		"http_requests_total":      {Type: "counter", Help: "Total number of HTTP requests."},
+		"memory_bytes":             {Type: "gauge", Help: "Memory usage."},
+		"request_duration_seconds": {Type: "histogram", Help: "Request duration."},
+	}
+
+	tests := map[string]struct {
+		accept              string
+		data                *PrometheusData
+		expectedContentType string
+		expectedBody        string
+	}{
+		"JSON requested": {
+			accept:              "application/json",
+			data:                &PrometheusData{ResultType: model.ValScalar.String(), Result: []SampleStream{{Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 2}}}}},
+			expectedContentType: jsonMimeType,
+			expectedBody:        `{"status":"success","data":{"resultType":"scalar","result":[1,"2"]}}`,
+		},
+		"vector": {
+			accept: "application/openmetrics-text",
+			data: &PrometheusData{ResultType: model.ValVector.String(), Result: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "memory_bytes"}, {Name: "pod", Value: "b"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 2}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "http_requests_total"}, {Name: "pod", Value: "a"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 5}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "memory_bytes"}, {Name: "pod", Value: "a"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 1}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "request_duration_seconds_count"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 3}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "pod", Value: "a"}}, Samples: []mimirpb.Sample{{TimestampMs: 10500, Value: 4}}},
+			}},
+			expectedContentType: string(expfmt.FmtOpenMetrics),
+			expectedBody: `# HELP http_requests Total number of HTTP requests.
+# TYPE http_requests counter
+http_requests_total{pod="a"} 5.0 10.0
+# HELP memory_bytes Memory usage.
+# TYPE memory_bytes gauge
+memory_bytes{pod="a"} 1.0 10.0
+memory_bytes{pod="b"} 2.0 10.0
+# TYPE query_result unknown
+query_result{pod="a"} 4.0 10.5
+# HELP request_duration_seconds_count Request duration.
+# TYPE request_duration_seconds_count unknown
+request_duration_seconds_count 3.0 10.0
+# EOF
+`,
+		},
+		"matrix": {
+			accept: "application/openmetrics-text; version=0.0.1",
+			data: &PrometheusData{ResultType: model.ValMatrix.String(), Result: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "memory_bytes"}, {Name: "pod", Value: "b"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 2}, {TimestampMs: 20000, Value: 3}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "memory_bytes"}, {Name: "pod", Value: "a"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 1}, {TimestampMs: 20000, Value: 4}}},
+			}},
+			expectedContentType: string(expfmt.FmtOpenMetrics),
+			expectedBody: `# HELP memory_bytes Memory usage.
+# TYPE memory_bytes gauge
+memory_bytes{pod="a"} 1.0 10.0
+memory_bytes{pod="a"} 4.0 20.0
+memory_bytes{pod="b"} 2.0 10.0
+memory_bytes{pod="b"} 3.0 20.0
+# EOF
+`,
+		},
+		"scalar": {
+			accept:              "application/openmetrics-text",
+			data:                &PrometheusData{ResultType: model.ValScalar.String(), Result: []SampleStream{{Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 2}}}}},
+			expectedContentType: string(expfmt.FmtOpenMetrics),
+			expectedBody: `# TYPE query_result unknown
+query_result 2.0 10.0
+# EOF
+`,
+		},
+		"string results are returned in JSON": {
+			accept:              "application/openmetrics-text",
+			data:                &PrometheusData{ResultType: model.ValString.String(), Result: []SampleStream{{Labels: []mimirpb.LabelAdapter{{Name: "value", Value: "foo"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000}}}}},
+			expectedContentType: jsonMimeType,
+			expectedBody:        `{"status":"success","data":{"resultType":"string","result":[10,"foo"]}}`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", testData.accept)
+
+			res := &PrometheusResponse{Status: statusSuccess, Data: testData.data}
+			encoded, err := PrometheusCodec.EncodeResponse(contextWithMetricsMetadata(context.Background(), metadata), req, res)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedContentType, encoded.Header.Get("Content-Type"))
+
+			body, err := bodyBuffer(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedBody, string(body))
+		})
+	}
+}
+
+func TestPrometheusCodec_EncodeResponse_OpenMetricsWithoutMetadata(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text")
+
+	res := &PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: model.ValVector.String(), Result: []SampleStream{
+		{Labels: []mimirpb.LabelAdapter{{Name: "__name__", Value: "up"}}, Samples: []mimirpb.Sample{{TimestampMs: 10000, Value: 1}}},
+	}}}
+	encoded, err := PrometheusCodec.EncodeResponse(context.Background(), req, res)
+	require.NoError(t, err)
+
+	body, err := bodyBuffer(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "# TYPE up unknown\nup 1.0 10.0\n# EOF\n", string(body))
+}
+
+func TestLimitedRoundTripper_ShouldFetchMetadataOnlyForTheMetricsInTheOpenMetricsResult(t *testing.T) {
+	var metadataRequests []*url.URL
+
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"http_requests_total","pod":"a"},"value":[10,"5"]},
+			{"metric":{"pod":"b"},"value":[10,"1"]}
+		]}}`
+		if r.URL.Path == "/prometheus/api/v1/metadata" {
+			metadataRequests = append(metadataRequests, r.URL)
+			assert.Equal(t, "user-1", r.Header.Get(user.OrgIDHeaderName))
+			body = `{"status":"success","data":{"http_requests_total":[{"type":"counter","help":"Total number of HTTP requests.","unit":""}]}}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	req, err := PrometheusCodec.EncodeRequest(ctx, &PrometheusInstantQueryRequest{
+		Path:  "/prometheus/api/v1/query",
+		Time:  10000,
+		Query: `{pod=~"a|b"}`,
+	})
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text")
+
+	res, err := newLimitedParallelismRoundTripper(downstream, PrometheusCodec, mockLimits{maxQueryParallelism: 1}).RoundTrip(req)
+	require.NoError(t, err)
+
+	body, err := bodyBuffer(res)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP http_requests Total number of HTTP requests.
+# TYPE http_requests counter
+http_requests_total{pod="a"} 5.0 10.0
+# TYPE query_result unknown
+query_result{pod="b"} 1.0 10.0
+# EOF
+`, string(body))
+
+	require.Len(t, metadataRequests, 1)
+	assert.Equal(t, []string{"http_requests", "http_requests_total"}, metadataRequests[0].Query()["metric"])
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/go-kit/log"
 	jsoniter "github.com/json-iterator/go"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -319,7 +320,7 @@ func TestResponseRoundtrip(t *testing.T) {
 				Body:          io.NopCloser(bytes.NewBuffer(body)),
 				ContentLength: int64(len(body)),
 			}
-			encoded, err := PrometheusCodec.EncodeResponse(context.Background(), decoded)
+			encoded, err := PrometheusCodec.EncodeResponse(context.Background(), nil, decoded)
 			require.NoError(t, err)
 
 			expectedJSON, err := bodyBuffer(httpResponse)
@@ -333,6 +334,100 @@ func TestResponseRoundtrip(t *testing.T) {
 	}
 }
 
+func TestPrometheusCodec_EncodeResponse_ContentNegotiation(t *testing.T) {
+	res := &PrometheusResponse{
+		Status: statusSuccess,
+		Data: &PrometheusData{
+			ResultType: model.ValMatrix.String(),
+			Result: []SampleStream{{
+				Labels:  []mimirpb.LabelAdapter{{Name: "__name__", Value: "metric"}, {Name: "job", Value: "test"}},
+				Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: 1.5}, {TimestampMs: 2000, Value: 2.5}},
+			}},
+		},
+		Headers: []*PrometheusResponseHeader{{Name: "Content-Type", Values: []string{"application/json"}}},
+	}
+
+	tests := map[string]struct {
+		accept              []string
+		expectedContentType string
+	}{
+		"no Accept header": {
+			expectedContentType: jsonMimeType,
+		},
+		"JSON accepted": {
+			accept:              []string{"application/json"},
+			expectedContentType: jsonMimeType,
+		},
+		"protobuf accepted": {
+			accept:              []string{"application/vnd.google.protobuf"},
+			expectedContentType: protobufMimeType,
+		},
+		"protobuf preferred over JSON": {
+			accept:              []string{"application/json;q=0.5, application/vnd.google.protobuf"},
+			expectedContentType: protobufMimeType,
+		},
+		"JSON preferred over protobuf": {
+			accept:              []string{"application/vnd.google.protobuf;q=0.5", "*/*"},
+			expectedContentType: jsonMimeType,
+		},
+		"both accepted with the same preference": {
+			accept:              []string{"application/vnd.google.protobuf, application/json"},
+			expectedContentType: jsonMimeType,
+		},
+		"OpenMetrics preferred over protobuf": {
+			accept:              []string{"application/vnd.google.protobuf;q=0.8, application/openmetrics-text;q=0.9"},
+			expectedContentType: string(expfmt.FmtOpenMetrics),
+		},
+		"protobuf preferred over OpenMetrics": {
+			accept:              []string{"application/openmetrics-text;q=0.8, application/vnd.google.protobuf;q=0.9"},
+			expectedContentType: protobufMimeType,
+		},
+		"JSON preferred over OpenMetrics": {
+			accept:              []string{"application/openmetrics-text;q=0.5, application/json"},
+			expectedContentType: jsonMimeType,
+		},
+		"protobuf not acceptable": {
+			accept:              []string{"application/vnd.google.protobuf;q=0"},
+			expectedContentType: jsonMimeType,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/query_range", nil)
+			require.NoError(t, err)
+			for _, accept := range testData.accept {
+				req.Header.Add("Accept", accept)
+			}
+
+			encoded, err := PrometheusCodec.EncodeResponse(context.Background(), req, res)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedContentType, encoded.Header.Get("Content-Type"))
+
+			body, err := bodyBuffer(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(body)), encoded.ContentLength)
+
+			// The OpenMetrics encoding is covered by its own tests.
+			if testData.expectedContentType == string(expfmt.FmtOpenMetrics) {
+				return
+			}
+
+			decoded := &PrometheusResponse{}
+			if testData.expectedContentType == protobufMimeType {
+				require.NoError(t, decoded.Unmarshal(body))
+			} else {
+				require.NoError(t, json.Unmarshal(body, decoded))
+			}
+
+			// Headers are not encoded in the body.
+			expected := *res
+			expected.Headers = nil
+			assert.Equal(t, &expected, decoded)
+		})
+	}
+}
+
 func TestMergeAPIResponses(t *testing.T) {
 	for _, tc := range []struct {
 		name     string
@@ -644,7 +739,7 @@ func BenchmarkPrometheusCodec_EncodeResponse(b *testing.B) {
 	b.ReportAllocs()
 
 	for n := 0; n < b.N; n++ {
-		_, err := PrometheusCodec.EncodeResponse(context.Background(), res)
+		_, err := PrometheusCodec.EncodeResponse(context.Background(), nil, res)
 		require.NoError(b, err)
 	}
 }
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// dynamicSplitMaxSteps is the max number of times the split interval can be halved from the
+	// configured one, so that it's kept between 1/8 of and the configured interval.
+	dynamicSplitMaxSteps = 3
+
+	// dynamicSplitWindowSize is the number of most recent latencies tracked for each split interval,
+	// and the number of split queries to observe at the current interval before adjusting it again.
+	dynamicSplitWindowSize = 100
+
+	// dynamicSplitLatencyTTL is the time after which the latencies observed at an interval are not considered
+	// anymore to prevent growing back to that interval, so that the interval can recover after a slowdown.
+	dynamicSplitLatencyTTL = 10 * time.Minute
+
+	// dynamicSplitIdleTimeout is the time after which the split interval of a tenant which hasn't run
+	// any range query is forgotten.
+	dynamicSplitIdleTimeout = time.Hour
+)
+
+// dynamicSplitIntervals tracks a dynamicSplitInterval per tenant, so that the split interval is adjusted
+// based on the latency of each tenant queries only.
+type dynamicSplitIntervals struct {
+	interval time.Duration
+	target   time.Duration
+
+	mtx         sync.Mutex
+	tenants     map[string]*dynamicSplitInterval
+	lastCleanup time.Time
+
+	currentInterval *prometheus.GaugeVec
+}
+
+func newDynamicSplitIntervals(interval, target time.Duration, reg prometheus.Registerer) *dynamicSplitIntervals {
+	return &dynamicSplitIntervals{
+		interval:    interval,
+		target:      target,
+		tenants:     map[string]*dynamicSplitInterval{},
+		lastCleanup: time.Now(),
+		currentInterval: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_frontend_dynamic_split_interval_seconds",
+			Help: "Current interval range queries are split by, adjusted to keep the split queries latency close to the target.",
+		}, []string{"user"}),
+	}
+}
+
+// forTenant returns the dynamicSplitInterval of the input tenant, which is the tenant ID or the
+// joined tenant IDs for the federated queries.
+func (d *dynamicSplitIntervals) forTenant(tenantID string) *dynamicSplitInterval {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastCleanup) >= dynamicSplitIdleTimeout {
+		d.cleanup(now)
+	}
+
+	split, ok := d.tenants[tenantID]
+	if !ok {
+		split = newDynamicSplitInterval(d.interval, d.target, d.currentInterval.WithLabelValues(tenantID))
+		d.tenants[tenantID] = split
+	}
+	split.lastUsed = now
+	return split
+}
+
+// cleanup forgets the split interval of the tenants which haven't run any range query for dynamicSplitIdleTimeout.
+// Must be called with the lock held.
+func (d *dynamicSplitIntervals) cleanup(now time.Time) {
+	for tenantID, split := range d.tenants {
+		if now.Sub(split.lastUsed) >= dynamicSplitIdleTimeout {
+			delete(d.tenants, tenantID)
+			d.currentInterval.DeleteLabelValues(tenantID)
+		}
+	}
+	d.lastCleanup = now
+}
+
+// dynamicSplitInterval adjusts the interval the range queries of a tenant are split by, to keep the p95
+// latency of the split queries close to a target latency. The interval is halved when the p95 latency at
+// the current interval exceeds the target, and doubled back when it's below half the target, unless the
+// p95 latency observed at the doubled interval in the last dynamicSplitLatencyTTL exceeds the target. The interval is adjusted by
+// at most one step every dynamicSplitWindowSize split queries, to avoid oscillations.
+//
+// The interval is never greater than the configured one, because the results cache keys are generated
+// from the configured interval: queries split by a shorter interval are cached under the key of the
+// configured interval they're within, so the cache keys don't change when the interval is adjusted.
+type dynamicSplitInterval struct {
+	target      time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+
+	// lastUsed is guarded by the dynamicSplitIntervals lock.
+	lastUsed time.Time
+
+	mtx       sync.Mutex
+	current   time.Duration
+	latencies map[time.Duration]*latencyWindow
+	observed  int // Number of split queries observed at the current interval since the last adjustment.
+
+	currentInterval prometheus.Gauge
+}
+
+func newDynamicSplitInterval(interval, target time.Duration, currentInterval prometheus.Gauge) *dynamicSplitInterval {
+	d := &dynamicSplitInterval{
+		target:          target,
+		minInterval:     interval >> dynamicSplitMaxSteps,
+		maxInterval:     interval,
+		current:         interval,
+		latencies:       map[time.Duration]*latencyWindow{},
+		currentInterval: currentInterval,
+	}
+	d.currentInterval.Set(interval.Seconds())
+	return d
+}
+
+// interval returns the interval the range queries should currently be split by.
+func (d *dynamicSplitInterval) interval() time.Duration {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.current
+}
+
+// observe tracks the latency of a split query run with the input split interval, and adjusts the
+// current split interval if enough split queries have been observed since the last adjustment.
+func (d *dynamicSplitInterval) observe(interval, latency time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	window, ok := d.latencies[interval]
+	if !ok {
+		window = &latencyWindow{}
+		d.latencies[interval] = window
+	}
+	window.add(latency, time.Now())
+
+	// Queries split before the last adjustment don't tell anything about the current interval.
+	if interval != d.current {
+		return
+	}
+	d.observed++
+	if d.observed < dynamicSplitWindowSize {
+		return
+	}
+
+	next := d.current
+	p95 := window.percentile(0.95)
+	switch {
+	case p95 > d.target && d.current/2 >= d.minInterval:
+		next = d.current / 2
+	case p95 < d.target/2 && d.current*2 <= d.maxInterval:
+		// Don't grow back to an interval already known to be too slow.
+		if larger, ok := d.latencies[d.current*2]; !ok || time.Since(larger.updatedAt) >= dynamicSplitLatencyTTL || larger.percentile(0.95) <= d.target {
+			next = d.current * 2
+		}
+	}
+
+	d.observed = 0
+	if next != d.current {
+		d.current = next
+		d.currentInterval.Set(next.Seconds())
+	}
+}
+
+// wrap returns a handler observing the latency of the successful split queries run through the
+// input handler, which have been split with the input interval.
+func (d *dynamicSplitInterval) wrap(next Handler, interval time.Duration) Handler {
+	return HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		start := time.Now()
+		resp, err := next.Do(ctx, req)
+		if err == nil {
+			d.observe(interval, time.Since(start))
+		}
+		return resp, err
+	})
+}
+
+// latencyWindow is a ring buffer of the most recent dynamicSplitWindowSize latencies.
+type latencyWindow struct {
+	latencies []time.Duration
+	next      int
+	updatedAt time.Time
+}
+
+func (w *latencyWindow) add(latency time.Duration, now time.Time) {
+	w.updatedAt = now
+	if len(w.latencies) < dynamicSplitWindowSize {
+		w.latencies = append(w.latencies, latency)
+	} else {
+		w.latencies[w.next] = latency
+	}
+	w.next = (w.next + 1) % dynamicSplitWindowSize
+}
+
+// percentile returns the input percentile, between 0 and 1, of the latencies in the window.
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	if len(w.latencies) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(w.latencies))
+	copy(sorted, w.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(math.Ceil(float64(len(sorted))*p))-1]
+}
@@ -0,0 +1,278 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/cache"
+)
+
+func TestDynamicSplitInterval(t *testing.T) {
+	observe := func(d *dynamicSplitInterval, latency time.Duration) {
+		interval := d.interval()
+		for i := 0; i < dynamicSplitWindowSize; i++ {
+			d.observe(interval, latency)
+		}
+	}
+
+	t.Run("should halve the interval while the p95 latency exceeds the target, down to the min interval", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, reg).forTenant("user-1")
+
+		// A single adjustment per window of observations.
+		for i := 0; i < dynamicSplitWindowSize-1; i++ {
+			d.observe(24*time.Hour, 2*time.Second)
+		}
+		assert.Equal(t, 24*time.Hour, d.interval())
+		d.observe(24*time.Hour, 2*time.Second)
+		assert.Equal(t, 12*time.Hour, d.interval())
+
+		observe(d, 2*time.Second)
+		assert.Equal(t, 6*time.Hour, d.interval())
+		observe(d, 2*time.Second)
+		assert.Equal(t, 3*time.Hour, d.interval())
+		observe(d, 2*time.Second)
+		assert.Equal(t, 3*time.Hour, d.interval())
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_frontend_dynamic_split_interval_seconds Current interval range queries are split by, adjusted to keep the split queries latency close to the target.
+			# TYPE cortex_frontend_dynamic_split_interval_seconds gauge
+			cortex_frontend_dynamic_split_interval_seconds{user="user-1"} 10800
+		`)))
+	})
+
+	t.Run("should double the interval while the p95 latency is below half the target, up to the configured interval", func(t *testing.T) {
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry()).forTenant("user-1")
+
+		observe(d, 100*time.Millisecond)
+		assert.Equal(t, 24*time.Hour, d.interval())
+
+		for i := 0; i < dynamicSplitMaxSteps; i++ {
+			observe(d, 2*time.Second)
+		}
+		require.Equal(t, 3*time.Hour, d.interval())
+
+		// The latencies previously observed at the larger intervals are too old to prevent growing back.
+		d.mtx.Lock()
+		for _, window := range d.latencies {
+			window.updatedAt = window.updatedAt.Add(-dynamicSplitLatencyTTL)
+		}
+		d.mtx.Unlock()
+
+		for _, expected := range []time.Duration{6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 24 * time.Hour} {
+			observe(d, 100*time.Millisecond)
+			assert.Equal(t, expected, d.interval())
+		}
+	})
+
+	t.Run("should keep the interval while the p95 latency is between half the target and the target", func(t *testing.T) {
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry()).forTenant("user-1")
+
+		observe(d, 2*time.Second)
+		require.Equal(t, 12*time.Hour, d.interval())
+
+		observe(d, 700*time.Millisecond)
+		assert.Equal(t, 12*time.Hour, d.interval())
+	})
+
+	t.Run("should not double the interval to one whose p95 latency exceeds the target", func(t *testing.T) {
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry()).forTenant("user-1")
+
+		observe(d, 2*time.Second)
+		require.Equal(t, 12*time.Hour, d.interval())
+
+		observe(d, 400*time.Millisecond)
+		assert.Equal(t, 12*time.Hour, d.interval())
+	})
+
+	t.Run("should ignore the latencies of the queries split before the last adjustment", func(t *testing.T) {
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry()).forTenant("user-1")
+
+		observe(d, 2*time.Second)
+		require.Equal(t, 12*time.Hour, d.interval())
+
+		for i := 0; i < dynamicSplitWindowSize; i++ {
+			d.observe(24*time.Hour, 2*time.Second)
+		}
+		assert.Equal(t, 12*time.Hour, d.interval())
+	})
+}
+
+func TestDynamicSplitIntervals(t *testing.T) {
+	t.Run("should adjust the interval of each tenant independently", func(t *testing.T) {
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry())
+
+		for i := 0; i < dynamicSplitWindowSize; i++ {
+			d.forTenant("user-1").observe(24*time.Hour, 2*time.Second)
+		}
+		assert.Equal(t, 12*time.Hour, d.forTenant("user-1").interval())
+		assert.Equal(t, 24*time.Hour, d.forTenant("user-2").interval())
+	})
+
+	t.Run("should forget the interval of the idle tenants", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		d := newDynamicSplitIntervals(24*time.Hour, time.Second, reg)
+
+		for i := 0; i < dynamicSplitWindowSize; i++ {
+			d.forTenant("user-1").observe(24*time.Hour, 2*time.Second)
+		}
+		d.forTenant("user-2")
+
+		// Simulate user-1 being idle for longer than the timeout.
+		d.mtx.Lock()
+		d.tenants["user-1"].lastUsed = time.Now().Add(-dynamicSplitIdleTimeout)
+		d.lastCleanup = time.Now().Add(-dynamicSplitIdleTimeout)
+		d.mtx.Unlock()
+
+		d.forTenant("user-2")
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_frontend_dynamic_split_interval_seconds Current interval range queries are split by, adjusted to keep the split queries latency close to the target.
+			# TYPE cortex_frontend_dynamic_split_interval_seconds gauge
+			cortex_frontend_dynamic_split_interval_seconds{user="user-2"} 86400
+		`)))
+		assert.Equal(t, 24*time.Hour, d.forTenant("user-1").interval())
+	})
+}
+
+func TestSplitAndCacheMiddleware_ShouldSplitByTheDynamicInterval(t *testing.T) {
+	d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry())
+	for i := 0; i < dynamicSplitWindowSize; i++ {
+		d.forTenant("user-1").observe(24*time.Hour, 2*time.Second)
+	}
+	require.Equal(t, 12*time.Hour, d.forTenant("user-1").interval())
+
+	mw := newSplitAndCacheMiddleware(
+		true,
+		false,
+		24*time.Hour,
+		d,
+		false,
+		false,
+		mockLimits{},
+		PrometheusCodec,
+		nil,
+		nil,
+		nil,
+		nil,
+		log.NewNopLogger(),
+		prometheus.NewPedanticRegistry(),
+	)
+
+	var (
+		mtx        sync.Mutex
+		actualReqs []Request
+	)
+	handler := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+		mtx.Lock()
+		actualReqs = append(actualReqs, req)
+		mtx.Unlock()
+		return &PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: matrix}}, nil
+	}))
+
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	req := &PrometheusRangeQueryRequest{
+		Path:  "/api/v1/query_range",
+		Start: start.UnixMilli(),
+		End:   start.Add(48*time.Hour - time.Minute).UnixMilli(),
+		Step:  time.Minute.Milliseconds(),
+		Query: "up",
+	}
+
+	_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), req)
+	require.NoError(t, err)
+	assert.Len(t, actualReqs, 4)
+
+	// The latency of the split queries is tracked for the interval they've been split by.
+	split := d.forTenant("user-1")
+	split.mtx.Lock()
+	require.Contains(t, split.latencies, 12*time.Hour)
+	assert.Len(t, split.latencies[12*time.Hour].latencies, 4)
+	split.mtx.Unlock()
+
+	// The queries of the other tenants are split by the configured interval.
+	actualReqs = nil
+	_, err = handler.Do(user.InjectOrgID(context.Background(), "user-2"), req)
+	require.NoError(t, err)
+	assert.Len(t, actualReqs, 2)
+}
+
+func TestSplitAndCacheMiddleware_ShouldCacheByTheConfiguredIntervalWhenSplitByTheDynamicInterval(t *testing.T) {
+	d := newDynamicSplitIntervals(24*time.Hour, time.Second, prometheus.NewPedanticRegistry())
+	for i := 0; i < dynamicSplitWindowSize; i++ {
+		d.forTenant("user-1").observe(24*time.Hour, 2*time.Second)
+	}
+	require.Equal(t, 12*time.Hour, d.forTenant("user-1").interval())
+
+	cacheBackend := cache.NewMockCache()
+	mw := newSplitAndCacheMiddleware(
+		true,
+		true,
+		24*time.Hour,
+		d,
+		false,
+		false,
+		mockLimits{},
+		PrometheusCodec,
+		cacheBackend,
+		ConstSplitter(24*time.Hour),
+		PrometheusResponseExtractor{},
+		resultsCacheAlwaysEnabled,
+		log.NewNopLogger(),
+		prometheus.NewPedanticRegistry(),
+	)
+
+	downstreamReqs := 0
+	handler := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+		downstreamReqs++
+		return &PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: matrix}}, nil
+	}))
+
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	req := &PrometheusRangeQueryRequest{
+		Path:  "/api/v1/query_range",
+		Start: start.UnixMilli(),
+		End:   start.Add(48*time.Hour - time.Minute).UnixMilli(),
+		Step:  time.Minute.Milliseconds(),
+		Query: "up",
+	}
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	_, err := handler.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 4, downstreamReqs)
+
+	// The split queries should be cached with the keys generated from the configured interval.
+	items := cacheBackend.GetItems()
+	require.Len(t, items, 2)
+	for i := 0; i < 2; i++ {
+		splitReq := req.WithStartEnd(start.Add(time.Duration(i)*24*time.Hour).UnixMilli(), start.Add(time.Duration(i+1)*24*time.Hour-time.Minute).UnixMilli())
+		assert.Contains(t, items, cacheHashKey(ConstSplitter(24*time.Hour).GenerateCacheKey(ctx, "user-1", splitReq)))
+	}
+
+	// The same query should be fully served from the cache.
+	_, err = handler.Do(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 4, downstreamReqs)
+
+	// The cached results should be used once the interval is adjusted again.
+	for i := 0; i < dynamicSplitWindowSize; i++ {
+		d.forTenant("user-1").observe(12*time.Hour, 2*time.Second)
+	}
+	require.Equal(t, 6*time.Hour, d.forTenant("user-1").interval())
+
+	_, err = handler.Do(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 4, downstreamReqs)
+}
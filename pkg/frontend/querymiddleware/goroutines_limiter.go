@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sync"
+)
+
+type goroutinesLimiterContextKey int
+
+const (
+	goroutinesLimiterKey goroutinesLimiterContextKey = iota
+	shardedQueriesLimiterKey
+)
+
+// goroutinesLimiter limits the number of goroutines spawned to run the sub-requests of a single query.
+// The same limiter is used to limit the number of in-flight sharded queries of a single query: while
+// the goroutines limit is enforced by running the exceeding jobs in the calling goroutine, which doesn't
+// bound the number of in-flight queries, the sharded queries exceeding their limit wait for a slot.
+type goroutinesLimiter struct {
+	slots chan struct{}
+}
+
+// contextWithGoroutinesLimiter returns a new context with a goroutinesLimiter allowing up to max goroutines.
+func contextWithGoroutinesLimiter(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, goroutinesLimiterKey, &goroutinesLimiter{slots: make(chan struct{}, max)})
+}
+
+// goroutinesLimiterFromContext returns the goroutinesLimiter from the context, or nil if there's no limit.
+func goroutinesLimiterFromContext(ctx context.Context) *goroutinesLimiter {
+	limiter, _ := ctx.Value(goroutinesLimiterKey).(*goroutinesLimiter)
+	return limiter
+}
+
+// contextWithShardedQueriesLimiter returns a new context with a goroutinesLimiter allowing up to max
+// in-flight sharded queries.
+func contextWithShardedQueriesLimiter(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, shardedQueriesLimiterKey, &goroutinesLimiter{slots: make(chan struct{}, max)})
+}
+
+// shardedQueriesLimiterFromContext returns the sharded queries goroutinesLimiter from the context, or nil if there's no limit.
+func shardedQueriesLimiterFromContext(ctx context.Context) *goroutinesLimiter {
+	limiter, _ := ctx.Value(shardedQueriesLimiterKey).(*goroutinesLimiter)
+	return limiter
+}
+
+// tryAcquire returns true if a new goroutine can be spawned. A nil limiter has no limit.
+func (l *goroutinesLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits until a slot is available, or the context is done. A nil limiter has no limit.
+func (l *goroutinesLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release must be called once a slot acquired through tryAcquire or acquire is not used anymore.
+func (l *goroutinesLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// forEachJob runs jobFunc for each job in parallel, spawning a goroutine for each job unless the
+// goroutinesLimiter in the context doesn't allow it: in that case the job waits to be run in the
+// calling goroutine. This never deadlocks, even when the jobs spawn further jobs. On the first error,
+// the context passed to the other jobs is canceled and the error is returned.
+func forEachJob(ctx context.Context, jobs int, jobFunc func(ctx context.Context, idx int) error) error {
+	limiter := goroutinesLimiterFromContext(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	run := func(idx int) {
+		if err := jobFunc(ctx, idx); err != nil {
+			errOnce.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+	}
+
+	idx := 0
+	for ; idx < jobs && ctx.Err() == nil; idx++ {
+		if !limiter.tryAcquire() {
+			run(idx)
+			continue
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer limiter.release()
+			run(idx)
+		}(idx)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if idx < jobs {
+		// Some jobs have not been run because the context has been canceled by the caller.
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestForEachJob(t *testing.T) {
+	t.Run("should run all jobs without a limit", func(t *testing.T) {
+		var runs atomic.Int32
+		require.NoError(t, forEachJob(context.Background(), 10, func(context.Context, int) error {
+			runs.Inc()
+			return nil
+		}))
+		assert.Equal(t, int32(10), runs.Load())
+	})
+
+	t.Run("should not run more jobs in parallel than the max goroutines plus the calling one", func(t *testing.T) {
+		const maxGoroutines = 3
+
+		var (
+			runs    atomic.Int32
+			running atomic.Int32
+			max     atomic.Int32
+		)
+
+		ctx := contextWithGoroutinesLimiter(context.Background(), maxGoroutines)
+		require.NoError(t, forEachJob(ctx, 20, func(context.Context, int) error {
+			runs.Inc()
+			cur := running.Inc()
+			defer running.Dec()
+			if cur > max.Load() {
+				max.Store(cur)
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}))
+
+		assert.Equal(t, int32(20), runs.Load())
+		assert.LessOrEqual(t, int(max.Load()), maxGoroutines+1)
+	})
+
+	t.Run("should not deadlock when jobs spawn further jobs", func(t *testing.T) {
+		var runs atomic.Int32
+
+		ctx := contextWithGoroutinesLimiter(context.Background(), 1)
+		require.NoError(t, forEachJob(ctx, 5, func(ctx context.Context, _ int) error {
+			return forEachJob(ctx, 5, func(context.Context, int) error {
+				runs.Inc()
+				time.Sleep(time.Millisecond)
+				return nil
+			})
+		}))
+
+		assert.Equal(t, int32(25), runs.Load())
+	})
+
+	t.Run("should return the first error and cancel the other jobs", func(t *testing.T) {
+		expectedErr := errors.New("job failed")
+
+		ctx := contextWithGoroutinesLimiter(context.Background(), 1)
+		err := forEachJob(ctx, 10, func(ctx context.Context, idx int) error {
+			if idx == 0 {
+				return expectedErr
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Minute):
+				return nil
+			}
+		})
+
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func TestGoroutinesLimiter_Acquire(t *testing.T) {
+	t.Run("should not limit with a nil limiter", func(t *testing.T) {
+		var limiter *goroutinesLimiter
+		require.NoError(t, limiter.acquire(context.Background()))
+		limiter.release()
+	})
+
+	t.Run("should wait for a slot until the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(contextWithShardedQueriesLimiter(context.Background(), 1), 100*time.Millisecond)
+		defer cancel()
+
+		limiter := shardedQueriesLimiterFromContext(ctx)
+		require.NoError(t, limiter.acquire(ctx))
+		require.ErrorIs(t, limiter.acquire(ctx), context.DeadlineExceeded)
+
+		limiter.release()
+		require.NoError(t, limiter.acquire(context.Background()))
+	})
+
+	t.Run("should keep the sharded queries limiter apart from the goroutines one", func(t *testing.T) {
+		ctx := contextWithShardedQueriesLimiter(contextWithGoroutinesLimiter(context.Background(), 1), 2)
+		assert.Equal(t, 1, cap(goroutinesLimiterFromContext(ctx).slots))
+		assert.Equal(t, 2, cap(shardedQueriesLimiterFromContext(ctx).slots))
+	})
+}
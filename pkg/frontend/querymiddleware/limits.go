@@ -14,6 +14,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/weaveworks/common/user"
@@ -40,6 +41,18 @@ type Limits interface {
 	// frontend will process in parallel.
 	MaxQueryParallelism(userID string) int
 
+	// MaxConcurrentGoroutinesPerQuery returns the limit to the number of goroutines spawned
+	// to run in parallel the split and partial queries of a single query. 0 to disable limit.
+	MaxConcurrentGoroutinesPerQuery(userID string) int
+
+	// MaxConcurrentSubqueriesPerQuery returns the limit to the number of in-flight subqueries
+	// run by the sharded queryable for a single query. 0 to disable limit.
+	MaxConcurrentSubqueriesPerQuery(userID string) int
+
+	// MaxResponseBodyBytes returns the max size, in bytes, of a query response body. Responses exceeding
+	// the limit are truncated. 0 to disable limit.
+	MaxResponseBodyBytes(userID string) int
+
 	// MaxCacheFreshness returns the period after which results are cacheable,
 	// to prevent caching of very recent results.
 	MaxCacheFreshness(userID string) time.Duration
@@ -156,6 +169,7 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 }
 
 type limitedParallelismRoundTripper struct {
+	next       http.RoundTripper
 	downstream Handler
 	limits     Limits
 
@@ -166,6 +180,7 @@ type limitedParallelismRoundTripper struct {
 // newLimitedParallelismRoundTripper creates a new roundtripper that enforces MaxQueryParallelism to the `next` roundtripper across `middlewares`.
 func newLimitedParallelismRoundTripper(next http.RoundTripper, codec Codec, limits Limits, middlewares ...Middleware) http.RoundTripper {
 	return limitedParallelismRoundTripper{
+		next: next,
 		downstream: roundTripperHandler{
 			next:  next,
 			codec: codec,
@@ -238,6 +253,18 @@ func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Respo
 		}()
 	}
 
+	// Limits the number of goroutines spawned by middlewares to run the sub-requests in parallel.
+	middlewaresCtx := ctx
+	if maxGoroutines := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, rt.limits.MaxConcurrentGoroutinesPerQuery); maxGoroutines > 0 {
+		middlewaresCtx = contextWithGoroutinesLimiter(ctx, maxGoroutines)
+	}
+
+	// Limits the number of in-flight sharded queries. The queries exceeding the limit wait until
+	// the query context is done, so the query timeout applies to them too.
+	if maxSubqueries := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, rt.limits.MaxConcurrentSubqueriesPerQuery); maxSubqueries > 0 {
+		middlewaresCtx = contextWithShardedQueriesLimiter(middlewaresCtx, maxSubqueries)
+	}
+
 	// Wraps middlewares with a final handler, which will receive requests in
 	// parallel from upstream handlers. Then each requests gets scheduled to a
 	// different worker via the `intermediate` channel, so the maximum
@@ -258,12 +285,23 @@ func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Respo
 			case <-ctx.Done():
 				return nil, ctx.Err()
 			}
-		})).Do(ctx, request)
+		})).Do(middlewaresCtx, request)
 	if err != nil {
 		return nil, err
 	}
 
-	return rt.codec.EncodeResponse(ctx, response)
+	// The metadata is only used to enrich the OpenMetrics output, so the encoding doesn't fail without it.
+	if acceptsOpenMetrics(r) {
+		metadata, err := fetchMetricsMetadata(ctx, rt.next, r.URL.Path, openMetricsMetadataNames(response))
+		if err != nil {
+			if span := opentracing.SpanFromContext(ctx); span != nil {
+				span.LogFields(otlog.String("msg", "failed to fetch the metrics metadata"), otlog.Error(err))
+			}
+		}
+		ctx = contextWithMetricsMetadata(ctx, metadata)
+	}
+
+	return rt.codec.EncodeResponse(ctx, r, response)
 }
 
 // roundTripperHandler is an adapter that implements the Handler interface using a http.RoundTripper to perform
@@ -7,7 +7,9 @@ package querymiddleware
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -284,6 +286,9 @@ type mockLimits struct {
 	maxTotalQueryLength            time.Duration
 	maxCacheFreshness              time.Duration
 	maxQueryParallelism            int
+	maxGoroutinesPerQuery          int
+	maxSubqueriesPerQuery          int
+	maxResponseBodyBytes           int
 	maxShardedQueries              int
 	splitInstantQueriesInterval    time.Duration
 	totalShards                    int
@@ -315,6 +320,18 @@ func (m mockLimits) MaxQueryParallelism(string) int {
 	return m.maxQueryParallelism
 }
 
+func (m mockLimits) MaxConcurrentGoroutinesPerQuery(string) int {
+	return m.maxGoroutinesPerQuery
+}
+
+func (m mockLimits) MaxResponseBodyBytes(string) int {
+	return m.maxResponseBodyBytes
+}
+
+func (m mockLimits) MaxConcurrentSubqueriesPerQuery(string) int {
+	return m.maxSubqueriesPerQuery
+}
+
 func (m mockLimits) MaxCacheFreshness(string) time.Duration {
 	return m.maxCacheFreshness
 }
@@ -406,6 +423,55 @@ func TestLimitedRoundTripper_MaxQueryParallelism(t *testing.T) {
 	require.LessOrEqual(t, maxFound, maxQueryParallelism, "max query parallelism: ", maxFound, " went over the configured one:", maxQueryParallelism)
 }
 
+func TestLimitedRoundTripper_MaxConcurrentGoroutinesPerQuery(t *testing.T) {
+	var (
+		maxGoroutines = 2
+		count         atomic.Int32
+		max           atomic.Int32
+		downstream    = RoundTripFunc(func(_ *http.Request) (*http.Response, error) {
+			cur := count.Inc()
+			if cur > max.Load() {
+				max.Store(cur)
+			}
+			defer count.Dec()
+			// simulate some work
+			time.Sleep(20 * time.Millisecond)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"matrix","result":[]}}`)),
+			}, nil
+		})
+		ctx = user.InjectOrgID(context.Background(), "foo")
+	)
+
+	r, err := PrometheusCodec.EncodeRequest(ctx, &PrometheusRangeQueryRequest{
+		Path:  "/query_range",
+		Start: time.Now().Add(time.Hour).Unix(),
+		End:   util.TimeToMillis(time.Now()),
+		Step:  int64(1 * time.Second * time.Millisecond),
+		Query: `foo`,
+	})
+	require.Nil(t, err)
+
+	_, err = newLimitedParallelismRoundTripper(downstream, PrometheusCodec, mockLimits{maxGoroutinesPerQuery: maxGoroutines},
+		MiddlewareFunc(func(next Handler) Handler {
+			return HandlerFunc(func(c context.Context, _ Request) (Response, error) {
+				reqs := make([]Request, 20)
+				for i := range reqs {
+					reqs[i] = &PrometheusRangeQueryRequest{}
+				}
+				_, err := doRequests(c, next, reqs, false)
+				return newEmptyPrometheusResponse(), err
+			})
+		}),
+	).RoundTrip(r)
+	require.NoError(t, err)
+
+	// The calling goroutine runs the requests too, when the limit has been reached.
+	maxFound := int(max.Load())
+	require.LessOrEqual(t, maxFound, maxGoroutines+1, "max concurrent requests: ", maxFound, " went over the configured max goroutines:", maxGoroutines)
+}
+
 func TestLimitedRoundTripper_MaxQueryParallelismLateScheduling(t *testing.T) {
 	var (
 		maxQueryParallelism = 2
@@ -287,6 +287,7 @@ type PrometheusResponse struct {
 	ErrorType string                      `protobuf:"bytes,3,opt,name=ErrorType,proto3" json:"errorType,omitempty"`
 	Error     string                      `protobuf:"bytes,4,opt,name=Error,proto3" json:"error,omitempty"`
 	Headers   []*PrometheusResponseHeader `protobuf:"bytes,5,rep,name=Headers,proto3" json:"-"`
+	Warnings  []string                    `protobuf:"bytes,6,rep,name=Warnings,proto3" json:"warnings,omitempty"`
 }
 
 func (m *PrometheusResponse) Reset()      { *m = PrometheusResponse{} }
@@ -356,6 +357,13 @@ func (m *PrometheusResponse) GetHeaders() []*PrometheusResponseHeader {
 	return nil
 }
 
+func (m *PrometheusResponse) GetWarnings() []string {
+	if m != nil {
+		return m.Warnings
+	}
+	return nil
+}
+
 type PrometheusData struct {
 	ResultType string         `protobuf:"bytes,1,opt,name=ResultType,proto3" json:"resultType"`
 	Result     []SampleStream `protobuf:"bytes,2,rep,name=Result,proto3" json:"result"`
@@ -706,70 +714,71 @@ func init() {
 func init() { proto.RegisterFile("model.proto", fileDescriptor_4c16552f9fdb66d8) }
 
 var fileDescriptor_4c16552f9fdb66d8 = []byte{
-	// 993 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xcd, 0x6e, 0x1c, 0x45,
-	0x10, 0xde, 0xd9, 0x7f, 0xd7, 0x86, 0xb5, 0x69, 0x5b, 0x62, 0x6c, 0x94, 0x99, 0xd5, 0x28, 0x07,
-	0xf3, 0xe3, 0x35, 0x38, 0xe2, 0x82, 0x04, 0x22, 0x13, 0x5b, 0x8a, 0x11, 0x82, 0xd0, 0xb6, 0x38,
-	0x70, 0x41, 0xbd, 0x3b, 0x9d, 0xdd, 0x21, 0xf3, 0x97, 0x9e, 0x9e, 0x90, 0xbd, 0x21, 0x9e, 0x80,
-	0x23, 0x2f, 0x80, 0xc4, 0x81, 0x33, 0x27, 0x1e, 0x20, 0x47, 0x73, 0x8b, 0x38, 0x0c, 0x78, 0x2d,
-	0x24, 0xb4, 0xa7, 0x3c, 0x02, 0xea, 0xea, 0x99, 0xdd, 0x71, 0x6c, 0x44, 0xb8, 0xec, 0x56, 0x57,
-	0x7d, 0x55, 0xfd, 0xd5, 0x37, 0xd5, 0x05, 0xbd, 0x30, 0xf6, 0x78, 0x30, 0x4c, 0x44, 0x2c, 0x63,
-	0x02, 0x8f, 0x32, 0x2e, 0x66, 0x82, 0x45, 0x13, 0xbe, 0xb3, 0x37, 0xf1, 0xe5, 0x34, 0x1b, 0x0d,
-	0xc7, 0x71, 0xb8, 0x3f, 0x89, 0x27, 0xf1, 0x3e, 0x42, 0x46, 0xd9, 0x03, 0x3c, 0xe1, 0x01, 0x2d,
-	0x9d, 0xba, 0x63, 0x4d, 0xe2, 0x78, 0x12, 0xf0, 0x15, 0xca, 0xcb, 0x04, 0x93, 0x7e, 0x1c, 0x15,
-	0xf1, 0x77, 0xaa, 0xe5, 0x04, 0x7b, 0xc0, 0x22, 0xb6, 0x1f, 0xfa, 0xa1, 0x2f, 0xf6, 0x93, 0x87,
-	0x13, 0x6d, 0x25, 0x23, 0xfd, 0x5f, 0x64, 0x6c, 0xbf, 0x58, 0x91, 0x45, 0x33, 0x1d, 0x72, 0x7e,
-	0xa9, 0xc3, 0xeb, 0xf7, 0x45, 0x1c, 0x72, 0x39, 0xe5, 0x59, 0x4a, 0x15, 0xdf, 0xcf, 0x15, 0x73,
-	0xca, 0x1f, 0x65, 0x3c, 0x95, 0x84, 0x40, 0x33, 0x61, 0x72, 0x6a, 0x1a, 0x03, 0x63, 0x77, 0x8d,
-	0xa2, 0x4d, 0xb6, 0xa0, 0x95, 0x4a, 0x26, 0xa4, 0x59, 0x1f, 0x18, 0xbb, 0x0d, 0xaa, 0x0f, 0x64,
-	0x03, 0x1a, 0x3c, 0xf2, 0xcc, 0x06, 0xfa, 0x94, 0xa9, 0x72, 0x53, 0xc9, 0x13, 0xb3, 0x89, 0x2e,
-	0xb4, 0xc9, 0x07, 0xd0, 0x91, 0x7e, 0xc8, 0xe3, 0x4c, 0x9a, 0xad, 0x81, 0xb1, 0xdb, 0x3b, 0xd8,
-	0x1e, 0x6a, 0x72, 0xc3, 0x92, 0xdc, 0xf0, 0xb0, 0x68, 0xd7, 0xed, 0x3e, 0xcd, 0xed, 0xda, 0x0f,
-	0x7f, 0xd8, 0x06, 0x2d, 0x73, 0xd4, 0xd5, 0x28, 0xac, 0xd9, 0x46, 0x3e, 0xfa, 0x40, 0x6e, 0x43,
-	0x27, 0x4e, 0x54, 0x4a, 0x6a, 0x76, 0xb0, 0xe8, 0xe6, 0x70, 0x25, 0xff, 0xf0, 0x33, 0x1d, 0x72,
-	0x9b, 0xaa, 0x1c, 0x2d, 0x91, 0xa4, 0x0f, 0x75, 0xdf, 0x33, 0xbb, 0xc8, 0xad, 0xee, 0x7b, 0x64,
-	0x0f, 0x5a, 0x53, 0x3f, 0x92, 0xa9, 0xb9, 0x86, 0x25, 0x5e, 0xad, 0x96, 0xb8, 0xa7, 0x02, 0x58,
-	0xc0, 0xa0, 0x1a, 0xe5, 0xfc, 0x66, 0xc0, 0xcd, 0x95, 0x70, 0xc7, 0x51, 0x2a, 0x59, 0x24, 0xff,
-	0x53, 0x3a, 0x02, 0x4d, 0xd5, 0x4a, 0xa1, 0x1c, 0xda, 0xab, 0x9e, 0x1a, 0xff, 0xd2, 0x53, 0xf3,
-	0x7f, 0xf6, 0xd4, 0xba, 0xda, 0x53, 0xfb, 0xa5, 0x7a, 0x3a, 0x05, 0xb3, 0x32, 0x0b, 0x3c, 0x4d,
-	0xe2, 0x28, 0xe5, 0xf7, 0x38, 0xf3, 0xb8, 0x20, 0xdb, 0xd0, 0xfc, 0x94, 0x85, 0x5c, 0x77, 0xe3,
-	0xb6, 0x16, 0xb9, 0x6d, 0xec, 0x51, 0x74, 0x91, 0x9b, 0xd0, 0xfe, 0x82, 0x05, 0x19, 0x4f, 0xcd,
-	0xfa, 0xa0, 0xb1, 0x0a, 0x16, 0x4e, 0xe7, 0xc7, 0x3a, 0x90, 0xab, 0x65, 0x89, 0x03, 0xed, 0x13,
-	0xc9, 0x64, 0x96, 0x16, 0x25, 0x61, 0x91, 0xdb, 0xed, 0x14, 0x3d, 0xb4, 0x88, 0x10, 0x17, 0x9a,
-	0x87, 0x4c, 0x32, 0x94, 0xab, 0x77, 0xb0, 0x53, 0xa5, 0xbf, 0xaa, 0xa8, 0x10, 0x2e, 0x59, 0xe4,
-	0x76, 0xdf, 0x63, 0x92, 0xbd, 0x1d, 0x87, 0xbe, 0xe4, 0x61, 0x22, 0x67, 0x14, 0x73, 0xc9, 0x7b,
-	0xb0, 0x76, 0x24, 0x44, 0x2c, 0x4e, 0x67, 0x09, 0xd7, 0x12, 0xbb, 0xaf, 0x2d, 0x72, 0x7b, 0x93,
-	0x97, 0xce, 0x4a, 0xc6, 0x0a, 0x49, 0xde, 0x80, 0x16, 0x1e, 0x50, 0xfd, 0x35, 0x77, 0x73, 0x91,
-	0xdb, 0xeb, 0x98, 0x52, 0x81, 0x6b, 0x04, 0x39, 0x82, 0x8e, 0x16, 0x29, 0x35, 0x5b, 0x83, 0xc6,
-	0x6e, 0xef, 0xe0, 0xd6, 0xf5, 0x44, 0x2f, 0x2b, 0x5a, 0xca, 0x54, 0xe6, 0x3a, 0xdf, 0x19, 0xd0,
-	0xbf, 0xdc, 0x15, 0x19, 0x02, 0x50, 0x9e, 0x66, 0x81, 0x44, 0xf2, 0x5a, 0xa7, 0xfe, 0x22, 0xb7,
-	0x41, 0x2c, 0xbd, 0xb4, 0x82, 0x20, 0x1f, 0x41, 0x5b, 0x9f, 0xf0, 0x4b, 0xf4, 0x0e, 0xcc, 0x2a,
-	0x91, 0x13, 0x16, 0x26, 0x01, 0x3f, 0x91, 0x82, 0xb3, 0xd0, 0xed, 0xab, 0xc1, 0x51, 0x8a, 0xeb,
-	0x4a, 0xb4, 0xc8, 0x73, 0x7e, 0x35, 0xe0, 0x46, 0x15, 0x48, 0x12, 0x68, 0x07, 0x6c, 0xc4, 0x03,
-	0xf5, 0x99, 0x1a, 0x38, 0x86, 0xe3, 0x58, 0x48, 0xfe, 0x24, 0x19, 0x0d, 0x3f, 0x51, 0xfe, 0xfb,
-	0xcc, 0x17, 0xee, 0x5d, 0x55, 0xed, 0xf7, 0xdc, 0x7e, 0xf7, 0x65, 0x56, 0x93, 0xce, 0xbb, 0xe3,
-	0xb1, 0x44, 0x72, 0xa1, 0x28, 0x84, 0x5c, 0x0a, 0x7f, 0x4c, 0x8b, 0x7b, 0xc8, 0xfb, 0xd0, 0x49,
-	0x91, 0x41, 0x5a, 0x74, 0xb1, 0xb1, 0xba, 0x52, 0x53, 0x5b, 0xb1, 0x7f, 0x8c, 0x23, 0x46, 0xcb,
-	0x04, 0xe7, 0x6b, 0xe8, 0xdf, 0x65, 0xe3, 0x29, 0xf7, 0x96, 0x63, 0xb6, 0x0d, 0x8d, 0x87, 0x7c,
-	0x56, 0x68, 0xd7, 0x59, 0xe4, 0xb6, 0x3a, 0x52, 0xf5, 0xa3, 0x76, 0x11, 0x7f, 0x22, 0xb9, 0x7a,
-	0x1f, 0xfa, 0x22, 0x52, 0x95, 0xeb, 0x08, 0x43, 0xee, 0x7a, 0x71, 0x55, 0x09, 0xa5, 0xa5, 0xe1,
-	0xfc, 0x6c, 0x40, 0x5b, 0x83, 0x88, 0x5d, 0x6e, 0x44, 0x75, 0x4d, 0xc3, 0x5d, 0x5b, 0xe4, 0xb6,
-	0x76, 0x94, 0xcb, 0x71, 0x5b, 0x2f, 0x47, 0x7c, 0xf6, 0x9a, 0x05, 0x8f, 0x3c, 0xbd, 0x25, 0x07,
-	0xd0, 0x95, 0x82, 0x8d, 0xf9, 0x57, 0xbe, 0x57, 0xcc, 0x5a, 0x39, 0x18, 0xe8, 0x3e, 0xf6, 0xc8,
-	0x87, 0xd0, 0x15, 0x45, 0x3b, 0xc5, 0xd2, 0xdc, 0xba, 0xb2, 0x34, 0xef, 0x44, 0x33, 0xf7, 0xc6,
-	0x22, 0xb7, 0x97, 0x48, 0xba, 0xb4, 0x3e, 0x6e, 0x76, 0x1b, 0x1b, 0x4d, 0xe7, 0x2f, 0x03, 0x3a,
-	0xc5, 0xda, 0x20, 0xb7, 0xe0, 0x15, 0x94, 0xe9, 0xd0, 0x4f, 0xd9, 0x28, 0xe0, 0x1e, 0xf2, 0xee,
-	0xd2, 0xcb, 0x4e, 0xf2, 0x26, 0x6c, 0x9c, 0x4c, 0x99, 0xf0, 0xfc, 0x68, 0xb2, 0x04, 0xd6, 0x11,
-	0x78, 0xc5, 0x4f, 0x06, 0xd0, 0x3b, 0x8d, 0x25, 0x0b, 0x30, 0x90, 0xe2, 0x3b, 0x6b, 0xd1, 0xaa,
-	0x8b, 0x1c, 0xc0, 0x56, 0xb1, 0x25, 0x4f, 0x92, 0xc0, 0x97, 0xcb, 0x8a, 0x4d, 0xac, 0x78, 0x6d,
-	0xec, 0xc5, 0x9c, 0xe3, 0x48, 0x72, 0xf1, 0x98, 0x05, 0xc5, 0x86, 0xbb, 0x36, 0xe6, 0xbc, 0x05,
-	0x2d, 0x5c, 0x6d, 0xc4, 0x81, 0x1b, 0x78, 0xbf, 0x5a, 0xca, 0x3e, 0xd7, 0x6b, 0xa6, 0x45, 0x2f,
-	0xf9, 0xdc, 0xa3, 0xb3, 0x73, 0xab, 0xf6, 0xec, 0xdc, 0xaa, 0x3d, 0x3f, 0xb7, 0x8c, 0x6f, 0xe7,
-	0x96, 0xf1, 0xd3, 0xdc, 0x32, 0x9e, 0xce, 0x2d, 0xe3, 0x6c, 0x6e, 0x19, 0x7f, 0xce, 0x2d, 0xe3,
-	0xef, 0xb9, 0x55, 0x7b, 0x3e, 0xb7, 0x8c, 0xef, 0x2f, 0xac, 0xda, 0xd9, 0x85, 0x55, 0x7b, 0x76,
-	0x61, 0xd5, 0xbe, 0x5c, 0xc7, 0x31, 0x09, 0x7d, 0xcf, 0x0b, 0xf8, 0x37, 0x4c, 0xf0, 0x51, 0x1b,
-	0xbf, 0xc3, 0xed, 0x7f, 0x02, 0x00, 0x00, 0xff, 0xff, 0x35, 0xce, 0x26, 0x85, 0x03, 0x08, 0x00,
-	0x00,
+	// 1016 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xcb, 0x6e, 0x23, 0x45,
+	0x17, 0x76, 0xfb, 0x9e, 0xe3, 0xfc, 0x4e, 0xfe, 0x4a, 0x04, 0x9d, 0xa0, 0xe9, 0xb6, 0x5a, 0xb3,
+	0x08, 0x97, 0x38, 0xe0, 0x11, 0x1b, 0x24, 0x10, 0xd3, 0x93, 0x48, 0x13, 0x84, 0x60, 0xa8, 0x44,
+	0x20, 0xb1, 0x41, 0x65, 0x77, 0x8d, 0xdd, 0x4c, 0xdf, 0xa6, 0xba, 0x3c, 0x33, 0xde, 0x21, 0x9e,
+	0x80, 0x25, 0x8f, 0xc0, 0x82, 0x35, 0x2b, 0x1e, 0x60, 0x96, 0x61, 0x37, 0xb0, 0x68, 0x88, 0x23,
+	0x24, 0xe4, 0xd5, 0x3c, 0x02, 0xaa, 0x53, 0xdd, 0x76, 0x67, 0x12, 0xc4, 0xb0, 0xb1, 0xab, 0xce,
+	0xf9, 0xce, 0xed, 0xab, 0xd3, 0x1f, 0x74, 0xc2, 0xd8, 0xe3, 0x41, 0x3f, 0x11, 0xb1, 0x8c, 0x09,
+	0x3c, 0x9c, 0x72, 0x31, 0x13, 0x2c, 0x1a, 0xf3, 0xdd, 0xfd, 0xb1, 0x2f, 0x27, 0xd3, 0x61, 0x7f,
+	0x14, 0x87, 0x07, 0xe3, 0x78, 0x1c, 0x1f, 0x20, 0x64, 0x38, 0xbd, 0x8f, 0x37, 0xbc, 0xe0, 0x49,
+	0x87, 0xee, 0x5a, 0xe3, 0x38, 0x1e, 0x07, 0x7c, 0x85, 0xf2, 0xa6, 0x82, 0x49, 0x3f, 0x8e, 0x72,
+	0xff, 0xdb, 0xe5, 0x74, 0x82, 0xdd, 0x67, 0x11, 0x3b, 0x08, 0xfd, 0xd0, 0x17, 0x07, 0xc9, 0x83,
+	0xb1, 0x3e, 0x25, 0x43, 0xfd, 0x9f, 0x47, 0xec, 0xbc, 0x98, 0x91, 0x45, 0x33, 0xed, 0x72, 0x7e,
+	0xaa, 0xc2, 0x6b, 0xf7, 0x44, 0x1c, 0x72, 0x39, 0xe1, 0xd3, 0x94, 0xaa, 0x7e, 0x3f, 0x53, 0x9d,
+	0x53, 0xfe, 0x70, 0xca, 0x53, 0x49, 0x08, 0xd4, 0x13, 0x26, 0x27, 0xa6, 0xd1, 0x33, 0xf6, 0xd6,
+	0x28, 0x9e, 0xc9, 0x36, 0x34, 0x52, 0xc9, 0x84, 0x34, 0xab, 0x3d, 0x63, 0xaf, 0x46, 0xf5, 0x85,
+	0x6c, 0x42, 0x8d, 0x47, 0x9e, 0x59, 0x43, 0x9b, 0x3a, 0xaa, 0xd8, 0x54, 0xf2, 0xc4, 0xac, 0xa3,
+	0x09, 0xcf, 0xe4, 0x7d, 0x68, 0x49, 0x3f, 0xe4, 0xf1, 0x54, 0x9a, 0x8d, 0x9e, 0xb1, 0xd7, 0x19,
+	0xec, 0xf4, 0x75, 0x73, 0xfd, 0xa2, 0xb9, 0xfe, 0x61, 0x3e, 0xae, 0xdb, 0x7e, 0x9a, 0xd9, 0x95,
+	0xef, 0x7f, 0xb7, 0x0d, 0x5a, 0xc4, 0xa8, 0xd2, 0x48, 0xac, 0xd9, 0xc4, 0x7e, 0xf4, 0x85, 0xdc,
+	0x82, 0x56, 0x9c, 0xa8, 0x90, 0xd4, 0x6c, 0x61, 0xd2, 0xad, 0xfe, 0x8a, 0xfe, 0xfe, 0xa7, 0xda,
+	0xe5, 0xd6, 0x55, 0x3a, 0x5a, 0x20, 0x49, 0x17, 0xaa, 0xbe, 0x67, 0xb6, 0xb1, 0xb7, 0xaa, 0xef,
+	0x91, 0x7d, 0x68, 0x4c, 0xfc, 0x48, 0xa6, 0xe6, 0x1a, 0xa6, 0xf8, 0x7f, 0x39, 0xc5, 0x5d, 0xe5,
+	0xc0, 0x04, 0x06, 0xd5, 0x28, 0xe7, 0x17, 0x03, 0x6e, 0xac, 0x88, 0x3b, 0x8e, 0x52, 0xc9, 0x22,
+	0xf9, 0xaf, 0xd4, 0x11, 0xa8, 0xab, 0x51, 0x72, 0xe6, 0xf0, 0xbc, 0x9a, 0xa9, 0xf6, 0x0f, 0x33,
+	0xd5, 0xff, 0xe3, 0x4c, 0x8d, 0xab, 0x33, 0x35, 0x5f, 0x6a, 0xa6, 0x53, 0x30, 0x4b, 0xbb, 0xc0,
+	0xd3, 0x24, 0x8e, 0x52, 0x7e, 0x97, 0x33, 0x8f, 0x0b, 0xb2, 0x03, 0xf5, 0x4f, 0x58, 0xc8, 0xf5,
+	0x34, 0x6e, 0x63, 0x91, 0xd9, 0xc6, 0x3e, 0x45, 0x13, 0xb9, 0x01, 0xcd, 0xcf, 0x59, 0x30, 0xe5,
+	0xa9, 0x59, 0xed, 0xd5, 0x56, 0xce, 0xdc, 0xe8, 0xfc, 0x5a, 0x05, 0x72, 0x35, 0x2d, 0x71, 0xa0,
+	0x79, 0x22, 0x99, 0x9c, 0xa6, 0x79, 0x4a, 0x58, 0x64, 0x76, 0x33, 0x45, 0x0b, 0xcd, 0x3d, 0xc4,
+	0x85, 0xfa, 0x21, 0x93, 0x0c, 0xe9, 0xea, 0x0c, 0x76, 0xcb, 0xed, 0xaf, 0x32, 0x2a, 0x84, 0x4b,
+	0x16, 0x99, 0xdd, 0xf5, 0x98, 0x64, 0x6f, 0xc5, 0xa1, 0x2f, 0x79, 0x98, 0xc8, 0x19, 0xc5, 0x58,
+	0xf2, 0x2e, 0xac, 0x1d, 0x09, 0x11, 0x8b, 0xd3, 0x59, 0xc2, 0x35, 0xc5, 0xee, 0xab, 0x8b, 0xcc,
+	0xde, 0xe2, 0x85, 0xb1, 0x14, 0xb1, 0x42, 0x92, 0xd7, 0xa1, 0x81, 0x17, 0x64, 0x7f, 0xcd, 0xdd,
+	0x5a, 0x64, 0xf6, 0x06, 0x86, 0x94, 0xe0, 0x1a, 0x41, 0x8e, 0xa0, 0xa5, 0x49, 0x4a, 0xcd, 0x46,
+	0xaf, 0xb6, 0xd7, 0x19, 0xdc, 0xbc, 0xbe, 0xd1, 0xcb, 0x8c, 0x16, 0x34, 0x15, 0xb1, 0x64, 0x00,
+	0xed, 0x2f, 0x98, 0x88, 0xfc, 0x68, 0xac, 0xde, 0x4b, 0x11, 0xf9, 0xca, 0x22, 0xb3, 0xc9, 0xe3,
+	0xdc, 0x56, 0xaa, 0xbb, 0xc4, 0x39, 0xdf, 0x1a, 0xd0, 0xbd, 0xcc, 0x04, 0xe9, 0x03, 0x50, 0x9e,
+	0x4e, 0x03, 0x89, 0x03, 0x6b, 0x6e, 0xbb, 0x8b, 0xcc, 0x06, 0xb1, 0xb4, 0xd2, 0x12, 0x82, 0x7c,
+	0x08, 0x4d, 0x7d, 0xc3, 0xd7, 0xeb, 0x0c, 0xcc, 0x72, 0xf3, 0x27, 0x2c, 0x4c, 0x02, 0x7e, 0x22,
+	0x05, 0x67, 0xa1, 0xdb, 0x55, 0xcb, 0xa6, 0x5e, 0x49, 0x67, 0xa2, 0x79, 0x9c, 0xf3, 0xb3, 0x01,
+	0xeb, 0x65, 0x20, 0x49, 0xa0, 0x19, 0xb0, 0x21, 0x0f, 0xd4, 0xd3, 0xd6, 0x70, 0x75, 0x47, 0xb1,
+	0x90, 0xfc, 0x49, 0x32, 0xec, 0x7f, 0xac, 0xec, 0xf7, 0x98, 0x2f, 0xdc, 0x3b, 0x2a, 0xdb, 0x6f,
+	0x99, 0xfd, 0xce, 0xcb, 0xc8, 0x99, 0x8e, 0xbb, 0xed, 0xb1, 0x44, 0x72, 0xa1, 0x5a, 0x08, 0xb9,
+	0x14, 0xfe, 0x88, 0xe6, 0x75, 0xc8, 0x7b, 0xd0, 0x4a, 0xb1, 0x83, 0x34, 0x9f, 0x62, 0x73, 0x55,
+	0x52, 0xb7, 0xb6, 0xea, 0xfe, 0x11, 0xae, 0x25, 0x2d, 0x02, 0x9c, 0xaf, 0xa1, 0x7b, 0x87, 0x8d,
+	0x26, 0xdc, 0x5b, 0xae, 0xe6, 0x0e, 0xd4, 0x1e, 0xf0, 0x59, 0xce, 0x5d, 0x6b, 0x91, 0xd9, 0xea,
+	0x4a, 0xd5, 0x8f, 0xd2, 0x2f, 0xfe, 0x44, 0x72, 0xf5, 0x4d, 0xe9, 0x42, 0xa4, 0x4c, 0xd7, 0x11,
+	0xba, 0xdc, 0x8d, 0xbc, 0x54, 0x01, 0xa5, 0xc5, 0xc1, 0xf9, 0xd1, 0x80, 0xa6, 0x06, 0x11, 0xbb,
+	0x50, 0x51, 0x55, 0xa6, 0xe6, 0xae, 0x2d, 0x32, 0x5b, 0x1b, 0x0a, 0x41, 0xdd, 0xd1, 0x82, 0x8a,
+	0x52, 0xa1, 0xbb, 0xe0, 0x91, 0xa7, 0x95, 0xb5, 0x07, 0x6d, 0x29, 0xd8, 0x88, 0x7f, 0xe5, 0x7b,
+	0xf9, 0x7e, 0x16, 0xcb, 0x84, 0xe6, 0x63, 0x8f, 0x7c, 0x00, 0x6d, 0x91, 0x8f, 0x93, 0x0b, 0xed,
+	0xf6, 0x15, 0xa1, 0xbd, 0x1d, 0xcd, 0xdc, 0xf5, 0x45, 0x66, 0x2f, 0x91, 0x74, 0x79, 0xfa, 0xa8,
+	0xde, 0xae, 0x6d, 0xd6, 0x9d, 0x3f, 0x0d, 0x68, 0xe5, 0x52, 0x43, 0x6e, 0xc2, 0xff, 0x90, 0xa6,
+	0x43, 0x3f, 0x65, 0xc3, 0x80, 0x7b, 0xd8, 0x77, 0x9b, 0x5e, 0x36, 0x92, 0x37, 0x60, 0xf3, 0x64,
+	0xc2, 0x84, 0xe7, 0x47, 0xe3, 0x25, 0xb0, 0x8a, 0xc0, 0x2b, 0x76, 0xd2, 0x83, 0xce, 0x69, 0x2c,
+	0x59, 0x80, 0x8e, 0x14, 0xbf, 0xcd, 0x06, 0x2d, 0x9b, 0xc8, 0x00, 0xb6, 0x73, 0x65, 0x3d, 0x49,
+	0x02, 0x5f, 0x2e, 0x33, 0xd6, 0x31, 0xe3, 0xb5, 0xbe, 0x17, 0x63, 0x8e, 0x23, 0xc9, 0xc5, 0x23,
+	0x16, 0xe4, 0xaa, 0x78, 0xad, 0xcf, 0x79, 0x13, 0x1a, 0x28, 0x87, 0xc4, 0x81, 0x75, 0xac, 0xaf,
+	0x84, 0xdc, 0xe7, 0x5a, 0x9a, 0x1a, 0xf4, 0x92, 0xcd, 0x3d, 0x3a, 0x3b, 0xb7, 0x2a, 0xcf, 0xce,
+	0xad, 0xca, 0xf3, 0x73, 0xcb, 0xf8, 0x66, 0x6e, 0x19, 0x3f, 0xcc, 0x2d, 0xe3, 0xe9, 0xdc, 0x32,
+	0xce, 0xe6, 0x96, 0xf1, 0xc7, 0xdc, 0x32, 0xfe, 0x9a, 0x5b, 0x95, 0xe7, 0x73, 0xcb, 0xf8, 0xee,
+	0xc2, 0xaa, 0x9c, 0x5d, 0x58, 0x95, 0x67, 0x17, 0x56, 0xe5, 0xcb, 0x0d, 0x5c, 0x93, 0xd0, 0xf7,
+	0xbc, 0x80, 0x3f, 0x66, 0x82, 0x0f, 0x9b, 0xf8, 0x0e, 0xb7, 0xfe, 0x0e, 0x00, 0x00, 0xff, 0xff,
+	0x3e, 0xf8, 0xba, 0x74, 0x37, 0x08, 0x00, 0x00,
 }
 
 func (this *PrometheusRangeQueryRequest) Equal(that interface{}) bool {
@@ -930,6 +939,14 @@ func (this *PrometheusResponse) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if len(this.Warnings) != len(that1.Warnings) {
+		return false
+	}
+	for i := range this.Warnings {
+		if this.Warnings[i] != that1.Warnings[i] {
+			return false
+		}
+	}
 	return true
 }
 func (this *PrometheusData) Equal(that interface{}) bool {
@@ -1178,7 +1195,7 @@ func (this *PrometheusResponse) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 9)
+	s := make([]string, 0, 10)
 	s = append(s, "&querymiddleware.PrometheusResponse{")
 	s = append(s, "Status: "+fmt.Sprintf("%#v", this.Status)+",\n")
 	if this.Data != nil {
@@ -1189,6 +1206,7 @@ func (this *PrometheusResponse) GoString() string {
 	if this.Headers != nil {
 		s = append(s, "Headers: "+fmt.Sprintf("%#v", this.Headers)+",\n")
 	}
+	s = append(s, "Warnings: "+fmt.Sprintf("%#v", this.Warnings)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1505,6 +1523,15 @@ func (m *PrometheusResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintModel(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
 	if len(m.Headers) > 0 {
 		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1961,6 +1988,12 @@ func (m *PrometheusResponse) Size() (n int) {
 			n += 1 + l + sovModel(uint64(l))
 		}
 	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovModel(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -2147,6 +2180,7 @@ func (this *PrometheusResponse) String() string {
 		`ErrorType:` + fmt.Sprintf("%v", this.ErrorType) + `,`,
 		`Error:` + fmt.Sprintf("%v", this.Error) + `,`,
 		`Headers:` + repeatedStringForHeaders + `,`,
+		`Warnings:` + fmt.Sprintf("%v", this.Warnings) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -3075,6 +3109,38 @@ func (m *PrometheusResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowModel
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthModel
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthModel
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipModel(dAtA[iNdEx:])
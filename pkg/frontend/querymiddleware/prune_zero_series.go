@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+type pruneZeroSeriesMiddleware struct {
+	next Handler
+
+	prunedSeries prometheus.Counter
+}
+
+// newPruneZeroSeriesMiddleware creates a new Middleware that removes from the query results the series whose
+// sample values are all zero or NaN, adding a warning to the response with the number of pruned series.
+// It must run before the query is split or sharded, so that only the final merged result is pruned: the
+// partial results of the split and sharded queries are required to compute it, and are cached unpruned.
+func newPruneZeroSeriesMiddleware(reg prometheus.Registerer) Middleware {
+	prunedSeries := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_pruned_series_total",
+		Help: "Total number of series removed from the query results because all their sample values are zero or NaN.",
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &pruneZeroSeriesMiddleware{
+			next:         next,
+			prunedSeries: prunedSeries,
+		}
+	})
+}
+
+func (m *pruneZeroSeriesMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	res, err := m.next.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	promRes, ok := res.(*PrometheusResponse)
+	if !ok || promRes.Data == nil || len(promRes.Data.Result) == 0 {
+		return res, nil
+	}
+
+	pruned, count := pruneZeroSeries(promRes)
+	if count > 0 {
+		m.prunedSeries.Add(float64(count))
+	}
+	return pruned, nil
+}
+
+// pruneZeroSeries returns a copy of the input response without the series whose sample values are all zero
+// or NaN, and the number of pruned series. The input response is returned as is when no series is pruned.
+func pruneZeroSeries(res *PrometheusResponse) (*PrometheusResponse, int) {
+	kept := make([]SampleStream, 0, len(res.Data.Result))
+	for _, s := range res.Data.Result {
+		if isZeroOrNaNSeries(s.Samples) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+
+	count := len(res.Data.Result) - len(kept)
+	if count == 0 {
+		return res, 0
+	}
+
+	data := *res.Data
+	data.Result = kept
+
+	pruned := *res
+	pruned.Data = &data
+	pruned.Warnings = append(append([]string(nil), res.Warnings...), fmt.Sprintf("%d series have been removed from the result because all their sample values are zero or NaN", count))
+
+	return &pruned, count
+}
+
+// isZeroOrNaNSeries returns true if the input samples are not empty and all their values are zero or NaN.
+func isZeroOrNaNSeries(samples []mimirpb.Sample) bool {
+	if len(samples) == 0 {
+		return false
+	}
+	for _, s := range samples {
+		if s.Value != 0 && !math.IsNaN(s.Value) {
+			return false
+		}
+	}
+	return true
+}
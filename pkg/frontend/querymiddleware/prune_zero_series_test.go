@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestPruneZeroSeriesMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		response         *PrometheusResponse
+		expectedResult   []SampleStream
+		expectedWarnings []string
+		expectedPruned   int
+	}{
+		"should prune all-zero and all-NaN series from a matrix": {
+			response: &PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: "matrix", Result: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "1"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 0}, {TimestampMs: 2, Value: 0}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "2"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 0}, {TimestampMs: 2, Value: 1}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "3"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: math.NaN()}, {TimestampMs: 2, Value: 0}}},
+			}}},
+			expectedResult: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "2"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 0}, {TimestampMs: 2, Value: 1}}},
+			},
+			expectedWarnings: []string{"2 series have been removed from the result because all their sample values are zero or NaN"},
+			expectedPruned:   2,
+		},
+		"should keep the existing warnings": {
+			response: &PrometheusResponse{Status: statusSuccess, Warnings: []string{"existing"}, Data: &PrometheusData{ResultType: "vector", Result: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "1"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 0}}},
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "2"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 2}}},
+			}}},
+			expectedResult: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "2"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 2}}},
+			},
+			expectedWarnings: []string{"existing", "1 series have been removed from the result because all their sample values are zero or NaN"},
+			expectedPruned:   1,
+		},
+		"should not add a warning if no series has been pruned": {
+			response: &PrometheusResponse{Status: statusSuccess, Data: &PrometheusData{ResultType: "matrix", Result: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "1"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 1}}},
+			}}},
+			expectedResult: []SampleStream{
+				{Labels: []mimirpb.LabelAdapter{{Name: "series", Value: "1"}}, Samples: []mimirpb.Sample{{TimestampMs: 1, Value: 1}}},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			m := newPruneZeroSeriesMiddleware(prometheus.NewPedanticRegistry()).Wrap(mockHandlerWith(testData.response, nil)).(*pruneZeroSeriesMiddleware)
+			res, err := m.Do(context.Background(), &PrometheusRangeQueryRequest{Query: "metric"})
+			require.NoError(t, err)
+
+			promRes := res.(*PrometheusResponse)
+			assert.Equal(t, testData.expectedResult, promRes.Data.Result)
+			assert.Equal(t, testData.expectedWarnings, promRes.Warnings)
+			assert.Equal(t, float64(testData.expectedPruned), testutil.ToFloat64(m.prunedSeries))
+		})
+	}
+}
+
+func TestPruneZeroSeriesMiddleware_ShouldPruneOnlyTheMergedResultOfShardedQueries(t *testing.T) {
+	const shards = 4
+
+	var (
+		from = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		step = 30 * time.Second
+		to   = from.Add(10 * step)
+	)
+
+	// Each series ends up in a different shard. Pruning the zero partial result of a shard would change the
+	// merged result of the queries below, while the merged result itself may be zero and should be pruned.
+	labelsForShard := labelsForShardsGenerator(labels.FromStrings(labels.MetricName, "metric"), shards)
+	storageSeries := []*promql.StorageSeries{
+		newSeries(labelsForShard(0), from, to, step, constant(0)),
+		newSeries(labelsForShard(1), from, to, step, constant(5)),
+		newSeries(labelsForShard(2), from, to, step, constant(-5)),
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	pruning := newPruneZeroSeriesMiddleware(reg)
+	sharding := newQueryShardingMiddleware(log.NewNopLogger(), newEngine(), mockLimits{totalShards: shards}, prometheus.NewPedanticRegistry())
+	downstream := &downstreamHandler{engine: newEngine(), queryable: storageSeriesQueryable(storageSeries)}
+
+	tests := map[string]struct {
+		query        string
+		expectPruned bool
+	}{
+		"max() whose merged result is the zero partial result of a shard": {query: `max(metric <= 0)`, expectPruned: true},
+		"min() whose merged result is the zero partial result of a shard": {query: `min(metric >= 0)`, expectPruned: true},
+		"max() with a zero partial result of a shard":                     {query: `max(metric)`},
+		"sum() which is zero only once merged":                            {query: `sum(metric)`, expectPruned: true},
+		"count() which is never zero":                                     {query: `count(metric)`},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req := &PrometheusRangeQueryRequest{
+				Path:  "/query_range",
+				Start: from.UnixMilli(),
+				End:   to.UnixMilli(),
+				Step:  step.Milliseconds(),
+				Query: testData.query,
+			}
+			ctx := user.InjectOrgID(context.Background(), "test")
+
+			// The expected result is the one of the query run without sharding, pruned.
+			unshardedRes, err := downstream.Do(ctx, req)
+			require.NoError(t, err)
+			expected, prunedCount := pruneZeroSeries(unshardedRes.(*PrometheusResponse))
+			assert.Equal(t, testData.expectPruned, prunedCount > 0)
+
+			shardedRes, err := MergeMiddlewares(pruning, sharding).Wrap(downstream).Do(ctx, req)
+			require.NoError(t, err)
+
+			actual := shardedRes.(*PrometheusResponse)
+			approximatelyEquals(t, expected, actual)
+			assert.Equal(t, expected.Warnings, actual.Warnings)
+		})
+	}
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_pruned_series_total Total number of series removed from the query results because all their sample values are zero or NaN.
+		# TYPE cortex_query_frontend_pruned_series_total counter
+		cortex_query_frontend_pruned_series_total 3
+	`), "cortex_query_frontend_pruned_series_total"))
+}
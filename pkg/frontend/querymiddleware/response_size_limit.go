@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// truncatedResponseHeader is the response header set when the response has been truncated
+// because it exceeded the max response body size.
+const truncatedResponseHeader = "X-Mimir-Truncated"
+
+type responseSizeLimitMiddleware struct {
+	Limits
+	next   Handler
+	logger log.Logger
+
+	truncatedResponses prometheus.Counter
+}
+
+// newResponseSizeLimitMiddleware creates a new Middleware that truncates the responses whose
+// JSON-encoded body exceeds the max response body size, by omitting series from the result.
+func newResponseSizeLimitMiddleware(l Limits, logger log.Logger, reg prometheus.Registerer) Middleware {
+	truncatedResponses := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_truncated_responses_total",
+		Help: "Total number of query responses truncated because they exceeded the max response body size.",
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &responseSizeLimitMiddleware{
+			Limits:             l,
+			next:               next,
+			logger:             logger,
+			truncatedResponses: truncatedResponses,
+		}
+	})
+}
+
+func (m *responseSizeLimitMiddleware) Do(ctx context.Context, req Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, apierror.New(apierror.TypeBadData, err.Error())
+	}
+
+	res, err := m.next.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBytes := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, m.MaxResponseBodyBytes)
+	if maxBytes <= 0 {
+		return res, nil
+	}
+
+	promRes, ok := res.(*PrometheusResponse)
+	if !ok || promRes.Data == nil || len(promRes.Data.Result) == 0 {
+		return res, nil
+	}
+
+	truncated, omitted, err := truncateResponse(promRes, maxBytes)
+	if err != nil {
+		return nil, apierror.Newf(apierror.TypeInternal, "error encoding response: %v", err)
+	}
+	if omitted == 0 {
+		return res, nil
+	}
+
+	m.truncatedResponses.Inc()
+
+	spanLog := spanlogger.FromContext(ctx, m.logger)
+	level.Debug(spanLog).Log("msg", "the query response has been truncated because it exceeded the max response body size", "max_bytes", maxBytes, "omitted_series", omitted, "total_series", len(promRes.Data.Result))
+
+	return truncated, nil
+}
+
+// truncateResponse returns a copy of the input response keeping as many series as possible so that
+// its JSON-encoded body doesn't exceed maxBytes, and the number of omitted series. The input
+// response is returned as is when it doesn't exceed the limit. Each series is encoded at most once,
+// and the series after the one exceeding the limit are not encoded at all.
+func truncateResponse(res *PrometheusResponse, maxBytes int) (*PrometheusResponse, int, error) {
+	series := res.Data.Result
+
+	// Compute the size of the response without any series, both as is and once truncated. The warning
+	// is built with the max number of omitted series, so that the actual warning can't be longer than
+	// the estimated one.
+	data := *res.Data
+	data.Result = []SampleStream{}
+
+	truncated := *res
+	truncated.Data = &data
+
+	encoded, err := json.Marshal(&truncated)
+	if err != nil {
+		return nil, 0, err
+	}
+	budget := maxBytes - len(encoded)
+
+	truncated.Warnings = append(append([]string(nil), res.Warnings...), truncatedResponseWarning(maxBytes, len(series)))
+	encoded, err = json.Marshal(&truncated)
+	if err != nil {
+		return nil, 0, err
+	}
+	truncatedBudget := maxBytes - len(encoded)
+
+	// Add up the size of the series, preserving their order, until the response exceeds the limit. The
+	// series kept in the truncated response are the ones fitting in the budget left by the warning.
+	size, kept := 0, 0
+	for i := range series {
+		encoded, err = json.Marshal(&series[i])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size += len(encoded)
+		if i > 0 {
+			// Account for the separator between series.
+			size++
+		}
+		if size > budget {
+			break
+		}
+		if size <= truncatedBudget {
+			kept = i + 1
+		}
+	}
+
+	if size <= budget {
+		return res, 0, nil
+	}
+
+	omitted := len(series) - kept
+	data.Result = series[:kept]
+	truncated.Warnings[len(truncated.Warnings)-1] = truncatedResponseWarning(maxBytes, omitted)
+	truncated.Headers = append(append([]*PrometheusResponseHeader(nil), res.Headers...), &PrometheusResponseHeader{
+		Name:   truncatedResponseHeader,
+		Values: []string{"true"},
+	})
+
+	return &truncated, omitted, nil
+}
+
+func truncatedResponseWarning(maxBytes, omittedSeries int) string {
+	return fmt.Sprintf("the response has been truncated because it exceeded the max response body size of %d bytes: %d series have been omitted", maxBytes, omittedSeries)
+}
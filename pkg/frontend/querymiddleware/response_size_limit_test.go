@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestResponseSizeLimitMiddleware(t *testing.T) {
+	const numSeries = 10
+
+	newResponse := func() *PrometheusResponse {
+		res := &PrometheusResponse{
+			Status: statusSuccess,
+			Data: &PrometheusData{
+				ResultType: model.ValMatrix.String(),
+			},
+		}
+		for i := 0; i < numSeries; i++ {
+			res.Data.Result = append(res.Data.Result, SampleStream{
+				Labels:  []mimirpb.LabelAdapter{{Name: "series", Value: fmt.Sprintf("%d", i)}},
+				Samples: []mimirpb.Sample{{TimestampMs: 1000, Value: float64(i)}},
+			})
+		}
+		return res
+	}
+
+	encoded, err := json.Marshal(newResponse())
+	require.NoError(t, err)
+	fullSize := len(encoded)
+
+	tests := map[string]struct {
+		maxBytes              int
+		expectedTruncated     bool
+		expectedMinSeriesKept int
+	}{
+		"limit disabled": {
+			maxBytes: 0,
+		},
+		"response smaller than the limit": {
+			maxBytes: fullSize + 1,
+		},
+		"response equal to the limit": {
+			maxBytes: fullSize,
+		},
+		"response larger than the limit": {
+			maxBytes:              fullSize - 1,
+			expectedTruncated:     true,
+			expectedMinSeriesKept: 1,
+		},
+		"limit smaller than a response without series": {
+			maxBytes:          10,
+			expectedTruncated: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			middleware := newResponseSizeLimitMiddleware(mockLimits{maxResponseBodyBytes: testData.maxBytes}, log.NewNopLogger(), reg)
+
+			input := newResponse()
+			handler := middleware.Wrap(HandlerFunc(func(context.Context, Request) (Response, error) {
+				return input, nil
+			}))
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			res, err := handler.Do(ctx, &PrometheusRangeQueryRequest{})
+			require.NoError(t, err)
+
+			// The input response should never be modified.
+			assert.Equal(t, newResponse(), input)
+
+			if !testData.expectedTruncated {
+				assert.Same(t, input, res)
+				assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+					# HELP cortex_query_frontend_truncated_responses_total Total number of query responses truncated because they exceeded the max response body size.
+					# TYPE cortex_query_frontend_truncated_responses_total counter
+					cortex_query_frontend_truncated_responses_total 0
+				`)))
+				return
+			}
+
+			truncated := res.(*PrometheusResponse)
+			kept := len(truncated.Data.Result)
+			assert.GreaterOrEqual(t, kept, testData.expectedMinSeriesKept)
+			assert.Less(t, kept, numSeries)
+			assert.Equal(t, input.Data.Result[:kept], truncated.Data.Result)
+			assert.Equal(t, []string{truncatedResponseWarning(testData.maxBytes, numSeries-kept)}, truncated.Warnings)
+			assert.Equal(t, []string{"true"}, getHeaderValuesWithName(truncated, truncatedResponseHeader))
+
+			// The encoded response should honor the limit, unless no series have been kept.
+			httpRes, err := prometheusCodec{}.EncodeResponse(ctx, nil, truncated)
+			require.NoError(t, err)
+			assert.Equal(t, "true", httpRes.Header.Get(truncatedResponseHeader))
+
+			body, err := io.ReadAll(httpRes.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), fmt.Sprintf(`"warnings":["the response has been truncated because it exceeded the max response body size of %d bytes: %d series have been omitted"]`, testData.maxBytes, numSeries-kept))
+			if kept > 0 {
+				assert.LessOrEqual(t, len(body), testData.maxBytes)
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_query_frontend_truncated_responses_total Total number of query responses truncated because they exceeded the max response body size.
+				# TYPE cortex_query_frontend_truncated_responses_total counter
+				cortex_query_frontend_truncated_responses_total 1
+			`)))
+		})
+	}
+}
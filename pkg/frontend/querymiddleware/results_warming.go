@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/user"
+)
+
+const (
+	// warmingLeadTime is how long before the next expected arrival of a recurring query its results are warmed.
+	warmingLeadTime = 10 * time.Second
+
+	// warmingCheckInterval is how frequently the recurring queries are checked to find the ones to warm.
+	warmingCheckInterval = time.Second
+
+	// warmingIntervalTolerance is the max relative deviation of the interval between two consecutive
+	// arrivals of a query from the average interval, for the query to be considered recurring.
+	warmingIntervalTolerance = 0.1
+
+	// warmingMaxIdlePeriod is how long a query which is not recurring is tracked since its last arrival.
+	warmingMaxIdlePeriod = time.Hour
+
+	// warmingMaxTrackedQueries is the max number of distinct queries tracked. Once reached, new queries are not tracked.
+	warmingMaxTrackedQueries = 10000
+
+	// warmingConcurrency is the max number of queries warmed concurrently.
+	warmingConcurrency = 4
+)
+
+// recurringQueryKey identifies a query pattern: the same query run by the same tenant with the same step
+// and time range length, but over a moving time range (e.g. a dashboard panel refreshed periodically).
+type recurringQueryKey struct {
+	tenantID string
+	query    string
+	step     int64
+	rangeMs  int64
+}
+
+type recurringQuery struct {
+	// lastRequest is the last received request of the query.
+	lastRequest Request
+
+	// arrivals holds the time of the most recent arrivals of the query, oldest first.
+	arrivals []time.Time
+
+	// warmedFor is the expected arrival time for which the query has been warmed last.
+	warmedFor time.Time
+}
+
+// expectedInterval returns the expected interval between two arrivals of the query, and whether
+// the query is recurring, that is it has arrived at least minOccurrences times at a regular interval.
+func (q *recurringQuery) expectedInterval(minOccurrences int) (time.Duration, bool) {
+	if len(q.arrivals) < minOccurrences {
+		return 0, false
+	}
+
+	avg := q.arrivals[len(q.arrivals)-1].Sub(q.arrivals[0]) / time.Duration(len(q.arrivals)-1)
+	if avg <= warmingLeadTime {
+		return 0, false
+	}
+
+	maxDeviation := time.Duration(float64(avg) * warmingIntervalTolerance)
+	for i := 1; i < len(q.arrivals); i++ {
+		deviation := q.arrivals[i].Sub(q.arrivals[i-1]) - avg
+		if deviation < -maxDeviation || deviation > maxDeviation {
+			return 0, false
+		}
+	}
+
+	return avg, true
+}
+
+type resultsWarmingMetrics struct {
+	trackedQueries prometheus.Gauge
+	warmedQueries  prometheus.Counter
+	failedQueries  prometheus.Counter
+}
+
+func newResultsWarmingMetrics(reg prometheus.Registerer) *resultsWarmingMetrics {
+	return &resultsWarmingMetrics{
+		trackedQueries: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_warming_tracked_queries",
+			Help: "Number of distinct queries tracked to find the recurring ones whose results are proactively warmed.",
+		}),
+		warmedQueries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_warming_queries_total",
+			Help: "Total number of recurring queries run ahead of their expected arrival to warm the results cache.",
+		}),
+		failedQueries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_warming_queries_failed_total",
+			Help: "Total number of recurring queries run ahead of their expected arrival to warm the results cache which failed.",
+		}),
+	}
+}
+
+// resultsWarmer tracks the range queries received from recent traffic, finds the ones recurring at a regular
+// interval (e.g. dashboards refreshed periodically) and runs them shortly before their next expected arrival,
+// so that the results cache is already populated when the actual query is received.
+//
+// A single resultsWarmer is shared by all the requests: it's used as Middleware to track the received queries,
+// while the warming queries are run by the service against the long-lived handler set with setHandler.
+type resultsWarmer struct {
+	services.Service
+
+	minOccurrences int
+	logger         log.Logger
+	metrics        *resultsWarmingMetrics
+
+	handlerMx sync.RWMutex
+	handler   Handler
+
+	queriesMx sync.Mutex
+	queries   map[recurringQueryKey]*recurringQuery
+}
+
+func newResultsWarmer(minOccurrences int, logger log.Logger, reg prometheus.Registerer) *resultsWarmer {
+	w := &resultsWarmer{
+		minOccurrences: minOccurrences,
+		logger:         logger,
+		metrics:        newResultsWarmingMetrics(reg),
+		queries:        map[recurringQueryKey]*recurringQuery{},
+	}
+
+	w.Service = services.NewTimerService(warmingCheckInterval, nil, w.iteration, nil)
+	return w
+}
+
+// setHandler sets the handler the warming queries are run against, which is expected to populate the results cache.
+func (w *resultsWarmer) setHandler(handler Handler) {
+	w.handlerMx.Lock()
+	defer w.handlerMx.Unlock()
+	w.handler = handler
+}
+
+func (w *resultsWarmer) getHandler() Handler {
+	w.handlerMx.RLock()
+	defer w.handlerMx.RUnlock()
+	return w.handler
+}
+
+// Wrap implements Middleware. The returned handler tracks the received queries and forwards them to next.
+func (w *resultsWarmer) Wrap(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		if tenantIDs, err := tenant.TenantIDs(ctx); err == nil && !req.GetOptions().CacheDisabled {
+			w.observe(tenant.JoinTenantIDs(tenantIDs), req, time.Now())
+		}
+
+		return next.Do(ctx, req)
+	})
+}
+
+// observe records the arrival of the input request.
+func (w *resultsWarmer) observe(tenantID string, req Request, now time.Time) {
+	key := recurringQueryKey{
+		tenantID: tenantID,
+		query:    req.GetQuery(),
+		step:     req.GetStep(),
+		rangeMs:  req.GetEnd() - req.GetStart(),
+	}
+
+	w.queriesMx.Lock()
+	defer w.queriesMx.Unlock()
+
+	q, ok := w.queries[key]
+	if !ok {
+		if len(w.queries) >= warmingMaxTrackedQueries {
+			return
+		}
+
+		q = &recurringQuery{}
+		w.queries[key] = q
+		w.metrics.trackedQueries.Set(float64(len(w.queries)))
+	}
+
+	q.lastRequest = req
+	q.arrivals = append(q.arrivals, now)
+
+	// Only the most recent arrivals are required to detect whether the query is recurring.
+	if len(q.arrivals) > w.minOccurrences {
+		q.arrivals = append(q.arrivals[:0], q.arrivals[len(q.arrivals)-w.minOccurrences:]...)
+	}
+}
+
+// dueRequests returns the requests to run to warm the results of the recurring queries expected to
+// arrive shortly, and stops tracking the queries which are not received anymore.
+func (w *resultsWarmer) dueRequests(now time.Time) (tenantIDs []string, reqs []Request) {
+	w.queriesMx.Lock()
+	defer w.queriesMx.Unlock()
+
+	for key, q := range w.queries {
+		last := q.arrivals[len(q.arrivals)-1]
+
+		interval, recurring := q.expectedInterval(w.minOccurrences)
+		if !recurring {
+			if now.Sub(last) > warmingMaxIdlePeriod {
+				delete(w.queries, key)
+			}
+			continue
+		}
+
+		// Stop tracking the query if it has missed two consecutive expected arrivals.
+		if now.Sub(last) > 2*interval {
+			delete(w.queries, key)
+			continue
+		}
+
+		next := last.Add(interval)
+		if now.Before(next.Add(-warmingLeadTime)) || !now.Before(next) || q.warmedFor.Equal(next) {
+			continue
+		}
+		q.warmedFor = next
+
+		tenantIDs = append(tenantIDs, key.tenantID)
+		reqs = append(reqs, nextRecurringRequest(q.lastRequest, interval))
+	}
+
+	w.metrics.trackedQueries.Set(float64(len(w.queries)))
+	return tenantIDs, reqs
+}
+
+// nextRecurringRequest returns the request expected to be received after the input interval,
+// given the last received request.
+func nextRecurringRequest(last Request, interval time.Duration) Request {
+	start := last.GetStart() + interval.Milliseconds()
+	end := last.GetEnd() + interval.Milliseconds()
+
+	// Keep the request step-aligned if the last one was, so that its results are cached the same way.
+	if step := last.GetStep(); step > 0 && isRequestStepAligned(last) {
+		start -= start % step
+		end -= end % step
+	}
+
+	return last.WithStartEnd(start, end)
+}
+
+func (w *resultsWarmer) iteration(ctx context.Context) error {
+	// The handler is set once the tripperware is applied to the downstream round tripper.
+	handler := w.getHandler()
+	if handler == nil {
+		return nil
+	}
+
+	tenantIDs, reqs := w.dueRequests(time.Now())
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	_ = concurrency.ForEachJob(ctx, len(reqs), warmingConcurrency, func(ctx context.Context, idx int) error {
+		w.metrics.warmedQueries.Inc()
+
+		if _, err := handler.Do(user.InjectOrgID(ctx, tenantIDs[idx]), reqs[idx]); err != nil {
+			w.metrics.failedQueries.Inc()
+			level.Warn(w.logger).Log("msg", "failed to warm the results of a recurring query", "user", tenantIDs[idx], "query", reqs[idx].GetQuery(), "err", err)
+		}
+
+		// Never fail, so that a failing query doesn't prevent warming the other ones.
+		return nil
+	})
+
+	return nil
+}
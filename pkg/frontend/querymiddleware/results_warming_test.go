@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestRecurringQuery_ExpectedInterval(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	arrivals := func(offsets ...time.Duration) []time.Time {
+		out := make([]time.Time, 0, len(offsets))
+		for _, offset := range offsets {
+			out = append(out, start.Add(offset))
+		}
+		return out
+	}
+
+	tests := map[string]struct {
+		arrivals          []time.Time
+		expectedInterval  time.Duration
+		expectedRecurring bool
+	}{
+		"less arrivals than min occurrences": {
+			arrivals: arrivals(0, time.Minute),
+		},
+		"regular interval": {
+			arrivals:          arrivals(0, time.Minute, 2*time.Minute),
+			expectedInterval:  time.Minute,
+			expectedRecurring: true,
+		},
+		"interval with a small jitter": {
+			arrivals:          arrivals(0, 62*time.Second, 2*time.Minute),
+			expectedInterval:  time.Minute,
+			expectedRecurring: true,
+		},
+		"irregular interval": {
+			arrivals: arrivals(0, 20*time.Second, 2*time.Minute),
+		},
+		"interval shorter than the warming lead time": {
+			arrivals: arrivals(0, 5*time.Second, 10*time.Second),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			q := &recurringQuery{arrivals: testData.arrivals}
+
+			interval, recurring := q.expectedInterval(3)
+			assert.Equal(t, testData.expectedRecurring, recurring)
+			assert.Equal(t, testData.expectedInterval, interval)
+		})
+	}
+}
+
+func TestNextRecurringRequest(t *testing.T) {
+	tests := map[string]struct {
+		last          *PrometheusRangeQueryRequest
+		interval      time.Duration
+		expectedStart int64
+		expectedEnd   int64
+	}{
+		"step-aligned request": {
+			last:          &PrometheusRangeQueryRequest{Start: 60_000, End: 120_000, Step: 30_000},
+			interval:      45 * time.Second,
+			expectedStart: 90_000,
+			expectedEnd:   150_000,
+		},
+		"non step-aligned request": {
+			last:          &PrometheusRangeQueryRequest{Start: 61_000, End: 121_000, Step: 30_000},
+			interval:      45 * time.Second,
+			expectedStart: 106_000,
+			expectedEnd:   166_000,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			next := nextRecurringRequest(testData.last, testData.interval)
+			assert.Equal(t, testData.expectedStart, next.GetStart())
+			assert.Equal(t, testData.expectedEnd, next.GetEnd())
+			assert.Equal(t, testData.last.GetStep(), next.GetStep())
+			assert.Equal(t, testData.last.GetQuery(), next.GetQuery())
+		})
+	}
+}
+
+func TestResultsWarmer(t *testing.T) {
+	var (
+		reg   = prometheus.NewPedanticRegistry()
+		start = time.Unix(1000, 0)
+
+		receivedMx sync.Mutex
+		received   []Request
+		receivedBy []string
+	)
+
+	next := HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		tenantID, err := tenant.TenantID(ctx)
+		require.NoError(t, err)
+
+		receivedMx.Lock()
+		defer receivedMx.Unlock()
+		received = append(received, req)
+		receivedBy = append(receivedBy, tenantID)
+
+		return newEmptyPrometheusResponse(), nil
+	})
+
+	w := newResultsWarmer(3, log.NewNopLogger(), reg)
+	w.setHandler(next)
+
+	recurring := &PrometheusRangeQueryRequest{Query: "up", Start: 0, End: 3_600_000, Step: 60_000}
+	other := &PrometheusRangeQueryRequest{Query: "sum(up)", Start: 0, End: 3_600_000, Step: 60_000}
+
+	// Receive the recurring query every minute, and another query only once.
+	for i := 0; i < 3; i++ {
+		w.observe("user-1", recurring.WithStartEnd(recurring.Start+int64(i)*60_000, recurring.End+int64(i)*60_000), start.Add(time.Duration(i)*time.Minute))
+	}
+	w.observe("user-1", other, start)
+
+	lastArrival := start.Add(2 * time.Minute)
+
+	// Nothing to warm before the lead time.
+	tenantIDs, reqs := w.dueRequests(lastArrival.Add(time.Minute - warmingLeadTime - time.Second))
+	assert.Empty(t, tenantIDs)
+	assert.Empty(t, reqs)
+
+	// The recurring query should be warmed within the lead time, only once.
+	tenantIDs, reqs = w.dueRequests(lastArrival.Add(time.Minute - warmingLeadTime + time.Second))
+	assert.Equal(t, []string{"user-1"}, tenantIDs)
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "up", reqs[0].GetQuery())
+	assert.Equal(t, int64(3*60_000), reqs[0].GetStart())
+	assert.Equal(t, int64(3_600_000+3*60_000), reqs[0].GetEnd())
+
+	tenantIDs, reqs = w.dueRequests(lastArrival.Add(time.Minute - time.Second))
+	assert.Empty(t, tenantIDs)
+	assert.Empty(t, reqs)
+
+	// Receiving a query through the warmer should track it and forward it to the next handler.
+	ctx := user.InjectOrgID(context.Background(), "user-2")
+	_, err := w.Wrap(next).Do(ctx, recurring)
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, "user-2", receivedBy[0])
+
+	// Queries which are not received anymore should stop being tracked.
+	tenantIDs, reqs = w.dueRequests(lastArrival.Add(warmingMaxIdlePeriod + time.Second))
+	assert.Empty(t, tenantIDs)
+	assert.Empty(t, reqs)
+
+	w.queriesMx.Lock()
+	assert.Len(t, w.queries, 1)
+	w.queriesMx.Unlock()
+
+	// Warming runs the due queries against the next handler.
+	received, receivedBy = nil, nil
+	now := time.Now()
+	for i := 3; i > 0; i-- {
+		w.observe("user-3", recurring, now.Add(-time.Duration(i)*time.Minute+warmingLeadTime/2))
+	}
+	require.NoError(t, w.iteration(context.Background()))
+	require.Len(t, received, 1)
+	assert.Equal(t, "user-3", receivedBy[0])
+	assert.Equal(t, "up", received[0].GetQuery())
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_warming_queries_total Total number of recurring queries run ahead of their expected arrival to warm the results cache.
+		# TYPE cortex_query_frontend_warming_queries_total counter
+		cortex_query_frontend_warming_queries_total 1
+		# HELP cortex_query_frontend_warming_queries_failed_total Total number of recurring queries run ahead of their expected arrival to warm the results cache which failed.
+		# TYPE cortex_query_frontend_warming_queries_failed_total counter
+		cortex_query_frontend_warming_queries_failed_total 0
+	`), "cortex_query_frontend_warming_queries_total", "cortex_query_frontend_warming_queries_failed_total"))
+}
@@ -8,12 +8,14 @@ package querymiddleware
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
 	"github.com/grafana/dskit/tenant"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -35,10 +37,15 @@ type Config struct {
 	SplitQueriesByInterval time.Duration `yaml:"split_queries_by_interval" category:"advanced"`
 	AlignQueriesWithStep   bool          `yaml:"align_queries_with_step"`
 	ResultsCacheConfig     `yaml:"results_cache"`
-	CacheResults           bool `yaml:"cache_results"`
-	MaxRetries             int  `yaml:"max_retries" category:"advanced"`
-	ShardedQueries         bool `yaml:"parallelize_shardable_queries"`
-	CacheUnalignedRequests bool `yaml:"cache_unaligned_requests" category:"advanced"`
+	CacheResults           bool          `yaml:"cache_results"`
+	MaxRetries             int           `yaml:"max_retries" category:"advanced"`
+	ShardedQueries         bool          `yaml:"parallelize_shardable_queries"`
+	CacheUnalignedRequests bool          `yaml:"cache_unaligned_requests" category:"advanced"`
+	CachePartialResults    bool          `yaml:"cache_partial_results" category:"experimental"`
+	ProactiveWarming       bool          `yaml:"proactive_warming" category:"experimental"`
+	WarmingMinOccurrences  int           `yaml:"warming_min_occurrences" category:"experimental"`
+	TargetSplitLatency     time.Duration `yaml:"target_split_latency" category:"experimental"`
+	PruneZeroSeries        bool          `yaml:"prune_zero_series" category:"experimental"`
 
 	// CacheSplitter allows to inject a CacheSplitter to use for generating cache keys.
 	// If nil, the querymiddleware package uses a ConstSplitter with SplitQueriesByInterval.
@@ -55,6 +62,11 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.CacheResults, "query-frontend.cache-results", false, "Cache query results.")
 	f.BoolVar(&cfg.ShardedQueries, "query-frontend.parallelize-shardable-queries", false, "True to enable query sharding.")
 	f.BoolVar(&cfg.CacheUnalignedRequests, "query-frontend.cache-unaligned-requests", false, "Cache requests that are not step-aligned.")
+	f.BoolVar(&cfg.CachePartialResults, "query-frontend.cache-partial-results", false, "Cache the results of the split queries which succeeded even if the query fails, so that a retry of the same query only runs the split queries which have not been cached yet. Requires -query-frontend.cache-results.")
+	f.BoolVar(&cfg.ProactiveWarming, "query-frontend.proactive-warming", false, fmt.Sprintf("Track the range queries received from recent traffic and, for the ones recurring at a regular interval, run them %s before their next expected arrival to pre-populate the results cache. Requires -query-frontend.cache-results.", warmingLeadTime))
+	f.IntVar(&cfg.WarmingMinOccurrences, "query-frontend.warming-min-occurrences", 3, "Minimum number of times a query must be received at a regular interval to be considered recurring and have its results proactively warmed.")
+	f.DurationVar(&cfg.TargetSplitLatency, "query-frontend.target-split-latency", 0, "Target p95 latency of the queries split by interval. When set, the split interval of each tenant is gradually halved or doubled, between 1/8 of and -query-frontend.split-queries-by-interval, to keep the split queries latency close to the target. 0 to disable.")
+	f.BoolVar(&cfg.PruneZeroSeries, "query-frontend.prune-zero-series", false, "When enabled, series whose sample values are all zero or NaN are removed from the query results, and a warning with the number of removed series is added to the response. The series are removed from the final result of the query, after merging the results of the split and sharded queries.")
 	cfg.ResultsCacheConfig.RegisterFlags(f)
 }
 
@@ -68,6 +80,20 @@ func (cfg *Config) Validate() error {
 			return errors.Wrap(err, "invalid ResultsCache config")
 		}
 	}
+	if cfg.CachePartialResults && !cfg.CacheResults {
+		return errors.New("-query-frontend.cache-partial-results may only be enabled in conjunction with -query-frontend.cache-results. Please set the latter")
+	}
+	if cfg.ProactiveWarming {
+		if !cfg.CacheResults {
+			return errors.New("-query-frontend.proactive-warming may only be enabled in conjunction with -query-frontend.cache-results. Please set the latter")
+		}
+		if cfg.WarmingMinOccurrences < 2 {
+			return errors.New("-query-frontend.warming-min-occurrences must be at least 2")
+		}
+	}
+	if cfg.TargetSplitLatency > 0 && cfg.SplitQueriesByInterval <= 0 {
+		return errors.New("-query-frontend.target-split-latency may only be enabled in conjunction with -query-frontend.split-queries-by-interval. Please set the latter")
+	}
 	return nil
 }
 
@@ -131,6 +157,8 @@ func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 }
 
 // NewTripperware returns a Tripperware configured with middlewares to limit, align, split, retry and cache requests.
+// The returned service, if not nil, runs the background work of the middlewares (e.g. the proactive warming of the
+// results cache) and must be started by the caller.
 func NewTripperware(
 	cfg Config,
 	log log.Logger,
@@ -139,15 +167,15 @@ func NewTripperware(
 	cacheExtractor Extractor,
 	engineOpts promql.EngineOpts,
 	registerer prometheus.Registerer,
-) (Tripperware, error) {
-	queryRangeTripperware, err := newQueryTripperware(cfg, log, limits, codec, cacheExtractor, engineOpts, registerer)
+) (Tripperware, services.Service, error) {
+	queryRangeTripperware, serv, err := newQueryTripperware(cfg, log, limits, codec, cacheExtractor, engineOpts, registerer)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	return MergeTripperwares(
 		newActiveUsersTripperware(log, registerer),
 		queryRangeTripperware,
-	), err
+	), serv, err
 }
 
 func newQueryTripperware(
@@ -158,7 +186,7 @@ func newQueryTripperware(
 	cacheExtractor Extractor,
 	engineOpts promql.EngineOpts,
 	registerer prometheus.Registerer,
-) (Tripperware, error) {
+) (Tripperware, services.Service, error) {
 	// Disable concurrency limits for sharded queries.
 	engineOpts.ActiveQueryTracker = nil
 	engine := promql.NewEngine(engineOpts)
@@ -166,15 +194,35 @@ func newQueryTripperware(
 	// Metric used to keep track of each middleware execution duration.
 	metrics := newInstrumentMiddlewareMetrics(registerer)
 
+	// Shared between range and instant queries, so that its metrics are registered once.
+	responseSizeLimitMiddleware := newResponseSizeLimitMiddleware(limits, log, registerer)
+
 	queryRangeMiddleware := []Middleware{
 		// Track query range statistics. Added first before any subsequent middleware modifies the request.
 		newQueryStatsMiddleware(registerer),
-		newLimitsMiddleware(limits, log),
+		responseSizeLimitMiddleware,
+	}
+	queryInstantMiddleware := []Middleware{
+		responseSizeLimitMiddleware,
+	}
+
+	// Prune the merged result, before the query is split, cached or sharded.
+	if cfg.PruneZeroSeries {
+		pruneZeroSeriesMiddleware := newPruneZeroSeriesMiddleware(registerer)
+		queryRangeMiddleware = append(queryRangeMiddleware, pruneZeroSeriesMiddleware)
+		queryInstantMiddleware = append(queryInstantMiddleware, pruneZeroSeriesMiddleware)
 	}
+
+	queryRangeMiddleware = append(queryRangeMiddleware, newLimitsMiddleware(limits, log))
 	if cfg.AlignQueriesWithStep {
 		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("step_align", metrics, log), newStepAlignMiddleware())
 	}
 
+	var (
+		warmer    *resultsWarmer
+		warmerIdx int
+	)
+
 	// Inject the middleware to split requests by interval + results cache (if at least one of the two is enabled).
 	if cfg.SplitQueriesByInterval > 0 || cfg.CacheResults {
 		var c cache.Cache
@@ -185,7 +233,7 @@ func newQueryTripperware(
 
 			c, err = newResultsCache(cfg.ResultsCacheConfig, log, registerer)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			c = cache.NewCompression(cfg.ResultsCacheConfig.Compression, c, log)
 		}
@@ -199,11 +247,26 @@ func newQueryTripperware(
 			splitter = ConstSplitter(cfg.SplitQueriesByInterval)
 		}
 
+		var dynamicSplit *dynamicSplitIntervals
+		if cfg.SplitQueriesByInterval > 0 && cfg.TargetSplitLatency > 0 {
+			dynamicSplit = newDynamicSplitIntervals(cfg.SplitQueriesByInterval, cfg.TargetSplitLatency, registerer)
+		}
+
+		// Warm the results of recurring queries. The warming queries run through the middlewares following
+		// the warmer, starting from the results cache, in order to populate it.
+		if cfg.ProactiveWarming {
+			warmer = newResultsWarmer(cfg.WarmingMinOccurrences, log, registerer)
+			warmerIdx = len(queryRangeMiddleware)
+			queryRangeMiddleware = append(queryRangeMiddleware, warmer)
+		}
+
 		queryRangeMiddleware = append(queryRangeMiddleware, newInstrumentMiddleware("split_by_interval_and_results_cache", metrics, log), newSplitAndCacheMiddleware(
 			cfg.SplitQueriesByInterval > 0,
 			cfg.CacheResults,
 			cfg.SplitQueriesByInterval,
+			dynamicSplit,
 			cfg.CacheUnalignedRequests,
+			cfg.CachePartialResults,
 			limits,
 			codec,
 			c,
@@ -215,10 +278,9 @@ func newQueryTripperware(
 		))
 	}
 
-	queryInstantMiddleware := []Middleware{newLimitsMiddleware(limits, log)}
-
 	queryInstantMiddleware = append(
 		queryInstantMiddleware,
+		newLimitsMiddleware(limits, log),
 		newSplitInstantQueryByIntervalMiddleware(limits, log, engine, registerer),
 	)
 
@@ -247,7 +309,21 @@ func newQueryTripperware(
 		queryInstantMiddleware = append(queryInstantMiddleware, newInstrumentMiddleware("retry", metrics, log), newRetryMiddleware(log, cfg.MaxRetries, retryMiddlewareMetrics))
 	}
 
+	// The warmer is returned as service, so that it's stopped together with the component using the tripperware.
+	var serv services.Service
+	if warmer != nil {
+		serv = warmer
+	}
+
 	return func(next http.RoundTripper) http.RoundTripper {
+		if warmer != nil {
+			warmer.setHandler(roundTripperHandler{
+				logger: log,
+				next:   newLimitedParallelismRoundTripper(next, codec, limits, queryRangeMiddleware[warmerIdx+1:]...),
+				codec:  codec,
+			})
+		}
+
 		queryrange := newLimitedParallelismRoundTripper(next, codec, limits, queryRangeMiddleware...)
 		instant := defaultInstantQueryParamsRoundTripper(
 			newLimitedParallelismRoundTripper(next, codec, limits, queryInstantMiddleware...),
@@ -263,7 +339,7 @@ func newQueryTripperware(
 				return next.RoundTrip(r)
 			}
 		})
-	}, nil
+	}, serv, nil
 }
 
 func newActiveUsersTripperware(logger log.Logger, registerer prometheus.Registerer) Tripperware {
@@ -12,12 +12,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/test"
 	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
@@ -63,7 +65,7 @@ func TestRangeTripperware(t *testing.T) {
 		next: http.DefaultTransport,
 	}
 
-	tw, err := NewTripperware(Config{},
+	tw, _, err := NewTripperware(Config{},
 		log.NewNopLogger(),
 		mockLimits{},
 		PrometheusCodec,
@@ -105,12 +107,90 @@ func TestRangeTripperware(t *testing.T) {
 	}
 }
 
+func TestRangeTripperware_ShouldShareTheResultsWarmerAcrossRequests(t *testing.T) {
+	const (
+		numRequests  = 20
+		responseBody = `{"status":"success","data":{"resultType":"matrix","result":[]}}`
+	)
+
+	downstream := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(responseBody)),
+		}, nil
+	})
+
+	tw, serv, err := NewTripperware(
+		Config{
+			SplitQueriesByInterval: 24 * time.Hour,
+			ProactiveWarming:       true,
+			WarmingMinOccurrences:  3,
+		},
+		log.NewNopLogger(),
+		mockLimits{},
+		PrometheusCodec,
+		nil,
+		promql.EngineOpts{
+			Logger:     log.NewNopLogger(),
+			Reg:        nil,
+			MaxSamples: 1000,
+			Timeout:    time.Minute,
+		},
+		prometheus.NewPedanticRegistry(),
+	)
+	require.NoError(t, err)
+
+	warmer, ok := serv.(*resultsWarmer)
+	require.True(t, ok)
+
+	rt := tw(downstream)
+	assert.NotNil(t, warmer.getHandler())
+
+	sendRequest := func(i int) {
+		start := 1536673680 + i*60
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/v1/query_range?query=up&start=%d&end=%d&step=60", start, start+3600), http.NoBody)
+		require.NoError(t, err)
+
+		ctx := user.InjectOrgID(context.Background(), "user-1")
+		req = req.WithContext(ctx)
+		require.NoError(t, user.InjectOrgIDIntoHTTPRequest(ctx, req))
+
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	// Send a first request, so that the goroutines started once are already running.
+	sendRequest(0)
+	goroutinesBefore := runtime.NumGoroutine()
+
+	for i := 1; i < numRequests; i++ {
+		sendRequest(i)
+	}
+
+	// Requests should not start any goroutine outliving them.
+	test.Poll(t, time.Second, true, func() interface{} {
+		return runtime.NumGoroutine() <= goroutinesBefore
+	})
+
+	// All the requests should have been tracked by the same warmer.
+	warmer.queriesMx.Lock()
+	defer warmer.queriesMx.Unlock()
+
+	require.Len(t, warmer.queries, 1)
+	for _, q := range warmer.queries {
+		assert.Len(t, q.arrivals, 3)
+	}
+}
+
 func TestInstantTripperware(t *testing.T) {
 	const totalShards = 8
 
 	ctx := user.InjectOrgID(context.Background(), "user-1")
 
-	tw, err := NewTripperware(
+	tw, _, err := NewTripperware(
 		Config{
 			ShardedQueries: true,
 		},
@@ -137,7 +217,7 @@ func TestInstantTripperware(t *testing.T) {
 			return nil, err
 		}
 
-		return PrometheusCodec.EncodeResponse(r.Context(), &PrometheusResponse{
+		return PrometheusCodec.EncodeResponse(r.Context(), r, &PrometheusResponse{
 			Status: "success",
 			Data: &PrometheusData{
 				ResultType: "vector",
@@ -218,7 +298,7 @@ func TestTripperware_Metrics(t *testing.T) {
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
-			tw, err := NewTripperware(Config{AlignQueriesWithStep: testData.stepAlignEnabled},
+			tw, _, err := NewTripperware(Config{AlignQueriesWithStep: testData.stepAlignEnabled},
 				log.NewNopLogger(),
 				mockLimits{},
 				PrometheusCodec,
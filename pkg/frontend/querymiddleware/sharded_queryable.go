@@ -11,7 +11,6 @@ import (
 	"math"
 	"sync"
 
-	"github.com/grafana/dskit/concurrency"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
@@ -108,8 +107,16 @@ func (q *shardedQuerier) Select(_ bool, hints *storage.SelectHints, matchers ...
 func (q *shardedQuerier) handleEmbeddedQueries(queries []string, hints *storage.SelectHints) storage.SeriesSet {
 	streams := make([][]SampleStream, len(queries))
 
+	limiter := shardedQueriesLimiterFromContext(q.ctx)
+
 	// Concurrently run each query. It breaks and cancels each worker context on first error.
-	err := concurrency.ForEachJob(q.ctx, len(queries), len(queries), func(ctx context.Context, idx int) error {
+	err := forEachJob(q.ctx, len(queries), func(ctx context.Context, idx int) error {
+		// Wait until the query can be run without exceeding the max in-flight sharded queries.
+		if err := limiter.acquire(ctx); err != nil {
+			return err
+		}
+		defer limiter.release()
+
 		resp, err := q.handler.Do(ctx, q.req.WithQuery(queries[idx]))
 		if err != nil {
 			return err
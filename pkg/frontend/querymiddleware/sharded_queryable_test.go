@@ -8,9 +8,12 @@ package querymiddleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/value"
@@ -18,6 +21,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware/astmapper"
 	"github.com/grafana/mimir/pkg/mimirpb"
@@ -247,6 +251,80 @@ func TestShardedQuerier_Select_ShouldConcurrentlyRunEmbeddedQueries(t *testing.T
 	require.Equal(t, len(embeddedQueries), actualSeries)
 }
 
+func TestShardedQuerier_Select_ShouldHonorConcurrentSubqueryLimit(t *testing.T) {
+	const maxSubqueries = 2
+
+	var embeddedQueries []string
+	for i := 0; i < 10; i++ {
+		embeddedQueries = append(embeddedQueries, fmt.Sprintf(`sum(rate(metric{__query_shard__="%d_of_10"}[1m]))`, i+1))
+	}
+
+	var (
+		runs    atomic.Int32
+		running atomic.Int32
+		max     atomic.Int32
+	)
+
+	querier := mkShardedQuerier(HandlerFunc(func(ctx context.Context, req Request) (Response, error) {
+		runs.Inc()
+		cur := running.Inc()
+		defer running.Dec()
+		if cur > max.Load() {
+			max.Store(cur)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		return &PrometheusResponse{
+			Data: &PrometheusData{
+				ResultType: string(parser.ValueTypeVector),
+				Result: []SampleStream{{
+					Labels:  []mimirpb.LabelAdapter{{Name: "query", Value: req.GetQuery()}},
+					Samples: []mimirpb.Sample{{Value: 1, TimestampMs: 1}},
+				}},
+			},
+		}, nil
+	}))
+	querier.ctx = contextWithShardedQueriesLimiter(context.Background(), maxSubqueries)
+
+	encodedQueries, err := astmapper.JSONCodec.Encode(embeddedQueries)
+	require.Nil(t, err)
+
+	seriesSet := querier.Select(
+		false,
+		nil,
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", astmapper.EmbeddedQueriesMetricName),
+		labels.MustNewMatcher(labels.MatchEqual, astmapper.EmbeddedQueriesLabelName, encodedQueries),
+	)
+	require.NoError(t, seriesSet.Err())
+
+	assert.Equal(t, int32(len(embeddedQueries)), runs.Load())
+	assert.LessOrEqual(t, int(max.Load()), maxSubqueries)
+}
+
+func TestShardedQuerier_Select_ShouldFailWhenWaitingForConcurrentSubqueryLimitAndContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(contextWithShardedQueriesLimiter(context.Background(), 1), 100*time.Millisecond)
+	defer cancel()
+
+	// Exhaust the limit, like other in-flight subqueries of the same query would do.
+	require.NoError(t, shardedQueriesLimiterFromContext(ctx).acquire(ctx))
+
+	querier := mkShardedQuerier(HandlerFunc(func(context.Context, Request) (Response, error) {
+		return nil, errors.New("unexpected subquery run")
+	}))
+	querier.ctx = ctx
+
+	encodedQueries, err := astmapper.JSONCodec.Encode([]string{`sum(rate(metric[1m]))`})
+	require.Nil(t, err)
+
+	seriesSet := querier.Select(
+		false,
+		nil,
+		labels.MustNewMatcher(labels.MatchEqual, "__name__", astmapper.EmbeddedQueriesMetricName),
+		labels.MustNewMatcher(labels.MatchEqual, astmapper.EmbeddedQueriesLabelName, encodedQueries),
+	)
+	require.ErrorIs(t, seriesSet.Err(), context.DeadlineExceeded)
+}
+
 func TestShardedQueryable_GetResponseHeaders(t *testing.T) {
 	queryable := newShardedQueryable(&PrometheusRangeQueryRequest{}, nil)
 	assert.Empty(t, queryable.getResponseHeaders())
@@ -22,7 +22,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/promql/parser"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/grafana/dskit/tenant"
 
@@ -92,10 +91,12 @@ type splitAndCacheMiddleware struct {
 	// Split by interval.
 	splitEnabled  bool
 	splitInterval time.Duration
+	dynamicSplit  *dynamicSplitIntervals // Nil if disabled.
 
 	// Results caching.
 	cacheEnabled           bool
 	cacheUnalignedRequests bool
+	cachePartialResults    bool
 	cache                  cache.Cache
 	splitter               CacheSplitter
 	extractor              Extractor
@@ -107,7 +108,9 @@ func newSplitAndCacheMiddleware(
 	splitEnabled bool,
 	cacheEnabled bool,
 	splitInterval time.Duration,
+	dynamicSplit *dynamicSplitIntervals,
 	cacheUnalignedRequests bool,
+	cachePartialResults bool,
 	limits Limits,
 	merger Merger,
 	cache cache.Cache,
@@ -123,10 +126,12 @@ func newSplitAndCacheMiddleware(
 			splitEnabled:           splitEnabled,
 			cacheEnabled:           cacheEnabled,
 			cacheUnalignedRequests: cacheUnalignedRequests,
+			cachePartialResults:    cachePartialResults,
 			next:                   next,
 			limits:                 limits,
 			merger:                 merger,
 			splitInterval:          splitInterval,
+			dynamicSplit:           dynamicSplit,
 			metrics:                metrics,
 			cache:                  cache,
 			splitter:               splitter,
@@ -145,7 +150,7 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 
 	// Split the input requests by the configured interval (eg. day).
 	// Returns the input request if splitting is disabled.
-	splitReqs, err := s.splitRequestByInterval(req)
+	splitReqs, err := s.splitRequestByInterval(req, s.splitInterval)
 	if err != nil {
 		return nil, err
 	}
@@ -214,6 +219,21 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 		}
 	}
 
+	// If the dynamic split interval is enabled, further split the downstream requests by the interval adjusted
+	// based on the recent latency of the tenant split queries. The requests are split after the cache lookup,
+	// so that they're cached with the keys generated from the configured interval.
+	next := s.next
+	if s.dynamicSplit != nil && s.splitEnabled {
+		dynamicSplit := s.dynamicSplit.forTenant(tenant.JoinTenantIDs(tenantIDs))
+		dynamicInterval := dynamicSplit.interval()
+		if dynamicInterval < s.splitInterval {
+			if err := splitReqs.splitDownstreamRequestsByInterval(dynamicInterval); err != nil {
+				return nil, err
+			}
+		}
+		next = dynamicSplit.wrap(next, dynamicInterval)
+	}
+
 	// Prepare and execute the downstream requests.
 	execReqs := splitReqs.prepareDownstreamRequests()
 
@@ -223,8 +243,18 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 	queryStats.AddSplitQueries(uint32(len(execReqs)))
 
 	if len(execReqs) > 0 {
-		execResps, err := doRequests(ctx, s.next, execReqs, true)
+		execResps, err := doRequests(ctx, next, execReqs, true)
 		if err != nil {
+			// Cache the results of the downstream requests which succeeded, so that they
+			// don't have to be run again when the same query is retried.
+			if isCacheEnabled && s.cachePartialResults && len(execResps) > 0 {
+				if storeErr := splitReqs.storePartialDownstreamResponses(execResps); storeErr == nil {
+					if cacheErr := s.updateCacheExtents(ctx, splitReqs, tenantIDs, maxCacheTime, maxCacheFreshness); cacheErr != nil {
+						level.Warn(s.logger).Log("msg", "failed to cache partial results", "err", cacheErr)
+					}
+				}
+			}
+
 			return nil, err
 		}
 
@@ -236,75 +266,85 @@ func (s *splitAndCacheMiddleware) Do(ctx context.Context, req Request) (Response
 
 	// Store the updated response in the results cache.
 	if isCacheEnabled && len(execReqs) > 0 {
-		for _, splitReq := range splitReqs {
-			// If there are no downstream requests it means the response was entirely picked up from the cache
-			// so there's no need to store it again in the cache (because nothing has changed).
-			if len(splitReq.downstreamRequests) == 0 {
-				continue
-			}
+		if err := s.updateCacheExtents(ctx, splitReqs, tenantIDs, maxCacheTime, maxCacheFreshness); err != nil {
+			return nil, err
+		}
+	}
 
-			// Skip caching if the request is not cachable.
-			if cachable, _ := isRequestCachable(splitReq.orig, maxCacheTime, s.cacheUnalignedRequests, s.logger); !cachable {
-				continue
-			}
+	// We can finally build the response, which is the merge of all downstream responses and the responses
+	// we've got from the cache (if any).
+	responses := make([]Response, 0, splitReqs.countDownstreamRequests()+splitReqs.countCachedResponses())
+	for _, splitReq := range splitReqs {
+		responses = append(responses, splitReq.cachedResponses...)
+		responses = append(responses, splitReq.downstreamResponses...)
+	}
 
-			// Update extents with the new ones from downstream responses.
-			updatedExtents := splitReq.cachedExtents
+	return s.merger.MergeResponse(responses...)
+}
 
-			for downstreamIdx, downstreamReq := range splitReq.downstreamRequests {
-				downstreamRes := splitReq.downstreamResponses[downstreamIdx]
-				if !isResponseCachable(downstreamRes, s.logger) {
-					continue
-				}
+// updateCacheExtents stores in the results cache the extents built from the responses of the downstream requests,
+// merged with the extents previously picked up from the cache. Downstream requests with no response are skipped.
+func (s *splitAndCacheMiddleware) updateCacheExtents(ctx context.Context, splitReqs splitRequests, tenantIDs []string, maxCacheTime int64, maxCacheFreshness time.Duration) error {
+	for _, splitReq := range splitReqs {
+		// If there are no downstream requests it means the response was entirely picked up from the cache
+		// so there's no need to store it again in the cache (because nothing has changed).
+		if len(splitReq.downstreamRequests) == 0 {
+			continue
+		}
 
-				extent, err := toExtent(ctx, downstreamReq, s.extractor.ResponseWithoutHeaders(downstreamRes))
-				if err != nil {
-					return nil, err
-				}
+		// Skip caching if the request is not cachable.
+		if cachable, _ := isRequestCachable(splitReq.orig, maxCacheTime, s.cacheUnalignedRequests, s.logger); !cachable {
+			continue
+		}
 
-				updatedExtents = append(updatedExtents, extent)
-			}
+		// Update extents with the new ones from downstream responses.
+		updatedExtents := splitReq.cachedExtents
 
-			// If extents haven't been updated, we can skip storing it in the cache again.
-			if len(splitReq.cachedExtents) == len(updatedExtents) {
+		for downstreamIdx, downstreamReq := range splitReq.downstreamRequests {
+			downstreamRes := splitReq.downstreamResponses[downstreamIdx]
+			if downstreamRes == nil || !isResponseCachable(downstreamRes, s.logger) {
 				continue
 			}
 
-			mergedExtents, err := mergeCacheExtentsForRequest(ctx, splitReq.orig, s.merger, updatedExtents)
+			extent, err := toExtent(ctx, downstreamReq, s.extractor.ResponseWithoutHeaders(downstreamRes))
 			if err != nil {
-				return nil, err
+				return err
 			}
 
-			// Filter out recent extents from merged ones.
-			// TODO(codesome): make filterRecentCacheExtents break it into 2 sets, one to cache with lower TTL and one with the usual TTL.
-			filteredExtents, err := filterRecentCacheExtents(splitReq.orig, maxCacheFreshness, s.extractor, mergedExtents)
-			if err != nil {
-				return nil, err
-			}
+			updatedExtents = append(updatedExtents, extent)
+		}
 
-			// Put back into the cache the filtered ones.
-			s.storeCacheExtents(ctx, splitReq.cacheKey, tenantIDs, filteredExtents)
+		// If extents haven't been updated, we can skip storing it in the cache again.
+		if len(splitReq.cachedExtents) == len(updatedExtents) {
+			continue
 		}
-	}
 
-	// We can finally build the response, which is the merge of all downstream responses and the responses
-	// we've got from the cache (if any).
-	responses := make([]Response, 0, splitReqs.countDownstreamRequests()+splitReqs.countCachedResponses())
-	for _, splitReq := range splitReqs {
-		responses = append(responses, splitReq.cachedResponses...)
-		responses = append(responses, splitReq.downstreamResponses...)
+		mergedExtents, err := mergeCacheExtentsForRequest(ctx, splitReq.orig, s.merger, updatedExtents)
+		if err != nil {
+			return err
+		}
+
+		// Filter out recent extents from merged ones.
+		// TODO(codesome): make filterRecentCacheExtents break it into 2 sets, one to cache with lower TTL and one with the usual TTL.
+		filteredExtents, err := filterRecentCacheExtents(splitReq.orig, maxCacheFreshness, s.extractor, mergedExtents)
+		if err != nil {
+			return err
+		}
+
+		// Put back into the cache the filtered ones.
+		s.storeCacheExtents(ctx, splitReq.cacheKey, tenantIDs, filteredExtents)
 	}
 
-	return s.merger.MergeResponse(responses...)
+	return nil
 }
 
-// splitRequestByInterval splits the given Request by configured interval. Returns the input request if splitting is disabled.
-func (s *splitAndCacheMiddleware) splitRequestByInterval(req Request) (splitRequests, error) {
+// splitRequestByInterval splits the given Request by the input interval. Returns the input request if splitting is disabled.
+func (s *splitAndCacheMiddleware) splitRequestByInterval(req Request, interval time.Duration) (splitRequests, error) {
 	if !s.splitEnabled {
 		return splitRequests{{orig: req}}, nil
 	}
 
-	splitReqs, err := splitQueryByInterval(req, s.splitInterval)
+	splitReqs, err := splitQueryByInterval(req, interval)
 	if err != nil {
 		return nil, err
 	}
@@ -446,6 +486,22 @@ func (s *splitRequests) countDownstreamRequests() int {
 	return count
 }
 
+// splitDownstreamRequestsByInterval splits each downstream request by the input interval.
+func (s *splitRequests) splitDownstreamRequestsByInterval(interval time.Duration) error {
+	for _, splitReq := range *s {
+		downstreamReqs := make([]Request, 0, len(splitReq.downstreamRequests))
+		for _, downstreamReq := range splitReq.downstreamRequests {
+			reqs, err := splitQueryByInterval(downstreamReq, interval)
+			if err != nil {
+				return err
+			}
+			downstreamReqs = append(downstreamReqs, reqs...)
+		}
+		splitReq.downstreamRequests = downstreamReqs
+	}
+	return nil
+}
+
 // prepareDownstreamRequests injects a unique ID and hints to all downstream requests and
 // initialize downstream responses slice to have the same length of requests.
 func (s *splitRequests) prepareDownstreamRequests() []Request {
@@ -517,6 +573,28 @@ func (s *splitRequests) storeDownstreamResponses(responses []requestResponse) er
 	return nil
 }
 
+// storePartialDownstreamResponses is like storeDownstreamResponses, but doesn't require all downstream requests to
+// have a response: the downstream requests with no response get a nil response associated.
+func (s *splitRequests) storePartialDownstreamResponses(responses []requestResponse) error {
+	execRespsByID := make(map[int64]Response, len(responses))
+	for _, resp := range responses {
+		if _, ok := execRespsByID[resp.Request.GetId()]; ok {
+			// Should never happen unless a bug.
+			return errors.New("consistency check failed: conflicting downstream request ID")
+		}
+
+		execRespsByID[resp.Request.GetId()] = resp.Response
+	}
+
+	for _, splitReq := range *s {
+		for downstreamIdx, downstreamReq := range splitReq.downstreamRequests {
+			splitReq.downstreamResponses[downstreamIdx] = execRespsByID[downstreamReq.GetId()]
+		}
+	}
+
+	return nil
+}
+
 // requestResponse contains a request response and the respective request that was used.
 type requestResponse struct {
 	Request  Request
@@ -525,33 +603,32 @@ type requestResponse struct {
 
 // doRequests executes a list of requests in parallel.
 func doRequests(ctx context.Context, downstream Handler, reqs []Request, recordSpan bool) ([]requestResponse, error) {
-	g, ctx := errgroup.WithContext(ctx)
 	mtx := sync.Mutex{}
 	resps := make([]requestResponse, 0, len(reqs))
-	for i := 0; i < len(reqs); i++ {
-		req := reqs[i]
-		g.Go(func() error {
-			var childCtx = ctx
-			if recordSpan {
-				var span opentracing.Span
-				span, childCtx = opentracing.StartSpanFromContext(ctx, "doRequests")
-				req.LogToSpan(span)
-				defer span.Finish()
-			}
 
-			resp, err := downstream.Do(childCtx, req)
-			if err != nil {
-				return err
-			}
+	err := forEachJob(ctx, len(reqs), func(ctx context.Context, idx int) error {
+		req := reqs[idx]
 
-			mtx.Lock()
-			resps = append(resps, requestResponse{req, resp})
-			mtx.Unlock()
-			return nil
-		})
-	}
+		var childCtx = ctx
+		if recordSpan {
+			var span opentracing.Span
+			span, childCtx = opentracing.StartSpanFromContext(ctx, "doRequests")
+			req.LogToSpan(span)
+			defer span.Finish()
+		}
+
+		resp, err := downstream.Do(childCtx, req)
+		if err != nil {
+			return err
+		}
+
+		mtx.Lock()
+		resps = append(resps, requestResponse{req, resp})
+		mtx.Unlock()
+		return nil
+	})
 
-	return resps, g.Wait()
+	return resps, err
 }
 
 func splitQueryByInterval(r Request, interval time.Duration) ([]Request, error) {
@@ -20,6 +20,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/grafana/dskit/concurrency"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
@@ -87,6 +88,8 @@ func TestSplitAndCacheMiddleware_SplitByInterval(t *testing.T) {
 		true,
 		false, // Cache disabled.
 		24*time.Hour,
+		nil,
+		false,
 		false,
 		mockLimits{},
 		PrometheusCodec,
@@ -152,6 +155,8 @@ func TestSplitAndCacheMiddleware_ResultsCache(t *testing.T) {
 		true,
 		true,
 		24*time.Hour,
+		nil,
+		false,
 		false,
 		mockLimits{maxCacheFreshness: 10 * time.Minute},
 		PrometheusCodec,
@@ -229,6 +234,90 @@ func TestSplitAndCacheMiddleware_ResultsCache(t *testing.T) {
 	assert.Equal(t, uint32(2), queryStats.LoadSplitQueries())
 }
 
+func TestSplitAndCacheMiddleware_ResultsCache_PartialResults(t *testing.T) {
+	for _, cachePartialResults := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cache partial results: %t", cachePartialResults), func(t *testing.T) {
+			cacheBackend := cache.NewInstrumentedMockCache()
+
+			mw := newSplitAndCacheMiddleware(
+				true,
+				true,
+				24*time.Hour,
+				nil,
+				false,
+				cachePartialResults,
+				mockLimits{maxCacheFreshness: 10 * time.Minute},
+				PrometheusCodec,
+				cacheBackend,
+				ConstSplitter(day),
+				PrometheusResponseExtractor{},
+				resultsCacheAlwaysEnabled,
+				log.NewNopLogger(),
+				prometheus.NewPedanticRegistry(),
+			)
+
+			emptyResponse := &PrometheusResponse{
+				Status: "success",
+				Data: &PrometheusData{
+					ResultType: model.ValMatrix.String(),
+					Result:     []SampleStream{},
+				},
+			}
+
+			// The query is split in two days. The first execution fails on the second day,
+			// only after the first day has been successfully run.
+			secondDayStart := parseTimeRFC3339(t, "2021-10-15T00:00:00Z").Unix() * 1000
+			firstDayDone := make(chan struct{})
+			failSecondDay := true
+
+			var downstreamReqs atomic.Int32
+			rc := mw.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				downstreamReqs.Inc()
+
+				if req.GetStart() < secondDayStart {
+					if failSecondDay {
+						defer close(firstDayDone)
+					}
+					return emptyResponse, nil
+				}
+
+				if failSecondDay {
+					<-firstDayDone
+					return nil, errors.New("downstream failure")
+				}
+				return emptyResponse, nil
+			}))
+
+			req := Request(&PrometheusRangeQueryRequest{
+				Path:  "/api/v1/query_range",
+				Start: parseTimeRFC3339(t, "2021-10-14T22:00:00Z").Unix() * 1000,
+				End:   parseTimeRFC3339(t, "2021-10-15T02:00:00Z").Unix() * 1000,
+				Step:  120 * 1000,
+				Query: `{__name__=~".+"}`,
+			})
+
+			ctx := user.InjectOrgID(context.Background(), "1")
+			_, err := rc.Do(ctx, req)
+			require.Error(t, err)
+			require.Equal(t, int32(2), downstreamReqs.Load())
+
+			// Retry the query.
+			failSecondDay = false
+			downstreamReqs.Store(0)
+
+			_, err = rc.Do(ctx, req)
+			require.NoError(t, err)
+
+			if cachePartialResults {
+				// The first day has been picked up from the cache.
+				assert.Equal(t, int32(1), downstreamReqs.Load())
+			} else {
+				assert.Equal(t, int32(2), downstreamReqs.Load())
+			}
+		})
+	}
+}
+
 func TestSplitAndCacheMiddleware_ResultsCache_ShouldNotLookupCacheIfStepIsNotAligned(t *testing.T) {
 	cacheBackend := cache.NewInstrumentedMockCache()
 	reg := prometheus.NewPedanticRegistry()
@@ -237,6 +326,8 @@ func TestSplitAndCacheMiddleware_ResultsCache_ShouldNotLookupCacheIfStepIsNotAli
 		true,
 		true,
 		24*time.Hour,
+		nil,
+		false,
 		false,
 		mockLimits{maxCacheFreshness: 10 * time.Minute},
 		PrometheusCodec,
@@ -317,7 +408,9 @@ func TestSplitAndCacheMiddleware_ResultsCache_EnabledCachingOfStepUnalignedReque
 		true,
 		true,
 		24*time.Hour,
+		nil,
 		true, // caching of step-unaligned requests is enabled in this test.
+		false,
 		mockLimits{maxCacheFreshness: 10 * time.Minute},
 		PrometheusCodec,
 		cacheBackend,
@@ -473,6 +566,8 @@ func TestSplitAndCacheMiddleware_ResultsCache_ShouldNotCacheRequestEarlierThanMa
 				false, // No interval splitting.
 				true,
 				24*time.Hour,
+				nil,
+				false,
 				false,
 				mockLimits{maxCacheFreshness: maxCacheFreshness},
 				PrometheusCodec,
@@ -682,7 +777,9 @@ func TestSplitAndCacheMiddleware_ResultsCacheFuzzy(t *testing.T) {
 					testData.splitEnabled,
 					testData.cacheEnabled,
 					24*time.Hour,
+					nil,
 					testData.cacheUnaligned,
+					false,
 					mockLimits{
 						maxCacheFreshness:   testData.maxCacheFreshness,
 						maxQueryParallelism: testData.maxQueryParallelism,
@@ -921,6 +1018,8 @@ func TestSplitAndCacheMiddleware_ResultsCache_ExtentsEdgeCases(t *testing.T) {
 				false, // No splitting.
 				true,
 				24*time.Hour,
+				nil,
+				false,
 				false,
 				mockLimits{},
 				PrometheusCodec,
@@ -966,6 +1065,8 @@ func TestSplitAndCacheMiddleware_StoreAndFetchCacheExtents(t *testing.T) {
 		false,
 		true,
 		24*time.Hour,
+		nil,
+		false,
 		false,
 		mockLimits{},
 		PrometheusCodec,
@@ -1013,6 +1114,8 @@ func TestSplitAndCacheMiddleware_WrapMultipleTimes(t *testing.T) {
 		false,
 		true,
 		24*time.Hour,
+		nil,
+		false,
 		false,
 		mockLimits{},
 		PrometheusCodec,
@@ -1279,7 +1382,7 @@ func (q roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	return q.codec.EncodeResponse(r.Context(), response)
+	return q.codec.EncodeResponse(r.Context(), r, response)
 }
 
 const seconds = 1e3 // 1e3 milliseconds per second.
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package transport
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/atomic"
+)
+
+const (
+	// backpressureLatencyWindow is the time window of the query response latencies used to compute the p99 latency.
+	backpressureLatencyWindow = time.Minute
+
+	// backpressureUpdateInterval is how frequently the p99 latency is computed.
+	backpressureUpdateInterval = 5 * time.Second
+)
+
+// BackpressureSignaling is a middleware signaling the clients to back off while the queriers are overloaded.
+// The queriers are considered overloaded when the p99 latency of the query responses of the last minute exceeds
+// the configured threshold: in this case a Retry-After header is added to all 429 responses, so that the
+// clients honoring it wait for the overload to resolve instead of retrying immediately. The latencies are
+// tracked by a summary, whose p99 is periodically computed, so that tracking a response is lock-free.
+type BackpressureSignaling struct {
+	services.Service
+
+	threshold time.Duration
+
+	latency prometheus.Summary
+	p99     *atomic.Duration
+
+	active prometheus.Gauge
+}
+
+// NewBackpressureSignaling makes a new BackpressureSignaling activated when the p99 query response latency exceeds
+// the input threshold. The p99 latency is only computed while the returned service is running.
+func NewBackpressureSignaling(threshold time.Duration, reg prometheus.Registerer) *BackpressureSignaling {
+	b := &BackpressureSignaling{
+		threshold: threshold,
+		p99:       atomic.NewDuration(0),
+		latency: promauto.With(reg).NewSummary(prometheus.SummaryOpts{
+			Name:       "cortex_query_frontend_backpressure_response_latency_seconds",
+			Help:       "Latency of the query responses tracked to decide whether to signal clients to back off. Quantiles keep track of the latencies over the last minute.",
+			Objectives: map[float64]float64{0.99: 0.001},
+			MaxAge:     backpressureLatencyWindow,
+			AgeBuckets: 6,
+		}),
+		active: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_query_frontend_backpressure_active",
+			Help: "Whether the query-frontend is signaling clients to back off because the p99 query response latency exceeds the configured threshold (1) or not (0).",
+		}),
+	}
+
+	b.Service = services.NewTimerService(backpressureUpdateInterval, nil, b.iteration, nil)
+	return b
+}
+
+// Wrap returns a handler tracking the response latency of the input handler, and adding a Retry-After
+// header to its 429 responses while the p99 latency exceeds the threshold.
+func (b *BackpressureSignaling) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bw := &backpressureResponseWriter{ResponseWriter: w, signaling: b, status: http.StatusOK}
+
+		start := time.Now()
+		next.ServeHTTP(bw, r)
+
+		// Rejected requests are not executed by the queriers, so their latency doesn't tell anything about the queriers load.
+		if bw.status != http.StatusTooManyRequests {
+			b.observe(time.Since(start))
+		}
+	})
+}
+
+// observe tracks the input query response latency.
+func (b *BackpressureSignaling) observe(latency time.Duration) {
+	b.latency.Observe(latency.Seconds())
+}
+
+func (b *BackpressureSignaling) iteration(_ context.Context) error {
+	b.update()
+	return nil
+}
+
+// update computes the p99 latency of the tracked query responses.
+func (b *BackpressureSignaling) update() {
+	m := &dto.Metric{}
+	if err := b.latency.Write(m); err != nil {
+		return
+	}
+
+	var p99 time.Duration
+	for _, q := range m.GetSummary().GetQuantile() {
+		if q.GetQuantile() == 0.99 && !math.IsNaN(q.GetValue()) {
+			p99 = time.Duration(q.GetValue() * float64(time.Second))
+		}
+	}
+	b.p99.Store(p99)
+
+	if p99 > b.threshold {
+		b.active.Set(1)
+	} else {
+		b.active.Set(0)
+	}
+}
+
+// retryAfter returns the value of the Retry-After header to add to the 429 responses, or an empty
+// string if the backpressure is not active. The clients are asked to wait for the current p99 latency.
+func (b *BackpressureSignaling) retryAfter() string {
+	p99 := b.p99.Load()
+	if p99 <= b.threshold {
+		return ""
+	}
+	return strconv.Itoa(int(math.Ceil(p99.Seconds())))
+}
+
+// backpressureResponseWriter is a http.ResponseWriter adding the Retry-After header to the 429 responses
+// while the backpressure is active, and keeping track of the response status code.
+type backpressureResponseWriter struct {
+	http.ResponseWriter
+
+	signaling   *BackpressureSignaling
+	status      int
+	wroteHeader bool
+}
+
+func (w *backpressureResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	if status == http.StatusTooManyRequests {
+		if retryAfter := w.signaling.retryAfter(); retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *backpressureResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressureSignaling(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	b := NewBackpressureSignaling(time.Second, reg)
+
+	status := http.StatusTooManyRequests
+	handler := b.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	serve := func() *http.Response {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/query", nil))
+		return w.Result()
+	}
+
+	assertActive := func(expected string) {
+		require.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_query_frontend_backpressure_active Whether the query-frontend is signaling clients to back off because the p99 query response latency exceeds the configured threshold (1) or not (0).
+			# TYPE cortex_query_frontend_backpressure_active gauge
+			cortex_query_frontend_backpressure_active `+expected+`
+		`), "cortex_query_frontend_backpressure_active"))
+	}
+
+	// No backpressure while the latency is below the threshold.
+	for i := 0; i < 200; i++ {
+		b.observe(100 * time.Millisecond)
+	}
+	b.update()
+	resp := serve()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Retry-After"))
+	assertActive("0")
+
+	// A single slow response out of 200 doesn't exceed the p99 latency.
+	b.observe(10 * time.Second)
+	b.update()
+	assert.Empty(t, serve().Header.Get("Retry-After"))
+	assertActive("0")
+
+	// The p99 latency is only computed periodically, so the backpressure is not activated right away.
+	for i := 0; i < 5; i++ {
+		b.observe(2500 * time.Millisecond)
+	}
+	assert.Empty(t, serve().Header.Get("Retry-After"))
+
+	// The backpressure is activated once the p99 latency exceeds the threshold.
+	b.update()
+	resp = serve()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "3", resp.Header.Get("Retry-After"))
+	assertActive("1")
+
+	// Only 429 responses get the Retry-After header.
+	status = http.StatusOK
+	resp = serve()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestBackpressureSignaling_ShouldNotTrackTheLatencyOfRejectedRequests(t *testing.T) {
+	b := NewBackpressureSignaling(time.Millisecond, prometheus.NewPedanticRegistry())
+
+	handler := b.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/query", nil))
+	assert.Empty(t, w.Result().Header.Get("Retry-After"))
+
+	m := &dto.Metric{}
+	require.NoError(t, b.latency.Write(m))
+	assert.Equal(t, uint64(0), m.GetSummary().GetSampleCount())
+}
@@ -50,12 +50,15 @@ type HandlerConfig struct {
 	LogQueriesLongerThan time.Duration `yaml:"log_queries_longer_than"`
 	MaxBodySize          int64         `yaml:"max_body_size" category:"advanced"`
 	QueryStatsEnabled    bool          `yaml:"query_stats_enabled" category:"advanced"`
+
+	BackpressureLatencyThreshold time.Duration `yaml:"backpressure_latency_threshold" category:"experimental"`
 }
 
 func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.LogQueriesLongerThan, "query-frontend.log-queries-longer-than", 0, "Log queries that are slower than the specified duration. Set to 0 to disable. Set to < 0 to enable on all queries.")
 	f.Int64Var(&cfg.MaxBodySize, "query-frontend.max-body-size", 10*1024*1024, "Max body size for downstream prometheus.")
 	f.BoolVar(&cfg.QueryStatsEnabled, "query-frontend.query-stats-enabled", true, "False to disable query statistics tracking. When enabled, a message with some statistics is logged for every query.")
+	f.DurationVar(&cfg.BackpressureLatencyThreshold, "query-frontend.backpressure-latency-threshold", 0, "When the p99 latency of the query responses of the last minute exceeds this threshold, a Retry-After header is added to all 429 responses, asking the clients to back off. 0 to disable.")
 }
 
 // Handler accepts queries and forwards them to RoundTripper. It can log slow queries,
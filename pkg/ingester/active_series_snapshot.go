@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"github.com/grafana/mimir/pkg/ingester/activeseries"
+)
+
+// activeSeriesSnapshotFilename is the name of the file in the tenant TSDB directory holding the snapshot
+// of the tenant active series.
+const activeSeriesSnapshotFilename = "active_series_snapshot"
+
+// activeSeriesSnapshotEnabled returns whether the active series are snapshotted on disk after each head
+// compaction cutting a block and when shutting down, along with the TSDB in-memory data, and restored when the TSDB is
+// opened at the next startup.
+func (i *Ingester) activeSeriesSnapshotEnabled() bool {
+	return i.cfg.ActiveSeriesMetricsEnabled && i.cfg.BlocksStorageConfig.TSDB.MemorySnapshotOnShutdown
+}
+
+// snapshotActiveSeries writes the snapshot of the tenant active series in the tenant TSDB directory, if enabled.
+func (i *Ingester) snapshotActiveSeries(userID string, db *userTSDB) {
+	if !i.activeSeriesSnapshotEnabled() {
+		return
+	}
+
+	if err := writeActiveSeriesSnapshot(db.activeSeries, i.cfg.BlocksStorageConfig.TSDB.BlocksDir(userID)); err != nil {
+		level.Warn(i.logger).Log("msg", "unable to write active series snapshot", "err", err, "user", userID)
+	}
+}
+
+// writeActiveSeriesSnapshot writes the snapshot of the input active series in the input TSDB directory.
+func writeActiveSeriesSnapshot(activeSeries *activeseries.ActiveSeries, dir string) error {
+	data, err := activeSeries.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	// Write the snapshot aside, so that a partially written snapshot is never read.
+	path := filepath.Join(dir, activeSeriesSnapshotFilename)
+	if err := os.WriteFile(path+".tmp", data, 0o666); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// restoreActiveSeriesSnapshot seeds the input active series with the snapshot in the input TSDB directory, if any.
+// The snapshot is removed once read, so that an outdated snapshot is never restored twice.
+func restoreActiveSeriesSnapshot(activeSeries *activeseries.ActiveSeries, dir string, logger log.Logger) {
+	path := filepath.Join(dir, activeSeriesSnapshotFilename)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	defer func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			level.Warn(logger).Log("msg", "failed to remove active series snapshot", "err", err)
+		}
+	}()
+
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to read active series snapshot", "err", err)
+		return
+	}
+
+	if err := activeSeries.UnmarshalBinary(data); err != nil {
+		level.Warn(logger).Log("msg", "discarded active series snapshot", "err", err)
+		return
+	}
+	level.Info(logger).Log("msg", "restored active series from snapshot")
+}
@@ -28,6 +28,18 @@ type ActiveSeries struct {
 	// The duration after which series become inactive.
 	// Also used to determine if enough time has passed since configuration reload for valid results.
 	timeout time.Duration
+
+	// The time of the last purge, and the number of active series matching each matcher as of the last
+	// purge. The latter is nil if the matchers have been reloaded since, or if the counts were not valid.
+	lastPurge          time.Time
+	lastActiveMatching []int
+}
+
+// CustomTrackerStatus is the status of a custom tracker as of the last time the active series were counted.
+type CustomTrackerStatus struct {
+	Matcher      string    `json:"matcher"`
+	ActiveSeries int       `json:"active_series"`
+	LastPurge    time.Time `json:"last_purge"`
 }
 
 // seriesStripe holds a subset of the series timestamps for a single tenant.
@@ -78,6 +90,7 @@ func (c *ActiveSeries) ReloadMatchers(asm *Matchers, now time.Time) {
 	}
 	c.matchers = asm
 	c.lastMatchersUpdate = now
+	c.lastActiveMatching = nil
 }
 
 func (c *ActiveSeries) CurrentConfig() CustomTrackersConfig {
@@ -110,8 +123,10 @@ func (c *ActiveSeries) Active(now time.Time) (int, []int, bool) {
 	defer c.mu.Unlock()
 	purgeTime := now.Add(-c.timeout)
 	c.purge(purgeTime)
+	c.lastPurge = now
 
 	if c.lastMatchersUpdate.After(purgeTime) {
+		c.lastActiveMatching = nil
 		return 0, nil, false
 	}
 
@@ -120,10 +135,33 @@ func (c *ActiveSeries) Active(now time.Time) (int, []int, bool) {
 	for s := 0; s < numStripes; s++ {
 		total += c.stripes[s].getTotalAndUpdateMatching(totalMatching)
 	}
+	c.lastActiveMatching = append(make([]int, 0, len(totalMatching)), totalMatching...)
 
 	return total, totalMatching, true
 }
 
+// CustomTrackersStatus returns the status of each custom tracker, by tracker name, as returned by the last call
+// to Active. The second return value is false if Active hasn't returned valid results since the last reload.
+func (c *ActiveSeries) CustomTrackersStatus() (map[string]CustomTrackerStatus, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lastActiveMatching == nil {
+		return nil, false
+	}
+
+	cfg := c.matchers.Config()
+	result := make(map[string]CustomTrackerStatus, len(c.lastActiveMatching))
+	for idx, name := range c.matchers.MatcherNames() {
+		result[name] = CustomTrackerStatus{
+			Matcher:      cfg.Matcher(name),
+			ActiveSeries: c.lastActiveMatching[idx],
+			LastPurge:    c.lastPurge,
+		}
+	}
+	return result, true
+}
+
 // getTotalAndUpdateMatching will return the total active series in the stripe and also update the slice provided
 // with each matcher's total.
 func (s *seriesStripe) getTotalAndUpdateMatching(matching []int) int {
@@ -255,6 +293,7 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 		if len(entries) == 1 {
 			ts := entries[0].nanos.Load()
 			if ts < keepUntilNanos {
+				s.matchers.Release(entries[0].matches)
 				delete(s.refs, fp)
 				continue
 			}
@@ -276,6 +315,7 @@ func (s *seriesStripe) purge(keepUntil time.Time) {
 		for i := 0; i < len(entries); {
 			ts := entries[i].nanos.Load()
 			if ts < keepUntilNanos {
+				s.matchers.Release(entries[i].matches)
 				entries = append(entries[:i], entries[i+1:]...)
 			} else {
 				if ts < oldest {
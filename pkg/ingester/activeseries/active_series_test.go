@@ -270,6 +270,57 @@ func TestActiveSeries_ReloadSeriesMatchers(t *testing.T) {
 	assert.True(t, valid)
 }
 
+func TestActiveSeries_CustomTrackersStatus(t *testing.T) {
+	ls1 := []labels.Label{{Name: "a", Value: "1"}}
+	ls2 := []labels.Label{{Name: "a", Value: "2"}}
+
+	asm := NewMatchers(mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": `{a="1"}`, "bar": `{a=~"1|2"}`}))
+
+	currentTime := time.Now()
+	c := NewActiveSeries(asm, DefaultTimeout)
+
+	// The active series have not been counted yet.
+	_, ok := c.CustomTrackersStatus()
+	assert.False(t, ok)
+
+	c.UpdateSeries(ls1, currentTime, copyFn)
+	c.UpdateSeries(ls2, currentTime, copyFn)
+	_, _, valid := c.Active(currentTime)
+	require.True(t, valid)
+
+	// New series are only reflected in the status once counted.
+	c.UpdateSeries([]labels.Label{{Name: "a", Value: "3"}}, currentTime, copyFn)
+
+	status, ok := c.CustomTrackersStatus()
+	require.True(t, ok)
+	assert.Equal(t, map[string]CustomTrackerStatus{
+		"foo": {Matcher: `{a="1"}`, ActiveSeries: 1, LastPurge: currentTime},
+		"bar": {Matcher: `{a=~"1|2"}`, ActiveSeries: 2, LastPurge: currentTime},
+	}, status)
+
+	// The status is not available until the counts are valid again after a reload.
+	c.ReloadMatchers(asm, currentTime)
+	_, ok = c.CustomTrackersStatus()
+	assert.False(t, ok)
+
+	_, _, valid = c.Active(currentTime)
+	require.False(t, valid)
+	_, ok = c.CustomTrackersStatus()
+	assert.False(t, ok)
+
+	currentTime = currentTime.Add(DefaultTimeout)
+	c.UpdateSeries(ls2, currentTime, copyFn)
+	_, _, valid = c.Active(currentTime)
+	require.True(t, valid)
+
+	status, ok = c.CustomTrackersStatus()
+	require.True(t, ok)
+	assert.Equal(t, map[string]CustomTrackerStatus{
+		"foo": {Matcher: `{a="1"}`, ActiveSeries: 0, LastPurge: currentTime},
+		"bar": {Matcher: `{a=~"1|2"}`, ActiveSeries: 1, LastPurge: currentTime},
+	}, status)
+}
+
 func TestActiveSeries_ReloadSeriesMatchers_LessMatchers(t *testing.T) {
 	ls1 := []labels.Label{{Name: "a", Value: "1"}}
 
@@ -484,3 +535,37 @@ func benchmarkPurge(b *testing.B, twice bool) {
 		}
 	}
 }
+
+func TestActiveSeries_CustomTrackerCardinalityLimit(t *testing.T) {
+	cfg, err := NewCustomTrackersConfigWithOptions(map[string]string{
+		"limited":   `{a=~".+"}`,
+		"unlimited": `{a=~".+"}`,
+	}, map[string]CustomTrackerOptions{"limited": {CardinalityLimit: 2}})
+	require.NoError(t, err)
+
+	asm := NewMatchers(cfg)
+	exceeded := 0
+	asm.OnCardinalityLimitExceeded(func(string) { exceeded++ })
+	c := NewActiveSeries(asm, DefaultTimeout)
+
+	// The series beyond the limit are not counted by the limited tracker.
+	for i := 0; i < 4; i++ {
+		c.UpdateSeries(labels.FromStrings("a", strconv.Itoa(i)), time.Unix(int64(i), 0), copyFn)
+	}
+	allActive, activeMatching, _ := c.Active(time.Unix(4, 0))
+	assert.Equal(t, 4, allActive)
+	assert.Equal(t, []int{2, 4}, activeMatching)
+	assert.Equal(t, 2, exceeded)
+
+	// Updating an already tracked series doesn't count towards the limit again.
+	c.UpdateSeries(labels.FromStrings("a", "3"), time.Unix(4, 0), copyFn)
+	assert.Equal(t, 2, exceeded)
+
+	// Purging the series counted by the limited tracker makes room for new series.
+	c.purge(time.Unix(2, 0))
+	c.UpdateSeries(labels.FromStrings("a", "4"), time.Unix(5, 0), copyFn)
+	allActive, activeMatching, _ = c.Active(time.Unix(5, 0))
+	assert.Equal(t, 3, allActive)
+	assert.Equal(t, []int{1, 3}, activeMatching)
+	assert.Equal(t, 2, exceeded)
+}
@@ -3,29 +3,99 @@
 package activeseries
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	amlabels "github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql/parser"
 	"gopkg.in/yaml.v3"
 )
 
 // CustomTrackersConfig configures active series custom trackers.
 // It can be set using a flag, or parsed from yaml.
 type CustomTrackersConfig struct {
-	source map[string]string
-	config map[string]labelsMatchers
-	string string
+	source  map[string]string
+	options map[string]CustomTrackerOptions // Only the trackers having non-default options.
+	config  map[string]labelsMatchersUnion
+	string  string
+}
+
+// CustomTrackerOptions are the optional settings of a custom tracker, which can only be set in yaml or JSON.
+type CustomTrackerOptions struct {
+	// Max number of active series the tracker can match, 0 if unlimited.
+	CardinalityLimit int `yaml:"cardinality_limit,omitempty" json:"cardinality_limit,omitempty"`
+	// Whether the tracker count is also exposed as a histogram, and its buckets. Defaults to DefaultHistogramBuckets.
+	ExposeHistogram  bool      `yaml:"expose_histogram,omitempty" json:"expose_histogram,omitempty"`
+	HistogramBuckets []float64 `yaml:"histogram_buckets,omitempty" json:"histogram_buckets,omitempty"`
+}
+
+// DefaultHistogramBuckets are the buckets of the custom trackers histograms, unless configured otherwise:
+// powers of 2 from 1 to 1<<20.
+var DefaultHistogramBuckets = prometheus.ExponentialBuckets(1, 2, 21)
+
+func (o CustomTrackerOptions) isDefault() bool {
+	return o.CardinalityLimit == 0 && !o.ExposeHistogram && len(o.HistogramBuckets) == 0
+}
+
+func (o CustomTrackerOptions) validate() error {
+	if o.CardinalityLimit < 0 {
+		return errors.New("cardinality limit must be greater than or equal to 0")
+	}
+	if len(o.HistogramBuckets) > 0 && !o.ExposeHistogram {
+		return errors.New("histogram buckets can only be set when the histogram is exposed")
+	}
+	for i := 1; i < len(o.HistogramBuckets); i++ {
+		if o.HistogramBuckets[i] <= o.HistogramBuckets[i-1] {
+			return errors.New("histogram buckets must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// String returns the canonical representation of the options, appended to the tracker definition in CustomTrackersConfig.String.
+func (o CustomTrackerOptions) String() string {
+	var sb strings.Builder
+	if o.CardinalityLimit > 0 {
+		sb.WriteString(" cardinality_limit=")
+		sb.WriteString(strconv.Itoa(o.CardinalityLimit))
+	}
+	if o.ExposeHistogram {
+		sb.WriteString(" expose_histogram=true")
+	}
+	if len(o.HistogramBuckets) > 0 {
+		sb.WriteString(" histogram_buckets=")
+		for i, b := range o.HistogramBuckets {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.FormatFloat(b, 'g', -1, 64))
+		}
+	}
+	return sb.String()
+}
+
+// customTrackerConfig is the yaml and JSON representation of a custom tracker having non-default options.
+type customTrackerConfig struct {
+	Matcher              string `yaml:"matcher" json:"matcher"`
+	CustomTrackerOptions `yaml:",inline"`
 }
 
 // ExampleDoc provides an example doc for this config, especially valuable since it's custom-unmarshaled.
 func (c CustomTrackersConfig) ExampleDoc() (comment string, yaml interface{}) {
 	return `The following configuration will count the active series coming from dev and prod namespaces for each tenant` +
-			` and label them as {name="dev"} and {name="prod"} in the cortex_ingester_active_series_custom_tracker metric.`,
+			` and label them as {name="dev"} and {name="prod"} in the cortex_ingester_active_series_custom_tracker metric.` +
+			` It will also count the active series having either a 5xx status_code or code label, labeled as {name="5xx"}.`,
 		map[string]string{
 			"dev":  `{namespace=~"dev-.*"}`,
 			"prod": `{namespace=~"prod-.*"}`,
+			"5xx":  `{status_code=~"5.."} | {code=~"5.."}`,
 		}
 }
 
@@ -33,13 +103,57 @@ func (c CustomTrackersConfig) Empty() bool {
 	return c.string == ""
 }
 
-// String is a canonical representation of the config, it is compatible with flag definition.
+// String is a canonical representation of the config, it is compatible with flag definition
+// unless any tracker has non-default options, which can't be set using a flag.
 // String is also needed to implement flag.Value.
 func (c CustomTrackersConfig) String() string {
 	return c.string
 }
 
-func customTrackersConfigString(cfg map[string]string) string {
+// Validate returns an error if any matchers definition of the config is not a valid PromQL series selector, or a union of
+// them. The matchers are parsed with a more permissive syntax when building the config, which accepts malformed definitions
+// like a selector missing its closing brace.
+func (c CustomTrackersConfig) Validate() error {
+	names := make([]string, 0, len(c.source))
+	for name := range c.source {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, alternative := range splitMatchersUnion(c.source[name]) {
+			if _, err := parser.ParseMetricSelector(strings.TrimSpace(alternative)); err != nil {
+				return fmt.Errorf("invalid matcher %q of active series custom tracker %s: %w", strings.TrimSpace(alternative), name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Matcher returns the matchers definition of the input tracker, as configured.
+func (c CustomTrackersConfig) Matcher(name string) string {
+	return c.source[name]
+}
+
+// CardinalityLimit returns the max number of active series the input tracker can match, or 0 if unlimited.
+func (c CustomTrackersConfig) CardinalityLimit(name string) int {
+	return c.options[name].CardinalityLimit
+}
+
+// HistogramBuckets returns the buckets of the histogram of the input tracker count, or nil if the tracker
+// count is not exposed as a histogram.
+func (c CustomTrackersConfig) HistogramBuckets(name string) []float64 {
+	opts := c.options[name]
+	if !opts.ExposeHistogram {
+		return nil
+	}
+	if len(opts.HistogramBuckets) == 0 {
+		return DefaultHistogramBuckets
+	}
+	return opts.HistogramBuckets
+}
+
+func customTrackersConfigString(cfg map[string]string, options map[string]CustomTrackerOptions) string {
 	if len(cfg) == 0 {
 		return ""
 	}
@@ -60,6 +174,7 @@ func customTrackersConfigString(cfg map[string]string) string {
 		sb.WriteString(name)
 		sb.WriteByte(':')
 		sb.WriteString(cfg[name])
+		sb.WriteString(options[name].String())
 	}
 
 	return sb.String()
@@ -98,7 +213,7 @@ func (c *CustomTrackersConfig) Set(s string) error {
 	}
 
 	// Recalculate the string after merging.
-	c.string = customTrackersConfigString(c.source)
+	c.string = customTrackersConfigString(c.source, c.options)
 	return nil
 }
 
@@ -123,36 +238,221 @@ func customTrackerFlagValueToMap(s string) (map[string]string, error) {
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
-// CustomTrackersConfig are marshaled in yaml as a map[string]string, with matcher names as keys and strings as matchers definitions.
+// CustomTrackersConfig are marshaled in yaml as a map, with matcher names as keys and either strings as matchers
+// definitions, or objects with the matchers definition and the options of the tracker as values.
 func (c *CustomTrackersConfig) UnmarshalYAML(value *yaml.Node) error {
-	stringMap := map[string]string{}
-	err := value.DecodeWithOptions(&stringMap, yaml.DecodeOptions{KnownFields: true})
+	nodes := map[string]yaml.Node{}
+	err := value.DecodeWithOptions(&nodes, yaml.DecodeOptions{KnownFields: true})
 	if err != nil {
 		return err
 	}
-	*c, err = NewCustomTrackersConfig(stringMap)
+
+	stringMap := make(map[string]string, len(nodes))
+	options := map[string]CustomTrackerOptions{}
+	for name, node := range nodes {
+		if node.Kind != yaml.MappingNode {
+			var matcher string
+			if err := node.DecodeWithOptions(&matcher, yaml.DecodeOptions{KnownFields: true}); err != nil {
+				return err
+			}
+			stringMap[name] = matcher
+			continue
+		}
+
+		var tracker customTrackerConfig
+		if err := node.DecodeWithOptions(&tracker, yaml.DecodeOptions{KnownFields: true}); err != nil {
+			return err
+		}
+		stringMap[name] = tracker.Matcher
+		options[name] = tracker.CustomTrackerOptions
+	}
+
+	*c, err = NewCustomTrackersConfigWithOptions(stringMap, options)
 	return err
 }
 
 // MarshalYAML implements yaml.Marshaler.
 func (c CustomTrackersConfig) MarshalYAML() (interface{}, error) {
-	return c.source, nil
+	return c.marshalable(), nil
 }
 
+// UnmarshalJSON implements json.Unmarshaler.
+// CustomTrackersConfig are marshaled in JSON as an object, with matcher names as keys and either strings as matchers
+// definitions, or objects with the matchers definition and the options of the tracker as values.
+func (c *CustomTrackersConfig) UnmarshalJSON(data []byte) error {
+	rawMap := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &rawMap); err != nil {
+		return err
+	}
+
+	stringMap := make(map[string]string, len(rawMap))
+	options := map[string]CustomTrackerOptions{}
+	for name, raw := range rawMap {
+		var matcher string
+		if err := json.Unmarshal(raw, &matcher); err == nil {
+			stringMap[name] = matcher
+			continue
+		}
+
+		var tracker customTrackerConfig
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&tracker); err != nil {
+			return err
+		}
+		stringMap[name] = tracker.Matcher
+		options[name] = tracker.CustomTrackerOptions
+	}
+
+	var err error
+	*c, err = NewCustomTrackersConfigWithOptions(stringMap, options)
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c CustomTrackersConfig) MarshalJSON() ([]byte, error) {
+	if c.source == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c.marshalable())
+}
+
+// marshalable returns the representation of the config used to marshal it, where the trackers
+// having non-default options are represented as objects, and the other ones as plain strings.
+func (c CustomTrackersConfig) marshalable() interface{} {
+	if len(c.options) == 0 {
+		return c.source
+	}
+
+	m := make(map[string]interface{}, len(c.source))
+	for name, matcher := range c.source {
+		if opts, ok := c.options[name]; ok {
+			m[name] = customTrackerConfig{Matcher: matcher, CustomTrackerOptions: opts}
+		} else {
+			m[name] = matcher
+		}
+	}
+	return m
+}
+
+// NewCustomTrackersConfig builds a CustomTrackersConfig from a map of tracker names to matchers definitions.
+// A matchers definition can contain multiple matchers separated by |, in which case the tracker counts the
+// series matching any of them.
 func NewCustomTrackersConfig(m map[string]string) (c CustomTrackersConfig, err error) {
+	return NewCustomTrackersConfigWithOptions(m, nil)
+}
+
+// NewCustomTrackersConfigWithOptions is like NewCustomTrackersConfig, but also sets the options of the trackers,
+// by tracker name. Trackers with no options use the default ones.
+func NewCustomTrackersConfigWithOptions(m map[string]string, options map[string]CustomTrackerOptions) (c CustomTrackersConfig, err error) {
 	c.source = m
-	c.config = map[string]labelsMatchers{}
-	for name, matcher := range m {
-		sm, err := amlabels.ParseMatchers(matcher)
-		if err != nil {
+	c.config = map[string]labelsMatchersUnion{}
+	for name, opts := range options {
+		if _, ok := m[name]; !ok {
+			return c, fmt.Errorf("can't set the options of active series matcher %s: matcher not found", name)
+		}
+		if err := opts.validate(); err != nil {
 			return c, fmt.Errorf("can't build active series matcher %s: %w", name, err)
 		}
-		matchers := make(labelsMatchers, len(sm))
-		for i, m := range sm {
-			matchers[i] = amlabelMatcherToProm(m)
+		if !opts.isDefault() {
+			if c.options == nil {
+				c.options = map[string]CustomTrackerOptions{}
+			}
+			c.options[name] = opts
+		}
+	}
+	for name, matcher := range m {
+		var union labelsMatchersUnion
+		for _, alternative := range splitMatchersUnion(matcher) {
+			alternative = strings.TrimSpace(alternative)
+			if alternative == "" {
+				return c, fmt.Errorf("can't build active series matcher %s: empty matcher in %q", name, matcher)
+			}
+
+			sm, err := amlabels.ParseMatchers(alternative)
+			if err != nil {
+				return c, fmt.Errorf("can't build active series matcher %s: %w", name, err)
+			}
+			matchers := make(labelsMatchers, len(sm))
+			for i, m := range sm {
+				matchers[i] = amlabelMatcherToProm(m)
+			}
+			union = append(union, matchers)
 		}
-		c.config[name] = matchers
+		c.config[name] = union
 	}
-	c.string = customTrackersConfigString(c.source)
+	c.string = customTrackersConfigString(c.source, c.options)
 	return c, nil
 }
+
+// MergeCustomTrackersConfigs returns the custom trackers of both configs. The trackers of the override config
+// replace the ones of the base config having the same name, along with their options.
+func MergeCustomTrackersConfigs(base, override CustomTrackersConfig) CustomTrackersConfig {
+	if base.Empty() {
+		return override
+	}
+	if override.Empty() {
+		return base
+	}
+
+	merged := CustomTrackersConfig{
+		source: make(map[string]string, len(base.source)+len(override.source)),
+		config: make(map[string]labelsMatchersUnion, len(base.config)+len(override.config)),
+	}
+	for _, c := range []CustomTrackersConfig{base, override} {
+		for name, matcher := range c.source {
+			merged.source[name] = matcher
+			merged.config[name] = c.config[name]
+
+			if opts, ok := c.options[name]; ok {
+				if merged.options == nil {
+					merged.options = map[string]CustomTrackerOptions{}
+				}
+				merged.options[name] = opts
+			} else {
+				delete(merged.options, name)
+			}
+		}
+	}
+	merged.string = customTrackersConfigString(merged.source, merged.options)
+	return merged
+}
+
+// splitMatchersUnion splits the input matchers definition on the | separators between two selectors, like
+// in `{foo="bar"} | {baz="qux"}`. Any other |, like in regular expressions alternations, is not a separator,
+// even if the label value is not quoted. A trailing separator is split too, so that it's reported as an
+// empty matcher.
+func splitMatchersUnion(s string) []string {
+	var (
+		parts   []string
+		start   int
+		quote   rune
+		escaped bool
+	)
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '|' && isMatchersUnionSeparator(s[:i], s[i+1:]):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// isMatchersUnionSeparator returns whether the | between the input before and after strings separates two
+// selectors: it must follow a closing brace, and precede an opening brace or the end of the definition.
+func isMatchersUnionSeparator(before, after string) bool {
+	before = strings.TrimRightFunc(before, unicode.IsSpace)
+	after = strings.TrimLeftFunc(after, unicode.IsSpace)
+	return strings.HasSuffix(before, "}") && (after == "" || strings.HasPrefix(after, "{"))
+}
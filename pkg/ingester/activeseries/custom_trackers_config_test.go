@@ -3,10 +3,13 @@
 package activeseries
 
 import (
+	"encoding/json"
 	"flag"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -89,6 +92,26 @@ func TestCustomTrackersConfigs(t *testing.T) {
 			flags:    []string{`-ingester.active-series-custom-trackers=foo:{foo="bar"}`, `-ingester.active-series-custom-trackers=baz:{baz="bar"}`},
 			expected: mustNewCustomTrackersConfigFromMap(t, map[string]string{`foo`: `{foo="bar"}`, `baz`: `{baz="bar"}`}),
 		},
+		{
+			name:     "multiple matchers separated by pipe for one name",
+			flags:    []string{`-ingester.active-series-custom-trackers=foo:{foo="bar"}|{baz="bar"}`},
+			expected: mustNewCustomTrackersConfigFromMap(t, map[string]string{`foo`: `{foo="bar"}|{baz="bar"}`}),
+		},
+		{
+			name:     "pipe within regular expression is not a separator",
+			flags:    []string{`-ingester.active-series-custom-trackers=foo:{foo=~"bar|baz"}`},
+			expected: mustNewCustomTrackersConfigFromMap(t, map[string]string{`foo`: `{foo=~"bar|baz"}`}),
+		},
+		{
+			name:     "pipe within unquoted regular expression is not a separator",
+			flags:    []string{`-ingester.active-series-custom-trackers=foo:{job=~api|web}`},
+			expected: mustNewCustomTrackersConfigFromMap(t, map[string]string{`foo`: `{job=~api|web}`}),
+		},
+		{
+			name:  "empty matcher separated by pipe fails",
+			flags: []string{`-ingester.active-series-custom-trackers=foo:{foo="bar"}|`},
+			error: errors.New(`invalid value "foo:{foo=\"bar\"}|" for flag -ingester.active-series-custom-trackers: can't build active series matcher foo: empty matcher in "{foo=\"bar\"}|"`),
+		},
 		{
 			name:  "two matchers with same name in same flag",
 			flags: []string{`-ingester.active-series-custom-trackers=foo:{foo="bar"};foo:{boo="bam"}`},
@@ -125,6 +148,15 @@ func TestCustomTrackersConfigs(t *testing.T) {
 	}
 }
 
+func TestCustomTrackersConfigs_ShouldNotSplitUnquotedRegexpAlternations(t *testing.T) {
+	config := mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": `{job=~api|web}`})
+
+	require.Len(t, config.config["foo"], 1)
+	assert.True(t, config.config["foo"].Matches(labels.FromStrings("job", "api")))
+	assert.True(t, config.config["foo"].Matches(labels.FromStrings("job", "web")))
+	assert.False(t, config.config["foo"].Matches(labels.FromStrings("job", "db")))
+}
+
 func TestCustomTrackerConfig_Equality(t *testing.T) {
 	configSets := [][]CustomTrackersConfig{
 		{
@@ -210,6 +242,7 @@ func TestTrackersConfigs_SerializeDeserialize(t *testing.T) {
 	sourceYAML := `
     baz: "{baz='bar'}"
     foo: "{foo='bar'}"
+    qux: "{qux='bar'} | {qux=~'baz|bam'}"
     `
 
 	obj := mustNewCustomTrackersConfigDeserializedFromYaml(t, sourceYAML)
@@ -222,4 +255,280 @@ func TestTrackersConfigs_SerializeDeserialize(t *testing.T) {
 		require.NoError(t, err, "Failed to deserialize serialized object")
 		assert.Equal(t, obj, reSerialized)
 	})
+
+	t.Run("ShouldResultInTheSameStringWhenSetFromString", func(t *testing.T) {
+		fromString := mustNewCustomTrackersConfigFromString(t, obj.String())
+		assert.Equal(t, obj.String(), fromString.String())
+		assert.Equal(t, obj, fromString)
+	})
+}
+
+func TestTrackersConfigs_JSON(t *testing.T) {
+	t.Run("ShouldSerializeToAnObjectOfMatchersByName", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigFromMap(t, map[string]string{
+			"baz": `{baz='bar'}`,
+			"foo": `{foo='bar'} | {foo="baz"}`,
+		})
+
+		out, err := json.Marshal(config)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"baz": "{baz='bar'}", "foo": "{foo='bar'} | {foo=\"baz\"}"}`, string(out))
+	})
+
+	t.Run("ShouldSerializeEmptyConfigToAnEmptyObject", func(t *testing.T) {
+		out, err := json.Marshal(CustomTrackersConfig{})
+		require.NoError(t, err)
+		assert.Equal(t, `{}`, string(out))
+	})
+
+	t.Run("ShouldSerializeDeserializeResultsTheSame", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigFromString(t, `baz:{baz='bar'};foo:{foo='bar'}|{foo="baz"}`)
+
+		out, err := json.Marshal(config)
+		require.NoError(t, err)
+
+		reSerialized := CustomTrackersConfig{}
+		require.NoError(t, json.Unmarshal(out, &reSerialized))
+		assert.Equal(t, config, reSerialized)
+		assert.Equal(t, config.String(), reSerialized.String())
+	})
+
+	t.Run("ShouldBeEqualToTheYAMLDeserializedConfig", func(t *testing.T) {
+		fromJSON := CustomTrackersConfig{}
+		require.NoError(t, json.Unmarshal([]byte(`{"baz": "{baz='bar'}", "foo": "{foo='bar'}"}`), &fromJSON))
+
+		fromYAML := mustNewCustomTrackersConfigDeserializedFromYaml(t, `
+            baz: "{baz='bar'}"
+            foo: "{foo='bar'}"`)
+
+		assert.Equal(t, fromYAML, fromJSON)
+		assert.Equal(t, fromYAML.String(), fromJSON.String())
+	})
+
+	t.Run("ShouldErrorOnMalformedInputWithTheSameErrorAsYAML", func(t *testing.T) {
+		for _, matcher := range []string{`123`, `{foo}`, `{foo="bar"}|`} {
+			fromJSON := CustomTrackersConfig{}
+			jsonErr := json.Unmarshal([]byte(`{"foo": "`+strings.ReplaceAll(matcher, `"`, `\"`)+`"}`), &fromJSON)
+			require.Error(t, jsonErr)
+
+			fromYAML := CustomTrackersConfig{}
+			yamlErr := yaml.Unmarshal([]byte(`foo: '`+matcher+`'`), &fromYAML)
+			require.Error(t, yamlErr)
+
+			assert.Equal(t, yamlErr.Error(), jsonErr.Error())
+		}
+	})
+
+	t.Run("ShouldErrorOnInvalidJSON", func(t *testing.T) {
+		config := CustomTrackersConfig{}
+		assert.Error(t, json.Unmarshal([]byte(`["foo"]`), &config))
+	})
+}
+
+func TestTrackersConfigs_CardinalityLimit(t *testing.T) {
+	sourceYAML := `
+        baz: "{baz='bar'}"
+        foo:
+          matcher: "{foo='bar'}"
+          cardinality_limit: 10
+    `
+
+	t.Run("ShouldDeserializeTheCardinalityLimitOfTheTrackers", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigDeserializedFromYaml(t, sourceYAML)
+
+		expected, err := NewCustomTrackersConfigWithOptions(map[string]string{
+			"baz": "{baz='bar'}",
+			"foo": "{foo='bar'}",
+		}, map[string]CustomTrackerOptions{"foo": {CardinalityLimit: 10}})
+		require.NoError(t, err)
+		assert.Equal(t, expected, config)
+		assert.Equal(t, 10, config.CardinalityLimit("foo"))
+		assert.Equal(t, 0, config.CardinalityLimit("baz"))
+		assert.Equal(t, `baz:{baz='bar'};foo:{foo='bar'} cardinality_limit=10`, config.String())
+	})
+
+	t.Run("ShouldSerializeDeserializeResultsTheSame", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigDeserializedFromYaml(t, sourceYAML)
+
+		out, err := yaml.Marshal(config)
+		require.NoError(t, err)
+		fromYAML := CustomTrackersConfig{}
+		require.NoError(t, yaml.Unmarshal(out, &fromYAML))
+		assert.Equal(t, config, fromYAML)
+
+		out, err = json.Marshal(config)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"baz": "{baz='bar'}", "foo": {"matcher": "{foo='bar'}", "cardinality_limit": 10}}`, string(out))
+		fromJSON := CustomTrackersConfig{}
+		require.NoError(t, json.Unmarshal(out, &fromJSON))
+		assert.Equal(t, config, fromJSON)
+	})
+
+	t.Run("ShouldNotChangeTheConfigWhenTheLimitIsZero", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigDeserializedFromYaml(t, `
+            foo:
+              matcher: "{foo='bar'}"
+              cardinality_limit: 0`)
+
+		assert.Equal(t, mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": "{foo='bar'}"}), config)
+	})
+
+	t.Run("ShouldErrorOnInvalidInput", func(t *testing.T) {
+		for _, input := range []string{
+			"foo:\n  matcher: \"{foo='bar'}\"\n  cardinality_limit: -1",
+			"foo:\n  matcher: \"{foo='bar'}\"\n  unknown: 1",
+			"foo:\n  cardinality_limit: 10",
+		} {
+			config := CustomTrackersConfig{}
+			assert.Error(t, yaml.Unmarshal([]byte(input), &config), input)
+		}
+
+		for _, input := range []string{
+			`{"foo": {"matcher": "{foo='bar'}", "cardinality_limit": -1}}`,
+			`{"foo": {"matcher": "{foo='bar'}", "unknown": 1}}`,
+			`{"foo": 10}`,
+		} {
+			config := CustomTrackersConfig{}
+			assert.Error(t, json.Unmarshal([]byte(input), &config), input)
+		}
+	})
+}
+
+func TestTrackersConfigs_Histogram(t *testing.T) {
+	t.Run("ShouldDeserializeTheHistogramOptionsOfTheTrackers", func(t *testing.T) {
+		config := mustNewCustomTrackersConfigDeserializedFromYaml(t, `
+            baz: "{baz='bar'}"
+            foo:
+              matcher: "{foo='bar'}"
+              expose_histogram: true
+            qux:
+              matcher: "{qux='bar'}"
+              expose_histogram: true
+              histogram_buckets: [10, 100, 1000]`)
+
+		assert.Nil(t, config.HistogramBuckets("baz"))
+		assert.Equal(t, DefaultHistogramBuckets, config.HistogramBuckets("foo"))
+		assert.Equal(t, []float64{10, 100, 1000}, config.HistogramBuckets("qux"))
+		assert.Equal(t, `baz:{baz='bar'};foo:{foo='bar'} expose_histogram=true;qux:{qux='bar'} expose_histogram=true histogram_buckets=10,100,1000`, config.String())
+
+		out, err := yaml.Marshal(config)
+		require.NoError(t, err)
+		fromYAML := CustomTrackersConfig{}
+		require.NoError(t, yaml.Unmarshal(out, &fromYAML))
+		assert.Equal(t, config, fromYAML)
+
+		out, err = json.Marshal(config)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"baz": "{baz='bar'}",
+			"foo": {"matcher": "{foo='bar'}", "expose_histogram": true},
+			"qux": {"matcher": "{qux='bar'}", "expose_histogram": true, "histogram_buckets": [10, 100, 1000]}
+		}`, string(out))
+		fromJSON := CustomTrackersConfig{}
+		require.NoError(t, json.Unmarshal(out, &fromJSON))
+		assert.Equal(t, config, fromJSON)
+	})
+
+	t.Run("ShouldDefaultToPowersOfTwoBuckets", func(t *testing.T) {
+		require.Len(t, DefaultHistogramBuckets, 21)
+		assert.Equal(t, float64(1), DefaultHistogramBuckets[0])
+		assert.Equal(t, float64(1<<20), DefaultHistogramBuckets[20])
+	})
+
+	t.Run("ShouldErrorOnInvalidBuckets", func(t *testing.T) {
+		for input, expectedErr := range map[string]string{
+			"foo:\n  matcher: \"{foo='bar'}\"\n  histogram_buckets: [1, 2]":                           "can't build active series matcher foo: histogram buckets can only be set when the histogram is exposed",
+			"foo:\n  matcher: \"{foo='bar'}\"\n  expose_histogram: true\n  histogram_buckets: [2, 1]": "can't build active series matcher foo: histogram buckets must be in increasing order",
+		} {
+			config := CustomTrackersConfig{}
+			assert.EqualError(t, yaml.Unmarshal([]byte(input), &config), expectedErr)
+		}
+	})
+}
+
+func TestMergeCustomTrackersConfigs(t *testing.T) {
+	base, err := NewCustomTrackersConfigWithOptions(map[string]string{
+		"foo": "{foo='bar'}",
+		"baz": "{baz='bar'}",
+	}, map[string]CustomTrackerOptions{"foo": {CardinalityLimit: 10}})
+	require.NoError(t, err)
+
+	t.Run("ShouldAddTheTrackersOfBothConfigs", func(t *testing.T) {
+		override := mustNewCustomTrackersConfigFromMap(t, map[string]string{"qux": "{qux='bar'}"})
+
+		expected, err := NewCustomTrackersConfigWithOptions(map[string]string{
+			"foo": "{foo='bar'}",
+			"baz": "{baz='bar'}",
+			"qux": "{qux='bar'}",
+		}, map[string]CustomTrackerOptions{"foo": {CardinalityLimit: 10}})
+		require.NoError(t, err)
+
+		merged := MergeCustomTrackersConfigs(base, override)
+		assert.Equal(t, expected, merged)
+		assert.Equal(t, `baz:{baz='bar'};foo:{foo='bar'} cardinality_limit=10;qux:{qux='bar'}`, merged.String())
+	})
+
+	t.Run("ShouldReplaceTheBaseTrackersWithTheSameName", func(t *testing.T) {
+		override, err := NewCustomTrackersConfigWithOptions(map[string]string{
+			"foo": "{foo='override'}",
+			"baz": "{baz='override'}",
+		}, map[string]CustomTrackerOptions{"baz": {ExposeHistogram: true}})
+		require.NoError(t, err)
+
+		expected, err := NewCustomTrackersConfigWithOptions(map[string]string{
+			"foo": "{foo='override'}",
+			"baz": "{baz='override'}",
+		}, map[string]CustomTrackerOptions{"baz": {ExposeHistogram: true}})
+		require.NoError(t, err)
+
+		merged := MergeCustomTrackersConfigs(base, override)
+		assert.Equal(t, expected, merged)
+		assert.Equal(t, 0, merged.CardinalityLimit("foo"))
+		assert.Equal(t, `baz:{baz='override'} expose_histogram=true;foo:{foo='override'}`, merged.String())
+	})
+
+	t.Run("ShouldNotModifyTheInputConfigs", func(t *testing.T) {
+		override := mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": "{foo='override'}"})
+		baseString, overrideString := base.String(), override.String()
+
+		MergeCustomTrackersConfigs(base, override)
+		assert.Equal(t, baseString, base.String())
+		assert.Equal(t, "{foo='bar'}", base.source["foo"])
+		assert.Equal(t, 10, base.CardinalityLimit("foo"))
+		assert.Equal(t, overrideString, override.String())
+	})
+
+	t.Run("ShouldReturnTheOtherConfigWhenOneIsEmpty", func(t *testing.T) {
+		assert.Equal(t, base, MergeCustomTrackersConfigs(base, CustomTrackersConfig{}))
+		assert.Equal(t, base, MergeCustomTrackersConfigs(CustomTrackersConfig{}, base))
+		assert.True(t, MergeCustomTrackersConfigs(CustomTrackersConfig{}, CustomTrackersConfig{}).Empty())
+	})
+}
+
+func TestTrackersConfigs_Validate(t *testing.T) {
+	for _, matcher := range []string{
+		`{foo="bar"}`,
+		`{foo='bar', baz!~"qux.*"}`,
+		`{foo=""}`,
+		`{foo="bar"} | {foo=~"b|z"}`,
+	} {
+		config := mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": matcher})
+		assert.NoError(t, config.Validate(), matcher)
+	}
+
+	// These matchers are accepted when building the config, but they're not valid series selectors.
+	for matcher, expectedErr := range map[string]string{
+		`{foo="bar"`:               `invalid matcher "{foo=\"bar\"" of active series custom tracker foo`,
+		`{foo=bar}`:                `invalid matcher "{foo=bar}" of active series custom tracker foo`,
+		`foo="bar"`:                `invalid matcher "foo=\"bar\"" of active series custom tracker foo`,
+		`{foo="bar"} | {foo="baz"`: `invalid matcher "{foo=\"baz\"" of active series custom tracker foo`,
+		`{foo="bar"} | {baz=~.+}`:  `invalid matcher "{baz=~.+}" of active series custom tracker foo`,
+	} {
+		config := mustNewCustomTrackersConfigFromMap(t, map[string]string{"foo": matcher, "bar": `{bar="baz"}`})
+		err := config.Validate()
+		require.Error(t, err, matcher)
+		assert.Contains(t, err.Error(), expectedErr)
+	}
+
+	assert.NoError(t, CustomTrackersConfig{}.Validate())
 }
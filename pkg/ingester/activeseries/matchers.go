@@ -7,6 +7,7 @@ import (
 
 	amlabels "github.com/prometheus/alertmanager/pkg/labels"
 	"github.com/prometheus/prometheus/model/labels"
+	"go.uber.org/atomic"
 )
 
 func NewMatchers(matchersConfig CustomTrackersConfig) *Matchers {
@@ -14,6 +15,8 @@ func NewMatchers(matchersConfig CustomTrackersConfig) *Matchers {
 	for name, matchers := range matchersConfig.config {
 		asm.matchers = append(asm.matchers, matchers)
 		asm.names = append(asm.names, name)
+		asm.cardinalityLimits = append(asm.cardinalityLimits, matchersConfig.CardinalityLimit(name))
+		asm.matchedSeries = append(asm.matchedSeries, atomic.NewInt64(0))
 	}
 	// Sort the result to make it deterministic for tests.
 	// Order doesn't matter for the functionality as long as the order remains consistent during the execution of the program.
@@ -24,7 +27,21 @@ func NewMatchers(matchersConfig CustomTrackersConfig) *Matchers {
 type Matchers struct {
 	cfg      CustomTrackersConfig
 	names    []string
-	matchers []labelsMatchers
+	matchers []labelsMatchersUnion
+
+	// Max number of series each matcher can match (0 if unlimited), and number of series currently matched
+	// by each matcher. The number of matched series is only tracked for the matchers having a limit.
+	cardinalityLimits []int
+	matchedSeries     []*atomic.Int64
+
+	// Called with the matcher name each time a series is not matched because the matcher reached its cardinality limit.
+	onCardinalityLimitExceeded func(name string)
+}
+
+// OnCardinalityLimitExceeded sets the function called with the matcher name each time a series is not matched
+// because the matcher reached its cardinality limit. It must be called before the Matchers are used.
+func (m *Matchers) OnCardinalityLimitExceeded(f func(name string)) {
+	m.onCardinalityLimitExceeded = f
 }
 
 func (m *Matchers) MatcherNames() []string {
@@ -35,17 +52,63 @@ func (m *Matchers) Config() CustomTrackersConfig {
 	return m.cfg
 }
 
+// Matches returns which matchers the input new series matches. A series is not matched by a matcher which already
+// reached its cardinality limit, and otherwise counts towards the limit until it's released by calling Release.
 func (m *Matchers) Matches(series labels.Labels) []bool {
 	if len(m.matchers) == 0 {
 		return nil
 	}
 	matches := make([]bool, len(m.matchers))
 	for i, sm := range m.matchers {
-		matches[i] = sm.Matches(series)
+		if !sm.Matches(series) {
+			continue
+		}
+		if limit := m.cardinalityLimits[i]; limit > 0 && m.matchedSeries[i].Inc() > int64(limit) {
+			m.matchedSeries[i].Dec()
+			if m.onCardinalityLimitExceeded != nil {
+				m.onCardinalityLimitExceeded(m.names[i])
+			}
+			continue
+		}
+		matches[i] = true
 	}
 	return matches
 }
 
+// Release releases the matches previously returned by Matches for a series which is no longer tracked,
+// so that it doesn't count towards the cardinality limit of the matchers anymore.
+func (m *Matchers) Release(matches []bool) {
+	for i, ok := range matches {
+		if ok && m.cardinalityLimits[i] > 0 {
+			m.matchedSeries[i].Dec()
+		}
+	}
+}
+
+// restore makes the input matches, restored from a snapshot, count towards the cardinality limit of the matchers.
+// The matches of the matchers which already reached their limit are dropped.
+func (m *Matchers) restore(matches []bool) {
+	for i, ok := range matches {
+		if ok && m.cardinalityLimits[i] > 0 && m.matchedSeries[i].Inc() > int64(m.cardinalityLimits[i]) {
+			m.matchedSeries[i].Dec()
+			matches[i] = false
+		}
+	}
+}
+
+// labelsMatchersUnion is a list of labelsMatchers, matching a label set if any of them matches it.
+type labelsMatchersUnion []labelsMatchers
+
+// Matches checks whether any of the labelsMatchers is fulfilled against the given label set, checking them in order.
+func (u labelsMatchersUnion) Matches(lset labels.Labels) bool {
+	for _, ms := range u {
+		if ms.Matches(lset) {
+			return true
+		}
+	}
+	return false
+}
+
 // labelsMatchers is like alertmanager's labels.Matchers but for Prometheus' labels.Matcher slice
 type labelsMatchers []*labels.Matcher
 
@@ -71,6 +134,8 @@ func (m *Matchers) Less(i, j int) bool {
 func (m *Matchers) Swap(i, j int) {
 	m.names[i], m.names[j] = m.names[j], m.names[i]
 	m.matchers[i], m.matchers[j] = m.matchers[j], m.matchers[i]
+	m.cardinalityLimits[i], m.cardinalityLimits[j] = m.cardinalityLimits[j], m.cardinalityLimits[i]
+	m.matchedSeries[i], m.matchedSeries[j] = m.matchedSeries[j], m.matchedSeries[i]
 }
 
 func amlabelMatcherToProm(m *amlabels.Matcher) *labels.Matcher {
@@ -86,10 +86,53 @@ func TestMatcher_MatchesSeries(t *testing.T) {
 	}
 }
 
+func TestMatcher_MatchesSeriesWithMultipleMatchersPerName(t *testing.T) {
+	asm := NewMatchers(mustNewCustomTrackersConfigFromMap(t, map[string]string{
+		"5xx":    `{status_code=~"5.."} | {code=~"5..", job="api"}`,
+		"foo_or": `{foo=~"bar|baz"}|{foo="qux"}`,
+	}))
+
+	for _, tc := range []struct {
+		series   labels.Labels
+		expected []bool
+	}{
+		{
+			series:   labels.Labels{{Name: "status_code", Value: "500"}},
+			expected: []bool{true, false},
+		},
+		{
+			series:   labels.Labels{{Name: "code", Value: "503"}, {Name: "job", Value: "api"}},
+			expected: []bool{true, false},
+		},
+		{
+			series:   labels.Labels{{Name: "code", Value: "503"}, {Name: "job", Value: "web"}},
+			expected: []bool{false, false},
+		},
+		{
+			series:   labels.Labels{{Name: "foo", Value: "baz"}},
+			expected: []bool{false, true},
+		},
+		{
+			series:   labels.Labels{{Name: "foo", Value: "qux"}},
+			expected: []bool{false, true},
+		},
+		{
+			series:   labels.Labels{{Name: "foo", Value: "bar|baz"}},
+			expected: []bool{false, false},
+		},
+	} {
+		t.Run(tc.series.String(), func(t *testing.T) {
+			assert.Equal(t, tc.expected, asm.Matches(tc.series))
+		})
+	}
+}
+
 func TestCustomTrackersConfigs_MalformedMatcher(t *testing.T) {
 	for _, matcher := range []string{
 		`{foo}`,
 		`{foo=~"}`,
+		`{foo="bar"}|{foo}`,
+		`{foo="bar"} | `,
 	} {
 		t.Run(matcher, func(t *testing.T) {
 			config := map[string]string{
@@ -121,3 +164,35 @@ func TestAmlabelMatchersToProm_MatchTypeValues(t *testing.T) {
 		_ = (lastType + 1).String()
 	}, "amlabels.MatchNotRegexp is expected to be the last enum value, update the test and check mapping")
 }
+
+func TestMatcher_MatchesSeriesWithCardinalityLimit(t *testing.T) {
+	cfg, err := NewCustomTrackersConfigWithOptions(map[string]string{
+		"limited":   `{foo="bar"}`,
+		"unlimited": `{foo!=""}`,
+	}, map[string]CustomTrackerOptions{"limited": {CardinalityLimit: 2}})
+	require.NoError(t, err)
+
+	asm := NewMatchers(cfg)
+	exceeded := map[string]int{}
+	asm.OnCardinalityLimitExceeded(func(name string) { exceeded[name]++ })
+
+	series := func(id string) labels.Labels {
+		return labels.Labels{{Name: "foo", Value: "bar"}, {Name: "id", Value: id}}
+	}
+
+	first := asm.Matches(series("1"))
+	assert.Equal(t, []bool{true, true}, first)
+	assert.Equal(t, []bool{true, true}, asm.Matches(series("2")))
+	assert.Empty(t, exceeded)
+
+	// The series beyond the limit are not matched by the limited matcher.
+	assert.Equal(t, []bool{false, true}, asm.Matches(series("3")))
+	assert.Equal(t, []bool{false, true}, asm.Matches(series("4")))
+	assert.Equal(t, map[string]int{"limited": 2}, exceeded)
+
+	// Releasing a series makes room for a new one.
+	asm.Release(first)
+	assert.Equal(t, []bool{true, true}, asm.Matches(series("5")))
+	assert.Equal(t, []bool{false, true}, asm.Matches(series("6")))
+	assert.Equal(t, map[string]int{"limited": 3}, exceeded)
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package activeseries
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"go.uber.org/atomic"
+)
+
+// snapshotVersion is the version of the format of the snapshots written by MarshalBinary.
+const snapshotVersion = 1
+
+var (
+	ErrSnapshotVersionMismatch = errors.New("unsupported active series snapshot version")
+	ErrSnapshotConfigMismatch  = errors.New("the active series snapshot was taken with a different custom trackers config")
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler. It returns a snapshot of the active series, along with
+// the series counted by each custom tracker, which can be used to seed the active series with UnmarshalBinary.
+func (c *ActiveSeries) MarshalBinary() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := c.matchers.MatcherNames()
+	snapshot := ActiveSeriesCustomTrackersSnapshot{
+		Version:  snapshotVersion,
+		Config:   c.matchers.Config().String(),
+		Trackers: make([]SnapshotTracker, len(names)),
+	}
+	for i, name := range names {
+		snapshot.Trackers[i].Name = name
+	}
+
+	for s := 0; s < numStripes; s++ {
+		snapshot.Series = c.stripes[s].appendSnapshot(snapshot.Series, snapshot.Trackers)
+	}
+
+	return snapshot.Marshal()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It seeds the active series with a snapshot returned
+// by MarshalBinary, without matching the series against the custom trackers again. The snapshot is rejected
+// if it has been taken with a different custom trackers config than the current one.
+func (c *ActiveSeries) UnmarshalBinary(data []byte) error {
+	snapshot := ActiveSeriesCustomTrackersSnapshot{}
+	if err := snapshot.Unmarshal(data); err != nil {
+		return err
+	}
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("%w %d", ErrSnapshotVersionMismatch, snapshot.Version)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := c.matchers.MatcherNames()
+	if snapshot.Config != c.matchers.Config().String() || len(snapshot.Trackers) != len(names) {
+		return ErrSnapshotConfigMismatch
+	}
+
+	matchesByFingerprint := map[uint64][]bool{}
+	for i, tracker := range snapshot.Trackers {
+		if tracker.Name != names[i] {
+			return ErrSnapshotConfigMismatch
+		}
+		for _, fp := range tracker.Fingerprints {
+			matches, ok := matchesByFingerprint[fp]
+			if !ok {
+				matches = make([]bool, len(names))
+				matchesByFingerprint[fp] = matches
+			}
+			matches[i] = true
+		}
+	}
+
+	// The snapshot is validated before seeding the active series, so that they're not partially seeded.
+	seriesLabels := make([]labels.Labels, 0, len(snapshot.Series))
+	seriesByFingerprint := make(map[uint64]int, len(snapshot.Series))
+	for _, series := range snapshot.Series {
+		lbs := make(labels.Labels, 0, len(series.Labels))
+		for _, l := range series.Labels {
+			lbs = append(lbs, labels.Label{Name: l.Name, Value: l.Value})
+		}
+		if lbs.Hash() != series.Fingerprint {
+			return fmt.Errorf("invalid fingerprint of series %s in active series snapshot", lbs)
+		}
+
+		seriesLabels = append(seriesLabels, lbs)
+		seriesByFingerprint[series.Fingerprint]++
+	}
+
+	for idx, series := range snapshot.Series {
+		lbs := seriesLabels[idx]
+
+		var matches []bool
+		if seriesByFingerprint[series.Fingerprint] > 1 {
+			// The trackers only reference the series by fingerprint, so the series with colliding
+			// fingerprints are matched again.
+			matches = c.matchers.Matches(lbs)
+		} else if m, ok := matchesByFingerprint[series.Fingerprint]; ok {
+			matches = append([]bool(nil), m...)
+			c.matchers.restore(matches)
+		} else if len(names) > 0 {
+			matches = make([]bool, len(names))
+		}
+
+		c.stripes[series.Fingerprint%numStripes].restoreEntry(series.Fingerprint, lbs, series.LastUpdate, matches)
+	}
+
+	return nil
+}
+
+// appendSnapshot appends the series of the stripe to the input snapshot series, and their fingerprints to the
+// input snapshot trackers matching them.
+func (s *seriesStripe) appendSnapshot(series []SnapshotSeries, trackers []SnapshotTracker) []SnapshotSeries {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for fp, entries := range s.refs {
+		for _, entry := range entries {
+			lbs := make([]SnapshotLabel, 0, len(entry.lbs))
+			for _, l := range entry.lbs {
+				lbs = append(lbs, SnapshotLabel{Name: l.Name, Value: l.Value})
+			}
+			series = append(series, SnapshotSeries{Fingerprint: fp, Labels: lbs, LastUpdate: entry.nanos.Load()})
+
+			for i, ok := range entry.matches {
+				if ok {
+					trackers[i].Fingerprints = append(trackers[i].Fingerprints, fp)
+				}
+			}
+		}
+	}
+	return series
+}
+
+// restoreEntry adds an entry restored from a snapshot to the stripe, unless the series is already tracked.
+func (s *seriesStripe) restoreEntry(fingerprint uint64, series labels.Labels, nanos int64, matches []bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.refs[fingerprint] {
+		if labels.Equal(entry.lbs, series) {
+			s.matchers.Release(matches)
+			return
+		}
+	}
+
+	s.active++
+	for i, ok := range matches {
+		if ok {
+			s.activeMatching[i]++
+		}
+	}
+
+	s.refs[fingerprint] = append(s.refs[fingerprint], seriesEntry{
+		lbs:     series,
+		nanos:   atomic.NewInt64(nanos),
+		matches: matches,
+	})
+
+	if oldest := s.oldestEntryTs.Load(); oldest == 0 || nanos < oldest {
+		s.oldestEntryTs.Store(nanos)
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package activeseries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveSeries_Snapshot(t *testing.T) {
+	trackers := map[string]string{"foo": `{a="1"}`, "bar": `{a=~"1|2"}`}
+	currentTime := time.Now()
+
+	c := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, trackers)), DefaultTimeout)
+	c.UpdateSeries(labels.FromStrings("a", "1"), currentTime.Add(-time.Minute), copyFn)
+	c.UpdateSeries(labels.FromStrings("a", "2"), currentTime, copyFn)
+	c.UpdateSeries(labels.FromStrings("a", "3"), currentTime, copyFn)
+
+	data, err := c.MarshalBinary()
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		restored := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, trackers)), DefaultTimeout)
+		require.NoError(t, restored.UnmarshalBinary(data))
+
+		allActive, activeMatching, valid := restored.Active(currentTime)
+		assert.True(t, valid)
+		assert.Equal(t, 3, allActive)
+		assert.Equal(t, []int{2, 1}, activeMatching) // bar, foo
+
+		// Updating a restored series doesn't count it twice.
+		restored.UpdateSeries(labels.FromStrings("a", "1"), currentTime, copyFn)
+		allActive, activeMatching, _ = restored.Active(currentTime)
+		assert.Equal(t, 3, allActive)
+		assert.Equal(t, []int{2, 1}, activeMatching)
+
+		// The restored series keep their last update time, so the least recently updated one expires first.
+		expiring := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, trackers)), DefaultTimeout)
+		require.NoError(t, expiring.UnmarshalBinary(data))
+		allActive, activeMatching, valid = expiring.Active(currentTime.Add(DefaultTimeout - 30*time.Second))
+		assert.True(t, valid)
+		assert.Equal(t, 2, allActive)
+		assert.Equal(t, []int{1, 0}, activeMatching)
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		snapshot := ActiveSeriesCustomTrackersSnapshot{}
+		require.NoError(t, snapshot.Unmarshal(data))
+		snapshot.Version = snapshotVersion + 1
+		otherVersion, err := snapshot.Marshal()
+		require.NoError(t, err)
+
+		restored := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, trackers)), DefaultTimeout)
+		require.ErrorIs(t, restored.UnmarshalBinary(otherVersion), ErrSnapshotVersionMismatch)
+
+		allActive, _, _ := restored.Active(currentTime)
+		assert.Equal(t, 0, allActive)
+	})
+
+	t.Run("config change", func(t *testing.T) {
+		changed := map[string]string{"foo": `{a="1"}`, "bar": `{a=~"2|3"}`}
+
+		restored := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, changed)), DefaultTimeout)
+		require.ErrorIs(t, restored.UnmarshalBinary(data), ErrSnapshotConfigMismatch)
+
+		allActive, activeMatching, _ := restored.Active(currentTime)
+		assert.Equal(t, 0, allActive)
+		assert.Equal(t, []int{0, 0}, activeMatching)
+	})
+
+	t.Run("invalid snapshot", func(t *testing.T) {
+		restored := NewActiveSeries(NewMatchers(mustNewCustomTrackersConfigFromMap(t, trackers)), DefaultTimeout)
+		require.Error(t, restored.UnmarshalBinary([]byte("invalid")))
+	})
+}
+
+func TestActiveSeries_Snapshot_CardinalityLimit(t *testing.T) {
+	cfg, err := NewCustomTrackersConfigWithOptions(map[string]string{"foo": `{a=~".+"}`}, map[string]CustomTrackerOptions{"foo": {CardinalityLimit: 2}})
+	require.NoError(t, err)
+	currentTime := time.Now()
+
+	c := NewActiveSeries(NewMatchers(cfg), DefaultTimeout)
+	for _, value := range []string{"1", "2", "3"} {
+		c.UpdateSeries(labels.FromStrings("a", value), currentTime, copyFn)
+	}
+
+	data, err := c.MarshalBinary()
+	require.NoError(t, err)
+
+	asm := NewMatchers(cfg)
+	restored := NewActiveSeries(asm, DefaultTimeout)
+	require.NoError(t, restored.UnmarshalBinary(data))
+
+	allActive, activeMatching, _ := restored.Active(currentTime)
+	assert.Equal(t, 3, allActive)
+	assert.Equal(t, []int{2}, activeMatching)
+
+	// The restored series count towards the cardinality limit.
+	assert.Equal(t, []bool{false}, asm.Matches(labels.FromStrings("a", "4")))
+}
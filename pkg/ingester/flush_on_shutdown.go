@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+var (
+	errInvalidFlushOnShutdownTimeout = errors.New("the flush on shutdown timeout must be greater than or equal to 0")
+	errFlushOnShutdownTimedOut       = errors.New("the flush on shutdown has not completed within the configured timeout")
+)
+
+// flushWithTimeout runs flush with a context with the configured flush on shutdown timeout (if any). If the
+// timeout expires before flush returns, the state of the TSDBs still in-flight is logged, the ingester is
+// marked unhealthy, and the function returns without waiting for flush to complete. In this case the TSDBs
+// are not closed on shutdown (they may be blocked by the stalled flush), and the WAL is left intact to be
+// replayed at the next startup.
+func (i *Ingester) flushWithTimeout(flush func(ctx context.Context)) {
+	if i.cfg.FlushOnShutdownTimeout <= 0 {
+		flush(context.Background())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), i.cfg.FlushOnShutdownTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		flush(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		i.flushOnShutdownTimedOut.Store(true)
+		level.Error(i.logger).Log("msg", "flushing TSDB blocks has not completed within the timeout, giving up and leaving the WAL to be replayed on restart", "timeout", i.cfg.FlushOnShutdownTimeout)
+		i.logInflightTSDBState()
+	}
+}
+
+// logInflightTSDBState logs, for each tenant, the state of the data not flushed and shipped yet.
+func (i *Ingester) logInflightTSDBState() {
+	for _, userID := range i.getTSDBUsers() {
+		db := i.getTSDB(userID)
+		if db == nil {
+			continue
+		}
+
+		h := db.Head()
+		keyvals := []interface{}{
+			"msg", "TSDB state not flushed yet",
+			"user", userID,
+			"head_series", h.NumSeries(),
+		}
+		if h.NumSeries() > 0 {
+			keyvals = append(keyvals,
+				"head_min_time", time.UnixMilli(h.MinTime()).UTC(),
+				"head_max_time", time.UnixMilli(h.MaxTime()).UTC())
+		}
+		if oldest := db.getOldestUnshippedBlockTime(); oldest > 0 {
+			keyvals = append(keyvals, "oldest_unshipped_block_time", time.UnixMilli(int64(oldest)).UTC())
+		}
+
+		level.Warn(i.logger).Log(keyvals...)
+	}
+}
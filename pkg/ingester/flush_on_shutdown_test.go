@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngester_FlushWithTimeout(t *testing.T) {
+	t.Run("should wait until the flush completes if no timeout is configured", func(t *testing.T) {
+		i := &Ingester{logger: log.NewNopLogger(), tsdbs: map[string]*userTSDB{}}
+
+		flushed := false
+		i.flushWithTimeout(func(ctx context.Context) {
+			time.Sleep(50 * time.Millisecond)
+			flushed = true
+		})
+
+		assert.True(t, flushed)
+		assert.False(t, i.flushOnShutdownTimedOut.Load())
+	})
+
+	t.Run("should not mark the ingester unhealthy if the flush completes within the timeout", func(t *testing.T) {
+		i := &Ingester{cfg: Config{FlushOnShutdownTimeout: time.Second}, logger: log.NewNopLogger(), tsdbs: map[string]*userTSDB{}}
+
+		flushed := false
+		i.flushWithTimeout(func(ctx context.Context) {
+			flushed = true
+		})
+
+		assert.True(t, flushed)
+		assert.False(t, i.flushOnShutdownTimedOut.Load())
+	})
+
+	t.Run("should give up and mark the ingester unhealthy if the flush doesn't complete within the timeout", func(t *testing.T) {
+		i := &Ingester{cfg: Config{FlushOnShutdownTimeout: 100 * time.Millisecond}, logger: log.NewNopLogger(), tsdbs: map[string]*userTSDB{}}
+
+		stalled := make(chan struct{})
+		defer close(stalled)
+
+		flushCtxDone := make(chan struct{})
+		start := time.Now()
+		i.flushWithTimeout(func(ctx context.Context) {
+			<-ctx.Done()
+			close(flushCtxDone)
+
+			// Simulate a flush not honoring the context cancellation.
+			<-stalled
+		})
+
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.True(t, i.flushOnShutdownTimedOut.Load())
+
+		// The context passed to the flush should have been canceled.
+		select {
+		case <-flushCtxDone:
+		case <-time.After(time.Second):
+			require.Fail(t, "the flush context has not been canceled")
+		}
+	})
+}
+
+func TestConfig_ValidateFlushOnShutdownTimeout(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.FlushOnShutdownTimeout = -time.Second
+	assert.Equal(t, errInvalidFlushOnShutdownTimeout, cfg.Validate())
+
+	cfg.FlushOnShutdownTimeout = time.Minute
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+const (
+	// cardinalityIncreaseWindow is the time constant of the decaying rate of new label name/value pairs,
+	// which approximates the number of new pairs introduced in the last window.
+	cardinalityIncreaseWindow = time.Minute
+
+	// cardinalityIncreaseTopPairs is the number of new label name/value pairs logged when the threshold is exceeded.
+	cardinalityIncreaseTopPairs = 5
+
+	// cardinalityIncreaseMaxContributingSeries is the max number of contributing series logged for each label name/value pair.
+	cardinalityIncreaseMaxContributingSeries = 3
+
+	// cardinalityIncreaseMaxRecentPairs is the max number of recently introduced label name/value pairs tracked
+	// to be logged, to bound the memory used during a cardinality explosion.
+	cardinalityIncreaseMaxRecentPairs = 10000
+)
+
+// newLabelPair holds the series which contributed to a recently introduced label name/value pair.
+type newLabelPair struct {
+	label        labels.Label
+	introducedAt time.Time
+
+	// A sample of the series created with this label name/value pair.
+	series []labels.Labels
+}
+
+// HighCardinalityDetector tracks, for a single tenant, the rate of new unique label name/value pairs
+// introduced by the created series, and logs a warning when it exceeds the configured threshold. It
+// counts the in-memory series of each label name/value pair, so that a pair is new when its first
+// series is created.
+type HighCardinalityDetector struct {
+	threshold int
+	logger    log.Logger
+
+	mtx          sync.Mutex
+	seriesByPair map[labels.Label]int
+	detecting    bool
+
+	// rate is the number of new label name/value pairs, exponentially decaying over cardinalityIncreaseWindow.
+	rate          float64
+	rateUpdatedAt time.Time
+	lastWarning   time.Time
+
+	// recentPairs holds the label name/value pairs introduced within the last window, to be logged.
+	recentPairs         map[labels.Label]*newLabelPair
+	recentPairsPrunedAt time.Time
+}
+
+// NewHighCardinalityDetector makes a new HighCardinalityDetector. The threshold is the max number of new
+// label name/value pairs per minute.
+func NewHighCardinalityDetector(threshold int, logger log.Logger) *HighCardinalityDetector {
+	return &HighCardinalityDetector{
+		threshold:    threshold,
+		logger:       logger,
+		seriesByPair: map[labels.Label]int{},
+		recentPairs:  map[labels.Label]*newLabelPair{},
+	}
+}
+
+// StartDetection starts detecting the new label name/value pairs. The series created before are only
+// counted, so that the series replayed from the WAL don't introduce new pairs.
+func (d *HighCardinalityDetector) StartDetection() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.detecting = true
+}
+
+// SeriesCreated tracks a newly created series, and logs a warning if the rate of new label name/value
+// pairs exceeds the threshold. The warning is logged at most once per window.
+func (d *HighCardinalityDetector) SeriesCreated(now time.Time, series labels.Labels) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	newPairs := 0
+	for _, l := range series {
+		count := d.seriesByPair[l]
+		d.seriesByPair[l] = count + 1
+
+		if count == 0 && d.detecting {
+			newPairs++
+			d.addRecentPair(now, l, series)
+		} else if pair, ok := d.recentPairs[l]; ok && len(pair.series) < cardinalityIncreaseMaxContributingSeries {
+			pair.series = append(pair.series, series)
+		}
+	}
+
+	if newPairs == 0 {
+		return
+	}
+
+	if elapsed := now.Sub(d.rateUpdatedAt); elapsed > 0 && !d.rateUpdatedAt.IsZero() {
+		d.rate *= math.Exp(-float64(elapsed) / float64(cardinalityIncreaseWindow))
+	}
+	d.rate += float64(newPairs)
+	if now.After(d.rateUpdatedAt) {
+		d.rateUpdatedAt = now
+	}
+
+	if d.rate > float64(d.threshold) && now.Sub(d.lastWarning) >= cardinalityIncreaseWindow {
+		d.lastWarning = now
+		level.Warn(d.logger).Log(d.warningKeyvals(now)...)
+	}
+}
+
+// SeriesDeleted stops tracking the input deleted series.
+func (d *HighCardinalityDetector) SeriesDeleted(series ...labels.Labels) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, s := range series {
+		for _, l := range s {
+			if count := d.seriesByPair[l]; count > 1 {
+				d.seriesByPair[l] = count - 1
+			} else {
+				delete(d.seriesByPair, l)
+				delete(d.recentPairs, l)
+			}
+		}
+	}
+}
+
+// addRecentPair tracks a new label name/value pair to be logged, after removing the pairs introduced
+// before the last window. Must be called with the lock held.
+func (d *HighCardinalityDetector) addRecentPair(now time.Time, l labels.Label, series labels.Labels) {
+	if now.Sub(d.recentPairsPrunedAt) >= cardinalityIncreaseWindow {
+		for label, pair := range d.recentPairs {
+			if now.Sub(pair.introducedAt) >= cardinalityIncreaseWindow {
+				delete(d.recentPairs, label)
+			}
+		}
+		d.recentPairsPrunedAt = now
+	}
+
+	if len(d.recentPairs) >= cardinalityIncreaseMaxRecentPairs {
+		return
+	}
+	d.recentPairs[l] = &newLabelPair{label: l, introducedAt: now, series: []labels.Labels{series}}
+}
+
+// warningKeyvals returns the structured log key-value pairs describing the top label name/value pairs
+// introduced within the last window, by number of series. Must be called with the lock held.
+func (d *HighCardinalityDetector) warningKeyvals(now time.Time) []interface{} {
+	pairs := make([]*newLabelPair, 0, len(d.recentPairs))
+	for _, pair := range d.recentPairs {
+		if now.Sub(pair.introducedAt) < cardinalityIncreaseWindow {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if ci, cj := d.seriesByPair[pairs[i].label], d.seriesByPair[pairs[j].label]; ci != cj {
+			return ci > cj
+		}
+		if pairs[i].label.Name != pairs[j].label.Name {
+			return pairs[i].label.Name < pairs[j].label.Name
+		}
+		return pairs[i].label.Value < pairs[j].label.Value
+	})
+
+	if len(pairs) > cardinalityIncreaseTopPairs {
+		pairs = pairs[:cardinalityIncreaseTopPairs]
+	}
+
+	keyvals := []interface{}{
+		"msg", "detected a rapid increase of new unique label name/value pairs",
+		"new_label_pairs", int(math.Round(d.rate)),
+		"window", cardinalityIncreaseWindow,
+		"threshold", d.threshold,
+	}
+
+	for idx, pair := range pairs {
+		series := make([]string, 0, len(pair.series))
+		for _, s := range pair.series {
+			series = append(series, s.String())
+		}
+
+		prefix := fmt.Sprintf("top_%d_", idx+1)
+		keyvals = append(keyvals,
+			prefix+"label_pair", fmt.Sprintf("%s=%q", pair.label.Name, pair.label.Value),
+			prefix+"series_count", d.seriesByPair[pair.label],
+			prefix+"series", strings.Join(series, " "),
+		)
+	}
+
+	return keyvals
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestHighCardinalityDetector(t *testing.T) {
+	logs := &concurrency.SyncBuffer{}
+	d := NewHighCardinalityDetector(3, log.NewLogfmtLogger(logs))
+
+	// The pairs of the series created before starting the detection are counted, but not detected as new.
+	d.SeriesCreated(time.Now(), labels.FromStrings(labels.MetricName, "test"))
+	d.StartDetection()
+
+	now := time.Now()
+
+	// Series introducing new pairs below the threshold don't trigger the warning.
+	d.SeriesCreated(now, labels.FromStrings(labels.MetricName, "test", "pod", "a"))
+	d.SeriesCreated(now, labels.FromStrings(labels.MetricName, "test", "pod", "a", "request_id", "1"))
+	d.SeriesCreated(now, labels.FromStrings(labels.MetricName, "test", "pod", "a", "request_id", "2"))
+	assert.Empty(t, logs.String())
+
+	// Once the threshold is exceeded, the warning is logged with the top pairs.
+	d.SeriesCreated(now, labels.FromStrings(labels.MetricName, "test", "pod", "a", "request_id", "3"))
+	output := logs.String()
+	assert.Contains(t, output, `msg="detected a rapid increase of new unique label name/value pairs" new_label_pairs=4 window=1m0s threshold=3`)
+	assert.Contains(t, output, `top_1_label_pair="pod=\"a\"" top_1_series_count=4 top_1_series="{__name__=\"test\", pod=\"a\"} {__name__=\"test\", pod=\"a\", request_id=\"1\"} {__name__=\"test\", pod=\"a\", request_id=\"2\"}"`)
+	assert.Contains(t, output, `top_2_label_pair="request_id=\"1\"" top_2_series_count=1`)
+	assert.NotContains(t, output, `label_pair="__name__=\"test\""`)
+	assert.NotContains(t, output, "top_5_")
+
+	// The warning is logged only once per window.
+	d.SeriesCreated(now.Add(30*time.Second), labels.FromStrings(labels.MetricName, "test", "pod", "a", "request_id", "4"))
+	assert.Equal(t, output, logs.String())
+
+	// Once the rate has decayed, a few new pairs don't trigger the warning.
+	d.SeriesCreated(now.Add(10*time.Minute), labels.FromStrings(labels.MetricName, "test", "pod", "b"))
+	assert.Equal(t, output, logs.String())
+
+	// A new burst of pairs triggers the warning again as soon as the rate exceeds the threshold, logging only
+	// the recently introduced pairs.
+	for n := 5; n <= 8; n++ {
+		d.SeriesCreated(now.Add(10*time.Minute), labels.FromStrings(labels.MetricName, "test", "pod", "b", "request_id", strconv.Itoa(n)))
+	}
+	assert.Equal(t, 2, strings.Count(logs.String(), "rapid increase"))
+	assert.Contains(t, logs.String(), `top_1_label_pair="pod=\"b\"" top_1_series_count=3`)
+	assert.NotContains(t, strings.TrimPrefix(logs.String(), output), `label_pair="pod=\"a\""`)
+}
+
+func TestHighCardinalityDetector_SeriesDeleted(t *testing.T) {
+	logs := &concurrency.SyncBuffer{}
+	d := NewHighCardinalityDetector(1, log.NewLogfmtLogger(logs))
+	d.StartDetection()
+
+	now := time.Now()
+	first := labels.FromStrings(labels.MetricName, "test", "request_id", "1")
+	second := labels.FromStrings(labels.MetricName, "test", "request_id", "2")
+	d.SeriesCreated(now, first)
+	d.SeriesCreated(now, second)
+	assert.Equal(t, 2, d.seriesByPair[labels.Label{Name: labels.MetricName, Value: "test"}])
+
+	// The pairs are tracked until their last series is deleted.
+	d.SeriesDeleted(first)
+	assert.Equal(t, map[labels.Label]int{
+		{Name: labels.MetricName, Value: "test"}: 1,
+		{Name: "request_id", Value: "2"}:         1,
+	}, d.seriesByPair)
+
+	d.SeriesDeleted(second)
+	assert.Empty(t, d.seriesByPair)
+	assert.Empty(t, d.recentPairs)
+
+	// Once the rate has decayed, the pairs of the deleted series are new again.
+	d.SeriesCreated(now.Add(10*time.Minute), first)
+	assert.Equal(t, 2, strings.Count(logs.String(), "rapid increase"))
+	assert.Contains(t, logs.String(), `new_label_pairs=2`)
+}
+
+func TestIngester_CardinalityIncreaseRateThreshold(t *testing.T) {
+	logs := &concurrency.SyncBuffer{}
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.CardinalityIncreaseRateThreshold = 5
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	i.logger = log.NewLogfmtLogger(logs)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is healthy
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	push := func(numSeries int) {
+		series := make([]labels.Labels, 0, numSeries)
+		samples := make([]mimirpb.Sample, 0, numSeries)
+		for n := 0; n < numSeries; n++ {
+			series = append(series, labels.FromStrings(labels.MetricName, "test", "request_id", fmt.Sprintf("%d", n)))
+			samples = append(samples, mimirpb.Sample{Value: 1, TimestampMs: 10})
+		}
+
+		_, err := i.Push(user.InjectOrgID(context.Background(), "user-1"), mimirpb.ToWriteRequest(series, samples, nil, nil, mimirpb.API))
+		require.NoError(t, err)
+	}
+
+	// The metric name and 4 request IDs introduce 5 new label name/value pairs.
+	push(4)
+	assert.NotContains(t, logs.String(), "rapid increase")
+
+	// Pushing the same series again doesn't introduce new pairs.
+	push(4)
+	assert.NotContains(t, logs.String(), "rapid increase")
+
+	push(5)
+	assert.Equal(t, 1, strings.Count(logs.String(), "rapid increase"))
+	assert.Contains(t, logs.String(), `user=user-1`)
+	assert.Contains(t, logs.String(), `top_1_label_pair="__name__=\"test\"" top_1_series_count=5`)
+}
@@ -14,6 +14,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -137,6 +138,16 @@ type Config struct {
 
 	TSDBConfigUpdatePeriod time.Duration `yaml:"tsdb_config_update_period" category:"experimental"`
 
+	CardinalityIncreaseRateThreshold int `yaml:"cardinality_increase_rate_threshold" category:"experimental"`
+
+	FlushOnShutdownTimeout time.Duration `yaml:"flush_on_shutdown_timeout" category:"experimental"`
+
+	SampleCoalescingEnabled bool `yaml:"sample_coalescing_enabled" category:"experimental"`
+
+	SeriesMetadataIndexEnabled bool `yaml:"series_metadata_index_enabled" category:"experimental"`
+
+	SeriesGrowthPredictionEnabled bool `yaml:"series_growth_prediction_enabled" category:"experimental"`
+
 	BlocksStorageConfig         mimir_tsdb.BlocksStorageConfig `yaml:"-"`
 	StreamChunksWhenUsingBlocks bool                           `yaml:"-" category:"advanced"`
 	// Runtime-override for type of streaming query to use (chunks or samples).
@@ -164,12 +175,29 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 
 	f.BoolVar(&cfg.StreamChunksWhenUsingBlocks, "ingester.stream-chunks-when-using-blocks", true, "Stream chunks from ingesters to queriers.")
 	f.DurationVar(&cfg.TSDBConfigUpdatePeriod, "ingester.tsdb-config-update-period", 15*time.Second, "Period with which to update the per-tenant TSDB configuration.")
+	f.IntVar(&cfg.CardinalityIncreaseRateThreshold, "ingester.cardinality-increase-rate-threshold", 0, "When greater than 0, a warning is logged when the series created for a tenant introduce new unique label name/value pairs at a rate higher than this number per minute. The warning includes the top new label name/value pairs and some of their contributing series. 0 to disable.")
+
+	f.DurationVar(&cfg.FlushOnShutdownTimeout, "ingester.flush-on-shutdown-timeout", 0, "Maximum time the ingester waits for the TSDB blocks to be flushed and shipped on shutdown. If the timeout is exceeded, the ingester logs the tenants with data not flushed yet, marks itself unhealthy and exits, leaving the WAL to be replayed on restart. 0 to disable.")
+
+	f.BoolVar(&cfg.SampleCoalescingEnabled, "ingester.sample-coalescing-enabled", false, "True to remove the duplicate samples, with the same series, timestamp and value, from each push request before appending them to the TSDB. This reduces the contention on the series locks when clients retry partially ingested requests.")
+
+	f.BoolVar(&cfg.SeriesMetadataIndexEnabled, "ingester.series-metadata-index-enabled", false, "True to maintain an in-memory index of the metric names of the series in the TSDB head, which is used to speed up label names and values queries only hitting the head.")
+
+	f.BoolVar(&cfg.SeriesGrowthPredictionEnabled, "ingester.series-growth-prediction-enabled", false, "True to sample the number of in-memory series of each tenant every hour, and predict when the tenant will hit the series limit fitting a linear regression to the samples of the last day. The prediction is exported by the cortex_ingester_predicted_series_limit_hit_seconds metric.")
 
 	cfg.DefaultLimits.RegisterFlags(f)
 
 	f.StringVar(&cfg.IgnoreSeriesLimitForMetricNames, "ingester.ignore-series-limit-for-metric-names", "", "Comma-separated list of metric names, for which the -ingester.max-global-series-per-metric limit will be ignored. Does not affect the -ingester.max-global-series-per-user limit.")
 }
 
+// Validate the config.
+func (cfg *Config) Validate() error {
+	if cfg.FlushOnShutdownTimeout < 0 {
+		return errInvalidFlushOnShutdownTimeout
+	}
+	return nil
+}
+
 func (cfg *Config) getIgnoreSeriesLimitForMetricNamesMap() map[string]struct{} {
 	if cfg.IgnoreSeriesLimitForMetricNames == "" {
 		return nil
@@ -231,6 +259,9 @@ type Ingester struct {
 	// Number of series in memory, across all tenants.
 	seriesCount atomic.Int64
 
+	// Whether the flush on shutdown has not completed within the configured timeout.
+	flushOnShutdownTimedOut atomic.Bool
+
 	// For storing metadata ingested.
 	usersMetadataMtx sync.RWMutex
 	usersMetadata    map[string]*userMetricsMetadata
@@ -414,7 +445,7 @@ func (i *Ingester) starting(ctx context.Context) error {
 }
 
 func (i *Ingester) stoppingForFlusher(_ error) error {
-	if !i.cfg.BlocksStorageConfig.TSDB.KeepUserTSDBOpenOnShutdown {
+	if !i.cfg.BlocksStorageConfig.TSDB.KeepUserTSDBOpenOnShutdown && !i.flushOnShutdownTimedOut.Load() {
 		i.closeAllTSDB()
 	}
 	return nil
@@ -434,6 +465,12 @@ func (i *Ingester) stopping(_ error) error {
 		level.Warn(i.logger).Log("msg", "failed to stop ingester lifecycler", "err", err)
 	}
 
+	// Closing the TSDBs could block on the stalled flush, so they're left open (their WAL is intact anyway).
+	if i.flushOnShutdownTimedOut.Load() {
+		level.Warn(i.logger).Log("msg", "not closing TSDBs because the flush on shutdown has timed out")
+		return nil
+	}
+
 	if !i.cfg.BlocksStorageConfig.TSDB.KeepUserTSDBOpenOnShutdown {
 		i.closeAllTSDB()
 	}
@@ -464,6 +501,13 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 	usageStatsUpdateTicker := time.NewTicker(usageStatsUpdateInterval)
 	defer usageStatsUpdateTicker.Stop()
 
+	var seriesGrowthTickerChan <-chan time.Time
+	if i.cfg.SeriesGrowthPredictionEnabled {
+		t := time.NewTicker(seriesGrowthSamplingInterval)
+		seriesGrowthTickerChan = t.C
+		defer t.Stop()
+	}
+
 	for {
 		select {
 		case <-metadataPurgeTicker.C:
@@ -487,6 +531,9 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 		case <-usageStatsUpdateTicker.C:
 			i.updateUsageStats()
 
+		case <-seriesGrowthTickerChan:
+			i.updateSeriesGrowthPredictions(time.Now())
+
 		case <-ctx.Done():
 			return nil
 		case err := <-i.subservicesWatcher.Chan():
@@ -495,6 +542,16 @@ func (i *Ingester) updateLoop(ctx context.Context) error {
 	}
 }
 
+// newActiveSeriesMatchers makes new active series matchers for the input user, tracking in the ingester
+// metrics the series not counted because of the custom trackers cardinality limits.
+func (i *Ingester) newActiveSeriesMatchers(userID string, cfg activeseries.CustomTrackersConfig) *activeseries.Matchers {
+	asm := activeseries.NewMatchers(cfg)
+	asm.OnCardinalityLimitExceeded(func(name string) {
+		i.metrics.activeSeriesCustomTrackerCardinalityLimitExceeded.WithLabelValues(userID, name).Inc()
+	})
+	return asm
+}
+
 func (i *Ingester) replaceMatchers(asm *activeseries.Matchers, userDB *userTSDB, now time.Time) {
 	i.metrics.deletePerUserCustomTrackerMetrics(userDB.userID, userDB.activeSeries.CurrentMatcherNames())
 	userDB.activeSeries.ReloadMatchers(asm, now)
@@ -509,7 +566,7 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 
 		newMatchersConfig := i.limits.ActiveSeriesCustomTrackersConfig(userID)
 		if newMatchersConfig.String() != userDB.activeSeries.CurrentConfig().String() {
-			i.replaceMatchers(activeseries.NewMatchers(newMatchersConfig), userDB, now)
+			i.replaceMatchers(i.newActiveSeriesMatchers(userID, newMatchersConfig), userDB, now)
 		}
 		allActive, activeMatching, valid := userDB.activeSeries.Active(now)
 		if !valid {
@@ -523,6 +580,7 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 				i.metrics.activeSeriesPerUser.DeleteLabelValues(userID)
 			}
 
+			trackersConfig := userDB.activeSeries.CurrentConfig()
 			for idx, name := range userDB.activeSeries.CurrentMatcherNames() {
 				// We only set the metrics for matchers that actually exist, to avoid increasing cardinality with zero valued metrics.
 				if activeMatching[idx] > 0 {
@@ -530,11 +588,42 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 				} else {
 					i.metrics.activeSeriesCustomTrackersPerUser.DeleteLabelValues(userID, name)
 				}
+
+				// The histogram tracks how the count evolves over time, so zero counts are observed too.
+				if buckets := trackersConfig.HistogramBuckets(name); buckets != nil {
+					i.metrics.activeSeriesCustomTrackerHistograms.observe(userID, name, buckets, float64(activeMatching[idx]))
+				}
 			}
 		}
 	}
 }
 
+// updateSeriesGrowthPredictions samples the number of in-memory series of each tenant, and updates the prediction
+// of when each tenant will hit the series limit.
+func (i *Ingester) updateSeriesGrowthPredictions(now time.Time) {
+	for _, userID := range i.getTSDBUsers() {
+		userDB := i.getTSDB(userID)
+		if userDB == nil || userDB.seriesGrowthPredictor == nil {
+			continue
+		}
+
+		userDB.seriesGrowthPredictor.Observe(now, int(userDB.Head().NumSeries()))
+
+		limit := i.limiter.maxSeriesPerUser(userID)
+		if limit == math.MaxInt32 {
+			// The series limit is disabled.
+			i.metrics.predictedSeriesLimitHit.DeleteLabelValues(userID)
+			continue
+		}
+
+		if hit, ok := userDB.seriesGrowthPredictor.PredictLimitHit(limit); ok {
+			i.metrics.predictedSeriesLimitHit.WithLabelValues(userID).Set(float64(hit.Unix()))
+		} else {
+			i.metrics.predictedSeriesLimitHit.WithLabelValues(userID).Set(0)
+		}
+	}
+}
+
 // updateUsageStats updated some anonymous usage statistics tracked by the ingester.
 // This function is expected to be called periodically.
 func (i *Ingester) updateUsageStats() {
@@ -669,6 +758,15 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 		return &mimirpb.WriteResponse{}, nil
 	}
 
+	if i.cfg.SampleCoalescingEnabled {
+		c := sampleCoalescerPool.Get().(*SampleCoalescer)
+		if removed := c.Coalesce(req.Timeseries); removed > 0 {
+			i.metrics.coalescedSamples.WithLabelValues(userID).Add(float64(removed))
+		}
+		c.reset()
+		sampleCoalescerPool.Put(c)
+	}
+
 	db, err := i.getOrCreateTSDB(userID, false)
 	if err != nil {
 		return nil, wrapWithUser(err, userID)
@@ -1001,6 +1099,17 @@ func (i *Ingester) LabelValues(ctx context.Context, req *client.LabelValuesReque
 		return &client.LabelValuesResponse{}, nil
 	}
 
+	if db.canUseSeriesMetadataIndex(startTimestampMs, endTimestampMs) {
+		if labelName == labels.MetricName && onlyMetricNameMatchers(matchers) {
+			return &client.LabelValuesResponse{
+				LabelValues: db.seriesMetadataIndex.MetricNames(matchers...),
+			}, nil
+		}
+		if db.seriesMetadataIndex.MatchesNoSeries(matchers) {
+			return &client.LabelValuesResponse{}, nil
+		}
+	}
+
 	q, err := db.Querier(ctx, startTimestampMs, endTimestampMs)
 	if err != nil {
 		return nil, err
@@ -1037,6 +1146,10 @@ func (i *Ingester) LabelNames(ctx context.Context, req *client.LabelNamesRequest
 		return nil, err
 	}
 
+	if db.canUseSeriesMetadataIndex(mint, maxt) && db.seriesMetadataIndex.MatchesNoSeries(matchers) {
+		return &client.LabelNamesResponse{}, nil
+	}
+
 	q, err := db.Querier(ctx, mint, maxt)
 	if err != nil {
 		return nil, err
@@ -1561,7 +1674,7 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 
 	userDB := &userTSDB{
 		userID:              userID,
-		activeSeries:        activeseries.NewActiveSeries(activeseries.NewMatchers(matchersConfig), i.cfg.ActiveSeriesMetricsIdleTimeout),
+		activeSeries:        activeseries.NewActiveSeries(i.newActiveSeriesMatchers(userID, matchersConfig), i.cfg.ActiveSeriesMetricsIdleTimeout),
 		seriesInMetric:      newMetricCounter(i.limiter, i.cfg.getIgnoreSeriesLimitForMetricNamesMap()),
 		ingestedAPISamples:  util_math.NewEWMARate(0.2, i.cfg.RateUpdatePeriod),
 		ingestedRuleSamples: util_math.NewEWMARate(0.2, i.cfg.RateUpdatePeriod),
@@ -1570,6 +1683,22 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 		instanceSeriesCount: &i.seriesCount,
 	}
 
+	// Seed the active series with the snapshot taken at the last shutdown, if any, before replaying the WAL.
+	if i.activeSeriesSnapshotEnabled() {
+		restoreActiveSeriesSnapshot(userDB.activeSeries, udir, userLogger)
+	}
+
+	// The index must be created before opening the TSDB, to track the series created during WAL replay.
+	if i.cfg.SeriesMetadataIndexEnabled {
+		userDB.seriesMetadataIndex = NewSeriesMetadataIndex()
+	}
+
+	// Similarly, the cardinality detector counts the series created during WAL replay, but the label
+	// name/value pairs they introduce are not detected as new.
+	if i.cfg.CardinalityIncreaseRateThreshold > 0 {
+		userDB.cardinalityDetector = NewHighCardinalityDetector(i.cfg.CardinalityIncreaseRateThreshold, userLogger)
+	}
+
 	maxExemplars := i.limiter.convertGlobalToLocalLimit(userID, i.limits.MaxGlobalExemplarsPerUser(userID))
 	oooTW := time.Duration(i.limits.OutOfOrderTimeWindow(userID))
 	// Create a new user database
@@ -1616,6 +1745,14 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 	// series during WAL replay.
 	userDB.limiter = i.limiter
 
+	// Similarly, we don't want to track the series created during WAL replay.
+	if i.cfg.SeriesGrowthPredictionEnabled {
+		userDB.seriesGrowthPredictor = NewSeriesGrowthPredictor()
+	}
+	if userDB.cardinalityDetector != nil {
+		userDB.cardinalityDetector.StartDetection()
+	}
+
 	if db.Head().NumSeries() > 0 {
 		// If there are series in the head, use max time from head. If this time is too old,
 		// TSDB will be eligible for flushing and closing sooner, unless more data is pushed to it quickly.
@@ -1664,6 +1801,8 @@ func (i *Ingester) closeAllTSDB() {
 				return
 			}
 
+			i.snapshotActiveSeries(userID, db)
+
 			// Now that the TSDB has been closed, we should remove it from the
 			// set of open ones. This lock acquisition doesn't deadlock with the
 			// outer one, because the outer one is released as soon as all go
@@ -1948,6 +2087,10 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 		}
 	}
 
+	defer func(start time.Time) {
+		i.metrics.compactionCycleTime.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
 	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency, func(ctx context.Context, userID string) error {
 		if !allowed.IsAllowed(userID) {
 			return nil
@@ -1966,7 +2109,12 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 
 		var err error
 
+		// Keep track of the head min time, to detect whether the compaction has cut a block.
+		minTimeBeforeCompaction := h.MinTime()
+
 		i.metrics.compactionsTriggered.Inc()
+		i.metrics.compactionsInflight.Inc()
+		defer i.metrics.compactionsInflight.Dec()
 
 		reason := ""
 		switch {
@@ -1991,6 +2139,12 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 			level.Debug(i.logger).Log("msg", "TSDB blocks compaction completed successfully", "user", userID, "compactReason", reason)
 		}
 
+		// Snapshot the active series once a block has been cut from the head, so that a recent snapshot
+		// is available at the next startup even if the ingester doesn't shut down cleanly.
+		if err == nil && h.MinTime() != minTimeBeforeCompaction {
+			i.snapshotActiveSeries(userID, userDB)
+		}
+
 		return nil
 	})
 }
@@ -2101,16 +2255,21 @@ func (i *Ingester) TransferOut(_ context.Context) error {
 // Samples are not received at this stage. Compaction and Shipping loops have already been stopped as well.
 //
 // When used from flusher, ingester is constructed in a way that compaction, shipping and receiving of samples is never started.
+//
+// The flush is interrupted after -ingester.flush-on-shutdown-timeout, if configured.
 func (i *Ingester) Flush() {
 	level.Info(i.logger).Log("msg", "starting to flush and ship TSDB blocks")
 
-	ctx := context.Background()
+	i.flushWithTimeout(func(ctx context.Context) {
+		i.compactBlocks(ctx, true, nil)
+		if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() && ctx.Err() == nil {
+			i.shipBlocks(ctx, nil)
+		}
+	})
 
-	i.compactBlocks(ctx, true, nil)
-	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
-		i.shipBlocks(ctx, nil)
+	if i.flushOnShutdownTimedOut.Load() {
+		return
 	}
-
 	level.Info(i.logger).Log("msg", "finished flushing and shipping TSDB blocks")
 }
 
@@ -2272,6 +2431,35 @@ func (i *Ingester) ShutdownHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ActiveSeriesCustomTrackersHandler returns the status of the active series custom trackers of the tenant, by tracker
+// name, as of the last update of the active series metrics.
+func (i *Ingester) ActiveSeriesCustomTrackersHandler(w http.ResponseWriter, r *http.Request) {
+	if !i.cfg.ActiveSeriesMetricsEnabled {
+		http.Error(w, "active series tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := i.getTSDB(userID)
+	if db == nil {
+		http.Error(w, "no active series for the tenant", http.StatusNotFound)
+		return
+	}
+
+	status, ok := db.activeSeries.CustomTrackersStatus()
+	if !ok {
+		http.Error(w, "the active series custom trackers are loading", http.StatusServiceUnavailable)
+		return
+	}
+
+	util.WriteJSONResponse(w, status)
+}
+
 // Using block store, the ingester is only available when it is in a Running state. The ingester is not available
 // when stopping to prevent any read or writes to the TSDB after the ingester has closed them.
 func (i *Ingester) checkRunning() error {
@@ -2412,6 +2600,9 @@ func (i *Ingester) CheckReady(ctx context.Context) error {
 	if err := i.checkRunning(); err != nil {
 		return fmt.Errorf("ingester not ready: %v", err)
 	}
+	if i.flushOnShutdownTimedOut.Load() {
+		return fmt.Errorf("ingester not ready: %v", errFlushOnShutdownTimedOut)
+	}
 	return i.lifecycler.CheckReady(ctx)
 }
 
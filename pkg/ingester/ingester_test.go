@@ -11,6 +11,7 @@ package ingester
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
@@ -1456,6 +1457,87 @@ func Test_Ingester_LabelValues(t *testing.T) {
 	}
 }
 
+func Test_Ingester_LabelNamesAndValues_WithSeriesMetadataIndex(t *testing.T) {
+	series := []struct {
+		lbls      labels.Labels
+		value     float64
+		timestamp int64
+	}{
+		{labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}, {Name: "route", Value: "get_user"}}, 1, 100000},
+		{labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "500"}, {Name: "route", Value: "get_user"}}, 1, 110000},
+		{labels.Labels{{Name: labels.MetricName, Value: "test_2"}}, 2, 200000},
+		{labels.Labels{{Name: labels.MetricName, Value: "other_1"}, {Name: "status", Value: "500"}}, 2, 200000},
+	}
+
+	matchers := map[string][]*labels.Matcher{
+		"no matchers":                 nil,
+		"equal metric name matcher":   {labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1")},
+		"missing metric name matcher": {labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "unknown")},
+		"regexp metric name matcher":  {labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "test_.*")},
+		"metric name and label matchers": {
+			labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "test_.*"),
+			labels.MustNewMatcher(labels.MatchEqual, "status", "500"),
+		},
+		"not equal metric name matcher": {labels.MustNewMatcher(labels.MatchNotEqual, labels.MetricName, "test_1")},
+	}
+
+	// Run the same queries on ingesters with and without the series metadata index,
+	// and compare the results.
+	ctx := user.InjectOrgID(context.Background(), "test")
+	ingesters := map[bool]*Ingester{}
+
+	for _, indexEnabled := range []bool{false, true} {
+		cfg := defaultIngesterTestConfig(t)
+		cfg.SeriesMetadataIndexEnabled = indexEnabled
+
+		i, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+		require.NoError(t, err)
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+		t.Cleanup(func() {
+			require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+		})
+
+		// Wait until it's healthy
+		test.Poll(t, 1*time.Second, 1, func() interface{} {
+			return i.lifecycler.HealthyInstancesCount()
+		})
+
+		for _, series := range series {
+			req, _, _, _ := mockWriteRequest(t, series.lbls, series.value, series.timestamp)
+			_, err := i.Push(ctx, req)
+			require.NoError(t, err)
+		}
+
+		ingesters[indexEnabled] = i
+	}
+
+	for name, matchers := range matchers {
+		t.Run(name, func(t *testing.T) {
+			for _, timeRange := range [][2]int64{{0, math.MaxInt64}, {150000, 250000}, {300000, 400000}} {
+				namesReq, err := client.ToLabelNamesRequest(model.Time(timeRange[0]), model.Time(timeRange[1]), matchers)
+				require.NoError(t, err)
+
+				expectedNames, err := ingesters[false].LabelNames(ctx, namesReq)
+				require.NoError(t, err)
+				actualNames, err := ingesters[true].LabelNames(ctx, namesReq)
+				require.NoError(t, err)
+				assert.ElementsMatch(t, expectedNames.LabelNames, actualNames.LabelNames)
+
+				for _, labelName := range []string{labels.MetricName, "status"} {
+					valuesReq, err := client.ToLabelValuesRequest(model.LabelName(labelName), model.Time(timeRange[0]), model.Time(timeRange[1]), matchers)
+					require.NoError(t, err)
+
+					expectedValues, err := ingesters[false].LabelValues(ctx, valuesReq)
+					require.NoError(t, err)
+					actualValues, err := ingesters[true].LabelValues(ctx, valuesReq)
+					require.NoError(t, err)
+					assert.ElementsMatch(t, expectedValues.LabelValues, actualValues.LabelValues)
+				}
+			}
+		})
+	}
+}
+
 func Test_Ingester_Query(t *testing.T) {
 	series := []series{
 		{labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}, {Name: "route", Value: "get_user"}}, 1, 100000},
@@ -3219,6 +3301,41 @@ func TestIngester_dontShipBlocksWhenTenantDeletionMarkerIsPresent(t *testing.T)
 	require.Equal(t, tsdbTenantMarkedForDeletion, i.closeAndDeleteUserTSDBIfIdle(userID))
 }
 
+func TestIngester_compactBlocks_ShouldTrackConcurrentHeadCompactions(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.BlocksStorageConfig.TSDB.HeadCompactionConcurrency = 2
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's healthy
+	test.Poll(t, 1*time.Second, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	for _, userID := range []string{"user-1", "user-2", "user-3"} {
+		ctx := user.InjectOrgID(context.Background(), userID)
+		req, _, _, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}}, 0, util.TimeToMillis(time.Now()))
+		_, err := i.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	i.compactBlocks(context.Background(), true, nil)
+	require.Equal(t, int64(0), i.seriesCount.Load())
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(i.metrics.compactionsTriggered))
+	assert.Equal(t, float64(0), testutil.ToFloat64(i.metrics.compactionsInflight))
+	assert.Equal(t, 1, testutil.CollectAndCount(i.metrics.compactionCycleTime))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_ingester_concurrent_head_compactions Number of TSDB head compactions currently running. Up to -blocks-storage.tsdb.head-compaction-concurrency tenants are compacted at the same time.
+		# TYPE cortex_ingester_concurrent_head_compactions gauge
+		cortex_ingester_concurrent_head_compactions 0
+	`), "cortex_ingester_concurrent_head_compactions"))
+}
+
 func TestIngester_seriesCountIsCorrectAfterClosingTSDBForDeletedTenant(t *testing.T) {
 	cfg := defaultIngesterTestConfig(t)
 	cfg.BlocksStorageConfig.TSDB.ShipConcurrency = 2
@@ -5408,6 +5525,143 @@ func TestIngesterActiveSeries(t *testing.T) {
 	}
 }
 
+func TestIngesterActiveSeries_CustomTrackerCardinalityLimit(t *testing.T) {
+	labelsToPush := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "1"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "2"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "3"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "b", "pod", "1"),
+	}
+
+	req := func(lbls labels.Labels, t time.Time) *mimirpb.WriteRequest {
+		return mimirpb.ToWriteRequest(
+			[]labels.Labels{lbls},
+			[]mimirpb.Sample{{Value: 1, TimestampMs: t.UnixMilli()}},
+			nil,
+			nil,
+			mimirpb.API,
+		)
+	}
+
+	activeSeriesConfig, err := activeseries.NewCustomTrackersConfigWithOptions(map[string]string{
+		"team_a": `{team="a"}`,
+		"team_b": `{team="b"}`,
+	}, map[string]activeseries.CustomTrackerOptions{"team_a": {CardinalityLimit: 2}})
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	cfg := defaultIngesterTestConfig(t)
+	cfg.ActiveSeriesMetricsEnabled = true
+
+	limits := defaultLimitsTestConfig()
+	limits.ActiveSeriesCustomTrackersConfig = activeSeriesConfig
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	pushWithUser(t, ing, labelsToPush, "test_user", req)
+	ing.updateActiveSeries(time.Now())
+
+	expectedMetrics := `
+		# HELP cortex_ingester_active_series Number of currently active series per user.
+		# TYPE cortex_ingester_active_series gauge
+		cortex_ingester_active_series{user="test_user"} 4
+		# HELP cortex_ingester_active_series_custom_tracker Number of currently active series matching a pre-configured label matchers per user.
+		# TYPE cortex_ingester_active_series_custom_tracker gauge
+		cortex_ingester_active_series_custom_tracker{name="team_a",user="test_user"} 2
+		cortex_ingester_active_series_custom_tracker{name="team_b",user="test_user"} 1
+		# HELP cortex_ingester_active_series_custom_tracker_cardinality_limit_exceeded_total Total number of active series not counted by a custom tracker because the tracker reached its cardinality limit, per user.
+		# TYPE cortex_ingester_active_series_custom_tracker_cardinality_limit_exceeded_total counter
+		cortex_ingester_active_series_custom_tracker_cardinality_limit_exceeded_total{name="team_a",user="test_user"} 1
+	`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expectedMetrics),
+		"cortex_ingester_active_series",
+		"cortex_ingester_active_series_custom_tracker",
+		"cortex_ingester_active_series_custom_tracker_cardinality_limit_exceeded_total",
+	))
+}
+
+func TestIngesterActiveSeries_CustomTrackerHistogram(t *testing.T) {
+	labelsToPush := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "1"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "2"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "b", "pod", "1"),
+	}
+
+	req := func(lbls labels.Labels, t time.Time) *mimirpb.WriteRequest {
+		return mimirpb.ToWriteRequest(
+			[]labels.Labels{lbls},
+			[]mimirpb.Sample{{Value: 1, TimestampMs: t.UnixMilli()}},
+			nil,
+			nil,
+			mimirpb.API,
+		)
+	}
+
+	activeSeriesConfig, err := activeseries.NewCustomTrackersConfigWithOptions(map[string]string{
+		"team_a": `{team="a"}`,
+		"team_b": `{team="b"}`,
+		"team_c": `{team="c"}`,
+	}, map[string]activeseries.CustomTrackerOptions{
+		"team_a": {ExposeHistogram: true, HistogramBuckets: []float64{1, 2, 4}},
+		"team_c": {ExposeHistogram: true, HistogramBuckets: []float64{1, 10}},
+	})
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	cfg := defaultIngesterTestConfig(t)
+	cfg.ActiveSeriesMetricsEnabled = true
+
+	limits := defaultLimitsTestConfig()
+	limits.ActiveSeriesCustomTrackersConfig = activeSeriesConfig
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	pushWithUser(t, ing, labelsToPush[:1], "test_user", req)
+	ing.updateActiveSeries(time.Now())
+	pushWithUser(t, ing, labelsToPush[1:], "test_user", req)
+	ing.updateActiveSeries(time.Now())
+
+	// The zero counts are observed too, while the trackers not exposing the histogram have no histogram.
+	expectedMetrics := `
+		# HELP cortex_ingester_active_series_custom_tracker_count_histogram Distribution of the number of currently active series matching a pre-configured label matchers per user, observed each time the active series are updated.
+		# TYPE cortex_ingester_active_series_custom_tracker_count_histogram histogram
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_a",user="test_user",le="1"} 1
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_a",user="test_user",le="2"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_a",user="test_user",le="4"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_a",user="test_user",le="+Inf"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_sum{name="team_a",user="test_user"} 3
+		cortex_ingester_active_series_custom_tracker_count_histogram_count{name="team_a",user="test_user"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_c",user="test_user",le="1"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_c",user="test_user",le="10"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_bucket{name="team_c",user="test_user",le="+Inf"} 2
+		cortex_ingester_active_series_custom_tracker_count_histogram_sum{name="team_c",user="test_user"} 0
+		cortex_ingester_active_series_custom_tracker_count_histogram_count{name="team_c",user="test_user"} 2
+	`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expectedMetrics), "cortex_ingester_active_series_custom_tracker_count_histogram"))
+
+	// The histograms are removed when the TSDB is closed.
+	ing.closeAllTSDB()
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(""), "cortex_ingester_active_series_custom_tracker_count_histogram"))
+}
+
 func TestIngesterActiveSeriesConfigChanges(t *testing.T) {
 	labelsToPush := []labels.Labels{
 		labels.FromStrings(labels.MetricName, "test_metric", "bool", "false", "team", "a"),
@@ -5755,6 +6009,157 @@ func pushWithUser(t *testing.T, ingester *Ingester, labelsToPush []labels.Labels
 	}
 }
 
+func TestIngester_ActiveSeriesCustomTrackersHandler(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.ActiveSeriesMetricsEnabled = true
+
+	limits := defaultLimitsTestConfig()
+	limits.ActiveSeriesCustomTrackersConfig = mustNewActiveSeriesCustomTrackersConfigFromMap(t, map[string]string{
+		"team_a": `{team="a"}`,
+		"team_b": `{team="b"}`,
+	})
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, "", prometheus.NewRegistry())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	get := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/active-series-custom-trackers", nil)
+		rec := httptest.NewRecorder()
+		ing.ActiveSeriesCustomTrackersHandler(rec, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+		return rec
+	}
+
+	// The tenant has no TSDB yet.
+	assert.Equal(t, http.StatusNotFound, get("user-1").Code)
+
+	pushWithUser(t, ing, []labels.Labels{
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "1"),
+		labels.FromStrings(labels.MetricName, "test_metric", "team", "c"),
+	}, "user-1", func(lbls labels.Labels, t time.Time) *mimirpb.WriteRequest {
+		return mimirpb.ToWriteRequest([]labels.Labels{lbls}, []mimirpb.Sample{{Value: 1, TimestampMs: t.UnixMilli()}}, nil, nil, mimirpb.API)
+	})
+
+	// The active series have not been counted yet.
+	assert.Equal(t, http.StatusServiceUnavailable, get("user-1").Code)
+
+	now := time.Now()
+	ing.updateActiveSeries(now)
+
+	rec := get("user-1")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status map[string]activeseries.CustomTrackerStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Len(t, status, 2)
+	assert.Equal(t, `{team="a"}`, status["team_a"].Matcher)
+	assert.Equal(t, 2, status["team_a"].ActiveSeries)
+	assert.True(t, now.Equal(status["team_a"].LastPurge))
+	assert.Equal(t, `{team="b"}`, status["team_b"].Matcher)
+	assert.Equal(t, 0, status["team_b"].ActiveSeries)
+}
+
+func TestIngester_ActiveSeriesSnapshotOnRestart(t *testing.T) {
+	const userID = "user-1"
+
+	trackers := map[string]string{
+		"team_a": `{team="a"}`,
+		"team_b": `{team="b"}`,
+	}
+
+	startIngester := func(t *testing.T, dataDir string, trackers map[string]string) *Ingester {
+		cfg := defaultIngesterTestConfig(t)
+		cfg.ActiveSeriesMetricsEnabled = true
+		cfg.BlocksStorageConfig.TSDB.MemorySnapshotOnShutdown = true
+
+		limits := defaultLimitsTestConfig()
+		limits.ActiveSeriesCustomTrackersConfig = mustNewActiveSeriesCustomTrackersConfigFromMap(t, trackers)
+		overrides, err := validation.NewOverrides(limits, nil)
+		require.NoError(t, err)
+
+		ing, err := prepareIngesterWithBlockStorageAndOverrides(t, cfg, overrides, dataDir, nil)
+		require.NoError(t, err)
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+
+		test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+			return ing.lifecycler.HealthyInstancesCount()
+		})
+		return ing
+	}
+
+	push := func(t *testing.T, ing *Ingester) {
+		pushWithUser(t, ing, []labels.Labels{
+			labels.FromStrings(labels.MetricName, "test_metric", "team", "a"),
+			labels.FromStrings(labels.MetricName, "test_metric", "team", "a", "pod", "1"),
+			labels.FromStrings(labels.MetricName, "test_metric", "team", "b"),
+		}, userID, func(lbls labels.Labels, t time.Time) *mimirpb.WriteRequest {
+			return mimirpb.ToWriteRequest([]labels.Labels{lbls}, []mimirpb.Sample{{Value: 1, TimestampMs: t.UnixMilli()}}, nil, nil, mimirpb.API)
+		})
+	}
+
+	pushAndStop := func(t *testing.T, dataDir string) {
+		ing := startIngester(t, dataDir, trackers)
+		push(t, ing)
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), ing))
+
+		require.FileExists(t, filepath.Join(dataDir, userID, activeSeriesSnapshotFilename))
+	}
+
+	t.Run("should restore the active series from the snapshot", func(t *testing.T) {
+		dataDir := t.TempDir()
+		pushAndStop(t, dataDir)
+
+		ing := startIngester(t, dataDir, trackers)
+		defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+		// The snapshot is removed once restored.
+		require.NoFileExists(t, filepath.Join(dataDir, userID, activeSeriesSnapshotFilename))
+
+		allActive, activeMatching, valid := ing.getTSDB(userID).activeSeries.Active(time.Now())
+		require.True(t, valid)
+		assert.Equal(t, 3, allActive)
+		assert.Equal(t, []int{2, 1}, activeMatching)
+	})
+
+	t.Run("should discard the snapshot if the custom trackers changed", func(t *testing.T) {
+		dataDir := t.TempDir()
+		pushAndStop(t, dataDir)
+
+		ing := startIngester(t, dataDir, map[string]string{"team_a": `{team="a"}`})
+		defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+		allActive, activeMatching, valid := ing.getTSDB(userID).activeSeries.Active(time.Now())
+		require.True(t, valid)
+		assert.Equal(t, 0, allActive)
+		assert.Equal(t, []int{0}, activeMatching)
+	})
+
+	t.Run("should write the snapshot on head compaction cutting a block", func(t *testing.T) {
+		dataDir := t.TempDir()
+		ing := startIngester(t, dataDir, trackers)
+		defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+		push(t, ing)
+		require.NoFileExists(t, filepath.Join(dataDir, userID, activeSeriesSnapshotFilename))
+
+		// The head is not compacted yet, so no block is cut.
+		ing.compactBlocks(context.Background(), false, nil)
+		require.NoFileExists(t, filepath.Join(dataDir, userID, activeSeriesSnapshotFilename))
+
+		ing.compactBlocks(context.Background(), true, nil)
+		require.FileExists(t, filepath.Join(dataDir, userID, activeSeriesSnapshotFilename))
+	})
+}
+
 func TestGetIgnoreSeriesLimitForMetricNamesMap(t *testing.T) {
 	cfg := Config{}
 
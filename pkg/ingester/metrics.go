@@ -6,6 +6,8 @@
 package ingester
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/atomic"
@@ -20,6 +22,7 @@ type ingesterMetrics struct {
 	ingestedExemplars       prometheus.Counter
 	ingestedMetadata        prometheus.Counter
 	ingestedSamplesFail     *prometheus.CounterVec
+	coalescedSamples        *prometheus.CounterVec
 	ingestedExemplarsFail   prometheus.Counter
 	ingestedMetadataFail    prometheus.Counter
 	queries                 prometheus.Counter
@@ -31,9 +34,11 @@ type ingesterMetrics struct {
 	memMetadataCreatedTotal *prometheus.CounterVec
 	memMetadataRemovedTotal *prometheus.CounterVec
 
-	activeSeriesLoading               *prometheus.GaugeVec
-	activeSeriesPerUser               *prometheus.GaugeVec
-	activeSeriesCustomTrackersPerUser *prometheus.GaugeVec
+	activeSeriesLoading                               *prometheus.GaugeVec
+	activeSeriesPerUser                               *prometheus.GaugeVec
+	activeSeriesCustomTrackersPerUser                 *prometheus.GaugeVec
+	activeSeriesCustomTrackerCardinalityLimitExceeded *prometheus.CounterVec
+	activeSeriesCustomTrackerHistograms               *customTrackerHistograms
 
 	// Global limit metrics
 	maxUsersGauge           prometheus.GaugeFunc
@@ -46,11 +51,15 @@ type ingesterMetrics struct {
 	// Head compactions metrics.
 	compactionsTriggered   prometheus.Counter
 	compactionsFailed      prometheus.Counter
+	compactionsInflight    prometheus.Gauge
+	compactionCycleTime    prometheus.Histogram
 	walReplayTime          prometheus.Histogram
 	appenderAddDuration    prometheus.Histogram
 	appenderCommitDuration prometheus.Histogram
 	idleTsdbChecks         *prometheus.CounterVec
 
+	predictedSeriesLimitHit *prometheus.GaugeVec
+
 	// Discarded samples
 	discardedSamplesSampleOutOfBounds    *prometheus.CounterVec
 	discardedSamplesSampleOutOfOrder     *prometheus.CounterVec
@@ -116,6 +125,10 @@ func newIngesterMetrics(
 			Name: "cortex_ingester_ingested_samples_failures_total",
 			Help: "The total number of samples that errored on ingestion per user.",
 		}, []string{"user"}),
+		coalescedSamples: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_coalesced_samples_total",
+			Help: "The total number of duplicate samples removed from push requests before being appended, per user.",
+		}, []string{"user"}),
 		ingestedExemplarsFail: promauto.With(r).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ingester_ingested_exemplars_failures_total",
 			Help: "The total number of exemplars that errored on ingestion.",
@@ -245,6 +258,12 @@ func newIngesterMetrics(
 			Help: "Number of currently active series matching a pre-configured label matchers per user.",
 		}, []string{"user", "name"}),
 
+		// Not registered automatically, but only if activeSeriesEnabled is true.
+		activeSeriesCustomTrackerCardinalityLimitExceeded: promauto.With(activeSeriesReg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_active_series_custom_tracker_cardinality_limit_exceeded_total",
+			Help: "Total number of active series not counted by a custom tracker because the tracker reached its cardinality limit, per user.",
+		}, []string{"user", "name"}),
+
 		compactionsTriggered: promauto.With(r).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ingester_tsdb_compactions_triggered_total",
 			Help: "Total number of triggered compactions.",
@@ -254,6 +273,19 @@ func newIngesterMetrics(
 			Name: "cortex_ingester_tsdb_compactions_failed_total",
 			Help: "Total number of compactions that failed.",
 		}),
+		predictedSeriesLimitHit: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ingester_predicted_series_limit_hit_seconds",
+			Help: "Unix timestamp at which the number of in-memory series of the tenant is predicted to hit the series limit, based on the growth of the last day. 0 if the number of series is not growing.",
+		}, []string{"user"}),
+		compactionsInflight: promauto.With(r).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_ingester_concurrent_head_compactions",
+			Help: "Number of TSDB head compactions currently running. Up to -blocks-storage.tsdb.head-compaction-concurrency tenants are compacted at the same time.",
+		}),
+		compactionCycleTime: promauto.With(r).NewHistogram(prometheus.HistogramOpts{
+			Name:    "cortex_ingester_tsdb_compaction_cycle_duration_seconds",
+			Help:    "The total time it takes to compact the TSDB heads of all tenants, including the time spent waiting for a free compaction slot.",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800},
+		}),
 		walReplayTime: promauto.With(r).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_ingester_tsdb_wal_replay_duration_seconds",
 			Help:    "The total time it takes to open and replay a TSDB WAL.",
@@ -281,6 +313,13 @@ func newIngesterMetrics(
 
 		discardedMetadataPerUserMetadataLimit:   validation.DiscardedMetadataCounter(r, perUserMetadataLimit),
 		discardedMetadataPerMetricMetadataLimit: validation.DiscardedMetadataCounter(r, perMetricMetadataLimit),
+
+		activeSeriesCustomTrackerHistograms: newCustomTrackerHistograms(),
+	}
+
+	// Not registered automatically, but only if activeSeriesEnabled is true.
+	if activeSeriesReg != nil {
+		activeSeriesReg.MustRegister(m.activeSeriesCustomTrackerHistograms)
 	}
 
 	return m
@@ -289,6 +328,7 @@ func newIngesterMetrics(
 func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 	m.ingestedSamples.DeleteLabelValues(userID)
 	m.ingestedSamplesFail.DeleteLabelValues(userID)
+	m.coalescedSamples.DeleteLabelValues(userID)
 	m.memMetadataCreatedTotal.DeleteLabelValues(userID)
 	m.memMetadataRemovedTotal.DeleteLabelValues(userID)
 
@@ -301,6 +341,8 @@ func (m *ingesterMetrics) deletePerUserMetrics(userID string) {
 
 	m.discardedMetadataPerUserMetadataLimit.DeleteLabelValues(userID)
 	m.discardedMetadataPerMetricMetadataLimit.DeleteLabelValues(userID)
+
+	m.predictedSeriesLimitHit.DeleteLabelValues(userID)
 }
 
 func (m *ingesterMetrics) deletePerUserCustomTrackerMetrics(userID string, customTrackerMetrics []string) {
@@ -308,6 +350,65 @@ func (m *ingesterMetrics) deletePerUserCustomTrackerMetrics(userID string, custo
 	m.activeSeriesPerUser.DeleteLabelValues(userID)
 	for _, name := range customTrackerMetrics {
 		m.activeSeriesCustomTrackersPerUser.DeleteLabelValues(userID, name)
+		m.activeSeriesCustomTrackerCardinalityLimitExceeded.DeleteLabelValues(userID, name)
+		m.activeSeriesCustomTrackerHistograms.delete(userID, name)
+	}
+}
+
+// customTrackerHistograms is a collector of the histograms of the active series count of the custom trackers
+// configured to expose it, per user. Each histogram can have different buckets, so a HistogramVec can't be used.
+type customTrackerHistograms struct {
+	mtx        sync.Mutex
+	histograms map[customTrackerKey]prometheus.Histogram
+}
+
+type customTrackerKey struct {
+	userID, name string
+}
+
+func newCustomTrackerHistograms() *customTrackerHistograms {
+	return &customTrackerHistograms{
+		histograms: map[customTrackerKey]prometheus.Histogram{},
+	}
+}
+
+// observe records the active series count of the input tracker, creating its histogram with the input buckets if it doesn't exist.
+func (h *customTrackerHistograms) observe(userID, name string, buckets []float64, count float64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	key := customTrackerKey{userID: userID, name: name}
+	histogram, ok := h.histograms[key]
+	if !ok {
+		histogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "cortex_ingester_active_series_custom_tracker_count_histogram",
+			Help:        "Distribution of the number of currently active series matching a pre-configured label matchers per user, observed each time the active series are updated.",
+			ConstLabels: prometheus.Labels{"user": userID, "name": name},
+			Buckets:     buckets,
+		})
+		h.histograms[key] = histogram
+	}
+	histogram.Observe(count)
+}
+
+func (h *customTrackerHistograms) delete(userID, name string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	delete(h.histograms, customTrackerKey{userID: userID, name: name})
+}
+
+// Describe implements prometheus.Collector. No descriptor is sent, making this an unchecked collector,
+// because the histograms are created on demand with the user and tracker name as constant labels.
+func (h *customTrackerHistograms) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (h *customTrackerHistograms) Collect(out chan<- prometheus.Metric) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for _, histogram := range h.histograms {
+		histogram.Collect(out)
 	}
 }
 
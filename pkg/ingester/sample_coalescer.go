@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"math"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+var sampleCoalescerPool = sync.Pool{
+	New: func() interface{} {
+		return NewSampleCoalescer()
+	},
+}
+
+// SampleCoalescer removes the duplicate samples from a push request before they're appended to the TSDB.
+// Duplicate samples are typically received when Prometheus retries sending a batch which was partially
+// ingested. A sample is a duplicate when a sample with the same series, timestamp and value has already
+// been found in the same request: these samples would be ignored by the TSDB anyway, but only after taking
+// the per-series lock. Samples with the same series and timestamp but a different value are not removed,
+// so that they're still rejected by the TSDB and reported back to the client.
+//
+// A SampleCoalescer is not safe for concurrent use.
+type SampleCoalescer struct {
+	seen map[coalescedSampleKey]coalescedSample
+}
+
+type coalescedSampleKey struct {
+	fingerprint uint64
+	timestampMs int64
+}
+
+type coalescedSample struct {
+	// series is the index of the series in the request.
+	series int
+	// value is the IEEE 754 binary representation of the sample value, so that NaN values (e.g. stale markers) are compared too.
+	value uint64
+}
+
+// NewSampleCoalescer makes a new SampleCoalescer.
+func NewSampleCoalescer() *SampleCoalescer {
+	return &SampleCoalescer{
+		seen: map[coalescedSampleKey]coalescedSample{},
+	}
+}
+
+// Coalesce removes in-place the duplicate samples from the input series, and returns the number of removed samples.
+func (c *SampleCoalescer) Coalesce(timeseries []mimirpb.PreallocTimeseries) int {
+	removed := 0
+
+	for idx, ts := range timeseries {
+		if len(ts.Samples) == 0 {
+			continue
+		}
+
+		lbls := mimirpb.FromLabelAdaptersToLabels(ts.Labels)
+		fingerprint := lbls.Hash()
+
+		kept := ts.Samples[:0]
+		for _, s := range ts.Samples {
+			key := coalescedSampleKey{fingerprint: fingerprint, timestampMs: s.TimestampMs}
+			value := math.Float64bits(s.Value)
+
+			prev, ok := c.seen[key]
+			if !ok {
+				c.seen[key] = coalescedSample{series: idx, value: value}
+			} else if prev.value == value && c.sameSeries(timeseries, prev.series, idx, lbls) {
+				removed++
+				continue
+			}
+
+			kept = append(kept, s)
+		}
+		ts.Samples = kept
+	}
+
+	return removed
+}
+
+// sameSeries returns whether the series at index prev and the current one, with the given labels, are the same.
+// The labels are compared because two different series may have the same fingerprint.
+func (c *SampleCoalescer) sameSeries(timeseries []mimirpb.PreallocTimeseries, prev, curr int, currLabels labels.Labels) bool {
+	return prev == curr || labels.Equal(mimirpb.FromLabelAdaptersToLabels(timeseries[prev].Labels), currLabels)
+}
+
+// reset clears the state of the coalescer, so that it can be reused for another request.
+func (c *SampleCoalescer) reset() {
+	for key := range c.seen {
+		delete(c.seen, key)
+	}
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestSampleCoalescer_Coalesce(t *testing.T) {
+	series1 := labels.FromStrings(labels.MetricName, "metric", "series", "1")
+	series2 := labels.FromStrings(labels.MetricName, "metric", "series", "2")
+
+	newSeries := func(lbls labels.Labels, samples ...mimirpb.Sample) mimirpb.PreallocTimeseries {
+		return mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  mimirpb.FromLabelsToLabelAdapters(lbls),
+			Samples: samples,
+		}}
+	}
+
+	tests := map[string]struct {
+		input           []mimirpb.PreallocTimeseries
+		expected        []mimirpb.PreallocTimeseries
+		expectedRemoved int
+	}{
+		"no duplicates": {
+			input: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+				newSeries(series2, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+			},
+			expected: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+				newSeries(series2, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+			},
+		},
+		"duplicates within the same series": {
+			input: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+			},
+			expected: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+			},
+			expectedRemoved: 1,
+		},
+		"duplicates across repeated series": {
+			input: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+				newSeries(series2, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}, mimirpb.Sample{TimestampMs: 3, Value: 3}),
+			},
+			expected: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}, mimirpb.Sample{TimestampMs: 2, Value: 2}),
+				newSeries(series2, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+				newSeries(series1, mimirpb.Sample{TimestampMs: 3, Value: 3}),
+			},
+			expectedRemoved: 2,
+		},
+		"samples with the same timestamp but a different value are not removed": {
+			input: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 2}),
+			},
+			expected: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 1}),
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: 2}),
+			},
+		},
+		"duplicate stale markers": {
+			input: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: math.Float64frombits(value.StaleNaN)}),
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: math.Float64frombits(value.StaleNaN)}),
+			},
+			expected: []mimirpb.PreallocTimeseries{
+				newSeries(series1, mimirpb.Sample{TimestampMs: 1, Value: math.Float64frombits(value.StaleNaN)}),
+				newSeries(series1),
+			},
+			expectedRemoved: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			c := NewSampleCoalescer()
+			assert.Equal(t, testData.expectedRemoved, c.Coalesce(testData.input))
+
+			require.Len(t, testData.input, len(testData.expected))
+			for idx, expected := range testData.expected {
+				assert.Equal(t, expected.Labels, testData.input[idx].Labels)
+				assert.Equal(t, len(expected.Samples), len(testData.input[idx].Samples))
+				for s := range expected.Samples {
+					assert.Equal(t, expected.Samples[s].TimestampMs, testData.input[idx].Samples[s].TimestampMs)
+					assert.Equal(t, math.Float64bits(expected.Samples[s].Value), math.Float64bits(testData.input[idx].Samples[s].Value))
+				}
+			}
+		})
+	}
+}
+
+func TestIngester_Push_ShouldCoalesceDuplicateSamples(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	cfg := defaultIngesterTestConfig(t)
+	cfg.SampleCoalescingEnabled = true
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is healthy
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	series := labels.FromStrings(labels.MetricName, "test")
+	now := time.Now().UnixMilli()
+	req := mimirpb.ToWriteRequest(
+		[]labels.Labels{series, series},
+		[]mimirpb.Sample{{TimestampMs: now, Value: 1}, {TimestampMs: now, Value: 1}},
+		nil, nil, mimirpb.API)
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	_, err = i.Push(ctx, req)
+	require.NoError(t, err)
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_ingester_coalesced_samples_total The total number of duplicate samples removed from push requests before being appended, per user.
+		# TYPE cortex_ingester_coalesced_samples_total counter
+		cortex_ingester_coalesced_samples_total{user="test"} 1
+		# HELP cortex_ingester_ingested_samples_total The total number of samples ingested per user.
+		# TYPE cortex_ingester_ingested_samples_total counter
+		cortex_ingester_ingested_samples_total{user="test"} 1
+	`), "cortex_ingester_coalesced_samples_total", "cortex_ingester_ingested_samples_total"))
+}
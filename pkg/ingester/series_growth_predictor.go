@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// seriesGrowthSamplingInterval is the interval at which the number of series of each tenant is sampled.
+	seriesGrowthSamplingInterval = time.Hour
+
+	// seriesGrowthMaxSamples is the number of samples the growth is predicted from, so the prediction is based
+	// on the growth of the last day.
+	seriesGrowthMaxSamples = 24
+)
+
+type seriesCountSample struct {
+	timestamp time.Time
+	series    int
+}
+
+// SeriesGrowthPredictor forecasts, for a single tenant, when the number of in-memory series will hit the series
+// limit. The prediction is computed fitting a linear regression to the last samples of the number of series.
+type SeriesGrowthPredictor struct {
+	mtx sync.Mutex
+
+	// Ring buffer of the samples. The oldest sample is at index next once the buffer is full.
+	samples    [seriesGrowthMaxSamples]seriesCountSample
+	next       int
+	numSamples int
+}
+
+// NewSeriesGrowthPredictor makes a new SeriesGrowthPredictor.
+func NewSeriesGrowthPredictor() *SeriesGrowthPredictor {
+	return &SeriesGrowthPredictor{}
+}
+
+// Observe adds a sample of the number of series, replacing the oldest sample if the buffer is full.
+func (p *SeriesGrowthPredictor) Observe(now time.Time, series int) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.samples[p.next] = seriesCountSample{timestamp: now, series: series}
+	p.next = (p.next + 1) % seriesGrowthMaxSamples
+	if p.numSamples < seriesGrowthMaxSamples {
+		p.numSamples++
+	}
+}
+
+// PredictLimitHit returns the time at which the number of series is predicted to hit the input limit. It returns
+// false if the number of series is not growing, there are not enough samples to predict the growth, or the limit
+// is hundreds of years away. The returned time is in the past if the limit has already been hit.
+func (p *SeriesGrowthPredictor) PredictLimitHit(limit int) (time.Time, bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.numSamples < 2 {
+		return time.Time{}, false
+	}
+
+	// Timestamps are relative to the oldest sample, to preserve the precision of the regression.
+	oldest := p.samples[(p.next-p.numSamples+seriesGrowthMaxSamples)%seriesGrowthMaxSamples].timestamp
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i := 0; i < p.numSamples; i++ {
+		s := p.samples[(p.next-p.numSamples+i+seriesGrowthMaxSamples)%seriesGrowthMaxSamples]
+		x := s.timestamp.Sub(oldest).Seconds()
+		y := float64(s.series)
+
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	n := float64(p.numSamples)
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		// All samples have the same timestamp.
+		return time.Time{}, false
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return time.Time{}, false
+	}
+
+	intercept := (sumY - slope*sumX) / n
+	secondsToLimit := (float64(limit) - intercept) / slope
+	if math.Abs(secondsToLimit) >= math.MaxInt64/float64(time.Second) {
+		// The limit hit is too far from the oldest sample to be represented.
+		return time.Time{}, false
+	}
+
+	return oldest.Add(time.Duration(secondsToLimit * float64(time.Second))), true
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestSeriesGrowthPredictor(t *testing.T) {
+	start := time.Unix(1_000_000, 0)
+
+	t.Run("should not predict with less than 2 samples", func(t *testing.T) {
+		p := NewSeriesGrowthPredictor()
+		_, ok := p.PredictLimitHit(100)
+		assert.False(t, ok)
+
+		p.Observe(start, 10)
+		_, ok = p.PredictLimitHit(100)
+		assert.False(t, ok)
+	})
+
+	t.Run("should predict the limit hit on linear growth", func(t *testing.T) {
+		p := NewSeriesGrowthPredictor()
+		for h := 0; h < 5; h++ {
+			p.Observe(start.Add(time.Duration(h)*time.Hour), 100+10*h)
+		}
+
+		hit, ok := p.PredictLimitHit(200)
+		require.True(t, ok)
+		assert.Equal(t, start.Add(10*time.Hour), hit)
+
+		// The limit has already been hit.
+		hit, ok = p.PredictLimitHit(120)
+		require.True(t, ok)
+		assert.Equal(t, start.Add(2*time.Hour), hit)
+	})
+
+	t.Run("should not predict if the number of series is not growing", func(t *testing.T) {
+		p := NewSeriesGrowthPredictor()
+		p.Observe(start, 100)
+		p.Observe(start.Add(time.Hour), 100)
+		_, ok := p.PredictLimitHit(200)
+		assert.False(t, ok)
+
+		p.Observe(start.Add(2*time.Hour), 50)
+		_, ok = p.PredictLimitHit(200)
+		assert.False(t, ok)
+	})
+
+	t.Run("should predict from the last samples only", func(t *testing.T) {
+		p := NewSeriesGrowthPredictor()
+
+		// The series were decreasing, then started growing.
+		for h := 0; h < seriesGrowthMaxSamples; h++ {
+			p.Observe(start.Add(time.Duration(h)*time.Hour), 1000-h)
+		}
+		_, ok := p.PredictLimitHit(2000)
+		assert.False(t, ok)
+
+		// Replace all the samples of the decreasing trend.
+		next := start.Add(seriesGrowthMaxSamples * time.Hour)
+		for h := 0; h < seriesGrowthMaxSamples; h++ {
+			p.Observe(next.Add(time.Duration(h)*time.Hour), 1000+100*h)
+		}
+		hit, ok := p.PredictLimitHit(4000)
+		require.True(t, ok)
+		assert.Equal(t, next.Add(30*time.Hour), hit)
+	})
+
+	t.Run("should not predict if the limit hit is too far away", func(t *testing.T) {
+		p := NewSeriesGrowthPredictor()
+		p.Observe(start, 0)
+		p.Observe(start.Add(time.Hour), 1)
+
+		_, ok := p.PredictLimitHit(1_000_000_000)
+		assert.False(t, ok)
+	})
+}
+
+func TestIngester_SeriesGrowthPrediction(t *testing.T) {
+	cfg := defaultIngesterTestConfig(t)
+	cfg.SeriesGrowthPredictionEnabled = true
+
+	limits := defaultLimitsTestConfig()
+	limits.MaxGlobalSeriesPerUser = 100
+
+	registry := prometheus.NewRegistry()
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", registry)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until the ingester is healthy
+	test.Poll(t, 100*time.Millisecond, 1, func() interface{} {
+		return i.lifecycler.HealthyInstancesCount()
+	})
+
+	push := func(userID string, numSeries int) {
+		series := make([]labels.Labels, 0, numSeries)
+		samples := make([]mimirpb.Sample, 0, numSeries)
+		for n := 0; n < numSeries; n++ {
+			series = append(series, labels.FromStrings(labels.MetricName, "test", "series", fmt.Sprintf("%d", n)))
+			samples = append(samples, mimirpb.Sample{Value: 1, TimestampMs: time.Now().UnixMilli()})
+		}
+
+		_, err := i.Push(user.InjectOrgID(context.Background(), userID), mimirpb.ToWriteRequest(series, samples, nil, nil, mimirpb.API))
+		require.NoError(t, err)
+	}
+
+	limit := i.limiter.maxSeriesPerUser("user-1")
+	now := time.Now()
+
+	push("user-1", 10)
+	push("user-2", 10)
+	i.updateSeriesGrowthPredictions(now)
+
+	// There are not enough samples to predict the growth yet.
+	assert.Equal(t, float64(0), testutil.ToFloat64(i.metrics.predictedSeriesLimitHit.WithLabelValues("user-1")))
+
+	// user-1 grows by 10 series per hour, while user-2 doesn't grow.
+	push("user-1", 20)
+	i.updateSeriesGrowthPredictions(now.Add(time.Hour))
+
+	expected := now.Add(time.Duration(limit-10) * time.Hour / 10)
+	assert.Equal(t, float64(expected.Unix()), testutil.ToFloat64(i.metrics.predictedSeriesLimitHit.WithLabelValues("user-1")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(i.metrics.predictedSeriesLimitHit.WithLabelValues("user-2")))
+
+	// The metric is removed when the tenant metrics are deleted.
+	i.metrics.deletePerUserMetrics("user-1")
+	assert.Equal(t, 1, testutil.CollectAndCount(i.metrics.predictedSeriesLimitHit))
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/segmentio/fasthash/fnv1a"
+)
+
+const numSeriesMetadataIndexShards = 128
+
+type seriesMetadataIndexShard struct {
+	mtx    sync.RWMutex
+	series map[string]*metricSeries
+}
+
+// metricSeries holds the fingerprints of the series of a metric name. The fingerprints are kept in a map,
+// so that adding and deleting a series is O(1) even when the whole head is loaded at WAL replay, and are
+// sorted lazily when read.
+type metricSeries struct {
+	// fps holds the number of series with each fingerprint, given fingerprints of different series may collide.
+	fps map[model.Fingerprint]int
+
+	// sorted holds the sorted fingerprints, or nil if they have been modified since last sorted.
+	sorted []model.Fingerprint
+}
+
+// SeriesMetadataIndex maps each metric name to the fingerprints of the in-memory series with that
+// metric name. It's kept up to date by the TSDB head series lifecycle callbacks, and allows to answer
+// some label names and values queries without scanning the head index.
+type SeriesMetadataIndex struct {
+	shards []seriesMetadataIndexShard
+}
+
+// NewSeriesMetadataIndex makes a new empty SeriesMetadataIndex.
+func NewSeriesMetadataIndex() *SeriesMetadataIndex {
+	shards := make([]seriesMetadataIndexShard, 0, numSeriesMetadataIndexShards)
+	for i := 0; i < numSeriesMetadataIndexShards; i++ {
+		shards = append(shards, seriesMetadataIndexShard{
+			series: map[string]*metricSeries{},
+		})
+	}
+	return &SeriesMetadataIndex{shards: shards}
+}
+
+func (idx *SeriesMetadataIndex) getShard(metricName string) *seriesMetadataIndexShard {
+	return &idx.shards[fnv1a.HashString64(metricName)%numSeriesMetadataIndexShards]
+}
+
+// Add adds the series with the input fingerprint to the metric name. Fingerprints of different series
+// may collide, so the same fingerprint can be added more than once.
+func (idx *SeriesMetadataIndex) Add(metricName string, fp model.Fingerprint) {
+	shard := idx.getShard(metricName)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+
+	ms, ok := shard.series[metricName]
+	if !ok {
+		ms = &metricSeries{fps: map[model.Fingerprint]int{}}
+		shard.series[metricName] = ms
+	}
+	ms.fps[fp]++
+	ms.sorted = nil
+}
+
+// Delete removes the series with the input fingerprint from the metric name.
+func (idx *SeriesMetadataIndex) Delete(metricName string, fp model.Fingerprint) {
+	shard := idx.getShard(metricName)
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+
+	ms, ok := shard.series[metricName]
+	if !ok {
+		return
+	}
+
+	count, ok := ms.fps[fp]
+	switch {
+	case !ok:
+		return
+	case count > 1:
+		ms.fps[fp] = count - 1
+	case len(ms.fps) == 1:
+		delete(shard.series, metricName)
+		return
+	default:
+		delete(ms.fps, fp)
+	}
+	ms.sorted = nil
+}
+
+// Fingerprints returns the sorted fingerprints of the series with the input metric name.
+func (idx *SeriesMetadataIndex) Fingerprints(metricName string) []model.Fingerprint {
+	shard := idx.getShard(metricName)
+
+	shard.mtx.RLock()
+	ms, ok := shard.series[metricName]
+	if !ok {
+		shard.mtx.RUnlock()
+		return nil
+	}
+	if ms.sorted != nil {
+		defer shard.mtx.RUnlock()
+		return append([]model.Fingerprint(nil), ms.sorted...)
+	}
+	shard.mtx.RUnlock()
+
+	// The fingerprints need to be sorted, so the write lock is required to cache them.
+	shard.mtx.Lock()
+	defer shard.mtx.Unlock()
+
+	// The series may have been deleted, or already sorted, while the lock was released.
+	ms, ok = shard.series[metricName]
+	if !ok {
+		return nil
+	}
+	if ms.sorted == nil {
+		ms.sorted = ms.sortedFingerprints()
+	}
+	return append([]model.Fingerprint(nil), ms.sorted...)
+}
+
+// sortedFingerprints returns the sorted fingerprints, with each one repeated as many times as it has been added.
+func (ms *metricSeries) sortedFingerprints() []model.Fingerprint {
+	sorted := make([]model.Fingerprint, 0, len(ms.fps))
+	for fp, count := range ms.fps {
+		for i := 0; i < count; i++ {
+			sorted = append(sorted, fp)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// MetricNames returns the sorted metric names having at least one series and matching all the input matchers.
+// The matchers are expected to be on the metric name label.
+func (idx *SeriesMetadataIndex) MetricNames(matchers ...*labels.Matcher) []string {
+	var names []string
+
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.mtx.RLock()
+		for name := range shard.series {
+			if matchesAll(matchers, name) {
+				names = append(names, name)
+			}
+		}
+		shard.mtx.RUnlock()
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// MatchesNoSeries returns true if the input matchers are guaranteed to select no in-memory series because
+// no metric name in the index matches the metric name matchers. It's conservative: it returns false when
+// there are no metric name matchers or one of them matches series without the metric name label.
+func (idx *SeriesMetadataIndex) MatchesNoSeries(matchers []*labels.Matcher) bool {
+	var nameMatchers []*labels.Matcher
+	for _, m := range matchers {
+		if m.Name != labels.MetricName {
+			continue
+		}
+		if m.Matches("") {
+			return false
+		}
+		nameMatchers = append(nameMatchers, m)
+	}
+
+	if len(nameMatchers) == 0 {
+		return false
+	}
+
+	// Fast path for the common case of an equal matcher.
+	for _, m := range nameMatchers {
+		if m.Type == labels.MatchEqual {
+			shard := idx.getShard(m.Value)
+			shard.mtx.RLock()
+			_, ok := shard.series[m.Value]
+			shard.mtx.RUnlock()
+
+			return !ok || !matchesAll(nameMatchers, m.Value)
+		}
+	}
+
+	return len(idx.MetricNames(nameMatchers...)) == 0
+}
+
+// matchesAll returns true if the value matches all the input matchers.
+func matchesAll(matchers []*labels.Matcher, value string) bool {
+	for _, m := range matchers {
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyMetricNameMatchers returns true if all the input matchers are on the metric name label.
+func onlyMetricNameMatchers(matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if m.Name != labels.MetricName {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesMetadataIndex_AddAndDelete(t *testing.T) {
+	idx := NewSeriesMetadataIndex()
+
+	idx.Add("metric_a", 3)
+	idx.Add("metric_a", 1)
+	idx.Add("metric_a", 2)
+	idx.Add("metric_b", 1)
+
+	// Colliding fingerprints are tracked once per series.
+	idx.Add("metric_a", 2)
+
+	assert.Equal(t, []model.Fingerprint{1, 2, 2, 3}, idx.Fingerprints("metric_a"))
+	assert.Equal(t, []model.Fingerprint{1}, idx.Fingerprints("metric_b"))
+	assert.Nil(t, idx.Fingerprints("metric_c"))
+	assert.Equal(t, []string{"metric_a", "metric_b"}, idx.MetricNames())
+
+	idx.Delete("metric_a", 2)
+	assert.Equal(t, []model.Fingerprint{1, 2, 3}, idx.Fingerprints("metric_a"))
+
+	// Deleting a series which is not tracked is a no-op.
+	idx.Delete("metric_a", 4)
+	idx.Delete("metric_c", 1)
+	assert.Equal(t, []model.Fingerprint{1, 2, 3}, idx.Fingerprints("metric_a"))
+
+	idx.Delete("metric_b", 1)
+	assert.Nil(t, idx.Fingerprints("metric_b"))
+	assert.Equal(t, []string{"metric_a"}, idx.MetricNames())
+}
+
+func TestSeriesMetadataIndex_MetricNames(t *testing.T) {
+	idx := NewSeriesMetadataIndex()
+	idx.Add("up", 1)
+	idx.Add("http_requests_total", 2)
+	idx.Add("http_request_duration_seconds", 3)
+
+	assert.Equal(t, []string{"http_request_duration_seconds", "http_requests_total", "up"}, idx.MetricNames())
+	assert.Equal(t, []string{"http_request_duration_seconds", "http_requests_total"}, idx.MetricNames(
+		labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "http_.*"),
+	))
+	assert.Equal(t, []string{"http_requests_total"}, idx.MetricNames(
+		labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "http_.*"),
+		labels.MustNewMatcher(labels.MatchNotEqual, labels.MetricName, "http_request_duration_seconds"),
+	))
+	assert.Empty(t, idx.MetricNames(labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "unknown")))
+}
+
+func TestSeriesMetadataIndex_MatchesNoSeries(t *testing.T) {
+	idx := NewSeriesMetadataIndex()
+	idx.Add("up", 1)
+	idx.Add("http_requests_total", 2)
+
+	tests := map[string]struct {
+		matchers []*labels.Matcher
+		expected bool
+	}{
+		"no matchers": {
+			expected: false,
+		},
+		"no metric name matchers": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "unknown")},
+			expected: false,
+		},
+		"equal matcher on existing metric name": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up")},
+			expected: false,
+		},
+		"equal matcher on missing metric name": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "unknown"),
+				labels.MustNewMatcher(labels.MatchEqual, "job", "test"),
+			},
+			expected: true,
+		},
+		"equal matcher on existing metric name excluded by another matcher": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up"),
+				labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "http_.*"),
+			},
+			expected: true,
+		},
+		"regexp matcher on existing metric names": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "http_.*")},
+			expected: false,
+		},
+		"regexp matcher on missing metric names": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "grpc_.*")},
+			expected: true,
+		},
+		"matcher matching series without the metric name": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, labels.MetricName, "up")},
+			expected: false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, idx.MatchesNoSeries(testData.matchers))
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
@@ -60,6 +61,15 @@ type userTSDB struct {
 	seriesInMetric *metricCounter
 	limiter        *Limiter
 
+	// Detects rapid increases of the number of unique label name/value pairs. Nil if disabled.
+	cardinalityDetector *HighCardinalityDetector
+
+	// Maps the metric names to the fingerprints of the series in the head. Nil if disabled.
+	seriesMetadataIndex *SeriesMetadataIndex
+
+	// Predicts when the tenant will hit the series limit. Nil if disabled.
+	seriesGrowthPredictor *SeriesGrowthPredictor
+
 	instanceSeriesCount *atomic.Int64 // Shared across all userTSDB instances created by ingester.
 	instanceLimitsFn    func() *InstanceLimits
 
@@ -215,6 +225,14 @@ func (u *userTSDB) PostCreation(metric labels.Labels) {
 		return
 	}
 	u.seriesInMetric.increaseSeriesForMetric(metricName)
+
+	if u.seriesMetadataIndex != nil {
+		u.seriesMetadataIndex.Add(metricName, model.Fingerprint(metric.Hash()))
+	}
+
+	if u.cardinalityDetector != nil {
+		u.cardinalityDetector.SeriesCreated(time.Now(), metric)
+	}
 }
 
 // PostDeletion implements SeriesLifecycleCallback interface.
@@ -228,7 +246,37 @@ func (u *userTSDB) PostDeletion(metrics ...labels.Labels) {
 			continue
 		}
 		u.seriesInMetric.decreaseSeriesForMetric(metricName)
+
+		if u.seriesMetadataIndex != nil {
+			u.seriesMetadataIndex.Delete(metricName, model.Fingerprint(metric.Hash()))
+		}
+	}
+
+	if u.cardinalityDetector != nil {
+		u.cardinalityDetector.SeriesDeleted(metrics...)
+	}
+}
+
+// canUseSeriesMetadataIndex returns whether the series metadata index can be used to answer label
+// queries in the [mint, maxt] range. That's the case when the index is enabled and the range overlaps
+// the head but none of the local blocks, whose series are not tracked by the index.
+func (u *userTSDB) canUseSeriesMetadataIndex(mint, maxt int64) bool {
+	if u.seriesMetadataIndex == nil {
+		return false
+	}
+
+	h := u.Head()
+	if mint > h.MaxTime() || maxt < h.MinTime() {
+		return false
+	}
+
+	for _, b := range u.Blocks() {
+		// The block max time is exclusive.
+		if b.Meta().MaxTime > mint {
+			return false
+		}
 	}
+	return true
 }
 
 // blocksToDelete filters the input blocks and returns the blocks which are safe to be deleted from the ingester.
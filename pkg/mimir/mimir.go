@@ -48,6 +48,7 @@ import (
 	"github.com/grafana/mimir/pkg/flusher"
 	"github.com/grafana/mimir/pkg/frontend"
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+	"github.com/grafana/mimir/pkg/frontend/transport"
 	frontendv1 "github.com/grafana/mimir/pkg/frontend/v1"
 	"github.com/grafana/mimir/pkg/ingester"
 	"github.com/grafana/mimir/pkg/ingester/client"
@@ -221,6 +222,12 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.Querier.Validate(); err != nil {
 		return errors.Wrap(err, "invalid querier config")
 	}
+	if err := c.LimitsConfig.ActiveSeriesCustomTrackersConfig.Validate(); err != nil {
+		return errors.Wrap(err, "invalid limits config")
+	}
+	if err := c.Ingester.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ingester config")
+	}
 	if err := c.IngesterClient.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid ingester_client config")
 	}
@@ -622,30 +629,31 @@ type Mimir struct {
 	ServiceMap    map[string]services.Service
 	ModuleManager *modules.Manager
 
-	API                      *api.API
-	Server                   *server.Server
-	Ring                     *ring.Ring
-	TenantLimits             validation.TenantLimits
-	Overrides                *validation.Overrides
-	Distributor              *distributor.Distributor
-	Ingester                 *ingester.Ingester
-	Flusher                  *flusher.Flusher
-	Frontend                 *frontendv1.Frontend
-	RuntimeConfig            *runtimeconfig.Manager
-	QuerierQueryable         prom_storage.SampleAndChunkQueryable
-	ExemplarQueryable        prom_storage.ExemplarQueryable
-	MetadataSupplier         querier.MetadataSupplier
-	QuerierEngine            *promql.Engine
-	QueryFrontendTripperware querymiddleware.Tripperware
-	Ruler                    *ruler.Ruler
-	RulerStorage             rulestore.RuleStore
-	Alertmanager             *alertmanager.MultitenantAlertmanager
-	Compactor                *compactor.MultitenantCompactor
-	StoreGateway             *storegateway.StoreGateway
-	MemberlistKV             *memberlist.KVInitService
-	ActivityTracker          *activitytracker.ActivityTracker
-	UsageStatsReporter       *usagestats.Reporter
-	BuildInfoHandler         http.Handler
+	API                       *api.API
+	Server                    *server.Server
+	Ring                      *ring.Ring
+	TenantLimits              validation.TenantLimits
+	Overrides                 *validation.Overrides
+	Distributor               *distributor.Distributor
+	Ingester                  *ingester.Ingester
+	Flusher                   *flusher.Flusher
+	Frontend                  *frontendv1.Frontend
+	RuntimeConfig             *runtimeconfig.Manager
+	QuerierQueryable          prom_storage.SampleAndChunkQueryable
+	ExemplarQueryable         prom_storage.ExemplarQueryable
+	MetadataSupplier          querier.MetadataSupplier
+	QuerierEngine             *promql.Engine
+	QueryFrontendTripperware  querymiddleware.Tripperware
+	QueryFrontendBackpressure *transport.BackpressureSignaling
+	Ruler                     *ruler.Ruler
+	RulerStorage              rulestore.RuleStore
+	Alertmanager              *alertmanager.MultitenantAlertmanager
+	Compactor                 *compactor.MultitenantCompactor
+	StoreGateway              *storegateway.StoreGateway
+	MemberlistKV              *memberlist.KVInitService
+	ActivityTracker           *activitytracker.ActivityTracker
+	UsageStatsReporter        *usagestats.Reporter
+	BuildInfoHandler          http.Handler
 
 	// Queryables that the querier should use to query the long term storage.
 	StoreQueryables []querier.QueryableWithFilter
@@ -683,6 +691,12 @@ func New(cfg Config, reg prometheus.Registerer) (*Mimir, error) {
 	// Inject the registerer in the Server config too.
 	cfg.Server.Registerer = reg
 
+	// The bucket bandwidth limits apply to the whole process, so the limiters are shared by all the
+	// bucket clients created by the components with the same storage config.
+	cfg.BlocksStorage.Bucket.Throttle.InitLimiters()
+	cfg.AlertmanagerStorage.Config.Throttle.InitLimiters()
+	cfg.RulerStorage.Config.Throttle.InitLimiters()
+
 	mimir := &Mimir{
 		Cfg:        cfg,
 		Registerer: reg,
@@ -271,6 +271,15 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name: "should fail validation if a default active series custom tracker is invalid",
+			getTestConfig: func() *Config {
+				cfg := newDefaultConfig()
+				_ = cfg.LimitsConfig.ActiveSeriesCustomTrackersConfig.Set(`team_a:{team="a"`)
+				return cfg
+			},
+			expectAnyError: true,
+		},
 		{
 			name: "S3: should fail if bucket name is shared between alertmanager and blocks storage",
 			getTestConfig: func() *Config {
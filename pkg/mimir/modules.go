@@ -28,6 +28,7 @@ import (
 	"github.com/prometheus/prometheus/rules"
 	prom_storage "github.com/prometheus/prometheus/storage"
 	prom_remote "github.com/prometheus/prometheus/storage/remote"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
 	"github.com/weaveworks/common/server"
@@ -60,34 +61,35 @@ import (
 
 // The various modules that make up Mimir.
 const (
-	ActivityTracker          string = "activity-tracker"
-	API                      string = "api"
-	SanityCheck              string = "sanity-check"
-	Ring                     string = "ring"
-	RuntimeConfig            string = "runtime-config"
-	Overrides                string = "overrides"
-	OverridesExporter        string = "overrides-exporter"
-	Server                   string = "server"
-	Distributor              string = "distributor"
-	DistributorService       string = "distributor-service"
-	Ingester                 string = "ingester"
-	IngesterService          string = "ingester-service"
-	Flusher                  string = "flusher"
-	Querier                  string = "querier"
-	Queryable                string = "queryable"
-	StoreQueryable           string = "store-queryable"
-	QueryFrontend            string = "query-frontend"
-	QueryFrontendTripperware string = "query-frontend-tripperware"
-	RulerStorage             string = "ruler-storage"
-	Ruler                    string = "ruler"
-	AlertManager             string = "alertmanager"
-	Compactor                string = "compactor"
-	StoreGateway             string = "store-gateway"
-	MemberlistKV             string = "memberlist-kv"
-	QueryScheduler           string = "query-scheduler"
-	TenantFederation         string = "tenant-federation"
-	UsageStats               string = "usage-stats"
-	All                      string = "all"
+	ActivityTracker           string = "activity-tracker"
+	API                       string = "api"
+	SanityCheck               string = "sanity-check"
+	Ring                      string = "ring"
+	RuntimeConfig             string = "runtime-config"
+	Overrides                 string = "overrides"
+	OverridesExporter         string = "overrides-exporter"
+	Server                    string = "server"
+	Distributor               string = "distributor"
+	DistributorService        string = "distributor-service"
+	Ingester                  string = "ingester"
+	IngesterService           string = "ingester-service"
+	Flusher                   string = "flusher"
+	Querier                   string = "querier"
+	Queryable                 string = "queryable"
+	StoreQueryable            string = "store-queryable"
+	QueryFrontend             string = "query-frontend"
+	QueryFrontendTripperware  string = "query-frontend-tripperware"
+	QueryFrontendBackpressure string = "query-frontend-backpressure"
+	RulerStorage              string = "ruler-storage"
+	Ruler                     string = "ruler"
+	AlertManager              string = "alertmanager"
+	Compactor                 string = "compactor"
+	StoreGateway              string = "store-gateway"
+	MemberlistKV              string = "memberlist-kv"
+	QueryScheduler            string = "query-scheduler"
+	TenantFederation          string = "tenant-federation"
+	UsageStats                string = "usage-stats"
+	All                       string = "all"
 
 	// Write Read and Backend are the targets used when using the read-write deployment mode.
 	Write   string = "write"
@@ -174,6 +176,7 @@ func (t *Mimir) initSanityCheck() (services.Service, error) {
 func (t *Mimir) initServer() (services.Service, error) {
 	// Mimir handles signals on its own.
 	DisableSignalHandling(&t.Cfg.Server)
+
 	serv, err := server.New(t.Cfg.Server)
 	if err != nil {
 		return nil, err
@@ -271,6 +274,7 @@ func (t *Mimir) initOverridesExporter() (services.Service, error) {
 
 func (t *Mimir) initDistributorService() (serv services.Service, err error) {
 	t.Cfg.Distributor.DistributorRing.ListenPort = t.Cfg.Server.GRPCListenPort
+	t.Cfg.Distributor.HATrackerConfig.StateExport.Bucket = t.Cfg.BlocksStorage.Bucket
 
 	// Only enable shuffle sharding on the read path when `query-ingesters-within`
 	// is non-zero since otherwise we can't determine if an ingester should be part
@@ -383,6 +387,11 @@ func (t *Mimir) initQuerier() (serv services.Service, err error) {
 	t.Cfg.Worker.MaxConcurrentRequests = t.Cfg.Querier.EngineConfig.MaxConcurrent
 	t.Cfg.Worker.QuerySchedulerDiscovery = t.Cfg.QueryScheduler.ServiceDiscovery
 
+	var queryEngine v1.QueryEngine = t.QuerierEngine
+	if t.Cfg.Querier.InstantQueryDedupWindow > 0 {
+		queryEngine = querier.NewInstantQueryDeduplicator(queryEngine, t.Cfg.Querier.InstantQueryDedupWindow, t.Registerer)
+	}
+
 	// Create a internal HTTP handler that is configured with the Prometheus API routes and points
 	// to a Prometheus API struct instantiated with the Mimir Queryable.
 	internalQuerierRouter := api.NewQuerierHandler(
@@ -390,7 +399,7 @@ func (t *Mimir) initQuerier() (serv services.Service, err error) {
 		t.QuerierQueryable,
 		t.ExemplarQueryable,
 		t.MetadataSupplier,
-		t.QuerierEngine,
+		queryEngine,
 		t.Distributor,
 		t.Registerer,
 		util_log.Logger,
@@ -512,7 +521,7 @@ func (t *Mimir) initFlusher() (serv services.Service, err error) {
 func (t *Mimir) initQueryFrontendTripperware() (serv services.Service, err error) {
 	promqlEngineRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "query-frontend"}, t.Registerer)
 
-	tripperware, err := querymiddleware.NewTripperware(
+	tripperware, serv, err := querymiddleware.NewTripperware(
 		t.Cfg.Frontend.QueryMiddleware,
 		util_log.Logger,
 		t.Overrides,
@@ -526,7 +535,18 @@ func (t *Mimir) initQueryFrontendTripperware() (serv services.Service, err error
 	}
 
 	t.QueryFrontendTripperware = tripperware
-	return nil, nil
+	return serv, nil
+}
+
+// initQueryFrontendBackpressure instantiates the middleware signaling the query-frontend clients to back off
+// while the queriers are overloaded. The returned service periodically computes the p99 query response latency.
+func (t *Mimir) initQueryFrontendBackpressure() (serv services.Service, err error) {
+	if t.Cfg.Frontend.Handler.BackpressureLatencyThreshold <= 0 {
+		return nil, nil
+	}
+
+	t.QueryFrontendBackpressure = transport.NewBackpressureSignaling(t.Cfg.Frontend.Handler.BackpressureLatencyThreshold, t.Registerer)
+	return t.QueryFrontendBackpressure, nil
 }
 
 func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
@@ -541,6 +561,9 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 	roundTripper = t.QueryFrontendTripperware(roundTripper)
 
 	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer)
+	if t.QueryFrontendBackpressure != nil {
+		handler = t.QueryFrontendBackpressure.Wrap(handler)
+	}
 	t.API.RegisterQueryFrontendHandler(handler, t.BuildInfoHandler)
 
 	if frontendV1 != nil {
@@ -651,6 +674,19 @@ func (t *Mimir) initRuler() (serv services.Service, err error) {
 		return nil, err
 	}
 
+	var metricsExporter *ruler.RuleGroupMetricsExporter
+	if t.Cfg.Ruler.MetricsExport.Enabled {
+		bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.RulerStorage.Config, "ruler-metrics-export", util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, err
+		}
+
+		metricsExporter, err = ruler.NewRuleGroupMetricsExporter(t.Cfg.Ruler.MetricsExport, t.Cfg.Ruler.Ring.InstanceID, manager.RulesManagersMetrics(), bucketClient, util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	t.Ruler, err = ruler.NewRuler(
 		t.Cfg.Ruler,
 		manager,
@@ -658,6 +694,8 @@ func (t *Mimir) initRuler() (serv services.Service, err error) {
 		util_log.Logger,
 		t.RulerStorage,
 		t.Overrides,
+		metricsExporter,
+		queryFunc,
 	)
 	if err != nil {
 		return
@@ -675,6 +713,7 @@ func (t *Mimir) initRuler() (serv services.Service, err error) {
 func (t *Mimir) initAlertManager() (serv services.Service, err error) {
 	t.Cfg.Alertmanager.ShardingRing.ListenPort = t.Cfg.Server.GRPCListenPort
 	t.Cfg.Alertmanager.CheckExternalURL(t.Cfg.API.AlertmanagerHTTPPrefix, util_log.Logger)
+	t.Cfg.AlertmanagerStorage.Local.ValidateConfig = alertmanager.ValidateConfig
 
 	store, err := alertstore.NewAlertStore(context.Background(), t.Cfg.AlertmanagerStorage, t.Overrides, util_log.Logger, t.Registerer)
 	if err != nil {
@@ -804,6 +843,7 @@ func (t *Mimir) setupModuleManager() error {
 	mm.RegisterModule(Querier, t.initQuerier)
 	mm.RegisterModule(StoreQueryable, t.initStoreQueryables, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontendTripperware, t.initQueryFrontendTripperware, modules.UserInvisibleModule)
+	mm.RegisterModule(QueryFrontendBackpressure, t.initQueryFrontendBackpressure, modules.UserInvisibleModule)
 	mm.RegisterModule(QueryFrontend, t.initQueryFrontend)
 	mm.RegisterModule(RulerStorage, t.initRulerStorage, modules.UserInvisibleModule)
 	mm.RegisterModule(Ruler, t.initRuler)
@@ -836,7 +876,7 @@ func (t *Mimir) setupModuleManager() error {
 		Querier:                  {TenantFederation},
 		StoreQueryable:           {Overrides, MemberlistKV},
 		QueryFrontendTripperware: {API, Overrides},
-		QueryFrontend:            {QueryFrontendTripperware, MemberlistKV},
+		QueryFrontend:            {QueryFrontendTripperware, QueryFrontendBackpressure, MemberlistKV},
 		QueryScheduler:           {API, Overrides, MemberlistKV},
 		Ruler:                    {DistributorService, StoreQueryable, RulerStorage},
 		RulerStorage:             {Overrides},
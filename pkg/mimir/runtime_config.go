@@ -7,6 +7,7 @@ package mimir
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
@@ -79,6 +80,15 @@ func loadRuntimeConfig(r io.Reader) (interface{}, error) {
 		return nil, errMultipleDocuments
 	}
 
+	for userID, limits := range overrides.TenantLimits {
+		if limits == nil {
+			continue
+		}
+		if err := limits.ActiveSeriesCustomTrackersConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid overrides of tenant %s: %w", userID, err)
+		}
+	}
+
 	return overrides, nil
 }
 
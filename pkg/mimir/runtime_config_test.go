@@ -113,3 +113,18 @@ overrides:
 		assert.Nil(t, actual)
 	}
 }
+
+func TestLoadRuntimeConfig_ShouldReturnErrorOnInvalidActiveSeriesCustomTrackers(t *testing.T) {
+	validation.SetDefaultLimitsForYAMLUnmarshalling(validation.Limits{})
+
+	yamlFile := strings.NewReader(`
+overrides:
+  '1234':
+    active_series_custom_trackers:
+      team_a: '{team="a"}'
+      team_b: '{team="b"'
+`)
+	actual, err := loadRuntimeConfig(yamlFile)
+	assert.ErrorContains(t, err, `invalid overrides of tenant 1234: invalid matcher "{team=\"b\"" of active series custom tracker team_b`)
+	assert.Nil(t, actual)
+}
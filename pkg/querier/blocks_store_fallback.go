@@ -0,0 +1,384 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/sharding"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+// blocksStoreFallback queries blocks directly from the object storage when they can't be queried from any
+// store-gateway (e.g. during a store-gateways outage). Only the index of each block is downloaded to the local
+// disk, while the chunks are fetched with range reads when the series are iterated, so this is significantly
+// slower than querying the store-gateways. The number of bytes read from the object storage by each query is
+// limited.
+type blocksStoreFallback struct {
+	bkt              objstore.Bucket
+	cfgProvider      bucket.TenantConfigProvider
+	dir              string
+	maxBytesPerQuery int64
+	logger           log.Logger
+
+	queriedBlocks prometheus.Counter
+	failures      prometheus.Counter
+}
+
+func newBlocksStoreFallback(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, dir string, maxBytesPerQuery uint64, logger log.Logger, reg prometheus.Registerer) *blocksStoreFallback {
+	return &blocksStoreFallback{
+		bkt:              bkt,
+		cfgProvider:      cfgProvider,
+		dir:              dir,
+		maxBytesPerQuery: int64(maxBytesPerQuery),
+		logger:           logger,
+		queriedBlocks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_blocks_fallback_queried_total",
+			Help: "Number of blocks queried directly from the object storage because they couldn't be queried from any store-gateway.",
+		}),
+		failures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_blocks_fallback_failures_total",
+			Help: "Number of times querying blocks directly from the object storage failed.",
+		}),
+	}
+}
+
+// Querier downloads the index of the input blocks of the tenant from the object storage and returns a
+// FallbackQuerier on them. The returned querier must be closed to release the downloaded indexes. The bytes
+// read from the object storage are added to readBytes, which is shared by all the calls done for the same
+// query, and the reads fail once it exceeds the max bytes per query.
+func (f *blocksStoreFallback) Querier(ctx context.Context, userID string, blockIDs []ulid.ULID, minT, maxT int64, readBytes *atomic.Int64) (*FallbackQuerier, error) {
+	q, err := f.openQuerier(ctx, userID, blockIDs, minT, maxT, readBytes)
+	if err != nil {
+		f.failures.Inc()
+		return nil, err
+	}
+
+	f.queriedBlocks.Add(float64(len(blockIDs)))
+	return q, nil
+}
+
+func (f *blocksStoreFallback) openQuerier(ctx context.Context, userID string, blockIDs []ulid.ULID, minT, maxT int64, readBytes *atomic.Int64) (_ *FallbackQuerier, returnErr error) {
+	if err := os.MkdirAll(f.dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "failed to create fallback blocks directory")
+	}
+
+	dir, err := os.MkdirTemp(f.dir, userID+"-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create fallback query directory")
+	}
+
+	q := &FallbackQuerier{dir: dir, logger: f.logger}
+	defer func() {
+		if returnErr != nil {
+			if err := q.Close(); err != nil {
+				level.Warn(f.logger).Log("msg", "failed to release blocks queried from the object storage", "user", userID, "err", err)
+			}
+		}
+	}()
+
+	var userBkt objstore.Bucket = bucket.NewUserBucketClient(userID, f.bkt, f.cfgProvider)
+	if f.maxBytesPerQuery > 0 {
+		userBkt = &readLimitBucket{Bucket: userBkt, read: readBytes, maxBytes: f.maxBytesPerQuery}
+	}
+	queriers := make([]storage.Querier, 0, len(blockIDs))
+
+	for _, blockID := range blockIDs {
+		b, err := openFallbackBlock(ctx, f.logger, userBkt, blockID, filepath.Join(dir, blockID.String()))
+		if err != nil {
+			return nil, err
+		}
+		q.blocks = append(q.blocks, b)
+
+		bq, err := tsdb.NewBlockQuerier(b, minT, maxT)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to query block %s", blockID)
+		}
+		queriers = append(queriers, bq)
+	}
+
+	q.querier = storage.NewMergeQuerier(queriers, nil, storage.ChainedSeriesMerge)
+	return q, nil
+}
+
+// FallbackQuerier is a storage.Querier on blocks read from the object storage.
+type FallbackQuerier struct {
+	dir     string
+	blocks  []*fallbackBlock
+	querier storage.Querier
+	logger  log.Logger
+}
+
+// Select implements storage.Querier. Differently from the store-gateway, series are filtered by
+// the query shard in the querier.
+func (q *FallbackQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	shard, matchers, err := sharding.RemoveShardFromMatchers(matchers)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	set := q.querier.Select(sortSeries, hints, matchers...)
+	if shard == nil {
+		return set
+	}
+
+	return &shardFilteredSeriesSet{SeriesSet: set, shard: shard}
+}
+
+// LabelValues implements storage.Querier.
+func (q *FallbackQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return q.querier.LabelValues(name, matchers...)
+}
+
+// LabelNames implements storage.Querier.
+func (q *FallbackQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return q.querier.LabelNames(matchers...)
+}
+
+// Close releases the blocks and removes their index from the local disk.
+func (q *FallbackQuerier) Close() error {
+	errs := tsdb_errors.NewMulti()
+	if q.querier != nil {
+		errs.Add(q.querier.Close())
+	}
+	for _, b := range q.blocks {
+		errs.Add(b.Close())
+	}
+	errs.Add(os.RemoveAll(q.dir))
+	return errs.Err()
+}
+
+// shardFilteredSeriesSet only returns the series belonging to the shard.
+type shardFilteredSeriesSet struct {
+	storage.SeriesSet
+
+	shard *sharding.ShardSelector
+}
+
+func (s *shardFilteredSeriesSet) Next() bool {
+	for s.SeriesSet.Next() {
+		if s.SeriesSet.At().Labels().Hash()%s.shard.ShardCount == s.shard.ShardIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackBlock is a tsdb.BlockReader on a block in the object storage. The index is downloaded to the
+// local disk, while the chunks are read from the object storage with a range read each.
+type fallbackBlock struct {
+	meta   tsdb.BlockMeta
+	index  *index.Reader
+	chunks *fallbackChunkReader
+}
+
+// openFallbackBlock downloads the meta.json and index of the input block to dir, and opens the block.
+func openFallbackBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blockID ulid.ULID, dir string) (*fallbackBlock, error) {
+	meta, err := block.DownloadMeta(ctx, logger, bkt, blockID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download meta.json of block %s from the object storage", blockID)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory of block %s", blockID)
+	}
+	indexPath := filepath.Join(dir, block.IndexFilename)
+	if err := objstore.DownloadFile(ctx, logger, bkt, path.Join(blockID.String(), block.IndexFilename), indexPath); err != nil {
+		return nil, errors.Wrapf(err, "failed to download index of block %s from the object storage", blockID)
+	}
+
+	segmentFiles := make([]string, 0, len(meta.Thanos.SegmentFiles))
+	for _, sf := range meta.Thanos.SegmentFiles {
+		segmentFiles = append(segmentFiles, path.Join(blockID.String(), block.ChunksDirname, sf))
+	}
+	if len(segmentFiles) == 0 {
+		// The segment files are not listed in the meta.json of the blocks uploaded by old versions.
+		if err := bkt.Iter(ctx, path.Join(blockID.String(), block.ChunksDirname), func(name string) error {
+			segmentFiles = append(segmentFiles, name)
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to list the chunks of block %s", blockID)
+		}
+	}
+
+	indexReader, err := index.NewFileReader(indexPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open index of block %s", blockID)
+	}
+
+	return &fallbackBlock{
+		meta:   meta.BlockMeta,
+		index:  indexReader,
+		chunks: &fallbackChunkReader{ctx: ctx, bkt: bkt, segmentFiles: segmentFiles, pool: chunkenc.NewPool()},
+	}, nil
+}
+
+// Index implements tsdb.BlockReader.
+func (b *fallbackBlock) Index() (tsdb.IndexReader, error) {
+	return fallbackIndexReader{b.index}, nil
+}
+
+// Chunks implements tsdb.BlockReader.
+func (b *fallbackBlock) Chunks() (tsdb.ChunkReader, error) {
+	return b.chunks, nil
+}
+
+// Tombstones implements tsdb.BlockReader. Blocks in the object storage have no tombstones.
+func (b *fallbackBlock) Tombstones() (tombstones.Reader, error) {
+	return tombstones.NewMemTombstones(), nil
+}
+
+// Meta implements tsdb.BlockReader.
+func (b *fallbackBlock) Meta() tsdb.BlockMeta {
+	return b.meta
+}
+
+// Size implements tsdb.BlockReader, returning the size of the block on the local disk.
+func (b *fallbackBlock) Size() int64 {
+	return int64(b.index.Size())
+}
+
+func (b *fallbackBlock) Close() error {
+	return b.index.Close()
+}
+
+// fallbackIndexReader adapts an index.Reader to be a tsdb.IndexReader. It's not closed by the block queriers,
+// because the index.Reader is owned by the fallbackBlock.
+type fallbackIndexReader struct {
+	*index.Reader
+}
+
+// PostingsForMatchers implements tsdb.IndexReader.
+func (r fallbackIndexReader) PostingsForMatchers(_ bool, ms ...*labels.Matcher) (index.Postings, error) {
+	return tsdb.PostingsForMatchers(r.Reader, ms...)
+}
+
+// Close implements tsdb.IndexReader.
+func (r fallbackIndexReader) Close() error {
+	return nil
+}
+
+// fallbackChunkReader is a tsdb.ChunkReader reading each chunk from the object storage with a range read.
+type fallbackChunkReader struct {
+	ctx          context.Context
+	bkt          objstore.BucketReader
+	segmentFiles []string
+	pool         chunkenc.Pool
+}
+
+// Chunk implements tsdb.ChunkReader. The chunk length is not known before reading it, so the estimated
+// max chunk size is read first, and the rest of the chunk is read with a second request if it's larger.
+func (r *fallbackChunkReader) Chunk(meta chunks.Meta) (chunkenc.Chunk, error) {
+	seq, off := chunks.BlockChunkRef(meta.Ref).Unpack()
+	if seq < 0 || seq >= len(r.segmentFiles) {
+		return nil, errors.Errorf("unknown segment file for index %d", seq)
+	}
+
+	buf, err := r.readRange(r.segmentFiles[seq], int64(off), mimir_tsdb.EstimatedMaxChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkDataLen, n := binary.Uvarint(buf)
+	if n < 1 {
+		return nil, errors.Errorf("reading chunk length from segment file %s failed", r.segmentFiles[seq])
+	}
+
+	// The chunk is made of the chunk data length, the encoding and the chunk data. The CRC32 is ignored.
+	chunkLen := n + chunks.ChunkEncodingSize + int(chunkDataLen)
+	if chunkLen > len(buf) {
+		if buf, err = r.readRange(r.segmentFiles[seq], int64(off), int64(chunkLen)); err != nil {
+			return nil, err
+		}
+		if chunkLen > len(buf) {
+			return nil, errors.Errorf("segment file %s doesn't include enough bytes to read the chunk at offset %d", r.segmentFiles[seq], off)
+		}
+	}
+
+	return r.pool.Get(chunkenc.Encoding(buf[n]), buf[n+chunks.ChunkEncodingSize:chunkLen])
+}
+
+// readRange reads up to length bytes from the input offset of the object.
+func (r *fallbackChunkReader) readRange(name string, off, length int64) ([]byte, error) {
+	rc, err := r.bkt.GetRange(r.ctx, name, off, length)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read range of segment file %s", name)
+	}
+
+	buf, err := io.ReadAll(rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read range of segment file %s", name)
+	}
+	return buf, nil
+}
+
+// Close implements tsdb.ChunkReader.
+func (r *fallbackChunkReader) Close() error {
+	return nil
+}
+
+// readLimitBucket is an objstore.Bucket failing the reads of the objects once the total number of bytes
+// read exceeds a limit.
+type readLimitBucket struct {
+	objstore.Bucket
+
+	read     *atomic.Int64
+	maxBytes int64
+}
+
+func (b *readLimitBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &readLimitReader{ReadCloser: rc, bucket: b}, nil
+}
+
+func (b *readLimitBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return &readLimitReader{ReadCloser: rc, bucket: b}, nil
+}
+
+type readLimitReader struct {
+	io.ReadCloser
+	bucket *readLimitBucket
+}
+
+func (r *readLimitReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.bucket.read.Add(int64(n)) > r.bucket.maxBytes {
+		return n, fmt.Errorf("the blocks queried from the object storage exceed the limit of %d bytes per query (-querier.fallback-to-object-storage-max-bytes-per-query)", r.bucket.maxBytes)
+	}
+	return n, err
+}
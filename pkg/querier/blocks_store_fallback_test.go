@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/sharding"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+)
+
+func TestBlocksStoreQuerier_ShouldFallbackToObjectStorageIfStoreGatewaysAreUnavailable(t *testing.T) {
+	const userID = "user-1"
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	series1 := labels.FromStrings(labels.MetricName, "test", "series", "1")
+	series2 := labels.FromStrings(labels.MetricName, "test", "series", "2")
+	blockID := uploadTestBlock(t, bkt, userID, map[string]labels.Labels{"1": series1, "2": series2}, 10, 20)
+
+	newQuerier := func(reg prometheus.Registerer, fallbackDir string, maxBytesPerQuery uint64) *blocksStoreQuerier {
+		finder := &blocksFinderMock{}
+		finder.On("GetBlocks", mock.Anything, userID, mock.Anything, mock.Anything).Return(bucketindex.Blocks{{ID: blockID, MinTime: 10, MaxTime: 21}}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+		return &blocksStoreQuerier{
+			ctx:         ctx,
+			minT:        0,
+			maxT:        100,
+			userID:      userID,
+			finder:      finder,
+			stores:      &blocksStoreSetMock{mockedResponses: []interface{}{errors.New("no store-gateway available")}},
+			consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+			logger:      log.NewNopLogger(),
+			metrics:     newBlocksStoreQueryableMetrics(nil),
+			limits:      &blocksStoreLimitsMock{},
+			fallback:    newBlocksStoreFallback(bkt, nil, fallbackDir, maxBytesPerQuery, log.NewNopLogger(), reg),
+		}
+	}
+
+	t.Run("Select", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		fallbackDir := t.TempDir()
+		q := newQuerier(reg, fallbackDir, 0)
+
+		set := q.Select(true, &storage.SelectHints{Start: 0, End: 100}, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test"))
+
+		var actual []labels.Labels
+		for set.Next() {
+			actual = append(actual, set.At().Labels())
+
+			samples := 0
+			it := set.At().Iterator()
+			for it.Next() {
+				samples++
+			}
+			require.NoError(t, it.Err())
+			assert.Equal(t, 10, samples)
+		}
+		require.NoError(t, set.Err())
+		assert.Equal(t, []labels.Labels{series1, series2}, actual)
+		assert.Equal(t, float64(1), testutil.ToFloat64(q.fallback.queriedBlocks))
+
+		// Only the index should have been downloaded, while the chunks are read with range reads.
+		downloaded, err := filepath.Glob(filepath.Join(fallbackDir, "*", blockID.String(), "*"))
+		require.NoError(t, err)
+		require.Len(t, downloaded, 1)
+		assert.Equal(t, block.IndexFilename, filepath.Base(downloaded[0]))
+
+		// Closing the querier should remove the downloaded indexes.
+		require.NoError(t, q.Close())
+		entries, err := os.ReadDir(fallbackDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Select with query sharding", func(t *testing.T) {
+		q := newQuerier(nil, t.TempDir(), 0)
+		t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+		shard := sharding.ShardSelector{ShardIndex: series1.Hash() % 2, ShardCount: 2}
+		set := q.Select(true, &storage.SelectHints{Start: 0, End: 100}, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test"), shard.Matcher())
+
+		var actual []labels.Labels
+		for set.Next() {
+			actual = append(actual, set.At().Labels())
+		}
+		require.NoError(t, set.Err())
+		assert.Contains(t, actual, series1)
+		for _, lbls := range actual {
+			assert.Equal(t, shard.ShardIndex, lbls.Hash()%2)
+		}
+	})
+
+	t.Run("LabelNames", func(t *testing.T) {
+		q := newQuerier(nil, t.TempDir(), 0)
+		t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+		names, _, err := q.LabelNames()
+		require.NoError(t, err)
+		assert.Equal(t, []string{labels.MetricName, "series"}, names)
+	})
+
+	t.Run("LabelValues", func(t *testing.T) {
+		q := newQuerier(nil, t.TempDir(), 0)
+		t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+		values, _, err := q.LabelValues("series")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, values)
+	})
+
+	t.Run("should fail if the block can't be downloaded from the object storage", func(t *testing.T) {
+		q := newQuerier(nil, t.TempDir(), 0)
+		q.userID = "user-2"
+		q.finder.(*blocksFinderMock).On("GetBlocks", mock.Anything, "user-2", mock.Anything, mock.Anything).Return(bucketindex.Blocks{{ID: blockID, MinTime: 10, MaxTime: 21}}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+		_, _, err := q.LabelNames()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to query blocks from the object storage")
+		assert.Equal(t, float64(1), testutil.ToFloat64(q.fallback.failures))
+	})
+
+	t.Run("should fail if the blocks exceed the max bytes per query", func(t *testing.T) {
+		fallbackDir := t.TempDir()
+		q := newQuerier(nil, fallbackDir, 100)
+
+		_, _, err := q.LabelNames()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceed the limit of 100 bytes per query")
+		assert.Equal(t, float64(1), testutil.ToFloat64(q.fallback.failures))
+
+		// The partially downloaded block should be removed.
+		require.NoError(t, q.Close())
+		entries, err := os.ReadDir(fallbackDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestBlocksStoreQuerier_ShouldFallbackToObjectStorageIfStoreGatewaysFail(t *testing.T) {
+	const userID = "user-1"
+
+	bkt := objstore.NewInMemBucket()
+	blockID := uploadTestBlock(t, bkt, userID, map[string]labels.Labels{"1": labels.FromStrings(labels.MetricName, "test")}, 10, 20)
+
+	tests := map[string]struct {
+		storeGateway *storeGatewayClientMock
+	}{
+		"should fallback if blocks are missing after all retries": {
+			// The store-gateway doesn't query the block, and there's no other store-gateway to retry.
+			storeGateway: &storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedLabelNamesResponse: &storepb.LabelNamesResponse{Hints: mockNamesHints()}},
+		},
+		"should fallback if the store-gateway fails on all retries": {
+			storeGateway: &storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedLabelNamesErr: errors.New("store-gateway failed")},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			finder := &blocksFinderMock{}
+			finder.On("GetBlocks", mock.Anything, userID, mock.Anything, mock.Anything).Return(bucketindex.Blocks{{ID: blockID, MinTime: 10, MaxTime: 21}}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+			q := &blocksStoreQuerier{
+				ctx:    context.Background(),
+				minT:   0,
+				maxT:   100,
+				userID: userID,
+				finder: finder,
+				stores: &blocksStoreSetMock{mockedResponses: []interface{}{
+					map[BlocksStoreClient][]ulid.ULID{testData.storeGateway: {blockID}},
+					errors.New("no store-gateway left"),
+				}},
+				consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+				logger:      log.NewNopLogger(),
+				metrics:     newBlocksStoreQueryableMetrics(nil),
+				limits:      &blocksStoreLimitsMock{},
+				fallback:    newBlocksStoreFallback(bkt, nil, t.TempDir(), 0, log.NewNopLogger(), nil),
+			}
+			t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+			names, _, err := q.LabelNames()
+			require.NoError(t, err)
+			assert.Equal(t, []string{labels.MetricName}, names)
+			assert.Equal(t, float64(1), testutil.ToFloat64(q.fallback.queriedBlocks))
+		})
+	}
+}
+
+func TestBlocksStoreQuerier_ShouldNotFallbackToObjectStorageIfDisabled(t *testing.T) {
+	finder := &blocksFinderMock{}
+	finder.On("GetBlocks", mock.Anything, "user-1", mock.Anything, mock.Anything).Return(bucketindex.Blocks{{ID: ulid.MustNew(1, nil)}}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+	q := &blocksStoreQuerier{
+		ctx:         context.Background(),
+		minT:        0,
+		maxT:        100,
+		userID:      "user-1",
+		finder:      finder,
+		stores:      &blocksStoreSetMock{mockedResponses: []interface{}{errors.New("no store-gateway available")}},
+		consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+		logger:      log.NewNopLogger(),
+		metrics:     newBlocksStoreQueryableMetrics(nil),
+		limits:      &blocksStoreLimitsMock{},
+	}
+
+	_, _, err := q.LabelNames()
+	require.EqualError(t, err, "no store-gateway available")
+}
+
+// uploadTestBlock creates a block with the input series, each with one sample for each timestamp
+// in the range [minT, maxT), and uploads it to the tenant's bucket.
+func uploadTestBlock(t *testing.T, bkt objstore.Bucket, userID string, series map[string]labels.Labels, minT, maxT int64) ulid.ULID {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	w, err := tsdb.NewBlockWriter(log.NewNopLogger(), dir, 2*(maxT-minT))
+	require.NoError(t, err)
+
+	app := w.Appender(ctx)
+	for _, lbls := range series {
+		for ts := minT; ts < maxT; ts++ {
+			_, err := app.Append(0, lbls, ts, float64(ts))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, app.Commit())
+
+	blockID, err := w.Flush(ctx)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+	require.NoError(t, block.UploadPromBlock(ctx, log.NewNopLogger(), userBkt, filepath.Join(dir, blockID.String()), metadata.NoneFunc))
+
+	return blockID
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -28,6 +29,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/extprom"
@@ -61,6 +63,10 @@ const (
 	// store-gateways. If no more store-gateways are left (ie. due to lower replication
 	// factor) than we'll end the retries earlier.
 	maxFetchSeriesAttempts = 3
+
+	// blocksStoreFallbackDir is the directory, within the bucket store sync directory, where the blocks
+	// queried directly from the object storage are downloaded to.
+	blocksStoreFallbackDir = "querier-fallback"
 )
 
 var (
@@ -77,7 +83,7 @@ type BlocksStoreSet interface {
 	// GetClientsFor returns the store gateway clients that should be used to
 	// query the set of blocks in input. The exclude parameter is the map of
 	// blocks -> store-gateway addresses that should be excluded.
-	GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error)
+	GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string, shard *sharding.ShardSelector) (map[BlocksStoreClient][]ulid.ULID, error)
 }
 
 // BlocksFinder is the interface used to find blocks for a given user and time range.
@@ -160,6 +166,10 @@ type BlocksStoreQueryable struct {
 	metrics         *blocksStoreQueryableMetrics
 	limits          BlocksStoreLimits
 
+	// Queries the blocks which can't be queried from any store-gateway directly
+	// from the object storage. Nil if disabled.
+	fallback *blocksStoreFallback
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -207,6 +217,11 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		return nil, errors.Wrap(err, "failed to create bucket client")
 	}
 
+	var fallback *blocksStoreFallback
+	if querierCfg.FallbackToObjectStorage {
+		fallback = newBlocksStoreFallback(bucketClient, limits, filepath.Join(storageCfg.BucketStore.SyncDir, blocksStoreFallbackDir), querierCfg.FallbackToObjectStorageMaxBytesPerQuery, logger, reg)
+	}
+
 	// Blocks finder doesn't use chunks, but we pass config for consistency.
 	cachingBucket, err := mimir_tsdb.CreateCachingBucket(storageCfg.BucketStore.ChunksCache, storageCfg.BucketStore.MetadataCache, bucketClient, logger, extprom.WrapRegistererWith(prometheus.Labels{"component": "querier"}, reg))
 	if err != nil {
@@ -270,7 +285,13 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		reg,
 	)
 
-	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, logger, reg)
+	q, err := NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, logger, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	q.fallback = fallback
+	return q, nil
 }
 
 func (q *BlocksStoreQueryable) starting(ctx context.Context) error {
@@ -321,6 +342,7 @@ func (q *BlocksStoreQueryable) Querier(ctx context.Context, mint, maxt int64) (s
 		consistency:     q.consistency,
 		logger:          q.logger,
 		queryStoreAfter: q.queryStoreAfter,
+		fallback:        q.fallback,
 	}, nil
 }
 
@@ -338,6 +360,16 @@ type blocksStoreQuerier struct {
 	// If set, the querier manipulates the max time to not be greater than
 	// "now - queryStoreAfter" so that most recent blocks are not queried.
 	queryStoreAfter time.Duration
+
+	// Queries the blocks which can't be queried from any store-gateway. Nil if disabled.
+	fallback *blocksStoreFallback
+
+	// The queriers opened by the fallback, released when this querier is closed.
+	fallbackQueriersMx sync.Mutex
+	fallbackQueriers   []*FallbackQuerier
+
+	// The bytes read from the object storage by the fallback for this querier.
+	fallbackReadBytes atomic.Int64
 }
 
 // Select implements storage.Querier interface.
@@ -380,7 +412,19 @@ func (q *blocksStoreQuerier) LabelNames(matchers ...*labels.Matcher) ([]string,
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	fallbackFunc := func(fq storage.Querier) error {
+		names, warnings, err := fq.LabelNames(matchers...)
+		if err != nil {
+			return err
+		}
+
+		resNameSets = append(resNameSets, names)
+		resWarnings = append(resWarnings, warnings...)
+
+		return nil
+	}
+
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc, fallbackFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -421,7 +465,19 @@ func (q *blocksStoreQuerier) LabelValues(name string, matchers ...*labels.Matche
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc)
+	fallbackFunc := func(fq storage.Querier) error {
+		values, warnings, err := fq.LabelValues(name, matchers...)
+		if err != nil {
+			return err
+		}
+
+		resValueSets = append(resValueSets, values)
+		resWarnings = append(resWarnings, warnings...)
+
+		return nil
+	}
+
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, nil, queryFunc, fallbackFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -430,7 +486,16 @@ func (q *blocksStoreQuerier) LabelValues(name string, matchers ...*labels.Matche
 }
 
 func (q *blocksStoreQuerier) Close() error {
-	return nil
+	q.fallbackQueriersMx.Lock()
+	defer q.fallbackQueriersMx.Unlock()
+
+	errs := tsdb_errors.NewMulti()
+	for _, fq := range q.fallbackQueriers {
+		errs.Add(fq.Close())
+	}
+	q.fallbackQueriers = nil
+
+	return errs.Err()
 }
 
 func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
@@ -471,7 +536,13 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		return queriedBlocks, nil
 	}
 
-	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, shard, queryFunc)
+	fallbackFunc := func(fq storage.Querier) error {
+		// The series set is lazily iterated, so the fallback querier is kept open until this querier is closed.
+		resSeriesSets = append(resSeriesSets, fq.Select(true, sp, matchers...))
+		return nil
+	}
+
+	err = q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, shard, queryFunc, fallbackFunc)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
@@ -486,7 +557,8 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 }
 
 func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64, shard *sharding.ShardSelector,
-	queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error)) error {
+	queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error),
+	fallbackFunc func(fq storage.Querier) error) error {
 	// If queryStoreAfter is enabled, we do manipulate the query maxt to query samples up until
 	// now - queryStoreAfter, because the most recent time range is covered by ingesters. This
 	// optimization is particularly important for the blocks storage because can be used to skip
@@ -548,7 +620,7 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 	for attempt := 1; attempt <= maxFetchSeriesAttempts; attempt++ {
 		// Find the set of store-gateway instances having the blocks. The exclude parameter is the
 		// map of blocks queried so far, with the list of store-gateway addresses for each block.
-		clients, err := q.stores.GetClientsFor(q.userID, remainingBlocks, attemptedBlocks)
+		clients, err := q.stores.GetClientsFor(q.userID, remainingBlocks, attemptedBlocks, shard)
 		if err != nil {
 			// If it's a retry and we get an error, it means there are no more store-gateways left
 			// from which running another attempt, so we're just stopping retrying.
@@ -557,6 +629,12 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 				break
 			}
 
+			// No store-gateway is available to query the blocks.
+			if q.fallback != nil {
+				level.Warn(logger).Log("msg", "unable to get store-gateway clients, querying blocks from the object storage", "err", err)
+				return q.queryFallback(ctx, remainingBlocks, minT, maxT, fallbackFunc)
+			}
+
 			return err
 		}
 		level.Debug(logger).Log("msg", "found store-gateway instances to query", "num instances", len(clients), "attempt", attempt)
@@ -595,11 +673,31 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 		remainingBlocks = missingBlocks
 	}
 
-	// We've not been able to query all expected blocks after all retries.
+	// We've not been able to query all expected blocks after all retries, because some store-gateways
+	// failed or didn't query some blocks.
+	if q.fallback != nil {
+		level.Warn(util_log.WithContext(ctx, logger)).Log("msg", "failed consistency check, querying the non-queried blocks from the object storage", "blocks", strings.Join(convertULIDsToString(remainingBlocks), " "))
+		return q.queryFallback(ctx, remainingBlocks, minT, maxT, fallbackFunc)
+	}
+
 	level.Warn(util_log.WithContext(ctx, logger)).Log("msg", "failed consistency check", "err", err)
 	return newStoreConsistencyCheckFailedError(remainingBlocks)
 }
 
+// queryFallback queries the input blocks directly from the object storage, passing the querier to fallbackFunc.
+func (q *blocksStoreQuerier) queryFallback(ctx context.Context, blockIDs []ulid.ULID, minT, maxT int64, fallbackFunc func(fq storage.Querier) error) error {
+	fq, err := q.fallback.Querier(ctx, q.userID, blockIDs, minT, maxT, &q.fallbackReadBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to query blocks from the object storage")
+	}
+
+	q.fallbackQueriersMx.Lock()
+	q.fallbackQueriers = append(q.fallbackQueriers, fq)
+	q.fallbackQueriersMx.Unlock()
+
+	return fallbackFunc(fq)
+}
+
 func newStoreConsistencyCheckFailedError(remainingBlocks []ulid.ULID) error {
 	return fmt.Errorf("%v. The non-queried blocks are: %s", globalerror.StoreConsistencyCheckFailed.Message("the consistency check failed because some blocks were not queried"), strings.Join(convertULIDsToString(remainingBlocks), " "))
 }
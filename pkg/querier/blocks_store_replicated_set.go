@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sort"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/dskit/ring"
@@ -18,6 +19,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storegateway"
 	"github.com/grafana/mimir/pkg/util"
@@ -38,6 +40,7 @@ type blocksStoreReplicationSet struct {
 	storesRing        *ring.Ring
 	clientsPool       *client.Pool
 	balancingStrategy loadBalancingStrategy
+	shardingRouter    *QueryShardingRouter
 	limits            BlocksStoreLimits
 
 	// Subservices manager.
@@ -61,6 +64,10 @@ func newBlocksStoreReplicationSet(
 		subservicesWatcher: services.NewFailureWatcher(),
 	}
 
+	if clientConfig.QueryShardingRoutingEnabled {
+		s.shardingRouter = &QueryShardingRouter{}
+	}
+
 	var err error
 	s.subservices, err = services.NewManager(s.storesRing, s.clientsPool)
 	if err != nil {
@@ -97,7 +104,7 @@ func (s *blocksStoreReplicationSet) stopping(_ error) error {
 	return services.StopManagerAndAwaitStopped(context.Background(), s.subservices)
 }
 
-func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
+func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string, shard *sharding.ShardSelector) (map[BlocksStoreClient][]ulid.ULID, error) {
 	shards := map[string][]ulid.ULID{}
 
 	userRing := storegateway.GetShuffleShardingSubring(s.storesRing, userID, s.limits)
@@ -114,7 +121,12 @@ func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blockIDs []ulid
 		}
 
 		// Pick a non excluded store-gateway instance.
-		addr := getNonExcludedInstanceAddr(set, exclude[blockID], s.balancingStrategy)
+		var addr string
+		if s.shardingRouter != nil && shard != nil && shard.ShardCount > 0 {
+			addr = s.shardingRouter.GetInstanceAddr(blockID, set, exclude[blockID], shard)
+		} else {
+			addr = getNonExcludedInstanceAddr(set, exclude[blockID], s.balancingStrategy)
+		}
 		if addr == "" {
 			return nil, fmt.Errorf("no store-gateway instance left after checking exclude for block %s", blockID.String())
 		}
@@ -153,3 +165,39 @@ func getNonExcludedInstanceAddr(set ring.ReplicationSet, exclude []string, balan
 
 	return ""
 }
+
+// QueryShardingRouter routes the requests for a sharded query to the store-gateway replicas
+// in a consistent way: the same query shard of a given block is always routed to the same
+// replica (as long as the replication set doesn't change), while different shards of the same
+// block are spread across the replicas. This improves the cache locality in the store-gateways
+// because each replica ends up serving a subset of the query shards of each block.
+type QueryShardingRouter struct{}
+
+// GetInstanceAddr returns the address of the store-gateway instance, within the input replication
+// set, owning the input shard of the block. If the owner instance is excluded, the next non
+// excluded instance is returned. Returns an empty string if all instances have been excluded.
+func (r *QueryShardingRouter) GetInstanceAddr(blockID ulid.ULID, set ring.ReplicationSet, exclude []string, shard *sharding.ShardSelector) string {
+	if len(set.Instances) == 0 {
+		return ""
+	}
+
+	// Sort the instances to get a stable order, regardless of the order returned by the ring.
+	addrs := make([]string, 0, len(set.Instances))
+	for _, instance := range set.Instances {
+		addrs = append(addrs, instance.Addr)
+	}
+	sort.Strings(addrs)
+
+	// The block hash is added to the shard index so that the same shard of different
+	// blocks is not always routed to the same replica position.
+	offset := int((uint64(mimir_tsdb.HashBlockID(blockID)) + shard.ShardIndex) % uint64(len(addrs)))
+
+	for i := 0; i < len(addrs); i++ {
+		addr := addrs[(offset+i)%len(addrs)]
+		if !util.StringsContain(exclude, addr) {
+			return addr
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/stats"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+)
+
+// instantQueryDedupKey identifies the instant queries which can be evaluated once.
+type instantQueryDedupKey struct {
+	tenantID     string
+	query        string
+	timestamp    int64
+	perStepStats bool
+}
+
+// inFlightInstantQuery is an instant query being executed, whose result is shared with the identical queries.
+type inFlightInstantQuery struct {
+	// The query actually executed on behalf of all the identical queries.
+	query promql.Query
+
+	// When the execution of the query started.
+	started time.Time
+
+	// Closed once the query has been executed. The result is shared between all the identical queries.
+	done   chan struct{}
+	result *promql.Result
+
+	// The number of identical queries not closed yet. Protected by the InstantQueryDeduplicator lock.
+	refs int
+}
+
+// InstantQueryDeduplicator is a v1.QueryEngine which deduplicates the instant queries for the same tenant
+// with the same expression and timestamp, evaluating them only once and sharing the result with all the
+// callers. A query is executed right away, unless an identical query is already being executed since
+// less than the window: in that case the query waits for it and gets its result. Queries are never delayed
+// to wait for identical ones. The shared query is evaluated within the context of the first query, so if
+// it's canceled then all the identical queries waiting for it fail. Range queries are not deduplicated.
+type InstantQueryDeduplicator struct {
+	v1.QueryEngine
+
+	window time.Duration
+
+	mtx      sync.Mutex
+	inFlight map[instantQueryDedupKey]*inFlightInstantQuery
+
+	dedupedQueries prometheus.Counter
+}
+
+// NewInstantQueryDeduplicator wraps the input engine to deduplicate the instant queries received while an identical
+// query is being executed, within the window since its execution started.
+func NewInstantQueryDeduplicator(engine v1.QueryEngine, window time.Duration, reg prometheus.Registerer) *InstantQueryDeduplicator {
+	return &InstantQueryDeduplicator{
+		QueryEngine: engine,
+		window:      window,
+		inFlight:    map[instantQueryDedupKey]*inFlightInstantQuery{},
+		dedupedQueries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_instant_queries_deduplicated_total",
+			Help: "Total number of instant queries which have not been evaluated because an identical query was in flight.",
+		}),
+	}
+}
+
+// NewInstantQuery implements v1.QueryEngine.
+func (d *InstantQueryDeduplicator) NewInstantQuery(q storage.Queryable, opts *promql.QueryOpts, qs string, ts time.Time) (promql.Query, error) {
+	// Create the query anyway, so that it's validated and parsed as usual.
+	query, err := d.QueryEngine.NewInstantQuery(q, opts, qs, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	key := instantQueryDedupKey{
+		query:     qs,
+		timestamp: ts.UnixNano(),
+	}
+	if opts != nil {
+		key.perStepStats = opts.EnablePerStepStats
+	}
+
+	return &dedupedInstantQuery{Query: query, dedup: d, key: key}, nil
+}
+
+// dedupedInstantQuery is a promql.Query which shares the execution of the identical queries in flight.
+type dedupedInstantQuery struct {
+	promql.Query
+
+	dedup *InstantQueryDeduplicator
+	key   instantQueryDedupKey
+
+	// The query whose result is shared. Nil if not executed yet.
+	shared *inFlightInstantQuery
+}
+
+// Exec implements promql.Query.
+func (q *dedupedInstantQuery) Exec(ctx context.Context) *promql.Result {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return q.Query.Exec(ctx)
+	}
+	q.key.tenantID = tenant.JoinTenantIDs(tenantIDs)
+
+	d := q.dedup
+	d.mtx.Lock()
+	shared, joined := d.inFlight[q.key]
+	if joined && time.Since(shared.started) > d.window {
+		// The identical query has been running for too long, and its result may not include
+		// the samples received in the meanwhile: execute the query.
+		joined = false
+	}
+	if !joined {
+		shared = &inFlightInstantQuery{query: q.Query, started: time.Now(), done: make(chan struct{})}
+		d.inFlight[q.key] = shared
+	}
+	shared.refs++
+	q.shared = shared
+	d.mtx.Unlock()
+
+	if joined {
+		d.dedupedQueries.Inc()
+
+		select {
+		case <-shared.done:
+			return shared.result
+		case <-ctx.Done():
+			return &promql.Result{Err: ctx.Err()}
+		}
+	}
+
+	// No identical query is in flight: run the query right away. The identical queries received
+	// while it's running get its result.
+	shared.result = q.Query.Exec(ctx)
+
+	d.mtx.Lock()
+	if d.inFlight[q.key] == shared {
+		delete(d.inFlight, q.key)
+	}
+	d.mtx.Unlock()
+
+	close(shared.done)
+	return shared.result
+}
+
+// Stats implements promql.Query.
+func (q *dedupedInstantQuery) Stats() *stats.Statistics {
+	if q.shared != nil {
+		return q.shared.query.Stats()
+	}
+	return q.Query.Stats()
+}
+
+// Close implements promql.Query. The executed query is closed once all the identical queries sharing it have been closed.
+func (q *dedupedInstantQuery) Close() {
+	if q.shared == nil {
+		q.Query.Close()
+		return
+	}
+
+	if q.shared.query != q.Query {
+		q.Query.Close()
+	}
+
+	d := q.dedup
+	d.mtx.Lock()
+	q.shared.refs--
+	last := q.shared.refs == 0
+	d.mtx.Unlock()
+
+	if last {
+		// The query executed on behalf of the identical queries holds a reference until
+		// closed, so it has already been executed at this point.
+		q.shared.query.Close()
+	}
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+)
+
+func TestInstantQueryDeduplicator(t *testing.T) {
+	const window = 100 * time.Millisecond
+	ts := time.Unix(1000, 0)
+
+	type query struct {
+		tenantID  string
+		expr      string
+		timestamp time.Time
+	}
+
+	tests := map[string]struct {
+		queries       []query
+		expectedExecs int
+	}{
+		"should deduplicate identical queries": {
+			queries: []query{
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+			},
+			expectedExecs: 1,
+		},
+		"should not deduplicate queries with different expressions": {
+			queries: []query{
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+				{tenantID: "user-1", expr: "down", timestamp: ts},
+			},
+			expectedExecs: 2,
+		},
+		"should not deduplicate queries with different timestamps": {
+			queries: []query{
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+				{tenantID: "user-1", expr: "up", timestamp: ts.Add(time.Second)},
+			},
+			expectedExecs: 2,
+		},
+		"should not deduplicate queries for different tenants": {
+			queries: []query{
+				{tenantID: "user-1", expr: "up", timestamp: ts},
+				{tenantID: "user-2", expr: "up", timestamp: ts},
+			},
+			expectedExecs: 2,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			// Keep the executed queries in flight until all queries have been either executed or deduplicated.
+			engine := &mockQueryEngine{release: make(chan struct{})}
+			reg := prometheus.NewPedanticRegistry()
+			dedup := NewInstantQueryDeduplicator(engine, window, reg)
+
+			results := make([]*promql.Result, len(testData.queries))
+			wg := sync.WaitGroup{}
+			wg.Add(len(testData.queries))
+
+			for i, q := range testData.queries {
+				query, err := dedup.NewInstantQuery(nil, nil, q.expr, q.timestamp)
+				require.NoError(t, err)
+
+				go func(i int, tenantID string, query promql.Query) {
+					defer wg.Done()
+					results[i] = query.Exec(user.InjectOrgID(context.Background(), tenantID))
+				}(i, q.tenantID, query)
+
+				// Wait until the query is either executing or deduplicated, so that the following ones find it in flight.
+				require.Eventually(t, func() bool {
+					return int(engine.execs.Load())+int(testutil.ToFloat64(dedup.dedupedQueries)) == i+1
+				}, time.Second, time.Millisecond)
+			}
+
+			close(engine.release)
+			wg.Wait()
+
+			assert.Equal(t, testData.expectedExecs, int(engine.execs.Load()))
+			assert.Equal(t, float64(len(testData.queries)-testData.expectedExecs), testutil.ToFloat64(dedup.dedupedQueries))
+
+			for i, q := range testData.queries {
+				require.NoError(t, results[i].Err)
+				assert.Equal(t, promql.Scalar{T: q.timestamp.UnixMilli(), V: float64(len(q.expr))}, results[i].Value)
+			}
+		})
+	}
+}
+
+func TestInstantQueryDeduplicator_ShouldNotDelayQueriesWithoutIdenticalQueryInFlight(t *testing.T) {
+	engine := &mockQueryEngine{}
+	dedup := NewInstantQueryDeduplicator(engine, time.Hour, nil)
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	// The queries are executed right away, without waiting for the window.
+	for i := 0; i < 2; i++ {
+		query, err := dedup.NewInstantQuery(nil, nil, "up", time.Unix(1000, 0))
+		require.NoError(t, err)
+		require.NoError(t, query.Exec(ctx).Err)
+		query.Close()
+	}
+
+	assert.Equal(t, int32(2), engine.execs.Load())
+	assert.Equal(t, float64(0), testutil.ToFloat64(dedup.dedupedQueries))
+	assert.Empty(t, dedup.inFlight)
+}
+
+func TestInstantQueryDeduplicator_ShouldNotDeduplicateQueriesAfterWindow(t *testing.T) {
+	const window = 50 * time.Millisecond
+
+	engine := &mockQueryEngine{release: make(chan struct{})}
+	dedup := NewInstantQueryDeduplicator(engine, window, nil)
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		query, err := dedup.NewInstantQuery(nil, nil, "up", time.Unix(1000, 0))
+		require.NoError(t, err)
+
+		go func() {
+			defer wg.Done()
+			require.NoError(t, query.Exec(ctx).Err)
+		}()
+
+		// Wait until the query is executing, and longer than the window.
+		require.Eventually(t, func() bool { return int(engine.execs.Load()) == i+1 }, time.Second, time.Millisecond)
+		time.Sleep(2 * window)
+	}
+
+	close(engine.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), engine.execs.Load())
+	assert.Equal(t, float64(0), testutil.ToFloat64(dedup.dedupedQueries))
+	assert.Empty(t, dedup.inFlight)
+}
+
+func TestInstantQueryDeduplicator_Close(t *testing.T) {
+	engine := &mockQueryEngine{release: make(chan struct{})}
+	dedup := NewInstantQueryDeduplicator(engine, time.Hour, nil)
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+
+	first, err := dedup.NewInstantQuery(nil, nil, "up", time.Unix(1000, 0))
+	require.NoError(t, err)
+	second, err := dedup.NewInstantQuery(nil, nil, "up", time.Unix(1000, 0))
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	for i, q := range []promql.Query{first, second} {
+		go func(q promql.Query) {
+			defer wg.Done()
+			require.NoError(t, q.Exec(ctx).Err)
+		}(q)
+
+		// Wait until the query is either executing or deduplicated.
+		require.Eventually(t, func() bool {
+			return int(engine.execs.Load())+int(testutil.ToFloat64(dedup.dedupedQueries)) == i+1
+		}, time.Second, time.Millisecond)
+	}
+	close(engine.release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), engine.execs.Load())
+	require.Len(t, engine.queries, 2)
+
+	// The first query has been executed on behalf of the identical queries, so it's closed only once
+	// all of them have been closed, while the deduplicated query is closed right away.
+	first.Close()
+	assert.Equal(t, int32(0), engine.closed.Load())
+	second.Close()
+	assert.Equal(t, int32(2), engine.closed.Load())
+}
+
+func TestInstantQueryDeduplicator_ShouldNotDeduplicateQueriesWithoutTenant(t *testing.T) {
+	engine := &mockQueryEngine{}
+	dedup := NewInstantQueryDeduplicator(engine, time.Hour, nil)
+
+	query, err := dedup.NewInstantQuery(nil, nil, "up", time.Unix(1000, 0))
+	require.NoError(t, err)
+
+	res := query.Exec(context.Background())
+	require.NoError(t, res.Err)
+	assert.Equal(t, int32(1), engine.execs.Load())
+}
+
+type mockQueryEngine struct {
+	mtx     sync.Mutex
+	queries []*mockQuery
+
+	// If not nil, the queries execution blocks until the channel is closed.
+	release chan struct{}
+
+	execs  atomic.Int32
+	closed atomic.Int32
+}
+
+func (e *mockQueryEngine) SetQueryLogger(promql.QueryLogger) {}
+
+func (e *mockQueryEngine) NewInstantQuery(_ storage.Queryable, _ *promql.QueryOpts, qs string, ts time.Time) (promql.Query, error) {
+	q := &mockQuery{engine: e, qs: qs, ts: ts}
+
+	e.mtx.Lock()
+	e.queries = append(e.queries, q)
+	e.mtx.Unlock()
+
+	return q, nil
+}
+
+func (e *mockQueryEngine) NewRangeQuery(storage.Queryable, *promql.QueryOpts, string, time.Time, time.Time, time.Duration) (promql.Query, error) {
+	panic("not implemented")
+}
+
+// mockQuery is a promql.Query returning a scalar with the length of the query expression as value.
+type mockQuery struct {
+	engine *mockQueryEngine
+	qs     string
+	ts     time.Time
+}
+
+func (q *mockQuery) Exec(context.Context) *promql.Result {
+	q.engine.execs.Inc()
+	if q.engine.release != nil {
+		<-q.engine.release
+	}
+	return &promql.Result{Value: promql.Scalar{T: q.ts.UnixMilli(), V: float64(len(q.qs))}}
+}
+
+func (q *mockQuery) Close() {
+	q.engine.closed.Inc()
+}
+
+func (q *mockQuery) Statement() parser.Statement { return nil }
+
+func (q *mockQuery) Stats() *stats.Statistics { return nil }
+
+func (q *mockQuery) Cancel() {}
+
+func (q *mockQuery) String() string { return q.qs }
@@ -49,9 +49,23 @@ func NewMetadataHandler(m MetadataSupplier) http.Handler {
 			return
 		}
 
+		// The metadata can be filtered by metric name, like in the Prometheus API. The filter
+		// can be set multiple times to get the metadata of multiple metrics.
+		var filter map[string]struct{}
+		if err := r.ParseForm(); err == nil && len(r.Form["metric"]) > 0 {
+			filter = make(map[string]struct{}, len(r.Form["metric"]))
+			for _, name := range r.Form["metric"] {
+				filter[name] = struct{}{}
+			}
+		}
+
 		// Put all the elements of the pseudo-set into a map of slices for marshalling.
 		metrics := map[string][]metricMetadata{}
 		for _, m := range resp {
+			if _, ok := filter[m.Metric]; filter != nil && !ok {
+				continue
+			}
+
 			ms, ok := metrics[m.Metric]
 			if !ok {
 				// Most metrics will only hold 1 copy of the same metadata.
@@ -55,6 +55,53 @@ func TestMetadataHandler_Success(t *testing.T) {
 	require.JSONEq(t, expectedJSON, string(responseBody))
 }
 
+func TestMetadataHandler_ShouldFilterByMetricName(t *testing.T) {
+	d := &mockDistributor{}
+	d.On("MetricsMetadata", mock.Anything).Return(
+		[]scrape.MetricMetadata{
+			{Metric: "alertmanager_dispatcher_aggregation_groups", Help: "Number of active aggregation groups", Type: "gauge", Unit: ""},
+			{Metric: "alertmanager_alerts", Help: "How many alerts by state", Type: "gauge", Unit: ""},
+			{Metric: "up", Help: "Whether the target is up", Type: "gauge", Unit: ""},
+		},
+		nil)
+
+	handler := NewMetadataHandler(d)
+
+	request, err := http.NewRequest("GET", "/metadata?metric=up&metric=alertmanager_alerts&metric=unknown", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	responseBody, err := io.ReadAll(recorder.Result().Body)
+	require.NoError(t, err)
+
+	expectedJSON := `
+	{
+		"status": "success",
+		"data": {
+			"alertmanager_alerts": [
+				{
+					"help": "How many alerts by state",
+					"type": "gauge",
+					"unit": ""
+				}
+			],
+			"up": [
+				{
+					"help": "Whether the target is up",
+					"type": "gauge",
+					"unit": ""
+				}
+			]
+		}
+	}
+	`
+
+	require.JSONEq(t, expectedJSON, string(responseBody))
+}
+
 func TestMetadataHandler_Error(t *testing.T) {
 	d := &mockDistributor{}
 	d.On("MetricsMetadata", mock.Anything).Return([]scrape.MetricMetadata{}, fmt.Errorf("no user id"))
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
@@ -51,6 +52,11 @@ type Config struct {
 
 	ShuffleShardingIngestersEnabled bool `yaml:"shuffle_sharding_ingesters_enabled" category:"advanced"`
 
+	InstantQueryDedupWindow time.Duration `yaml:"instant_query_dedup_window" category:"experimental"`
+	FallbackToObjectStorage bool          `yaml:"fallback_to_object_storage" category:"experimental"`
+
+	FallbackToObjectStorageMaxBytesPerQuery uint64 `yaml:"fallback_to_object_storage_max_bytes_per_query" category:"experimental"`
+
 	// PromQL engine config.
 	EngineConfig engine.Config `yaml:",inline"`
 }
@@ -74,6 +80,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.MaxQueryIntoFuture, "querier.max-query-into-future", 10*time.Minute, "Maximum duration into the future you can query. 0 to disable.")
 	f.DurationVar(&cfg.QueryStoreAfter, queryStoreAfterFlag, 12*time.Hour, "The time after which a metric should be queried from storage and not just ingesters. 0 means all queries are sent to store. If this option is enabled, the time range of the query sent to the store-gateway will be manipulated to ensure the query end is not more recent than 'now - query-store-after'.")
 	f.BoolVar(&cfg.ShuffleShardingIngestersEnabled, "querier.shuffle-sharding-ingesters-enabled", true, fmt.Sprintf("Fetch in-memory series from the minimum set of required ingesters, selecting only ingesters which may have received series since -%s. If this setting is false or -%s is '0', queriers always query all ingesters (ingesters shuffle sharding on read path is disabled).", queryIngestersWithinFlag, queryIngestersWithinFlag))
+	f.DurationVar(&cfg.InstantQueryDedupWindow, "querier.instant-query-dedup-window", 0, "When greater than 0, an instant query received while an identical query (same tenant, expression and timestamp) is being evaluated since less than this time window is not evaluated, and gets the result of the identical query instead. Instant queries are never delayed. 0 to disable.")
+
+	f.BoolVar(&cfg.FallbackToObjectStorage, "querier.fallback-to-object-storage", false, "When enabled, the blocks which can't be queried from any store-gateway, for example during a store-gateways outage, are queried directly from the object storage by the querier. The index of each queried block is downloaded to the local disk, and the chunks are read with range requests. This is significantly slower than querying the store-gateways.")
+	f.Uint64Var(&cfg.FallbackToObjectStorageMaxBytesPerQuery, "querier.fallback-to-object-storage-max-bytes-per-query", uint64(units.Gibibyte), "Maximum number of bytes read from the object storage for the blocks queried directly by a query when falling back to the object storage, including the index of each block downloaded to the local disk. Queries exceeding it fail. 0 to disable the limit.")
 
 	cfg.EngineConfig.RegisterFlags(f)
 }
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	v1 "github.com/prometheus/prometheus/web/api/v1"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// queryDiffMaxPoints is the max number of points per series each expression can be evaluated at,
+// the same limit enforced by the Prometheus range query API.
+const queryDiffMaxPoints = 11000
+
+// QueryDiffResponse is the result of the comparison of two expressions evaluated over the same time range.
+type QueryDiffResponse struct {
+	// Equal is true if both expressions returned the same series with the same samples.
+	Equal bool `json:"equal"`
+
+	// OnlyInA are the series returned by expr_a but not by expr_b.
+	OnlyInA []QueryDiffSeries `json:"only_in_a"`
+
+	// OnlyInB are the series returned by expr_b but not by expr_a.
+	OnlyInB []QueryDiffSeries `json:"only_in_b"`
+
+	// Different are the series returned by both expressions, with different samples.
+	Different []QueryDiffSeriesSamples `json:"different"`
+}
+
+// QueryDiffSeries is a series returned by only one of the compared expressions.
+type QueryDiffSeries struct {
+	Metric  labels.Labels  `json:"metric"`
+	Samples []promql.Point `json:"values"`
+}
+
+// QueryDiffSeriesSamples is a series returned by both compared expressions, with the samples which differ.
+type QueryDiffSeriesSamples struct {
+	Metric  labels.Labels     `json:"metric"`
+	Samples []QueryDiffSample `json:"samples"`
+}
+
+// QueryDiffSample is a timestamp at which the compared expressions have a different value. A nil value means the
+// expression has no sample at the timestamp.
+type QueryDiffSample struct {
+	Timestamp int64   `json:"timestamp"`
+	A         *string `json:"a"`
+	B         *string `json:"b"`
+}
+
+type queryDiffResult struct {
+	Status string             `json:"status"`
+	Data   *QueryDiffResponse `json:"data,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// QueryDiffHandler creates a http.Handler evaluating two expressions as range queries over the same time range and
+// returning the series and samples which differ. It allows to verify that a recording rule can safely be replaced
+// with another one.
+func QueryDiffHandler(engine v1.QueryEngine, queryable storage.Queryable) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exprA, exprB, start, end, step, err := extractQueryDiffRequestParams(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			util.WriteJSONResponse(w, queryDiffResult{Status: statusError, Error: err.Error()})
+			return
+		}
+
+		matrixA, err := execRangeQuery(r.Context(), engine, queryable, exprA, start, end, step)
+		if err != nil {
+			w.WriteHeader(queryDiffErrorStatusCode(err))
+			util.WriteJSONResponse(w, queryDiffResult{Status: statusError, Error: errors.Wrap(err, "expr_a").Error()})
+			return
+		}
+
+		matrixB, err := execRangeQuery(r.Context(), engine, queryable, exprB, start, end, step)
+		if err != nil {
+			w.WriteHeader(queryDiffErrorStatusCode(err))
+			util.WriteJSONResponse(w, queryDiffResult{Status: statusError, Error: errors.Wrap(err, "expr_b").Error()})
+			return
+		}
+
+		util.WriteJSONResponse(w, queryDiffResult{Status: statusSuccess, Data: diffMatrices(matrixA, matrixB)})
+	})
+}
+
+func extractQueryDiffRequestParams(r *http.Request) (exprA, exprB string, start, end time.Time, step time.Duration, err error) {
+	if err = r.ParseForm(); err != nil {
+		return
+	}
+
+	exprA, exprB = r.Form.Get("expr_a"), r.Form.Get("expr_b")
+	if exprA == "" || exprB == "" {
+		err = errors.New("both expr_a and expr_b parameters are required")
+		return
+	}
+
+	startMs, err := util.ParseTime(r.Form.Get("start"))
+	if err != nil {
+		err = errors.Wrap(err, "invalid start parameter")
+		return
+	}
+	endMs, err := util.ParseTime(r.Form.Get("end"))
+	if err != nil {
+		err = errors.Wrap(err, "invalid end parameter")
+		return
+	}
+	if endMs < startMs {
+		err = errors.New("end timestamp must not be before start time")
+		return
+	}
+
+	step, err = parseQueryDiffStep(r.Form.Get("step"))
+	if err != nil {
+		err = errors.Wrap(err, "invalid step parameter")
+		return
+	}
+	if step < time.Millisecond {
+		err = errors.New("query resolution step width must be at least 1ms, try a positive integer")
+		return
+	}
+	if (endMs-startMs)/step.Milliseconds() > queryDiffMaxPoints {
+		err = fmt.Errorf("exceeded maximum resolution of %d points per timeseries, try decreasing the query resolution (?step=XX)", queryDiffMaxPoints)
+		return
+	}
+
+	return exprA, exprB, util.TimeFromMillis(startMs), util.TimeFromMillis(endMs), step, nil
+}
+
+func parseQueryDiffStep(s string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(s, 64); err == nil {
+		ts := d * float64(time.Second)
+		if ts > float64(math.MaxInt64) || ts < float64(math.MinInt64) {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration, it overflows int64", s)
+		}
+		return time.Duration(ts), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
+
+func execRangeQuery(ctx context.Context, engine v1.QueryEngine, queryable storage.Queryable, expr string, start, end time.Time, step time.Duration) (promql.Matrix, error) {
+	q, err := engine.NewRangeQuery(queryable, nil, expr, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	qRes := q.Exec(ctx)
+	if qRes.Err != nil {
+		return nil, qRes.Err
+	}
+
+	matrix, err := qRes.Matrix()
+	if err != nil {
+		return nil, err
+	}
+
+	// The points of the query result are returned to the engine pool when the query is closed, so we copy them.
+	res := make(promql.Matrix, 0, len(matrix))
+	for _, series := range matrix {
+		res = append(res, promql.Series{Metric: series.Metric, Points: append([]promql.Point(nil), series.Points...)})
+	}
+	return res, nil
+}
+
+func queryDiffErrorStatusCode(err error) int {
+	switch errors.Cause(err).(type) {
+	case promql.ErrQueryCanceled, promql.ErrQueryTimeout:
+		return http.StatusServiceUnavailable
+	case promql.ErrStorage:
+		return http.StatusInternalServerError
+	default:
+		// Invalid expressions and evaluation errors.
+		return http.StatusBadRequest
+	}
+}
+
+// diffMatrices compares the series of the two input matrices, matching them by labels.
+func diffMatrices(a, b promql.Matrix) *QueryDiffResponse {
+	res := &QueryDiffResponse{
+		OnlyInA:   []QueryDiffSeries{},
+		OnlyInB:   []QueryDiffSeries{},
+		Different: []QueryDiffSeriesSamples{},
+	}
+
+	// Sort the series by labels, so that they can be matched in a single pass.
+	sort.Sort(a)
+	sort.Sort(b)
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var cmp int
+		switch {
+		case i == len(a):
+			cmp = 1
+		case j == len(b):
+			cmp = -1
+		default:
+			cmp = labels.Compare(a[i].Metric, b[j].Metric)
+		}
+
+		switch {
+		case cmp < 0:
+			res.OnlyInA = append(res.OnlyInA, QueryDiffSeries{Metric: a[i].Metric, Samples: a[i].Points})
+			i++
+		case cmp > 0:
+			res.OnlyInB = append(res.OnlyInB, QueryDiffSeries{Metric: b[j].Metric, Samples: b[j].Points})
+			j++
+		default:
+			if samples := diffPoints(a[i].Points, b[j].Points); len(samples) > 0 {
+				res.Different = append(res.Different, QueryDiffSeriesSamples{Metric: a[i].Metric, Samples: samples})
+			}
+			i++
+			j++
+		}
+	}
+
+	res.Equal = len(res.OnlyInA) == 0 && len(res.OnlyInB) == 0 && len(res.Different) == 0
+	return res
+}
+
+// diffPoints returns the timestamps at which the input points, sorted by timestamp, differ.
+func diffPoints(a, b []promql.Point) []QueryDiffSample {
+	var res []QueryDiffSample
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].T < b[j].T):
+			res = append(res, QueryDiffSample{Timestamp: a[i].T, A: formatValue(a[i].V)})
+			i++
+		case i == len(a) || b[j].T < a[i].T:
+			res = append(res, QueryDiffSample{Timestamp: b[j].T, B: formatValue(b[j].V)})
+			j++
+		default:
+			// NaN values are considered equal to each other.
+			if a[i].V != b[j].V && !(math.IsNaN(a[i].V) && math.IsNaN(b[j].V)) {
+				res = append(res, QueryDiffSample{Timestamp: a[i].T, A: formatValue(a[i].V), B: formatValue(b[j].V)})
+			}
+			i++
+			j++
+		}
+	}
+
+	return res
+}
+
+// formatValue formats the input value like the Prometheus API does, so that special values (eg. NaN) can be encoded.
+func formatValue(v float64) *string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	return &s
+}
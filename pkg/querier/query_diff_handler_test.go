@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryDiffHandler(t *testing.T) {
+	test, err := promql.NewTest(t, `
+		load 1m
+			metric_a{job="a"}        1 2 3 4 5
+			metric_a{job="b"}        1 1 1 1 1
+			metric_a{job="c"}        NaN NaN NaN NaN NaN
+			metric_b{job="a"}        1 2 3 4 5
+			metric_b{job="b"}        1 1 2 _ 1
+			metric_b{job="c"}        NaN NaN NaN NaN NaN
+			metric_b{job="d"}        1 1 1 1 1
+	`)
+	require.NoError(t, err)
+	t.Cleanup(test.Close)
+	require.NoError(t, test.Run())
+
+	handler := QueryDiffHandler(test.QueryEngine(), test.Storage())
+
+	tests := map[string]struct {
+		params             url.Values
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"same expressions": {
+			params:             url.Values{"expr_a": {"metric_a"}, "expr_b": {"metric_a"}, "start": {"0"}, "end": {"240"}, "step": {"60"}},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"status":"success","data":{"equal":true,"only_in_a":[],"only_in_b":[],"different":[]}}`,
+		},
+		"equivalent expressions": {
+			params:             url.Values{"expr_a": {`label_replace(metric_a, "__name__", "metric_b", "", "")`}, "expr_b": {`metric_b{job!="d"} or metric_b{job="a"}`}, "start": {"0"}, "end": {"60"}, "step": {"1m"}},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"status":"success","data":{"equal":true,"only_in_a":[],"only_in_b":[],"different":[]}}`,
+		},
+		"different expressions": {
+			params:             url.Values{"expr_a": {`label_replace(metric_a, "__name__", "metric_b", "", "")`}, "expr_b": {"metric_b"}, "start": {"0"}, "end": {"240"}, "step": {"60"}},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"status":"success","data":{"equal":false,"only_in_a":[],` +
+				`"only_in_b":[{"metric":{"__name__":"metric_b","job":"d"},"values":[[0,"1"],[60,"1"],[120,"1"],[180,"1"],[240,"1"]]}],` +
+				`"different":[{"metric":{"__name__":"metric_b","job":"b"},"samples":[{"timestamp":120000,"a":"1","b":"2"},{"timestamp":180000,"a":"1","b":"2"}]}]}}`,
+		},
+		"missing expression": {
+			params:             url.Values{"expr_a": {"metric_a"}, "start": {"0"}, "end": {"240"}, "step": {"60"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"status":"error","error":"both expr_a and expr_b parameters are required"}`,
+		},
+		"end before start": {
+			params:             url.Values{"expr_a": {"metric_a"}, "expr_b": {"metric_b"}, "start": {"240"}, "end": {"0"}, "step": {"60"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"status":"error","error":"end timestamp must not be before start time"}`,
+		},
+		"invalid step": {
+			params:             url.Values{"expr_a": {"metric_a"}, "expr_b": {"metric_b"}, "start": {"0"}, "end": {"240"}, "step": {"0"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"status":"error","error":"query resolution step width must be at least 1ms, try a positive integer"}`,
+		},
+		"invalid expression": {
+			params:             url.Values{"expr_a": {"metric_a"}, "expr_b": {"sum(metric_b"}, "start": {"0"}, "end": {"240"}, "step": {"60"}},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/query_diff", strings.NewReader(testData.params.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, testData.expectedStatusCode, rec.Code)
+
+			if testData.expectedBody != "" {
+				assert.JSONEq(t, testData.expectedBody, rec.Body.String())
+			} else {
+				res := queryDiffResult{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Equal(t, statusError, res.Status)
+				assert.True(t, strings.HasPrefix(res.Error, "expr_b: "), res.Error)
+			}
+		})
+	}
+}
@@ -103,9 +103,12 @@ func newStoreGatewayClientPool(discovery client.PoolServiceDiscovery, clientConf
 type ClientConfig struct {
 	TLSEnabled bool             `yaml:"tls_enabled" category:"advanced"`
 	TLS        tls.ClientConfig `yaml:",inline"`
+
+	QueryShardingRoutingEnabled bool `yaml:"query_sharding_routing_enabled" category:"experimental"`
 }
 
 func (cfg *ClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	f.BoolVar(&cfg.TLSEnabled, prefix+".tls-enabled", cfg.TLSEnabled, "Enable TLS for gRPC client connecting to store-gateway.")
 	cfg.TLS.RegisterFlagsWithPrefix(prefix, f)
+	f.BoolVar(&cfg.QueryShardingRoutingEnabled, prefix+".query-sharding-routing-enabled", false, "If enabled, requests for sharded queries are consistently routed to the store-gateway replica owning the query shard of each block, instead of a random replica. This improves the store-gateway cache locality.")
 }
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// AlertNormalization applies the tenant's alert label normalization rules to the label values of the
+// alerts sent to the Alertmanager, for example to make the casing and whitespace consistent across rule
+// groups. The rules are read from the limits each time the alerts are sent, so that changes to the
+// runtime overrides apply without reloading the rules. The labels of the ALERTS series written by the
+// ruler are not normalized.
+type AlertNormalization struct {
+	userID string
+	limits RulesLimits
+}
+
+func NewAlertNormalization(userID string, limits RulesLimits) *AlertNormalization {
+	return &AlertNormalization{
+		userID: userID,
+		limits: limits,
+	}
+}
+
+// WrapNotifyFunc returns a rules.NotifyFunc which normalizes the alert labels before passing the alerts
+// to next. The input alerts are not modified.
+func (n *AlertNormalization) WrapNotifyFunc(next rules.NotifyFunc) rules.NotifyFunc {
+	return func(ctx context.Context, expr string, alerts ...*rules.Alert) {
+		normalizationRules := n.limits.RulerAlertLabelNormalization(n.userID)
+		if len(normalizationRules) == 0 {
+			next(ctx, expr, alerts...)
+			return
+		}
+
+		normalized := make([]*rules.Alert, 0, len(alerts))
+		for _, alert := range alerts {
+			copied := *alert
+			copied.Labels = n.normalizeLabels(alert.Labels, normalizationRules)
+			normalized = append(normalized, &copied)
+		}
+
+		next(ctx, expr, normalized...)
+	}
+}
+
+// normalizeLabels returns the input labels with the normalization rules applied, in order, to their values.
+// Labels whose value is empty after the normalization are removed, except the alert name which is never
+// normalized to an empty value.
+func (n *AlertNormalization) normalizeLabels(lbls labels.Labels, normalizationRules []validation.AlertLabelNormalizationRule) labels.Labels {
+	builder := labels.NewBuilder(lbls)
+
+	for _, rule := range normalizationRules {
+		regex := rule.CompiledRegex()
+
+		for _, l := range builder.Labels() {
+			if len(rule.Labels) > 0 && !util.StringsContain(rule.Labels, l.Name) {
+				continue
+			}
+
+			value := l.Value
+			if rule.TrimSpace {
+				value = strings.TrimSpace(value)
+			}
+			if rule.Lowercase {
+				value = strings.ToLower(value)
+			}
+			if regex != nil {
+				value = regex.ReplaceAllString(value, rule.Replacement)
+			}
+
+			if value == "" && l.Name == labels.AlertName {
+				continue
+			}
+			if value != l.Value {
+				builder.Set(l.Name, value)
+			}
+		}
+	}
+
+	return builder.Labels()
+}
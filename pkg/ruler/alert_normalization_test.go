@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestAlertNormalization(t *testing.T) {
+	var normalizationRules []validation.AlertLabelNormalizationRule
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- trim_space: true
+- labels: [severity, team]
+  lowercase: true
+- labels: [team]
+  regex: '\s+'
+  replacement: '-'
+`), &normalizationRules))
+
+	limits := validation.MockOverrides(func(defaults *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits["user-1"] = validation.MockDefaultLimits()
+		tenantLimits["user-1"].RulerAlertLabelNormalization = normalizationRules
+	})
+
+	newAlert := func(lbls labels.Labels) *rules.Alert {
+		return &rules.Alert{
+			State:      rules.StateFiring,
+			Labels:     lbls,
+			FiredAt:    time.Now(),
+			ValidUntil: time.Now().Add(time.Minute),
+		}
+	}
+
+	tests := map[string]struct {
+		userID   string
+		input    labels.Labels
+		expected labels.Labels
+	}{
+		"should normalize the labels": {
+			userID:   "user-1",
+			input:    labels.FromStrings(labels.AlertName, " HighErrorRate ", "severity", "Critical ", "team", " Platform  Infra", "job", "API"),
+			expected: labels.FromStrings(labels.AlertName, "HighErrorRate", "severity", "critical", "team", "platform-infra", "job", "API"),
+		},
+		"should remove the labels whose value is empty after the normalization": {
+			userID:   "user-1",
+			input:    labels.FromStrings(labels.AlertName, "HighErrorRate", "severity", "  "),
+			expected: labels.FromStrings(labels.AlertName, "HighErrorRate"),
+		},
+		"should never remove the alert name": {
+			userID:   "user-1",
+			input:    labels.FromStrings(labels.AlertName, "  ", "severity", "Critical"),
+			expected: labels.FromStrings(labels.AlertName, "  ", "severity", "critical"),
+		},
+		"should not normalize the labels of tenants without normalization rules": {
+			userID:   "user-2",
+			input:    labels.FromStrings(labels.AlertName, " HighErrorRate ", "severity", "Critical "),
+			expected: labels.FromStrings(labels.AlertName, " HighErrorRate ", "severity", "Critical "),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			s := &mockSender{}
+			notifyFunc := NewAlertNormalization(testData.userID, limits).WrapNotifyFunc(SendAlerts(s, "http://localhost"))
+
+			alert := newAlert(testData.input.Copy())
+			notifyFunc(context.Background(), "up == 0", alert)
+
+			require.Len(t, s.alerts, 1)
+			assert.Equal(t, testData.expected, s.alerts[0].Labels)
+
+			// The input alert should not be modified.
+			assert.Equal(t, testData.input, alert.Labels)
+		})
+	}
+}
+
+func TestAlertLabelNormalizationRule_ShouldFailUnmarshallingAnInvalidRegex(t *testing.T) {
+	var normalizationRules []validation.AlertLabelNormalizationRule
+	err := yaml.Unmarshal([]byte(`[{regex: "(unclosed"}]`), &normalizationRules)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid alert label normalization regex")
+}
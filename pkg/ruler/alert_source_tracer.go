@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/rules"
+)
+
+const (
+	// AlertSourceTenantLabel is the label holding the tenant which the rule producing the alert belongs to.
+	AlertSourceTenantLabel = "__ruler_tenant__"
+	// AlertSourceRuleGroupLabel is the label holding the name of the rule group which produced the alert.
+	AlertSourceRuleGroupLabel = "__ruler_rule_group__"
+	// AlertSourceRuleNameLabel is the label holding the name of the alerting rule which produced the alert.
+	AlertSourceRuleNameLabel = "__ruler_rule_name__"
+)
+
+const alertSourceRuleGroup contextKey = 2
+
+// AlertSourceTracer records which tenant, rule group and rule produced each alert, injecting
+// synthetic labels into the alerts sent to the Alertmanager. The labels are not added to the
+// ALERTS series written by the ruler.
+type AlertSourceTracer struct {
+	userID string
+}
+
+func NewAlertSourceTracer(userID string) *AlertSourceTracer {
+	return &AlertSourceTracer{userID: userID}
+}
+
+// WrapGroupContextFunc returns a rules.ContextWrapFunc which stores the rule group being evaluated
+// in the context, so that it can be retrieved when the group alerts are sent.
+func (t *AlertSourceTracer) WrapGroupContextFunc(next rules.ContextWrapFunc) rules.ContextWrapFunc {
+	return func(ctx context.Context, g *rules.Group) context.Context {
+		ctx = context.WithValue(ctx, alertSourceRuleGroup, g.Name())
+		if next != nil {
+			ctx = next(ctx, g)
+		}
+		return ctx
+	}
+}
+
+// WrapNotifyFunc returns a rules.NotifyFunc which injects the alert source labels into the
+// alerts before passing them to next. The input alerts are not modified.
+func (t *AlertSourceTracer) WrapNotifyFunc(next rules.NotifyFunc) rules.NotifyFunc {
+	return func(ctx context.Context, expr string, alerts ...*rules.Alert) {
+		group, _ := ctx.Value(alertSourceRuleGroup).(string)
+
+		traced := make([]*rules.Alert, 0, len(alerts))
+		for _, alert := range alerts {
+			builder := labels.NewBuilder(alert.Labels)
+			builder.Set(AlertSourceTenantLabel, t.userID)
+			if group != "" {
+				builder.Set(AlertSourceRuleGroupLabel, group)
+			}
+			// The alert name label is always set to the name of the alerting rule.
+			builder.Set(AlertSourceRuleNameLabel, alert.Labels.Get(labels.AlertName))
+
+			copied := *alert
+			copied.Labels = builder.Labels()
+			traced = append(traced, &copied)
+		}
+
+		next(ctx, expr, traced...)
+	}
+}
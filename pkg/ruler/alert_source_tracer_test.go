@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertSourceTracer(t *testing.T) {
+	tracer := NewAlertSourceTracer("user-1")
+
+	group := rules.NewGroup(rules.GroupOptions{
+		Name:          "group-1",
+		File:          "namespace-1",
+		Interval:      time.Minute,
+		SourceTenants: []string{"tenant-a", "tenant-b"},
+		Opts:          &rules.ManagerOptions{},
+	})
+
+	// The wrapped context function should still be called.
+	ctx := tracer.WrapGroupContextFunc(FederatedGroupContextFunc)(context.Background(), group)
+	tenantID, err := ExtractTenantIDs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-a|tenant-b", tenantID)
+
+	s := &mockSender{}
+	notifyFunc := tracer.WrapNotifyFunc(SendAlerts(s, "http://localhost"))
+
+	alert := &rules.Alert{
+		State:       rules.StateFiring,
+		Labels:      labels.FromStrings(labels.AlertName, "HighErrorRate", "job", "api"),
+		Annotations: labels.FromStrings("summary", "high error rate"),
+		FiredAt:     time.Now(),
+		ValidUntil:  time.Now().Add(time.Minute),
+	}
+	notifyFunc(ctx, "up == 0", alert)
+
+	require.Len(t, s.alerts, 1)
+	assert.Equal(t, labels.FromStrings(
+		labels.AlertName, "HighErrorRate",
+		"job", "api",
+		AlertSourceRuleGroupLabel, "group-1",
+		AlertSourceRuleNameLabel, "HighErrorRate",
+		AlertSourceTenantLabel, "user-1",
+	), s.alerts[0].Labels)
+	assert.Equal(t, alert.Annotations, s.alerts[0].Annotations)
+
+	// The input alert should not be modified.
+	assert.Equal(t, labels.FromStrings(labels.AlertName, "HighErrorRate", "job", "api"), alert.Labels)
+
+	// The rule group label should not be added if the rule group is unknown.
+	s.alerts = nil
+	notifyFunc(context.Background(), "up == 0", alert)
+
+	require.Len(t, s.alerts, 1)
+	assert.Equal(t, labels.FromStrings(
+		labels.AlertName, "HighErrorRate",
+		"job", "api",
+		AlertSourceRuleNameLabel, "HighErrorRate",
+		AlertSourceTenantLabel, "user-1",
+	), s.alerts[0].Labels)
+}
+
+type mockSender struct {
+	alerts []*notifier.Alert
+}
+
+func (s *mockSender) Send(alerts ...*notifier.Alert) {
+	s.alerts = append(s.alerts, alerts...)
+}
@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// fallbackBatchDedupPeriod is how long a batch of notifications sent to the fallback Alertmanager is remembered,
+// so that it's not sent again when the same batch fails to be sent to other primary Alertmanagers. The notifier
+// sends each batch to all the primary Alertmanagers concurrently, so this only needs to be longer than the
+// notifications timeout.
+const fallbackBatchDedupPeriod = time.Minute
+
+// alertmanagerDoFunc sends an HTTP request to the Alertmanager.
+type alertmanagerDoFunc func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error)
+
+// ExternalAlertmanagerFallback sends the notifications to a fallback Alertmanager once the requests to a primary
+// Alertmanager failed for a number of consecutive times. The state is tracked for each tenant and primary
+// Alertmanager URL. While the fallback is active, the primary Alertmanager is periodically retried, and the fallback
+// is deactivated as soon as the primary one is reachable. Each batch of notifications is sent to the fallback
+// Alertmanager once, even if it failed to be sent to multiple primary Alertmanagers: the response of the fallback
+// Alertmanager is returned for each of them.
+// The requests to the fallback Alertmanager don't use the TLS and basic auth settings of the primary Alertmanager
+// client, so that its credentials are not leaked to an external service.
+type ExternalAlertmanagerFallback struct {
+	fallbackURL          *url.URL
+	fallbackClient       *http.Client
+	maxPrimaryFailures   int
+	primaryRetryInterval time.Duration
+	logger               log.Logger
+
+	mtx     sync.Mutex
+	tenants map[string]*tenantAlertmanagerFallback
+
+	primaryFailuresTotal *prometheus.CounterVec
+	fallbackActive       *prometheus.GaugeVec
+}
+
+// tenantAlertmanagerFallback holds the fallback state of a tenant.
+type tenantAlertmanagerFallback struct {
+	primaries map[string]*primaryAlertmanagerState // Keyed by primary Alertmanager URL.
+	batches   map[uint64]*fallbackBatch            // Batches recently sent to the fallback, keyed by the hash of the body.
+}
+
+// primaryAlertmanagerState is the state of a primary Alertmanager of a tenant.
+type primaryAlertmanagerState struct {
+	failures  int       // Number of consecutive failed requests to the primary Alertmanager.
+	active    bool      // Whether notifications are sent to the fallback Alertmanager.
+	lastRetry time.Time // Last time the primary Alertmanager has been retried while the fallback is active.
+}
+
+// fallbackBatch is a batch of notifications sent to the fallback Alertmanager.
+type fallbackBatch struct {
+	done    chan struct{} // Closed once the request to the fallback Alertmanager completed.
+	expires time.Time
+
+	// Result of the request to the fallback Alertmanager, set before done is closed. The response body
+	// is read, so that the response can be returned for each primary Alertmanager the batch failed to be sent to.
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// response returns a copy of the response of the fallback Alertmanager. Must be called once done is closed.
+func (b *fallbackBatch) response() (*http.Response, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	resp := *b.resp
+	resp.Header = b.resp.Header.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(b.body))
+	return &resp, nil
+}
+
+// NewExternalAlertmanagerFallback makes a new ExternalAlertmanagerFallback.
+func NewExternalAlertmanagerFallback(fallbackURL *url.URL, maxPrimaryFailures int, primaryRetryInterval time.Duration, logger log.Logger, reg prometheus.Registerer) *ExternalAlertmanagerFallback {
+	return &ExternalAlertmanagerFallback{
+		fallbackURL:          fallbackURL,
+		fallbackClient:       &http.Client{},
+		maxPrimaryFailures:   maxPrimaryFailures,
+		primaryRetryInterval: primaryRetryInterval,
+		logger:               logger,
+		tenants:              map[string]*tenantAlertmanagerFallback{},
+		primaryFailuresTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_alertmanager_primary_failures_total",
+			Help: "Total number of failed requests to the primary Alertmanager.",
+		}, []string{"user"}),
+		fallbackActive: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ruler_alertmanager_fallback_active",
+			Help: "Number of primary Alertmanagers for which notifications are currently sent to the fallback Alertmanager.",
+		}, []string{"user"}),
+	}
+}
+
+// Wrap returns an alertmanagerDoFunc which sends the requests of the tenant through the fallback logic.
+func (f *ExternalAlertmanagerFallback) Wrap(userID string, do alertmanagerDoFunc) alertmanagerDoFunc {
+	return func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		if !f.shouldTryPrimary(userID, req.URL, time.Now()) {
+			return f.doFallback(ctx, userID, req, do)
+		}
+
+		resp, err := do(ctx, client, req)
+		if err == nil && resp.StatusCode/100 == 2 {
+			f.primarySucceeded(userID, req.URL)
+			return resp, nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf("bad response status %s", resp.Status)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if !f.primaryFailed(userID, req.URL, err) {
+			return nil, err
+		}
+
+		// Do not drop the notifications which failed to be sent to the primary Alertmanager.
+		return f.doFallback(ctx, userID, req, do)
+	}
+}
+
+// RemoveUser removes the fallback state and the metrics of the tenant.
+func (f *ExternalAlertmanagerFallback) RemoveUser(userID string) {
+	f.mtx.Lock()
+	delete(f.tenants, userID)
+	f.mtx.Unlock()
+
+	f.primaryFailuresTotal.DeleteLabelValues(userID)
+	f.fallbackActive.DeleteLabelValues(userID)
+}
+
+// primary returns the state of the primary Alertmanager of the tenant. Must be called with the lock held.
+func (f *ExternalAlertmanagerFallback) primary(userID string, primaryURL *url.URL) *primaryAlertmanagerState {
+	tenant := f.tenant(userID)
+	key := primaryURL.String()
+	state, ok := tenant.primaries[key]
+	if !ok {
+		state = &primaryAlertmanagerState{}
+		tenant.primaries[key] = state
+	}
+	return state
+}
+
+// tenant returns the fallback state of the tenant. Must be called with the lock held.
+func (f *ExternalAlertmanagerFallback) tenant(userID string) *tenantAlertmanagerFallback {
+	tenant, ok := f.tenants[userID]
+	if !ok {
+		tenant = &tenantAlertmanagerFallback{
+			primaries: map[string]*primaryAlertmanagerState{},
+			batches:   map[uint64]*fallbackBatch{},
+		}
+		f.tenants[userID] = tenant
+	}
+	return tenant
+}
+
+// shouldTryPrimary returns whether the request should be sent to the primary Alertmanager.
+func (f *ExternalAlertmanagerFallback) shouldTryPrimary(userID string, primaryURL *url.URL, now time.Time) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	state := f.primary(userID, primaryURL)
+	if !state.active {
+		return true
+	}
+
+	if now.Sub(state.lastRetry) >= f.primaryRetryInterval {
+		state.lastRetry = now
+		return true
+	}
+
+	return false
+}
+
+func (f *ExternalAlertmanagerFallback) primarySucceeded(userID string, primaryURL *url.URL) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	state := f.primary(userID, primaryURL)
+	state.failures = 0
+	if state.active {
+		state.active = false
+		f.fallbackActive.WithLabelValues(userID).Dec()
+		level.Info(f.logger).Log("msg", "primary Alertmanager is reachable again, stopped sending notifications to the fallback Alertmanager", "user", userID, "url", primaryURL.Redacted())
+	}
+}
+
+// primaryFailed tracks a failed request to the primary Alertmanager, and returns whether the fallback is active.
+func (f *ExternalAlertmanagerFallback) primaryFailed(userID string, primaryURL *url.URL, err error) bool {
+	f.primaryFailuresTotal.WithLabelValues(userID).Inc()
+	level.Warn(f.logger).Log("msg", "failed to send notifications to the primary Alertmanager", "user", userID, "url", primaryURL.Redacted(), "err", err)
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	state := f.primary(userID, primaryURL)
+	state.failures++
+	if !state.active && state.failures >= f.maxPrimaryFailures {
+		state.active = true
+		state.lastRetry = time.Now()
+		f.fallbackActive.WithLabelValues(userID).Inc()
+		level.Warn(f.logger).Log("msg", "primary Alertmanager is unreachable, sending notifications to the fallback Alertmanager", "user", userID, "url", primaryURL.Redacted(), "consecutive_failures", state.failures, "fallback_url", f.fallbackURL.Redacted())
+	}
+
+	return state.active
+}
+
+// doFallback sends the input request, originally built for a primary Alertmanager, to the fallback one, unless
+// the same batch of notifications has already been sent to the fallback Alertmanager because it failed to be
+// sent to another primary Alertmanager. In the latter case, the result of the request already done is returned.
+func (f *ExternalAlertmanagerFallback) doFallback(ctx context.Context, userID string, req *http.Request, do alertmanagerDoFunc) (*http.Response, error) {
+	var body []byte
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	batch, first := f.startFallbackBatch(userID, xxhash.Sum64(body), time.Now())
+	if !first {
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		return batch.response()
+	}
+
+	batch.resp, batch.err = f.sendToFallback(ctx, req, do)
+	if batch.err == nil {
+		batch.body, batch.err = io.ReadAll(batch.resp.Body)
+		_ = batch.resp.Body.Close()
+	}
+	close(batch.done)
+
+	return batch.response()
+}
+
+// startFallbackBatch returns the batch of notifications with the input hash recently sent to the fallback
+// Alertmanager, or a new one if there is none. Returns true if the batch is new, and so must be sent.
+func (f *ExternalAlertmanagerFallback) startFallbackBatch(userID string, hash uint64, now time.Time) (*fallbackBatch, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	tenant := f.tenant(userID)
+	for h, b := range tenant.batches {
+		if now.After(b.expires) {
+			delete(tenant.batches, h)
+		}
+	}
+
+	if b, ok := tenant.batches[hash]; ok {
+		return b, false
+	}
+
+	b := &fallbackBatch{done: make(chan struct{}), expires: now.Add(fallbackBatchDedupPeriod)}
+	tenant.batches[hash] = b
+	return b, true
+}
+
+func (f *ExternalAlertmanagerFallback) sendToFallback(ctx context.Context, req *http.Request, do alertmanagerDoFunc) (*http.Response, error) {
+	fallbackReq := req.Clone(ctx)
+
+	// The request is built by the Prometheus notifier, which always uses the Alertmanager API v2.
+	fallbackReq.URL = &url.URL{
+		Scheme: f.fallbackURL.Scheme,
+		Host:   f.fallbackURL.Host,
+		Path:   path.Join("/", f.fallbackURL.Path, "/api/v2/alerts"),
+	}
+	fallbackReq.Host = ""
+	fallbackReq.Header.Del("Authorization")
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		fallbackReq.Body = body
+	}
+
+	if f.fallbackURL.User != nil {
+		password, _ := f.fallbackURL.User.Password()
+		fallbackReq.SetBasicAuth(f.fallbackURL.User.Username(), password)
+	}
+
+	return do(ctx, f.fallbackClient, fallbackReq)
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestExternalAlertmanagerFallback(t *testing.T) {
+	primaryUp := atomic.NewBool(false)
+	primaryRequests := atomic.NewInt64(0)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Inc()
+		if !primaryUp.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(primary.Close)
+
+	var (
+		fallbackMtx    sync.Mutex
+		fallbackBodies []string
+	)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		assert.Equal(t, "/prefix/api/v2/alerts", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		fallbackMtx.Lock()
+		fallbackBodies = append(fallbackBodies, string(body))
+		fallbackMtx.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(fallback.Close)
+
+	fallbackURL, err := url.Parse(fallback.URL + "/prefix")
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	f := NewExternalAlertmanagerFallback(fallbackURL, 2, time.Hour, log.NewNopLogger(), reg)
+	do := f.Wrap("user-1", func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		return client.Do(req.WithContext(ctx))
+	})
+
+	send := func(body string) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, primary.URL+"/alertmanager/api/v2/alerts", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Scope-OrgID", "user-1")
+
+		resp, err := do(context.Background(), http.DefaultClient, req)
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	// The first failure doesn't activate the fallback.
+	_, err = send("alert-1")
+	require.Error(t, err)
+	assert.Equal(t, int64(1), primaryRequests.Load())
+	assert.Empty(t, fallbackBodies)
+
+	// The second consecutive failure activates the fallback, and the notifications are sent to it.
+	resp, err := send("alert-2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(2), primaryRequests.Load())
+	assert.Equal(t, []string{"alert-2"}, fallbackBodies)
+
+	// While the fallback is active, the primary Alertmanager is not retried before the retry interval.
+	_, err = send("alert-3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), primaryRequests.Load())
+	assert.Equal(t, []string{"alert-2", "alert-3"}, fallbackBodies)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_alertmanager_fallback_active Number of primary Alertmanagers for which notifications are currently sent to the fallback Alertmanager.
+		# TYPE cortex_ruler_alertmanager_fallback_active gauge
+		cortex_ruler_alertmanager_fallback_active{user="user-1"} 1
+		# HELP cortex_ruler_alertmanager_primary_failures_total Total number of failed requests to the primary Alertmanager.
+		# TYPE cortex_ruler_alertmanager_primary_failures_total counter
+		cortex_ruler_alertmanager_primary_failures_total{user="user-1"} 2
+	`)))
+
+	// Once the retry interval elapsed, the primary Alertmanager is retried and the fallback deactivated.
+	primaryUp.Store(true)
+	f.mtx.Lock()
+	for _, state := range f.tenants["user-1"].primaries {
+		state.lastRetry = time.Now().Add(-2 * time.Hour)
+	}
+	f.mtx.Unlock()
+
+	_, err = send("alert-4")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), primaryRequests.Load())
+	assert.Equal(t, []string{"alert-2", "alert-3"}, fallbackBodies)
+
+	_, err = send("alert-5")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), primaryRequests.Load())
+	assert.Equal(t, []string{"alert-2", "alert-3"}, fallbackBodies)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_alertmanager_fallback_active Number of primary Alertmanagers for which notifications are currently sent to the fallback Alertmanager.
+		# TYPE cortex_ruler_alertmanager_fallback_active gauge
+		cortex_ruler_alertmanager_fallback_active{user="user-1"} 0
+		# HELP cortex_ruler_alertmanager_primary_failures_total Total number of failed requests to the primary Alertmanager.
+		# TYPE cortex_ruler_alertmanager_primary_failures_total counter
+		cortex_ruler_alertmanager_primary_failures_total{user="user-1"} 2
+	`)))
+}
+
+func TestExternalAlertmanagerFallback_ShouldResetFailuresOnPrimarySuccess(t *testing.T) {
+	f := NewExternalAlertmanagerFallback(&url.URL{Scheme: "http", Host: "fallback"}, 2, time.Minute, log.NewNopLogger(), nil)
+	primary := &url.URL{Scheme: "http", Host: "primary"}
+
+	assert.False(t, f.primaryFailed("user-1", primary, assert.AnError))
+	f.primarySucceeded("user-1", primary)
+	assert.False(t, f.primaryFailed("user-1", primary, assert.AnError))
+	assert.True(t, f.primaryFailed("user-1", primary, assert.AnError))
+}
+
+func TestExternalAlertmanagerFallback_ShouldTrackTheStatePerTenantAndPrimaryURL(t *testing.T) {
+	f := NewExternalAlertmanagerFallback(&url.URL{Scheme: "http", Host: "fallback"}, 2, time.Minute, log.NewNopLogger(), nil)
+	primary1 := &url.URL{Scheme: "http", Host: "primary-1"}
+	primary2 := &url.URL{Scheme: "http", Host: "primary-2"}
+
+	assert.False(t, f.primaryFailed("user-1", primary1, assert.AnError))
+	assert.False(t, f.primaryFailed("user-1", primary2, assert.AnError))
+	assert.False(t, f.primaryFailed("user-2", primary1, assert.AnError))
+
+	assert.True(t, f.primaryFailed("user-1", primary1, assert.AnError))
+	assert.False(t, f.shouldTryPrimary("user-1", primary1, time.Now()))
+	assert.True(t, f.shouldTryPrimary("user-1", primary2, time.Now()))
+	assert.True(t, f.shouldTryPrimary("user-2", primary1, time.Now()))
+}
+
+func TestExternalAlertmanagerFallback_ShouldSendEachBatchToTheFallbackOnce(t *testing.T) {
+	primaries := make([]*httptest.Server, 3)
+	for i := range primaries {
+		primaries[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(primaries[i].Close)
+	}
+
+	var (
+		fallbackMtx    sync.Mutex
+		fallbackBodies []string
+	)
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		fallbackMtx.Lock()
+		fallbackBodies = append(fallbackBodies, string(body))
+		fallbackMtx.Unlock()
+
+		// The batches of user-2 are rejected.
+		if r.Header.Get("X-Scope-OrgID") == "user-2" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("rejected " + string(body)))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("accepted " + string(body)))
+	}))
+	t.Cleanup(fallback.Close)
+
+	fallbackURL, err := url.Parse(fallback.URL)
+	require.NoError(t, err)
+
+	f := NewExternalAlertmanagerFallback(fallbackURL, 1, time.Hour, log.NewNopLogger(), nil)
+	do := func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		return client.Do(req.WithContext(ctx))
+	}
+
+	// Send each batch to all the primary Alertmanagers concurrently, like the notifier does. The response
+	// of the fallback Alertmanager is returned for each of them.
+	sendToAll := func(userID, body string, expectedStatus int, expectedBody string) {
+		wg := sync.WaitGroup{}
+		for _, primary := range primaries {
+			wg.Add(1)
+			go func(primaryURL string) {
+				defer wg.Done()
+
+				req, err := http.NewRequest(http.MethodPost, primaryURL+"/alertmanager/api/v2/alerts", bytes.NewBufferString(body))
+				require.NoError(t, err)
+				req.Header.Set("X-Scope-OrgID", userID)
+
+				resp, err := f.Wrap(userID, do)(context.Background(), http.DefaultClient, req)
+				require.NoError(t, err)
+				assert.Equal(t, expectedStatus, resp.StatusCode)
+
+				respBody, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, expectedBody, string(respBody))
+				_ = resp.Body.Close()
+			}(primary.URL)
+		}
+		wg.Wait()
+	}
+
+	sendToAll("user-1", "alert-1", http.StatusOK, "accepted alert-1")
+	sendToAll("user-1", "alert-2", http.StatusOK, "accepted alert-2")
+	sendToAll("user-2", "alert-1", http.StatusBadRequest, "rejected alert-1")
+
+	assert.ElementsMatch(t, []string{"alert-1", "alert-2", "alert-1"}, fallbackBodies)
+}
+
+func TestExternalAlertmanagerFallback_RemoveUser(t *testing.T) {
+	fallbackURL, err := url.Parse("http://fallback")
+	require.NoError(t, err)
+	primaryURL, err := url.Parse("http://primary")
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	f := NewExternalAlertmanagerFallback(fallbackURL, 1, time.Hour, log.NewNopLogger(), reg)
+
+	require.True(t, f.primaryFailed("user-1", primaryURL, errors.New("unreachable")))
+	require.True(t, f.primaryFailed("user-2", primaryURL, errors.New("unreachable")))
+
+	f.RemoveUser("user-1")
+
+	assert.NotContains(t, f.tenants, "user-1")
+	assert.Contains(t, f.tenants, "user-2")
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_alertmanager_fallback_active Number of primary Alertmanagers for which notifications are currently sent to the fallback Alertmanager.
+		# TYPE cortex_ruler_alertmanager_fallback_active gauge
+		cortex_ruler_alertmanager_fallback_active{user="user-2"} 1
+
+		# HELP cortex_ruler_alertmanager_primary_failures_total Total number of failed requests to the primary Alertmanager.
+		# TYPE cortex_ruler_alertmanager_primary_failures_total counter
+		cortex_ruler_alertmanager_primary_failures_total{user="user-2"} 1
+	`)))
+}
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/template"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/ruler/rulespb"
+)
+
+// parsedAnnotationTemplates holds the alert annotation template snippets of a tenant, pre-parsed.
+type parsedAnnotationTemplates struct {
+	// snippets is a copy of the snippets the templates have been built from.
+	snippets map[string]string
+
+	// references holds, for each snippet, the names of the other snippets it references.
+	references map[string][]string
+
+	// err is the error returned parsing the snippets, if any.
+	err error
+
+	// expanded caches, for each annotation value seen by the current and the previous apply, the value
+	// to pass to the alerting rule. Values are only kept as long as they're used by a rule, so the cache
+	// doesn't grow with the changes of the rule groups.
+	expanded, previous map[string]expandedAnnotation
+}
+
+type expandedAnnotation struct {
+	value string
+	ok    bool
+}
+
+func newParsedAnnotationTemplates(snippets map[string]string) *parsedAnnotationTemplates {
+	p := &parsedAnnotationTemplates{
+		snippets:   make(map[string]string, len(snippets)),
+		references: make(map[string][]string, len(snippets)),
+		expanded:   map[string]expandedAnnotation{},
+	}
+
+	names := make([]string, 0, len(snippets))
+	for name, text := range snippets {
+		names = append(names, name)
+		p.snippets[name] = text
+	}
+
+	// Parse the snippets with the same functions available when expanding the annotations.
+	expander := template.NewTemplateExpander(context.Background(), p.definitions(names), "alert_annotation_templates", nil, 0, nil, nil, nil)
+	if p.err = expander.ParseTest(); p.err != nil {
+		return p
+	}
+
+	for name, text := range p.snippets {
+		refs, err := templateReferences(text)
+		if err != nil {
+			p.err = err
+			return p
+		}
+		p.references[name] = refs
+	}
+
+	return p
+}
+
+// equal returns whether the snippets the templates have been built from are equal to the input ones.
+func (p *parsedAnnotationTemplates) equal(snippets map[string]string) bool {
+	if len(p.snippets) != len(snippets) {
+		return false
+	}
+	for name, text := range snippets {
+		if existing, ok := p.snippets[name]; !ok || existing != text {
+			return false
+		}
+	}
+	return true
+}
+
+// definitions returns the template text defining the input snippets, sorted by name.
+func (p *parsedAnnotationTemplates) definitions(names []string) string {
+	sort.Strings(names)
+
+	sb := strings.Builder{}
+	for _, name := range names {
+		sb.WriteString(`{{define ` + strconv.Quote(name) + `}}`)
+		sb.WriteString(p.snippets[name])
+		sb.WriteString(`{{end}}`)
+	}
+	return sb.String()
+}
+
+// rotate starts a new apply: the annotation values expanded by the previous one are still reused, but the
+// ones not expanded again are dropped by the next rotate.
+func (p *parsedAnnotationTemplates) rotate() {
+	p.previous = p.expanded
+	p.expanded = make(map[string]expandedAnnotation, len(p.previous))
+}
+
+// expand returns the input annotation value preceded by the definitions of the snippets it references,
+// either directly or through other snippets. The definitions are prepended to the annotation, so that the
+// snippets can be executed by name: the alerting rules build a new template expander from the annotation
+// text at each evaluation, and there's no way to pass additional templates to it.
+//
+// The annotation is parsed once, when the rule group is loaded, and the result is cached until the snippets
+// change. The input annotation value is returned as is if it doesn't reference any snippet, or the expanded
+// value can't be parsed.
+func (p *parsedAnnotationTemplates) expand(value string) (string, bool) {
+	if e, ok := p.expanded[value]; ok {
+		return e.value, e.ok
+	}
+	e, ok := p.previous[value]
+	if !ok {
+		e.value, e.ok = p.doExpand(value)
+	}
+	p.expanded[value] = e
+	return e.value, e.ok
+}
+
+func (p *parsedAnnotationTemplates) doExpand(value string) (string, bool) {
+	refs, err := templateReferences(value)
+	if err != nil {
+		// The error will be reported when the alerting rule is evaluated.
+		return value, false
+	}
+
+	referenced := map[string]struct{}{}
+	for len(refs) > 0 {
+		name := refs[len(refs)-1]
+		refs = refs[:len(refs)-1]
+
+		if _, ok := referenced[name]; ok {
+			continue
+		}
+		if _, ok := p.snippets[name]; !ok {
+			continue
+		}
+		referenced[name] = struct{}{}
+		refs = append(refs, p.references[name]...)
+	}
+
+	if len(referenced) == 0 {
+		return value, false
+	}
+
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	expanded := p.definitions(names) + value
+
+	// Make sure the expanded annotation can be parsed, otherwise leave it as is so that the rule evaluation
+	// reports the error against the annotation as written by the user.
+	expander := template.NewTemplateExpander(context.Background(), expanded, "alert_annotation", nil, 0, nil, nil, nil)
+	if err := expander.ParseTest(); err != nil {
+		return value, false
+	}
+	return expanded, true
+}
+
+// templateReferences returns the names of the templates executed by the input template text, excluding
+// the ones defined by the text itself.
+func templateReferences(text string) ([]string, error) {
+	root := parse.New("")
+	// The functions are checked when the template is expanded, here we're only interested in its structure.
+	root.Mode = parse.SkipFuncCheck
+
+	trees := map[string]*parse.Tree{}
+	if _, err := root.Parse(text, "", "", trees); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	collect := func(name string) {
+		if tree, ok := trees[name]; !ok || tree == root {
+			refs = append(refs, name)
+		}
+	}
+
+	walkTemplateNodes(root.Root, collect)
+	for _, tree := range trees {
+		if tree != root {
+			walkTemplateNodes(tree.Root, collect)
+		}
+	}
+	return refs, nil
+}
+
+// walkTemplateNodes calls fn with the name of each template executed within the input node.
+func walkTemplateNodes(node parse.Node, fn func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNodes(child, fn)
+		}
+	case *parse.TemplateNode:
+		fn(n.Name)
+	case *parse.IfNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	case *parse.WithNode:
+		walkTemplateNodes(n.List, fn)
+		walkTemplateNodes(n.ElseList, fn)
+	}
+}
+
+// annotationTemplates makes the per-tenant alert annotation template snippets available to the tenant
+// alerting rules. The snippets, and the annotations referencing them, are parsed when the rule groups are
+// loaded and cached until the snippets change.
+type annotationTemplates struct {
+	logger log.Logger
+
+	mtx    sync.Mutex
+	byUser map[string]*parsedAnnotationTemplates
+
+	// injected maps, for each user, the annotation values expanded by the last apply to the original ones.
+	injected map[string]map[string]string
+}
+
+func newAnnotationTemplates(logger log.Logger) *annotationTemplates {
+	return &annotationTemplates{
+		logger:   logger,
+		byUser:   map[string]*parsedAnnotationTemplates{},
+		injected: map[string]map[string]string{},
+	}
+}
+
+// get returns the parsed snippets of the input user, parsing them only if they've changed since the last call.
+func (a *annotationTemplates) get(userID string, snippets map[string]string) *parsedAnnotationTemplates {
+	if p, ok := a.byUser[userID]; ok && p.equal(snippets) {
+		return p
+	}
+
+	p := newParsedAnnotationTemplates(snippets)
+	if p.err != nil {
+		level.Warn(a.logger).Log("msg", "failed to parse alert annotation templates, the templates will not be available to alerting rules", "user", userID, "err", p.err)
+	}
+
+	a.byUser[userID] = p
+	return p
+}
+
+// strip returns the input annotations of an alerting rule of the user without the snippets definitions
+// prepended by apply, so that they're not exposed by the rules API.
+func (a *annotationTemplates) strip(userID string, annotations labels.Labels) labels.Labels {
+	a.mtx.Lock()
+	injected := a.injected[userID]
+	a.mtx.Unlock()
+
+	if len(injected) == 0 {
+		return annotations
+	}
+
+	var stripped labels.Labels
+	for idx, ann := range annotations {
+		value, ok := injected[ann.Value]
+		if !ok {
+			continue
+		}
+
+		if stripped == nil {
+			stripped = append(labels.Labels(nil), annotations...)
+		}
+		stripped[idx].Value = value
+	}
+
+	if stripped == nil {
+		return annotations
+	}
+	return stripped
+}
+
+// apply returns the input configs where the annotations of the alerting rules referencing a tenant's template
+// snippet are preceded by the snippets definitions.
+//
+// This function doesn't modify the input configs in place, in order to not alter the rule groups as stored.
+func (a *annotationTemplates) apply(configs map[string]rulespb.RuleGroupList, limits RulesLimits) map[string]rulespb.RuleGroupList {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	result := make(map[string]rulespb.RuleGroupList, len(configs))
+	injected := make(map[string]map[string]string, len(configs))
+
+	for userID, groups := range configs {
+		snippets := limits.AlertAnnotationTemplates(userID)
+		if len(snippets) == 0 {
+			result[userID] = groups
+			continue
+		}
+
+		p := a.get(userID, snippets)
+		if p.err != nil {
+			result[userID] = groups
+			continue
+		}
+
+		p.rotate()
+		userInjected := map[string]string{}
+		result[userID] = make(rulespb.RuleGroupList, 0, len(groups))
+		for _, group := range groups {
+			result[userID] = append(result[userID], applyAnnotationTemplatesToGroup(group, p, userInjected))
+		}
+		if len(userInjected) > 0 {
+			injected[userID] = userInjected
+		}
+	}
+
+	a.injected = injected
+
+	// Remove the users which don't have any template anymore.
+	for userID := range a.byUser {
+		if _, ok := configs[userID]; !ok || len(limits.AlertAnnotationTemplates(userID)) == 0 {
+			delete(a.byUser, userID)
+		}
+	}
+
+	return result
+}
+
+// applyAnnotationTemplatesToGroup returns a copy of the input group with the templates applied, or the
+// input group itself if no annotation references a template snippet. Each expanded annotation value is
+// recorded in injected, mapped to the original value.
+func applyAnnotationTemplatesToGroup(group *rulespb.RuleGroupDesc, p *parsedAnnotationTemplates, injected map[string]string) *rulespb.RuleGroupDesc {
+	var rules []*rulespb.RuleDesc
+
+	for idx, rule := range group.Rules {
+		if rule.Alert == "" {
+			continue
+		}
+
+		var annotations []mimirpb.LabelAdapter
+		for annIdx, ann := range rule.Annotations {
+			value, ok := p.expand(ann.Value)
+			if !ok {
+				continue
+			}
+
+			if annotations == nil {
+				annotations = append([]mimirpb.LabelAdapter(nil), rule.Annotations...)
+			}
+			annotations[annIdx].Value = value
+			injected[value] = ann.Value
+		}
+
+		if annotations == nil {
+			continue
+		}
+
+		if rules == nil {
+			rules = append([]*rulespb.RuleDesc(nil), group.Rules...)
+		}
+
+		copied := *rule
+		copied.Annotations = annotations
+		rules[idx] = &copied
+	}
+
+	if rules == nil {
+		return group
+	}
+
+	copied := *group
+	copied.Rules = rules
+	return &copied
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/ruler/rulespb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestAnnotationTemplates_Apply(t *testing.T) {
+	withAnnotations := func(rule *rulespb.RuleDesc, annotations ...string) *rulespb.RuleDesc {
+		for i := 0; i < len(annotations); i += 2 {
+			rule.Annotations = append(rule.Annotations, mimirpb.LabelAdapter{Name: annotations[i], Value: annotations[i+1]})
+		}
+		return rule
+	}
+
+	newConfigs := func() map[string]rulespb.RuleGroupList {
+		return map[string]rulespb.RuleGroupList{
+			"user-1": {
+				mockRuleGroup("group-1", "user-1",
+					withAnnotations(mockAlertingRuleDesc("alert-1", "up == 0"), "description", `see {{ template "runbook_link" . }}`, "runbook_url", `{{ template "runbook" . }}`, "summary", "instance is down"),
+					mockRecordingRuleDesc("record:1", "sum(up)"),
+				),
+				mockRuleGroup("group-2", "user-1",
+					// Mentioning a snippet name is not a reference to the snippet.
+					withAnnotations(mockAlertingRuleDesc("alert-2", "up == 0"), "summary", `instance is down, check the "runbook"`),
+				),
+			},
+			"user-2": {
+				mockRuleGroup("group-1", "user-2",
+					withAnnotations(mockAlertingRuleDesc("alert-1", "up == 0"), "runbook_url", `{{ template "runbook" . }}`),
+				),
+			},
+			"user-3": {
+				mockRuleGroup("group-1", "user-3",
+					withAnnotations(mockAlertingRuleDesc("alert-1", "up == 0"), "runbook_url", `{{ template "runbook" . }}`),
+				),
+			},
+		}
+	}
+
+	limits := validation.MockOverrides(func(defaults *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits["user-1"] = validation.MockDefaultLimits()
+		tenantLimits["user-1"].AlertAnnotationTemplates = map[string]string{
+			"runbook":      `https://runbooks.example.com/{{ .Labels.alertname }}`,
+			"runbook_link": `<a href="{{ template "runbook" . }}">runbook</a>`,
+			"team":         `{{ .Labels.team }}`,
+		}
+
+		// Invalid snippet.
+		tenantLimits["user-2"] = validation.MockDefaultLimits()
+		tenantLimits["user-2"].AlertAnnotationTemplates = map[string]string{
+			"runbook": `{{ .Labels.alertname `,
+		}
+	})
+
+	a := newAnnotationTemplates(log.NewNopLogger())
+	input := newConfigs()
+	actual := a.apply(input, limits)
+
+	// The input configs should not be modified.
+	assert.Equal(t, newConfigs(), input)
+
+	// The annotations referencing a snippet should be preceded by the definitions of the snippets they reference,
+	// directly or through other snippets.
+	expected := newConfigs()
+	expected["user-1"][0].Rules[0].Annotations[0].Value = `{{define "runbook"}}https://runbooks.example.com/{{ .Labels.alertname }}{{end}}` +
+		`{{define "runbook_link"}}<a href="{{ template "runbook" . }}">runbook</a>{{end}}see {{ template "runbook_link" . }}`
+	expected["user-1"][0].Rules[0].Annotations[1].Value = `{{define "runbook"}}https://runbooks.example.com/{{ .Labels.alertname }}{{end}}{{ template "runbook" . }}`
+	assert.Equal(t, expected, actual)
+
+	// The rule groups not referencing any snippet should not be copied.
+	assert.Same(t, input["user-1"][1], actual["user-1"][1])
+
+	// The expanded annotation should include the snippet.
+	expander := template.NewTemplateExpander(context.Background(), actual["user-1"][0].Rules[0].Annotations[0].Value, "description",
+		template.AlertTemplateData(map[string]string{"alertname": "alert-1"}, nil, "", 0), 0, nil, nil, nil)
+	value, err := expander.Expand()
+	require.NoError(t, err)
+	assert.Equal(t, `see <a href="https://runbooks.example.com/alert-1">runbook</a>`, value)
+
+	// The snippets definitions should be stripped from the annotations exposed by the rules API.
+	exposed := mimirpb.FromLabelAdaptersToLabels(actual["user-1"][0].Rules[0].Annotations)
+	assert.Equal(t, labels.FromStrings("description", `see {{ template "runbook_link" . }}`, "runbook_url", `{{ template "runbook" . }}`, "summary", "instance is down"), a.strip("user-1", exposed))
+	assert.Equal(t, exposed, a.strip("user-3", exposed))
+
+	// The parsed snippets should be cached until they change.
+	cached := a.byUser["user-1"]
+	require.NotNil(t, cached)
+	require.NoError(t, cached.err)
+	require.Error(t, a.byUser["user-2"].err)
+	assert.NotContains(t, a.byUser, "user-3")
+
+	a.apply(newConfigs(), limits)
+	assert.Same(t, cached, a.byUser["user-1"])
+
+	// The expanded annotations should be cached as long as they're used by a rule.
+	assert.Contains(t, cached.expanded, `see {{ template "runbook_link" . }}`)
+	assert.Contains(t, cached.expanded, "instance is down")
+
+	a.apply(map[string]rulespb.RuleGroupList{"user-1": newConfigs()["user-1"][1:]}, limits)
+	assert.Same(t, cached, a.byUser["user-1"])
+	assert.NotContains(t, cached.expanded, `see {{ template "runbook_link" . }}`)
+	assert.Contains(t, cached.previous, `see {{ template "runbook_link" . }}`)
+
+	// The cached snippets should be removed once the user has no rule groups.
+	a.apply(map[string]rulespb.RuleGroupList{}, limits)
+	assert.Empty(t, a.byUser)
+	assert.Empty(t, a.injected)
+}
+
+func TestTemplateReferences(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		expected []string
+	}{
+		"no reference": {
+			text: `instance {{ .Labels.instance }} is down, check the "runbook"`,
+		},
+		"reference": {
+			text:     `{{ template "runbook" . }}`,
+			expected: []string{"runbook"},
+		},
+		"references within branches": {
+			text:     `{{ if .Labels.team }}{{ template "team" . }}{{ else }}{{ range .Labels }}{{ template "label" . }}{{ end }}{{ end }}`,
+			expected: []string{"team", "label"},
+		},
+		"reference to a template defined by the text itself": {
+			text:     `{{ define "local" }}{{ template "runbook" . }}{{ end }}{{ template "local" . }}`,
+			expected: []string{"runbook"},
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := templateReferences(testData.text)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, testData.expected, actual)
+		})
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/grafana/mimir/pkg/querier"
 	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
 	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 // Pusher is an ingester server that accepts pushes.
@@ -122,6 +123,8 @@ type RulesLimits interface {
 	RulerMaxRulesPerRuleGroup(userID string) int
 	RulerRecordingRulesEvaluationEnabled(userID string) bool
 	RulerAlertingRulesEvaluationEnabled(userID string) bool
+	AlertAnnotationTemplates(userID string) map[string]string
+	RulerAlertLabelNormalization(userID string) []validation.AlertLabelNormalizationRule
 }
 
 func MetricsQueryFunc(qf rules.QueryFunc, queries, failedQueries prometheus.Counter) rules.QueryFunc {
@@ -265,14 +268,25 @@ func DefaultTenantManagerFactory(
 		wrappedQueryFunc = MetricsQueryFunc(queryFunc, totalQueries, failedQueries)
 		wrappedQueryFunc = RecordAndReportRuleQueryMetrics(wrappedQueryFunc, queryTime, logger)
 
+		notifyFunc := SendAlerts(notifier, cfg.ExternalURL.String())
+		groupContextFunc := FederatedGroupContextFunc
+		if cfg.AlertSourceLabelsEnabled {
+			tracer := NewAlertSourceTracer(userID)
+			notifyFunc = tracer.WrapNotifyFunc(notifyFunc)
+			groupContextFunc = tracer.WrapGroupContextFunc(groupContextFunc)
+		}
+
+		// Normalize the alert labels before the alert source labels are injected.
+		notifyFunc = NewAlertNormalization(userID, overrides).WrapNotifyFunc(notifyFunc)
+
 		return rules.NewManager(&rules.ManagerOptions{
 			Appendable:                 NewPusherAppendable(p, userID, overrides, totalWrites, failedWrites),
 			Queryable:                  embeddedQueryable,
 			QueryFunc:                  wrappedQueryFunc,
 			Context:                    user.InjectOrgID(ctx, userID),
-			GroupEvaluationContextFunc: FederatedGroupContextFunc,
+			GroupEvaluationContextFunc: groupContextFunc,
 			ExternalURL:                cfg.ExternalURL.URL,
-			NotifyFunc:                 SendAlerts(notifier, cfg.ExternalURL.String()),
+			NotifyFunc:                 notifyFunc,
 			Logger:                     log.With(logger, "user", userID),
 			Registerer:                 reg,
 			OutageTolerance:            cfg.OutageTolerance,
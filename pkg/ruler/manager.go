@@ -46,6 +46,9 @@ type DefaultMultiTenantManager struct {
 	notifiersMtx sync.Mutex
 	notifiers    map[string]*rulerNotifier
 
+	// Optional fallback for the notifications which fail to be sent to the Alertmanager.
+	alertmanagerFallback *ExternalAlertmanagerFallback
+
 	managersTotal                 prometheus.Gauge
 	lastReloadSuccessful          *prometheus.GaugeVec
 	lastReloadSuccessfulTimestamp *prometheus.GaugeVec
@@ -65,14 +68,20 @@ func NewDefaultMultiTenantManager(cfg Config, managerFactory ManagerFactory, reg
 		reg.MustRegister(userManagerMetrics)
 	}
 
+	var alertmanagerFallback *ExternalAlertmanagerFallback
+	if u := cfg.AlertmanagerFallbackURL.URL; u != nil && u.String() != "" {
+		alertmanagerFallback = NewExternalAlertmanagerFallback(u, cfg.AlertmanagerFallbackAfterFailures, cfg.AlertmanagerFallbackPrimaryRetryInterval, logger, reg)
+	}
+
 	return &DefaultMultiTenantManager{
-		cfg:                cfg,
-		notifierCfg:        ncfg,
-		managerFactory:     managerFactory,
-		notifiers:          map[string]*rulerNotifier{},
-		mapper:             newMapper(cfg.RulePath, logger),
-		userManagers:       map[string]RulesManager{},
-		userManagerMetrics: userManagerMetrics,
+		cfg:                  cfg,
+		notifierCfg:          ncfg,
+		managerFactory:       managerFactory,
+		notifiers:            map[string]*rulerNotifier{},
+		mapper:               newMapper(cfg.RulePath, logger),
+		userManagers:         map[string]RulesManager{},
+		userManagerMetrics:   userManagerMetrics,
+		alertmanagerFallback: alertmanagerFallback,
 		managersTotal: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 			Namespace: "cortex",
 			Name:      "ruler_managers_total",
@@ -98,6 +107,12 @@ func NewDefaultMultiTenantManager(cfg Config, managerFactory ManagerFactory, reg
 	}, nil
 }
 
+// RulesManagersMetrics returns the collector of the metrics exported by the per-tenant rules managers.
+// All metrics have the "user" label.
+func (r *DefaultMultiTenantManager) RulesManagersMetrics() prometheus.Collector {
+	return r.userManagerMetrics
+}
+
 // SyncRuleGroups sync the input rulesGroups.
 // It's not safe to call this function concurrently.
 func (r *DefaultMultiTenantManager) SyncRuleGroups(ctx context.Context, ruleGroups map[string]rulespb.RuleGroupList) {
@@ -123,6 +138,9 @@ func (r *DefaultMultiTenantManager) SyncRuleGroups(ctx context.Context, ruleGrou
 			r.lastReloadSuccessfulTimestamp.DeleteLabelValues(userID)
 			r.configUpdatesTotal.DeleteLabelValues(userID)
 			r.userManagerMetrics.RemoveUserRegistry(userID)
+			if r.alertmanagerFallback != nil {
+				r.alertmanagerFallback.RemoveUser(userID)
+			}
 			level.Info(r.logger).Log("msg", "deleted rule manager and local rule files", "user", userID)
 		}
 	}
@@ -232,24 +250,29 @@ func (r *DefaultMultiTenantManager) getOrCreateNotifier(userID string) (*notifie
 
 	reg := prometheus.WrapRegistererWith(prometheus.Labels{"user": userID}, r.registry)
 	reg = prometheus.WrapRegistererWithPrefix("cortex_", reg)
+	var do alertmanagerDoFunc = func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		// Note: The passed-in context comes from the Prometheus notifier
+		// and does *not* contain the userID. So it needs to be added to the context
+		// here before using the context to inject the userID into the HTTP request.
+		ctx = user.InjectOrgID(ctx, userID)
+		if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		// Jaeger complains the passed-in context has an invalid span ID, so start a new root span
+		sp := ot.GlobalTracer().StartSpan("notify", ot.Tag{Key: "organization", Value: userID})
+		defer sp.Finish()
+		ctx = ot.ContextWithSpan(ctx, sp)
+		_ = ot.GlobalTracer().Inject(sp.Context(), ot.HTTPHeaders, ot.HTTPHeadersCarrier(req.Header))
+		return ctxhttp.Do(ctx, client, req)
+	}
+	if r.alertmanagerFallback != nil {
+		do = r.alertmanagerFallback.Wrap(userID, do)
+	}
+
 	n = newRulerNotifier(&notifier.Options{
 		QueueCapacity: r.cfg.NotificationQueueCapacity,
 		Registerer:    reg,
-		Do: func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
-			// Note: The passed-in context comes from the Prometheus notifier
-			// and does *not* contain the userID. So it needs to be added to the context
-			// here before using the context to inject the userID into the HTTP request.
-			ctx = user.InjectOrgID(ctx, userID)
-			if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
-				return nil, err
-			}
-			// Jaeger complains the passed-in context has an invalid span ID, so start a new root span
-			sp := ot.GlobalTracer().StartSpan("notify", ot.Tag{Key: "organization", Value: userID})
-			defer sp.Finish()
-			ctx = ot.ContextWithSpan(ctx, sp)
-			_ = ot.GlobalTracer().Inject(sp.Context(), ot.HTTPHeaders, ot.HTTPHeadersCarrier(req.Header))
-			return ctxhttp.Do(ctx, client, req)
-		},
+		Do:            do,
 	}, log.With(r.logger, "user", userID))
 
 	n.run()
@@ -274,6 +297,12 @@ func (r *DefaultMultiTenantManager) GetRules(userID string) []*promRules.Group {
 	return nil
 }
 
+// GetRuleGroupsLastEvaluationSamples returns the number of samples returned during the last evaluation
+// of each rule group of the input tenant, by rule group key.
+func (r *DefaultMultiTenantManager) GetRuleGroupsLastEvaluationSamples(userID string) (map[string]float64, error) {
+	return r.userManagerMetrics.LastEvaluationSamples(userID)
+}
+
 func (r *DefaultMultiTenantManager) Stop() {
 	r.notifiersMtx.Lock()
 	for _, n := range r.notifiers {
@@ -113,6 +113,25 @@ func (m *ManagerMetrics) RemoveUserRegistry(user string) {
 	m.regs.RemoveUserRegistry(user, true)
 }
 
+// LastEvaluationSamples returns the number of samples returned during the last evaluation of each
+// rule group of the input user, by rule group key.
+func (m *ManagerMetrics) LastEvaluationSamples(user string) (map[string]float64, error) {
+	mfm, err := m.regs.GatherUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := map[string]float64{}
+	for _, metric := range mfm["prometheus_rule_group_last_evaluation_samples"].GetMetric() {
+		for _, l := range metric.GetLabel() {
+			if l.GetName() == "rule_group" {
+				samples[l.GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return samples, nil
+}
+
 // Describe implements the Collector interface
 func (m *ManagerMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.EvalDuration
@@ -139,6 +139,20 @@ cortex_prometheus_rule_group_rules{rule_group="group_two",user="user3"} 100000
 	require.NoError(t, err)
 }
 
+func TestManagerMetrics_LastEvaluationSamples(t *testing.T) {
+	managerMetrics := NewManagerMetrics()
+	managerMetrics.AddUserRegistry("user1", populateManager(1))
+	managerMetrics.AddUserRegistry("user2", populateManager(10))
+
+	samples, err := managerMetrics.LastEvaluationSamples("user2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"group_one": 10000, "group_two": 10000}, samples)
+
+	samples, err = managerMetrics.LastEvaluationSamples("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
 func populateManager(base float64) *prometheus.Registry {
 	r := prometheus.NewRegistry()
 
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/ruler/rulespb"
+	"github.com/grafana/mimir/pkg/util"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+var (
+	errImportBadResponse      = errors.New("the request body must be a successful Prometheus /api/v1/rules response")
+	errImportMissingNamespace = errors.New("unable to infer the namespace of the rule group from its file, the namespace parameter is required")
+)
+
+// prometheusRulesResponse is the subset of the Prometheus /api/v1/rules response needed to import the rule groups.
+type prometheusRulesResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Groups []prometheusRuleGroup `json:"groups"`
+	} `json:"data"`
+}
+
+type prometheusRuleGroup struct {
+	Name     string           `json:"name"`
+	File     string           `json:"file"`
+	Rules    []prometheusRule `json:"rules"`
+	Interval float64          `json:"interval"`
+	Limit    int              `json:"limit"`
+}
+
+type prometheusRule struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Query       string            `json:"query"`
+	Duration    float64           `json:"duration"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// importedRuleGroup identifies a rule group in the response of RuleGroupImportFromPrometheus.
+type importedRuleGroup struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type importRuleGroupsResponse struct {
+	Imported []importedRuleGroup `json:"imported"`
+	Skipped  []importedRuleGroup `json:"skipped"`
+}
+
+// RuleGroupImportFromPrometheus imports the rule groups of a Prometheus /api/v1/rules response, passed as the
+// request body, for the tenant. The namespace of each rule group is the base name of the rule file it has been
+// loaded from in Prometheus, without the extension, unless the namespace parameter is set. The rule groups which
+// already exist in the tenant, or are repeated in the request, are skipped. The imported and skipped rule groups
+// are returned as JSON.
+//
+// All the rule groups are validated before storing any of them, so an invalid request imports nothing.
+// If storing a rule group fails, the rule groups already stored by the request are deleted.
+func (a *API) RuleGroupImportFromPrometheus(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), a.logger)
+
+	userID, err := tenant.TenantID(req.Context())
+	if err != nil {
+		// Auth Middleware sends http.StatusUnauthorized if X-Scope-OrgID is missing, so we do too here, for consistency.
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var promResp prometheusRulesResponse
+	if err := json.NewDecoder(req.Body).Decode(&promResp); err != nil || promResp.Status != "success" {
+		http.Error(w, errImportBadResponse.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger = log.With(logger, "user", userID)
+
+	resp, status, err := a.importRuleGroups(req.Context(), logger, userID, req.FormValue("namespace"), promResp.Data.Groups)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to import rule groups from Prometheus", "err", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	level.Info(logger).Log("msg", "imported rule groups from Prometheus", "imported", len(resp.Imported), "skipped", len(resp.Skipped))
+	util.WriteJSONResponse(w, resp)
+}
+
+// importRuleGroups stores the input rule groups and, on failure, returns the HTTP status code to respond with.
+func (a *API) importRuleGroups(ctx context.Context, logger log.Logger, userID, namespace string, groups []prometheusRuleGroup) (importRuleGroupsResponse, int, error) {
+	existing, err := a.store.ListRuleGroupsForUserAndNamespace(ctx, userID, "")
+	if err != nil {
+		return importRuleGroupsResponse{}, http.StatusInternalServerError, errors.Wrap(err, "failed to list the rule groups of the tenant")
+	}
+
+	seen := make(map[importedRuleGroup]struct{}, len(existing)+len(groups))
+	for _, rg := range existing {
+		seen[importedRuleGroup{Namespace: rg.Namespace, Name: rg.Name}] = struct{}{}
+	}
+
+	resp := importRuleGroupsResponse{Imported: []importedRuleGroup{}, Skipped: []importedRuleGroup{}}
+	var toStore []*rulespb.RuleGroupDesc
+
+	for _, group := range groups {
+		groupNamespace := namespace
+		if groupNamespace == "" {
+			groupNamespace = namespaceFromRuleFile(group.File)
+		}
+		if groupNamespace == "" {
+			return importRuleGroupsResponse{}, http.StatusBadRequest, errImportMissingNamespace
+		}
+
+		id := importedRuleGroup{Namespace: groupNamespace, Name: group.Name}
+		if _, ok := seen[id]; ok {
+			level.Warn(logger).Log("msg", "skipped importing rule group from Prometheus because it already exists", "namespace", id.Namespace, "group", id.Name)
+			resp.Skipped = append(resp.Skipped, id)
+			continue
+		}
+		seen[id] = struct{}{}
+
+		rg, err := ruleGroupFromPrometheus(group)
+		if err != nil {
+			return importRuleGroupsResponse{}, http.StatusBadRequest, errors.Wrapf(err, "rule group %s/%s", id.Namespace, id.Name)
+		}
+		if errs := a.ruler.manager.ValidateRuleGroup(rg); len(errs) > 0 {
+			return importRuleGroupsResponse{}, http.StatusBadRequest, errors.Wrapf(errs[0], "rule group %s/%s", id.Namespace, id.Name)
+		}
+		if err := a.ruler.AssertMaxRulesPerRuleGroup(userID, len(rg.Rules)); err != nil {
+			return importRuleGroupsResponse{}, http.StatusBadRequest, errors.Wrapf(err, "rule group %s/%s", id.Namespace, id.Name)
+		}
+
+		toStore = append(toStore, rulespb.ToProto(userID, groupNamespace, rg))
+		resp.Imported = append(resp.Imported, id)
+	}
+
+	if err := a.ruler.AssertMaxRuleGroups(userID, len(existing)+len(toStore)); err != nil {
+		return importRuleGroupsResponse{}, http.StatusBadRequest, err
+	}
+
+	for i, rg := range toStore {
+		if err := a.store.SetRuleGroup(ctx, userID, rg.Namespace, rg); err != nil {
+			a.deleteImportedRuleGroups(ctx, logger, userID, toStore[:i])
+			return importRuleGroupsResponse{}, http.StatusInternalServerError, errors.Wrapf(err, "failed to store the rule group %s/%s", rg.Namespace, rg.Name)
+		}
+	}
+
+	return resp, http.StatusOK, nil
+}
+
+// deleteImportedRuleGroups deletes the rule groups stored by a failed import, so that the import
+// is not partially applied. Failures are logged, because the import has already failed.
+func (a *API) deleteImportedRuleGroups(ctx context.Context, logger log.Logger, userID string, groups []*rulespb.RuleGroupDesc) {
+	for _, rg := range groups {
+		if err := a.store.DeleteRuleGroup(ctx, userID, rg.Namespace, rg.Name); err != nil {
+			level.Error(logger).Log("msg", "failed to delete the rule group stored by a failed import from Prometheus", "namespace", rg.Namespace, "group", rg.Name, "err", err)
+		}
+	}
+}
+
+// ruleGroupFromPrometheus converts a rule group of the Prometheus /api/v1/rules response to the rule group format.
+func ruleGroupFromPrometheus(group prometheusRuleGroup) (rulefmt.RuleGroup, error) {
+	rg := rulefmt.RuleGroup{
+		Name:     group.Name,
+		Interval: model.Duration(secondsToDuration(group.Interval)),
+		Limit:    group.Limit,
+		Rules:    make([]rulefmt.RuleNode, 0, len(group.Rules)),
+	}
+
+	for _, rule := range group.Rules {
+		node := rulefmt.RuleNode{
+			Expr:   yaml.Node{Kind: yaml.ScalarNode, Value: rule.Query},
+			Labels: rule.Labels,
+		}
+
+		switch rule.Type {
+		case "alerting":
+			node.Alert = yaml.Node{Kind: yaml.ScalarNode, Value: rule.Name}
+			node.For = model.Duration(secondsToDuration(rule.Duration))
+			node.Annotations = rule.Annotations
+		case "recording":
+			node.Record = yaml.Node{Kind: yaml.ScalarNode, Value: rule.Name}
+		default:
+			return rulefmt.RuleGroup{}, fmt.Errorf("unknown type %q of rule %s", rule.Type, rule.Name)
+		}
+
+		rg.Rules = append(rg.Rules, node)
+	}
+
+	return rg, nil
+}
+
+// namespaceFromRuleFile returns the base name of the Prometheus rule file, without the extension.
+func namespaceFromRuleFile(file string) string {
+	base := filepath.Base(file)
+	if base == "." || base == string(filepath.Separator) {
+		return ""
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
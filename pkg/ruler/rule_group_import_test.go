@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/weaveworks/common/user"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/ruler/rulespb"
+	"github.com/grafana/mimir/pkg/ruler/rulestore"
+	"github.com/grafana/mimir/pkg/ruler/rulestore/bucketclient"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const prometheusRulesResponseBody = `{
+  "status": "success",
+  "data": {
+    "groups": [
+      {
+        "name": "recording",
+        "file": "/etc/prometheus/rules/node.yml",
+        "interval": 30,
+        "rules": [
+          {"type": "recording", "name": "instance:up:sum", "query": "sum by (instance) (up)", "labels": {"source": "prometheus"}, "health": "ok"}
+        ]
+      },
+      {
+        "name": "alerting",
+        "file": "/etc/prometheus/rules/node.yml",
+        "interval": 60,
+        "rules": [
+          {"type": "alerting", "name": "InstanceDown", "query": "up == 0", "duration": 300, "labels": {"severity": "critical"}, "annotations": {"summary": "Instance down"}, "alerts": [], "state": "inactive", "health": "ok"}
+        ]
+      },
+      {
+        "name": "alerting",
+        "file": "/etc/prometheus/rules/node.yml",
+        "interval": 60,
+        "rules": [
+          {"type": "alerting", "name": "InstanceDown", "query": "up == 0", "duration": 300}
+        ]
+      }
+    ]
+  }
+}`
+
+func TestRuler_RuleGroupImportFromPrometheus(t *testing.T) {
+	existingGroup := rulespb.ToProto("user-1", "node", rulefmt.RuleGroup{
+		Name: "recording",
+		Rules: []rulefmt.RuleNode{
+			{Record: yaml.Node{Kind: yaml.ScalarNode, Value: "up:sum"}, Expr: yaml.Node{Kind: yaml.ScalarNode, Value: "sum(up)"}},
+		},
+	})
+
+	tests := map[string]struct {
+		body             string
+		query            string
+		existing         []*rulespb.RuleGroupDesc
+		maxRuleGroups    int
+		expectedStatus   int
+		expectedResponse importRuleGroupsResponse
+		expectedGroups   []string
+	}{
+		"should import the rule groups skipping the repeated ones": {
+			body:           prometheusRulesResponseBody,
+			expectedStatus: http.StatusOK,
+			expectedResponse: importRuleGroupsResponse{
+				Imported: []importedRuleGroup{{Namespace: "node", Name: "recording"}, {Namespace: "node", Name: "alerting"}},
+				Skipped:  []importedRuleGroup{{Namespace: "node", Name: "alerting"}},
+			},
+			expectedGroups: []string{"node/recording", "node/alerting"},
+		},
+		"should skip the rule groups which already exist in the tenant": {
+			body:           prometheusRulesResponseBody,
+			existing:       []*rulespb.RuleGroupDesc{existingGroup},
+			expectedStatus: http.StatusOK,
+			expectedResponse: importRuleGroupsResponse{
+				Imported: []importedRuleGroup{{Namespace: "node", Name: "alerting"}},
+				Skipped:  []importedRuleGroup{{Namespace: "node", Name: "recording"}, {Namespace: "node", Name: "alerting"}},
+			},
+			expectedGroups: []string{"node/recording", "node/alerting"},
+		},
+		"should import the rule groups to the namespace set in the request": {
+			body:           prometheusRulesResponseBody,
+			query:          "?namespace=imported",
+			existing:       []*rulespb.RuleGroupDesc{existingGroup},
+			expectedStatus: http.StatusOK,
+			expectedResponse: importRuleGroupsResponse{
+				Imported: []importedRuleGroup{{Namespace: "imported", Name: "recording"}, {Namespace: "imported", Name: "alerting"}},
+				Skipped:  []importedRuleGroup{{Namespace: "imported", Name: "alerting"}},
+			},
+			expectedGroups: []string{"node/recording", "imported/recording", "imported/alerting"},
+		},
+		"should fail if the tenant would exceed the max rule groups": {
+			body:           prometheusRulesResponseBody,
+			maxRuleGroups:  1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should fail if the request body is not a successful Prometheus response": {
+			body:           `{"status": "error", "error": "failed"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should fail and import nothing if a rule is invalid": {
+			body: `{"status": "success", "data": {"groups": [
+				{"name": "valid", "file": "rules.yml", "rules": [{"type": "recording", "name": "up:sum", "query": "sum(up)"}]},
+				{"name": "invalid", "file": "rules.yml", "rules": [{"type": "recording", "name": "up:sum", "query": "sum(up"}]}
+			]}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			store := bucketclient.NewBucketRuleStore(objstore.NewInMemBucket(), nil, log.NewNopLogger())
+			for _, rg := range testData.existing {
+				require.NoError(t, store.SetRuleGroup(ctx, rg.User, rg.Namespace, rg))
+			}
+
+			limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+				defaults.RulerMaxRuleGroupsPerTenant = testData.maxRuleGroups
+			})
+
+			r, err := NewRuler(defaultRulerConfig(t), &DefaultMultiTenantManager{}, nil, log.NewNopLogger(), store, limits, nil, nil)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/ruler/api/v1/rules/import_from_prometheus"+testData.query, strings.NewReader(testData.body))
+			req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+			resp := httptest.NewRecorder()
+			NewAPI(r, store, log.NewNopLogger()).RuleGroupImportFromPrometheus(resp, req)
+			require.Equal(t, testData.expectedStatus, resp.Code, resp.Body.String())
+
+			list, err := store.ListRuleGroupsForUserAndNamespace(ctx, "user-1", "")
+			require.NoError(t, err)
+			var actualGroups []string
+			for _, rg := range list {
+				actualGroups = append(actualGroups, rg.Namespace+"/"+rg.Name)
+			}
+
+			if testData.expectedStatus != http.StatusOK {
+				// Nothing should have been imported.
+				var expectedGroups []string
+				for _, rg := range testData.existing {
+					expectedGroups = append(expectedGroups, rg.Namespace+"/"+rg.Name)
+				}
+				assert.ElementsMatch(t, expectedGroups, actualGroups)
+				return
+			}
+
+			var actualResponse importRuleGroupsResponse
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &actualResponse))
+			assert.Equal(t, testData.expectedResponse, actualResponse)
+			assert.ElementsMatch(t, testData.expectedGroups, actualGroups)
+		})
+	}
+}
+
+func TestRuler_RuleGroupImportFromPrometheus_ShouldConvertTheRules(t *testing.T) {
+	ctx := context.Background()
+	store := bucketclient.NewBucketRuleStore(objstore.NewInMemBucket(), nil, log.NewNopLogger())
+
+	r, err := NewRuler(defaultRulerConfig(t), &DefaultMultiTenantManager{}, nil, log.NewNopLogger(), store, validation.MockDefaultOverrides(), nil, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/ruler/api/v1/rules/import_from_prometheus", strings.NewReader(prometheusRulesResponseBody))
+	req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+	resp := httptest.NewRecorder()
+	NewAPI(r, store, log.NewNopLogger()).RuleGroupImportFromPrometheus(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	recording, err := store.GetRuleGroup(ctx, "user-1", "node", "recording")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, recording.Interval)
+	require.Len(t, recording.Rules, 1)
+	assert.Equal(t, "instance:up:sum", recording.Rules[0].Record)
+	assert.Equal(t, "sum by (instance) (up)", recording.Rules[0].Expr)
+	assert.Equal(t, map[string]string{"source": "prometheus"}, mimirpb.FromLabelAdaptersToLabels(recording.Rules[0].Labels).Map())
+
+	alerting, err := store.GetRuleGroup(ctx, "user-1", "node", "alerting")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, alerting.Interval)
+	require.Len(t, alerting.Rules, 1)
+	assert.Equal(t, "InstanceDown", alerting.Rules[0].Alert)
+	assert.Equal(t, "up == 0", alerting.Rules[0].Expr)
+	assert.Equal(t, 5*time.Minute, alerting.Rules[0].For)
+	assert.Equal(t, map[string]string{"severity": "critical"}, mimirpb.FromLabelAdaptersToLabels(alerting.Rules[0].Labels).Map())
+	assert.Equal(t, map[string]string{"summary": "Instance down"}, mimirpb.FromLabelAdaptersToLabels(alerting.Rules[0].Annotations).Map())
+}
+
+func TestRuler_RuleGroupImportFromPrometheus_ShouldDeleteTheStoredRuleGroupsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingSetRuleGroupStore{
+		RuleStore: bucketclient.NewBucketRuleStore(objstore.NewInMemBucket(), nil, log.NewNopLogger()),
+		failOn:    "alerting",
+	}
+
+	r, err := NewRuler(defaultRulerConfig(t), &DefaultMultiTenantManager{}, nil, log.NewNopLogger(), store, validation.MockDefaultOverrides(), nil, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/ruler/api/v1/rules/import_from_prometheus", strings.NewReader(prometheusRulesResponseBody))
+	req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+	resp := httptest.NewRecorder()
+	NewAPI(r, store, log.NewNopLogger()).RuleGroupImportFromPrometheus(resp, req)
+	require.Equal(t, http.StatusInternalServerError, resp.Code, resp.Body.String())
+
+	// The rule group stored before the failure should have been deleted.
+	list, err := store.ListRuleGroupsForUserAndNamespace(ctx, "user-1", "")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+// failingSetRuleGroupStore is a rule store failing to store the rule groups with the given name.
+type failingSetRuleGroupStore struct {
+	rulestore.RuleStore
+	failOn string
+}
+
+func (s *failingSetRuleGroupStore) SetRuleGroup(ctx context.Context, userID, namespace string, group *rulespb.RuleGroupDesc) error {
+	if group.Name == s.failOn {
+		return errors.New("failed to store the rule group")
+	}
+	return s.RuleStore.SetRuleGroup(ctx, userID, namespace, group)
+}
@@ -0,0 +1,409 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+const (
+	// RuleGroupMetricsExportPrefix is the bucket prefix under which the ruler metrics blocks are uploaded, for each tenant.
+	RuleGroupMetricsExportPrefix = "ruler-metrics"
+
+	// RulerIDExternalLabel is the external label set in the ruler metrics blocks to identify the ruler which
+	// exported them. Each ruler exports the metrics of the rule groups it evaluates, so the blocks exported by
+	// different rulers for the same tenant overlap in time, while the ones exported by a single ruler don't.
+	RulerIDExternalLabel = "__ruler_id__"
+
+	// ruleGroupMetricsExportShutdownTimeout is how long the ruler waits for the blocks to be uploaded when stopping.
+	ruleGroupMetricsExportShutdownTimeout = time.Minute
+
+	// ruleGroupMetricsExportDirName is the subdirectory of the configured data directory owned by the exporter.
+	ruleGroupMetricsExportDirName = "blocks"
+)
+
+var (
+	errInvalidRuleGroupMetricsExportScrapeInterval = errors.New("the ruler metrics export scrape interval must be greater than 0")
+	errInvalidRuleGroupMetricsExportBlockDuration  = errors.New("the ruler metrics export block duration must be greater than or equal to the scrape interval, and must divide 24h")
+	errInvalidRuleGroupMetricsExportFlushInterval  = errors.New("the ruler metrics export flush interval must be greater than 0 and less than or equal to the block duration")
+)
+
+// RuleGroupMetricsExporterConfig configures the RuleGroupMetricsExporter.
+type RuleGroupMetricsExporterConfig struct {
+	Enabled        bool          `yaml:"enabled" category:"experimental"`
+	ScrapeInterval time.Duration `yaml:"scrape_interval" category:"experimental"`
+	BlockDuration  time.Duration `yaml:"block_duration" category:"experimental"`
+	FlushInterval  time.Duration `yaml:"flush_interval" category:"experimental"`
+	DataDir        string        `yaml:"data_dir" category:"experimental"`
+}
+
+func (cfg *RuleGroupMetricsExporterConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "ruler.metrics-export.enabled", false, "When enabled, the rule evaluation metrics of each tenant are periodically written to a TSDB block, which is uploaded every -ruler.metrics-export.block-duration to the ruler storage under the "+RuleGroupMetricsExportPrefix+"/<tenant>/ prefix. Each ruler exports the metrics of the rule groups it evaluates, in blocks with the "+RulerIDExternalLabel+" external label set to the ruler instance ID.")
+	f.DurationVar(&cfg.ScrapeInterval, "ruler.metrics-export.scrape-interval", time.Minute, "How frequently the rule evaluation metrics are sampled to be exported.")
+	f.DurationVar(&cfg.BlockDuration, "ruler.metrics-export.block-duration", 24*time.Hour, "Time range of the rule evaluation metrics exported in each block. Must divide 24h.")
+	f.DurationVar(&cfg.FlushInterval, "ruler.metrics-export.flush-interval", 2*time.Hour, "How frequently the rule evaluation metrics sampled in memory are written to a local block. The local blocks are compacted into a single block, which is uploaded at the end of each -ruler.metrics-export.block-duration. Must be less than or equal to the block duration.")
+	f.StringVar(&cfg.DataDir, "ruler.metrics-export.data-dir", "./ruler-metrics-export/", "Directory where the blocks with the rule evaluation metrics are written before being uploaded. The blocks are written to the "+ruleGroupMetricsExportDirName+" subdirectory, which is cleaned up at startup. This directory is not required to be persisted between restarts.")
+}
+
+func (cfg *RuleGroupMetricsExporterConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.ScrapeInterval <= 0 {
+		return errInvalidRuleGroupMetricsExportScrapeInterval
+	}
+	if cfg.BlockDuration < cfg.ScrapeInterval || (24*time.Hour)%cfg.BlockDuration != 0 {
+		return errInvalidRuleGroupMetricsExportBlockDuration
+	}
+	if cfg.FlushInterval <= 0 || cfg.FlushInterval > cfg.BlockDuration {
+		return errInvalidRuleGroupMetricsExportFlushInterval
+	}
+	return nil
+}
+
+// RuleGroupMetricsExporter periodically samples the per-tenant rule evaluation metrics and writes them to a
+// local TSDB block for each tenant at every flush interval. At the end of each block time range, the local
+// blocks of each tenant are compacted into a single block, which is uploaded to the object storage, so that
+// the rule evaluation metrics are available for long-term query.
+type RuleGroupMetricsExporter struct {
+	services.Service
+
+	cfg        RuleGroupMetricsExporterConfig
+	instanceID string
+	gatherer   prometheus.Gatherer
+	bucket     objstore.Bucket
+	logger     log.Logger
+
+	// Directory owned by the exporter, where the local blocks of each tenant are written.
+	dir string
+
+	// Start time of the period currently being collected, the time the samples were last written to the local
+	// blocks, and the block writer of each tenant holding the samples collected since then.
+	// Only accessed by the service goroutine.
+	periodStart time.Time
+	lastFlush   time.Time
+	writers     map[string]*tsdb.BlockWriter
+
+	uploadedBlocks prometheus.Counter
+	failedUploads  prometheus.Counter
+}
+
+// NewRuleGroupMetricsExporter makes a new RuleGroupMetricsExporter exporting the metrics collected by the input
+// collector, which are expected to have a "user" label with the tenant ID. The instanceID is the ID of the
+// ruler in the ring, set as external label of the exported blocks.
+func NewRuleGroupMetricsExporter(cfg RuleGroupMetricsExporterConfig, instanceID string, metrics prometheus.Collector, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) (*RuleGroupMetricsExporter, error) {
+	gatherer := prometheus.NewRegistry()
+	if err := gatherer.Register(metrics); err != nil {
+		return nil, errors.Wrap(err, "register ruler metrics to export")
+	}
+
+	e := &RuleGroupMetricsExporter{
+		cfg:        cfg,
+		instanceID: instanceID,
+		gatherer:   gatherer,
+		bucket:     bkt,
+		logger:     logger,
+		dir:        filepath.Join(cfg.DataDir, ruleGroupMetricsExportDirName),
+		writers:    map[string]*tsdb.BlockWriter{},
+		uploadedBlocks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_metrics_export_uploaded_blocks_total",
+			Help: "Total number of blocks with the rule evaluation metrics uploaded to the object storage.",
+		}),
+		failedUploads: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ruler_metrics_export_failed_uploads_total",
+			Help: "Total number of blocks with the rule evaluation metrics failed to be uploaded to the object storage.",
+		}),
+	}
+
+	e.Service = services.NewTimerService(cfg.ScrapeInterval, e.starting, e.iteration, e.stopping)
+	return e, nil
+}
+
+func (e *RuleGroupMetricsExporter) starting(_ context.Context) error {
+	// Remove any leftover from a previous run, because it can't be reliably resumed.
+	if err := os.RemoveAll(e.dir); err != nil {
+		return errors.Wrap(err, "clean up ruler metrics export directory")
+	}
+
+	now := time.Now()
+	e.periodStart = now.Truncate(e.cfg.BlockDuration)
+	e.lastFlush = now
+	return nil
+}
+
+func (e *RuleGroupMetricsExporter) iteration(ctx context.Context) error {
+	now := time.Now()
+
+	if !now.Before(e.periodStart.Add(e.cfg.BlockDuration)) {
+		e.flushBlocks(ctx)
+		e.exportBlocks(ctx)
+		e.periodStart = now.Truncate(e.cfg.BlockDuration)
+		e.lastFlush = now
+	} else if now.Sub(e.lastFlush) >= e.cfg.FlushInterval {
+		e.flushBlocks(ctx)
+		e.lastFlush = now
+	}
+
+	e.scrape(ctx, now)
+	return nil
+}
+
+func (e *RuleGroupMetricsExporter) stopping(_ error) error {
+	// Export the metrics collected so far, otherwise they would be lost, without blocking the shutdown for too long.
+	ctx, cancel := context.WithTimeout(context.Background(), ruleGroupMetricsExportShutdownTimeout)
+	defer cancel()
+
+	e.flushBlocks(ctx)
+	e.exportBlocks(ctx)
+	return nil
+}
+
+// scrape samples the rule evaluation metrics and appends them to the block writer of each tenant.
+func (e *RuleGroupMetricsExporter) scrape(ctx context.Context, now time.Time) {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		level.Warn(e.logger).Log("msg", "failed to gather the rule evaluation metrics to export", "err", err)
+		return
+	}
+
+	appenders := map[string]exportAppender{}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			userID, lbls := metricLabels(family.GetName(), metric)
+			if userID == "" {
+				continue
+			}
+
+			app, ok := appenders[userID]
+			if !ok {
+				w, err := e.blockWriter(userID)
+				if err != nil {
+					level.Warn(e.logger).Log("msg", "failed to create block writer for the rule evaluation metrics", "user", userID, "err", err)
+					continue
+				}
+				app = exportAppender{Appender: w.Appender(ctx)}
+				appenders[userID] = app
+			}
+
+			app.appendMetric(family, metric, lbls, now.UnixMilli())
+		}
+	}
+
+	for userID, app := range appenders {
+		if err := app.Commit(); err != nil {
+			level.Warn(e.logger).Log("msg", "failed to append the rule evaluation metrics to export", "user", userID, "err", err)
+		}
+	}
+}
+
+func (e *RuleGroupMetricsExporter) blockWriter(userID string) (*tsdb.BlockWriter, error) {
+	if w, ok := e.writers[userID]; ok {
+		return w, nil
+	}
+
+	dir := filepath.Join(e.dir, userID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	w, err := tsdb.NewBlockWriter(e.logger, dir, e.cfg.BlockDuration.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	e.writers[userID] = w
+	return w, nil
+}
+
+// flushBlocks writes the samples held in memory by the block writer of each tenant to a local block.
+func (e *RuleGroupMetricsExporter) flushBlocks(ctx context.Context) {
+	for userID, w := range e.writers {
+		if _, err := w.Flush(ctx); err != nil && !errors.Is(err, tsdb.ErrNoSeriesAppended) {
+			level.Warn(e.logger).Log("msg", "failed to write the rule evaluation metrics block", "user", userID, "err", err)
+		}
+		if err := w.Close(); err != nil {
+			level.Warn(e.logger).Log("msg", "failed to close the rule evaluation metrics block writer", "user", userID, "err", err)
+		}
+
+		delete(e.writers, userID)
+	}
+}
+
+// exportBlocks compacts the local blocks of each tenant into a single block and uploads it to the object storage.
+func (e *RuleGroupMetricsExporter) exportBlocks(ctx context.Context) {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(e.logger).Log("msg", "failed to list the rule evaluation metrics blocks", "err", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		userID := entry.Name()
+		if err := e.exportBlock(ctx, userID); err != nil {
+			e.failedUploads.Inc()
+			level.Warn(e.logger).Log("msg", "failed to export the rule evaluation metrics block", "user", userID, "err", err)
+		}
+
+		if err := os.RemoveAll(filepath.Join(e.dir, userID)); err != nil {
+			level.Warn(e.logger).Log("msg", "failed to remove the rule evaluation metrics blocks", "user", userID, "err", err)
+		}
+	}
+}
+
+func (e *RuleGroupMetricsExporter) exportBlock(ctx context.Context, userID string) error {
+	userDir := filepath.Join(e.dir, userID)
+
+	blockID, err := e.compactBlocks(ctx, userDir)
+	if err != nil {
+		return err
+	}
+	if blockID == (ulid.ULID{}) {
+		return nil
+	}
+
+	blockDir := filepath.Join(userDir, blockID.String())
+	meta, err := metadata.ReadFromDir(blockDir)
+	if err != nil {
+		return errors.Wrap(err, "read block meta")
+	}
+	meta.Thanos.Source = metadata.RulerSource
+	meta.Thanos.Labels = map[string]string{RulerIDExternalLabel: e.instanceID}
+
+	userBucket := bucket.NewPrefixedBucketClient(e.bucket, path.Join(RuleGroupMetricsExportPrefix, userID))
+	if err := mimir_tsdb.UploadBlock(ctx, e.logger, userBucket, blockDir, meta); err != nil {
+		return errors.Wrap(err, "upload block")
+	}
+
+	e.uploadedBlocks.Inc()
+	level.Info(e.logger).Log("msg", "uploaded the rule evaluation metrics block", "user", userID, "block", blockID.String())
+	return nil
+}
+
+// compactBlocks compacts the blocks in the input directory into a single block, and returns its ID. The block
+// itself is returned if there's only one, while a zero ID is returned if there's none.
+func (e *RuleGroupMetricsExporter) compactBlocks(ctx context.Context, dir string) (ulid.ULID, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "list blocks")
+	}
+
+	var blockDirs []string
+	for _, entry := range entries {
+		if _, err := ulid.Parse(entry.Name()); err == nil && entry.IsDir() {
+			blockDirs = append(blockDirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	switch len(blockDirs) {
+	case 0:
+		return ulid.ULID{}, nil
+	case 1:
+		return ulid.MustParse(filepath.Base(blockDirs[0])), nil
+	}
+
+	compactor, err := tsdb.NewLeveledCompactor(ctx, nil, e.logger, []int64{e.cfg.BlockDuration.Milliseconds()}, nil, nil, false)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create compactor")
+	}
+
+	blockID, err := compactor.Compact(dir, blockDirs, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "compact blocks")
+	}
+	return blockID, nil
+}
+
+// metricLabels returns the tenant ID and the labels of the input metric, excluding the "user" label.
+func metricLabels(name string, metric *dto.Metric) (string, labels.Labels) {
+	userID := ""
+	b := labels.NewBuilder(labels.FromStrings(labels.MetricName, name))
+
+	for _, pair := range metric.GetLabel() {
+		if pair.GetName() == "user" {
+			userID = pair.GetValue()
+			continue
+		}
+		b.Set(pair.GetName(), pair.GetValue())
+	}
+
+	return userID, b.Labels()
+}
+
+// exportAppender appends the samples of the exported metrics.
+type exportAppender struct {
+	storage.Appender
+}
+
+// appendMetric appends the samples of the input metric. Summaries and histograms are appended
+// as the series exposed in the Prometheus text format.
+func (a exportAppender) appendMetric(family *dto.MetricFamily, metric *dto.Metric, lbls labels.Labels, ts int64) {
+	name := family.GetName()
+
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		a.append(lbls, ts, metric.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		a.append(lbls, ts, metric.GetGauge().GetValue())
+	case dto.MetricType_UNTYPED:
+		a.append(lbls, ts, metric.GetUntyped().GetValue())
+	case dto.MetricType_SUMMARY:
+		s := metric.GetSummary()
+		for _, q := range s.GetQuantile() {
+			a.append(labels.NewBuilder(lbls).Set("quantile", formatFloat(q.GetQuantile())).Labels(), ts, q.GetValue())
+		}
+		a.append(renameMetric(lbls, name+"_sum"), ts, s.GetSampleSum())
+		a.append(renameMetric(lbls, name+"_count"), ts, float64(s.GetSampleCount()))
+	case dto.MetricType_HISTOGRAM:
+		h := metric.GetHistogram()
+		bucketLabels := renameMetric(lbls, name+"_bucket")
+		for _, b := range h.GetBucket() {
+			a.append(labels.NewBuilder(bucketLabels).Set(labels.BucketLabel, formatFloat(b.GetUpperBound())).Labels(), ts, float64(b.GetCumulativeCount()))
+		}
+		a.append(labels.NewBuilder(bucketLabels).Set(labels.BucketLabel, "+Inf").Labels(), ts, float64(h.GetSampleCount()))
+		a.append(renameMetric(lbls, name+"_sum"), ts, h.GetSampleSum())
+		a.append(renameMetric(lbls, name+"_count"), ts, float64(h.GetSampleCount()))
+	}
+}
+
+func (a exportAppender) append(lbls labels.Labels, ts int64, v float64) {
+	// Errors are only returned for out of order or duplicated samples, which can be safely skipped.
+	_, _ = a.Append(0, lbls, ts, v)
+}
+
+func renameMetric(lbls labels.Labels, name string) labels.Labels {
+	return labels.NewBuilder(lbls).Set(labels.MetricName, name).Labels()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
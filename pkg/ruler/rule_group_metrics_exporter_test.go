@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+func TestRuleGroupMetricsExporter(t *testing.T) {
+	evalTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_prometheus_rule_evaluations_total",
+		Help: "The total number of rule evaluations.",
+	}, []string{"user", "rule_group"})
+	evalDuration := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "cortex_prometheus_rule_evaluation_duration_seconds",
+		Help: "The duration for a rule to execute.",
+	}, []string{"user"})
+
+	metrics := multiCollector{evalTotal, evalDuration}
+
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewPedanticRegistry()
+	cfg := RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 2 * time.Hour, FlushInterval: time.Hour, DataDir: t.TempDir()}
+
+	exporter, err := NewRuleGroupMetricsExporter(cfg, "ruler-1", metrics, bkt, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, exporter.starting(ctx))
+
+	now := time.Now()
+	evalTotal.WithLabelValues("user-1", "group-1").Add(1)
+	evalTotal.WithLabelValues("user-2", "group-1").Add(2)
+	evalDuration.WithLabelValues("user-1").Observe(0.5)
+	exporter.scrape(ctx, now)
+
+	// The samples held in memory should be written to a local block for each tenant.
+	exporter.flushBlocks(ctx)
+	assert.Empty(t, exporter.writers)
+	assert.Len(t, listLocalBlocks(t, exporter, "user-1"), 1)
+
+	evalTotal.WithLabelValues("user-1", "group-1").Add(1)
+	exporter.scrape(ctx, now.Add(time.Minute))
+	exporter.flushBlocks(ctx)
+	assert.Len(t, listLocalBlocks(t, exporter, "user-1"), 2)
+
+	// The local blocks should be compacted into a single block for each tenant, which is uploaded.
+	exporter.exportBlocks(ctx)
+	assert.NoDirExists(t, filepath.Join(exporter.dir, "user-1"))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_metrics_export_uploaded_blocks_total Total number of blocks with the rule evaluation metrics uploaded to the object storage.
+		# TYPE cortex_ruler_metrics_export_uploaded_blocks_total counter
+		cortex_ruler_metrics_export_uploaded_blocks_total 2
+		# HELP cortex_ruler_metrics_export_failed_uploads_total Total number of blocks with the rule evaluation metrics failed to be uploaded to the object storage.
+		# TYPE cortex_ruler_metrics_export_failed_uploads_total counter
+		cortex_ruler_metrics_export_failed_uploads_total 0
+	`)))
+
+	// Read back the block uploaded for user-1.
+	user1Series := readExportedSeries(t, bkt, "user-1")
+	assert.Equal(t, map[string][]float64{
+		`{__name__="cortex_prometheus_rule_evaluations_total", rule_group="group-1"}`: {1, 2},
+		`{__name__="cortex_prometheus_rule_evaluation_duration_seconds_count"}`:       {1, 1},
+		`{__name__="cortex_prometheus_rule_evaluation_duration_seconds_sum"}`:         {0.5, 0.5},
+	}, user1Series)
+
+	user2Series := readExportedSeries(t, bkt, "user-2")
+	assert.Equal(t, map[string][]float64{
+		`{__name__="cortex_prometheus_rule_evaluations_total", rule_group="group-1"}`: {2, 2},
+	}, user2Series)
+}
+
+func TestRuleGroupMetricsExporter_ShouldNotUploadBlocksWithoutSamples(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	cfg := RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 2 * time.Hour, FlushInterval: time.Hour, DataDir: t.TempDir()}
+
+	exporter, err := NewRuleGroupMetricsExporter(cfg, "ruler-1", multiCollector{}, bkt, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, exporter.starting(ctx))
+	exporter.scrape(ctx, time.Now())
+	exporter.flushBlocks(ctx)
+	exporter.exportBlocks(ctx)
+
+	assert.Empty(t, bkt.Objects())
+}
+
+func TestRuleGroupMetricsExporter_ShouldOnlyCleanUpItsOwnDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "other"), []byte("other"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, ruleGroupMetricsExportDirName, "user-1"), os.ModePerm))
+
+	cfg := RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 2 * time.Hour, FlushInterval: time.Hour, DataDir: dataDir}
+	exporter, err := NewRuleGroupMetricsExporter(cfg, "ruler-1", multiCollector{}, objstore.NewInMemBucket(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, exporter.starting(context.Background()))
+
+	assert.FileExists(t, filepath.Join(dataDir, "other"))
+	assert.NoDirExists(t, filepath.Join(dataDir, ruleGroupMetricsExportDirName))
+}
+
+func TestRuleGroupMetricsExporterConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cfg      RuleGroupMetricsExporterConfig
+		expected error
+	}{
+		"should pass if disabled": {
+			cfg: RuleGroupMetricsExporterConfig{},
+		},
+		"should pass with the default block duration": {
+			cfg: RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 24 * time.Hour, FlushInterval: 2 * time.Hour},
+		},
+		"should fail if the scrape interval is not positive": {
+			cfg:      RuleGroupMetricsExporterConfig{Enabled: true, BlockDuration: 2 * time.Hour},
+			expected: errInvalidRuleGroupMetricsExportScrapeInterval,
+		},
+		"should fail if the block duration is shorter than the scrape interval": {
+			cfg:      RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Hour, BlockDuration: time.Minute},
+			expected: errInvalidRuleGroupMetricsExportBlockDuration,
+		},
+		"should fail if the block duration doesn't divide 24h": {
+			cfg:      RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 5 * time.Hour},
+			expected: errInvalidRuleGroupMetricsExportBlockDuration,
+		},
+		"should fail if the flush interval is not positive": {
+			cfg:      RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 2 * time.Hour},
+			expected: errInvalidRuleGroupMetricsExportFlushInterval,
+		},
+		"should fail if the flush interval is longer than the block duration": {
+			cfg:      RuleGroupMetricsExporterConfig{Enabled: true, ScrapeInterval: time.Minute, BlockDuration: 2 * time.Hour, FlushInterval: 3 * time.Hour},
+			expected: errInvalidRuleGroupMetricsExportFlushInterval,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testData.expected, testData.cfg.Validate())
+		})
+	}
+}
+
+// listLocalBlocks returns the local blocks written by the exporter for the input tenant.
+func listLocalBlocks(t *testing.T, exporter *RuleGroupMetricsExporter, userID string) []string {
+	entries, err := os.ReadDir(filepath.Join(exporter.dir, userID))
+	require.NoError(t, err)
+
+	var blocks []string
+	for _, entry := range entries {
+		if _, err := ulid.Parse(entry.Name()); err == nil {
+			blocks = append(blocks, entry.Name())
+		}
+	}
+	return blocks
+}
+
+// readExportedSeries downloads the single block exported for the input tenant, and returns the
+// sample values of each series, keyed by the series labels.
+func readExportedSeries(t *testing.T, bkt objstore.Bucket, userID string) map[string][]float64 {
+	ctx := context.Background()
+	userBucket := bucket.NewPrefixedBucketClient(bkt, RuleGroupMetricsExportPrefix+"/"+userID)
+
+	var blockIDs []ulid.ULID
+	require.NoError(t, userBucket.Iter(ctx, "", func(name string) error {
+		if id, err := ulid.Parse(strings.TrimSuffix(name, "/")); err == nil {
+			blockIDs = append(blockIDs, id)
+		}
+		return nil
+	}))
+	require.Len(t, blockIDs, 1)
+
+	dir := t.TempDir()
+	blockDir := filepath.Join(dir, blockIDs[0].String())
+	require.NoError(t, objstore.DownloadDir(ctx, log.NewNopLogger(), userBucket, blockIDs[0].String(), blockIDs[0].String(), blockDir))
+
+	// The block should be identified by the ruler which exported it.
+	meta, err := metadata.ReadFromDir(blockDir)
+	require.NoError(t, err)
+	assert.Equal(t, metadata.RulerSource, meta.Thanos.Source)
+	assert.Equal(t, map[string]string{RulerIDExternalLabel: "ruler-1"}, meta.Thanos.Labels)
+
+	block, err := tsdb.OpenBlock(log.NewNopLogger(), blockDir, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, block.Close()) })
+
+	querier, err := tsdb.NewBlockQuerier(block, 0, time.Now().Add(time.Hour).UnixMilli())
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, querier.Close()) })
+
+	result := map[string][]float64{}
+	set := querier.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+	for set.Next() {
+		series := set.At()
+		it := series.Iterator()
+		for it.Next() {
+			_, v := it.At()
+			result[series.Labels().String()] = append(result[series.Labels().String()], v)
+		}
+		require.NoError(t, it.Err())
+	}
+	require.NoError(t, set.Err())
+
+	return result
+}
+
+// multiCollector is a prometheus.Collector collecting the metrics of multiple collectors.
+type multiCollector []prometheus.Collector
+
+func (m multiCollector) Describe(out chan<- *prometheus.Desc) {
+	for _, c := range m {
+		c.Describe(out)
+	}
+}
+
+func (m multiCollector) Collect(out chan<- prometheus.Metric) {
+	for _, c := range m {
+		c.Collect(out)
+	}
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/ruler/rulestore"
+	"github.com/grafana/mimir/pkg/util"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+var (
+	errTransferMissingParams      = errors.New("from_tenant, to_tenant, namespace and group parameters are required")
+	errTransferSameTenant         = errors.New("the source and destination tenants must be different")
+	errTransferNotAuthorized      = errors.New("the request must be authenticated for both the source and destination tenants")
+	errTransferGroupExists        = errors.New("the rule group already exists in the destination tenant")
+	errTransferVerificationFailed = errors.New("the rule group copied to the destination tenant doesn't match the source rule group")
+	errTransferSourceChanged      = errors.New("the rule group has been changed in the source tenant during the transfer")
+)
+
+// TransferRuleGroup moves a rule group from a tenant to another one. The rule group is copied to the destination
+// tenant, the copy is verified and then the rule group is deleted from the source tenant. If any step fails, the
+// changes done to the destination tenant are reverted, so that the rule group is owned by exactly one tenant.
+//
+// The rule store has no transactions: the transfers handled by a ruler are serialized, and the transfer fails
+// with a conflict if the source rule group is changed while it's being transferred, but a rule group written
+// to the destination tenant between the copy and the revert of a failed transfer is reverted too.
+//
+// This is an administrative API, and not to be exposed to users. The request must be authenticated for both the
+// source and destination tenants, e.g. with the X-Scope-OrgID header set to "<from_tenant>|<to_tenant>".
+func (r *Ruler) TransferRuleGroup(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), r.logger)
+
+	// The request is authenticated for multiple tenants, regardless of whether tenant federation is enabled.
+	tenantIDs, err := tenant.NewMultiResolver().TenantIDs(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	params := req.URL.Query()
+	fromTenant, toTenant := params.Get("from_tenant"), params.Get("to_tenant")
+	namespace, group := params.Get("namespace"), params.Get("group")
+
+	if fromTenant == "" || toTenant == "" || namespace == "" || group == "" {
+		http.Error(w, errTransferMissingParams.Error(), http.StatusBadRequest)
+		return
+	}
+	if fromTenant == toTenant {
+		http.Error(w, errTransferSameTenant.Error(), http.StatusBadRequest)
+		return
+	}
+	if !util.StringsContain(tenantIDs, fromTenant) || !util.StringsContain(tenantIDs, toTenant) {
+		http.Error(w, errTransferNotAuthorized.Error(), http.StatusForbidden)
+		return
+	}
+
+	logger = log.With(logger, "from_tenant", fromTenant, "to_tenant", toTenant, "namespace", namespace, "group", group)
+
+	status, err := r.transferRuleGroup(req.Context(), logger, fromTenant, toTenant, namespace, group)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to transfer rule group", "err", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	level.Info(logger).Log("msg", "transferred rule group")
+	w.WriteHeader(http.StatusOK)
+}
+
+// transferRuleGroup moves the rule group and, on failure, returns the HTTP status code to respond with.
+func (r *Ruler) transferRuleGroup(ctx context.Context, logger log.Logger, fromTenant, toTenant, namespace, group string) (int, error) {
+	r.transferMtx.Lock()
+	defer r.transferMtx.Unlock()
+
+	source, err := r.store.GetRuleGroup(ctx, fromTenant, namespace, group)
+	if err != nil {
+		if errors.Is(err, rulestore.ErrGroupNotFound) {
+			return http.StatusNotFound, err
+		}
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to get the rule group from the source tenant")
+	}
+
+	// Never overwrite an existing rule group of the destination tenant.
+	if _, err := r.store.GetRuleGroup(ctx, toTenant, namespace, group); err == nil {
+		return http.StatusConflict, errTransferGroupExists
+	} else if !errors.Is(err, rulestore.ErrGroupNotFound) {
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to check the rule group in the destination tenant")
+	}
+
+	// The rule group is subject to the destination tenant limits.
+	if err := r.AssertMaxRulesPerRuleGroup(toTenant, len(source.Rules)); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	destGroups, err := r.store.ListRuleGroupsForUserAndNamespace(ctx, toTenant, "")
+	if err != nil {
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to list the rule groups of the destination tenant")
+	}
+	if err := r.AssertMaxRuleGroups(toTenant, len(destGroups)+1); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// Copy the rule group, preserving all its settings, to the destination tenant.
+	dest := *source
+	dest.User = toTenant
+
+	if err := r.store.SetRuleGroup(ctx, toTenant, namespace, &dest); err != nil {
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to copy the rule group to the destination tenant")
+	}
+	level.Info(logger).Log("msg", "audit: copied rule group to the destination tenant", "rules", len(dest.Rules))
+
+	// Verify the copy before deleting the source rule group.
+	copied, err := r.store.GetRuleGroup(ctx, toTenant, namespace, group)
+	if err == nil && !copied.Equal(&dest) {
+		err = errTransferVerificationFailed
+	}
+	if err != nil {
+		r.revertRuleGroupCopy(ctx, logger, toTenant, namespace, group)
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to verify the rule group copied to the destination tenant")
+	}
+
+	// Don't delete the source rule group if it has been changed since it was copied, otherwise the change is lost.
+	current, err := r.store.GetRuleGroup(ctx, fromTenant, namespace, group)
+	if err != nil && !errors.Is(err, rulestore.ErrGroupNotFound) {
+		r.revertRuleGroupCopy(ctx, logger, toTenant, namespace, group)
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to check the rule group in the source tenant")
+	}
+	if err != nil || !current.Equal(source) {
+		r.revertRuleGroupCopy(ctx, logger, toTenant, namespace, group)
+		return http.StatusConflict, errTransferSourceChanged
+	}
+
+	if err := r.store.DeleteRuleGroup(ctx, fromTenant, namespace, group); err != nil {
+		r.revertRuleGroupCopy(ctx, logger, toTenant, namespace, group)
+		return http.StatusInternalServerError, errors.Wrap(err, "failed to delete the rule group from the source tenant")
+	}
+	level.Info(logger).Log("msg", "audit: deleted rule group from the source tenant", "rules", len(source.Rules))
+
+	return http.StatusOK, nil
+}
+
+// revertRuleGroupCopy deletes the rule group copied to the destination tenant by a failed transfer.
+func (r *Ruler) revertRuleGroupCopy(ctx context.Context, logger log.Logger, toTenant, namespace, group string) {
+	if err := r.store.DeleteRuleGroup(ctx, toTenant, namespace, group); err != nil && !errors.Is(err, rulestore.ErrGroupNotFound) {
+		level.Error(logger).Log("msg", "failed to revert the rule group copied to the destination tenant, the rule group is owned by both tenants", "err", err)
+		return
+	}
+	level.Info(logger).Log("msg", "audit: deleted rule group copied to the destination tenant because the transfer failed")
+}
@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/weaveworks/common/user"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/ruler/rulespb"
+	"github.com/grafana/mimir/pkg/ruler/rulestore"
+	"github.com/grafana/mimir/pkg/ruler/rulestore/bucketclient"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestRuler_TransferRuleGroup(t *testing.T) {
+	newGroup := func(userID, namespace, name string) *rulespb.RuleGroupDesc {
+		rg := rulespb.ToProto(userID, namespace, rulefmt.RuleGroup{
+			Name:     name,
+			Interval: 0,
+			Rules: []rulefmt.RuleNode{
+				{Record: yaml.Node{Kind: yaml.ScalarNode, Value: "up:sum"}, Expr: yaml.Node{Kind: yaml.ScalarNode, Value: "sum(up)"}},
+			},
+		})
+		rg.Interval = time.Minute
+		rg.SourceTenants = []string{"tenant-a", "tenant-b"}
+		return rg
+	}
+
+	tests := map[string]struct {
+		setup            map[string][]*rulespb.RuleGroupDesc
+		orgID            string
+		params           url.Values
+		maxRuleGroups    int
+		expectedStatus   int
+		expectedRemained map[string][]string
+	}{
+		"should transfer the rule group to the destination tenant": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1"), newGroup("user-1", "ns", "group-2")},
+			},
+			orgID:          "user-1|user-2",
+			params:         url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-1"}},
+			expectedStatus: http.StatusOK,
+			expectedRemained: map[string][]string{
+				"user-1": {"group-2"},
+				"user-2": {"group-1"},
+			},
+		},
+		"should fail if the request is not authenticated": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+			},
+			params:           url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-1"}},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedRemained: map[string][]string{"user-1": {"group-1"}},
+		},
+		"should fail if the request is not authenticated for the destination tenant": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+			},
+			orgID:            "user-1",
+			params:           url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-1"}},
+			expectedStatus:   http.StatusForbidden,
+			expectedRemained: map[string][]string{"user-1": {"group-1"}},
+		},
+		"should fail if a parameter is missing": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+			},
+			orgID:            "user-1|user-2",
+			params:           url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedRemained: map[string][]string{"user-1": {"group-1"}},
+		},
+		"should fail if the source and destination tenants are the same": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+			},
+			orgID:            "user-1",
+			params:           url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-1"}, "namespace": {"ns"}, "group": {"group-1"}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedRemained: map[string][]string{"user-1": {"group-1"}},
+		},
+		"should fail if the rule group doesn't exist": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+			},
+			orgID:            "user-1|user-2",
+			params:           url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-2"}},
+			expectedStatus:   http.StatusNotFound,
+			expectedRemained: map[string][]string{"user-1": {"group-1"}},
+		},
+		"should fail if the rule group already exists in the destination tenant": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+				"user-2": {newGroup("user-2", "ns", "group-1")},
+			},
+			orgID:          "user-1|user-2",
+			params:         url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-1"}},
+			expectedStatus: http.StatusConflict,
+			expectedRemained: map[string][]string{
+				"user-1": {"group-1"},
+				"user-2": {"group-1"},
+			},
+		},
+		"should fail if the destination tenant would exceed the max rule groups": {
+			setup: map[string][]*rulespb.RuleGroupDesc{
+				"user-1": {newGroup("user-1", "ns", "group-1")},
+				"user-2": {newGroup("user-2", "ns", "group-2")},
+			},
+			orgID:          "user-1|user-2",
+			params:         url.Values{"from_tenant": {"user-1"}, "to_tenant": {"user-2"}, "namespace": {"ns"}, "group": {"group-1"}},
+			maxRuleGroups:  1,
+			expectedStatus: http.StatusBadRequest,
+			expectedRemained: map[string][]string{
+				"user-1": {"group-1"},
+				"user-2": {"group-2"},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			store := bucketclient.NewBucketRuleStore(objstore.NewInMemBucket(), nil, log.NewNopLogger())
+			for userID, groups := range testData.setup {
+				for _, rg := range groups {
+					require.NoError(t, store.SetRuleGroup(ctx, userID, rg.Namespace, rg))
+				}
+			}
+
+			limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+				defaults.RulerMaxRuleGroupsPerTenant = testData.maxRuleGroups
+			})
+
+			r, err := NewRuler(defaultRulerConfig(t), nil, nil, log.NewNopLogger(), store, limits, nil, nil)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/ruler/api/v1/rules/transfer?"+testData.params.Encode(), nil)
+			if testData.orgID != "" {
+				req = req.WithContext(user.InjectOrgID(req.Context(), testData.orgID))
+			}
+			resp := httptest.NewRecorder()
+			r.TransferRuleGroup(resp, req)
+			assert.Equal(t, testData.expectedStatus, resp.Code, resp.Body.String())
+
+			for userID, expectedGroups := range testData.expectedRemained {
+				list, err := store.ListRuleGroupsForUserAndNamespace(ctx, userID, "")
+				require.NoError(t, err)
+
+				var actualGroups []string
+				for _, rg := range list {
+					actualGroups = append(actualGroups, rg.Name)
+				}
+				assert.ElementsMatch(t, expectedGroups, actualGroups, "user: %s", userID)
+			}
+
+			if testData.expectedStatus != http.StatusOK {
+				return
+			}
+
+			// The transferred rule group should preserve all its settings.
+			from := testData.params.Get("from_tenant")
+			to := testData.params.Get("to_tenant")
+			expected := newGroup(to, testData.params.Get("namespace"), testData.params.Get("group"))
+
+			actual, err := store.GetRuleGroup(ctx, to, expected.Namespace, expected.Name)
+			require.NoError(t, err)
+			assert.True(t, expected.Equal(actual), "expected: %s actual: %s", expected, actual)
+
+			_, err = store.GetRuleGroup(ctx, from, expected.Namespace, expected.Name)
+			assert.ErrorIs(t, err, rulestore.ErrGroupNotFound)
+		})
+	}
+}
+
+func TestRuler_TransferRuleGroup_ShouldRevertTheCopyOnFailure(t *testing.T) {
+	newGroup := func(userID, expr string) *rulespb.RuleGroupDesc {
+		return rulespb.ToProto(userID, "ns", rulefmt.RuleGroup{
+			Name: "group-1",
+			Rules: []rulefmt.RuleNode{
+				{Record: yaml.Node{Kind: yaml.ScalarNode, Value: "up:sum"}, Expr: yaml.Node{Kind: yaml.ScalarNode, Value: expr}},
+			},
+		})
+	}
+
+	tests := map[string]struct {
+		onCopy         func(ctx context.Context, store rulestore.RuleStore) error
+		deleteErr      error
+		expectedStatus int
+		expectedExpr   string
+	}{
+		"should revert the copy if the source rule group can't be deleted": {
+			deleteErr:      errors.New("delete failed"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedExpr:   "sum(up)",
+		},
+		"should revert the copy if the source rule group is changed during the transfer": {
+			onCopy: func(ctx context.Context, store rulestore.RuleStore) error {
+				return store.SetRuleGroup(ctx, "user-1", "ns", newGroup("user-1", "max(up)"))
+			},
+			expectedStatus: http.StatusConflict,
+			expectedExpr:   "max(up)",
+		},
+		"should revert the copy if the source rule group is deleted during the transfer": {
+			onCopy: func(ctx context.Context, store rulestore.RuleStore) error {
+				return store.DeleteRuleGroup(ctx, "user-1", "ns", "group-1")
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			store := bucketclient.NewBucketRuleStore(objstore.NewInMemBucket(), nil, log.NewNopLogger())
+			require.NoError(t, store.SetRuleGroup(ctx, "user-1", "ns", newGroup("user-1", "sum(up)")))
+
+			failing := &transferFailingRuleStore{RuleStore: store, deleteErr: testData.deleteErr}
+			failing.onCopy = func() error {
+				if testData.onCopy == nil {
+					return nil
+				}
+				return testData.onCopy(ctx, store)
+			}
+
+			r, err := NewRuler(defaultRulerConfig(t), nil, nil, log.NewNopLogger(), failing, validation.MockDefaultOverrides(), nil, nil)
+			require.NoError(t, err)
+
+			status, err := r.transferRuleGroup(ctx, log.NewNopLogger(), "user-1", "user-2", "ns", "group-1")
+			require.Error(t, err)
+			assert.Equal(t, testData.expectedStatus, status)
+
+			// The copy should have been deleted from the destination tenant.
+			_, err = store.GetRuleGroup(ctx, "user-2", "ns", "group-1")
+			assert.ErrorIs(t, err, rulestore.ErrGroupNotFound)
+
+			// The source rule group, including its changes, should be left untouched.
+			source, err := store.GetRuleGroup(ctx, "user-1", "ns", "group-1")
+			if testData.expectedExpr == "" {
+				assert.ErrorIs(t, err, rulestore.ErrGroupNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedExpr, source.Rules[0].Expr)
+		})
+	}
+}
+
+// transferFailingRuleStore calls onCopy once a rule group is copied to the destination tenant, and fails
+// deleting the rule groups of the source tenant with deleteErr, if set.
+type transferFailingRuleStore struct {
+	rulestore.RuleStore
+	onCopy    func() error
+	deleteErr error
+}
+
+func (s *transferFailingRuleStore) SetRuleGroup(ctx context.Context, userID, namespace string, group *rulespb.RuleGroupDesc) error {
+	if err := s.RuleStore.SetRuleGroup(ctx, userID, namespace, group); err != nil {
+		return err
+	}
+	return s.onCopy()
+}
+
+func (s *transferFailingRuleStore) DeleteRuleGroup(ctx context.Context, userID, namespace, group string) error {
+	if userID == "user-1" && s.deleteErr != nil {
+		return s.deleteErr
+	}
+	return s.RuleStore.DeleteRuleGroup(ctx, userID, namespace, group)
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	promRules "github.com/prometheus/prometheus/rules"
+
+	"github.com/grafana/mimir/pkg/util"
+	util_log "github.com/grafana/mimir/pkg/util/log"
+)
+
+var (
+	errPreviewMissingExpr  = errors.New("expr parameter is required")
+	errPreviewNotAvailable = errors.New("the recording rule preview is not available")
+)
+
+// PreviewRecordingRule evaluates a recording rule expression for the tenant at the requested time, without
+// storing the result, and returns the time series the recording rule would produce as a JSON array.
+//
+// The request parameters are the rule expression (expr), the optional name of the recording rule (record)
+// and the optional evaluation time (time), as a Unix timestamp or RFC3339 time. It defaults to now.
+func (r *Ruler) PreviewRecordingRule(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), r.logger)
+
+	if _, err := tenant.TenantID(req.Context()); err != nil {
+		// Auth Middleware sends http.StatusUnauthorized if X-Scope-OrgID is missing, so we do too here, for consistency.
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if r.previewQueryFunc == nil {
+		http.Error(w, errPreviewNotAvailable.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	rule, ts, err := parsePreviewRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := req.Context()
+	if r.cfg.PreviewTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.PreviewTimeout)
+		defer cancel()
+	}
+
+	vector, err := rule.Eval(ctx, 0, ts, r.previewQueryFunc, nil, 0)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		} else if errors.As(err, &QueryableError{}) {
+			status = http.StatusInternalServerError
+			level.Error(logger).Log("msg", "failed to preview recording rule", "expr", rule.Query().String(), "err", err)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if maxSeries := r.cfg.PreviewMaxSeries; maxSeries > 0 && len(vector) > maxSeries {
+		http.Error(w, fmt.Sprintf("the recording rule produces %d series, exceeding the max number of series of a preview (%d)", len(vector), maxSeries), http.StatusUnprocessableEntity)
+		return
+	}
+
+	samples := make([]model.Sample, 0, len(vector))
+	for _, s := range vector {
+		samples = append(samples, model.Sample{
+			Metric:    util.LabelsToMetric(s.Metric),
+			Value:     model.SampleValue(s.V),
+			Timestamp: model.Time(s.T),
+		})
+	}
+
+	util.WriteJSONResponse(w, samples)
+}
+
+// parsePreviewRequest returns the recording rule to preview and its evaluation time.
+func parsePreviewRequest(req *http.Request) (*promRules.RecordingRule, time.Time, error) {
+	expr := req.FormValue("expr")
+	if expr == "" {
+		return nil, time.Time{}, errPreviewMissingExpr
+	}
+
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "invalid expr")
+	}
+
+	record := req.FormValue("record")
+	if record != "" && !model.IsValidMetricName(model.LabelValue(record)) {
+		return nil, time.Time{}, fmt.Errorf("invalid recording rule name: %s", record)
+	}
+
+	ts := time.Now()
+	if t := req.FormValue("time"); t != "" {
+		ms, err := util.ParseTime(t)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		ts = util.TimeFromMillis(ms)
+	}
+
+	return promRules.NewRecordingRule(record, parsed, labels.Labels{}), ts, nil
+}
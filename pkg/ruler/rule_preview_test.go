@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ruler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+)
+
+func TestRuler_PreviewRecordingRule(t *testing.T) {
+	evalTime := time.Unix(1660000000, 0)
+
+	queryFunc := func(ctx context.Context, qs string, ts time.Time) (promql.Vector, error) {
+		switch qs {
+		case "up_by_job":
+			return promql.Vector{
+				{Metric: labels.FromStrings("job", "api"), Point: promql.Point{T: ts.UnixMilli(), V: 3}},
+				{Metric: labels.FromStrings("job", "web"), Point: promql.Point{T: ts.UnixMilli(), V: 1.5}},
+			}, nil
+		case "slow":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case "storage_failure":
+			return nil, WrapQueryableErrors(errors.New("storage failure"))
+		default:
+			return nil, errors.New("unexpected query")
+		}
+	}
+
+	tests := map[string]struct {
+		params           url.Values
+		orgID            string
+		disablePreviews  bool
+		maxSeries        int
+		expectedStatus   int
+		expectedBody     string
+		expectedErrorMsg string
+	}{
+		"should return the series produced by the recording rule": {
+			params:         url.Values{"record": {"job:up:sum"}, "expr": {"up_by_job"}, "time": {"1660000000"}},
+			expectedStatus: http.StatusOK,
+			expectedBody: `[
+				{"metric": {"__name__": "job:up:sum", "job": "api"}, "value": [1660000000, "3"]},
+				{"metric": {"__name__": "job:up:sum", "job": "web"}, "value": [1660000000, "1.5"]}
+			]`,
+		},
+		"should accept a RFC3339 evaluation time": {
+			params:         url.Values{"record": {"job:up:sum"}, "expr": {"up_by_job"}, "time": {evalTime.UTC().Format(time.RFC3339)}},
+			maxSeries:      2,
+			expectedStatus: http.StatusOK,
+			expectedBody: `[
+				{"metric": {"__name__": "job:up:sum", "job": "api"}, "value": [1660000000, "3"]},
+				{"metric": {"__name__": "job:up:sum", "job": "web"}, "value": [1660000000, "1.5"]}
+			]`,
+		},
+		"should fail if the recording rule produces more series than the limit": {
+			params:           url.Values{"expr": {"up_by_job"}},
+			maxSeries:        1,
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedErrorMsg: "the recording rule produces 2 series, exceeding the max number of series of a preview (1)",
+		},
+		"should fail if the expr parameter is missing": {
+			params:           url.Values{"record": {"job:up:sum"}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorMsg: errPreviewMissingExpr.Error(),
+		},
+		"should fail if the expr is invalid": {
+			params:           url.Values{"expr": {"sum("}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorMsg: "invalid expr",
+		},
+		"should fail if the recording rule name is invalid": {
+			params:           url.Values{"record": {"job-up"}, "expr": {"up"}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorMsg: "invalid recording rule name: job-up",
+		},
+		"should fail if the evaluation time is invalid": {
+			params:           url.Values{"expr": {"up"}, "time": {"yesterday"}},
+			expectedStatus:   http.StatusBadRequest,
+			expectedErrorMsg: `cannot parse "yesterday" to a valid timestamp`,
+		},
+		"should fail if the evaluation times out": {
+			params:         url.Values{"expr": {"slow"}},
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		"should fail if the storage fails": {
+			params:           url.Values{"expr": {"storage_failure"}},
+			expectedStatus:   http.StatusInternalServerError,
+			expectedErrorMsg: "storage failure",
+		},
+		"should fail if the tenant is missing": {
+			params:         url.Values{"expr": {"up"}},
+			orgID:          "-",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"should fail if the previews are not available": {
+			params:          url.Values{"expr": {"up"}},
+			disablePreviews: true,
+			expectedStatus:  http.StatusNotImplemented,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := defaultRulerConfig(t)
+			cfg.PreviewMaxSeries = testData.maxSeries
+			cfg.PreviewTimeout = 100 * time.Millisecond
+
+			qf := promRules.QueryFunc(queryFunc)
+			if testData.disablePreviews {
+				qf = nil
+			}
+
+			r, err := NewRuler(cfg, nil, nil, log.NewNopLogger(), nil, nil, nil, qf)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/ruler/api/v1/rules/preview", strings.NewReader(testData.params.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if testData.orgID != "-" {
+				req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+			}
+
+			resp := httptest.NewRecorder()
+			r.PreviewRecordingRule(resp, req)
+			require.Equal(t, testData.expectedStatus, resp.Code, resp.Body.String())
+
+			if testData.expectedBody != "" {
+				assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+				assert.JSONEq(t, testData.expectedBody, resp.Body.String())
+			}
+			if testData.expectedErrorMsg != "" {
+				assert.Contains(t, resp.Body.String(), testData.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -46,6 +47,9 @@ import (
 
 var (
 	errInvalidTenantShardSize = errors.New("invalid tenant shard size, the value must be greater or equal to 0")
+
+	errInvalidAlertmanagerFallbackURL           = errors.New("the Alertmanager fallback URL must be an HTTP or HTTPS URL")
+	errInvalidAlertmanagerFallbackAfterFailures = errors.New("the number of failures after which the Alertmanager fallback is used must be greater than 0")
 )
 
 const (
@@ -93,6 +97,12 @@ type Config struct {
 	NotificationTimeout time.Duration `yaml:"notification_timeout" category:"advanced"`
 	// Client configs for interacting with the Alertmanager
 	Notifier NotifierConfig `yaml:"alertmanager_client"`
+	// URL of the Alertmanager to send notifications to when the primary ones are unreachable.
+	AlertmanagerFallbackURL flagext.URLValue `yaml:"alertmanager_fallback_url" category:"experimental"`
+	// Number of consecutive failed requests to the primary Alertmanager after which the fallback one is used.
+	AlertmanagerFallbackAfterFailures int `yaml:"alertmanager_fallback_after_failures" category:"experimental"`
+	// How frequently to retry the primary Alertmanager while sending notifications to the fallback one.
+	AlertmanagerFallbackPrimaryRetryInterval time.Duration `yaml:"alertmanager_fallback_primary_retry_interval" category:"experimental"`
 
 	// Max time to tolerate outage for restoring "for" state of alert.
 	OutageTolerance time.Duration `yaml:"for_outage_tolerance" category:"advanced"`
@@ -100,6 +110,8 @@ type Config struct {
 	ForGracePeriod time.Duration `yaml:"for_grace_period" category:"advanced"`
 	// Minimum amount of time to wait before resending an alert to Alertmanager.
 	ResendDelay time.Duration `yaml:"resend_delay" category:"advanced"`
+	// Inject labels recording which tenant, rule group and rule produced each alert sent to the Alertmanager.
+	AlertSourceLabelsEnabled bool `yaml:"alert_source_labels_enabled" category:"experimental"`
 
 	// Enable sharding rule groups.
 	Ring RingConfig `yaml:"ring"`
@@ -116,6 +128,12 @@ type Config struct {
 	QueryFrontend QueryFrontendConfig `yaml:"query_frontend"`
 
 	TenantFederation TenantFederationConfig `yaml:"tenant_federation"`
+
+	MetricsExport RuleGroupMetricsExporterConfig `yaml:"metrics_export"`
+
+	// Max number of series and timeout of the recording rules previews.
+	PreviewMaxSeries int           `yaml:"preview_max_series" category:"experimental"`
+	PreviewTimeout   time.Duration `yaml:"preview_timeout" category:"experimental"`
 }
 
 // Validate config and returns error on failure
@@ -127,6 +145,17 @@ func (cfg *Config) Validate(limits validation.Limits, log log.Logger) error {
 	if err := cfg.ClientTLSConfig.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid ruler gRPC client config")
 	}
+	if u := cfg.AlertmanagerFallbackURL.URL; u != nil && u.String() != "" {
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errInvalidAlertmanagerFallbackURL
+		}
+		if cfg.AlertmanagerFallbackAfterFailures <= 0 {
+			return errInvalidAlertmanagerFallbackAfterFailures
+		}
+	}
+	if err := cfg.MetricsExport.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ruler metrics export config")
+	}
 	return nil
 }
 
@@ -137,6 +166,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.Notifier.RegisterFlags(f)
 	cfg.TenantFederation.RegisterFlags(f)
 	cfg.QueryFrontend.RegisterFlags(f)
+	cfg.MetricsExport.RegisterFlags(f)
 
 	cfg.ExternalURL.URL, _ = url.Parse("") // Must be non-nil
 	f.Var(&cfg.ExternalURL, "ruler.external.url", "URL of alerts return path.")
@@ -147,18 +177,25 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.DurationVar(&cfg.AlertmanagerRefreshInterval, "ruler.alertmanager-refresh-interval", 1*time.Minute, "How long to wait between refreshing DNS resolutions of Alertmanager hosts.")
 	f.IntVar(&cfg.NotificationQueueCapacity, "ruler.notification-queue-capacity", 10000, "Capacity of the queue for notifications to be sent to the Alertmanager.")
 	f.DurationVar(&cfg.NotificationTimeout, "ruler.notification-timeout", 10*time.Second, "HTTP timeout duration when sending notifications to the Alertmanager.")
+	f.Var(&cfg.AlertmanagerFallbackURL, "ruler.alertmanager-fallback-url", "URL of an external Alertmanager to send notifications to when the primary Alertmanager is unreachable. Basic auth is supported as part of the URL. Empty to disable.")
+	f.IntVar(&cfg.AlertmanagerFallbackAfterFailures, "ruler.alertmanager-fallback-after-failures", 3, "Number of consecutive failed requests to the primary Alertmanager after which notifications are sent to the fallback Alertmanager.")
+	f.DurationVar(&cfg.AlertmanagerFallbackPrimaryRetryInterval, "ruler.alertmanager-fallback-primary-retry-interval", time.Minute, "How frequently to retry sending notifications to the primary Alertmanager while the fallback Alertmanager is used.")
 
 	f.StringVar(&cfg.RulePath, "ruler.rule-path", "./data-ruler/", "Directory to store temporary rule files loaded by the Prometheus rule managers. This directory is not required to be persisted between restarts.")
 	f.BoolVar(&cfg.EnableAPI, "ruler.enable-api", true, "Enable the ruler config API.")
 	f.DurationVar(&cfg.OutageTolerance, "ruler.for-outage-tolerance", time.Hour, `Max time to tolerate outage for restoring "for" state of alert.`)
 	f.DurationVar(&cfg.ForGracePeriod, "ruler.for-grace-period", 10*time.Minute, `Minimum duration between alert and restored "for" state. This is maintained only for alerts with configured "for" time greater than grace period.`)
 	f.DurationVar(&cfg.ResendDelay, "ruler.resend-delay", time.Minute, `Minimum amount of time to wait before resending an alert to Alertmanager.`)
+	f.BoolVar(&cfg.AlertSourceLabelsEnabled, "ruler.alert-source-labels-enabled", false, "Add the __ruler_tenant__, __ruler_rule_group__ and __ruler_rule_name__ labels to the alerts sent to the Alertmanager, recording which tenant, rule group and rule produced each alert. Enabling it changes the identity of the alerts already firing.")
 
 	f.Var(&cfg.EnabledTenants, "ruler.enabled-tenants", "Comma separated list of tenants whose rules this ruler can evaluate. If specified, only these tenants will be handled by ruler, otherwise this ruler can process rules from all tenants. Subject to sharding.")
 	f.Var(&cfg.DisabledTenants, "ruler.disabled-tenants", "Comma separated list of tenants whose rules this ruler cannot evaluate. If specified, a ruler that would normally pick the specified tenant(s) for processing will ignore them instead. Subject to sharding.")
 
 	f.BoolVar(&cfg.EnableQueryStats, "ruler.query-stats-enabled", false, "Report the wall time for ruler queries to complete as a per-tenant metric and as an info level log message.")
 
+	f.IntVar(&cfg.PreviewMaxSeries, "ruler.preview-max-series", 1000, "Maximum number of series a recording rule preview can return. The preview fails if the recording rule produces more series. 0 to disable the limit.")
+	f.DurationVar(&cfg.PreviewTimeout, "ruler.preview-timeout", 30*time.Second, "Timeout of the evaluation of a recording rule preview. 0 to disable the timeout.")
+
 	cfg.RingCheckPeriod = 5 * time.Second
 }
 
@@ -199,6 +236,9 @@ type MultiTenantManager interface {
 	SyncRuleGroups(ctx context.Context, ruleGroups map[string]rulespb.RuleGroupList)
 	// GetRules fetches rules for a particular tenant (userID).
 	GetRules(userID string) []*promRules.Group
+	// GetRuleGroupsLastEvaluationSamples returns the number of samples returned during the last evaluation
+	// of each rule group of a particular tenant (userID), by rule group key.
+	GetRuleGroupsLastEvaluationSamples(userID string) (map[string]float64, error)
 	// Stop stops all Manager components.
 	Stop()
 	// ValidateRuleGroup validates a rulegroup
@@ -250,15 +290,34 @@ type Ruler struct {
 	// Pool of clients used to connect to other ruler replicas.
 	clientsPool ClientsPool
 
+	// Optional exporter of the rule evaluation metrics to the object storage.
+	metricsExporter *RuleGroupMetricsExporter
+
+	// Function used to evaluate the recording rules previews. Nil if the previews are not available.
+	previewQueryFunc promRules.QueryFunc
+
 	allowedTenants *util.AllowedTenants
 
+	// Pre-parsed per-tenant alert annotation template snippets.
+	annotationTemplates *annotationTemplates
+
+	// Serializes the rule group transfers handled by this ruler.
+	transferMtx sync.Mutex
+
 	registry prometheus.Registerer
 	logger   log.Logger
 }
 
-// NewRuler creates a new ruler from a distributor and chunk store.
-func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer, logger log.Logger, ruleStore rulestore.RuleStore, limits RulesLimits) (*Ruler, error) {
-	return newRuler(cfg, manager, reg, logger, ruleStore, limits, newRulerClientPool(cfg.ClientTLSConfig, logger, reg))
+// NewRuler creates a new ruler from a distributor and chunk store. The metricsExporter and previewQueryFunc are optional.
+func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer, logger log.Logger, ruleStore rulestore.RuleStore, limits RulesLimits, metricsExporter *RuleGroupMetricsExporter, previewQueryFunc promRules.QueryFunc) (*Ruler, error) {
+	ruler, err := newRuler(cfg, manager, reg, logger, ruleStore, limits, newRulerClientPool(cfg.ClientTLSConfig, logger, reg))
+	if err != nil {
+		return nil, err
+	}
+
+	ruler.metricsExporter = metricsExporter
+	ruler.previewQueryFunc = previewQueryFunc
+	return ruler, nil
 }
 
 func newRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer, logger log.Logger, ruleStore rulestore.RuleStore, limits RulesLimits, clientPool ClientsPool) (*Ruler, error) {
@@ -272,6 +331,8 @@ func newRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer,
 		clientsPool:    clientPool,
 		allowedTenants: util.NewAllowedTenants(cfg.EnabledTenants, cfg.DisabledTenants),
 		metrics:        newRulerMetrics(reg),
+
+		annotationTemplates: newAnnotationTemplates(logger),
 	}
 
 	if len(cfg.EnabledTenants) > 0 {
@@ -328,7 +389,12 @@ func enableSharding(r *Ruler, ringStore kv.Client) error {
 func (r *Ruler) starting(ctx context.Context) error {
 	var err error
 
-	if r.subservices, err = services.NewManager(r.lifecycler, r.ring, r.clientsPool); err != nil {
+	subservices := []services.Service{r.lifecycler, r.ring, r.clientsPool}
+	if r.metricsExporter != nil {
+		subservices = append(subservices, r.metricsExporter)
+	}
+
+	if r.subservices, err = services.NewManager(subservices...); err != nil {
 		return errors.Wrap(err, "unable to start ruler subservices")
 	}
 
@@ -479,6 +545,9 @@ func (r *Ruler) syncRules(ctx context.Context, reason string) {
 	// Filter out all rules for which their evaluation has been disabled for the given tenant.
 	configs = filterRuleGroupsByEnabled(configs, r.limits, r.logger)
 
+	// Make the tenant's alert annotation template snippets available to alerting rules.
+	configs = r.annotationTemplates.apply(configs, r.limits)
+
 	// This will also delete local group files for users that are no longer in 'configs' map.
 	r.manager.SyncRuleGroups(ctx, configs)
 }
@@ -795,6 +864,7 @@ func (r *Ruler) Rules(ctx context.Context, in *RulesRequest) (*RulesResponse, er
 
 func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 	groups := r.manager.GetRules(userID)
+	annotationTemplates := r.annotationTemplates
 
 	groupDescs := make([]*GroupStateDesc, 0, len(groups))
 	prefix := filepath.Join(r.cfg.RulePath, userID) + "/"
@@ -850,7 +920,7 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 						Alert:       rule.Name(),
 						For:         rule.HoldDuration(),
 						Labels:      mimirpb.FromLabelsToLabelAdapters(rule.Labels()),
-						Annotations: mimirpb.FromLabelsToLabelAdapters(rule.Annotations()),
+						Annotations: mimirpb.FromLabelsToLabelAdapters(annotationTemplates.strip(userID, rule.Annotations())),
 					},
 					State:               rule.State().String(),
 					Health:              string(rule.Health()),
@@ -881,6 +951,171 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 	return groupDescs, nil
 }
 
+// GetRuleGroupEvalStats implements the ruler service, returning the evaluation statistics of the
+// rule groups of the tenant evaluated by this ruler.
+func (r *Ruler) GetRuleGroupEvalStats(ctx context.Context, _ *RuleGroupEvalStatsRequest) (*RuleGroupEvalStatsResponse, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no user id found in context")
+	}
+
+	stats, err := r.getLocalRuleGroupEvalStats(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuleGroupEvalStatsResponse{Groups: stats}, nil
+}
+
+func (r *Ruler) getLocalRuleGroupEvalStats(userID string, now time.Time) ([]*RuleGroupEvalStats, error) {
+	groups := r.manager.GetRules(userID)
+
+	samples, err := r.manager.GetRuleGroupsLastEvaluationSamples(userID)
+	if err != nil {
+		// The series count is only part of the statistics, so the other ones are returned anyway.
+		level.Warn(r.logger).Log("msg", "failed to get the number of samples of the last rule groups evaluation", "user", userID, "err", err)
+	}
+
+	stats := make([]*RuleGroupEvalStats, 0, len(groups))
+	prefix := filepath.Join(r.cfg.RulePath, userID) + "/"
+
+	for _, group := range groups {
+		// The mapped filename is url path escaped encoded to make handling `/` characters easier
+		decodedNamespace, err := url.PathUnescape(strings.TrimPrefix(group.File(), prefix))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode rule filename")
+		}
+
+		lastError := ""
+		for _, rule := range group.Rules() {
+			if err := rule.LastError(); err != nil {
+				lastError = fmt.Sprintf("rule %s: %s", rule.Name(), err.Error())
+				break
+			}
+		}
+
+		stats = append(stats, &RuleGroupEvalStats{
+			Namespace:               decodedNamespace,
+			Name:                    group.Name(),
+			LastEvaluationTimestamp: group.GetLastEvaluation(),
+			LastEvaluationDuration:  group.GetEvaluationTime(),
+			LastError:               lastError,
+			SeriesCount:             int64(samples[promRules.GroupKey(group.File(), group.Name())]),
+			NextEvaluationTimestamp: group.EvalTimestamp(now.UnixNano()).Add(group.Interval()),
+		})
+	}
+	return stats, nil
+}
+
+// getRuleGroupEvalStats retrieves the evaluation statistics of the rule groups from this ruler and all running rulers in the ring.
+func (r *Ruler) getRuleGroupEvalStats(ctx context.Context) ([]*RuleGroupEvalStats, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no user id found in context")
+	}
+
+	ring := ring.ReadRing(r.ring)
+
+	if shardSize := r.limits.RulerTenantShardSize(userID); shardSize > 0 {
+		ring = r.ring.ShuffleShard(userID, shardSize)
+	}
+
+	rulers, err := ring.GetReplicationSetForOperation(RingOp)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = user.InjectIntoGRPCRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to inject user ID into grpc request, %v", err)
+	}
+
+	var (
+		mergedMx sync.Mutex
+		merged   []*RuleGroupEvalStats
+	)
+
+	// Concurrently fetch the statistics from all rulers, since each rule group is evaluated by a single ruler.
+	addrs := rulers.GetAddresses()
+	err = concurrency.ForEachJob(ctx, len(addrs), len(addrs), func(ctx context.Context, idx int) error {
+		addr := addrs[idx]
+
+		rulerClient, err := r.clientsPool.GetClientFor(addr)
+		if err != nil {
+			return errors.Wrapf(err, "unable to get client for ruler %s", addr)
+		}
+
+		resp, err := rulerClient.GetRuleGroupEvalStats(ctx, &RuleGroupEvalStatsRequest{})
+		if err != nil {
+			return errors.Wrapf(err, "unable to retrieve rule group evaluation statistics from ruler %s", addr)
+		}
+
+		mergedMx.Lock()
+		merged = append(merged, resp.Groups...)
+		mergedMx.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Namespace != merged[j].Namespace {
+			return merged[i].Namespace < merged[j].Namespace
+		}
+		return merged[i].Name < merged[j].Name
+	})
+	return merged, nil
+}
+
+// ruleGroupEvalStatsJSON is the JSON representation of RuleGroupEvalStats returned by the HTTP API.
+type ruleGroupEvalStatsJSON struct {
+	Namespace      string    `json:"namespace"`
+	Name           string    `json:"name"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastError      string    `json:"lastError"`
+	SeriesCount    int64     `json:"seriesCount"`
+	NextEvaluation time.Time `json:"nextEvaluation"`
+}
+
+// RuleGroupEvalStatsHandler returns the evaluation statistics of all the rule groups of the tenant, across all rulers.
+func (r *Ruler) RuleGroupEvalStatsHandler(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), r.logger)
+
+	if _, err := tenant.TenantID(req.Context()); err != nil {
+		// Auth Middleware sends http.StatusUnauthorized if X-Scope-OrgID is missing, so we do too here, for consistency.
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	stats, err := r.getRuleGroupEvalStats(req.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get rule group evaluation statistics", "err", err)
+		respondError(logger, w, err.Error())
+		return
+	}
+
+	groups := make([]ruleGroupEvalStatsJSON, 0, len(stats))
+	for _, s := range stats {
+		groups = append(groups, ruleGroupEvalStatsJSON{
+			Namespace:      s.Namespace,
+			Name:           s.Name,
+			LastEvaluation: s.LastEvaluationTimestamp,
+			EvaluationTime: s.LastEvaluationDuration.Seconds(),
+			LastError:      s.LastError,
+			SeriesCount:    s.SeriesCount,
+			NextEvaluation: s.NextEvaluationTimestamp,
+		})
+	}
+
+	util.WriteJSONResponse(w, response{
+		Status: "success",
+		Data:   map[string]interface{}{"groups": groups},
+	})
+}
+
 // AssertMaxRuleGroups limit has not been reached compared to the current
 // number of total rule groups in input and returns an error if so.
 func (r *Ruler) AssertMaxRuleGroups(userID string, rg int) error {
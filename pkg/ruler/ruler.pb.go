@@ -116,6 +116,178 @@ func (m *RulesResponse) GetGroups() []*GroupStateDesc {
 	return nil
 }
 
+type RuleGroupEvalStatsRequest struct {
+}
+
+func (m *RuleGroupEvalStatsRequest) Reset()      { *m = RuleGroupEvalStatsRequest{} }
+func (*RuleGroupEvalStatsRequest) ProtoMessage() {}
+func (*RuleGroupEvalStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_9ecbec0a4cfddea6, []int{2}
+}
+func (m *RuleGroupEvalStatsRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RuleGroupEvalStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RuleGroupEvalStatsRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RuleGroupEvalStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RuleGroupEvalStatsRequest.Merge(m, src)
+}
+func (m *RuleGroupEvalStatsRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *RuleGroupEvalStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RuleGroupEvalStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RuleGroupEvalStatsRequest proto.InternalMessageInfo
+
+type RuleGroupEvalStatsResponse struct {
+	Groups []*RuleGroupEvalStats `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups,omitempty"`
+}
+
+func (m *RuleGroupEvalStatsResponse) Reset()      { *m = RuleGroupEvalStatsResponse{} }
+func (*RuleGroupEvalStatsResponse) ProtoMessage() {}
+func (*RuleGroupEvalStatsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_9ecbec0a4cfddea6, []int{3}
+}
+func (m *RuleGroupEvalStatsResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RuleGroupEvalStatsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RuleGroupEvalStatsResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RuleGroupEvalStatsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RuleGroupEvalStatsResponse.Merge(m, src)
+}
+func (m *RuleGroupEvalStatsResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *RuleGroupEvalStatsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RuleGroupEvalStatsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RuleGroupEvalStatsResponse proto.InternalMessageInfo
+
+func (m *RuleGroupEvalStatsResponse) GetGroups() []*RuleGroupEvalStats {
+	if m != nil {
+		return m.Groups
+	}
+	return nil
+}
+
+// RuleGroupEvalStats is the evaluation statistics of a rule group.
+type RuleGroupEvalStats struct {
+	Namespace               string        `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name                    string        `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	LastEvaluationTimestamp time.Time     `protobuf:"bytes,3,opt,name=last_evaluation_timestamp,json=lastEvaluationTimestamp,proto3,stdtime" json:"last_evaluation_timestamp"`
+	LastEvaluationDuration  time.Duration `protobuf:"bytes,4,opt,name=last_evaluation_duration,json=lastEvaluationDuration,proto3,stdduration" json:"last_evaluation_duration"`
+	// The error of the first rule of the group which failed the last evaluation, if any.
+	LastError string `protobuf:"bytes,5,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	// The number of series returned by the rules of the group in the last evaluation.
+	SeriesCount             int64     `protobuf:"varint,6,opt,name=series_count,json=seriesCount,proto3" json:"series_count,omitempty"`
+	NextEvaluationTimestamp time.Time `protobuf:"bytes,7,opt,name=next_evaluation_timestamp,json=nextEvaluationTimestamp,proto3,stdtime" json:"next_evaluation_timestamp"`
+}
+
+func (m *RuleGroupEvalStats) Reset()      { *m = RuleGroupEvalStats{} }
+func (*RuleGroupEvalStats) ProtoMessage() {}
+func (*RuleGroupEvalStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_9ecbec0a4cfddea6, []int{4}
+}
+func (m *RuleGroupEvalStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *RuleGroupEvalStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_RuleGroupEvalStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *RuleGroupEvalStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RuleGroupEvalStats.Merge(m, src)
+}
+func (m *RuleGroupEvalStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *RuleGroupEvalStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_RuleGroupEvalStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RuleGroupEvalStats proto.InternalMessageInfo
+
+func (m *RuleGroupEvalStats) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *RuleGroupEvalStats) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *RuleGroupEvalStats) GetLastEvaluationTimestamp() time.Time {
+	if m != nil {
+		return m.LastEvaluationTimestamp
+	}
+	return time.Time{}
+}
+
+func (m *RuleGroupEvalStats) GetLastEvaluationDuration() time.Duration {
+	if m != nil {
+		return m.LastEvaluationDuration
+	}
+	return 0
+}
+
+func (m *RuleGroupEvalStats) GetLastError() string {
+	if m != nil {
+		return m.LastError
+	}
+	return ""
+}
+
+func (m *RuleGroupEvalStats) GetSeriesCount() int64 {
+	if m != nil {
+		return m.SeriesCount
+	}
+	return 0
+}
+
+func (m *RuleGroupEvalStats) GetNextEvaluationTimestamp() time.Time {
+	if m != nil {
+		return m.NextEvaluationTimestamp
+	}
+	return time.Time{}
+}
+
 // GroupStateDesc is a proto representation of a mimir rule group
 type GroupStateDesc struct {
 	Group               *rulespb.RuleGroupDesc `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
@@ -127,7 +299,7 @@ type GroupStateDesc struct {
 func (m *GroupStateDesc) Reset()      { *m = GroupStateDesc{} }
 func (*GroupStateDesc) ProtoMessage() {}
 func (*GroupStateDesc) Descriptor() ([]byte, []int) {
-	return fileDescriptor_9ecbec0a4cfddea6, []int{2}
+	return fileDescriptor_9ecbec0a4cfddea6, []int{5}
 }
 func (m *GroupStateDesc) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -198,7 +370,7 @@ type RuleStateDesc struct {
 func (m *RuleStateDesc) Reset()      { *m = RuleStateDesc{} }
 func (*RuleStateDesc) ProtoMessage() {}
 func (*RuleStateDesc) Descriptor() ([]byte, []int) {
-	return fileDescriptor_9ecbec0a4cfddea6, []int{3}
+	return fileDescriptor_9ecbec0a4cfddea6, []int{6}
 }
 func (m *RuleStateDesc) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -291,7 +463,7 @@ type AlertStateDesc struct {
 func (m *AlertStateDesc) Reset()      { *m = AlertStateDesc{} }
 func (*AlertStateDesc) ProtoMessage() {}
 func (*AlertStateDesc) Descriptor() ([]byte, []int) {
-	return fileDescriptor_9ecbec0a4cfddea6, []int{4}
+	return fileDescriptor_9ecbec0a4cfddea6, []int{7}
 }
 func (m *AlertStateDesc) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -372,6 +544,9 @@ func (m *AlertStateDesc) GetValidUntil() time.Time {
 func init() {
 	proto.RegisterType((*RulesRequest)(nil), "ruler.RulesRequest")
 	proto.RegisterType((*RulesResponse)(nil), "ruler.RulesResponse")
+	proto.RegisterType((*RuleGroupEvalStatsRequest)(nil), "ruler.RuleGroupEvalStatsRequest")
+	proto.RegisterType((*RuleGroupEvalStatsResponse)(nil), "ruler.RuleGroupEvalStatsResponse")
+	proto.RegisterType((*RuleGroupEvalStats)(nil), "ruler.RuleGroupEvalStats")
 	proto.RegisterType((*GroupStateDesc)(nil), "ruler.GroupStateDesc")
 	proto.RegisterType((*RuleStateDesc)(nil), "ruler.RuleStateDesc")
 	proto.RegisterType((*AlertStateDesc)(nil), "ruler.AlertStateDesc")
@@ -380,50 +555,61 @@ func init() {
 func init() { proto.RegisterFile("ruler.proto", fileDescriptor_9ecbec0a4cfddea6) }
 
 var fileDescriptor_9ecbec0a4cfddea6 = []byte{
-	// 682 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x54, 0xcd, 0x6e, 0x13, 0x3b,
-	0x14, 0x1e, 0xa7, 0x4d, 0x9a, 0x38, 0xbd, 0xbd, 0x92, 0x9b, 0x7b, 0x35, 0x44, 0xc8, 0xa9, 0xc2,
-	0xa6, 0x42, 0xea, 0x04, 0x4a, 0x05, 0x62, 0x01, 0x28, 0x55, 0x0b, 0x1b, 0x16, 0x68, 0x0a, 0x6c,
-	0x2b, 0x4f, 0xe2, 0x4c, 0x47, 0x4c, 0xc6, 0x83, 0xed, 0x89, 0x58, 0xf2, 0x08, 0x5d, 0xb2, 0x66,
-	0xc5, 0xa3, 0x74, 0xd9, 0x65, 0x85, 0x50, 0xa1, 0xd3, 0x0d, 0xcb, 0x3e, 0x02, 0xf2, 0xf1, 0x84,
-	0x24, 0x50, 0x10, 0x11, 0xea, 0x26, 0xf1, 0xf9, 0xf9, 0xbe, 0x73, 0xce, 0x77, 0xc6, 0xc6, 0x75,
-	0x99, 0xc5, 0x5c, 0x7a, 0xa9, 0x14, 0x5a, 0x90, 0x32, 0x18, 0xcd, 0x8d, 0x30, 0xd2, 0x07, 0x59,
-	0xe0, 0xf5, 0xc4, 0xb0, 0x13, 0x8a, 0x50, 0x74, 0x20, 0x1a, 0x64, 0x03, 0xb0, 0xc0, 0x80, 0x93,
-	0x45, 0x35, 0x69, 0x28, 0x44, 0x18, 0xf3, 0x49, 0x56, 0x3f, 0x93, 0x4c, 0x47, 0x22, 0x29, 0xe2,
-	0xad, 0x1f, 0xe3, 0x3a, 0x1a, 0x72, 0xa5, 0xd9, 0x30, 0x2d, 0x12, 0x6e, 0x4d, 0xd7, 0x93, 0x6c,
-	0xc0, 0x12, 0xd6, 0x19, 0x46, 0xc3, 0x48, 0x76, 0xd2, 0x57, 0xa1, 0x3d, 0xa5, 0x81, 0xfd, 0x2f,
-	0x10, 0x77, 0x7f, 0x8b, 0x80, 0x29, 0xe0, 0x57, 0xa5, 0x81, 0xfd, 0xb7, 0xb8, 0xf6, 0x0a, 0x5e,
-	0xf6, 0x8d, 0xe9, 0xf3, 0xd7, 0x19, 0x57, 0xba, 0xfd, 0x10, 0xff, 0x53, 0xd8, 0x2a, 0x15, 0x89,
-	0xe2, 0x64, 0x03, 0x57, 0x42, 0x29, 0xb2, 0x54, 0xb9, 0x68, 0x6d, 0x61, 0xbd, 0xbe, 0xf9, 0x9f,
-	0x67, 0xf5, 0x79, 0x62, 0x9c, 0x7b, 0x9a, 0x69, 0xbe, 0xc3, 0x55, 0xcf, 0x2f, 0x92, 0xda, 0xef,
-	0x4b, 0x78, 0x65, 0x36, 0x44, 0x6e, 0xe2, 0x32, 0x04, 0x5d, 0xb4, 0x86, 0xd6, 0xeb, 0x9b, 0x0d,
-	0xcf, 0xd6, 0x37, 0x65, 0x20, 0x13, 0xf0, 0x36, 0x85, 0xdc, 0xc3, 0xcb, 0xac, 0xa7, 0xa3, 0x11,
-	0xdf, 0x87, 0x24, 0xb7, 0x04, 0x35, 0x1b, 0x45, 0x4d, 0x03, 0x99, 0x94, 0xac, 0xdb, 0x4c, 0x68,
-	0x97, 0xbc, 0xc4, 0xab, 0x7c, 0xc4, 0xe2, 0x0c, 0x64, 0x7e, 0x3e, 0x96, 0xd3, 0x5d, 0x80, 0x92,
-	0x4d, 0xcf, 0x0a, 0xee, 0x8d, 0x05, 0xf7, 0xbe, 0x67, 0x6c, 0x57, 0x8f, 0x4e, 0x5b, 0xce, 0xe1,
-	0xe7, 0x16, 0xf2, 0x2f, 0x23, 0x20, 0x7b, 0x98, 0x4c, 0xdc, 0x3b, 0xc5, 0x1a, 0xdd, 0x45, 0xa0,
-	0xbd, 0xf6, 0x13, 0xed, 0x38, 0xc1, 0xb2, 0xbe, 0x33, 0xac, 0x97, 0xc0, 0xdb, 0x9f, 0x4a, 0x56,
-	0xe5, 0x89, 0x46, 0x37, 0xf0, 0xa2, 0x19, 0xb1, 0x90, 0xe8, 0xdf, 0x29, 0x89, 0x60, 0x54, 0x08,
-	0x92, 0x06, 0x2e, 0x2b, 0x83, 0x70, 0x4b, 0x6b, 0x68, 0xbd, 0xe6, 0x5b, 0x83, 0xfc, 0x8f, 0x2b,
-	0x07, 0x9c, 0xc5, 0xfa, 0x00, 0x86, 0xad, 0xf9, 0x85, 0x45, 0xae, 0xe3, 0x5a, 0xcc, 0x94, 0xde,
-	0x95, 0x52, 0x48, 0x68, 0xb8, 0xe6, 0x4f, 0x1c, 0x66, 0xad, 0x2c, 0xe6, 0x52, 0x2b, 0xb7, 0x3c,
-	0xb3, 0xd6, 0xae, 0x71, 0x4e, 0xad, 0xd5, 0x26, 0xfd, 0x4a, 0xde, 0xca, 0xd5, 0xc8, 0xbb, 0xf4,
-	0x77, 0xf2, 0x5e, 0x2c, 0xe2, 0x95, 0xd9, 0x39, 0x26, 0xd2, 0xa1, 0x69, 0xe9, 0x06, 0xb8, 0x12,
-	0xb3, 0x80, 0xc7, 0xe3, 0xef, 0x6c, 0xd5, 0xeb, 0x09, 0xa9, 0xf9, 0x9b, 0x34, 0xf0, 0x9e, 0x1a,
-	0xff, 0x33, 0x16, 0xc9, 0xed, 0xfb, 0xa6, 0xd6, 0xc7, 0xd3, 0xd6, 0xed, 0x3f, 0xb9, 0x93, 0x16,
-	0xd7, 0xed, 0xb3, 0x54, 0x73, 0xe9, 0x17, 0xec, 0x24, 0xc5, 0x75, 0x96, 0x24, 0x42, 0x43, 0x7b,
-	0xca, 0x5d, 0xb8, 0x92, 0x62, 0xd3, 0x25, 0xcc, 0xbc, 0x46, 0x17, 0x0e, 0x8b, 0x47, 0xbe, 0x35,
-	0x48, 0x17, 0xd7, 0x8a, 0xdb, 0xc5, 0xb4, 0x5b, 0x9e, 0x63, 0x77, 0x55, 0x0b, 0xeb, 0x6a, 0xf2,
-	0x08, 0x57, 0x07, 0x91, 0xe4, 0x7d, 0xc3, 0x30, 0xcf, 0xf6, 0x97, 0x00, 0xd5, 0xd5, 0x64, 0x17,
-	0xd7, 0x25, 0x57, 0x22, 0x1e, 0x59, 0x8e, 0xa5, 0x39, 0x38, 0xf0, 0x18, 0xd8, 0xd5, 0xe4, 0x31,
-	0x5e, 0x36, 0x1f, 0xf3, 0xbe, 0xe2, 0x89, 0x36, 0x3c, 0xd5, 0x79, 0x78, 0x0c, 0x72, 0x8f, 0x27,
-	0xda, 0xb6, 0x33, 0x62, 0x71, 0xd4, 0xdf, 0xcf, 0x12, 0x1d, 0xc5, 0x6e, 0x6d, 0x1e, 0x1a, 0x00,
-	0xbe, 0x30, 0xb8, 0xcd, 0x07, 0xb8, 0x6c, 0x2e, 0xab, 0x24, 0x5b, 0xf6, 0xa0, 0xc8, 0xea, 0xd4,
-	0x9b, 0x35, 0x7e, 0x5d, 0x9b, 0x8d, 0x59, 0xa7, 0x7d, 0x62, 0xdb, 0xce, 0xf6, 0xd6, 0xf1, 0x19,
-	0x75, 0x4e, 0xce, 0xa8, 0x73, 0x71, 0x46, 0xd1, 0xdb, 0x9c, 0xa2, 0x0f, 0x39, 0x45, 0x47, 0x39,
-	0x45, 0xc7, 0x39, 0x45, 0x5f, 0x72, 0x8a, 0xbe, 0xe6, 0xd4, 0xb9, 0xc8, 0x29, 0x3a, 0x3c, 0xa7,
-	0xce, 0xf1, 0x39, 0x75, 0x4e, 0xce, 0xa9, 0x13, 0x54, 0xa0, 0xbd, 0x3b, 0xdf, 0x02, 0x00, 0x00,
-	0xff, 0xff, 0x0c, 0x0b, 0x21, 0x72, 0xb2, 0x06, 0x00, 0x00,
+	// 851 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x55, 0x4d, 0x6f, 0xe3, 0x44,
+	0x18, 0xf6, 0xe4, 0xab, 0xc9, 0xeb, 0x50, 0xa4, 0x69, 0x76, 0x71, 0x02, 0x38, 0xd9, 0x70, 0x89,
+	0x90, 0xea, 0xb0, 0x61, 0x05, 0xe2, 0x02, 0x4a, 0xd9, 0xb2, 0x17, 0x24, 0x90, 0x0b, 0xdc, 0x20,
+	0x4c, 0x92, 0x49, 0x6a, 0xe1, 0xd8, 0x66, 0x66, 0x1c, 0xf5, 0xc8, 0x4f, 0xe8, 0x91, 0x0b, 0x17,
+	0x4e, 0x48, 0xfc, 0x91, 0x1e, 0x7b, 0xac, 0x10, 0x2a, 0x34, 0xbd, 0x70, 0xec, 0x4f, 0x40, 0x33,
+	0x63, 0xe7, 0xa3, 0x49, 0xab, 0x46, 0xab, 0x5e, 0xec, 0x79, 0x3f, 0x9e, 0xe7, 0x9d, 0xf7, 0x63,
+	0x66, 0xc0, 0x64, 0xb1, 0x4f, 0x99, 0x13, 0xb1, 0x50, 0x84, 0x38, 0xaf, 0x84, 0xda, 0xfe, 0xd8,
+	0x13, 0xc7, 0x71, 0xdf, 0x19, 0x84, 0x93, 0xf6, 0x38, 0x1c, 0x87, 0x6d, 0x65, 0xed, 0xc7, 0x23,
+	0x25, 0x29, 0x41, 0xad, 0x34, 0xaa, 0x66, 0x8f, 0xc3, 0x70, 0xec, 0xd3, 0x85, 0xd7, 0x30, 0x66,
+	0x44, 0x78, 0x61, 0x90, 0xd8, 0xeb, 0xb7, 0xed, 0xc2, 0x9b, 0x50, 0x2e, 0xc8, 0x24, 0x4a, 0x1c,
+	0x3e, 0x58, 0x8e, 0xc7, 0xc8, 0x88, 0x04, 0xa4, 0x3d, 0xf1, 0x26, 0x1e, 0x6b, 0x47, 0x3f, 0x8d,
+	0xf5, 0x2a, 0xea, 0xeb, 0x7f, 0x82, 0xf8, 0xe8, 0x5e, 0x84, 0xca, 0x42, 0x7d, 0x79, 0xd4, 0xd7,
+	0x7f, 0x8d, 0x6b, 0xee, 0x42, 0xd9, 0x95, 0xa2, 0x4b, 0x7f, 0x8e, 0x29, 0x17, 0xcd, 0x4f, 0xe1,
+	0x8d, 0x44, 0xe6, 0x51, 0x18, 0x70, 0x8a, 0xf7, 0xa1, 0x30, 0x66, 0x61, 0x1c, 0x71, 0x0b, 0x35,
+	0xb2, 0x2d, 0xb3, 0xf3, 0xc4, 0xd1, 0xf5, 0x79, 0x25, 0x95, 0x47, 0x82, 0x08, 0xfa, 0x92, 0xf2,
+	0x81, 0x9b, 0x38, 0x35, 0xdf, 0x86, 0xaa, 0xc4, 0x2b, 0xeb, 0xe1, 0x94, 0xf8, 0xd2, 0x63, 0x4e,
+	0xfe, 0x15, 0xd4, 0x36, 0x19, 0x93, 0x48, 0xcf, 0x6f, 0x45, 0xaa, 0x26, 0x91, 0x36, 0x40, 0xd2,
+	0x68, 0x7f, 0x66, 0x01, 0xaf, 0x9b, 0xf1, 0x3b, 0x50, 0x0a, 0xc8, 0x84, 0xf2, 0x88, 0x0c, 0xa8,
+	0x85, 0x1a, 0xa8, 0x55, 0x72, 0x17, 0x0a, 0x8c, 0x21, 0x27, 0x05, 0x2b, 0xa3, 0x0c, 0x6a, 0x8d,
+	0x7f, 0x84, 0xaa, 0x4f, 0xb8, 0xe8, 0xd1, 0x29, 0xf1, 0x63, 0xd5, 0xaa, 0xde, 0xbc, 0x27, 0x56,
+	0xb6, 0x81, 0x5a, 0x66, 0xa7, 0xe6, 0xe8, 0xae, 0x39, 0x69, 0xd7, 0x9c, 0x6f, 0x52, 0x8f, 0x83,
+	0xe2, 0xd9, 0x65, 0xdd, 0x38, 0xfd, 0xa7, 0x8e, 0xdc, 0xb7, 0x24, 0xcd, 0xe1, 0x9c, 0x65, 0xee,
+	0x82, 0xbf, 0x07, 0xeb, 0x76, 0x84, 0x74, 0x2a, 0xac, 0x9c, 0x0a, 0x50, 0x5d, 0x0b, 0xf0, 0x32,
+	0x71, 0xd0, 0xfc, 0xbf, 0x4a, 0xfe, 0xa7, 0xab, 0xfc, 0xa9, 0x07, 0x7e, 0x17, 0x40, 0xd3, 0x33,
+	0x16, 0x32, 0x2b, 0xaf, 0x73, 0x56, 0xbe, 0x52, 0x81, 0x9f, 0x41, 0x99, 0x53, 0xe6, 0x51, 0xde,
+	0x1b, 0x84, 0x71, 0x20, 0xac, 0x42, 0x03, 0xb5, 0xb2, 0xae, 0xa9, 0x75, 0x9f, 0x4b, 0x95, 0x2c,
+	0x41, 0x40, 0x4f, 0xee, 0x28, 0xc1, 0xce, 0x36, 0x25, 0x90, 0x34, 0x1b, 0x4a, 0xd0, 0xfc, 0x3d,
+	0x03, 0xbb, 0xab, 0x63, 0x83, 0xdf, 0x87, 0xbc, 0x6a, 0xa5, 0xea, 0x92, 0xd9, 0xa9, 0x38, 0x7a,
+	0x36, 0xe7, 0x3d, 0x55, 0xb3, 0xa5, 0x5d, 0xf0, 0xc7, 0x50, 0x26, 0x03, 0xe1, 0x4d, 0x69, 0x4f,
+	0x39, 0x59, 0x19, 0x35, 0x25, 0x95, 0xa5, 0x29, 0x59, 0x8c, 0xa3, 0xa9, 0x3d, 0xd5, 0x28, 0xe3,
+	0xef, 0x60, 0x8f, 0xae, 0x6f, 0x67, 0xab, 0xb6, 0x6e, 0x22, 0xc0, 0x47, 0x80, 0xe9, 0x5a, 0x27,
+	0xb6, 0x69, 0xe6, 0x06, 0x78, 0xf3, 0xef, 0x8c, 0x3e, 0x81, 0x8b, 0x1a, 0xbd, 0x07, 0x39, 0x99,
+	0x62, 0x52, 0xa2, 0x37, 0x97, 0x4a, 0xa4, 0x52, 0x55, 0x46, 0x5c, 0x81, 0x3c, 0x97, 0x88, 0x64,
+	0xaa, 0xb5, 0x80, 0x9f, 0x42, 0xe1, 0x98, 0x12, 0x5f, 0x1c, 0xab, 0x64, 0x4b, 0x6e, 0x22, 0xc9,
+	0x03, 0x32, 0x9f, 0x0d, 0xb5, 0xe1, 0x95, 0x61, 0xd9, 0x87, 0x02, 0xf1, 0x29, 0x13, 0xdc, 0xca,
+	0xaf, 0x1c, 0xf9, 0xae, 0x54, 0x2e, 0x1d, 0x79, 0xed, 0x74, 0x57, 0x79, 0x0b, 0x8f, 0x53, 0xde,
+	0x9d, 0xd7, 0x2b, 0xef, 0x4d, 0x0e, 0x76, 0x57, 0xf3, 0x58, 0x94, 0x0e, 0x2d, 0x97, 0x6e, 0x04,
+	0x05, 0x9f, 0xf4, 0xa9, 0x9f, 0xce, 0xd9, 0x9e, 0x33, 0x08, 0x99, 0xa0, 0x27, 0x51, 0xdf, 0xf9,
+	0x52, 0xea, 0xbf, 0x26, 0x1e, 0x3b, 0xf8, 0x44, 0xc6, 0xfa, 0xeb, 0xb2, 0xfe, 0xfc, 0x21, 0xf7,
+	0xb5, 0xc6, 0x75, 0x87, 0x24, 0x12, 0x94, 0xb9, 0x09, 0x3b, 0x8e, 0xc0, 0x24, 0x41, 0x10, 0x0a,
+	0xb5, 0x3d, 0x6e, 0x65, 0x1f, 0x25, 0xd8, 0x72, 0x08, 0x99, 0xaf, 0xac, 0x0b, 0x55, 0x8d, 0x47,
+	0xae, 0x16, 0x70, 0x17, 0x4a, 0xc9, 0xe9, 0x22, 0x42, 0xdd, 0x1f, 0x0f, 0xed, 0x5d, 0x51, 0xc3,
+	0xba, 0x02, 0x7f, 0x06, 0xc5, 0x91, 0xc7, 0xe8, 0x50, 0x32, 0x6c, 0xd3, 0xfd, 0x1d, 0x85, 0xea,
+	0x0a, 0x7c, 0x08, 0x26, 0xa3, 0x3c, 0xf4, 0xa7, 0x9a, 0x63, 0x9b, 0x4b, 0x07, 0x52, 0x60, 0x57,
+	0xe0, 0x2f, 0xa0, 0xac, 0xee, 0x42, 0x4e, 0x03, 0x21, 0x79, 0x8a, 0xdb, 0xf0, 0x48, 0xe4, 0x11,
+	0x0d, 0x84, 0xde, 0xce, 0x94, 0xf8, 0xde, 0xb0, 0x17, 0x07, 0xc2, 0xf3, 0xad, 0xd2, 0x36, 0x34,
+	0x0a, 0xf8, 0xad, 0xc4, 0x75, 0x7e, 0x43, 0x90, 0x97, 0xa7, 0x95, 0xe1, 0x17, 0x7a, 0xc1, 0xf1,
+	0xde, 0xd2, 0xa5, 0x95, 0xbe, 0x8e, 0xb5, 0xca, 0xaa, 0x52, 0xbf, 0x8a, 0x4d, 0x03, 0xff, 0x00,
+	0x4f, 0x5e, 0x51, 0xb1, 0xe1, 0x99, 0x6b, 0xdc, 0xfd, 0x40, 0x26, 0x94, 0xcf, 0xee, 0xf1, 0x48,
+	0xf9, 0x0f, 0x5e, 0x9c, 0x5f, 0xd9, 0xc6, 0xc5, 0x95, 0x6d, 0xdc, 0x5c, 0xd9, 0xe8, 0x97, 0x99,
+	0x8d, 0xfe, 0x98, 0xd9, 0xe8, 0x6c, 0x66, 0xa3, 0xf3, 0x99, 0x8d, 0xfe, 0x9d, 0xd9, 0xe8, 0xbf,
+	0x99, 0x6d, 0xdc, 0xcc, 0x6c, 0x74, 0x7a, 0x6d, 0x1b, 0xe7, 0xd7, 0xb6, 0x71, 0x71, 0x6d, 0x1b,
+	0xfd, 0x82, 0xca, 0xff, 0xc3, 0xff, 0x03, 0x00, 0x00, 0xff, 0xff, 0x23, 0x4b, 0x70, 0x4d, 0x2f,
+	0x09, 0x00, 0x00,
 }
 
 func (this *RulesRequest) Equal(that interface{}) bool {
@@ -476,6 +662,98 @@ func (this *RulesResponse) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *RuleGroupEvalStatsRequest) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*RuleGroupEvalStatsRequest)
+	if !ok {
+		that2, ok := that.(RuleGroupEvalStatsRequest)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	return true
+}
+func (this *RuleGroupEvalStatsResponse) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*RuleGroupEvalStatsResponse)
+	if !ok {
+		that2, ok := that.(RuleGroupEvalStatsResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if len(this.Groups) != len(that1.Groups) {
+		return false
+	}
+	for i := range this.Groups {
+		if !this.Groups[i].Equal(that1.Groups[i]) {
+			return false
+		}
+	}
+	return true
+}
+func (this *RuleGroupEvalStats) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*RuleGroupEvalStats)
+	if !ok {
+		that2, ok := that.(RuleGroupEvalStats)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Namespace != that1.Namespace {
+		return false
+	}
+	if this.Name != that1.Name {
+		return false
+	}
+	if !this.LastEvaluationTimestamp.Equal(that1.LastEvaluationTimestamp) {
+		return false
+	}
+	if this.LastEvaluationDuration != that1.LastEvaluationDuration {
+		return false
+	}
+	if this.LastError != that1.LastError {
+		return false
+	}
+	if this.SeriesCount != that1.SeriesCount {
+		return false
+	}
+	if !this.NextEvaluationTimestamp.Equal(that1.NextEvaluationTimestamp) {
+		return false
+	}
+	return true
+}
 func (this *GroupStateDesc) Equal(that interface{}) bool {
 	if that == nil {
 		return this == nil
@@ -640,6 +918,43 @@ func (this *RulesResponse) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *RuleGroupEvalStatsRequest) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 4)
+	s = append(s, "&ruler.RuleGroupEvalStatsRequest{")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *RuleGroupEvalStatsResponse) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 5)
+	s = append(s, "&ruler.RuleGroupEvalStatsResponse{")
+	if this.Groups != nil {
+		s = append(s, "Groups: "+fmt.Sprintf("%#v", this.Groups)+",\n")
+	}
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *RuleGroupEvalStats) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 11)
+	s = append(s, "&ruler.RuleGroupEvalStats{")
+	s = append(s, "Namespace: "+fmt.Sprintf("%#v", this.Namespace)+",\n")
+	s = append(s, "Name: "+fmt.Sprintf("%#v", this.Name)+",\n")
+	s = append(s, "LastEvaluationTimestamp: "+fmt.Sprintf("%#v", this.LastEvaluationTimestamp)+",\n")
+	s = append(s, "LastEvaluationDuration: "+fmt.Sprintf("%#v", this.LastEvaluationDuration)+",\n")
+	s = append(s, "LastError: "+fmt.Sprintf("%#v", this.LastError)+",\n")
+	s = append(s, "SeriesCount: "+fmt.Sprintf("%#v", this.SeriesCount)+",\n")
+	s = append(s, "NextEvaluationTimestamp: "+fmt.Sprintf("%#v", this.NextEvaluationTimestamp)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func (this *GroupStateDesc) GoString() string {
 	if this == nil {
 		return "nil"
@@ -717,6 +1032,7 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type RulerClient interface {
 	Rules(ctx context.Context, in *RulesRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	GetRuleGroupEvalStats(ctx context.Context, in *RuleGroupEvalStatsRequest, opts ...grpc.CallOption) (*RuleGroupEvalStatsResponse, error)
 }
 
 type rulerClient struct {
@@ -736,9 +1052,19 @@ func (c *rulerClient) Rules(ctx context.Context, in *RulesRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *rulerClient) GetRuleGroupEvalStats(ctx context.Context, in *RuleGroupEvalStatsRequest, opts ...grpc.CallOption) (*RuleGroupEvalStatsResponse, error) {
+	out := new(RuleGroupEvalStatsResponse)
+	err := c.cc.Invoke(ctx, "/ruler.Ruler/GetRuleGroupEvalStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RulerServer is the server API for Ruler service.
 type RulerServer interface {
 	Rules(context.Context, *RulesRequest) (*RulesResponse, error)
+	GetRuleGroupEvalStats(context.Context, *RuleGroupEvalStatsRequest) (*RuleGroupEvalStatsResponse, error)
 }
 
 // UnimplementedRulerServer can be embedded to have forward compatible implementations.
@@ -748,6 +1074,9 @@ type UnimplementedRulerServer struct {
 func (*UnimplementedRulerServer) Rules(ctx context.Context, req *RulesRequest) (*RulesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Rules not implemented")
 }
+func (*UnimplementedRulerServer) GetRuleGroupEvalStats(ctx context.Context, req *RuleGroupEvalStatsRequest) (*RuleGroupEvalStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRuleGroupEvalStats not implemented")
+}
 
 func RegisterRulerServer(s *grpc.Server, srv RulerServer) {
 	s.RegisterService(&_Ruler_serviceDesc, srv)
@@ -771,6 +1100,24 @@ func _Ruler_Rules_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Ruler_GetRuleGroupEvalStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RuleGroupEvalStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulerServer).GetRuleGroupEvalStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ruler.Ruler/GetRuleGroupEvalStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulerServer).GetRuleGroupEvalStats(ctx, req.(*RuleGroupEvalStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Ruler_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "ruler.Ruler",
 	HandlerType: (*RulerServer)(nil),
@@ -779,6 +1126,10 @@ var _Ruler_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Rules",
 			Handler:    _Ruler_Rules_Handler,
 		},
+		{
+			MethodName: "GetRuleGroupEvalStats",
+			Handler:    _Ruler_GetRuleGroupEvalStats_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "ruler.proto",
@@ -844,7 +1195,7 @@ func (m *RulesResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *GroupStateDesc) Marshal() (dAtA []byte, err error) {
+func (m *RuleGroupEvalStatsRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -854,31 +1205,164 @@ func (m *GroupStateDesc) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *GroupStateDesc) MarshalTo(dAtA []byte) (int, error) {
+func (m *RuleGroupEvalStatsRequest) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *GroupStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *RuleGroupEvalStatsRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
-	if err1 != nil {
-		return 0, err1
-	}
-	i -= n1
-	i = encodeVarintRuler(dAtA, i, uint64(n1))
-	i--
-	dAtA[i] = 0x22
-	n2, err2 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
-	if err2 != nil {
-		return 0, err2
+	return len(dAtA) - i, nil
+}
+
+func (m *RuleGroupEvalStatsResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
-	i -= n2
+	return dAtA[:n], nil
+}
+
+func (m *RuleGroupEvalStatsResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RuleGroupEvalStatsResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Groups) > 0 {
+		for iNdEx := len(m.Groups) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Groups[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRuler(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *RuleGroupEvalStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *RuleGroupEvalStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RuleGroupEvalStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	n1, err1 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.NextEvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.NextEvaluationTimestamp):])
+	if err1 != nil {
+		return 0, err1
+	}
+	i -= n1
+	i = encodeVarintRuler(dAtA, i, uint64(n1))
+	i--
+	dAtA[i] = 0x3a
+	if m.SeriesCount != 0 {
+		i = encodeVarintRuler(dAtA, i, uint64(m.SeriesCount))
+		i--
+		dAtA[i] = 0x30
+	}
+	if len(m.LastError) > 0 {
+		i -= len(m.LastError)
+		copy(dAtA[i:], m.LastError)
+		i = encodeVarintRuler(dAtA, i, uint64(len(m.LastError)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	n2, err2 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.LastEvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.LastEvaluationDuration):])
+	if err2 != nil {
+		return 0, err2
+	}
+	i -= n2
 	i = encodeVarintRuler(dAtA, i, uint64(n2))
 	i--
+	dAtA[i] = 0x22
+	n3, err3 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastEvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastEvaluationTimestamp):])
+	if err3 != nil {
+		return 0, err3
+	}
+	i -= n3
+	i = encodeVarintRuler(dAtA, i, uint64(n3))
+	i--
+	dAtA[i] = 0x1a
+	if len(m.Name) > 0 {
+		i -= len(m.Name)
+		copy(dAtA[i:], m.Name)
+		i = encodeVarintRuler(dAtA, i, uint64(len(m.Name)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Namespace) > 0 {
+		i -= len(m.Namespace)
+		copy(dAtA[i:], m.Namespace)
+		i = encodeVarintRuler(dAtA, i, uint64(len(m.Namespace)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *GroupStateDesc) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *GroupStateDesc) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *GroupStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	n4, err4 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
+	if err4 != nil {
+		return 0, err4
+	}
+	i -= n4
+	i = encodeVarintRuler(dAtA, i, uint64(n4))
+	i--
+	dAtA[i] = 0x22
+	n5, err5 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
+	if err5 != nil {
+		return 0, err5
+	}
+	i -= n5
+	i = encodeVarintRuler(dAtA, i, uint64(n5))
+	i--
 	dAtA[i] = 0x1a
 	if len(m.ActiveRules) > 0 {
 		for iNdEx := len(m.ActiveRules) - 1; iNdEx >= 0; iNdEx-- {
@@ -929,20 +1413,20 @@ func (m *RuleStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	n4, err4 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
-	if err4 != nil {
-		return 0, err4
+	n7, err7 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
+	if err7 != nil {
+		return 0, err7
 	}
-	i -= n4
-	i = encodeVarintRuler(dAtA, i, uint64(n4))
+	i -= n7
+	i = encodeVarintRuler(dAtA, i, uint64(n7))
 	i--
 	dAtA[i] = 0x3a
-	n5, err5 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
-	if err5 != nil {
-		return 0, err5
+	n8, err8 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
+	if err8 != nil {
+		return 0, err8
 	}
-	i -= n5
-	i = encodeVarintRuler(dAtA, i, uint64(n5))
+	i -= n8
+	i = encodeVarintRuler(dAtA, i, uint64(n8))
 	i--
 	dAtA[i] = 0x32
 	if len(m.Alerts) > 0 {
@@ -1015,44 +1499,44 @@ func (m *AlertStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	n7, err7 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ValidUntil, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ValidUntil):])
-	if err7 != nil {
-		return 0, err7
+	n10, err10 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ValidUntil, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ValidUntil):])
+	if err10 != nil {
+		return 0, err10
 	}
-	i -= n7
-	i = encodeVarintRuler(dAtA, i, uint64(n7))
+	i -= n10
+	i = encodeVarintRuler(dAtA, i, uint64(n10))
 	i--
 	dAtA[i] = 0x4a
-	n8, err8 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastSentAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSentAt):])
-	if err8 != nil {
-		return 0, err8
+	n11, err11 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastSentAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSentAt):])
+	if err11 != nil {
+		return 0, err11
 	}
-	i -= n8
-	i = encodeVarintRuler(dAtA, i, uint64(n8))
+	i -= n11
+	i = encodeVarintRuler(dAtA, i, uint64(n11))
 	i--
 	dAtA[i] = 0x42
-	n9, err9 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ResolvedAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ResolvedAt):])
-	if err9 != nil {
-		return 0, err9
+	n12, err12 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ResolvedAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ResolvedAt):])
+	if err12 != nil {
+		return 0, err12
 	}
-	i -= n9
-	i = encodeVarintRuler(dAtA, i, uint64(n9))
+	i -= n12
+	i = encodeVarintRuler(dAtA, i, uint64(n12))
 	i--
 	dAtA[i] = 0x3a
-	n10, err10 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.FiredAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.FiredAt):])
-	if err10 != nil {
-		return 0, err10
+	n13, err13 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.FiredAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.FiredAt):])
+	if err13 != nil {
+		return 0, err13
 	}
-	i -= n10
-	i = encodeVarintRuler(dAtA, i, uint64(n10))
+	i -= n13
+	i = encodeVarintRuler(dAtA, i, uint64(n13))
 	i--
 	dAtA[i] = 0x32
-	n11, err11 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ActiveAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ActiveAt):])
-	if err11 != nil {
-		return 0, err11
+	n14, err14 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ActiveAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ActiveAt):])
+	if err14 != nil {
+		return 0, err14
 	}
-	i -= n11
-	i = encodeVarintRuler(dAtA, i, uint64(n11))
+	i -= n14
+	i = encodeVarintRuler(dAtA, i, uint64(n14))
 	i--
 	dAtA[i] = 0x2a
 	if m.Value != 0 {
@@ -1134,6 +1618,60 @@ func (m *RulesResponse) Size() (n int) {
 	return n
 }
 
+func (m *RuleGroupEvalStatsRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	return n
+}
+
+func (m *RuleGroupEvalStatsResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Groups) > 0 {
+		for _, e := range m.Groups {
+			l = e.Size()
+			n += 1 + l + sovRuler(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *RuleGroupEvalStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Namespace)
+	if l > 0 {
+		n += 1 + l + sovRuler(uint64(l))
+	}
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovRuler(uint64(l))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.LastEvaluationTimestamp)
+	n += 1 + l + sovRuler(uint64(l))
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.LastEvaluationDuration)
+	n += 1 + l + sovRuler(uint64(l))
+	l = len(m.LastError)
+	if l > 0 {
+		n += 1 + l + sovRuler(uint64(l))
+	}
+	if m.SeriesCount != 0 {
+		n += 1 + sovRuler(uint64(m.SeriesCount))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.NextEvaluationTimestamp)
+	n += 1 + l + sovRuler(uint64(l))
+	return n
+}
+
 func (m *GroupStateDesc) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1260,6 +1798,46 @@ func (this *RulesResponse) String() string {
 	}, "")
 	return s
 }
+func (this *RuleGroupEvalStatsRequest) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&RuleGroupEvalStatsRequest{`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *RuleGroupEvalStatsResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForGroups := "[]*RuleGroupEvalStats{"
+	for _, f := range this.Groups {
+		repeatedStringForGroups += strings.Replace(f.String(), "RuleGroupEvalStats", "RuleGroupEvalStats", 1) + ","
+	}
+	repeatedStringForGroups += "}"
+	s := strings.Join([]string{`&RuleGroupEvalStatsResponse{`,
+		`Groups:` + repeatedStringForGroups + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *RuleGroupEvalStats) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&RuleGroupEvalStats{`,
+		`Namespace:` + fmt.Sprintf("%v", this.Namespace) + `,`,
+		`Name:` + fmt.Sprintf("%v", this.Name) + `,`,
+		`LastEvaluationTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.LastEvaluationTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
+		`LastEvaluationDuration:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.LastEvaluationDuration), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`LastError:` + fmt.Sprintf("%v", this.LastError) + `,`,
+		`SeriesCount:` + fmt.Sprintf("%v", this.SeriesCount) + `,`,
+		`NextEvaluationTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.NextEvaluationTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func (this *GroupStateDesc) String() string {
 	if this == nil {
 		return "nil"
@@ -1465,6 +2043,413 @@ func (m *RulesResponse) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *RuleGroupEvalStatsRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRuler
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RuleGroupEvalStatsRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RuleGroupEvalStatsRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRuler(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RuleGroupEvalStatsResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRuler
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RuleGroupEvalStatsResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RuleGroupEvalStatsResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Groups", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Groups = append(m.Groups, &RuleGroupEvalStats{})
+			if err := m.Groups[len(m.Groups)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRuler(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RuleGroupEvalStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRuler
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RuleGroupEvalStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RuleGroupEvalStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Namespace", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Namespace = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluationTimestamp", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastEvaluationTimestamp, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastEvaluationDuration", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.LastEvaluationDuration, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastError = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesCount", wireType)
+			}
+			m.SeriesCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesCount |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NextEvaluationTimestamp", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.NextEvaluationTimestamp, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRuler(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *GroupStateDesc) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -7,6 +7,7 @@ package ruler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -94,6 +95,11 @@ func (c *mockRulerClient) Rules(ctx context.Context, in *RulesRequest, _ ...grpc
 	return c.ruler.Rules(ctx, in)
 }
 
+func (c *mockRulerClient) GetRuleGroupEvalStats(ctx context.Context, in *RuleGroupEvalStatsRequest, _ ...grpc.CallOption) (*RuleGroupEvalStatsResponse, error) {
+	c.numberOfCalls.Inc()
+	return c.ruler.GetRuleGroupEvalStats(ctx, in)
+}
+
 func (p *mockRulerClientsPool) GetClientFor(addr string) (RulerClient, error) {
 	for _, r := range p.rulerAddrMap {
 		if r.lifecycler.GetInstanceAddr() == addr {
@@ -309,6 +315,61 @@ func TestRuler_Rules(t *testing.T) {
 	}
 }
 
+func TestRuler_GetRuleGroupEvalStats(t *testing.T) {
+	cfg := defaultRulerConfig(t)
+	rulerAddrMap := map[string]*Ruler{}
+	r := prepareRuler(t, cfg, newMockRuleStore(mockRules), withRulerAddrMap(rulerAddrMap), withStart())
+	rulerAddrMap["ruler1"] = r
+
+	ctx := user.InjectOrgID(context.Background(), "user1")
+	test.Poll(t, 5*time.Second, len(mockRules["user1"]), func() interface{} {
+		rls, _ := r.Rules(ctx, &RulesRequest{})
+		return len(rls.Groups)
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		resp, err := r.GetRuleGroupEvalStats(ctx, &RuleGroupEvalStatsRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Groups, 1)
+
+		stats := resp.Groups[0]
+		assert.Equal(t, "namespace1", stats.Namespace)
+		assert.Equal(t, "group1", stats.Name)
+		assert.Empty(t, stats.LastError)
+		assert.True(t, stats.NextEvaluationTimestamp.After(stats.LastEvaluationTimestamp))
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		router := mux.NewRouter()
+		router.Path("/ruler/api/v1/eval_stats").Methods(http.MethodGet).HandlerFunc(r.RuleGroupEvalStatsHandler)
+
+		req := requestFor(t, http.MethodGet, "https://localhost:8080/ruler/api/v1/eval_stats", nil, "user1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Status string `json:"status"`
+			Data   struct {
+				Groups []ruleGroupEvalStatsJSON `json:"groups"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "success", body.Status)
+		require.Len(t, body.Data.Groups, 1)
+		assert.Equal(t, "namespace1", body.Data.Groups[0].Namespace)
+		assert.Equal(t, "group1", body.Data.Groups[0].Name)
+	})
+
+	t.Run("HTTP without tenant", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.RuleGroupEvalStatsHandler(w, httptest.NewRequest(http.MethodGet, "https://localhost:8080/ruler/api/v1/eval_stats", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+}
+
 func compareRuleGroupDescToStateDesc(t *testing.T, expected *rulespb.RuleGroupDesc, got *GroupStateDesc) {
 	require.Equal(t, got.Group.Name, expected.Name)
 	require.Equal(t, got.Group.Namespace, expected.Namespace)
@@ -940,7 +1001,7 @@ func TestDeleteTenantRuleGroups(t *testing.T) {
 	require.Equal(t, 3, len(obj.Objects()))
 
 	cfg := defaultRulerConfig(t)
-	api, err := NewRuler(cfg, nil, nil, log.NewNopLogger(), rs, nil)
+	api, err := NewRuler(cfg, nil, nil, log.NewNopLogger(), rs, nil, nil, nil)
 	require.NoError(t, err)
 
 	{
@@ -7,7 +7,9 @@ package rulestore
 
 import (
 	"flag"
+	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/google/go-cmp/cmp"
@@ -15,12 +17,16 @@ import (
 
 	"github.com/grafana/mimir/pkg/ruler/rulestore/local"
 	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util"
 )
 
 // Config configures a rule store.
 type Config struct {
 	bucket.Config `yaml:",inline"`
 	Local         local.Config `yaml:"local"`
+
+	CompressionAlgorithm    string `yaml:"compression_algorithm" category:"experimental"`
+	CompressionMinSizeBytes int64  `yaml:"compression_min_size_bytes" category:"experimental"`
 }
 
 // RegisterFlags registers the backend storage config.
@@ -30,6 +36,17 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.StorageBackendConfig.ExtraBackends = []string{local.Name}
 	cfg.Local.RegisterFlagsWithPrefix(prefix, f)
 	cfg.RegisterFlagsWithPrefixAndDefaultDirectory(prefix, "ruler", f, logger)
+
+	f.StringVar(&cfg.CompressionAlgorithm, prefix+"compression-algorithm", "", fmt.Sprintf("Algorithm used to compress the rule groups larger than -%scompression-min-size-bytes when storing them. Supported values are: %s. The compressed rule groups are read regardless of this setting. Empty to store the rule groups uncompressed.", prefix, strings.Join(bucket.SupportedCompressionAlgorithms, ", ")))
+	f.Int64Var(&cfg.CompressionMinSizeBytes, prefix+"compression-min-size-bytes", 1024, "Minimum size in bytes of the rule groups to compress, when compression is enabled.")
+}
+
+// Validate validates the config.
+func (cfg *Config) Validate() error {
+	if cfg.CompressionAlgorithm != "" && !util.StringsContain(bucket.SupportedCompressionAlgorithms, cfg.CompressionAlgorithm) {
+		return bucket.ErrUnsupportedCompressionAlgorithm
+	}
+	return cfg.Config.Validate()
 }
 
 // IsDefaults returns true if the storage options have not been set.
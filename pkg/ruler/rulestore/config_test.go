@@ -10,6 +10,8 @@ import (
 
 	"github.com/grafana/dskit/flagext"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
 )
 
 func TestIsDefaults(t *testing.T) {
@@ -52,3 +54,37 @@ func TestIsDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(cfg *Config)
+		expected error
+	}{
+		"should pass with the default config": {
+			setup:    func(cfg *Config) {},
+			expected: nil,
+		},
+		"should pass with a supported compression algorithm": {
+			setup: func(cfg *Config) {
+				cfg.CompressionAlgorithm = bucket.CompressionZstd
+			},
+			expected: nil,
+		},
+		"should fail with an unsupported compression algorithm": {
+			setup: func(cfg *Config) {
+				cfg.CompressionAlgorithm = "unknown"
+			},
+			expected: bucket.ErrUnsupportedCompressionAlgorithm,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			testData.setup(&cfg)
+
+			assert.Equal(t, testData.expected, cfg.Validate())
+		})
+	}
+}
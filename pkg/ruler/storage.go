@@ -34,7 +34,14 @@ func NewRuleStore(ctx context.Context, cfg rulestore.Config, cfgProvider bucket.
 		return nil, err
 	}
 
-	store := bucketclient.NewBucketRuleStore(bucketClient, cfgProvider, logger)
+	// The compression middleware is always used, so that the compressed rule groups can be
+	// read even once compression has been disabled.
+	compressionClient, err := bucket.NewCompressionMiddleware(bucketClient, cfg.CompressionMinSizeBytes, cfg.CompressionAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	store := bucketclient.NewBucketRuleStore(compressionClient, cfgProvider, logger)
 	if err != nil {
 		return nil, err
 	}
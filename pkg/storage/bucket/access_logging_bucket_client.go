@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	opUpload     = "upload"
+	opDelete     = "delete"
+	opIter       = "iter"
+	opGet        = "get"
+	opGetRange   = "get_range"
+	opExists     = "exists"
+	opAttributes = "attributes"
+
+	// accessLogMaxPendingBytes is the max number of bytes of the entries buffered by the access log
+	// writer before writing them to the output, when more entries are waiting to be written.
+	accessLogMaxPendingBytes = 64 * 1024
+)
+
+var errInvalidAccessLogBufferSize = errors.New("the bucket access log buffer size must be greater than 0")
+
+// AccessLogConfig holds the config of the access log of the bucket operations.
+type AccessLogConfig struct {
+	File       string `yaml:"access_log_file" category:"experimental"`
+	BufferSize int    `yaml:"access_log_buffer_size" category:"experimental"`
+}
+
+func (cfg *AccessLogConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.File, prefix+"access-log-file", "", "File to which an access log entry is appended, as a JSON line, for each operation run against the bucket. The entries are written asynchronously: the ones exceeding the buffer are dropped and tracked by the cortex_bucket_access_log_entries_dropped_total metric. Empty to disable.")
+	f.IntVar(&cfg.BufferSize, prefix+"access-log-buffer-size", 10000, "Max number of access log entries buffered while waiting to be written to the access log file.")
+}
+
+func (cfg *AccessLogConfig) Validate() error {
+	if cfg.File != "" && cfg.BufferSize <= 0 {
+		return errInvalidAccessLogBufferSize
+	}
+	return nil
+}
+
+// accessLogEntry is a single line of the access log.
+type accessLogEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Operation  string    `json:"operation"`
+	Key        string    `json:"key"`
+	Tenant     string    `json:"tenant,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// accessLoggingBucket is an objstore.Bucket writing an access log entry for each operation.
+type accessLoggingBucket struct {
+	objstore.Bucket
+
+	// The writer is shared with the buckets returned by WithExpectedErrs().
+	out *accessLogWriter
+}
+
+// NewAccessLoggingBucket wraps the input bucket with a middleware writing to output one JSON line per
+// operation, with the operation, the object key, the tenant (if any) read from the context, the duration
+// and the error (if any). For the Get and GetRange operations, the duration doesn't include the time
+// spent reading the returned object.
+//
+// The entries are written by a background goroutine, so that the bucket operations never wait for the
+// output: up to bufferSize entries are buffered, and the entries which don't fit in the buffer or which
+// fail to be written are dropped and tracked by the cortex_bucket_access_log_entries_dropped_total metric.
+// Close() stops the background goroutine, after writing the buffered entries, and closes the output too
+// if it's an io.Closer.
+func NewAccessLoggingBucket(inner objstore.Bucket, output io.Writer, bufferSize int, reg prometheus.Registerer) objstore.Bucket {
+	return &accessLoggingBucket{
+		Bucket: inner,
+		out:    newAccessLogWriter(output, bufferSize, reg),
+	}
+}
+
+// newAccessLogFileBucket wraps the input bucket with a middleware writing the access log to the configured file.
+func newAccessLogFileBucket(inner objstore.Bucket, cfg AccessLogConfig, reg prometheus.Registerer) (objstore.Bucket, error) {
+	file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open bucket access log file")
+	}
+	return NewAccessLoggingBucket(inner, file, cfg.BufferSize, reg), nil
+}
+
+// Upload implements objstore.Bucket.
+func (b *accessLoggingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	start := time.Now()
+	err := b.Bucket.Upload(ctx, name, r)
+	b.log(ctx, opUpload, name, start, err)
+	return err
+}
+
+// Delete implements objstore.Bucket.
+func (b *accessLoggingBucket) Delete(ctx context.Context, name string) error {
+	start := time.Now()
+	err := b.Bucket.Delete(ctx, name)
+	b.log(ctx, opDelete, name, start, err)
+	return err
+}
+
+// Iter implements objstore.Bucket.
+func (b *accessLoggingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	start := time.Now()
+	err := b.Bucket.Iter(ctx, dir, f, options...)
+	b.log(ctx, opIter, dir, start, err)
+	return err
+}
+
+// Get implements objstore.Bucket.
+func (b *accessLoggingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := b.Bucket.Get(ctx, name)
+	b.log(ctx, opGet, name, start, err)
+	return rc, err
+}
+
+// GetRange implements objstore.Bucket.
+func (b *accessLoggingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	b.log(ctx, opGetRange, name, start, err)
+	return rc, err
+}
+
+// Exists implements objstore.Bucket.
+func (b *accessLoggingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	start := time.Now()
+	exists, err := b.Bucket.Exists(ctx, name)
+	b.log(ctx, opExists, name, start, err)
+	return exists, err
+}
+
+// Attributes implements objstore.Bucket.
+func (b *accessLoggingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	start := time.Now()
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	b.log(ctx, opAttributes, name, start, err)
+	return attrs, err
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *accessLoggingBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *accessLoggingBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &accessLoggingBucket{Bucket: ib.WithExpectedErrs(fn), out: b.out}
+	}
+
+	return b
+}
+
+// Close implements objstore.Bucket.
+func (b *accessLoggingBucket) Close() error {
+	b.out.stop()
+	return b.Bucket.Close()
+}
+
+func (b *accessLoggingBucket) log(ctx context.Context, op, key string, start time.Time, err error) {
+	entry := accessLogEntry{
+		Timestamp:  start.UTC(),
+		Operation:  op,
+		Key:        key,
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	entry.Tenant, _ = tenant.TenantID(ctx)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	b.out.write(entry)
+}
+
+// accessLogWriter writes the access log entries to the output from a background goroutine.
+type accessLogWriter struct {
+	output  io.Writer
+	entries chan accessLogEntry
+	dropped prometheus.Counter
+
+	stopOnce sync.Once
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+func newAccessLogWriter(output io.Writer, bufferSize int, reg prometheus.Registerer) *accessLogWriter {
+	w := &accessLogWriter{
+		output:  output,
+		entries: make(chan accessLogEntry, bufferSize),
+		dropped: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_access_log_entries_dropped_total",
+			Help: "Total number of bucket access log entries dropped because the buffer was full or they failed to be written.",
+		}),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// write enqueues the entry to be written, without ever blocking.
+func (w *accessLogWriter) write(entry accessLogEntry) {
+	select {
+	case w.entries <- entry:
+	default:
+		w.dropped.Inc()
+	}
+}
+
+func (w *accessLogWriter) run() {
+	defer close(w.done)
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	pending := 0
+
+	for {
+		select {
+		case entry := <-w.entries:
+			if err := enc.Encode(entry); err != nil {
+				w.dropped.Inc()
+				continue
+			}
+			pending++
+
+			// Entries are written in batches of whole lines, so that the entries written by multiple
+			// writers appending to the same file don't interleave.
+			if len(w.entries) == 0 || buf.Len() >= accessLogMaxPendingBytes {
+				w.flush(&buf, pending)
+				pending = 0
+			}
+
+		case <-w.stopping:
+			for {
+				select {
+				case entry := <-w.entries:
+					if err := enc.Encode(entry); err != nil {
+						w.dropped.Inc()
+						continue
+					}
+					pending++
+				default:
+					w.flush(&buf, pending)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *accessLogWriter) flush(buf *bytes.Buffer, entries int) {
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := w.output.Write(buf.Bytes()); err != nil {
+		w.dropped.Add(float64(entries))
+	}
+	buf.Reset()
+}
+
+// stop writes the buffered entries and stops the background goroutine. The entries logged
+// after stop() has been called may not be written.
+func (w *accessLogWriter) stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopping)
+		<-w.done
+
+		if c, ok := w.output.(io.Closer); ok {
+			_ = c.Close()
+		}
+	})
+}
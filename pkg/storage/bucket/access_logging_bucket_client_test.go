@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/weaveworks/common/user"
+)
+
+func TestAccessLoggingBucket(t *testing.T) {
+	out := &bytes.Buffer{}
+	bkt := NewAccessLoggingBucket(objstore.NewInMemBucket(), out, 100, nil)
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	require.NoError(t, bkt.Upload(ctx, "user-1/object", strings.NewReader("content")))
+
+	_, err := bkt.Get(ctx, "user-1/object")
+	require.NoError(t, err)
+
+	_, err = bkt.GetRange(context.Background(), "user-1/missing", 0, 10)
+	require.Error(t, err)
+
+	_, err = bkt.Exists(ctx, "user-1/object")
+	require.NoError(t, err)
+
+	_, err = bkt.Attributes(ctx, "user-1/object")
+	require.NoError(t, err)
+
+	require.NoError(t, bkt.Iter(ctx, "user-1/", func(string) error { return nil }))
+	require.NoError(t, bkt.Delete(ctx, "user-1/object"))
+
+	// Close the bucket to write the buffered entries.
+	require.NoError(t, bkt.Close())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 7)
+
+	expected := []struct {
+		operation, key, tenant string
+		failed                 bool
+	}{
+		{operation: "upload", key: "user-1/object", tenant: "user-1"},
+		{operation: "get", key: "user-1/object", tenant: "user-1"},
+		{operation: "get_range", key: "user-1/missing", failed: true},
+		{operation: "exists", key: "user-1/object", tenant: "user-1"},
+		{operation: "attributes", key: "user-1/object", tenant: "user-1"},
+		{operation: "iter", key: "user-1/", tenant: "user-1"},
+		{operation: "delete", key: "user-1/object", tenant: "user-1"},
+	}
+
+	for i, line := range lines {
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+
+		assert.Equal(t, expected[i].operation, entry["operation"], line)
+		assert.Equal(t, expected[i].key, entry["key"], line)
+		assert.Contains(t, entry, "timestamp", line)
+		assert.Contains(t, entry, "duration_ms", line)
+
+		if expected[i].tenant != "" {
+			assert.Equal(t, expected[i].tenant, entry["tenant"], line)
+		} else {
+			assert.NotContains(t, entry, "tenant", line)
+		}
+
+		if expected[i].failed {
+			assert.NotEmpty(t, entry["error"], line)
+		} else {
+			assert.NotContains(t, entry, "error", line)
+		}
+	}
+}
+
+func TestAccessLoggingBucket_ConcurrentOperations(t *testing.T) {
+	out := &bytes.Buffer{}
+	bkt := NewAccessLoggingBucket(objstore.NewInMemBucket(), out, 100, nil)
+
+	const concurrency = 10
+	wg := sync.WaitGroup{}
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			_, _ = bkt.Exists(context.Background(), "object")
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, bkt.Close())
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, concurrency)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+}
+
+func TestAccessLoggingBucket_ShouldDropEntriesWhenTheBufferIsFull(t *testing.T) {
+	out := &blockingWriter{unblock: make(chan struct{})}
+	reg := prometheus.NewPedanticRegistry()
+	bkt := NewAccessLoggingBucket(objstore.NewInMemBucket(), out, 1, reg)
+
+	// The background writer blocks writing the first entry, so at most another entry fits in the
+	// buffer and the next ones are dropped. The operations must never wait for the writer.
+	const numOps = 5
+	for i := 0; i < numOps; i++ {
+		_, err := bkt.Exists(context.Background(), "object")
+		require.NoError(t, err)
+	}
+
+	close(out.unblock)
+	require.NoError(t, bkt.Close())
+
+	metrics, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "cortex_bucket_access_log_entries_dropped_total", metrics[0].GetName())
+	dropped := int(metrics[0].GetMetric()[0].GetCounter().GetValue())
+
+	written := strings.Count(out.buf.String(), "\n")
+	assert.GreaterOrEqual(t, dropped, numOps-2)
+	assert.Equal(t, numOps, written+dropped)
+}
+
+// blockingWriter is an io.Writer whose writes block until unblock is closed.
+type blockingWriter struct {
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.buf.Write(p)
+}
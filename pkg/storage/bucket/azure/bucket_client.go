@@ -6,13 +6,40 @@
 package azure
 
 import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/go-kit/log"
-	"github.com/thanos-io/objstore"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore/exthttp"
 	"github.com/thanos-io/objstore/providers/azure"
 	yaml "gopkg.in/yaml.v3"
 )
 
-func NewBucketClient(cfg Config, name string, logger log.Logger) (objstore.Bucket, error) {
+const (
+	defaultEndpoint = "blob.core.windows.net"
+
+	// copyStatusPollInterval is how frequently the status of a pending copy is checked.
+	copyStatusPollInterval = time.Second
+
+	// copyAbortTimeout is the timeout to abort a pending copy once the CopyObject context is canceled.
+	copyAbortTimeout = 10 * time.Second
+)
+
+// BucketClient is the Azure bucket client. It wraps the Thanos Azure bucket client, and additionally
+// keeps a container client to support Azure native operations not exposed by the objstore.Bucket interface.
+type BucketClient struct {
+	*azure.Bucket
+
+	containerClient *azblob.ContainerClient
+}
+
+func NewBucketClient(cfg Config, name string, logger log.Logger) (*BucketClient, error) {
 	// Start with default config to make sure that all parameters are set to sensible values, especially
 	// HTTP Config field.
 	bucketConfig := azure.DefaultConfig
@@ -23,6 +50,11 @@ func NewBucketClient(cfg Config, name string, logger log.Logger) (objstore.Bucke
 	bucketConfig.MaxRetries = cfg.MaxRetries
 	bucketConfig.UserAssignedID = cfg.UserAssignedID
 
+	// A negative max retries disables the retries, which would otherwise default to 3.
+	if cfg.MaxRetries < 0 {
+		bucketConfig.PipelineConfig.MaxTries = -1
+	}
+
 	// Thanos currently doesn't support passing the config as is, but expects a YAML,
 	// so we're going to serialize it.
 	serialized, err := yaml.Marshal(bucketConfig)
@@ -30,5 +62,126 @@ func NewBucketClient(cfg Config, name string, logger log.Logger) (objstore.Bucke
 		return nil, err
 	}
 
-	return azure.NewBucket(logger, serialized, name)
+	bkt, err := azure.NewBucket(logger, serialized, name)
+	if err != nil {
+		return nil, err
+	}
+
+	containerClient, err := newContainerClient(bucketConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "initialize azure container client")
+	}
+
+	return &BucketClient{
+		Bucket:          bkt,
+		containerClient: containerClient,
+	}, nil
+}
+
+// newContainerClient creates a container client from the same config, and with the same options, as the
+// Thanos Azure bucket client, which doesn't expose its own. The container is addressed over HTTPS, like
+// the Thanos client does, so that both clients always access the same container.
+func newContainerClient(conf azure.Config) (*azblob.ContainerClient, error) {
+	if conf.Endpoint == "" {
+		conf.Endpoint = defaultEndpoint
+	}
+	if conf.MaxRetries > 0 && conf.PipelineConfig.MaxTries == 0 {
+		conf.PipelineConfig.MaxTries = int32(conf.MaxRetries)
+	}
+
+	transport, err := exthttp.DefaultTransport(conf.HTTPConfig)
+	if err != nil {
+		return nil, err
+	}
+	opts := &azblob.ClientOptions{
+		Retry: policy.RetryOptions{
+			MaxRetries:    conf.PipelineConfig.MaxTries,
+			TryTimeout:    time.Duration(conf.PipelineConfig.TryTimeout),
+			RetryDelay:    time.Duration(conf.PipelineConfig.RetryDelay),
+			MaxRetryDelay: time.Duration(conf.PipelineConfig.MaxRetryDelay),
+		},
+		Transport: &http.Client{Transport: transport},
+	}
+
+	containerURL := (&url.URL{
+		Scheme: "https",
+		Host:   conf.StorageAccountName + "." + conf.Endpoint,
+		Path:   conf.ContainerName,
+	}).String()
+
+	// Use shared keys if set.
+	if conf.StorageAccountKey != "" {
+		cred, err := azblob.NewSharedKeyCredential(conf.StorageAccountName, conf.StorageAccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewContainerClientWithSharedKey(containerURL, cred, opts)
+	}
+
+	// Use MSI for authentication.
+	msiOpt := &azidentity.ManagedIdentityCredentialOptions{}
+	if conf.UserAssignedID != "" {
+		msiOpt.ID = azidentity.ClientID(conf.UserAssignedID)
+	}
+	cred, err := azidentity.NewManagedIdentityCredential(msiOpt)
+	if err != nil {
+		return nil, err
+	}
+	return azblob.NewContainerClient(containerURL, cred, opts)
+}
+
+// CopyObject copies the src object to dst using the Azure server-side Copy Blob, without downloading it.
+// The copy is asynchronous on the Azure side, so CopyObject waits until it's completed, and aborts it
+// if the context is canceled in the meanwhile.
+func (b *BucketClient) CopyObject(ctx context.Context, src, dst string) error {
+	srcClient, err := b.containerClient.NewBlobClient(src)
+	if err != nil {
+		return err
+	}
+	dstClient, err := b.containerClient.NewBlobClient(dst)
+	if err != nil {
+		return err
+	}
+
+	res, err := dstClient.StartCopyFromURL(ctx, srcClient.URL(), nil)
+	if err != nil {
+		return err
+	}
+
+	status := res.CopyStatus
+	for status != nil && *status == azblob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			abortCopy(dstClient, res.CopyID)
+			return ctx.Err()
+		case <-time.After(copyStatusPollInterval):
+		}
+
+		props, err := dstClient.GetProperties(ctx, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				abortCopy(dstClient, res.CopyID)
+			}
+			return err
+		}
+		status = props.CopyStatus
+	}
+
+	if status != nil && *status != azblob.CopyStatusTypeSuccess {
+		return errors.Errorf("copy of %s to %s completed with status %s", src, dst, *status)
+	}
+	return nil
+}
+
+// abortCopy aborts a pending copy, so that it doesn't keep running on the Azure side after CopyObject
+// has returned. The abort is best-effort, because the copy may have been completed in the meanwhile.
+func abortCopy(client *azblob.BlobClient, copyID *string) {
+	if copyID == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), copyAbortTimeout)
+	defer cancel()
+
+	_, _ = client.AbortCopyFromURL(ctx, *copyID, nil)
 }
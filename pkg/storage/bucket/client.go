@@ -11,9 +11,11 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/thanos-io/objstore"
 
 	"github.com/grafana/regexp"
@@ -121,6 +123,14 @@ type Config struct {
 
 	StoragePrefix string `yaml:"storage_prefix" category:"experimental"`
 
+	MultipartUpload MultipartUploadConfig `yaml:",inline"`
+
+	Retry RetryConfig `yaml:",inline"`
+
+	Throttle ThrottleConfig `yaml:",inline"`
+
+	AccessLog AccessLogConfig `yaml:",inline"`
+
 	// Not used internally, meant to allow callers to wrap Buckets
 	// created using this config
 	Middlewares []func(objstore.InstrumentedBucket) (objstore.InstrumentedBucket, error) `yaml:"-"`
@@ -134,6 +144,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 func (cfg *Config) RegisterFlagsWithPrefixAndDefaultDirectory(prefix, dir string, f *flag.FlagSet, logger log.Logger) {
 	cfg.StorageBackendConfig.RegisterFlagsWithPrefixAndDefaultDirectory(prefix, dir, f, logger)
 	f.StringVar(&cfg.StoragePrefix, prefix+"storage-prefix", "", "Prefix for all objects stored in the backend storage. For simplicity, it may only contain digits and English alphabet letters.")
+	cfg.MultipartUpload.RegisterFlagsWithPrefix(prefix, f)
+	cfg.Retry.RegisterFlagsWithPrefix(prefix, f)
+	cfg.Throttle.RegisterFlagsWithPrefix(prefix, f)
+	cfg.AccessLog.RegisterFlagsWithPrefix(prefix, f)
 }
 
 func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet, logger log.Logger) {
@@ -148,6 +162,22 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if err := cfg.MultipartUpload.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Retry.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Throttle.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.AccessLog.Validate(); err != nil {
+		return err
+	}
+
 	return cfg.StorageBackendConfig.Validate()
 }
 
@@ -158,11 +188,31 @@ func NewClient(ctx context.Context, cfg Config, name string, logger log.Logger,
 		err           error
 	)
 
+	// The whole operations are retried by the RetryingBucket, so the retries built into the backend
+	// clients, and the retries of the multipart upload parts, are disabled to not multiply the attempts.
+	retriesEnabled := cfg.Retry.MaxAttempts > 1
+	if retriesEnabled {
+		cfg.Azure.MaxRetries = -1
+		// The Swift client needs a retry to re-authenticate when the auth token expires.
+		cfg.Swift.MaxRetries = 1
+		cfg.MultipartUpload.PartMaxRetries = 0
+	}
+
 	switch cfg.Backend {
 	case S3:
+		if retriesEnabled {
+			s3.DisableClientRetries()
+		}
 		backendClient, err = s3.NewBucketClient(cfg.S3, name, logger)
 	case GCS:
-		backendClient, err = gcs.NewBucketClient(ctx, cfg.GCS, name, logger)
+		var gcsClient *gcs.BucketClient
+		gcsClient, err = gcs.NewBucketClient(ctx, cfg.GCS, name, logger)
+		if err == nil {
+			if retriesEnabled {
+				gcsClient.DisableRetries()
+			}
+			backendClient = gcsClient
+		}
 	case Azure:
 		backendClient, err = azure.NewBucketClient(cfg.Azure, name, logger)
 	case Swift:
@@ -177,12 +227,47 @@ func NewClient(ctx context.Context, cfg Config, name string, logger log.Logger,
 		return nil, err
 	}
 
+	if cfg.MultipartUpload.Threshold > 0 {
+		backendClient = NewMultipartUploadManager(backendClient, cfg.MultipartUpload)
+	}
+
 	if cfg.StoragePrefix != "" {
 		backendClient = NewPrefixedBucketClient(backendClient, cfg.StoragePrefix)
 	}
 
+	// The backend native operations are neither throttled nor retried.
+	nativeOpsClient := backendClient
+
+	// Log every attempt of the operations run against the backend, including the retried ones.
+	if cfg.AccessLog.File != "" {
+		backendClient, err = newAccessLogFileBucket(backendClient, cfg.AccessLog, componentRegisterer(name, reg))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Throttle.Enabled() {
+		limiters := cfg.Throttle.Limiters
+		if limiters == nil {
+			limiters = cfg.Throttle.newLimiters()
+		}
+		backendClient = NewThrottledBucket(backendClient, limiters.Read, limiters.Write)
+	}
+
+	if cfg.Retry.MaxAttempts > 1 {
+		backendClient = NewRetryingBucket(backendClient, cfg.Retry, componentRegisterer(name, reg))
+	}
+
 	instrumentedClient := objstore.NewTracingBucket(bucketWithMetrics(backendClient, name, reg))
 
+	// Preserve the backend native support to list objects with attributes and to copy objects,
+	// which is otherwise hidden by the instrumentation wrappers.
+	_, isIterator := nativeOpsClient.(AttributesIterator)
+	_, isCopier := nativeOpsClient.(ObjectCopier)
+	if isIterator || isCopier {
+		instrumentedClient = &backendNativeOpsBucket{InstrumentedBucket: instrumentedClient, backend: nativeOpsClient, metrics: newNativeOpsMetrics(componentRegisterer(name, reg))}
+	}
+
 	// Wrap the client with any provided middleware
 	for _, wrap := range cfg.Middlewares {
 		instrumentedClient, err = wrap(instrumentedClient)
@@ -202,5 +287,107 @@ func bucketWithMetrics(bucketClient objstore.Bucket, name string, reg prometheus
 	return objstore.BucketWithMetrics(
 		"", // bucket label value
 		bucketClient,
-		prometheus.WrapRegistererWith(prometheus.Labels{"component": name}, reg))
+		componentRegisterer(name, reg))
+}
+
+func componentRegisterer(name string, reg prometheus.Registerer) prometheus.Registerer {
+	if reg == nil {
+		return nil
+	}
+	return prometheus.WrapRegistererWith(prometheus.Labels{"component": name}, reg)
+}
+
+// Names of the backend native operations, as tracked by nativeOpsMetrics.
+const (
+	nativeOpIterWithAttributes = "iter_with_attributes"
+	nativeOpCopyObject         = "copy_object"
+)
+
+// nativeOpsMetrics tracks the backend native operations, which are not tracked by the objstore
+// instrumentation because they bypass it.
+type nativeOpsMetrics struct {
+	ops      *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newNativeOpsMetrics(reg prometheus.Registerer) *nativeOpsMetrics {
+	return &nativeOpsMetrics{
+		ops: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_native_operations_total",
+			Help: "Total number of backend native operations run against the bucket.",
+		}, []string{"operation"}),
+		failures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_native_operation_failures_total",
+			Help: "Total number of backend native operations run against the bucket which failed.",
+		}, []string{"operation"}),
+		duration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cortex_bucket_native_operation_duration_seconds",
+			Help:    "Duration of the backend native operations run against the bucket.",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120},
+		}, []string{"operation"}),
+	}
+}
+
+// observe tracks the operation run by fn.
+func (m *nativeOpsMetrics) observe(op string, fn func() error) error {
+	if m == nil {
+		return fn()
+	}
+
+	start := time.Now()
+	err := fn()
+
+	m.ops.WithLabelValues(op).Inc()
+	m.duration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.failures.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+// backendNativeOpsBucket is an objstore.InstrumentedBucket exposing the AttributesIterator and
+// ObjectCopier implementations of the wrapped backend client. If the backend client doesn't
+// implement one of them, the generic implementation is used on top of the instrumented bucket.
+// The backend native operations are tracked by their own metrics.
+type backendNativeOpsBucket struct {
+	objstore.InstrumentedBucket
+
+	backend objstore.Bucket
+	metrics *nativeOpsMetrics
+}
+
+// IterWithAttributes implements AttributesIterator.
+func (b *backendNativeOpsBucket) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	if it, ok := b.backend.(AttributesIterator); ok {
+		return b.metrics.observe(nativeOpIterWithAttributes, func() error {
+			return it.IterWithAttributes(ctx, prefix, f)
+		})
+	}
+	return iterWithAttributes(ctx, b.InstrumentedBucket, prefix, f)
+}
+
+// CopyObject implements ObjectCopier.
+func (b *backendNativeOpsBucket) CopyObject(ctx context.Context, src, dst string) error {
+	if c, ok := b.backend.(ObjectCopier); ok {
+		return b.metrics.observe(nativeOpCopyObject, func() error {
+			return c.CopyObject(ctx, src, dst)
+		})
+	}
+	return downloadAndUploadObject(ctx, b.InstrumentedBucket, src, dst)
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *backendNativeOpsBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *backendNativeOpsBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	bkt := b.InstrumentedBucket.WithExpectedErrs(fn)
+	if ib, ok := bkt.(objstore.InstrumentedBucket); ok {
+		return &backendNativeOpsBucket{InstrumentedBucket: ib, backend: b.backend, metrics: b.metrics}
+	}
+
+	return bkt
 }
@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	yaml "gopkg.in/yaml.v3"
@@ -73,6 +74,10 @@ func TestNewClient(t *testing.T) {
 			config:      configWithGCSBackend,
 			expectedErr: nil,
 		},
+		"should create a GCS bucket with the operations retries enabled": {
+			config:      configWithGCSBackend + "operation_retry_max_attempts: 3\n",
+			expectedErr: nil,
+		},
 		"should return error on unknown backend": {
 			config:      configWithUnknownBackend,
 			expectedErr: ErrUnsupportedStorageBackend,
@@ -167,6 +172,11 @@ func TestClient_ConfigValidation(t *testing.T) {
 			cfg:           Config{StorageBackendConfig: StorageBackendConfig{Backend: "flash drive"}},
 			expectedError: ErrUnsupportedStorageBackend,
 		},
+		{
+			name:          "access log enabled with an invalid buffer size",
+			cfg:           Config{StorageBackendConfig: StorageBackendConfig{Backend: Filesystem}, AccessLog: AccessLogConfig{File: "access.log", BufferSize: 0}},
+			expectedError: errInvalidAccessLogBufferSize,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -178,6 +188,32 @@ func TestClient_ConfigValidation(t *testing.T) {
 	}
 }
 
+func TestNewClient_AccessLog(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	logFile := path.Join(tempDir, "access.log")
+	cfg := Config{
+		StorageBackendConfig: StorageBackendConfig{
+			Backend: Filesystem,
+			Filesystem: filesystem.Config{
+				Directory: path.Join(tempDir, "bucket"),
+			},
+		},
+		AccessLog: AccessLogConfig{File: logFile, BufferSize: 10},
+	}
+
+	client, err := NewClient(ctx, cfg, "test", util_log.Logger, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	require.NoError(t, client.Upload(ctx, "file", bytes.NewBufferString("content")))
+
+	// Closing the client writes the buffered entries.
+	require.NoError(t, client.Close())
+
+	b, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"operation":"upload","key":"file"`)
+}
+
 func TestNewPrefixedBucketClient(t *testing.T) {
 	t.Run("with prefix", func(t *testing.T) {
 		ctx := context.Background()
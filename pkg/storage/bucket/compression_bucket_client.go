@@ -0,0 +1,325 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	// CompressionGzip is the gzip compression algorithm.
+	CompressionGzip = "gzip"
+
+	// CompressionZstd is the zstd compression algorithm.
+	CompressionZstd = "zstd"
+)
+
+// compressedObjectMagic prefixes the content of the objects compressed by the middleware, so that they
+// can be told apart from the other objects without looking up any other object. It's followed by the ID
+// of the compression algorithm and by the size of the uncompressed content, as a big endian uint64.
+var compressedObjectMagic = []byte("\x00mimir-compressed\x00")
+
+// compressedObjectHeaderSize is the size of the header of the objects compressed by the middleware.
+var compressedObjectHeaderSize = len(compressedObjectMagic) + 1 + 8
+
+var (
+	SupportedCompressionAlgorithms = []string{CompressionGzip, CompressionZstd}
+
+	ErrUnsupportedCompressionAlgorithm = errors.New("unsupported compression algorithm")
+)
+
+// compressionCodec compresses and decompresses objects with a given algorithm.
+type compressionCodec struct {
+	// id identifies the algorithm in the header of the compressed objects. It must never change.
+	id         byte
+	compress   func(data []byte) ([]byte, error)
+	decompress func(r io.Reader) (io.ReadCloser, error)
+}
+
+func newCompressionCodec(algorithm string) (*compressionCodec, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return &compressionCodec{
+			id:       1,
+			compress: gzipCompress,
+			decompress: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+		}, nil
+	case CompressionZstd:
+		// The encoder is safe for concurrent use when only EncodeAll() is called.
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &compressionCodec{
+			id: 2,
+			compress: func(data []byte) ([]byte, error) {
+				return enc.EncodeAll(data, nil), nil
+			},
+			decompress: func(r io.Reader) (io.ReadCloser, error) {
+				dec, err := zstd.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return dec.IOReadCloser(), nil
+			},
+		}, nil
+	default:
+		return nil, ErrUnsupportedCompressionAlgorithm
+	}
+}
+
+func gzipCompress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressionBucket is an objstore.Bucket which transparently compresses the objects whose size is
+// above a threshold before uploading them, and decompresses them when read. Compressed objects are
+// stored with their original name, and their content is prefixed by a header with the compression
+// algorithm and the size of the uncompressed content.
+type compressionBucket struct {
+	objstore.Bucket
+
+	minSizeBytes int64
+
+	// codec is the codec used to compress uploaded objects. nil if compression on upload is disabled.
+	codec *compressionCodec
+
+	// codecs are all the codecs supported when reading objects, by ID.
+	codecs map[byte]*compressionCodec
+}
+
+// NewCompressionMiddleware wraps the input bucket with a middleware that compresses, with the given algorithm
+// (gzip or zstd), the objects whose size is above minSizeBytes before uploading them, and decompresses them on
+// Get. Objects compressed with any of the supported algorithms can be read, regardless of the configured one:
+// if the algorithm is empty, objects are uploaded uncompressed.
+//
+// Compressed objects keep their name, so Exists, Delete and Iter don't issue any extra request. Reading a range
+// of an object or getting its attributes costs one extra request, to read the header of the object.
+func NewCompressionMiddleware(inner objstore.Bucket, minSizeBytes int64, algorithm string) (objstore.Bucket, error) {
+	b := &compressionBucket{
+		Bucket:       inner,
+		minSizeBytes: minSizeBytes,
+		codecs:       map[byte]*compressionCodec{},
+	}
+
+	if algorithm != "" {
+		codec, err := newCompressionCodec(algorithm)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compression algorithm %q", algorithm)
+		}
+		b.codec = codec
+	}
+
+	for _, alg := range SupportedCompressionAlgorithms {
+		codec, err := newCompressionCodec(alg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compression algorithm %q", alg)
+		}
+		b.codecs[codec.id] = codec
+	}
+
+	return b, nil
+}
+
+// Upload implements objstore.Bucket.
+func (b *compressionBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if b.codec == nil {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	// Avoid buffering the object in memory if we already know it's too small to be compressed.
+	if size, err := objstore.TryToGetSize(r); err == nil && size <= b.minSizeBytes {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "read object %s", name)
+	}
+	if int64(len(data)) <= b.minSizeBytes {
+		return b.Bucket.Upload(ctx, name, bytes.NewReader(data))
+	}
+
+	compressed, err := b.codec.compress(data)
+	if err != nil {
+		return errors.Wrapf(err, "compress object %s", name)
+	}
+
+	header := make([]byte, 0, compressedObjectHeaderSize)
+	header = append(header, compressedObjectMagic...)
+	header = append(header, b.codec.id)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(data)))
+
+	return b.Bucket.Upload(ctx, name, io.MultiReader(bytes.NewReader(header), bytes.NewReader(compressed)))
+}
+
+// Get implements objstore.Bucket.
+func (b *compressionBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, compressedObjectHeaderSize)
+	n, err := io.ReadFull(rc, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	codec, _, err := b.parseHeader(header[:n])
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "object %s", name)
+	}
+	if codec == nil {
+		// The object is not compressed: return its content, including the bytes read so far.
+		return struct {
+			io.Reader
+			io.Closer
+		}{Reader: io.MultiReader(bytes.NewReader(header[:n]), rc), Closer: rc}, nil
+	}
+
+	dec, err := codec.decompress(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(err, "decompress object %s", name)
+	}
+	return &decompressingReader{ReadCloser: dec, underlying: rc}, nil
+}
+
+// GetRange implements objstore.Bucket. The range of compressed objects is read from the decompressed
+// content, so the object has to be downloaded from the beginning.
+func (b *compressionBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	codec, _, err := b.readHeader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if codec == nil {
+		return b.Bucket.GetRange(ctx, name, off, length)
+	}
+
+	rc, err := b.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.CopyN(io.Discard, rc, off); err != nil && !errors.Is(err, io.EOF) {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	var r io.Reader = rc
+	if length >= 0 {
+		r = io.LimitReader(rc, length)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{Reader: r, Closer: rc}, nil
+}
+
+// Attributes implements objstore.Bucket. The size of compressed objects is the size of their uncompressed content.
+func (b *compressionBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil || attrs.Size < int64(compressedObjectHeaderSize) {
+		return attrs, err
+	}
+
+	codec, size, err := b.readHeader(ctx, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	if codec != nil {
+		attrs.Size = int64(size)
+	}
+	return attrs, nil
+}
+
+// readHeader reads the header of the object, returning the codec it's compressed with and the size of its
+// uncompressed content. The returned codec is nil if the object is not compressed.
+func (b *compressionBucket) readHeader(ctx context.Context, name string) (*compressionCodec, uint64, error) {
+	rc, err := b.Bucket.GetRange(ctx, name, 0, int64(compressedObjectHeaderSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	header, err := io.ReadAll(rc)
+	if closeErr := rc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	codec, size, err := b.parseHeader(header)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "object %s", name)
+	}
+	return codec, size, nil
+}
+
+// parseHeader parses the header of an object. The returned codec is nil if the object is not compressed.
+func (b *compressionBucket) parseHeader(header []byte) (*compressionCodec, uint64, error) {
+	if len(header) < compressedObjectHeaderSize || !bytes.HasPrefix(header, compressedObjectMagic) {
+		return nil, 0, nil
+	}
+
+	id := header[len(compressedObjectMagic)]
+	codec, ok := b.codecs[id]
+	if !ok {
+		return nil, 0, errors.Errorf("unknown compression algorithm ID %d", id)
+	}
+	return codec, binary.BigEndian.Uint64(header[len(compressedObjectMagic)+1:]), nil
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *compressionBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *compressionBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &compressionBucket{
+			Bucket:       ib.WithExpectedErrs(fn),
+			minSizeBytes: b.minSizeBytes,
+			codec:        b.codec,
+			codecs:       b.codecs,
+		}
+	}
+
+	return b
+}
+
+// decompressingReader reads the decompressed content of an object, closing both the decompressor
+// and the underlying object reader on Close().
+type decompressingReader struct {
+	io.ReadCloser
+	underlying io.Closer
+}
+
+func (r *decompressingReader) Close() error {
+	decErr := r.ReadCloser.Close()
+	if err := r.underlying.Close(); err != nil {
+		return err
+	}
+	return decErr
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"version":1,"ulid":"01GEVR5EDCPBFXFJ4HZVBYJ9TF"}`, 100)
+
+	for _, algorithm := range SupportedCompressionAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			ctx := context.Background()
+			mem := objstore.NewInMemBucket()
+			bkt, err := NewCompressionMiddleware(mem, 100, algorithm)
+			require.NoError(t, err)
+
+			require.NoError(t, bkt.Upload(ctx, "user/small.json", strings.NewReader("small")))
+			require.NoError(t, bkt.Upload(ctx, "user/large.json", strings.NewReader(large)))
+
+			// The objects should keep their name, and only the large one should be stored compressed.
+			assert.ElementsMatch(t, []string{"user/small.json", "user/large.json"}, listObjects(t, mem, "user/"))
+			assert.Equal(t, []byte("small"), mem.Objects()["user/small.json"])
+			assert.Less(t, len(mem.Objects()["user/large.json"]), len(large))
+
+			assert.ElementsMatch(t, []string{"user/small.json", "user/large.json"}, listObjects(t, bkt, "user/"))
+			assert.Equal(t, "small", readObject(t, bkt, "user/small.json"))
+			assert.Equal(t, large, readObject(t, bkt, "user/large.json"))
+
+			rc, err := bkt.GetRange(ctx, "user/large.json", 10, 20)
+			require.NoError(t, err)
+			assert.Equal(t, large[10:30], readAndClose(t, rc))
+
+			rc, err = bkt.GetRange(ctx, "user/large.json", int64(len(large)-5), -1)
+			require.NoError(t, err)
+			assert.Equal(t, large[len(large)-5:], readAndClose(t, rc))
+
+			rc, err = bkt.GetRange(ctx, "user/small.json", 1, 2)
+			require.NoError(t, err)
+			assert.Equal(t, "ma", readAndClose(t, rc))
+
+			exists, err := bkt.Exists(ctx, "user/large.json")
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			// The size should be the one of the uncompressed content.
+			attrs, err := bkt.Attributes(ctx, "user/large.json")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(large)), attrs.Size)
+
+			attrs, err = bkt.Attributes(ctx, "user/small.json")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len("small")), attrs.Size)
+
+			_, err = bkt.Get(ctx, "user/missing.json")
+			assert.True(t, bkt.IsObjNotFoundErr(err))
+
+			// Overwriting the object with a smaller content should store it uncompressed.
+			require.NoError(t, bkt.Upload(ctx, "user/large.json", strings.NewReader("not large anymore")))
+			assert.Equal(t, []byte("not large anymore"), mem.Objects()["user/large.json"])
+			assert.Equal(t, "not large anymore", readObject(t, bkt, "user/large.json"))
+
+			require.NoError(t, bkt.Delete(ctx, "user/large.json"))
+			require.NoError(t, bkt.Delete(ctx, "user/small.json"))
+			assert.Empty(t, listObjects(t, mem, "user/"))
+		})
+	}
+}
+
+func TestCompressionMiddleware_ShouldReadObjectsCompressedWithAnyAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+	content := strings.Repeat("a", 1000)
+
+	upload := func(algorithm, name string, r io.Reader) {
+		bkt, err := NewCompressionMiddleware(mem, 0, algorithm)
+		require.NoError(t, err)
+		require.NoError(t, bkt.Upload(ctx, name, r))
+	}
+	upload(CompressionGzip, "gzip", strings.NewReader(content))
+	upload(CompressionZstd, "zstd", strings.NewReader(content))
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd, ""} {
+		bkt, err := NewCompressionMiddleware(mem, 0, algorithm)
+		require.NoError(t, err)
+		assert.Equal(t, content, readObject(t, bkt, "gzip"), "algorithm: %s", algorithm)
+		assert.Equal(t, content, readObject(t, bkt, "zstd"), "algorithm: %s", algorithm)
+	}
+
+	// When compression is disabled, objects should be uploaded uncompressed.
+	upload("", "plain", bytes.NewReader([]byte(content)))
+	assert.Equal(t, []byte(content), mem.Objects()["plain"])
+}
+
+func TestCompressionMiddleware_ShouldReadObjectsNotCompressedByTheMiddleware(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	_, err := w.Write([]byte("archive"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.NoError(t, mem.Upload(ctx, "user/archive.gz", bytes.NewReader(gzipped.Bytes())))
+	require.NoError(t, mem.Upload(ctx, "user/empty", bytes.NewReader(nil)))
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd, ""} {
+		bkt, err := NewCompressionMiddleware(mem, 0, algorithm)
+		require.NoError(t, err)
+
+		// The objects should be returned as they're stored.
+		assert.Equal(t, gzipped.String(), readObject(t, bkt, "user/archive.gz"), "algorithm: %s", algorithm)
+		assert.Equal(t, "", readObject(t, bkt, "user/empty"), "algorithm: %s", algorithm)
+
+		attrs, err := bkt.Attributes(ctx, "user/archive.gz")
+		require.NoError(t, err)
+		assert.Equal(t, int64(gzipped.Len()), attrs.Size)
+	}
+}
+
+func TestCompressionMiddleware_ShouldFailOnUnsupportedAlgorithm(t *testing.T) {
+	_, err := NewCompressionMiddleware(objstore.NewInMemBucket(), 0, "lz4")
+	require.ErrorIs(t, err, ErrUnsupportedCompressionAlgorithm)
+}
+
+func listObjects(t *testing.T, bkt objstore.Bucket, dir string) []string {
+	var names []string
+	require.NoError(t, bkt.Iter(context.Background(), dir, func(name string) error {
+		names = append(names, name)
+		return nil
+	}))
+	return names
+}
+
+func readObject(t *testing.T, bkt objstore.Bucket, name string) string {
+	rc, err := bkt.Get(context.Background(), name)
+	require.NoError(t, err)
+	return readAndClose(t, rc)
+}
+
+func readAndClose(t *testing.T, rc io.ReadCloser) string {
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	return string(data)
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+// ObjectCopier is implemented by bucket clients which can copy an object within the bucket
+// using the backend native server-side copy, without downloading and re-uploading it.
+type ObjectCopier interface {
+	// CopyObject copies the src object to dst, overwriting dst if it already exists.
+	CopyObject(ctx context.Context, src, dst string) error
+}
+
+// CopyObject copies the src object to dst within the input bucket, overwriting dst if it already
+// exists. If the bucket implements ObjectCopier, the object is copied server-side, otherwise it's
+// downloaded and re-uploaded.
+func CopyObject(ctx context.Context, bkt objstore.Bucket, src, dst string) error {
+	if c, ok := bkt.(ObjectCopier); ok {
+		return c.CopyObject(ctx, src, dst)
+	}
+
+	return downloadAndUploadObject(ctx, bkt, src, dst)
+}
+
+// downloadAndUploadObject copies the src object to dst by streaming it through the client.
+func downloadAndUploadObject(ctx context.Context, bkt objstore.Bucket, src, dst string) error {
+	r, err := bkt.Get(ctx, src)
+	if err != nil {
+		return errors.Wrapf(err, "download object %s", src)
+	}
+	defer r.Close()
+
+	if err := bkt.Upload(ctx, dst, r); err != nil {
+		return errors.Wrapf(err, "upload object %s", dst)
+	}
+	return nil
+}
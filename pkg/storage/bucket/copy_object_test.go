@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket/s3"
+)
+
+func TestBackendNativeOpsBucket_ShouldTrackNativeOperations(t *testing.T) {
+	ctx := context.Background()
+
+	mem := objstore.NewInMemBucket()
+	require.NoError(t, mem.Upload(ctx, "user-1/src", strings.NewReader("content")))
+
+	reg := prometheus.NewPedanticRegistry()
+	copier := &objectCopierMock{Bucket: mem}
+	bkt := &backendNativeOpsBucket{InstrumentedBucket: objstore.WithNoopInstr(copier), backend: copier, metrics: newNativeOpsMetrics(reg)}
+
+	require.NoError(t, bkt.CopyObject(ctx, "user-1/src", "user-1/dst"))
+	require.Error(t, bkt.CopyObject(ctx, "user-1/missing", "user-1/dst"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(bkt.metrics.ops.WithLabelValues(nativeOpCopyObject)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(bkt.metrics.failures.WithLabelValues(nativeOpCopyObject)))
+	assert.Equal(t, 1, testutil.CollectAndCount(bkt.metrics.duration, "cortex_bucket_native_operation_duration_seconds"))
+}
+
+func TestCopyObject(t *testing.T) {
+	tests := map[string]struct {
+		bucket         func(mem objstore.Bucket, copier *objectCopierMock) objstore.Bucket
+		src, dst       string
+		expectedDst    string
+		expectedCopies []string
+	}{
+		"bucket without native support": {
+			bucket: func(mem objstore.Bucket, _ *objectCopierMock) objstore.Bucket {
+				return mem
+			},
+			src:         "user-1/src",
+			dst:         "user-1/dst",
+			expectedDst: "user-1/dst",
+		},
+		"bucket with native support": {
+			bucket: func(_ objstore.Bucket, copier *objectCopierMock) objstore.Bucket {
+				return copier
+			},
+			src:            "user-1/src",
+			dst:            "user-1/dst",
+			expectedDst:    "user-1/dst",
+			expectedCopies: []string{"user-1/src -> user-1/dst"},
+		},
+		"instrumented bucket with native support": {
+			bucket: func(_ objstore.Bucket, copier *objectCopierMock) objstore.Bucket {
+				return &backendNativeOpsBucket{InstrumentedBucket: objstore.WithNoopInstr(copier), backend: copier}
+			},
+			src:            "user-1/src",
+			dst:            "user-1/dst",
+			expectedDst:    "user-1/dst",
+			expectedCopies: []string{"user-1/src -> user-1/dst"},
+		},
+		"user bucket with native support": {
+			bucket: func(_ objstore.Bucket, copier *objectCopierMock) objstore.Bucket {
+				return NewUserBucketClient("user-1", copier, &mockTenantConfigProvider{})
+			},
+			src:            "src",
+			dst:            "dst",
+			expectedDst:    "user-1/dst",
+			expectedCopies: []string{"user-1/src -> user-1/dst"},
+		},
+		"user bucket with native support and custom SSE config": {
+			bucket: func(_ objstore.Bucket, copier *objectCopierMock) objstore.Bucket {
+				return NewUserBucketClient("user-1", copier, &mockTenantConfigProvider{s3SseType: s3.SSES3})
+			},
+			src:         "src",
+			dst:         "dst",
+			expectedDst: "user-1/dst",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+
+			mem := objstore.NewInMemBucket()
+			require.NoError(t, mem.Upload(ctx, "user-1/src", strings.NewReader("content")))
+
+			copier := &objectCopierMock{Bucket: mem}
+			require.NoError(t, CopyObject(ctx, testData.bucket(mem, copier), testData.src, testData.dst))
+
+			r, err := mem.Get(ctx, testData.expectedDst)
+			require.NoError(t, err)
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "content", string(content))
+
+			assert.Equal(t, testData.expectedCopies, copier.copies)
+		})
+	}
+}
+
+func TestCopyObject_ShouldFailIfSourceDoesNotExist(t *testing.T) {
+	mem := objstore.NewInMemBucket()
+
+	err := CopyObject(context.Background(), mem, "src", "dst")
+	require.Error(t, err)
+	assert.True(t, mem.IsObjNotFoundErr(errors.Cause(err)))
+}
+
+func TestS3BucketClient_CopyObject(t *testing.T) {
+	var req *http.Request
+
+	// Start a fake HTTP server which simulate S3.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The size of the source object is checked before copying it.
+		if r.Method == http.MethodHead {
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Length", "7")
+			return
+		}
+
+		// Keep track of the received request.
+		req = r
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag><LastModified>2022-10-01T00:00:00.000Z</LastModified></CopyObjectResult>`))
+	}))
+	defer srv.Close()
+
+	s3Client, err := s3.NewBucketClient(s3.Config{
+		Endpoint:        srv.Listener.Addr().String(),
+		Region:          "test",
+		BucketName:      "test-bucket",
+		SecretAccessKey: flagext.SecretWithValue("test"),
+		AccessKeyID:     "test",
+		Insecure:        true,
+		SSE:             s3.SSEConfig{Type: s3.SSES3},
+	}, "test", log.NewNopLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, CopyObject(context.Background(), NewPrefixedBucketClient(s3Client, "user-1"), "src", "dst"))
+
+	// Ensure the object has been copied server-side.
+	require.NotNil(t, req)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "/test-bucket/user-1/dst", req.URL.Path)
+	assert.Equal(t, "test-bucket/user-1/src", req.Header.Get("X-Amz-Copy-Source"))
+	assert.Equal(t, "AES256", req.Header.Get("X-Amz-Server-Side-Encryption"))
+}
+
+// objectCopierMock implements ObjectCopier on top of the wrapped bucket, keeping track of the copies.
+type objectCopierMock struct {
+	objstore.Bucket
+
+	copies []string
+}
+
+func (m *objectCopierMock) CopyObject(ctx context.Context, src, dst string) error {
+	m.copies = append(m.copies, src+" -> "+dst)
+	return downloadAndUploadObject(ctx, m.Bucket, src, dst)
+}
@@ -0,0 +1,524 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	// encryptionKeySize is the size of the AES-256 keys.
+	encryptionKeySize = 32
+
+	// encryptionNonceSize is the size of the nonce prepended to each encrypted object.
+	encryptionNonceSize = 12
+
+	// encryptionTagSize is the size of the authentication tag appended by AES-GCM to each encrypted segment.
+	encryptionTagSize = 16
+
+	// encryptionSegmentSize is the size of the plaintext segments encrypted separately, so that a range of the
+	// object can be read by downloading and decrypting only the segments containing it.
+	encryptionSegmentSize = 64 * 1024
+
+	// encryptedSegmentSize is the size of each encrypted segment, apart from the last one which can be smaller.
+	encryptedSegmentSize = encryptionSegmentSize + encryptionTagSize
+)
+
+var (
+	ErrInvalidEncryptionKey = errors.New("the encryption key must be 32 bytes long")
+	ErrDecryptionFailed     = errors.New("failed to decrypt the object: the object is not encrypted with any of the tenant keys or it's corrupted")
+)
+
+// KeyProvider provides the key used to encrypt the objects of each tenant.
+type KeyProvider interface {
+	// Key returns the 32 bytes AES-256 key of the input tenant.
+	Key(tenantID string) ([]byte, error)
+}
+
+// RotatingKeyProvider is a KeyProvider supporting key rotation: the objects encrypted with a previous key of the
+// tenant can still be read, and can be re-encrypted with the current key.
+type RotatingKeyProvider interface {
+	KeyProvider
+
+	// PreviousKeys returns the keys previously used to encrypt the objects of the input tenant.
+	PreviousKeys(tenantID string) ([][]byte, error)
+}
+
+// EncryptedUserBucketClient is a bucket client encrypting the objects of a tenant at rest with AES-256-GCM,
+// using a key which is distinct for each tenant. Each object is stored as a random nonce followed by the
+// plaintext split in segments of encryptionSegmentSize, each one encrypted separately. The object name, the
+// index of the segment and whether it's the last one are authenticated with each segment, so that objects
+// can't be swapped, and segments can't be reordered or truncated, without failing the decryption.
+type EncryptedUserBucketClient struct {
+	objstore.Bucket
+
+	userID      string
+	keyProvider KeyProvider
+}
+
+// NewEncryptedUserBucketClient wraps the input tenant bucket client with a client encrypting the objects on
+// Upload and decrypting them on Get and GetRange, using the keys of the tenant the inner client is scoped to.
+// Iter and Exists are passed through, while the size returned by Attributes is the size of the decrypted
+// content. If the key provider is a RotatingKeyProvider, the objects encrypted with a previous key of the
+// tenant can be read, and re-encrypted with ReencryptObject.
+func NewEncryptedUserBucketClient(inner UserBucketClient, keyProvider KeyProvider) *EncryptedUserBucketClient {
+	return &EncryptedUserBucketClient{
+		Bucket:      inner,
+		userID:      inner.UserID(),
+		keyProvider: keyProvider,
+	}
+}
+
+// Upload implements objstore.Bucket. The object is encrypted while it's streamed to the inner bucket.
+func (b *EncryptedUserBucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	key, err := b.keyProvider.Key(b.userID)
+	if err != nil {
+		return errors.Wrapf(err, "get encryption key of tenant %s", b.userID)
+	}
+
+	er, err := newEncryptingReader(key, name, r)
+	if err != nil {
+		return errors.Wrapf(err, "encrypt object %s", name)
+	}
+
+	return b.Bucket.Upload(ctx, name, er)
+}
+
+// Get implements objstore.Bucket. The object is decrypted while it's read.
+func (b *EncryptedUserBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	gcms, err := b.gcms()
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, encryptionNonceSize)
+	if _, err := io.ReadFull(rc, nonce); err != nil {
+		_ = rc.Close()
+		return nil, errors.Wrapf(ErrDecryptionFailed, "object %s", name)
+	}
+
+	return newDecryptingReader(gcms, name, nonce, rc, 0, false)
+}
+
+// GetRange implements objstore.Bucket. Only the encrypted segments containing the range are downloaded.
+func (b *EncryptedUserBucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	gcms, err := b.gcms()
+	if err != nil {
+		return nil, err
+	}
+
+	first := off / encryptionSegmentSize
+	rangeOff := encryptionNonceSize + first*encryptedSegmentSize
+	rangeLength := int64(-1)
+	if length >= 0 {
+		last := first
+		if length > 0 {
+			last = (off + length - 1) / encryptionSegmentSize
+		}
+		rangeLength = (last - first + 1) * encryptedSegmentSize
+	}
+
+	// The nonce is at the beginning of the object, so it's read with the range when it starts from the first segment.
+	nonce := make([]byte, encryptionNonceSize)
+	if first == 0 {
+		rangeOff = 0
+		if rangeLength >= 0 {
+			rangeLength += encryptionNonceSize
+		}
+	} else if err := b.readNonce(ctx, name, nonce); err != nil {
+		return nil, err
+	}
+
+	rc, err := b.Bucket.GetRange(ctx, name, rangeOff, rangeLength)
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		if _, err := io.ReadFull(rc, nonce); err != nil {
+			_ = rc.Close()
+			return nil, errors.Wrapf(ErrDecryptionFailed, "object %s", name)
+		}
+	}
+
+	dr, err := newDecryptingReader(gcms, name, nonce, rc, uint32(first), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.CopyN(io.Discard, dr, off-first*encryptionSegmentSize); err != nil && !errors.Is(err, io.EOF) {
+		_ = dr.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return dr, nil
+	}
+	return readCloser{Reader: io.LimitReader(dr, length), Closer: dr}, nil
+}
+
+func (b *EncryptedUserBucketClient) readNonce(ctx context.Context, name string, nonce []byte) error {
+	rc, err := b.Bucket.GetRange(ctx, name, 0, encryptionNonceSize)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	if _, err := io.ReadFull(rc, nonce); err != nil {
+		return errors.Wrapf(ErrDecryptionFailed, "object %s", name)
+	}
+	return nil
+}
+
+// Attributes implements objstore.Bucket.
+func (b *EncryptedUserBucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil {
+		return attrs, err
+	}
+
+	attrs.Size = decryptedObjectSize(attrs.Size)
+	return attrs, nil
+}
+
+// ReencryptObject re-encrypts the object with the current key of the tenant. It's used to rotate the key:
+// the object must be encrypted with the current key or with one of the previous keys of the tenant. The
+// decrypted object is buffered in memory, because it's overwritten while uploading it.
+func (b *EncryptedUserBucketClient) ReencryptObject(ctx context.Context, name string) error {
+	rc, err := b.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	plaintext, err := io.ReadAll(rc)
+	if err != nil {
+		return errors.Wrapf(err, "read object %s", name)
+	}
+
+	return b.Upload(ctx, name, bytes.NewReader(plaintext))
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *EncryptedUserBucketClient) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *EncryptedUserBucketClient) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ub, ok := b.Bucket.(UserBucketClient).WithExpectedErrs(fn).(UserBucketClient); ok {
+		return NewEncryptedUserBucketClient(ub, b.keyProvider)
+	}
+
+	return b
+}
+
+// gcms returns the ciphers of the current key of the tenant, followed by the previous ones if supported
+// by the key provider.
+func (b *EncryptedUserBucketClient) gcms() ([]cipher.AEAD, error) {
+	key, err := b.keyProvider.Key(b.userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get encryption key of tenant %s", b.userID)
+	}
+	keys := [][]byte{key}
+
+	if rotating, ok := b.keyProvider.(RotatingKeyProvider); ok {
+		previous, err := rotating.PreviousKeys(b.userID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get previous encryption keys of tenant %s", b.userID)
+		}
+		keys = append(keys, previous...)
+	}
+
+	gcms := make([]cipher.AEAD, 0, len(keys))
+	for _, key := range keys {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		gcms = append(gcms, gcm)
+	}
+	return gcms, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedObjectSize returns the size of an object once encrypted, given the size of its plaintext.
+func encryptedObjectSize(size int64) int64 {
+	segments := (size + encryptionSegmentSize - 1) / encryptionSegmentSize
+	if segments == 0 {
+		segments = 1
+	}
+	return encryptionNonceSize + size + segments*encryptionTagSize
+}
+
+// decryptedObjectSize returns the size of the plaintext of an object, given the size of the encrypted object.
+func decryptedObjectSize(size int64) int64 {
+	if size < encryptionNonceSize+encryptionTagSize {
+		return 0
+	}
+	size -= encryptionNonceSize
+	segments := (size + encryptedSegmentSize - 1) / encryptedSegmentSize
+	return size - segments*encryptionTagSize
+}
+
+// segmentNonce returns the nonce of the segment at the input index, derived from the random nonce of the object.
+func segmentNonce(dst, nonce []byte, index uint32) []byte {
+	dst = append(dst[:0], nonce...)
+	counter := binary.BigEndian.Uint32(dst[encryptionNonceSize-4:])
+	binary.BigEndian.PutUint32(dst[encryptionNonceSize-4:], counter^index)
+	return dst
+}
+
+// segmentAdditionalData returns the data authenticated with the segment at the input index: the object name,
+// the segment index and whether it's the last segment of the object.
+func segmentAdditionalData(dst []byte, name string, index uint32, last bool) []byte {
+	var suffix [5]byte
+	binary.BigEndian.PutUint32(suffix[:4], index)
+	if last {
+		suffix[4] = 1
+	}
+	return append(append(dst[:0], name...), suffix[:]...)
+}
+
+// encryptingReader reads the encrypted object of the plaintext read from the source reader: the random
+// nonce followed by the encrypted segments.
+type encryptingReader struct {
+	gcm  cipher.AEAD
+	name string
+	src  *bufio.Reader
+	size int64
+
+	nonce, segmentNonce, additionalData []byte
+	plaintext, ciphertext               []byte
+
+	// out is the encrypted data not read yet.
+	out   []byte
+	index uint32
+	done  bool
+}
+
+func newEncryptingReader(key []byte, name string, src io.Reader) (*encryptingReader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, encryptionNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+
+	// Keep track of the size, when known, so that the inner bucket client can use it.
+	size := int64(-1)
+	if s, err := objstore.TryToGetSize(src); err == nil {
+		size = encryptedObjectSize(s)
+	}
+
+	return &encryptingReader{
+		gcm:        gcm,
+		name:       name,
+		src:        bufio.NewReaderSize(src, encryptionSegmentSize),
+		size:       size,
+		nonce:      nonce,
+		plaintext:  make([]byte, encryptionSegmentSize),
+		ciphertext: make([]byte, 0, encryptedSegmentSize),
+		out:        nonce,
+	}, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.encryptNextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptingReader) encryptNextSegment() error {
+	n, err := io.ReadFull(r.src, r.plaintext)
+	last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		// A full segment is the last one if there's nothing left to read.
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.segmentNonce = segmentNonce(r.segmentNonce, r.nonce, r.index)
+	r.additionalData = segmentAdditionalData(r.additionalData, r.name, r.index, last)
+	r.out = r.gcm.Seal(r.ciphertext[:0], r.segmentNonce, r.plaintext[:n], r.additionalData)
+	r.index++
+	r.done = last
+	return nil
+}
+
+// ObjectSize implements objstore.ObjectSizer.
+func (r *encryptingReader) ObjectSize() (int64, error) {
+	if r.size < 0 {
+		return 0, errors.New("the size of the object to encrypt is unknown")
+	}
+	return r.size, nil
+}
+
+// decryptingReader reads the plaintext of the encrypted segments read from the source reader.
+type decryptingReader struct {
+	gcm  cipher.AEAD
+	name string
+	rc   io.ReadCloser
+	src  *bufio.Reader
+
+	// partial is true when the segments are a range of the object, which may not include the last segment.
+	partial bool
+
+	nonce, segmentNonce, additionalData []byte
+	ciphertext, plaintext               []byte
+
+	// out is the decrypted data not read yet.
+	out   []byte
+	index uint32
+	done  bool
+}
+
+// newDecryptingReader returns a reader of the plaintext of the encrypted segments read from the input reader,
+// starting from the segment at the input index. The first segment is decrypted right away, to find the key
+// used to encrypt the object among the input ciphers.
+func newDecryptingReader(gcms []cipher.AEAD, name string, nonce []byte, rc io.ReadCloser, index uint32, partial bool) (*decryptingReader, error) {
+	r := &decryptingReader{
+		name:       name,
+		rc:         rc,
+		src:        bufio.NewReaderSize(rc, encryptedSegmentSize),
+		partial:    partial,
+		nonce:      nonce,
+		ciphertext: make([]byte, encryptedSegmentSize),
+		plaintext:  make([]byte, 0, encryptionSegmentSize),
+		index:      index,
+	}
+
+	n, end, err := r.readNextSegment()
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	// The key used to encrypt the object is not stored, so we try all the keys of the tenant:
+	// decrypting with the wrong key fails the authentication.
+	for _, gcm := range gcms {
+		r.gcm = gcm
+		if err = r.decryptSegment(n, end); err == nil {
+			return r, nil
+		}
+	}
+
+	_ = rc.Close()
+	return nil, err
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, end, err := r.readNextSegment()
+		if err != nil {
+			return 0, err
+		}
+		if err := r.decryptSegment(n, end); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// readNextSegment reads the next encrypted segment, returning its size and whether it's at the end of the source.
+func (r *decryptingReader) readNextSegment() (int, bool, error) {
+	n, err := io.ReadFull(r.src, r.ciphertext)
+	end := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if err != nil && !end {
+		return 0, false, err
+	}
+	if !end {
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			end = true
+		} else if err != nil {
+			return 0, false, err
+		}
+	}
+	return n, end, nil
+}
+
+func (r *decryptingReader) decryptSegment(n int, end bool) error {
+	// A range past the end of the object has no segments.
+	if n == 0 && r.partial && r.index > 0 {
+		r.out = nil
+		r.done = true
+		return nil
+	}
+
+	// A full segment at the end of a range may or may not be the last one of the object.
+	lastCandidates := []bool{end}
+	if end && r.partial && n == encryptedSegmentSize {
+		lastCandidates = []bool{false, true}
+	}
+
+	r.segmentNonce = segmentNonce(r.segmentNonce, r.nonce, r.index)
+	for _, last := range lastCandidates {
+		var err error
+		r.additionalData = segmentAdditionalData(r.additionalData, r.name, r.index, last)
+		if r.out, err = r.gcm.Open(r.plaintext[:0], r.segmentNonce, r.ciphertext[:n], r.additionalData); err == nil {
+			r.index++
+			r.done = end
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrDecryptionFailed, "object %s", r.name)
+}
+
+// Close implements io.Closer.
+func (r *decryptingReader) Close() error {
+	return r.rc.Close()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
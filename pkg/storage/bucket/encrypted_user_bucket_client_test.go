@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestEncryptedUserBucketClient(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("the content of the object ", 10)
+
+	mem := objstore.NewInMemBucket()
+	keys := &mockKeyProvider{keys: map[string][]byte{"user-1": testEncryptionKey('a')}}
+	bkt := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), keys)
+
+	require.NoError(t, bkt.Upload(ctx, "object", strings.NewReader(content)))
+
+	// The object should be stored encrypted, with the nonce prepended.
+	stored := mem.Objects()["user-1/object"]
+	assert.Len(t, stored, encryptionNonceSize+len(content)+encryptionTagSize)
+	assert.Equal(t, int64(len(stored)), encryptedObjectSize(int64(len(content))))
+	assert.NotContains(t, string(stored), "the content of the object")
+
+	assert.Equal(t, content, readObject(t, bkt, "object"))
+
+	rc, err := bkt.GetRange(ctx, "object", 4, 7)
+	require.NoError(t, err)
+	assert.Equal(t, content[4:11], readAndClose(t, rc))
+
+	rc, err = bkt.GetRange(ctx, "object", int64(len(content)-3), -1)
+	require.NoError(t, err)
+	assert.Equal(t, content[len(content)-3:], readAndClose(t, rc))
+
+	attrs, err := bkt.Attributes(ctx, "object")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), attrs.Size)
+
+	exists, err := bkt.Exists(ctx, "object")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Equal(t, []string{"object"}, listObjects(t, bkt, ""))
+
+	_, err = bkt.Get(ctx, "missing")
+	assert.True(t, bkt.IsObjNotFoundErr(err))
+
+	// Uploading the same content twice should store a different ciphertext, because of the random nonce.
+	require.NoError(t, bkt.Upload(ctx, "object", strings.NewReader(content)))
+	assert.False(t, bytes.Equal(stored, mem.Objects()["user-1/object"]))
+}
+
+func TestEncryptedUserBucketClient_ShouldNotReadObjectsWithAnotherKey(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+	keys := &mockKeyProvider{keys: map[string][]byte{
+		"user-1": testEncryptionKey('a'),
+		"user-2": testEncryptionKey('b'),
+	}}
+
+	user1 := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), keys)
+	require.NoError(t, user1.Upload(ctx, "object", strings.NewReader("content")))
+
+	// Another tenant's key can't decrypt the object.
+	require.NoError(t, CopyObject(ctx, mem, "user-1/object", "user-2/object"))
+	user2 := NewEncryptedUserBucketClient(NewUserBucketClient("user-2", mem, nil), keys)
+	_, err := user2.Get(ctx, "object")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+	assert.False(t, user2.IsObjNotFoundErr(err))
+
+	// Neither can a new key of the same tenant, if the previous one is not provided.
+	keys.keys["user-1"] = testEncryptionKey('c')
+	_, err = user1.Get(ctx, "object")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+}
+
+func TestEncryptedUserBucketClient_ShouldFailWithInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	keys := &mockKeyProvider{keys: map[string][]byte{"user-1": []byte("too-short")}}
+	bkt := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", objstore.NewInMemBucket(), nil), keys)
+
+	err := bkt.Upload(ctx, "object", strings.NewReader("content"))
+	assert.True(t, errors.Is(err, ErrInvalidEncryptionKey))
+}
+
+func TestEncryptedUserBucketClient_ReencryptObject(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+	keys := &mockRotatingKeyProvider{mockKeyProvider: mockKeyProvider{keys: map[string][]byte{"user-1": testEncryptionKey('a')}}}
+	bkt := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), keys)
+
+	require.NoError(t, bkt.Upload(ctx, "object", strings.NewReader("content")))
+
+	// Rotate the key: the object can still be read with the previous key.
+	keys.previous = map[string][][]byte{"user-1": {testEncryptionKey('a')}}
+	keys.keys["user-1"] = testEncryptionKey('b')
+	assert.Equal(t, "content", readObject(t, bkt, "object"))
+
+	require.NoError(t, bkt.ReencryptObject(ctx, "object"))
+
+	// Once re-encrypted, the previous key is not needed anymore.
+	keys.previous = nil
+	assert.Equal(t, "content", readObject(t, bkt, "object"))
+
+	// And the object can't be read with the previous key.
+	previous := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), &mockKeyProvider{keys: map[string][]byte{"user-1": testEncryptionKey('a')}})
+	_, err := previous.Get(ctx, "object")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+}
+
+func TestEncryptedUserBucketClient_MultipleSegments(t *testing.T) {
+	ctx := context.Background()
+	keys := &mockKeyProvider{keys: map[string][]byte{"user-1": testEncryptionKey('a')}}
+
+	for _, size := range []int{0, 1, encryptionSegmentSize - 1, encryptionSegmentSize, encryptionSegmentSize + 1, 3 * encryptionSegmentSize, 3*encryptionSegmentSize + 100} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			content := make([]byte, size)
+			for i := range content {
+				content[i] = byte(i % 251)
+			}
+
+			mem := objstore.NewInMemBucket()
+			bkt := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), keys)
+			require.NoError(t, bkt.Upload(ctx, "object", bytes.NewReader(content)))
+
+			stored := mem.Objects()["user-1/object"]
+			assert.Equal(t, encryptedObjectSize(int64(size)), int64(len(stored)))
+
+			attrs, err := bkt.Attributes(ctx, "object")
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), attrs.Size)
+
+			assert.Equal(t, string(content), readObject(t, bkt, "object"))
+
+			for _, r := range [][2]int64{{0, 10}, {0, -1}, {encryptionSegmentSize - 5, 10}, {encryptionSegmentSize, -1}, {int64(size) / 2, int64(size) / 3}, {int64(size), -1}} {
+				off, length := r[0], r[1]
+				if off > int64(size) {
+					continue
+				}
+				end := int64(size)
+				if length >= 0 && off+length < end {
+					end = off + length
+				}
+
+				rc, err := bkt.GetRange(ctx, "object", off, length)
+				require.NoError(t, err)
+				assert.Equal(t, string(content[off:end]), readAndClose(t, rc), "off: %d length: %d", off, length)
+			}
+		})
+	}
+}
+
+func TestEncryptedUserBucketClient_ShouldAuthenticateObjectNameAndSegments(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+	keys := &mockKeyProvider{keys: map[string][]byte{"user-1": testEncryptionKey('a')}}
+	bkt := NewEncryptedUserBucketClient(NewUserBucketClient("user-1", mem, nil), keys)
+
+	content := bytes.Repeat([]byte("x"), 2*encryptionSegmentSize)
+	require.NoError(t, bkt.Upload(ctx, "object", bytes.NewReader(content)))
+	stored := mem.Objects()["user-1/object"]
+
+	// An object moved to another name can't be decrypted.
+	require.NoError(t, mem.Upload(ctx, "user-1/another", bytes.NewReader(stored)))
+	_, err := bkt.Get(ctx, "another")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+
+	// A copy through the client is re-encrypted, so it can be decrypted.
+	require.NoError(t, CopyObject(ctx, bkt, "object", "copy"))
+	assert.Equal(t, string(content), readObject(t, bkt, "copy"))
+
+	// An object truncated at a segment boundary can't be decrypted.
+	require.NoError(t, mem.Upload(ctx, "user-1/object", bytes.NewReader(stored[:encryptionNonceSize+encryptedSegmentSize])))
+	_, err = bkt.Get(ctx, "object")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+
+	// Segments can't be reordered.
+	swapped := append([]byte{}, stored[:encryptionNonceSize]...)
+	swapped = append(swapped, stored[encryptionNonceSize+encryptedSegmentSize:]...)
+	swapped = append(swapped, stored[encryptionNonceSize:encryptionNonceSize+encryptedSegmentSize]...)
+	require.NoError(t, mem.Upload(ctx, "user-1/object", bytes.NewReader(swapped)))
+	_, err = bkt.Get(ctx, "object")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+}
+
+func testEncryptionKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, encryptionKeySize)
+}
+
+type mockKeyProvider struct {
+	keys map[string][]byte
+}
+
+func (m *mockKeyProvider) Key(tenantID string) ([]byte, error) {
+	key, ok := m.keys[tenantID]
+	if !ok {
+		return nil, errors.Errorf("no key for tenant %s", tenantID)
+	}
+	return key, nil
+}
+
+type mockRotatingKeyProvider struct {
+	mockKeyProvider
+	previous map[string][][]byte
+}
+
+func (m *mockRotatingKeyProvider) PreviousKeys(tenantID string) ([][]byte, error) {
+	return m.previous[tenantID], nil
+}
@@ -0,0 +1,243 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	eventBridgeSource = "grafana.mimir"
+
+	eventBridgeDetailTypeObjectCreated = "Object Created"
+	eventBridgeDetailTypeObjectDeleted = "Object Deleted"
+
+	// eventBridgeBufferSize is the max number of events waiting to be published. Events are dropped
+	// when the buffer is full, so that a slow or unavailable EventBridge doesn't block the bucket operations.
+	eventBridgeBufferSize = 1000
+
+	// eventBridgeMaxBatchSize is the max number of events published by a single PutEvents call,
+	// as allowed by EventBridge.
+	eventBridgeMaxBatchSize = 10
+
+	eventBridgePublishTimeout = 10 * time.Second
+)
+
+// objectEvent is the detail of the events published by the bucket returned by NewEventBridgeBucket.
+type objectEvent struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Size   *int64 `json:"size,omitempty"`
+}
+
+// eventBridgeBucket is an objstore.Bucket publishing an event to AWS EventBridge for each object
+// created or deleted.
+type eventBridgeBucket struct {
+	objstore.Bucket
+
+	// The publisher is shared with the buckets returned by WithExpectedErrs().
+	publisher *eventBridgePublisher
+}
+
+// NewEventBridgeBucket wraps the input bucket with a middleware publishing an event to the input EventBridge
+// bus on each successful Upload, with the object name and size, and Delete, with the object name. Events are
+// published asynchronously and in batches, so that the bucket operations are not slowed down: an event is
+// dropped if the buffer of events waiting to be published is full. Close() publishes the buffered events
+// before closing the input bucket.
+func NewEventBridgeBucket(inner objstore.Bucket, client eventbridgeiface.EventBridgeAPI, busName string, logger log.Logger) objstore.Bucket {
+	return &eventBridgeBucket{
+		Bucket:    inner,
+		publisher: newEventBridgePublisher(client, busName, logger),
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (b *eventBridgeBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	// If the size is not known upfront, we count the bytes read by the inner bucket. The reader is wrapped only
+	// in this case, so that the inner bucket can still get the size upfront when possible.
+	size, err := objstore.TryToGetSize(r)
+	var counter *countingReader
+	if err != nil {
+		counter = &countingReader{Reader: r}
+		r = counter
+	}
+
+	if err := b.Bucket.Upload(ctx, name, r); err != nil {
+		return err
+	}
+
+	if counter != nil {
+		size = counter.n
+	}
+	b.publisher.enqueue(eventBridgeDetailTypeObjectCreated, objectEvent{Bucket: b.Name(), Name: name, Size: &size})
+	return nil
+}
+
+// Delete implements objstore.Bucket.
+func (b *eventBridgeBucket) Delete(ctx context.Context, name string) error {
+	if err := b.Bucket.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	b.publisher.enqueue(eventBridgeDetailTypeObjectDeleted, objectEvent{Bucket: b.Name(), Name: name})
+	return nil
+}
+
+// Close implements io.Closer.
+func (b *eventBridgeBucket) Close() error {
+	b.publisher.stop()
+	return b.Bucket.Close()
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *eventBridgeBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *eventBridgeBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &eventBridgeBucket{Bucket: ib.WithExpectedErrs(fn), publisher: b.publisher}
+	}
+
+	return b
+}
+
+// eventBridgePublisher publishes the enqueued events from a background goroutine.
+type eventBridgePublisher struct {
+	client  eventbridgeiface.EventBridgeAPI
+	busName string
+	logger  log.Logger
+
+	// The events channel is closed by stop(), once no more events can be sent to it.
+	mtx     sync.RWMutex
+	events  chan *eventbridge.PutEventsRequestEntry
+	stopped bool
+
+	done chan struct{}
+}
+
+func newEventBridgePublisher(client eventbridgeiface.EventBridgeAPI, busName string, logger log.Logger) *eventBridgePublisher {
+	p := &eventBridgePublisher{
+		client:  client,
+		busName: busName,
+		logger:  logger,
+		events:  make(chan *eventbridge.PutEventsRequestEntry, eventBridgeBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go p.loop()
+
+	return p
+}
+
+// enqueue adds an event to the buffer of events waiting to be published, unless the buffer is full.
+func (p *eventBridgePublisher) enqueue(detailType string, event objectEvent) {
+	detail, err := json.Marshal(event)
+	if err != nil {
+		level.Warn(p.logger).Log("msg", "failed to encode bucket event", "object", event.Name, "err", err)
+		return
+	}
+
+	entry := &eventbridge.PutEventsRequestEntry{
+		EventBusName: aws.String(p.busName),
+		Source:       aws.String(eventBridgeSource),
+		DetailType:   aws.String(detailType),
+		Detail:       aws.String(string(detail)),
+		Time:         aws.Time(time.Now()),
+	}
+
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	if p.stopped {
+		return
+	}
+
+	select {
+	case p.events <- entry:
+	default:
+		level.Warn(p.logger).Log("msg", "dropped bucket event because too many events are waiting to be published", "object", event.Name, "type", detailType)
+	}
+}
+
+// stop waits until the buffered events have been published. Events enqueued afterwards are dropped.
+func (p *eventBridgePublisher) stop() {
+	p.mtx.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.events)
+	}
+	p.mtx.Unlock()
+
+	<-p.done
+}
+
+// loop publishes the buffered events in batches, until the buffer is closed and drained.
+func (p *eventBridgePublisher) loop() {
+	defer close(p.done)
+
+	for entry := range p.events {
+		batch := []*eventbridge.PutEventsRequestEntry{entry}
+
+		// Batch the events already waiting in the buffer.
+	batching:
+		for len(batch) < eventBridgeMaxBatchSize {
+			select {
+			case next, ok := <-p.events:
+				if !ok {
+					break batching
+				}
+				batch = append(batch, next)
+			default:
+				break batching
+			}
+		}
+
+		p.publish(batch)
+	}
+}
+
+func (p *eventBridgePublisher) publish(batch []*eventbridge.PutEventsRequestEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventBridgePublishTimeout)
+	defer cancel()
+
+	out, err := p.client.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{Entries: batch})
+	if err != nil {
+		level.Warn(p.logger).Log("msg", "failed to publish bucket events", "events", len(batch), "err", err)
+		return
+	}
+
+	if failed := aws.Int64Value(out.FailedEntryCount); failed > 0 {
+		// The result entries are in the same order as the request entries.
+		for i, res := range out.Entries {
+			if res == nil || res.ErrorCode == nil || i >= len(batch) {
+				continue
+			}
+			level.Warn(p.logger).Log("msg", "failed to publish bucket event", "detail", aws.StringValue(batch[i].Detail), "code", aws.StringValue(res.ErrorCode), "err", aws.StringValue(res.ErrorMessage))
+		}
+	}
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/eventbridge/eventbridgeiface"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestEventBridgeBucket(t *testing.T) {
+	ctx := context.Background()
+	client := &eventBridgeClientMock{}
+	bkt := NewEventBridgeBucket(objstore.NewInMemBucket(), client, "bus", log.NewNopLogger())
+
+	require.NoError(t, bkt.Upload(ctx, "user-1/object", strings.NewReader("content")))
+	require.NoError(t, bkt.Upload(ctx, "user-1/unknown-size", io.MultiReader(strings.NewReader("12"), strings.NewReader("345"))))
+	require.NoError(t, bkt.Delete(ctx, "user-1/object"))
+
+	// Failed operations don't publish events.
+	require.Error(t, bkt.Delete(ctx, "user-1/missing"))
+
+	// Reads don't publish events.
+	_, err := bkt.Exists(ctx, "user-1/unknown-size")
+	require.NoError(t, err)
+
+	// The buffered events are published on close.
+	require.NoError(t, bkt.Close())
+
+	// Operations after close don't publish events.
+	require.NoError(t, bkt.Upload(ctx, "user-1/after-close", strings.NewReader("content")))
+
+	entries := client.publishedEntries()
+	require.Len(t, entries, 3)
+
+	expected := []struct {
+		detailType string
+		detail     objectEvent
+	}{
+		{detailType: "Object Created", detail: objectEvent{Bucket: "inmem", Name: "user-1/object", Size: aws.Int64(7)}},
+		{detailType: "Object Created", detail: objectEvent{Bucket: "inmem", Name: "user-1/unknown-size", Size: aws.Int64(5)}},
+		{detailType: "Object Deleted", detail: objectEvent{Bucket: "inmem", Name: "user-1/object"}},
+	}
+
+	for i, entry := range entries {
+		assert.Equal(t, "bus", aws.StringValue(entry.EventBusName))
+		assert.Equal(t, "grafana.mimir", aws.StringValue(entry.Source))
+		assert.Equal(t, expected[i].detailType, aws.StringValue(entry.DetailType))
+
+		detail := objectEvent{}
+		require.NoError(t, json.Unmarshal([]byte(aws.StringValue(entry.Detail)), &detail))
+		assert.Equal(t, expected[i].detail, detail)
+	}
+}
+
+func TestEventBridgeBucket_ShouldNotFailOperationsIfPublishingFails(t *testing.T) {
+	ctx := context.Background()
+	client := &eventBridgeClientMock{err: errors.New("publishing failed")}
+	bkt := NewEventBridgeBucket(objstore.NewInMemBucket(), client, "bus", log.NewNopLogger())
+
+	require.NoError(t, bkt.Upload(ctx, "user-1/object", strings.NewReader("content")))
+	require.NoError(t, bkt.Delete(ctx, "user-1/object"))
+	require.NoError(t, bkt.Close())
+
+	assert.Len(t, client.publishedEntries(), 2)
+}
+
+func TestEventBridgeBucket_ShouldPublishInBatches(t *testing.T) {
+	ctx := context.Background()
+	client := &eventBridgeClientMock{}
+	inner := objstore.NewInMemBucket()
+	bkt := NewEventBridgeBucket(inner, client, "bus", log.NewNopLogger())
+
+	for i := 0; i < 3*eventBridgeMaxBatchSize; i++ {
+		require.NoError(t, bkt.Upload(ctx, "user-1/object", strings.NewReader("content")))
+	}
+	require.NoError(t, bkt.Close())
+
+	assert.Len(t, client.publishedEntries(), 3*eventBridgeMaxBatchSize)
+	for _, size := range client.batchSizes() {
+		assert.LessOrEqual(t, size, eventBridgeMaxBatchSize)
+	}
+}
+
+type eventBridgeClientMock struct {
+	eventbridgeiface.EventBridgeAPI
+
+	err error
+
+	mtx     sync.Mutex
+	batches [][]*eventbridge.PutEventsRequestEntry
+}
+
+func (m *eventBridgeClientMock) PutEventsWithContext(_ aws.Context, input *eventbridge.PutEventsInput, _ ...request.Option) (*eventbridge.PutEventsOutput, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.batches = append(m.batches, input.Entries)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &eventbridge.PutEventsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
+
+func (m *eventBridgeClientMock) publishedEntries() []*eventbridge.PutEventsRequestEntry {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var entries []*eventbridge.PutEventsRequestEntry
+	for _, batch := range m.batches {
+		entries = append(entries, batch...)
+	}
+	return entries
+}
+
+func (m *eventBridgeClientMock) batchSizes() []int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	sizes := make([]int, 0, len(m.batches))
+	for _, batch := range m.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
@@ -7,15 +7,50 @@ package gcs
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/providers/gcs"
+	"google.golang.org/api/iterator"
 	yaml "gopkg.in/yaml.v3"
 )
 
+const (
+	// maxComposeSources is the maximum number of source objects which can be composed in a single GCS request.
+	maxComposeSources = 32
+
+	// multipartUploadsPrefix is the bucket prefix under which the temporary part objects are uploaded. It's
+	// within the Mimir internals prefix (bucket.MimirInternalsPrefix), which is never listed as a tenant.
+	multipartUploadsPrefix = "__mimir_cluster/multipart-uploads"
+
+	// staleMultipartUploadsMaxAge is the age after which the parts of a multipart upload which has been
+	// neither completed nor aborted (e.g. because the process was killed) are deleted.
+	staleMultipartUploadsMaxAge = 24 * time.Hour
+
+	// staleMultipartUploadsCleanupInterval is how frequently the stale multipart uploads are looked up.
+	staleMultipartUploadsCleanupInterval = time.Hour
+)
+
+// BucketClient is the GCS bucket client. It wraps the Thanos GCS bucket client to support
+// GCS native operations not exposed by the objstore.Bucket interface.
+type BucketClient struct {
+	*gcs.Bucket
+
+	cleanupMtx  sync.Mutex
+	lastCleanup time.Time
+}
+
 // NewBucketClient creates a new GCS bucket client
-func NewBucketClient(ctx context.Context, cfg Config, name string, logger log.Logger) (objstore.Bucket, error) {
+func NewBucketClient(ctx context.Context, cfg Config, name string, logger log.Logger) (*BucketClient, error) {
 	bucketConfig := gcs.Config{
 		Bucket:         cfg.BucketName,
 		ServiceAccount: cfg.ServiceAccount.String(),
@@ -28,5 +63,167 @@ func NewBucketClient(ctx context.Context, cfg Config, name string, logger log.Lo
 		return nil, err
 	}
 
-	return gcs.NewBucket(ctx, logger, serialized, name)
+	bkt, err := gcs.NewBucket(ctx, logger, serialized, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BucketClient{Bucket: bkt}, nil
+}
+
+// DisableRetries disables the retries of the failed requests built into the GCS client.
+func (b *BucketClient) DisableRetries() {
+	handle := b.Handle()
+	*handle = *handle.Retryer(storage.WithPolicy(storage.RetryNever))
+}
+
+// IterWithAttributes calls f for each object whose name starts with prefix (recursively), passing
+// the object name, ETag and attributes as returned by the GCS list objects API.
+func (b *BucketClient) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	it := b.Handle().Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Skip the "directory" placeholder objects.
+		if strings.HasSuffix(attrs.Name, objstore.DirDelim) {
+			continue
+		}
+
+		if err := f(attrs.Name, attrs.Etag, objstore.ObjectAttributes{
+			Size:         attrs.Size,
+			LastModified: attrs.Updated,
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyObject copies the src object to dst using the GCS server-side rewrite, without downloading it.
+func (b *BucketClient) CopyObject(ctx context.Context, src, dst string) error {
+	_, err := b.Handle().Object(dst).CopierFrom(b.Handle().Object(src)).Run(ctx)
+	return err
+}
+
+// CreateMultipartUpload implements bucket.MultipartUploader. GCS has no native multipart upload: each
+// part is uploaded as a temporary object, and the parts are composed into the final object on completion.
+// The upload ID is a ULID, whose timestamp is used to delete the parts of the stale uploads.
+func (b *BucketClient) CreateMultipartUpload(ctx context.Context, _ string) (string, error) {
+	now := time.Now()
+	b.cleanUpStaleMultipartUploads(ctx, now)
+
+	return ulid.MustNew(ulid.Timestamp(now), rand.Reader).String(), nil
+}
+
+// UploadPart implements bucket.MultipartUploader. The returned part ID is the name of the temporary part object.
+// The part is written with the GCS resumable upload, so a transient error only resends the chunk being written.
+func (b *BucketClient) UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, _ int64) (string, error) {
+	partName := fmt.Sprintf("%s%05d", multipartUploadPartsPrefix(uploadID), partNumber)
+
+	w := b.Handle().Object(partName).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return partName, nil
+}
+
+// CompleteMultipartUpload implements bucket.MultipartUploader. The parts are composed into the final object
+// in batches, because of the GCS limit on the number of sources of a single compose, and then deleted.
+func (b *BucketClient) CompleteMultipartUpload(ctx context.Context, name, uploadID string, partIDs []string) error {
+	dst := b.Handle().Object(name)
+
+	var sources []*storage.ObjectHandle
+	for idx, partName := range partIDs {
+		sources = append(sources, b.Handle().Object(partName))
+
+		// Compose when the batch is full or this is the last part. The object composed so far is the first
+		// source of the next batch, given GCS allows the destination of a compose to be one of its sources.
+		if len(sources) < maxComposeSources && idx < len(partIDs)-1 {
+			continue
+		}
+		if _, err := dst.ComposerFrom(sources...).Run(ctx); err != nil {
+			return err
+		}
+		sources = []*storage.ObjectHandle{dst}
+	}
+
+	// The object has been successfully composed, so failing to delete the parts is not an upload failure.
+	_ = b.AbortMultipartUpload(ctx, name, uploadID)
+	return nil
+}
+
+// AbortMultipartUpload implements bucket.MultipartUploader, deleting the temporary part objects.
+func (b *BucketClient) AbortMultipartUpload(ctx context.Context, name, uploadID string) error {
+	it := b.Handle().Objects(ctx, &storage.Query{Prefix: multipartUploadPartsPrefix(uploadID)})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := b.Handle().Object(attrs.Name).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+			return err
+		}
+	}
+}
+
+// cleanUpStaleMultipartUploads deletes, at most once every staleMultipartUploadsCleanupInterval, the
+// parts of the multipart uploads started more than staleMultipartUploadsMaxAge ago, which have been left
+// behind by uploads which have been interrupted before being completed or aborted. It's best-effort:
+// the stale uploads which fail to be deleted are retried at the next cleanup.
+func (b *BucketClient) cleanUpStaleMultipartUploads(ctx context.Context, now time.Time) {
+	b.cleanupMtx.Lock()
+	defer b.cleanupMtx.Unlock()
+
+	if now.Sub(b.lastCleanup) < staleMultipartUploadsCleanupInterval {
+		return
+	}
+	b.lastCleanup = now
+
+	it := b.Handle().Objects(ctx, &storage.Query{Prefix: multipartUploadsPrefix + "/", Delimiter: "/"})
+	for {
+		attrs, err := it.Next()
+		if err != nil {
+			// Either iterator.Done or a failure, which is retried at the next cleanup.
+			return
+		}
+
+		// Only the upload prefixes are returned, given the parts are listed with a delimiter.
+		if attrs.Prefix == "" {
+			continue
+		}
+
+		uploadID := path.Base(attrs.Prefix)
+		id, err := ulid.Parse(uploadID)
+		if err != nil || now.Sub(ulid.Time(id.Time())) < staleMultipartUploadsMaxAge {
+			continue
+		}
+
+		_ = b.AbortMultipartUpload(ctx, "", uploadID)
+	}
+}
+
+// multipartUploadPartsPrefix returns the name prefix of the temporary part objects of a multipart upload.
+// The parts are stored outside of the destination object's location, so that a block is never listed with
+// partial objects while being uploaded, or left with orphaned ones if the upload is interrupted.
+func multipartUploadPartsPrefix(uploadID string) string {
+	return fmt.Sprintf("%s/%s/", multipartUploadsPrefix, uploadID)
 }
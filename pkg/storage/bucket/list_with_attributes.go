@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/thanos-io/objstore"
+)
+
+// ObjectInfo holds the metadata of an object returned by ListWithAttributes.
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+
+	// Err is set if the listing failed. An ObjectInfo with Err set is always the last
+	// one sent over the channel, and all other fields are empty.
+	Err error
+}
+
+// AttributesIterator is implemented by bucket clients which can list objects along with their
+// metadata in a single call to the backend, instead of issuing an extra call for each object.
+type AttributesIterator interface {
+	// IterWithAttributes calls f for each object whose name starts with prefix (recursively).
+	IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error
+}
+
+// ListWithAttributes lists all objects in the prefix (recursively) along with their metadata.
+// The prefix is a directory: the objstore.DirDelim is appended if missing. If the input bucket
+// implements AttributesIterator, objects metadata are fetched from the backend native list
+// response, otherwise an extra Attributes() call is issued for each object and the ETag is
+// left empty. The returned channel is closed once the listing is done or ctx is canceled.
+func ListWithAttributes(ctx context.Context, bkt objstore.BucketReader, prefix string) (<-chan ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan ObjectInfo)
+
+	go func() {
+		defer close(ch)
+
+		err := iterWithAttributes(ctx, bkt, prefix, func(name, etag string, attrs objstore.ObjectAttributes) error {
+			select {
+			case ch <- ObjectInfo{Name: name, Size: attrs.Size, ETag: etag, LastModified: attrs.LastModified}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+
+		// Do not block on sending the error if the caller is gone.
+		if err != nil && ctx.Err() == nil {
+			ch <- ObjectInfo{Err: err}
+		}
+	}()
+
+	return ch, nil
+}
+
+// iterWithAttributes calls f for each object in the prefix (recursively), using the bucket native
+// AttributesIterator implementation if available.
+func iterWithAttributes(ctx context.Context, bkt objstore.BucketReader, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	if prefix != "" && !strings.HasSuffix(prefix, objstore.DirDelim) {
+		prefix += objstore.DirDelim
+	}
+
+	if it, ok := bkt.(AttributesIterator); ok {
+		return it.IterWithAttributes(ctx, prefix, f)
+	}
+
+	return bkt.Iter(ctx, prefix, func(name string) error {
+		attrs, err := bkt.Attributes(ctx, name)
+		if err != nil {
+			// The object may have been deleted in the meanwhile.
+			if bkt.IsObjNotFoundErr(err) {
+				return nil
+			}
+			return err
+		}
+
+		return f(name, "", attrs)
+	}, objstore.WithRecursiveIter)
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestListWithAttributes(t *testing.T) {
+	ctx := context.Background()
+
+	mem := objstore.NewInMemBucket()
+	require.NoError(t, mem.Upload(ctx, "obj", strings.NewReader("hello")))
+	require.NoError(t, mem.Upload(ctx, "prefix/1", strings.NewReader("a")))
+	require.NoError(t, mem.Upload(ctx, "prefix/sub/2", strings.NewReader("bb")))
+	require.NoError(t, mem.Upload(ctx, "prefixed/3", strings.NewReader("ccc")))
+
+	tests := map[string]struct {
+		bucket   objstore.Bucket
+		prefix   string
+		expected map[string]ObjectInfo
+	}{
+		"bucket without native support, ETag should be empty": {
+			bucket: mem,
+			prefix: "prefix",
+			expected: map[string]ObjectInfo{
+				"prefix/1":     {Name: "prefix/1", Size: 1},
+				"prefix/sub/2": {Name: "prefix/sub/2", Size: 2},
+			},
+		},
+		"bucket with native support": {
+			bucket: &attributesIteratorMock{Bucket: mem},
+			prefix: "prefix/",
+			expected: map[string]ObjectInfo{
+				"prefix/1":     {Name: "prefix/1", Size: 1, ETag: "etag-prefix/1"},
+				"prefix/sub/2": {Name: "prefix/sub/2", Size: 2, ETag: "etag-prefix/sub/2"},
+			},
+		},
+		"prefixed bucket with native support": {
+			bucket: NewPrefixedBucketClient(&attributesIteratorMock{Bucket: mem}, "prefix"),
+			prefix: "",
+			expected: map[string]ObjectInfo{
+				"1":     {Name: "1", Size: 1, ETag: "etag-prefix/1"},
+				"sub/2": {Name: "sub/2", Size: 2, ETag: "etag-prefix/sub/2"},
+			},
+		},
+		"SSE bucket without native support": {
+			bucket: NewSSEBucketClient("user-1", mem, nil),
+			prefix: "prefixed",
+			expected: map[string]ObjectInfo{
+				"prefixed/3": {Name: "prefixed/3", Size: 3},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ch, err := ListWithAttributes(ctx, testData.bucket, testData.prefix)
+			require.NoError(t, err)
+
+			actual := map[string]ObjectInfo{}
+			for info := range ch {
+				require.NoError(t, info.Err)
+				assert.False(t, info.LastModified.IsZero())
+
+				// Do not compare the last modified time.
+				info.LastModified = time.Time{}
+				actual[info.Name] = info
+			}
+
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
+
+func TestListWithAttributes_ShouldReturnErrorAsLastObjectInfo(t *testing.T) {
+	ctx := context.Background()
+	expectedErr := errors.New("mocked error")
+
+	mem := objstore.NewInMemBucket()
+	require.NoError(t, mem.Upload(ctx, "prefix/1", strings.NewReader("a")))
+
+	ch, err := ListWithAttributes(ctx, &attributesIteratorMock{Bucket: mem, err: expectedErr}, "prefix")
+	require.NoError(t, err)
+
+	var infos []ObjectInfo
+	for info := range ch {
+		infos = append(infos, info)
+	}
+
+	require.Len(t, infos, 2)
+	assert.Equal(t, "prefix/1", infos[0].Name)
+	assert.NoError(t, infos[0].Err)
+	assert.Equal(t, ObjectInfo{Err: expectedErr}, infos[1])
+}
+
+func TestListWithAttributes_ShouldCloseChannelOnContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mem := objstore.NewInMemBucket()
+	require.NoError(t, mem.Upload(ctx, "prefix/1", strings.NewReader("a")))
+	require.NoError(t, mem.Upload(ctx, "prefix/2", strings.NewReader("b")))
+
+	ch, err := ListWithAttributes(ctx, mem, "prefix")
+	require.NoError(t, err)
+
+	// Read only the first object and then cancel the context.
+	info := <-ch
+	require.NoError(t, info.Err)
+	cancel()
+
+	select {
+	case <-waitClosed(ch):
+	case <-time.After(time.Second):
+		t.Fatal("the channel has not been closed after the context has been canceled")
+	}
+
+	_, err = ListWithAttributes(ctx, mem, "prefix")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func waitClosed(ch <-chan ObjectInfo) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
+
+// attributesIteratorMock implements AttributesIterator on top of the wrapped bucket,
+// returning a mocked ETag and optionally failing after listing all objects.
+type attributesIteratorMock struct {
+	objstore.Bucket
+
+	err error
+}
+
+func (m *attributesIteratorMock) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	err := m.Iter(ctx, prefix, func(name string) error {
+		attrs, err := m.Attributes(ctx, name)
+		if err != nil {
+			return err
+		}
+		return f(name, "etag-"+name, attrs)
+	}, objstore.WithRecursiveIter)
+	if err != nil {
+		return err
+	}
+
+	return m.err
+}
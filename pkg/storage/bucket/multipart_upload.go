@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"flag"
+	"io"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	// MinMultipartUploadPartSize is the minimum size of each part of a multipart upload. It's the
+	// most restrictive limit across the supported backends (S3 doesn't allow parts smaller than 5MiB,
+	// except the last one).
+	MinMultipartUploadPartSize = 5 * 1024 * 1024
+
+	defaultMultipartUploadPartSize       = 64 * 1024 * 1024
+	defaultMultipartUploadConcurrency    = 4
+	defaultMultipartUploadPartMaxRetries = 3
+
+	// Backoff between the attempts of a failed part upload.
+	multipartUploadPartMinBackoff = 100 * time.Millisecond
+	multipartUploadPartMaxBackoff = 5 * time.Second
+)
+
+var (
+	errInvalidMultipartUploadPartSize    = errors.New("the multipart upload part size must be at least 5MiB")
+	errInvalidMultipartUploadConcurrency = errors.New("the multipart upload concurrency must be greater than 0")
+	errInvalidMultipartUploadMaxRetries  = errors.New("the multipart upload part max retries must not be negative")
+)
+
+// MultipartUploadConfig holds the config of the multipart upload of large objects.
+type MultipartUploadConfig struct {
+	Threshold      uint64 `yaml:"multipart_upload_threshold" category:"experimental"`
+	PartSize       uint64 `yaml:"multipart_upload_part_size" category:"experimental"`
+	Concurrency    int    `yaml:"multipart_upload_concurrency" category:"experimental"`
+	PartMaxRetries int    `yaml:"multipart_upload_part_max_retries" category:"experimental"`
+}
+
+func (cfg *MultipartUploadConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.Uint64Var(&cfg.Threshold, prefix+"multipart-upload-threshold", 0, "Objects whose size is greater than or equal to this threshold (in bytes) are uploaded in parts, in parallel, using the backend native multipart upload. Supported by the s3 and gcs backends, and ignored by the other ones. With the gcs backend, the parts are uploaded as temporary objects, and the parts of the uploads interrupted for more than 24h are deleted. 0 to disable.")
+	f.Uint64Var(&cfg.PartSize, prefix+"multipart-upload-part-size", defaultMultipartUploadPartSize, "Size (in bytes) of each part of a multipart upload. The last part may be smaller. Must be at least 5MiB.")
+	f.IntVar(&cfg.Concurrency, prefix+"multipart-upload-concurrency", defaultMultipartUploadConcurrency, "Maximum number of parts of a single multipart upload which are uploaded concurrently.")
+	f.IntVar(&cfg.PartMaxRetries, prefix+"multipart-upload-part-max-retries", defaultMultipartUploadPartMaxRetries, "Maximum number of times the upload of a part is retried, with an exponential backoff, before failing the multipart upload. Only the failed part is uploaded again, while the parts already uploaded are kept. Ignored, and the parts are not retried, when the failed bucket operations are retried. 0 to disable.")
+}
+
+func (cfg *MultipartUploadConfig) Validate() error {
+	if cfg.Threshold == 0 {
+		return nil
+	}
+	if cfg.PartSize < MinMultipartUploadPartSize {
+		return errInvalidMultipartUploadPartSize
+	}
+	if cfg.Concurrency < 1 {
+		return errInvalidMultipartUploadConcurrency
+	}
+	if cfg.PartMaxRetries < 0 {
+		return errInvalidMultipartUploadMaxRetries
+	}
+	return nil
+}
+
+// MultipartUploader is implemented by bucket clients which can upload an object in parts, using
+// the backend native multipart upload. Parts of the same upload can be uploaded concurrently.
+type MultipartUploader interface {
+	// CreateMultipartUpload starts a new multipart upload of the object name and returns its ID.
+	CreateMultipartUpload(ctx context.Context, name string) (uploadID string, err error)
+
+	// UploadPart uploads the part partNumber (1-based) of size bytes read from r, and returns
+	// an identifier of the uploaded part which should be passed to CompleteMultipartUpload().
+	UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, size int64) (partID string, err error)
+
+	// CompleteMultipartUpload assembles the uploaded parts into the object name. The partIDs are
+	// the ones returned by UploadPart(), ordered by part number.
+	CompleteMultipartUpload(ctx context.Context, name, uploadID string, partIDs []string) error
+
+	// AbortMultipartUpload aborts the multipart upload, cleaning up the parts uploaded so far.
+	AbortMultipartUpload(ctx context.Context, name, uploadID string) error
+}
+
+// MultipartUploadManager is an objstore.Bucket which uploads large objects in parts, in parallel,
+// if the wrapped bucket implements MultipartUploader. Smaller objects, objects whose size can't be
+// determined upfront and objects which can't be read at arbitrary offsets are uploaded as is.
+type MultipartUploadManager struct {
+	objstore.Bucket
+
+	uploader MultipartUploader
+	cfg      MultipartUploadConfig
+}
+
+// NewMultipartUploadManager makes a new MultipartUploadManager wrapping the input bucket.
+func NewMultipartUploadManager(bkt objstore.Bucket, cfg MultipartUploadConfig) *MultipartUploadManager {
+	uploader, _ := bkt.(MultipartUploader)
+
+	return &MultipartUploadManager{
+		Bucket:   bkt,
+		uploader: uploader,
+		cfg:      cfg,
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (m *MultipartUploadManager) Upload(ctx context.Context, name string, r io.Reader) error {
+	if m.uploader == nil || m.cfg.Threshold == 0 {
+		return m.Bucket.Upload(ctx, name, r)
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return m.Bucket.Upload(ctx, name, r)
+	}
+
+	size, err := objstore.TryToGetSize(r)
+	if err != nil || size < int64(m.cfg.Threshold) {
+		return m.Bucket.Upload(ctx, name, r)
+	}
+
+	return m.uploadMultipart(ctx, name, ra, size)
+}
+
+func (m *MultipartUploadManager) uploadMultipart(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	partSize := int64(m.cfg.PartSize)
+	numParts := int((size + partSize - 1) / partSize)
+
+	uploadID, err := m.uploader.CreateMultipartUpload(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "create multipart upload of %s", name)
+	}
+
+	partIDs := make([]string, numParts)
+	err = concurrency.ForEachJob(ctx, numParts, m.cfg.Concurrency, func(ctx context.Context, idx int) error {
+		offset := int64(idx) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		partID, err := m.uploadPart(ctx, name, uploadID, idx+1, r, offset, length)
+		if err != nil {
+			return errors.Wrapf(err, "upload part %d", idx+1)
+		}
+
+		partIDs[idx] = partID
+		return nil
+	})
+
+	if err == nil {
+		err = m.uploader.CompleteMultipartUpload(ctx, name, uploadID, partIDs)
+	}
+
+	if err != nil {
+		// Clean up the parts uploaded so far. This is best effort, the original error is what matters.
+		_ = m.uploader.AbortMultipartUpload(ctx, name, uploadID)
+		return errors.Wrapf(err, "multipart upload of %s", name)
+	}
+
+	return nil
+}
+
+// uploadPart uploads a single part, retrying it on failure. Each attempt reads the part from the
+// beginning, so a partially uploaded part is never completed with the content of a later attempt.
+func (m *MultipartUploadManager) uploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.ReaderAt, offset, length int64) (string, error) {
+	boff := backoff.New(ctx, backoff.Config{
+		MinBackoff: multipartUploadPartMinBackoff,
+		MaxBackoff: multipartUploadPartMaxBackoff,
+	})
+
+	for retries := 0; ; retries++ {
+		partID, err := m.uploader.UploadPart(ctx, name, uploadID, partNumber, io.NewSectionReader(r, offset, length), length)
+		if err == nil || retries >= m.cfg.PartMaxRetries {
+			return partID, err
+		}
+
+		boff.Wait()
+		if ctx.Err() != nil {
+			return "", err
+		}
+	}
+}
+
+// IterWithAttributes implements AttributesIterator.
+func (m *MultipartUploadManager) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	return iterWithAttributes(ctx, m.Bucket, prefix, f)
+}
+
+// CopyObject implements ObjectCopier.
+func (m *MultipartUploadManager) CopyObject(ctx context.Context, src, dst string) error {
+	return CopyObject(ctx, m.Bucket, src, dst)
+}
+
+// ReaderWithExpectedErrs allows to specify a filter that marks certain errors as expected, so it will not increment
+// thanos_objstore_bucket_operation_failures_total metric.
+func (m *MultipartUploadManager) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return m.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs allows to specify a filter that marks certain errors as expected, so it will not increment
+// thanos_objstore_bucket_operation_failures_total metric.
+func (m *MultipartUploadManager) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := m.Bucket.(objstore.InstrumentedBucket); ok {
+		return NewMultipartUploadManager(ib.WithExpectedErrs(fn), m.cfg)
+	}
+
+	return m
+}
@@ -0,0 +1,348 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket/s3"
+)
+
+func TestMultipartUploadConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cfg      MultipartUploadConfig
+		expected error
+	}{
+		"disabled": {
+			cfg: MultipartUploadConfig{},
+		},
+		"valid config": {
+			cfg: MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize, Concurrency: 1},
+		},
+		"part size too small": {
+			cfg:      MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize - 1, Concurrency: 1},
+			expected: errInvalidMultipartUploadPartSize,
+		},
+		"invalid concurrency": {
+			cfg:      MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize, Concurrency: 0},
+			expected: errInvalidMultipartUploadConcurrency,
+		},
+		"negative part max retries": {
+			cfg:      MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize, Concurrency: 1, PartMaxRetries: -1},
+			expected: errInvalidMultipartUploadMaxRetries,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, testData.cfg.Validate())
+		})
+	}
+}
+
+func TestMultipartUploadManager_Upload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10)
+
+	tests := map[string]struct {
+		reader        func() io.Reader
+		threshold     uint64
+		expectedParts []string
+	}{
+		"object smaller than the threshold": {
+			reader:    func() io.Reader { return bytes.NewReader(content) },
+			threshold: 101,
+		},
+		"object with unknown size": {
+			reader:    func() io.Reader { return io.LimitReader(bytes.NewReader(content), int64(len(content))) },
+			threshold: 1,
+		},
+		"object size is equal to the threshold": {
+			reader:        func() io.Reader { return bytes.NewReader(content) },
+			threshold:     100,
+			expectedParts: []string{"1:30", "2:30", "3:30", "4:10"},
+		},
+		"object size is a multiple of the part size": {
+			reader:        func() io.Reader { return bytes.NewReader(content[:90]) },
+			threshold:     1,
+			expectedParts: []string{"1:30", "2:30", "3:30"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			uploader := newMultipartUploaderMock(objstore.NewInMemBucket())
+
+			r := testData.reader()
+			expected, err := io.ReadAll(testData.reader())
+			require.NoError(t, err)
+
+			m := NewMultipartUploadManager(uploader, MultipartUploadConfig{Threshold: testData.threshold, PartSize: 30, Concurrency: 2})
+			require.NoError(t, m.Upload(ctx, "object", r))
+
+			actual, err := m.Get(ctx, "object")
+			require.NoError(t, err)
+			actualContent, err := io.ReadAll(actual)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actualContent)
+
+			assert.Equal(t, testData.expectedParts, uploader.uploadedParts())
+			assert.Empty(t, uploader.aborted)
+		})
+	}
+}
+
+func TestMultipartUploadManager_Upload_ShouldAbortOnPartFailure(t *testing.T) {
+	ctx := context.Background()
+	uploader := newMultipartUploaderMock(objstore.NewInMemBucket())
+	uploader.failPart = 2
+
+	m := NewMultipartUploadManager(uploader, MultipartUploadConfig{Threshold: 1, PartSize: 30, Concurrency: 1})
+	err := m.Upload(ctx, "object", bytes.NewReader(make([]byte, 100)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upload part 2")
+
+	assert.Equal(t, []string{"object"}, uploader.aborted)
+
+	exists, err := m.Exists(ctx, "object")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestMultipartUploadManager_Upload_ShouldRetryOnlyTheFailedPart(t *testing.T) {
+	ctx := context.Background()
+	uploader := newMultipartUploaderMock(objstore.NewInMemBucket())
+	uploader.failPart = 2
+	uploader.failPartTimes = 2
+
+	content := make([]byte, 100)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	m := NewMultipartUploadManager(uploader, MultipartUploadConfig{Threshold: 1, PartSize: 30, Concurrency: 2, PartMaxRetries: 2})
+	require.NoError(t, m.Upload(ctx, "object", bytes.NewReader(content)))
+
+	// The object is complete and not corrupted by the content read before the failures.
+	actual, err := m.Get(ctx, "object")
+	require.NoError(t, err)
+	actualContent, err := io.ReadAll(actual)
+	require.NoError(t, err)
+	assert.Equal(t, content, actualContent)
+
+	assert.Equal(t, map[int]int{1: 1, 2: 3, 3: 1, 4: 1}, uploader.partAttempts())
+	assert.Empty(t, uploader.aborted)
+}
+
+func TestMultipartUploadManager_Upload_ShouldAbortWhenPartRetriesAreExhausted(t *testing.T) {
+	ctx := context.Background()
+	uploader := newMultipartUploaderMock(objstore.NewInMemBucket())
+	uploader.failPart = 2
+	uploader.failPartTimes = 2
+
+	m := NewMultipartUploadManager(uploader, MultipartUploadConfig{Threshold: 1, PartSize: 30, Concurrency: 1, PartMaxRetries: 1})
+	err := m.Upload(ctx, "object", bytes.NewReader(make([]byte, 100)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upload part 2")
+
+	assert.Equal(t, 2, uploader.partAttempts()[2])
+	assert.Equal(t, []string{"object"}, uploader.aborted)
+}
+
+func TestMultipartUploadManager_Upload_ShouldFallbackToUploadIfBucketIsNotMultipartUploader(t *testing.T) {
+	ctx := context.Background()
+	mem := objstore.NewInMemBucket()
+
+	m := NewMultipartUploadManager(mem, MultipartUploadConfig{Threshold: 1, PartSize: 30, Concurrency: 1})
+	require.NoError(t, m.Upload(ctx, "object", bytes.NewReader([]byte("content"))))
+
+	exists, err := mem.Exists(ctx, "object")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestS3BucketClient_MultipartUpload(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests []string
+		sseType  string
+	)
+
+	// Start a fake HTTP server which simulate S3.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			requests = append(requests, "create")
+			sseType = r.Header.Get("X-Amz-Server-Side-Encryption")
+			_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>user-1/object</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut && query.Get("uploadId") == "upload-1":
+			requests = append(requests, "part "+query.Get("partNumber"))
+			w.Header().Set("ETag", `"etag-`+query.Get("partNumber")+`"`)
+		case r.Method == http.MethodPost && query.Get("uploadId") == "upload-1":
+			requests = append(requests, "complete")
+			_, _ = w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>test-bucket</Bucket><Key>user-1/object</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+		default:
+			requests = append(requests, r.Method+" "+r.URL.String())
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		StorageBackendConfig: StorageBackendConfig{
+			Backend: S3,
+			S3: s3.Config{
+				Endpoint:        srv.Listener.Addr().String(),
+				Region:          "test",
+				BucketName:      "test-bucket",
+				SecretAccessKey: flagext.SecretWithValue("test"),
+				AccessKeyID:     "test",
+				Insecure:        true,
+				SSE:             s3.SSEConfig{Type: s3.SSES3},
+			},
+		},
+		MultipartUpload: MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize, Concurrency: 1},
+	}
+
+	// The object is uploaded in parts of the configured size using the S3 native multipart upload.
+	client, err := NewClient(context.Background(), cfg, "test", log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, NewPrefixedBucketClient(client, "user-1").Upload(context.Background(), "object", bytes.NewReader(make([]byte, 2*MinMultipartUploadPartSize+1))))
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, []string{"create", "part 1", "part 2", "part 3", "complete"}, requests)
+	assert.Equal(t, "AES256", sseType)
+}
+
+// multipartUploaderMock implements MultipartUploader on top of the wrapped bucket, keeping the
+// parts in memory until the upload is completed.
+type multipartUploaderMock struct {
+	objstore.Bucket
+
+	// failPart is the number of the part whose upload fails (0 to never fail).
+	failPart int
+
+	// failPartTimes is the number of times the upload of failPart fails, after reading part of its
+	// content (0 to always fail).
+	failPartTimes int
+
+	mtx      sync.Mutex
+	nextID   int
+	parts    map[string]map[int][]byte
+	attempts map[int]int
+	aborted  []string
+}
+
+func newMultipartUploaderMock(bkt objstore.Bucket) *multipartUploaderMock {
+	return &multipartUploaderMock{Bucket: bkt, parts: map[string]map[int][]byte{}, attempts: map[int]int{}}
+}
+
+func (m *multipartUploaderMock) CreateMultipartUpload(_ context.Context, _ string) (string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.nextID++
+	uploadID := strconv.Itoa(m.nextID)
+	m.parts[uploadID] = map[int][]byte{}
+	return uploadID, nil
+}
+
+func (m *multipartUploaderMock) UploadPart(_ context.Context, _, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	m.mtx.Lock()
+	m.attempts[partNumber]++
+	attempt := m.attempts[partNumber]
+	m.mtx.Unlock()
+
+	if partNumber == m.failPart && (m.failPartTimes == 0 || attempt <= m.failPartTimes) {
+		// Simulate a failure in the middle of the part upload.
+		_, _ = io.CopyN(io.Discard, r, size/2)
+		return "", errors.New("part upload failed")
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) != size {
+		return "", fmt.Errorf("expected %d bytes, read %d", size, len(data))
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.parts[uploadID][partNumber] = data
+	return strconv.Itoa(partNumber), nil
+}
+
+func (m *multipartUploaderMock) CompleteMultipartUpload(ctx context.Context, name, uploadID string, partIDs []string) error {
+	m.mtx.Lock()
+	parts := m.parts[uploadID]
+	m.mtx.Unlock()
+
+	var buf bytes.Buffer
+	for idx, partID := range partIDs {
+		if partID != strconv.Itoa(idx+1) {
+			return fmt.Errorf("unexpected part ID %s at position %d", partID, idx)
+		}
+		buf.Write(parts[idx+1])
+	}
+	return m.Bucket.Upload(ctx, name, &buf)
+}
+
+func (m *multipartUploaderMock) AbortMultipartUpload(_ context.Context, name, uploadID string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	delete(m.parts, uploadID)
+	m.aborted = append(m.aborted, name)
+	return nil
+}
+
+// partAttempts returns the number of upload attempts of each part, by part number.
+func (m *multipartUploaderMock) partAttempts() map[int]int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	out := make(map[int]int, len(m.attempts))
+	for partNumber, attempts := range m.attempts {
+		out[partNumber] = attempts
+	}
+	return out
+}
+
+// uploadedParts returns the number and size of all parts uploaded so far, formatted as "number:size".
+func (m *multipartUploaderMock) uploadedParts() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var out []string
+	for _, parts := range m.parts {
+		for partNumber, data := range parts {
+			out = append(out, fmt.Sprintf("%d:%d", partNumber, len(data)))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/grafana/dskit/multierror"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+var errNoMatchingRoute = errors.New("no bucket route matches the object name")
+
+// PrefixRoute maps a prefix glob to a bucket.
+type PrefixRoute struct {
+	// Pattern is matched against the leading path segments of the object name, using the
+	// path.Match syntax. For example, the pattern "eu-*" matches all objects whose first path
+	// segment starts with "eu-", while "eu-*/markers" matches the "markers" directory of them.
+	// An empty pattern matches any object name, and can be used to configure the default bucket.
+	Pattern string
+
+	Bucket objstore.Bucket
+}
+
+// Validate returns an error if the route pattern is malformed.
+func (r PrefixRoute) Validate() error {
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return errors.Wrapf(err, "invalid bucket route pattern %q", r.Pattern)
+	}
+	return nil
+}
+
+// matches returns whether the input object name matches the route pattern.
+// Malformed patterns never match.
+func (r PrefixRoute) matches(name string) bool {
+	if r.Pattern == "" {
+		return true
+	}
+
+	patternSegments := strings.Count(r.Pattern, objstore.DirDelim) + 1
+	nameSegments := strings.SplitN(strings.TrimPrefix(name, objstore.DirDelim), objstore.DirDelim, patternSegments+1)
+	if len(nameSegments) < patternSegments {
+		return false
+	}
+
+	matched, err := path.Match(r.Pattern, strings.Join(nameSegments[:patternSegments], objstore.DirDelim))
+	return err == nil && matched
+}
+
+// PrefixRoutingBucketClient is an objstore.Bucket which routes each operation to the bucket
+// of the first route matching the object name.
+type PrefixRoutingBucketClient struct {
+	routes []PrefixRoute
+
+	// The distinct buckets of all routes, in the order they've been configured.
+	buckets []objstore.Bucket
+
+	// The max number of path segments of the routes patterns.
+	maxPatternSegments int
+}
+
+// NewPrefixRoutingBucket returns a bucket which routes operations to the bucket of the first route
+// whose pattern matches the object name. The route with an empty pattern, if any, acts as the default
+// bucket for object names not matching any other route. Operations on object names not matching any
+// route fail. Routes with a malformed pattern never match: see PrefixRoute.Validate().
+func NewPrefixRoutingBucket(routes []PrefixRoute) objstore.Bucket {
+	b := &PrefixRoutingBucketClient{routes: routes}
+
+	for _, r := range routes {
+		if segments := strings.Count(r.Pattern, objstore.DirDelim) + 1; segments > b.maxPatternSegments {
+			b.maxPatternSegments = segments
+		}
+
+		if !containsBucket(b.buckets, r.Bucket) {
+			b.buckets = append(b.buckets, r.Bucket)
+		}
+	}
+
+	return b
+}
+
+func (b *PrefixRoutingBucketClient) route(name string) (objstore.Bucket, error) {
+	for _, r := range b.routes {
+		if r.matches(name) {
+			return r.Bucket, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", errNoMatchingRoute, name)
+}
+
+// mayRouteDir returns whether any object within the input dir may be routed to the input bucket.
+func (b *PrefixRoutingBucketClient) mayRouteDir(dir string, bkt objstore.Bucket) bool {
+	dirSegments := strings.Split(strings.Trim(dir, objstore.DirDelim), objstore.DirDelim)
+
+	for _, r := range b.routes {
+		patternSegments := strings.Split(r.Pattern, objstore.DirDelim)
+
+		// If the route pattern is not deeper than the dir, then all objects within the dir
+		// are routed to this bucket if the pattern matches (first match wins).
+		if r.Pattern == "" || len(patternSegments) <= len(dirSegments) {
+			if r.matches(dir) {
+				return r.Bucket == bkt
+			}
+			continue
+		}
+
+		// Otherwise, some objects within the dir may be routed to this bucket if the
+		// dir matches the leading segments of the pattern.
+		matched, err := path.Match(strings.Join(patternSegments[:len(dirSegments)], objstore.DirDelim), strings.Join(dirSegments, objstore.DirDelim))
+		if err == nil && matched && r.Bucket == bkt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close implements io.Closer.
+func (b *PrefixRoutingBucketClient) Close() error {
+	errs := multierror.New()
+	for _, bkt := range b.buckets {
+		errs.Add(bkt.Close())
+	}
+	return errs.Err()
+}
+
+// Upload implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	bkt, err := b.route(name)
+	if err != nil {
+		return err
+	}
+	return bkt.Upload(ctx, name, r)
+}
+
+// Delete implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Delete(ctx context.Context, name string) error {
+	bkt, err := b.route(name)
+	if err != nil {
+		return err
+	}
+	return bkt.Delete(ctx, name)
+}
+
+// Name implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Name() string {
+	names := make([]string, 0, len(b.buckets))
+	for _, bkt := range b.buckets {
+		names = append(names, bkt.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Iter implements objstore.Bucket. If the input dir is deep enough to be routed to a single
+// bucket, only that bucket is iterated. Otherwise all buckets are iterated, and each entry is
+// returned only if the bucket it has been found in is the one it's routed to.
+func (b *PrefixRoutingBucketClient) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if trimmed := strings.Trim(dir, objstore.DirDelim); trimmed != "" && strings.Count(trimmed, objstore.DirDelim)+1 >= b.maxPatternSegments {
+		bkt, err := b.route(dir)
+		if err != nil {
+			return err
+		}
+		return bkt.Iter(ctx, dir, f, options...)
+	}
+
+	seen := map[string]struct{}{}
+
+	for _, bkt := range b.buckets {
+		err := bkt.Iter(ctx, dir, func(name string) error {
+			if _, ok := seen[name]; ok {
+				return nil
+			}
+
+			if strings.HasSuffix(name, objstore.DirDelim) {
+				if !b.mayRouteDir(name, bkt) {
+					return nil
+				}
+			} else if routed, err := b.route(name); err != nil || routed != bkt {
+				return nil
+			}
+
+			seen[name] = struct{}{}
+			return f(name)
+		}, options...)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	bkt, err := b.route(name)
+	if err != nil {
+		return nil, err
+	}
+	return bkt.Get(ctx, name)
+}
+
+// GetRange implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	bkt, err := b.route(name)
+	if err != nil {
+		return nil, err
+	}
+	return bkt.GetRange(ctx, name, off, length)
+}
+
+// Exists implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Exists(ctx context.Context, name string) (bool, error) {
+	bkt, err := b.route(name)
+	if err != nil {
+		return false, err
+	}
+	return bkt.Exists(ctx, name)
+}
+
+// IsObjNotFoundErr implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) IsObjNotFoundErr(err error) bool {
+	for _, bkt := range b.buckets {
+		if bkt.IsObjNotFoundErr(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes implements objstore.Bucket.
+func (b *PrefixRoutingBucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	bkt, err := b.route(name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return bkt.Attributes(ctx, name)
+}
+
+func containsBucket(buckets []objstore.Bucket, bkt objstore.Bucket) bool {
+	for _, b := range buckets {
+		if b == bkt {
+			return true
+		}
+	}
+	return false
+}
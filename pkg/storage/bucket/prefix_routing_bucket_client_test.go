@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestPrefixRoutingBucketClient(t *testing.T) {
+	ctx := context.Background()
+
+	eu := objstore.NewInMemBucket()
+	euMarkers := objstore.NewInMemBucket()
+	def := objstore.NewInMemBucket()
+
+	bkt := NewPrefixRoutingBucket([]PrefixRoute{
+		{Pattern: "eu-*/markers", Bucket: euMarkers},
+		{Pattern: "eu-*", Bucket: eu},
+		{Pattern: "", Bucket: def},
+	})
+
+	// Upload objects through the routing bucket.
+	for _, name := range []string{"eu-1/block/meta.json", "eu-1/markers/block-deletion-mark.json", "eu-2/block/meta.json", "us-1/block/meta.json", "eu"} {
+		require.NoError(t, bkt.Upload(ctx, name, strings.NewReader(name)))
+	}
+
+	// Ensure objects have been stored in the right bucket.
+	assert.ElementsMatch(t, []string{"eu-1/block/meta.json", "eu-2/block/meta.json"}, listAll(t, eu, "", objstore.WithRecursiveIter))
+	assert.ElementsMatch(t, []string{"eu-1/markers/block-deletion-mark.json"}, listAll(t, euMarkers, "", objstore.WithRecursiveIter))
+	assert.ElementsMatch(t, []string{"us-1/block/meta.json", "eu"}, listAll(t, def, "", objstore.WithRecursiveIter))
+
+	// Ensure objects are read from the right bucket.
+	reader, err := bkt.Get(ctx, "eu-1/markers/block-deletion-mark.json")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "eu-1/markers/block-deletion-mark.json", string(content))
+
+	exists, err := bkt.Exists(ctx, "us-1/block/meta.json")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// The same object in a different bucket should not be visible.
+	require.NoError(t, def.Upload(ctx, "eu-3/block/meta.json", strings.NewReader("")))
+	exists, err = bkt.Exists(ctx, "eu-3/block/meta.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = bkt.Get(ctx, "eu-3/block/meta.json")
+	assert.True(t, bkt.IsObjNotFoundErr(err))
+
+	// Iterating the root should merge all buckets, skipping objects stored in the wrong bucket.
+	assert.Equal(t, []string{"eu", "eu-1/", "eu-2/", "us-1/"}, listAll(t, bkt, ""))
+	assert.Equal(t, []string{"eu-1/block/", "eu-1/markers/"}, listAll(t, bkt, "eu-1/"))
+	assert.Equal(t, []string{"eu-1/markers/block-deletion-mark.json"}, listAll(t, bkt, "eu-1/markers/"))
+	assert.Equal(t, []string{"eu-1/block/meta.json"}, listAll(t, bkt, "eu-1/block"))
+
+	require.NoError(t, bkt.Delete(ctx, "eu-1/markers/block-deletion-mark.json"))
+	assert.Empty(t, listAll(t, euMarkers, "", objstore.WithRecursiveIter))
+}
+
+func TestPrefixRoutingBucketClient_ShouldFailIfNoRouteMatches(t *testing.T) {
+	ctx := context.Background()
+
+	bkt := NewPrefixRoutingBucket([]PrefixRoute{
+		{Pattern: "eu-*", Bucket: objstore.NewInMemBucket()},
+	})
+
+	err := bkt.Upload(ctx, "us-1/block/meta.json", strings.NewReader(""))
+	require.ErrorIs(t, err, errNoMatchingRoute)
+
+	_, err = bkt.Exists(ctx, "us-1/block/meta.json")
+	require.ErrorIs(t, err, errNoMatchingRoute)
+}
+
+func TestPrefixRoute_Validate(t *testing.T) {
+	assert.NoError(t, PrefixRoute{Pattern: ""}.Validate())
+	assert.NoError(t, PrefixRoute{Pattern: "eu-*/markers"}.Validate())
+	assert.Error(t, PrefixRoute{Pattern: "eu-["}.Validate())
+}
+
+func listAll(t *testing.T, bkt objstore.Bucket, dir string, options ...objstore.IterOption) []string {
+	var names []string
+	require.NoError(t, bkt.Iter(context.Background(), dir, func(name string) error {
+		names = append(names, name)
+		return nil
+	}, options...))
+
+	sort.Strings(names)
+	return names
+}
@@ -58,6 +58,19 @@ func (b *PrefixedBucketClient) Iter(ctx context.Context, dir string, f func(stri
 	}, options...)
 }
 
+// IterWithAttributes implements AttributesIterator. The configured prefix will be stripped
+// from object names before supplied function is applied.
+func (b *PrefixedBucketClient) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	return iterWithAttributes(ctx, b.bucket, b.fullName(prefix), func(name, etag string, attrs objstore.ObjectAttributes) error {
+		return f(strings.TrimPrefix(name, b.prefix+objstore.DirDelim), etag, attrs)
+	})
+}
+
+// CopyObject implements ObjectCopier.
+func (b *PrefixedBucketClient) CopyObject(ctx context.Context, src, dst string) error {
+	return CopyObject(ctx, b.bucket, b.fullName(src), b.fullName(dst))
+}
+
 // Get returns a reader for the given object name.
 func (b *PrefixedBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	return b.bucket.Get(ctx, b.fullName(name))
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+)
+
+// QuotaExceededError is returned by the bucket returned by NewQuotaEnforcingBucket when an upload would
+// make the size of the tenant objects exceed the tenant quota.
+type QuotaExceededError struct {
+	Tenant string
+	// Quota is the max size, in bytes, of the tenant objects.
+	Quota int64
+	// Used is the size, in bytes, of the tenant objects before the upload.
+	Used int64
+	// UploadSize is the size, in bytes, of the rejected upload. If the size of the upload is not known in
+	// advance, it's the size read before the quota was exceeded.
+	UploadSize int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded for tenant %s: uploading %d bytes would exceed the quota of %d bytes, %d bytes already used", e.Tenant, e.UploadSize, e.Quota, e.Used)
+}
+
+// quotaUsageRefreshInterval is how frequently the size of the tenant objects is recomputed listing them.
+const quotaUsageRefreshInterval = 5 * time.Minute
+
+// quotaEnforcingBucket is an objstore.Bucket rejecting the uploads which would make the size of the tenant
+// objects exceed the tenant quota.
+type quotaEnforcingBucket struct {
+	objstore.Bucket
+
+	quotasByTenant map[string]int64
+	fallback       int64
+	usage          *tenantsUsageCache
+}
+
+// NewQuotaEnforcingBucket wraps the input bucket with a middleware checking, before each upload, the total
+// size of the objects within the tenant prefix against the tenant quota, in bytes. The tenant is the first
+// segment of the object name, so the input bucket must not be scoped to a tenant. The fallback quota is
+// used for the tenants not in quotasByTenant. A quota of 0 or less means no limit. Uploads which would
+// exceed the quota fail with a *QuotaExceededError. Objects not within a tenant prefix are not limited.
+//
+// The size of each tenant object is computed listing them, and cached for 5 minutes. The cached sizes are
+// updated after each upload and delete through this bucket, so the objects uploaded or deleted through
+// other clients are accounted only once they're refreshed, and the quota is not strictly enforced when
+// uploading concurrently for the same tenant.
+func NewQuotaEnforcingBucket(inner objstore.Bucket, quotasByTenant map[string]int64, fallback int64) objstore.Bucket {
+	return newQuotaEnforcingBucket(inner, quotasByTenant, fallback, quotaUsageRefreshInterval)
+}
+
+func newQuotaEnforcingBucket(inner objstore.Bucket, quotasByTenant map[string]int64, fallback int64, usageRefreshInterval time.Duration) *quotaEnforcingBucket {
+	return &quotaEnforcingBucket{
+		Bucket:         inner,
+		quotasByTenant: quotasByTenant,
+		fallback:       fallback,
+		usage:          newTenantsUsageCache(usageRefreshInterval),
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (b *quotaEnforcingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	tenant := tenantFromObjectName(name)
+	if tenant == "" {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	quota := b.quota(tenant)
+	if quota <= 0 {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	used, err := b.usage.get(tenant, func() (map[string]int64, error) { return b.tenantObjectSizes(ctx, tenant) })
+	if err != nil {
+		return errors.Wrapf(err, "compute storage usage of tenant %s", tenant)
+	}
+
+	// The size of the overwritten object, if any, is not counted.
+	overwritten, overwriting := b.usage.objectSize(tenant, name)
+	used -= overwritten
+
+	uploadSize, err := objstore.TryToGetSize(r)
+	if err == nil {
+		if used+uploadSize > quota {
+			return &QuotaExceededError{Tenant: tenant, Quota: quota, Used: used, UploadSize: uploadSize}
+		}
+		if err := b.Bucket.Upload(ctx, name, r); err != nil {
+			return err
+		}
+		b.usage.setObjectSize(tenant, name, uploadSize)
+		return nil
+	}
+
+	// The size of the upload is unknown, so the upload is aborted as soon as it reads past the quota.
+	lr := &quotaLimitedReader{r: r, remaining: quota - used}
+	if err := b.Bucket.Upload(ctx, name, lr); err != nil {
+		if !lr.exceeded {
+			return err
+		}
+
+		// Some backends, like the filesystem, leave the partially written object in place.
+		if !overwriting {
+			_ = b.Bucket.Delete(ctx, name)
+		}
+		return &QuotaExceededError{Tenant: tenant, Quota: quota, Used: used, UploadSize: lr.read}
+	}
+	b.usage.setObjectSize(tenant, name, lr.read)
+	return nil
+}
+
+// Delete implements objstore.Bucket.
+func (b *quotaEnforcingBucket) Delete(ctx context.Context, name string) error {
+	if err := b.Bucket.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	if tenant := tenantFromObjectName(name); tenant != "" {
+		b.usage.deleteObject(tenant, name)
+	}
+	return nil
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *quotaEnforcingBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *quotaEnforcingBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &quotaEnforcingBucket{
+			Bucket:         ib.WithExpectedErrs(fn),
+			quotasByTenant: b.quotasByTenant,
+			fallback:       b.fallback,
+			usage:          b.usage,
+		}
+	}
+
+	return b
+}
+
+func (b *quotaEnforcingBucket) quota(tenant string) int64 {
+	if quota, ok := b.quotasByTenant[tenant]; ok {
+		return quota
+	}
+	return b.fallback
+}
+
+// tenantObjectSizes returns the size of each tenant object, by object name.
+func (b *quotaEnforcingBucket) tenantObjectSizes(ctx context.Context, tenant string) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	err := iterWithAttributes(ctx, b.Bucket, tenant, func(name, _ string, attrs objstore.ObjectAttributes) error {
+		sizes[name] = attrs.Size
+		return nil
+	})
+	return sizes, err
+}
+
+// tenantsUsageCache caches the size of the objects of each tenant.
+type tenantsUsageCache struct {
+	refreshInterval time.Duration
+
+	mtx   sync.Mutex
+	usage map[string]*tenantUsage
+}
+
+type tenantUsage struct {
+	size        int64
+	objects     map[string]int64
+	refreshedAt time.Time
+}
+
+func newTenantsUsageCache(refreshInterval time.Duration) *tenantsUsageCache {
+	return &tenantsUsageCache{
+		refreshInterval: refreshInterval,
+		usage:           map[string]*tenantUsage{},
+	}
+}
+
+// get returns the cached size of the tenant objects, refreshing the size of each object with the input
+// function when they're not cached or they were refreshed more than the refresh interval ago.
+func (c *tenantsUsageCache) get(tenant string, refresh func() (map[string]int64, error)) (int64, error) {
+	c.mtx.Lock()
+	usage, ok := c.usage[tenant]
+	if ok && time.Since(usage.refreshedAt) < c.refreshInterval {
+		defer c.mtx.Unlock()
+		return usage.size, nil
+	}
+	c.mtx.Unlock()
+
+	objects, err := refresh()
+	if err != nil {
+		return 0, err
+	}
+
+	usage = &tenantUsage{objects: objects, refreshedAt: time.Now()}
+	for _, size := range objects {
+		usage.size += size
+	}
+
+	c.mtx.Lock()
+	c.usage[tenant] = usage
+	c.mtx.Unlock()
+
+	return usage.size, nil
+}
+
+// objectSize returns the cached size of the tenant object, and whether the object is cached.
+func (c *tenantsUsageCache) objectSize(tenant, name string) (int64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if usage, ok := c.usage[tenant]; ok {
+		size, ok := usage.objects[name]
+		return size, ok
+	}
+	return 0, false
+}
+
+// setObjectSize updates the cached size of the tenant object, if the tenant usage is cached.
+func (c *tenantsUsageCache) setObjectSize(tenant, name string, size int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if usage, ok := c.usage[tenant]; ok {
+		usage.size += size - usage.objects[name]
+		usage.objects[name] = size
+	}
+}
+
+// deleteObject removes the tenant object from the cached usage, if cached.
+func (c *tenantsUsageCache) deleteObject(tenant, name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if usage, ok := c.usage[tenant]; ok {
+		usage.size -= usage.objects[name]
+		delete(usage.objects, name)
+	}
+}
+
+// errQuotaLimitedReaderExceeded is returned by quotaLimitedReader once the quota is exceeded.
+var errQuotaLimitedReaderExceeded = errors.New("storage quota exceeded")
+
+// quotaLimitedReader is a reader failing once more than the remaining quota has been read.
+type quotaLimitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+	exceeded  bool
+}
+
+func (r *quotaLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.read > r.remaining {
+		r.exceeded = true
+		return 0, errQuotaLimitedReaderExceeded
+	}
+	return n, err
+}
+
+// tenantFromObjectName returns the first segment of the object name, or an empty string if the object is
+// not within a directory.
+func tenantFromObjectName(name string) string {
+	tenant, _, found := strings.Cut(strings.TrimPrefix(name, objstore.DirDelim), objstore.DirDelim)
+	if !found {
+		return ""
+	}
+	return tenant
+}
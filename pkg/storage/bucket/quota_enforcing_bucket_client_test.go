@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestQuotaEnforcingBucket_Upload(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reject uploads exceeding the tenant quota", func(t *testing.T) {
+		bkt := NewQuotaEnforcingBucket(objstore.NewInMemBucket(), map[string]int64{"user-1": 10}, 0)
+
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("12345")))
+		require.NoError(t, bkt.Upload(ctx, "user-1/dir/b", strings.NewReader("1234")))
+
+		err := bkt.Upload(ctx, "user-1/c", strings.NewReader("12"))
+		require.Error(t, err)
+
+		var quotaErr *QuotaExceededError
+		require.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, QuotaExceededError{Tenant: "user-1", Quota: 10, Used: 9, UploadSize: 2}, *quotaErr)
+
+		exists, err := bkt.Exists(ctx, "user-1/c")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		// An upload filling the quota exactly is allowed.
+		require.NoError(t, bkt.Upload(ctx, "user-1/c", strings.NewReader("1")))
+	})
+
+	t.Run("should not count the size of the overwritten object", func(t *testing.T) {
+		bkt := NewQuotaEnforcingBucket(objstore.NewInMemBucket(), map[string]int64{"user-1": 10}, 0)
+
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("12345678")))
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("123456789")))
+	})
+
+	t.Run("should use the fallback quota for the tenants without a quota", func(t *testing.T) {
+		bkt := NewQuotaEnforcingBucket(objstore.NewInMemBucket(), map[string]int64{"user-1": 0}, 5)
+
+		// A quota of 0 means no limit.
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("1234567890")))
+
+		require.NoError(t, bkt.Upload(ctx, "user-2/a", strings.NewReader("12345")))
+		var quotaErr *QuotaExceededError
+		require.ErrorAs(t, bkt.Upload(ctx, "user-2/b", strings.NewReader("1")), &quotaErr)
+		assert.Equal(t, "user-2", quotaErr.Tenant)
+		assert.Equal(t, int64(5), quotaErr.Quota)
+
+		// The quotas are tracked per tenant.
+		require.NoError(t, bkt.Upload(ctx, "user-3/a", strings.NewReader("12345")))
+	})
+
+	t.Run("should not limit the objects not within a tenant prefix", func(t *testing.T) {
+		bkt := NewQuotaEnforcingBucket(objstore.NewInMemBucket(), nil, 1)
+
+		require.NoError(t, bkt.Upload(ctx, "object", strings.NewReader("1234567890")))
+	})
+
+	t.Run("should upload the content of readers with unknown size", func(t *testing.T) {
+		inner := objstore.NewInMemBucket()
+		bkt := NewQuotaEnforcingBucket(inner, nil, 10)
+
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", io.MultiReader(strings.NewReader("123"), bytes.NewReader([]byte("456")))))
+		require.ErrorAs(t, bkt.Upload(ctx, "user-1/b", io.MultiReader(strings.NewReader("12345"))), new(*QuotaExceededError))
+
+		r, err := inner.Get(ctx, "user-1/a")
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "123456", string(content))
+
+		// The rejected upload should not leave a partial object.
+		exists, err := inner.Exists(ctx, "user-1/b")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("should cache the tenant usage until the refresh interval", func(t *testing.T) {
+		inner := objstore.NewInMemBucket()
+		bkt := newQuotaEnforcingBucket(inner, nil, 10, time.Hour)
+
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("12345")))
+
+		// The objects uploaded through other clients are not accounted until the usage is refreshed.
+		require.NoError(t, inner.Upload(ctx, "user-1/b", strings.NewReader("12345")))
+		require.NoError(t, bkt.Upload(ctx, "user-1/c", strings.NewReader("12345")))
+
+		bkt = newQuotaEnforcingBucket(inner, nil, 10, 0)
+		var quotaErr *QuotaExceededError
+		require.ErrorAs(t, bkt.Upload(ctx, "user-1/d", strings.NewReader("1")), &quotaErr)
+		assert.Equal(t, int64(15), quotaErr.Used)
+
+		// Deleted objects are accounted once the usage is refreshed.
+		require.NoError(t, inner.Delete(ctx, "user-1/b"))
+		require.NoError(t, inner.Delete(ctx, "user-1/c"))
+		require.NoError(t, bkt.Upload(ctx, "user-1/d", strings.NewReader("1")))
+	})
+	t.Run("should account the objects deleted through the bucket", func(t *testing.T) {
+		bkt := NewQuotaEnforcingBucket(objstore.NewInMemBucket(), nil, 10)
+
+		require.NoError(t, bkt.Upload(ctx, "user-1/a", strings.NewReader("12345")))
+		require.NoError(t, bkt.Upload(ctx, "user-1/b", strings.NewReader("12345")))
+		require.ErrorAs(t, bkt.Upload(ctx, "user-1/c", strings.NewReader("1")), new(*QuotaExceededError))
+
+		require.NoError(t, bkt.Delete(ctx, "user-1/a"))
+		require.NoError(t, bkt.Upload(ctx, "user-1/c", strings.NewReader("12345")))
+	})
+}
@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"flag"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	defaultRetryMinBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+)
+
+var (
+	errInvalidRetryMaxAttempts = errors.New("the bucket operations max attempts must not be negative")
+	errInvalidRetryBackoff     = errors.New("the bucket operations retry min backoff must be greater than 0 and not greater than the max backoff")
+)
+
+// RetryConfig holds the config of the retries of the failed bucket operations.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"operation_retry_max_attempts" category:"experimental"`
+	MinBackoff  time.Duration `yaml:"operation_retry_min_backoff" category:"experimental"`
+	MaxBackoff  time.Duration `yaml:"operation_retry_max_backoff" category:"experimental"`
+
+	// RetryableErrors returns whether the failed operation should be retried. If not set, all the errors
+	// are retried. Errors of objects not found and context cancellation are never retried.
+	RetryableErrors func(error) bool `yaml:"-"`
+}
+
+func (cfg *RetryConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.MaxAttempts, prefix+"operation-retry-max-attempts", 1, "Maximum number of attempts of each failed bucket operation, including the first one, with an exponential backoff between them. The whole operation is retried. When enabled, it replaces the retries of the single requests done by the backend clients, which are disabled, and the retries of the multipart upload parts: the swift client keeps a single retry, to re-authenticate when the auth token expires, and the retries built into the s3 client are disabled for all the s3 bucket clients of the process. 0 or 1 to disable.")
+	f.DurationVar(&cfg.MinBackoff, prefix+"operation-retry-min-backoff", defaultRetryMinBackoff, "Minimum backoff between the attempts of a failed bucket operation.")
+	f.DurationVar(&cfg.MaxBackoff, prefix+"operation-retry-max-backoff", defaultRetryMaxBackoff, "Maximum backoff between the attempts of a failed bucket operation.")
+}
+
+func (cfg *RetryConfig) Validate() error {
+	if cfg.MaxAttempts < 0 {
+		return errInvalidRetryMaxAttempts
+	}
+	if cfg.MaxAttempts <= 1 {
+		return nil
+	}
+	if cfg.MinBackoff <= 0 || cfg.MinBackoff > cfg.MaxBackoff {
+		return errInvalidRetryBackoff
+	}
+	return nil
+}
+
+// RetryingBucket is an objstore.Bucket retrying the failed operations with an exponential backoff.
+//
+// The backend clients keep retrying the single requests on their own: the s3 and gcs retries are built into
+// the vendored SDKs and can't be disabled, while the azure and swift ones are configurable. They're not replaced
+// by RetryingBucket because they retry each request with the knowledge of the backend errors and throttling
+// responses, while RetryingBucket retries the whole operation, including reading the object from the beginning.
+type RetryingBucket struct {
+	objstore.Bucket
+
+	cfg      RetryConfig
+	attempts *prometheus.CounterVec
+}
+
+// NewRetryingBucket wraps the input bucket with a client retrying the failed operations up to
+// cfg.MaxAttempts times. Uploads are retried only if the reader implements io.Seeker, because the
+// content must be read again from the beginning. Iter is retried only if it failed before
+// calling the input function, otherwise the same objects would be passed to it twice.
+func NewRetryingBucket(inner objstore.Bucket, cfg RetryConfig, reg prometheus.Registerer) *RetryingBucket {
+	return &RetryingBucket{
+		Bucket: inner,
+		cfg:    cfg,
+		attempts: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_bucket_retry_attempts_total",
+			Help: "Total number of attempts of the bucket operations, by operation and attempt number.",
+		}, []string{"operation", "attempt"}),
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (b *RetryingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		b.attempts.WithLabelValues(objstore.OpUpload, "1").Inc()
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	first := true
+	return b.retry(ctx, objstore.OpUpload, func() error {
+		if !first {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return errors.Wrapf(err, "rewind object %s", name)
+			}
+		}
+		first = false
+
+		return b.Bucket.Upload(ctx, name, r)
+	})
+}
+
+// Delete implements objstore.Bucket.
+func (b *RetryingBucket) Delete(ctx context.Context, name string) error {
+	return b.retry(ctx, objstore.OpDelete, func() error {
+		return b.Bucket.Delete(ctx, name)
+	})
+}
+
+// Iter implements objstore.Bucket.
+func (b *RetryingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	called := false
+	err := b.retry(ctx, objstore.OpIter, func() error {
+		err := b.Bucket.Iter(ctx, dir, func(name string) error {
+			called = true
+			return f(name)
+		}, options...)
+
+		// Once the function has been called, the error can't be retried.
+		if err != nil && called {
+			return nonRetryableError{err}
+		}
+		return err
+	})
+
+	if nonRetryable, ok := err.(nonRetryableError); ok {
+		return nonRetryable.err
+	}
+	return err
+}
+
+// Get implements objstore.Bucket.
+func (b *RetryingBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.retry(ctx, objstore.OpGet, func() error {
+		rc, err = b.Bucket.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+// GetRange implements objstore.Bucket.
+func (b *RetryingBucket) GetRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.retry(ctx, objstore.OpGetRange, func() error {
+		rc, err = b.Bucket.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+// Exists implements objstore.Bucket.
+func (b *RetryingBucket) Exists(ctx context.Context, name string) (ok bool, err error) {
+	err = b.retry(ctx, objstore.OpExists, func() error {
+		ok, err = b.Bucket.Exists(ctx, name)
+		return err
+	})
+	return ok, err
+}
+
+// Attributes implements objstore.Bucket.
+func (b *RetryingBucket) Attributes(ctx context.Context, name string) (attrs objstore.ObjectAttributes, err error) {
+	err = b.retry(ctx, objstore.OpAttributes, func() error {
+		attrs, err = b.Bucket.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *RetryingBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *RetryingBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &RetryingBucket{
+			Bucket:   ib.WithExpectedErrs(fn),
+			cfg:      b.cfg,
+			attempts: b.attempts,
+		}
+	}
+
+	return b
+}
+
+// retry runs the input operation until it succeeds, it fails with a non retryable error, the max
+// attempts are reached or the context is canceled. The error of the last attempt is returned.
+func (b *RetryingBucket) retry(ctx context.Context, op string, fn func() error) error {
+	boff := backoff.New(ctx, backoff.Config{
+		MinBackoff: b.cfg.MinBackoff,
+		MaxBackoff: b.cfg.MaxBackoff,
+	})
+
+	for attempt := 1; ; attempt++ {
+		b.attempts.WithLabelValues(op, strconv.Itoa(attempt)).Inc()
+
+		err := fn()
+		if err == nil || attempt >= b.cfg.MaxAttempts || !b.isRetryable(ctx, err) {
+			return err
+		}
+
+		boff.Wait()
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func (b *RetryingBucket) isRetryable(ctx context.Context, err error) bool {
+	if _, ok := err.(nonRetryableError); ok {
+		return false
+	}
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || b.Bucket.IsObjNotFoundErr(err) {
+		return false
+	}
+	if b.cfg.RetryableErrors != nil {
+		return b.cfg.RetryableErrors(err)
+	}
+	return true
+}
+
+// nonRetryableError wraps an error which must not be retried, regardless of the config.
+type nonRetryableError struct {
+	err error
+}
+
+func (e nonRetryableError) Error() string {
+	return e.err.Error()
+}
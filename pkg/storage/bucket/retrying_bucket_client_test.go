@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestRetryConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cfg      RetryConfig
+		expected error
+	}{
+		"disabled": {
+			cfg: RetryConfig{MaxAttempts: 1},
+		},
+		"valid config": {
+			cfg: RetryConfig{MaxAttempts: 3, MinBackoff: time.Second, MaxBackoff: time.Second},
+		},
+		"negative max attempts": {
+			cfg:      RetryConfig{MaxAttempts: -1},
+			expected: errInvalidRetryMaxAttempts,
+		},
+		"min backoff greater than max backoff": {
+			cfg:      RetryConfig{MaxAttempts: 3, MinBackoff: 2 * time.Second, MaxBackoff: time.Second},
+			expected: errInvalidRetryBackoff,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, testData.cfg.Validate())
+		})
+	}
+}
+
+func TestRetryingBucket(t *testing.T) {
+	errTransient := errors.New("transient error")
+	errPermanent := errors.New("permanent error")
+
+	tests := map[string]struct {
+		failures         []error
+		expectedErr      error
+		expectedAttempts int
+	}{
+		"succeeded at the first attempt": {
+			expectedAttempts: 1,
+		},
+		"succeeded after transient failures": {
+			failures:         []error{errTransient, errTransient},
+			expectedAttempts: 3,
+		},
+		"failed after max attempts": {
+			failures:         []error{errTransient, errTransient, errTransient, errTransient},
+			expectedErr:      errTransient,
+			expectedAttempts: 3,
+		},
+		"non retryable error": {
+			failures:         []error{errPermanent},
+			expectedErr:      errPermanent,
+			expectedAttempts: 1,
+		},
+	}
+
+	ops := map[string]func(b objstore.Bucket) error{
+		objstore.OpUpload: func(b objstore.Bucket) error {
+			return b.Upload(context.Background(), "test", strings.NewReader("content"))
+		},
+		objstore.OpDelete: func(b objstore.Bucket) error {
+			return b.Delete(context.Background(), "test")
+		},
+		objstore.OpIter: func(b objstore.Bucket) error {
+			return b.Iter(context.Background(), "", func(string) error { return nil })
+		},
+		objstore.OpGet: func(b objstore.Bucket) error {
+			_, err := b.Get(context.Background(), "test")
+			return err
+		},
+		objstore.OpGetRange: func(b objstore.Bucket) error {
+			_, err := b.GetRange(context.Background(), "test", 0, 1)
+			return err
+		},
+		objstore.OpExists: func(b objstore.Bucket) error {
+			_, err := b.Exists(context.Background(), "test")
+			return err
+		},
+		objstore.OpAttributes: func(b objstore.Bucket) error {
+			_, err := b.Attributes(context.Background(), "test")
+			return err
+		},
+	}
+
+	for testName, testData := range tests {
+		for op, run := range ops {
+			t.Run(testName+"/"+op, func(t *testing.T) {
+				inner := objstore.NewInMemBucket()
+				require.NoError(t, inner.Upload(context.Background(), "test", strings.NewReader("content")))
+
+				faulty := &faultInjectingBucket{Bucket: inner, op: op, failures: testData.failures}
+				reg := prometheus.NewPedanticRegistry()
+				b := NewRetryingBucket(faulty, RetryConfig{
+					MaxAttempts:     3,
+					MinBackoff:      time.Millisecond,
+					MaxBackoff:      time.Millisecond,
+					RetryableErrors: func(err error) bool { return errors.Is(err, errTransient) },
+				}, reg)
+
+				err := run(b)
+				if testData.expectedErr != nil {
+					require.ErrorIs(t, err, testData.expectedErr)
+				} else {
+					require.NoError(t, err)
+				}
+
+				assert.Equal(t, testData.expectedAttempts, faulty.attempts)
+				for attempt := 1; attempt <= 3; attempt++ {
+					expected := 0.0
+					if attempt <= testData.expectedAttempts {
+						expected = 1
+					}
+					assert.Equal(t, expected, testutil.ToFloat64(b.attempts.WithLabelValues(op, strconv.Itoa(attempt))))
+				}
+			})
+		}
+	}
+}
+
+func TestRetryingBucket_ShouldNotRetryObjectNotFound(t *testing.T) {
+	inner := objstore.NewInMemBucket()
+	faulty := &faultInjectingBucket{Bucket: inner, op: objstore.OpGet}
+	b := NewRetryingBucket(faulty, RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, nil)
+
+	_, err := b.Get(context.Background(), "missing")
+	require.True(t, b.IsObjNotFoundErr(err))
+	assert.Equal(t, 1, faulty.attempts)
+}
+
+func TestRetryingBucket_ShouldRetryUploadRewindingTheReader(t *testing.T) {
+	inner := objstore.NewInMemBucket()
+	faulty := &faultInjectingBucket{Bucket: inner, op: objstore.OpUpload, failures: []error{errors.New("failed")}, readBeforeFailing: true}
+	b := NewRetryingBucket(faulty, RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, nil)
+
+	require.NoError(t, b.Upload(context.Background(), "test", bytes.NewReader([]byte("content"))))
+	assert.Equal(t, 2, faulty.attempts)
+
+	rc, err := inner.Get(context.Background(), "test")
+	require.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
+
+func TestRetryingBucket_ShouldNotRetryUploadOfNonSeekableReader(t *testing.T) {
+	errFailed := errors.New("failed")
+	faulty := &faultInjectingBucket{Bucket: objstore.NewInMemBucket(), op: objstore.OpUpload, failures: []error{errFailed}}
+	b := NewRetryingBucket(faulty, RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, nil)
+
+	err := b.Upload(context.Background(), "test", io.LimitReader(strings.NewReader("content"), 7))
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 1, faulty.attempts)
+}
+
+func TestRetryingBucket_ShouldNotRetryIterAfterCallingTheFunction(t *testing.T) {
+	errFailed := errors.New("failed")
+	inner := objstore.NewInMemBucket()
+	require.NoError(t, inner.Upload(context.Background(), "test", strings.NewReader("content")))
+	faulty := &faultInjectingBucket{Bucket: inner, op: objstore.OpIter, failures: []error{errFailed, errFailed}, iterBeforeFailing: true}
+	b := NewRetryingBucket(faulty, RetryConfig{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, nil)
+
+	var names []string
+	err := b.Iter(context.Background(), "", func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 1, faulty.attempts)
+	assert.Equal(t, []string{"test"}, names)
+}
+
+func TestRetryingBucket_ShouldStopRetryingWhenContextIsCanceled(t *testing.T) {
+	errFailed := errors.New("failed")
+	faulty := &faultInjectingBucket{Bucket: objstore.NewInMemBucket(), op: objstore.OpExists, failures: []error{errFailed, errFailed, errFailed}}
+	b := NewRetryingBucket(faulty, RetryConfig{MaxAttempts: 3, MinBackoff: time.Hour, MaxBackoff: time.Hour}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := b.Exists(ctx, "test")
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 1, faulty.attempts)
+}
+
+// faultInjectingBucket is an objstore.Bucket failing the first attempts of an operation with the configured errors.
+type faultInjectingBucket struct {
+	objstore.Bucket
+
+	op       string
+	failures []error
+	attempts int
+
+	// readBeforeFailing reads the uploaded content before failing an upload.
+	readBeforeFailing bool
+
+	// iterBeforeFailing iterates the objects before failing an iteration.
+	iterBeforeFailing bool
+}
+
+func (b *faultInjectingBucket) fail(op string) error {
+	if op != b.op {
+		return nil
+	}
+
+	b.attempts++
+	if b.attempts > len(b.failures) {
+		return nil
+	}
+	return b.failures[b.attempts-1]
+}
+
+func (b *faultInjectingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.fail(objstore.OpUpload); err != nil {
+		if b.readBeforeFailing {
+			_, _ = io.ReadAll(r)
+		}
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func (b *faultInjectingBucket) Delete(ctx context.Context, name string) error {
+	if err := b.fail(objstore.OpDelete); err != nil {
+		return err
+	}
+	return b.Bucket.Delete(ctx, name)
+}
+
+func (b *faultInjectingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	if err := b.fail(objstore.OpIter); err != nil {
+		if b.iterBeforeFailing {
+			if iterErr := b.Bucket.Iter(ctx, dir, f, options...); iterErr != nil {
+				return iterErr
+			}
+		}
+		return err
+	}
+	return b.Bucket.Iter(ctx, dir, f, options...)
+}
+
+func (b *faultInjectingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail(objstore.OpGet); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *faultInjectingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.fail(objstore.OpGetRange); err != nil {
+		return nil, err
+	}
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
+func (b *faultInjectingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.fail(objstore.OpExists); err != nil {
+		return false, err
+	}
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *faultInjectingBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	if err := b.fail(objstore.OpAttributes); err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return b.Bucket.Attributes(ctx, name)
+}
@@ -6,30 +6,109 @@
 package s3
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
 	"github.com/go-kit/log"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/exthttp"
 	"github.com/thanos-io/objstore/providers/s3"
 )
 
+type ctxKey int
+
+// sseConfigKey is the context key to override the SSE config of the objects copied with CopyObject(),
+// uploaded with the multipart upload or encrypted with SSE-C.
+const sseConfigKey = ctxKey(0)
+
+// maxCopyObjectSize is the max size of an object copied with a single S3 copy request.
+const maxCopyObjectSize = 5 << 30
+
+// ContextWithSSEConfig returns a context with a custom SSE config, which overrides the default one
+// when copying an object with CopyObject(), uploading an object in parts, or when the default one is SSE-C.
+func ContextWithSSEConfig(ctx context.Context, value encrypt.ServerSide) context.Context {
+	return context.WithValue(ctx, sseConfigKey, value)
+}
+
+// BucketClient is the S3 bucket client. It wraps the Thanos S3 bucket client, and additionally
+// keeps a minio client to support S3 native operations not exposed by the objstore.Bucket interface.
+type BucketClient struct {
+	*s3.Bucket
+
+	client     *minio.Client
+	bucketName string
+
+	// sse is the server-side encryption applied to the objects copied with CopyObject() and uploaded
+	// with the multipart upload (optional). SSE-C is applied to all operations by this client, because
+	// it's not supported by the Thanos client config.
+	sse encrypt.ServerSide
+}
+
 // NewBucketClient creates a new S3 bucket client
-func NewBucketClient(cfg Config, name string, logger log.Logger) (objstore.Bucket, error) {
+func NewBucketClient(cfg Config, name string, logger log.Logger) (*BucketClient, error) {
 	s3Cfg, err := newS3Config(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return s3.NewBucketWithConfig(logger, s3Cfg, name)
-}
+	// Share the same HTTP transport between the Thanos and the minio clients.
+	if s3Cfg.HTTPConfig.Transport == nil {
+		s3Cfg.HTTPConfig.Transport, err = exthttp.DefaultTransport(s3Cfg.HTTPConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-// NewBucketReaderClient creates a new S3 bucket client
-func NewBucketReaderClient(cfg Config, name string, logger log.Logger) (objstore.BucketReader, error) {
-	s3Cfg, err := newS3Config(cfg)
+	bkt, err := s3.NewBucketWithConfig(logger, s3Cfg, name)
 	if err != nil {
 		return nil, err
 	}
 
-	return s3.NewBucketWithConfig(logger, s3Cfg, name)
+	client, err := minio.New(s3Cfg.Endpoint, &minio.Options{
+		Creds:     newCredentials(s3Cfg),
+		Secure:    !s3Cfg.Insecure,
+		Region:    s3Cfg.Region,
+		Transport: s3Cfg.HTTPConfig.Transport,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "initialize s3 client")
+	}
+
+	sse, err := cfg.SSE.BuildMinioConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &BucketClient{
+		Bucket:     bkt,
+		client:     client,
+		bucketName: s3Cfg.Bucket,
+		sse:        sse,
+	}, nil
+}
+
+var disableClientRetriesOnce sync.Once
+
+// DisableClientRetries disables the retries of the failed requests built into the S3 client. The minio
+// client doesn't support configuring the retries of each client, so they're disabled for all the S3
+// bucket clients of the process.
+func DisableClientRetries() {
+	disableClientRetriesOnce.Do(func() {
+		minio.MaxRetry = 1
+	})
+}
+
+// NewBucketReaderClient creates a new S3 bucket client
+func NewBucketReaderClient(cfg Config, name string, logger log.Logger) (objstore.BucketReader, error) {
+	return NewBucketClient(cfg, name, logger)
 }
 
 func newS3Config(cfg Config) (s3.Config, error) {
@@ -61,3 +140,226 @@ func newS3Config(cfg Config) (s3.Config, error) {
 		SignatureV2: cfg.SignatureVersion == SignatureVersionV2,
 	}, nil
 }
+
+// newCredentials returns the same credentials chain built by the Thanos S3 bucket client.
+func newCredentials(cfg s3.Config) *credentials.Credentials {
+	wrap := func(p credentials.Provider) credentials.Provider { return p }
+	if cfg.SignatureV2 {
+		wrap = func(p credentials.Provider) credentials.Provider {
+			return &signatureV2Provider{Provider: p}
+		}
+	}
+
+	if cfg.AccessKey != "" {
+		return credentials.NewChainCredentials([]credentials.Provider{wrap(&credentials.Static{
+			Value: credentials.Value{
+				AccessKeyID:     cfg.AccessKey,
+				SecretAccessKey: cfg.SecretKey,
+				SignerType:      credentials.SignatureV4,
+			},
+		})})
+	}
+
+	return credentials.NewChainCredentials([]credentials.Provider{
+		wrap(&credentials.EnvAWS{}),
+		wrap(&credentials.FileAWSCredentials{}),
+		wrap(&credentials.IAM{
+			Client:   &http.Client{Transport: http.DefaultTransport},
+			Endpoint: cfg.STSEndpoint,
+		}),
+	})
+}
+
+// signatureV2Provider overrides the signer type of non anonymous credentials to V2.
+type signatureV2Provider struct {
+	credentials.Provider
+}
+
+func (p *signatureV2Provider) Retrieve() (credentials.Value, error) {
+	v, err := p.Provider.Retrieve()
+	if err != nil {
+		return v, err
+	}
+	if !v.SignerType.IsAnonymous() {
+		v.SignerType = credentials.SignatureV2
+	}
+	return v, nil
+}
+
+// Upload implements objstore.Bucket.
+func (b *BucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	return b.Bucket.Upload(b.contextWithSSEC(ctx), name, r)
+}
+
+// Get implements objstore.Bucket.
+func (b *BucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.Bucket.Get(b.contextWithSSEC(ctx), name)
+}
+
+// GetRange implements objstore.Bucket.
+func (b *BucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.Bucket.GetRange(b.contextWithSSEC(ctx), name, off, length)
+}
+
+// Exists implements objstore.Bucket.
+func (b *BucketClient) Exists(ctx context.Context, name string) (bool, error) {
+	sse := b.serverSideEncryption(ctx)
+	if !isSSEC(sse) {
+		return b.Bucket.Exists(ctx, name)
+	}
+
+	// The object metadata of SSE-C encrypted objects can't be read without the customer key.
+	if _, err := b.statObject(ctx, name, sse); err != nil {
+		if b.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "stat s3 object")
+	}
+	return true, nil
+}
+
+// Attributes implements objstore.Bucket.
+func (b *BucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	sse := b.serverSideEncryption(ctx)
+	if !isSSEC(sse) {
+		return b.Bucket.Attributes(ctx, name)
+	}
+
+	info, err := b.statObject(ctx, name, sse)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{
+		Size:         info.Size,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (b *BucketClient) statObject(ctx context.Context, name string, sse encrypt.ServerSide) (minio.ObjectInfo, error) {
+	return b.client.StatObject(ctx, b.bucketName, name, minio.StatObjectOptions{ServerSideEncryption: sse})
+}
+
+// serverSideEncryption returns the SSE config overridden in the context, or the default one.
+func (b *BucketClient) serverSideEncryption(ctx context.Context) encrypt.ServerSide {
+	if value, ok := ctx.Value(sseConfigKey).(encrypt.ServerSide); ok {
+		return value
+	}
+	return b.sse
+}
+
+// contextWithSSEC returns a context passing the SSE-C config, if any, to the Thanos client.
+func (b *BucketClient) contextWithSSEC(ctx context.Context) context.Context {
+	if sse := b.serverSideEncryption(ctx); isSSEC(sse) {
+		return s3.ContextWithSSEConfig(ctx, sse)
+	}
+	return ctx
+}
+
+// CreateMultipartUpload implements bucket.MultipartUploader.
+func (b *BucketClient) CreateMultipartUpload(ctx context.Context, name string) (string, error) {
+	core := minio.Core{Client: b.client}
+	return core.NewMultipartUpload(ctx, b.bucketName, name, minio.PutObjectOptions{ServerSideEncryption: b.serverSideEncryption(ctx)})
+}
+
+// UploadPart implements bucket.MultipartUploader. The returned part ID is the ETag of the uploaded part.
+func (b *BucketClient) UploadPart(ctx context.Context, name, uploadID string, partNumber int, r io.Reader, size int64) (string, error) {
+	// The SSE config is only sent with each part when using SSE-C.
+	var sse encrypt.ServerSide
+	if s := b.serverSideEncryption(ctx); isSSEC(s) {
+		sse = s
+	}
+
+	core := minio.Core{Client: b.client}
+	part, err := core.PutObjectPart(ctx, b.bucketName, name, uploadID, partNumber, r, size, "", "", sse)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+// CompleteMultipartUpload implements bucket.MultipartUploader.
+func (b *BucketClient) CompleteMultipartUpload(ctx context.Context, name, uploadID string, partIDs []string) error {
+	parts := make([]minio.CompletePart, 0, len(partIDs))
+	for idx, etag := range partIDs {
+		parts = append(parts, minio.CompletePart{PartNumber: idx + 1, ETag: etag})
+	}
+
+	core := minio.Core{Client: b.client}
+	_, err := core.CompleteMultipartUpload(ctx, b.bucketName, name, uploadID, parts, minio.PutObjectOptions{})
+	return err
+}
+
+// AbortMultipartUpload implements bucket.MultipartUploader, deleting the parts uploaded so far.
+func (b *BucketClient) AbortMultipartUpload(ctx context.Context, name, uploadID string) error {
+	core := minio.Core{Client: b.client}
+	return core.AbortMultipartUpload(ctx, b.bucketName, name, uploadID)
+}
+
+func isSSEC(sse encrypt.ServerSide) bool {
+	return sse != nil && sse.Type() == encrypt.SSEC
+}
+
+// IterWithAttributes calls f for each object whose name starts with prefix (recursively), passing
+// the object name, ETag and attributes as returned by the S3 list objects API.
+func (b *BucketClient) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	// Cancel the listing on early return, otherwise the minio goroutine sending the objects would be blocked forever.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range b.client.ListObjects(ctx, b.bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return object.Err
+		}
+
+		// Skip the "directory" placeholder objects.
+		if strings.HasSuffix(object.Key, objstore.DirDelim) {
+			continue
+		}
+
+		err := f(object.Key, strings.Trim(object.ETag, `"`), objstore.ObjectAttributes{
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// CopyObject copies the src object to dst using the S3 server-side copy, without downloading it.
+// Objects larger than the max size supported by a single copy request are copied in parts.
+func (b *BucketClient) CopyObject(ctx context.Context, src, dst string) error {
+	sse := b.serverSideEncryption(ctx)
+
+	srcOpts := minio.CopySrcOptions{
+		Bucket: b.bucketName,
+		Object: src,
+	}
+	// The source object must be decrypted with the customer key too.
+	if isSSEC(sse) {
+		srcOpts.Encryption = sse
+	}
+
+	dstOpts := minio.CopyDestOptions{
+		Bucket:     b.bucketName,
+		Object:     dst,
+		Encryption: sse,
+	}
+
+	info, err := b.client.StatObject(ctx, b.bucketName, src, minio.StatObjectOptions{ServerSideEncryption: srcOpts.Encryption})
+	if err != nil {
+		return err
+	}
+
+	if info.Size > maxCopyObjectSize {
+		_, err = b.client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = b.client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	return err
+}
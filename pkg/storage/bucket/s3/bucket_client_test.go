@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketClient_ServerSideEncryptionHeaders(t *testing.T) {
+	customerKey := bytes.Repeat([]byte{'k'}, sseCustomerKeySize)
+	t.Setenv("TEST_SSE_C_KEY", base64.StdEncoding.EncodeToString(customerKey))
+
+	tests := map[string]struct {
+		cfg SSEConfig
+
+		// expectedUploadHeaders are the headers expected in every request creating an object.
+		expectedUploadHeaders map[string]string
+
+		// expectedReadHeaders are the headers expected in every request reading an object or uploading
+		// a part of a multipart upload, which only carry the SSE-C headers.
+		expectedReadHeaders map[string]string
+	}{
+		"no SSE": {
+			cfg: SSEConfig{},
+			expectedUploadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption":                    "",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       "",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id":     "",
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "",
+			},
+			expectedReadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Key": "",
+			},
+		},
+		"SSE-S3": {
+			cfg: SSEConfig{Type: SSES3},
+			expectedUploadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption": "AES256",
+			},
+			expectedReadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Key": "",
+			},
+		},
+		"SSE-KMS": {
+			cfg: SSEConfig{Type: SSEKMS, KMSKeyID: "test-key"},
+			expectedUploadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "test-key",
+			},
+			expectedReadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Key": "",
+			},
+		},
+		"SSE-C": {
+			cfg: SSEConfig{Type: SSEC, CustomerKeyEnvVar: "TEST_SSE_C_KEY"},
+			expectedUploadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(customerKey),
+			},
+			expectedReadHeaders: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(customerKey),
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			srv := newSSEMockServer()
+			defer srv.Close()
+
+			client, err := NewBucketClient(Config{
+				Endpoint:         srv.Listener.Addr().String(),
+				Region:           "test",
+				BucketName:       "test-bucket",
+				SecretAccessKey:  flagext.SecretWithValue("test"),
+				AccessKeyID:      "test",
+				Insecure:         true,
+				SignatureVersion: SignatureVersionV4,
+				SSE:              testData.cfg,
+			}, "test", log.NewNopLogger())
+			require.NoError(t, err)
+
+			ctx := context.Background()
+
+			// Upload an object with a single request and one with the multipart upload.
+			require.NoError(t, client.Upload(ctx, "object", bytes.NewReader([]byte("content"))))
+
+			uploadID, err := client.CreateMultipartUpload(ctx, "multipart-object")
+			require.NoError(t, err)
+			partID, err := client.UploadPart(ctx, "multipart-object", uploadID, 1, bytes.NewReader([]byte("part")), int64(len("part")))
+			require.NoError(t, err)
+			require.NoError(t, client.CompleteMultipartUpload(ctx, "multipart-object", uploadID, []string{partID}))
+
+			// Read the object.
+			rc, err := client.Get(ctx, "object")
+			require.NoError(t, err)
+			_, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+
+			rc, err = client.GetRange(ctx, "object", 1, 2)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+
+			exists, err := client.Exists(ctx, "object")
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			attrs, err := client.Attributes(ctx, "object")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len("content")), attrs.Size)
+
+			uploads, parts, reads := srv.requests()
+			require.Len(t, uploads, 2)
+			require.Len(t, parts, 1)
+			require.Len(t, reads, 4)
+
+			for _, req := range uploads {
+				for name, expected := range testData.expectedUploadHeaders {
+					assert.Equal(t, expected, req.Header.Get(name), "request: %s %s, header: %s", req.Method, req.URL, name)
+				}
+			}
+			for _, req := range append(parts, reads...) {
+				for name, expected := range testData.expectedReadHeaders {
+					assert.Equal(t, expected, req.Header.Get(name), "request: %s %s, header: %s", req.Method, req.URL, name)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketClient_CopyObjectShouldHonorTheSSEConfigFromContext(t *testing.T) {
+	srv := newSSEMockServer()
+	defer srv.Close()
+
+	client, err := NewBucketClient(Config{
+		Endpoint:         srv.Listener.Addr().String(),
+		Region:           "test",
+		BucketName:       "test-bucket",
+		SecretAccessKey:  flagext.SecretWithValue("test"),
+		AccessKeyID:      "test",
+		Insecure:         true,
+		SignatureVersion: SignatureVersionV4,
+		SSE:              SSEConfig{Type: SSES3},
+	}, "test", log.NewNopLogger())
+	require.NoError(t, err)
+
+	sse, err := (&SSEConfig{Type: SSEKMS, KMSKeyID: "tenant-key"}).BuildMinioConfig()
+	require.NoError(t, err)
+	require.NoError(t, client.CopyObject(ContextWithSSEConfig(context.Background(), sse), "src", "dst"))
+
+	uploads, _, _ := srv.requests()
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "aws:kms", uploads[0].Header.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "tenant-key", uploads[0].Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+}
+
+func TestBucketClient_CopyObjectShouldCopyLargeObjectsInParts(t *testing.T) {
+	srv := newSSEMockServer()
+	srv.objectSize = maxCopyObjectSize + 1
+	defer srv.Close()
+
+	client, err := NewBucketClient(Config{
+		Endpoint:         srv.Listener.Addr().String(),
+		Region:           "test",
+		BucketName:       "test-bucket",
+		SecretAccessKey:  flagext.SecretWithValue("test"),
+		AccessKeyID:      "test",
+		Insecure:         true,
+		SignatureVersion: SignatureVersionV4,
+		SSE:              SSEConfig{Type: SSES3},
+	}, "test", log.NewNopLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, client.CopyObject(context.Background(), "src", "dst"))
+
+	// The multipart upload is initiated with the SSE config, and then each part is copied by range.
+	uploads, _, _ := srv.requests()
+	require.Greater(t, len(uploads), 2)
+	assert.Equal(t, http.MethodPost, uploads[0].Method)
+	assert.Equal(t, "AES256", uploads[0].Header.Get("X-Amz-Server-Side-Encryption"))
+	for _, part := range uploads[1:] {
+		assert.NotEmpty(t, part.URL.Query().Get("partNumber"))
+		assert.NotEmpty(t, part.Header.Get("X-Amz-Copy-Source-Range"))
+	}
+}
+
+// sseMockServer is a fake S3 server storing a single object, recording the received requests.
+type sseMockServer struct {
+	*httptest.Server
+
+	// objectSize overrides the size of the stored object returned by HEAD requests (optional).
+	objectSize int64
+
+	mtx     sync.Mutex
+	uploads []*http.Request
+	parts   []*http.Request
+	reads   []*http.Request
+}
+
+func newSSEMockServer() *sseMockServer {
+	s := &sseMockServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *sseMockServer) handle(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.uploads = append(s.uploads, r)
+		_, _ = w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>test-bucket</Bucket><Key>multipart-object</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.uploads = append(s.uploads, r)
+		_, _ = w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag><LastModified>2022-01-01T00:00:00.000Z</LastModified></CopyObjectResult>`))
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		s.parts = append(s.parts, r)
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		_, _ = w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>test-bucket</Bucket><Key>multipart-object</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodPut:
+		s.uploads = append(s.uploads, r)
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.reads = append(s.reads, r)
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.Method == http.MethodHead && s.objectSize > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(s.objectSize, 10))
+			break
+		}
+		w.Header().Set("Content-Length", "7")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte("content"))
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *sseMockServer) requests() (uploads, parts, reads []*http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.uploads, s.parts, s.reads
+}
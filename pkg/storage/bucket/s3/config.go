@@ -6,10 +6,12 @@
 package s3
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -32,14 +34,24 @@ const (
 	// SSES3 config type constant to configure S3 server side encryption with AES-256
 	// https://docs.aws.amazon.com/AmazonS3/latest/dev/UsingServerSideEncryption.html
 	SSES3 = "SSE-S3"
+
+	// SSEC config type constant to configure S3 server side encryption with a customer-provided key
+	// https://docs.aws.amazon.com/AmazonS3/latest/userguide/ServerSideEncryptionCustomerKeys.html
+	SSEC = "SSE-C"
+
+	// sseCustomerKeySize is the size of the AES-256 key used by SSE-C.
+	sseCustomerKeySize = 32
 )
 
 var (
 	supportedSignatureVersions     = []string{SignatureVersionV4, SignatureVersionV2}
-	supportedSSETypes              = []string{SSEKMS, SSES3}
+	supportedSSETypes              = []string{SSEKMS, SSES3, SSEC}
 	errUnsupportedSignatureVersion = errors.New("unsupported signature version")
 	errUnsupportedSSEType          = errors.New("unsupported S3 SSE type")
 	errInvalidSSEContext           = errors.New("invalid S3 SSE encryption context")
+	errMissingSSECustomerKey       = errors.New("S3 SSE-C requires either the customer key file or the customer key environment variable to be set")
+	errAmbiguousSSECustomerKey     = errors.New("S3 SSE-C customer key file and customer key environment variable are mutually exclusive")
+	errInvalidSSECustomerKey       = errors.New("the S3 SSE-C customer key must be 32 bytes long, either raw or base64 encoded")
 )
 
 // HTTPConfig stores the http.Transport configuration for the s3 minio client.
@@ -120,6 +132,11 @@ type SSEConfig struct {
 	Type                 string `yaml:"type"`
 	KMSKeyID             string `yaml:"kms_key_id"`
 	KMSEncryptionContext string `yaml:"kms_encryption_context"`
+
+	// The SSE-C customer key is read from a file or an environment variable, and never stored
+	// in the config, so that it's not exposed by the config dumps.
+	CustomerKeyFile   string `yaml:"customer_key_file"`
+	CustomerKeyEnvVar string `yaml:"customer_key_env_var"`
 }
 
 func (cfg *SSEConfig) RegisterFlags(f *flag.FlagSet) {
@@ -131,6 +148,8 @@ func (cfg *SSEConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	f.StringVar(&cfg.Type, prefix+"type", "", fmt.Sprintf("Enable AWS Server Side Encryption. Supported values: %s.", strings.Join(supportedSSETypes, ", ")))
 	f.StringVar(&cfg.KMSKeyID, prefix+"kms-key-id", "", "KMS Key ID used to encrypt objects in S3")
 	f.StringVar(&cfg.KMSEncryptionContext, prefix+"kms-encryption-context", "", "KMS Encryption Context used for object encryption. It expects JSON formatted string.")
+	f.StringVar(&cfg.CustomerKeyFile, prefix+"customer-key-file", "", "Path to the file containing the customer-provided key used to encrypt objects in S3 with SSE-C. The key must be 32 bytes long, either raw or base64 encoded.")
+	f.StringVar(&cfg.CustomerKeyEnvVar, prefix+"customer-key-env-var", "", "Name of the environment variable containing the base64 encoded customer-provided key used to encrypt objects in S3 with SSE-C.")
 }
 
 func (cfg *SSEConfig) Validate() error {
@@ -142,6 +161,12 @@ func (cfg *SSEConfig) Validate() error {
 		return errInvalidSSEContext
 	}
 
+	if cfg.Type == SSEC {
+		if _, err := cfg.customerKey(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -165,6 +190,10 @@ func (cfg *SSEConfig) BuildThanosConfig() (s3.SSEConfig, error) {
 		return s3.SSEConfig{
 			Type: s3.SSES3,
 		}, nil
+	case SSEC:
+		// The Thanos client only supports reading the customer key from a file, so SSE-C
+		// is applied by the Mimir client (see BucketClient).
+		return s3.SSEConfig{}, nil
 	default:
 		return s3.SSEConfig{}, errUnsupportedSSEType
 	}
@@ -188,11 +217,46 @@ func (cfg *SSEConfig) BuildMinioConfig() (encrypt.ServerSide, error) {
 		return encrypt.NewSSEKMS(cfg.KMSKeyID, encryptionCtx)
 	case SSES3:
 		return encrypt.NewSSE(), nil
+	case SSEC:
+		key, err := cfg.customerKey()
+		if err != nil {
+			return nil, err
+		}
+		return encrypt.NewSSEC(key)
 	default:
 		return nil, errUnsupportedSSEType
 	}
 }
 
+// customerKey reads the SSE-C customer key from the configured file or environment variable.
+func (cfg *SSEConfig) customerKey() ([]byte, error) {
+	var data []byte
+
+	switch {
+	case cfg.CustomerKeyFile != "" && cfg.CustomerKeyEnvVar != "":
+		return nil, errAmbiguousSSECustomerKey
+	case cfg.CustomerKeyFile != "":
+		var err error
+		if data, err = os.ReadFile(cfg.CustomerKeyFile); err != nil {
+			return nil, errors.Wrap(err, "unable to read S3 SSE-C customer key file")
+		}
+	case cfg.CustomerKeyEnvVar != "":
+		data = []byte(os.Getenv(cfg.CustomerKeyEnvVar))
+	default:
+		return nil, errMissingSSECustomerKey
+	}
+
+	if len(data) == sseCustomerKeySize {
+		return data, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != sseCustomerKeySize {
+		return nil, errInvalidSSECustomerKey
+	}
+	return key, nil
+}
+
 func parseKMSEncryptionContext(data string) (map[string]string, error) {
 	if data == "" {
 		return nil, nil
@@ -6,8 +6,11 @@
 package s3
 
 import (
+	"bytes"
 	"encoding/base64"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/grafana/dskit/flagext"
@@ -105,6 +108,75 @@ func TestSSEConfig_BuildMinioConfig(t *testing.T) {
 	}
 }
 
+func TestSSEConfig_SSEC(t *testing.T) {
+	key := bytes.Repeat([]byte{'k'}, sseCustomerKeySize)
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+
+	rawKeyFile := filepath.Join(t.TempDir(), "raw-key")
+	require.NoError(t, os.WriteFile(rawKeyFile, key, 0600))
+	encodedKeyFile := filepath.Join(t.TempDir(), "encoded-key")
+	require.NoError(t, os.WriteFile(encodedKeyFile, []byte(encodedKey+"\n"), 0600))
+	invalidKeyFile := filepath.Join(t.TempDir(), "invalid-key")
+	require.NoError(t, os.WriteFile(invalidKeyFile, []byte("short"), 0600))
+
+	t.Setenv("TEST_SSE_C_KEY", encodedKey)
+
+	tests := map[string]struct {
+		cfg         SSEConfig
+		expectedErr error
+	}{
+		"raw key read from file": {
+			cfg: SSEConfig{Type: SSEC, CustomerKeyFile: rawKeyFile},
+		},
+		"base64 encoded key read from file": {
+			cfg: SSEConfig{Type: SSEC, CustomerKeyFile: encodedKeyFile},
+		},
+		"base64 encoded key read from environment variable": {
+			cfg: SSEConfig{Type: SSEC, CustomerKeyEnvVar: "TEST_SSE_C_KEY"},
+		},
+		"missing key": {
+			cfg:         SSEConfig{Type: SSEC},
+			expectedErr: errMissingSSECustomerKey,
+		},
+		"both key file and environment variable": {
+			cfg:         SSEConfig{Type: SSEC, CustomerKeyFile: rawKeyFile, CustomerKeyEnvVar: "TEST_SSE_C_KEY"},
+			expectedErr: errAmbiguousSSECustomerKey,
+		},
+		"invalid key": {
+			cfg:         SSEConfig{Type: SSEC, CustomerKeyFile: invalidKeyFile},
+			expectedErr: errInvalidSSECustomerKey,
+		},
+		"empty environment variable": {
+			cfg:         SSEConfig{Type: SSEC, CustomerKeyEnvVar: "TEST_SSE_C_KEY_NOT_SET"},
+			expectedErr: errInvalidSSECustomerKey,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := testData.cfg.Validate()
+			if testData.expectedErr != nil {
+				require.Equal(t, testData.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			sse, err := testData.cfg.BuildMinioConfig()
+			require.NoError(t, err)
+
+			headers := http.Header{}
+			sse.Marshal(headers)
+			assert.Equal(t, "AES256", headers.Get("x-amz-server-side-encryption-customer-algorithm"))
+			assert.Equal(t, encodedKey, headers.Get("x-amz-server-side-encryption-customer-key"))
+
+			// The customer key must not be passed to the Thanos client config.
+			thanosCfg, err := testData.cfg.BuildThanosConfig()
+			require.NoError(t, err)
+			assert.Empty(t, thanosCfg.Type)
+		})
+	}
+}
+
 func TestParseKMSEncryptionContext(t *testing.T) {
 	actual, err := parseKMSEncryptionContext("")
 	assert.NoError(t, err)
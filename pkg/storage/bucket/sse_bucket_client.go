@@ -46,6 +46,11 @@ func NewSSEBucketClient(userID string, bucket objstore.Bucket, cfgProvider Tenan
 	}
 }
 
+// UserID implements UserBucketClient.
+func (b *SSEBucketClient) UserID() string {
+	return b.userID
+}
+
 // Close implements objstore.Bucket.
 func (b *SSEBucketClient) Close() error {
 	return b.bucket.Close()
@@ -53,15 +58,25 @@ func (b *SSEBucketClient) Close() error {
 
 // Upload the contents of the reader as an object into the bucket.
 func (b *SSEBucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	ctx, err := b.contextWithCustomS3SSEConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	return b.bucket.Upload(ctx, name, r)
+}
+
+// CopyObject implements ObjectCopier.
+func (b *SSEBucketClient) CopyObject(ctx context.Context, src, dst string) error {
 	if sse, err := b.getCustomS3SSEConfig(); err != nil {
 		return err
 	} else if sse != nil {
-		// If the underlying bucket client is not S3 and a custom S3 SSE config has been
-		// provided, the config option will be ignored.
-		ctx = s3.ContextWithSSEConfig(ctx, sse)
+		// The server-side copy would not encrypt the copied object with the custom S3 SSE config,
+		// so we copy it through Upload() which applies it.
+		return downloadAndUploadObject(ctx, b, src, dst)
 	}
 
-	return b.bucket.Upload(ctx, name, r)
+	return CopyObject(ctx, b.bucket, src, dst)
 }
 
 // Delete implements objstore.Bucket.
@@ -99,23 +114,59 @@ func (b *SSEBucketClient) getCustomS3SSEConfig() (encrypt.ServerSide, error) {
 	return sse, nil
 }
 
+// contextWithCustomS3SSEConfig returns a context with the custom S3 SSE config, if any.
+// The custom config is also passed when reading an object, so that the default SSE-C
+// config, if any, is not applied to the objects encrypted with the custom one.
+func (b *SSEBucketClient) contextWithCustomS3SSEConfig(ctx context.Context) (context.Context, error) {
+	sse, err := b.getCustomS3SSEConfig()
+	if err != nil || sse == nil {
+		return ctx, err
+	}
+
+	// If the underlying bucket client is not S3 and a custom S3 SSE config has been
+	// provided, the config option will be ignored.
+	ctx = s3.ContextWithSSEConfig(ctx, sse)
+	ctx = mimir_s3.ContextWithSSEConfig(ctx, sse)
+	return ctx, nil
+}
+
 // Iter implements objstore.Bucket.
 func (b *SSEBucketClient) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
 	return b.bucket.Iter(ctx, dir, f, options...)
 }
 
+// IterWithAttributes implements AttributesIterator.
+func (b *SSEBucketClient) IterWithAttributes(ctx context.Context, prefix string, f func(name, etag string, attrs objstore.ObjectAttributes) error) error {
+	return iterWithAttributes(ctx, b.bucket, prefix, f)
+}
+
 // Get implements objstore.Bucket.
 func (b *SSEBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	ctx, err := b.contextWithCustomS3SSEConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return b.bucket.Get(ctx, name)
 }
 
 // GetRange implements objstore.Bucket.
 func (b *SSEBucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	ctx, err := b.contextWithCustomS3SSEConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return b.bucket.GetRange(ctx, name, off, length)
 }
 
 // Exists implements objstore.Bucket.
 func (b *SSEBucketClient) Exists(ctx context.Context, name string) (bool, error) {
+	ctx, err := b.contextWithCustomS3SSEConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+
 	return b.bucket.Exists(ctx, name)
 }
 
@@ -126,6 +177,11 @@ func (b *SSEBucketClient) IsObjNotFoundErr(err error) bool {
 
 // Attributes implements objstore.Bucket.
 func (b *SSEBucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	ctx, err := b.contextWithCustomS3SSEConfig(ctx)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+
 	return b.bucket.Attributes(ctx, name)
 }
 
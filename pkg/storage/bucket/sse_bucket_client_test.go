@@ -6,12 +6,16 @@
 package bucket
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/dskit/flagext"
@@ -110,6 +114,96 @@ func TestSSEBucketClient_Upload_ShouldInjectCustomSSEConfig(t *testing.T) {
 	}
 }
 
+func TestSSEBucketClient_ShouldApplyCustomSSEConfigOnTopOfDefaultSSEC(t *testing.T) {
+	customerKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, 32))
+	t.Setenv("TEST_SSE_C_KEY", customerKey)
+
+	var (
+		reqsMx sync.Mutex
+		reqs   []*http.Request
+	)
+
+	// Start a fake HTTP server which simulate S3.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		reqsMx.Lock()
+		reqs = append(reqs, r)
+		reqsMx.Unlock()
+
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", "4")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte("test"))
+		}
+	}))
+	defer srv.Close()
+
+	s3Client, err := s3.NewBucketClient(s3.Config{
+		Endpoint:        srv.Listener.Addr().String(),
+		Region:          "test",
+		BucketName:      "test-bucket",
+		SecretAccessKey: flagext.SecretWithValue("test"),
+		AccessKeyID:     "test",
+		Insecure:        true,
+		SSE:             s3.SSEConfig{Type: s3.SSEC, CustomerKeyEnvVar: "TEST_SSE_C_KEY"},
+	}, "test", log.NewNopLogger())
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		tenantSSEType               string
+		expectedCustomerKeyHeader   string
+		expectedUploadSSETypeHeader string
+	}{
+		"tenant without SSE override": {
+			expectedCustomerKeyHeader: customerKey,
+		},
+		"tenant with SSE override": {
+			tenantSSEType:               s3.SSES3,
+			expectedUploadSSETypeHeader: "AES256",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reqsMx.Lock()
+			reqs = nil
+			reqsMx.Unlock()
+
+			ctx := context.Background()
+			sseBkt := NewSSEBucketClient("user-1", s3Client, &mockTenantConfigProvider{s3SseType: testData.tenantSSEType})
+
+			require.NoError(t, sseBkt.Upload(ctx, "test", strings.NewReader("test")))
+
+			rc, err := sseBkt.Get(ctx, "test")
+			require.NoError(t, err)
+			_, err = io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+
+			rc, err = sseBkt.GetRange(ctx, "test", 1, 2)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+
+			_, err = sseBkt.Exists(ctx, "test")
+			require.NoError(t, err)
+
+			_, err = sseBkt.Attributes(ctx, "test")
+			require.NoError(t, err)
+
+			reqsMx.Lock()
+			defer reqsMx.Unlock()
+			require.Len(t, reqs, 5)
+
+			for _, req := range reqs {
+				assert.Equal(t, testData.expectedCustomerKeyHeader, req.Header.Get("x-amz-server-side-encryption-customer-key"), "request: %s %s", req.Method, req.URL)
+			}
+			assert.Equal(t, testData.expectedUploadSSETypeHeader, reqs[0].Header.Get("x-amz-server-side-encryption"))
+		})
+	}
+}
+
 type mockTenantConfigProvider struct {
 	s3SseType              string
 	s3KmsKeyID             string
@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"context"
+	"flag"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+	"golang.org/x/time/rate"
+)
+
+// throttleChunkSize is the max number of bytes waited for at once, and the burst of the limiters,
+// so that the limit applies since the first bytes read or written.
+const throttleChunkSize = 64 * 1024
+
+var errInvalidThrottleBytesPerSec = errors.New("the bucket throttling bytes per second must not be negative")
+
+// ThrottleConfig holds the config of the bandwidth throttling of the bucket operations.
+type ThrottleConfig struct {
+	ReadBytesPerSec  int `yaml:"throttle_read_bytes_per_sec" category:"experimental"`
+	WriteBytesPerSec int `yaml:"throttle_write_bytes_per_sec" category:"experimental"`
+
+	// Limiters are shared by all the bucket clients created with this config. If nil, each bucket client
+	// is created with its own limiters.
+	Limiters *ThrottleLimiters `yaml:"-"`
+}
+
+// ThrottleLimiters holds the limiters of the bandwidth used to read from and write to the bucket.
+// A nil limiter disables the throttling.
+type ThrottleLimiters struct {
+	Read  *rate.Limiter
+	Write *rate.Limiter
+}
+
+func (cfg *ThrottleConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.ReadBytesPerSec, prefix+"throttle-read-bytes-per-sec", 0, "Maximum number of bytes per second read from the bucket, across all the objects being read by the components running in the process. 0 to disable.")
+	f.IntVar(&cfg.WriteBytesPerSec, prefix+"throttle-write-bytes-per-sec", 0, "Maximum number of bytes per second written to the bucket, across all the objects being uploaded by the components running in the process, including the parts of the multipart uploads. 0 to disable.")
+}
+
+func (cfg *ThrottleConfig) Validate() error {
+	if cfg.ReadBytesPerSec < 0 || cfg.WriteBytesPerSec < 0 {
+		return errInvalidThrottleBytesPerSec
+	}
+	return nil
+}
+
+// Enabled returns whether reads or writes are throttled.
+func (cfg *ThrottleConfig) Enabled() bool {
+	return cfg.ReadBytesPerSec > 0 || cfg.WriteBytesPerSec > 0
+}
+
+// InitLimiters creates the limiters shared by all the bucket clients which are created with this config
+// afterwards, including its copies. It's a no-op if the throttling is disabled.
+func (cfg *ThrottleConfig) InitLimiters() {
+	if cfg.Enabled() {
+		cfg.Limiters = cfg.newLimiters()
+	}
+}
+
+func (cfg *ThrottleConfig) newLimiters() *ThrottleLimiters {
+	return &ThrottleLimiters{
+		Read:  newThrottleLimiter(cfg.ReadBytesPerSec),
+		Write: newThrottleLimiter(cfg.WriteBytesPerSec),
+	}
+}
+
+// newThrottleLimiter returns a rate.Limiter allowing up to bytesPerSec bytes per second, or nil if bytesPerSec is 0.
+func newThrottleLimiter(bytesPerSec int) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+
+	burst := throttleChunkSize
+	if bytesPerSec < burst {
+		burst = bytesPerSec
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// ThrottledBucket is an objstore.Bucket limiting the bandwidth used to read and upload objects, to prevent
+// the object storage traffic from saturating the network.
+type ThrottledBucket struct {
+	objstore.Bucket
+
+	readLimiter  *rate.Limiter
+	writeLimiter *rate.Limiter
+}
+
+// NewThrottledBucket wraps the input bucket with a client throttling the content of the objects read with
+// Get and GetRange through readLimiter, and the content of the uploaded objects through writeLimiter.
+// A nil limiter disables the throttling.
+func NewThrottledBucket(inner objstore.Bucket, readLimiter, writeLimiter *rate.Limiter) *ThrottledBucket {
+	return &ThrottledBucket{
+		Bucket:       inner,
+		readLimiter:  readLimiter,
+		writeLimiter: writeLimiter,
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (b *ThrottledBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if b.writeLimiter == nil {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	// Keep the reader readable at arbitrary offsets, so that the object can still be uploaded in parts.
+	tr := throttledReader{ctx: ctx, r: r, limiter: b.writeLimiter}
+	if ra, ok := r.(io.ReaderAt); ok {
+		return b.Bucket.Upload(ctx, name, &throttledReaderAt{throttledReader: tr, ra: ra})
+	}
+	return b.Bucket.Upload(ctx, name, &tr)
+}
+
+// Get implements objstore.Bucket.
+func (b *ThrottledBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil || b.readLimiter == nil {
+		return rc, err
+	}
+	return &throttledReadCloser{throttledReader: throttledReader{ctx: ctx, r: rc, limiter: b.readLimiter}, closer: rc}, nil
+}
+
+// GetRange implements objstore.Bucket.
+func (b *ThrottledBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	rc, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil || b.readLimiter == nil {
+		return rc, err
+	}
+	return &throttledReadCloser{throttledReader: throttledReader{ctx: ctx, r: rc, limiter: b.readLimiter}, closer: rc}, nil
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *ThrottledBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *ThrottledBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &ThrottledBucket{
+			Bucket:       ib.WithExpectedErrs(fn),
+			readLimiter:  b.readLimiter,
+			writeLimiter: b.writeLimiter,
+		}
+	}
+
+	return b
+}
+
+// throttledReader is an io.Reader waiting for the limiter before returning each chunk of the read bytes.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Read at most a burst, so that the limiter can always allow the read bytes.
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := t.r.Read(p)
+	return n, t.wait(n, err)
+}
+
+// wait waits for the limiter to allow the n bytes read, and returns the input read error if the wait succeeds.
+func (t *throttledReader) wait(n int, readErr error) error {
+	if n > 0 {
+		if err := t.limiter.WaitN(t.ctx, n); err != nil {
+			return err
+		}
+	}
+	return readErr
+}
+
+// ObjectSize implements objstore.ObjectSizer, so that the backend clients can still get the size of the uploaded objects.
+func (t *throttledReader) ObjectSize() (int64, error) {
+	return objstore.TryToGetSize(t.r)
+}
+
+// throttledReaderAt is a throttledReader which can also be read at arbitrary offsets, like the parts of
+// a multipart upload, waiting for the limiter in the same way.
+type throttledReaderAt struct {
+	throttledReader
+	ra io.ReaderAt
+}
+
+func (t *throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		// Read at most a burst at once, so that the limiter can always allow the read bytes.
+		chunk := p[read:]
+		if burst := t.limiter.Burst(); len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+
+		n, err := t.ra.ReadAt(chunk, off+int64(read))
+		read += n
+		if err := t.wait(n, err); err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+type throttledReadCloser struct {
+	throttledReader
+	closer io.Closer
+}
+
+func (t *throttledReadCloser) Close() error {
+	return t.closer.Close()
+}
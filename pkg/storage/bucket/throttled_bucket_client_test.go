@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
+)
+
+const mebibyte = 1024 * 1024
+
+func TestThrottleConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&ThrottleConfig{}).Validate())
+	assert.NoError(t, (&ThrottleConfig{ReadBytesPerSec: mebibyte, WriteBytesPerSec: mebibyte}).Validate())
+	assert.Equal(t, errInvalidThrottleBytesPerSec, (&ThrottleConfig{ReadBytesPerSec: -1}).Validate())
+	assert.Equal(t, errInvalidThrottleBytesPerSec, (&ThrottleConfig{WriteBytesPerSec: -1}).Validate())
+}
+
+func TestThrottledBucket_Upload(t *testing.T) {
+	inner := objstore.NewInMemBucket()
+	b := NewThrottledBucket(inner, nil, newThrottleLimiter(mebibyte))
+
+	content := bytes.Repeat([]byte{'a'}, 2*mebibyte)
+
+	start := time.Now()
+	require.NoError(t, b.Upload(context.Background(), "test", bytes.NewReader(content)))
+	elapsed := time.Since(start)
+
+	// Only the first chunk is not throttled, so the upload takes about 2 seconds.
+	assert.GreaterOrEqual(t, elapsed, 1800*time.Millisecond)
+	assert.Less(t, elapsed, 3*time.Second)
+
+	rc, err := inner.Get(context.Background(), "test")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+}
+
+func TestThrottledBucket_ShouldThrottleTheMultipartUploadParts(t *testing.T) {
+	uploader := newMultipartUploaderMock(objstore.NewInMemBucket())
+	manager := NewMultipartUploadManager(uploader, MultipartUploadConfig{Threshold: 1, PartSize: MinMultipartUploadPartSize, Concurrency: 2})
+	b := NewThrottledBucket(manager, nil, newThrottleLimiter(4*mebibyte))
+
+	content := bytes.Repeat([]byte{'a'}, 2*MinMultipartUploadPartSize)
+
+	start := time.Now()
+	require.NoError(t, b.Upload(context.Background(), "test", bytes.NewReader(content)))
+	elapsed := time.Since(start)
+
+	// The object is uploaded in parts, concurrently, sharing the same limiter.
+	assert.Equal(t, map[int]int{1: 1, 2: 1}, uploader.partAttempts())
+	assert.GreaterOrEqual(t, elapsed, 2300*time.Millisecond)
+	assert.Less(t, elapsed, 4*time.Second)
+
+	rc, err := uploader.Get(context.Background(), "test")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+}
+
+func TestNewClient_ShouldShareTheThrottleLimiters(t *testing.T) {
+	cfg := Config{
+		StorageBackendConfig: StorageBackendConfig{
+			Backend:    Filesystem,
+			Filesystem: filesystem.Config{Directory: t.TempDir()},
+		},
+		Throttle: ThrottleConfig{WriteBytesPerSec: mebibyte},
+	}
+	cfg.Throttle.InitLimiters()
+
+	var clients []objstore.Bucket
+	for i := 0; i < 2; i++ {
+		client, err := NewClient(context.Background(), cfg, "test", log.NewNopLogger(), nil)
+		require.NoError(t, err)
+		clients = append(clients, client)
+	}
+
+	// The clients upload concurrently, so they take about 2 seconds only if they share the limiter.
+	start := time.Now()
+	g := errgroup.Group{}
+	for i, client := range clients {
+		client, name := client, []string{"a", "b"}[i]
+		g.Go(func() error {
+			return client.Upload(context.Background(), name, bytes.NewReader(bytes.Repeat([]byte{'a'}, mebibyte)))
+		})
+	}
+	require.NoError(t, g.Wait())
+	assert.GreaterOrEqual(t, time.Since(start), 1800*time.Millisecond)
+}
+
+func TestThrottledBucket_Get(t *testing.T) {
+	inner := objstore.NewInMemBucket()
+	content := bytes.Repeat([]byte{'a'}, mebibyte/2)
+	require.NoError(t, inner.Upload(context.Background(), "test", bytes.NewReader(content)))
+
+	b := NewThrottledBucket(inner, newThrottleLimiter(mebibyte), nil)
+
+	start := time.Now()
+	rc, err := b.Get(context.Background(), "test")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	elapsed := time.Since(start)
+
+	assert.Equal(t, content, actual)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 1500*time.Millisecond)
+
+	// Uploads are not throttled.
+	start = time.Now()
+	require.NoError(t, b.Upload(context.Background(), "other", bytes.NewReader(bytes.Repeat([]byte{'a'}, 2*mebibyte))))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestThrottledBucket_ShouldStopWaitingWhenContextIsCanceled(t *testing.T) {
+	b := NewThrottledBucket(objstore.NewInMemBucket(), nil, newThrottleLimiter(1024))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := b.Upload(ctx, "test", bytes.NewReader(bytes.Repeat([]byte{'a'}, mebibyte)))
+	require.Error(t, err)
+}
+
+func TestThrottledReader_ShouldPreserveTheObjectSize(t *testing.T) {
+	r := &throttledReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, 123)), limiter: newThrottleLimiter(mebibyte)}
+
+	size, err := objstore.TryToGetSize(r)
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), size)
+}
@@ -9,9 +9,17 @@ import (
 	"github.com/thanos-io/objstore"
 )
 
+// UserBucketClient is a bucket client scoped to a tenant.
+type UserBucketClient interface {
+	objstore.InstrumentedBucket
+
+	// UserID returns the ID of the tenant the client is scoped to.
+	UserID() string
+}
+
 // NewUserBucketClient returns a bucket client to use to access the storage on behalf of the provided user.
 // The cfgProvider can be nil.
-func NewUserBucketClient(userID string, bucket objstore.Bucket, cfgProvider TenantConfigProvider) objstore.InstrumentedBucket {
+func NewUserBucketClient(userID string, bucket objstore.Bucket, cfgProvider TenantConfigProvider) UserBucketClient {
 	// Inject the user/tenant prefix.
 	bucket = NewPrefixedBucketClient(bucket, userID)
 
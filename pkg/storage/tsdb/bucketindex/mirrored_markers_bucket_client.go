@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/multierror"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// mirrorTimeout is the max time an upload or delete of a marker on the secondary bucket can take.
+const mirrorTimeout = time.Minute
+
+// mirroredMarkersBucket is a bucket client which mirrors markers (eg. block deletion marks) to a secondary bucket.
+type mirroredMarkersBucket struct {
+	objstore.Bucket
+
+	secondary objstore.Bucket
+	logger    log.Logger
+
+	// inflight tracks the mirroring operations still running. It's shared with the buckets
+	// returned by WithExpectedErrs(), so that Close() waits for all of them.
+	inflight *sync.WaitGroup
+}
+
+// BucketWithMirroredMarkers wraps the primary bucket into a bucket which mirrors markers to the secondary bucket,
+// for deployments replicating the blocks, but not the markers, to another region. When a marker is uploaded to
+// or deleted from the primary bucket, the same operation is asynchronously run on the secondary bucket: failures
+// are logged and don't fail the primary operation. When a marker is not found in the primary bucket, it's read
+// from the secondary bucket. Other objects are only stored in the primary bucket. Close() waits until the
+// running mirroring operations complete, and closes both buckets.
+func BucketWithMirroredMarkers(primary, secondary objstore.Bucket, logger log.Logger) objstore.Bucket {
+	return &mirroredMarkersBucket{
+		Bucket:    primary,
+		secondary: secondary,
+		logger:    logger,
+		inflight:  &sync.WaitGroup{},
+	}
+}
+
+// Upload implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if !isMarker(name) {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	// Read the marker, so that the same bytes can be uploaded to the secondary bucket.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Bucket.Upload(ctx, name, bytes.NewReader(body)); err != nil {
+		return err
+	}
+
+	b.mirror(name, "upload", func(ctx context.Context) error {
+		return b.secondary.Upload(ctx, name, bytes.NewReader(body))
+	})
+	return nil
+}
+
+// Delete implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Delete(ctx context.Context, name string) error {
+	if err := b.Bucket.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	// The marker must be deleted from the secondary bucket too, otherwise reads would fall back to it.
+	if isMarker(name) {
+		b.mirror(name, "delete", func(ctx context.Context) error {
+			if err := b.secondary.Delete(ctx, name); err != nil && !b.secondary.IsObjNotFoundErr(err) {
+				return err
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// Get implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := b.Bucket.Get(ctx, name)
+	if err != nil && isMarker(name) && b.Bucket.IsObjNotFoundErr(err) {
+		return b.secondary.Get(ctx, name)
+	}
+	return r, err
+}
+
+// GetRange implements objstore.Bucket.
+func (b *mirroredMarkersBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	r, err := b.Bucket.GetRange(ctx, name, off, length)
+	if err != nil && isMarker(name) && b.Bucket.IsObjNotFoundErr(err) {
+		return b.secondary.GetRange(ctx, name, off, length)
+	}
+	return r, err
+}
+
+// Exists implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Exists(ctx context.Context, name string) (bool, error) {
+	ok, err := b.Bucket.Exists(ctx, name)
+	if err == nil && !ok && isMarker(name) {
+		return b.secondary.Exists(ctx, name)
+	}
+	return ok, err
+}
+
+// Attributes implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	attrs, err := b.Bucket.Attributes(ctx, name)
+	if err != nil && isMarker(name) && b.Bucket.IsObjNotFoundErr(err) {
+		return b.secondary.Attributes(ctx, name)
+	}
+	return attrs, err
+}
+
+// IsObjNotFoundErr implements objstore.Bucket.
+func (b *mirroredMarkersBucket) IsObjNotFoundErr(err error) bool {
+	// Reads of markers may return an error from the secondary bucket.
+	return b.Bucket.IsObjNotFoundErr(err) || b.secondary.IsObjNotFoundErr(err)
+}
+
+// Close implements objstore.Bucket.
+func (b *mirroredMarkersBucket) Close() error {
+	b.inflight.Wait()
+
+	var errs multierror.MultiError
+	errs.Add(b.Bucket.Close())
+	errs.Add(b.secondary.Close())
+	return errs.Err()
+}
+
+// WithExpectedErrs implements objstore.InstrumentedBucket.
+func (b *mirroredMarkersBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		return &mirroredMarkersBucket{
+			Bucket:    ib.WithExpectedErrs(fn),
+			secondary: b.secondary,
+			logger:    b.logger,
+			inflight:  b.inflight,
+		}
+	}
+
+	return b
+}
+
+// ReaderWithExpectedErrs implements objstore.InstrumentedBucketReader.
+func (b *mirroredMarkersBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// mirror runs the input operation on the secondary bucket in the background, logging its failure.
+func (b *mirroredMarkersBucket) mirror(name, op string, fn func(ctx context.Context) error) {
+	b.inflight.Add(1)
+
+	go func() {
+		defer b.inflight.Done()
+
+		// The operation must not be canceled when the caller's context is, because it runs after the caller returned.
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+		defer cancel()
+
+		if err := fn(ctx); err != nil {
+			level.Warn(b.logger).Log("msg", "failed to mirror marker to secondary bucket", "op", op, "marker", name, "err", err)
+		}
+	}()
+}
+
+// isMarker returns whether the input object is a block-local or global marker.
+func isMarker(name string) bool {
+	return strings.HasSuffix(name, metadata.DeletionMarkFilename) || strings.HasSuffix(name, metadata.NoCompactMarkFilename)
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bucketindex
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+func TestMirroredMarkersBucket_Upload(t *testing.T) {
+	ctx := context.Background()
+	blockID := ulid.MustNew(1, nil)
+
+	primary := objstore.NewInMemBucket()
+	secondary := objstore.NewInMemBucket()
+	bkt := BucketWithMirroredMarkers(primary, secondary, log.NewNopLogger())
+
+	markers := []string{
+		path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename),
+		path.Join("user-1", blockID.String(), metadata.NoCompactMarkFilename),
+		path.Join("user-1", BlockDeletionMarkFilepath(blockID)),
+		path.Join("user-1", NoCompactMarkFilepath(blockID)),
+	}
+	meta := path.Join("user-1", blockID.String(), metadata.MetaFilename)
+
+	for _, name := range append(markers, meta) {
+		require.NoError(t, bkt.Upload(ctx, name, strings.NewReader("{}")))
+	}
+
+	// Close waits until the markers have been mirrored.
+	require.NoError(t, bkt.Close())
+
+	for _, name := range markers {
+		assert.Equal(t, []byte("{}"), primary.Objects()[name], name)
+		assert.Equal(t, []byte("{}"), secondary.Objects()[name], name)
+	}
+
+	assert.Contains(t, primary.Objects(), meta)
+	assert.NotContains(t, secondary.Objects(), meta)
+}
+
+func TestMirroredMarkersBucket_Delete(t *testing.T) {
+	ctx := context.Background()
+	blockID := ulid.MustNew(1, nil)
+	marker := path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename)
+
+	primary := objstore.NewInMemBucket()
+	secondary := objstore.NewInMemBucket()
+	bkt := BucketWithMirroredMarkers(primary, secondary, log.NewNopLogger())
+
+	require.NoError(t, primary.Upload(ctx, marker, strings.NewReader("{}")))
+	require.NoError(t, secondary.Upload(ctx, marker, strings.NewReader("{}")))
+
+	require.NoError(t, bkt.Delete(ctx, marker))
+	require.NoError(t, bkt.Close())
+
+	assert.Empty(t, primary.Objects())
+	assert.Empty(t, secondary.Objects())
+}
+
+func TestMirroredMarkersBucket_ShouldFallbackToSecondaryForMarkersNotFoundInPrimary(t *testing.T) {
+	ctx := context.Background()
+	blockID := ulid.MustNew(1, nil)
+	marker := path.Join("user-1", BlockDeletionMarkFilepath(blockID))
+	meta := path.Join("user-1", blockID.String(), metadata.MetaFilename)
+
+	primary := objstore.NewInMemBucket()
+	secondary := objstore.NewInMemBucket()
+	bkt := BucketWithMirroredMarkers(primary, secondary, log.NewNopLogger())
+	t.Cleanup(func() { require.NoError(t, bkt.Close()) })
+
+	// Both objects only exist in the secondary bucket, like when markers are not replicated to the primary region.
+	require.NoError(t, secondary.Upload(ctx, marker, strings.NewReader("{}")))
+	require.NoError(t, secondary.Upload(ctx, meta, strings.NewReader("{}")))
+
+	// Markers are read from the secondary bucket.
+	ok, err := bkt.Exists(ctx, marker)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	r, err := bkt.Get(ctx, marker)
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "{}", string(content))
+
+	attrs, err := bkt.Attributes(ctx, marker)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), attrs.Size)
+
+	// Other objects are not.
+	ok, err = bkt.Exists(ctx, meta)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = bkt.Get(ctx, meta)
+	require.Error(t, err)
+	assert.True(t, bkt.IsObjNotFoundErr(err))
+
+	// Markers missing in both buckets are not found.
+	_, err = bkt.Get(ctx, path.Join("user-1", NoCompactMarkFilepath(blockID)))
+	require.Error(t, err)
+	assert.True(t, bkt.IsObjNotFoundErr(err))
+}
+
+func TestMirroredMarkersBucket_ShouldNotFailUploadIfMirroringFails(t *testing.T) {
+	ctx := context.Background()
+	blockID := ulid.MustNew(1, nil)
+	marker := path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename)
+
+	primary := objstore.NewInMemBucket()
+	bkt := BucketWithMirroredMarkers(primary, &failingUploadBucket{Bucket: objstore.NewInMemBucket()}, log.NewNopLogger())
+
+	require.NoError(t, bkt.Upload(ctx, marker, strings.NewReader("{}")))
+	require.NoError(t, bkt.Close())
+
+	assert.Contains(t, primary.Objects(), marker)
+}
+
+type failingUploadBucket struct {
+	objstore.Bucket
+}
+
+func (b *failingUploadBucket) Upload(context.Context, string, io.Reader) error {
+	return errors.New("upload failed")
+}
@@ -121,6 +121,18 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidWALSegmentSizeBytes,
 		},
+		"should fail on TSDB WAL segment size not multiple of the WAL page size": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.WALSegmentSizeBytes = 10*1024*1024 + 1
+			},
+			expectedErr: errInvalidWALSegmentSizeBytes,
+		},
+		"should pass on TSDB WAL segment size multiple of the WAL page size": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.TSDB.WALSegmentSizeBytes = 10 * 1024 * 1024
+			},
+			expectedErr: nil,
+		},
 	}
 
 	for testName, testData := range tests {
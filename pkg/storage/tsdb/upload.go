@@ -7,10 +7,12 @@ package tsdb
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
@@ -20,6 +22,37 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 )
 
+// uploadedMeta is the meta.json file uploaded along with a block: the Thanos meta, extended with the
+// time the block has been uploaded. The extra field is ignored when the file is read as a Thanos meta.
+type uploadedMeta struct {
+	*metadata.Meta
+
+	// UploadTime is the time the meta.json file has been uploaded, which is the last step of a block upload,
+	// in milliseconds since epoch.
+	UploadTime int64 `json:"mimir_upload_time,omitempty"`
+}
+
+// ReadUploadTime returns the time the block in the input directory has been uploaded, read from its meta.json
+// file as downloaded from the bucket. Returns the zero time if the block has been uploaded without the time.
+func ReadUploadTime(blockDir string) (time.Time, error) {
+	f, err := os.Open(filepath.Join(blockDir, block.MetaFilename))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	meta := struct {
+		UploadTime int64 `json:"mimir_upload_time"`
+	}{}
+	if err := json.NewDecoder(f).Decode(&meta); err != nil {
+		return time.Time{}, errors.Wrap(err, "decode meta file")
+	}
+	if meta.UploadTime == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(meta.UploadTime).UTC(), nil
+}
+
 // UploadBlock is copy of block.Upload with following modifications:
 //
 // - If meta parameter is supplied (not nil), then uploaded meta.json file reflects meta parameter. However local
@@ -28,6 +61,8 @@ import (
 // - Meta struct is updated with gatherFileStats
 //
 // - external labels are not checked for
+//
+// - the uploaded meta.json file includes the upload time, see ReadUploadTime
 func UploadBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blockDir string, meta *metadata.Meta) error {
 	df, err := os.Stat(blockDir)
 	if err != nil {
@@ -58,11 +93,6 @@ func UploadBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bl
 		return errors.Wrap(err, "gather meta file stats")
 	}
 
-	metaEncoded := strings.Builder{}
-	if err := meta.Write(&metaEncoded); err != nil {
-		return errors.Wrap(err, "encode meta file")
-	}
-
 	if err := objstore.UploadDir(ctx, logger, bkt, filepath.Join(blockDir, block.ChunksDirname), path.Join(id.String(), block.ChunksDirname)); err != nil {
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload chunks"))
 	}
@@ -71,6 +101,13 @@ func UploadBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bl
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload index"))
 	}
 
+	metaEncoded := strings.Builder{}
+	enc := json.NewEncoder(&metaEncoded)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(uploadedMeta{Meta: meta, UploadTime: time.Now().UnixMilli()}); err != nil {
+		return errors.Wrap(err, "encode meta file")
+	}
+
 	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file to be pending uploads.
 	if err := bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), strings.NewReader(metaEncoded.String())); err != nil {
 		// Don't call cleanUp here. Despite getting error, meta.json may have been uploaded in certain cases,
@@ -11,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/prometheus/prometheus/model/labels"
@@ -107,7 +108,18 @@ func TestUploadBlock(t *testing.T) {
 		chunkFileSize := getFileSize(t, filepath.Join(tmpDir, b1.String(), block.ChunksDirname, "000001"))
 		require.Equal(t, chunkFileSize, int64(len(bkt.Objects()[path.Join(b1.String(), block.ChunksDirname, "000001")])))
 		require.Equal(t, 401, len(bkt.Objects()[path.Join(b1.String(), block.IndexFilename)]))
-		require.Equal(t, 570, len(bkt.Objects()[path.Join(b1.String(), block.MetaFilename)]))
+		require.Equal(t, 607, len(bkt.Objects()[path.Join(b1.String(), block.MetaFilename)]))
+
+		// The upload time can be read from the downloaded block, while the local one has no upload time.
+		downloadDir := path.Join(tmpDir, "download", b1.String())
+		require.NoError(t, block.Download(ctx, log.NewNopLogger(), bkt, b1, downloadDir))
+		uploadTime, err := ReadUploadTime(downloadDir)
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), uploadTime, time.Minute)
+
+		uploadTime, err = ReadUploadTime(path.Join(tmpDir, "test", b1.String()))
+		require.NoError(t, err)
+		require.True(t, uploadTime.IsZero())
 
 		origMeta, err := metadata.ReadFromDir(path.Join(tmpDir, "test", b1.String()))
 		require.NoError(t, err)
@@ -134,7 +146,7 @@ func TestUploadBlock(t *testing.T) {
 		chunkFileSize := getFileSize(t, filepath.Join(tmpDir, b1.String(), block.ChunksDirname, "000001"))
 		require.Equal(t, chunkFileSize, int64(len(bkt.Objects()[path.Join(b1.String(), block.ChunksDirname, "000001")])))
 		require.Equal(t, 401, len(bkt.Objects()[path.Join(b1.String(), block.IndexFilename)]))
-		require.Equal(t, 570, len(bkt.Objects()[path.Join(b1.String(), block.MetaFilename)]))
+		require.Equal(t, 607, len(bkt.Objects()[path.Join(b1.String(), block.MetaFilename)]))
 	})
 
 	t.Run("upload with no external labels works just fine", func(t *testing.T) {
@@ -155,7 +167,7 @@ func TestUploadBlock(t *testing.T) {
 		require.Equal(t, 6, len(bkt.Objects())) // 3 from b1, 3 from b2
 		require.Equal(t, chunkFileSize, int64(len(bkt.Objects()[path.Join(b2.String(), block.ChunksDirname, "000001")])))
 		require.Equal(t, 401, len(bkt.Objects()[path.Join(b2.String(), block.IndexFilename)]))
-		require.Equal(t, 549, len(bkt.Objects()[path.Join(b2.String(), block.MetaFilename)]))
+		require.Equal(t, 586, len(bkt.Objects()[path.Join(b2.String(), block.MetaFilename)]))
 
 		origMeta, err := metadata.ReadFromDir(path.Join(tmpDir, b2.String()))
 		require.NoError(t, err)
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	// blockPrewarmQueueSize is the max number of blocks waiting to be prewarmed. Blocks loaded
+	// while the queue is full are not prewarmed.
+	blockPrewarmQueueSize = 1024
+
+	// blockPrewarmConcurrency is the max number of blocks prewarmed concurrently.
+	blockPrewarmConcurrency = 4
+)
+
+// BlockPrewarmCache pre-fetches the postings of a configured list of label matchers when a block is loaded,
+// storing them in the index cache. This way the queries run by the most common dashboards don't have to
+// fetch and decode the postings from the object storage after a store-gateway restart. Blocks are prewarmed
+// asynchronously and with a bounded concurrency, so that prewarming doesn't slow down the blocks loading.
+type BlockPrewarmCache struct {
+	services.Service
+
+	matchers [][]*labels.Matcher
+	queue    chan blockPrewarmRequest
+
+	prewarmed prometheus.Counter
+	failures  prometheus.Counter
+	skipped   prometheus.Counter
+	duration  prometheus.Histogram
+}
+
+// blockPrewarmRequest is a block waiting to be prewarmed.
+type blockPrewarmRequest struct {
+	store   *BucketStore
+	blockID ulid.ULID
+}
+
+// NewBlockPrewarmCache makes a new BlockPrewarmCache. Each selector in the input list must be a valid
+// series selector (e.g. `{__name__="up", job="api"}`).
+func NewBlockPrewarmCache(selectors []string, reg prometheus.Registerer) (*BlockPrewarmCache, error) {
+	matchers, err := parsePrewarmMatchers(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &BlockPrewarmCache{
+		matchers: matchers,
+		queue:    make(chan blockPrewarmRequest, blockPrewarmQueueSize),
+		prewarmed: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_postings_prewarmed_total",
+			Help: "Total number of label matchers whose postings have been pre-fetched at block load time.",
+		}),
+		failures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_postings_prewarm_failures_total",
+			Help: "Total number of label matchers whose postings failed to be pre-fetched at block load time.",
+		}),
+		skipped: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_blocks_prewarm_skipped_total",
+			Help: "Total number of loaded blocks which have not been prewarmed, because the prewarm queue was full or the index-header would have been unloaded right after.",
+		}),
+		duration: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "cortex_bucket_store_postings_prewarm_duration_seconds",
+			Help:    "Time it took to pre-fetch the postings of all configured label matchers for a block.",
+			Buckets: []float64{0.01, 0.1, 0.5, 1, 5, 10, 30},
+		}),
+	}
+
+	c.Service = services.NewBasicService(nil, c.running, c.stopping)
+	return c, nil
+}
+
+// Enqueue enqueues the input block of the input store to be prewarmed. It never blocks.
+func (c *BlockPrewarmCache) Enqueue(store *BucketStore, blockID ulid.ULID) {
+	select {
+	case c.queue <- blockPrewarmRequest{store: store, blockID: blockID}:
+	default:
+		c.skipped.Inc()
+	}
+}
+
+func (c *BlockPrewarmCache) running(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	wg.Add(blockPrewarmConcurrency)
+
+	for i := 0; i < blockPrewarmConcurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-c.queue:
+					c.prewarmBlock(ctx, req)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (c *BlockPrewarmCache) stopping(_ error) error {
+	// The blocks still waiting are not prewarmed.
+	for {
+		select {
+		case <-c.queue:
+			c.skipped.Inc()
+		default:
+			return nil
+		}
+	}
+}
+
+// prewarmBlock prewarms the requested block, unless it has been removed from the store in the meanwhile.
+func (c *BlockPrewarmCache) prewarmBlock(ctx context.Context, req blockPrewarmRequest) {
+	// When the index-headers are lazy loaded and the max number of loaded ones has been reached,
+	// loading the index-header of this block would unload the least recently used one, which
+	// could be the one of the block prewarmed right before.
+	if req.store.indexHeaderLRU != nil && req.store.indexReaderPool.LazyReaderEnabled() && req.store.indexHeaderLRU.IsFull() {
+		c.skipped.Inc()
+		return
+	}
+
+	indexr := req.store.blockIndexReader(req.blockID)
+	if indexr == nil {
+		return
+	}
+
+	c.Prewarm(ctx, indexr)
+}
+
+// Prewarm pre-fetches the postings of the configured label matchers through the input index reader, storing
+// them in the block index cache, and then closes the reader. Failures are logged but not returned, given the
+// block can be queried anyway.
+func (c *BlockPrewarmCache) Prewarm(ctx context.Context, indexr *bucketIndexReader) {
+	defer indexr.Close()
+
+	if len(c.matchers) == 0 {
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		c.duration.Observe(time.Since(start).Seconds())
+	}()
+
+	for _, ms := range c.matchers {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if _, err := indexr.ExpandedPostings(ctx, ms); err != nil {
+			c.failures.Inc()
+			level.Warn(indexr.block.logger).Log("msg", "failed to prewarm postings", "matchers", util.MatchersStringer(ms), "err", err)
+			continue
+		}
+		c.prewarmed.Inc()
+	}
+}
+
+func parsePrewarmMatchers(selectors []string) ([][]*labels.Matcher, error) {
+	result := make([][]*labels.Matcher, 0, len(selectors))
+	for _, selector := range selectors {
+		ms, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid prewarm matchers %q", selector)
+		}
+		result = append(result, ms)
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	dstest "github.com/grafana/dskit/test"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storegateway/indexheader"
+	"github.com/grafana/mimir/pkg/util/test"
+)
+
+func TestBlockPrewarmCache_Prewarm(t *testing.T) {
+	newTestBucketBlock := prepareTestBlock(test.NewTB(t), 500)
+
+	b := newTestBucketBlock()
+	b.indexCache = newInMemoryIndexCache(t)
+
+	c, err := NewBlockPrewarmCache([]string{`{j="foo"}`, `{p="foo", n=~"1.*"}`}, nil)
+	require.NoError(t, err)
+
+	c.Prewarm(context.Background(), b.indexReader())
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.prewarmed))
+	assert.Equal(t, float64(0), testutil.ToFloat64(c.failures))
+
+	// The postings of the prewarmed matchers should now be in the cache.
+	keys := []labels.Label{{Name: "j", Value: "foo"}, {Name: "p", Value: "foo"}}
+	hits, misses := b.indexCache.FetchMultiPostings(context.Background(), b.userID, b.meta.ULID, keys)
+	assert.Len(t, hits, 2)
+	assert.Empty(t, misses)
+
+	// Postings not prewarmed should not be cached.
+	_, misses = b.indexCache.FetchMultiPostings(context.Background(), b.userID, b.meta.ULID, []labels.Label{{Name: "q", Value: "foo"}})
+	assert.Len(t, misses, 1)
+}
+
+func TestBlockPrewarmCache_ShouldNotPrewarmOnCanceledContext(t *testing.T) {
+	newTestBucketBlock := prepareTestBlock(test.NewTB(t), 100)
+
+	b := newTestBucketBlock()
+	b.indexCache = newInMemoryIndexCache(t)
+
+	c, err := NewBlockPrewarmCache([]string{`{j="foo"}`}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Prewarm(ctx, b.indexReader())
+	assert.Equal(t, float64(0), testutil.ToFloat64(c.prewarmed))
+}
+
+func TestBlockPrewarmCache_ShouldPrewarmEnqueuedBlocksAsynchronously(t *testing.T) {
+	newTestBucketBlock := prepareTestBlock(test.NewTB(t), 100)
+
+	b := newTestBucketBlock()
+	b.indexCache = newInMemoryIndexCache(t)
+
+	store := &BucketStore{
+		blocks:          map[ulid.ULID]*bucketBlock{b.meta.ULID: b},
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, nil, indexheader.NewReaderPoolMetrics(nil)),
+	}
+
+	c, err := NewBlockPrewarmCache([]string{`{j="foo"}`}, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+	})
+
+	// A block which is not loaded in the store anymore should not be prewarmed.
+	c.Enqueue(store, ulid.MustNew(1, nil))
+	c.Enqueue(store, b.meta.ULID)
+
+	dstest.Poll(t, time.Second, float64(1), func() interface{} {
+		return testutil.ToFloat64(c.prewarmed)
+	})
+	assert.Equal(t, float64(0), testutil.ToFloat64(c.skipped))
+}
+
+func TestBlockPrewarmCache_ShouldSkipBlocksEnqueuedWhileTheQueueIsFull(t *testing.T) {
+	c, err := NewBlockPrewarmCache([]string{`{j="foo"}`}, nil)
+	require.NoError(t, err)
+
+	// The service is not running, so enqueued blocks are not consumed.
+	for i := 0; i < blockPrewarmQueueSize+1; i++ {
+		c.Enqueue(&BucketStore{}, ulid.MustNew(uint64(i), nil))
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.skipped))
+}
+
+func TestNewBlockPrewarmCache_ShouldFailOnInvalidSelector(t *testing.T) {
+	_, err := NewBlockPrewarmCache([]string{`{j="foo"}`, `{j=`}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid prewarm matchers "{j="`)
+}
@@ -37,7 +37,6 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
-	"github.com/prometheus/prometheus/tsdb/hashcache"
 	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -99,8 +98,9 @@ type BucketStore struct {
 	dir             string
 	indexCache      indexcache.IndexCache
 	indexReaderPool *indexheader.ReaderPool
+	indexHeaderLRU  *indexheader.ReaderLRU
 	chunkPool       pool.Bytes
-	seriesHashCache *hashcache.SeriesHashCache
+	seriesHashCache *SeriesHashCache
 
 	// Sets of blocks that have the same labels. They are indexed by a hash over their label set.
 	mtx      sync.RWMutex
@@ -130,6 +130,12 @@ type BucketStore struct {
 
 	// Enables hints in the Series() response.
 	enableSeriesResponseHints bool
+
+	// Pre-fetches the postings of the configured label matchers at block load time (optional).
+	prewarmCache *BlockPrewarmCache
+
+	// Enables a per-block timeout in the Series() call, so that a single slow block doesn't delay the whole query.
+	perBlockQueryTimeout time.Duration
 }
 
 type noopCache struct{}
@@ -200,6 +206,28 @@ func WithChunkPool(chunkPool pool.Bytes) BucketStoreOption {
 	}
 }
 
+// WithIndexHeaderLRU sets the indexheader.ReaderLRU used to limit the number of loaded index-headers.
+func WithIndexHeaderLRU(lru *indexheader.ReaderLRU) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.indexHeaderLRU = lru
+	}
+}
+
+// WithBlockPrewarmCache sets the BlockPrewarmCache used to pre-fetch postings when a block is loaded.
+func WithBlockPrewarmCache(cache *BlockPrewarmCache) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.prewarmCache = cache
+	}
+}
+
+// WithPerBlockQueryTimeout enables the per-block timeout in the Series() call. The blocks are queried
+// concurrently, so each block is given the input timeout, bounded by the request deadline.
+func WithPerBlockQueryTimeout(timeout time.Duration) BucketStoreOption {
+	return func(s *BucketStore) {
+		s.perBlockQueryTimeout = timeout
+	}
+}
+
 // WithDebugLogging enables debug logging.
 func WithDebugLogging() BucketStoreOption {
 	return func(s *BucketStore) {
@@ -223,7 +251,7 @@ func NewBucketStore(
 	enableSeriesResponseHints bool, // TODO(pracucci) Thanos 0.12 and below doesn't gracefully handle new fields in SeriesResponse. Drop this flag and always enable hints once we can drop backward compatibility.
 	lazyIndexReaderEnabled bool,
 	lazyIndexReaderIdleTimeout time.Duration,
-	seriesHashCache *hashcache.SeriesHashCache,
+	seriesHashCache *SeriesHashCache,
 	metrics *BucketStoreMetrics,
 	options ...BucketStoreOption,
 ) (*BucketStore, error) {
@@ -254,7 +282,7 @@ func NewBucketStore(
 	}
 
 	// Depend on the options
-	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, metrics.indexHeaderReaderMetrics)
+	s.indexReaderPool = indexheader.NewReaderPool(s.logger, lazyIndexReaderEnabled, lazyIndexReaderIdleTimeout, s.indexHeaderLRU, metrics.indexHeaderReaderMetrics)
 
 	if err := os.MkdirAll(dir, 0750); err != nil {
 		return nil, errors.Wrap(err, "create dir")
@@ -378,6 +406,19 @@ func (s *BucketStore) getBlock(id ulid.ULID) *bucketBlock {
 	return s.blocks[id]
 }
 
+// blockIndexReader returns a new index reader for the input block, or nil if the block is not loaded.
+// The reader is created while holding the lock, so that the block can't be closed until it's closed.
+func (s *BucketStore) blockIndexReader(id ulid.ULID) *bucketIndexReader {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	b := s.blocks[id]
+	if b == nil {
+		return nil
+	}
+	return b.indexReader()
+}
+
 func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err error) {
 	dir := filepath.Join(s.dir, meta.ULID.String())
 	start := time.Now()
@@ -445,6 +486,10 @@ func (s *BucketStore) addBlock(ctx context.Context, meta *metadata.Meta) (err er
 	}
 	s.blocks[b.meta.ULID] = b
 
+	if s.prewarmCache != nil {
+		s.prewarmCache.Enqueue(s, b.meta.ULID)
+	}
+
 	return nil
 }
 
@@ -565,7 +610,7 @@ func blockSeries(
 	chunkr *bucketChunkReader, // Chunk reader for block.
 	matchers []*labels.Matcher, // Series matchers.
 	shard *sharding.ShardSelector, // Shard selector.
-	seriesHashCache *hashcache.BlockSeriesHashCache, // Block-specific series hash cache (used only if shard selector is specified).
+	seriesHashCache *BlockSeriesHashCache, // Block-specific series hash cache (used only if shard selector is specified).
 	chunksLimiter ChunksLimiter, // Rate limiter for loading chunks.
 	seriesLimiter SeriesLimiter, // Rate limiter for loading series.
 	skipChunks bool, // If true, chunks are not loaded and minTime/maxTime are ignored.
@@ -768,7 +813,7 @@ func storeCachedSeries(ctx context.Context, indexCache indexcache.IndexCache, us
 // filterPostingsByCachedShardHash filters the input postings by the provided shard. It filters only
 // postings for which we have their series hash already in the cache; if a series is not in the cache,
 // postings will be kept in the output.
-func filterPostingsByCachedShardHash(ps []storage.SeriesRef, shard *sharding.ShardSelector, seriesHashCache *hashcache.BlockSeriesHashCache) (filteredPostings []storage.SeriesRef, stats queryStats) {
+func filterPostingsByCachedShardHash(ps []storage.SeriesRef, shard *sharding.ShardSelector, seriesHashCache *BlockSeriesHashCache) (filteredPostings []storage.SeriesRef, stats queryStats) {
 	writeIdx := 0
 	stats.seriesHashCacheRequests = len(ps)
 
@@ -871,6 +916,8 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		ctx              = srv.Context()
 		stats            = &queryStats{}
 		res              []storepb.SeriesSet
+		warnings         []error
+		timedOutBlocks   = map[ulid.ULID]struct{}{}
 		mtx              sync.Mutex
 		g, gctx          = errgroup.WithContext(ctx)
 		resHints         = &hintspb.SeriesResponseHints{}
@@ -910,19 +957,23 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		debugFoundBlockSetOverview(s.logger, req.MinTime, req.MaxTime, req.MaxResolutionWindow, blocks)
 	}
 
+	blockTimeout := s.perBlockQueryTimeout
+
 	for _, b := range blocks {
 		b := b
 
-		if s.enableSeriesResponseHints {
-			// Keep track of queried blocks.
-			resHints.AddQueriedBlock(b.meta.ULID)
+		blockCtx := gctx
+		if blockTimeout > 0 {
+			var cancel context.CancelFunc
+			blockCtx, cancel = context.WithTimeout(gctx, blockTimeout)
+			defer cancel()
 		}
 
 		var chunkr *bucketChunkReader
 		// We must keep the readers open until all their data has been sent.
 		indexr := b.indexReader()
 		if !req.SkipChunks {
-			chunkr = b.chunkReader(gctx)
+			chunkr = b.chunkReader(blockCtx)
 			defer runutil.CloseWithLogOnErr(s.logger, chunkr, "series block")
 		}
 
@@ -931,14 +982,14 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 
 		// If query sharding is enabled we have to get the block-specific series hash cache
 		// which is used by blockSeries().
-		var blockSeriesHashCache *hashcache.BlockSeriesHashCache
+		var blockSeriesHashCache *BlockSeriesHashCache
 		if shardSelector != nil {
 			blockSeriesHashCache = s.seriesHashCache.GetBlockCache(b.meta.ULID.String())
 		}
 
 		g.Go(func() error {
 			part, pstats, err := blockSeries(
-				gctx,
+				blockCtx,
 				indexr,
 				chunkr,
 				matchers,
@@ -951,6 +1002,18 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				req.Aggregates,
 				s.logger,
 			)
+			if err != nil && blockTimeout > 0 && errors.Is(blockCtx.Err(), context.DeadlineExceeded) && gctx.Err() == nil {
+				// The block timed out but the query is still running: skip the block instead of failing the query.
+				// The block is not tracked as queried, so that the querier can retry it on another store-gateway.
+				level.Warn(spanLogger).Log("msg", "fetching series for block timed out", "block", b.meta.ULID, "timeout", blockTimeout)
+				s.metrics.seriesBlocksTimedOut.Inc()
+
+				mtx.Lock()
+				warnings = append(warnings, errors.Errorf("fetch series for block %s timed out after %s", b.meta.ULID, blockTimeout))
+				timedOutBlocks[b.meta.ULID] = struct{}{}
+				mtx.Unlock()
+				return nil
+			}
 			if err != nil {
 				return errors.Wrapf(err, "fetch series for block %s", b.meta.ULID)
 			}
@@ -1048,8 +1111,24 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 
 		err = nil
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range warnings {
+		if err = srv.Send(storepb.NewWarnSeriesResponse(w)); err != nil {
+			return status.Error(codes.Unknown, errors.Wrap(err, "send series response warning").Error())
+		}
+	}
 
 	if s.enableSeriesResponseHints {
+		// Keep track of queried blocks. The blocks which timed out have not been queried.
+		for _, b := range blocks {
+			if _, ok := timedOutBlocks[b.meta.ULID]; !ok {
+				resHints.AddQueriedBlock(b.meta.ULID)
+			}
+		}
+
 		var anyHints *types.Any
 
 		if anyHints, err = types.MarshalAny(resHints); err != nil {
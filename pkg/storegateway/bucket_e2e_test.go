@@ -8,7 +8,9 @@ package storegateway
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -17,10 +19,11 @@ import (
 	"github.com/go-kit/log"
 	"github.com/gogo/status"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
-	"github.com/prometheus/prometheus/tsdb/hashcache"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/providers/filesystem"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -175,7 +178,7 @@ func prepareStoreWithTestBlocksForSeries(t testing.TB, dir string, bkt objstore.
 		true,
 		true,
 		time.Minute,
-		hashcache.NewSeriesHashCache(1024*1024),
+		NewSeriesHashCache(1024*1024, nil),
 		NewBucketStoreMetrics(nil),
 		WithLogger(s.logger),
 		WithIndexCache(s.cache),
@@ -551,6 +554,67 @@ func TestBucketStore_Series_ChunksLimiter_e2e(t *testing.T) {
 	}
 }
 
+func TestBucketStore_Series_PerBlockQueryTimeout_e2e(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	bkt := &slowChunksBucket{Bucket: objstore.NewInMemBucket()}
+	s := prepareStoreWithTestBlocks(t, t.TempDir(), bkt, false, NewChunksLimiterFactory(0), NewSeriesLimiterFactory(0))
+	s.store.perBlockQueryTimeout = time.Second
+
+	// Make the chunks of a single block slower than the per-block timeout.
+	s.store.mtx.RLock()
+	for id := range s.store.blocks {
+		bkt.slowBlockID = id.String()
+		break
+	}
+	s.store.mtx.RUnlock()
+
+	req := &storepb.SeriesRequest{
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"},
+		},
+		MinTime: minTimeDuration.PrometheusTimestamp(),
+		MaxTime: maxTimeDuration.PrometheusTimestamp(),
+	}
+
+	s.cache.SwapWith(noopCache{})
+	srv := newBucketStoreSeriesServer(ctx)
+	require.NoError(t, s.store.Series(req, srv))
+
+	// The query fetches 2 series from each of the 6 blocks, each with 1 chunk, but the slow block is skipped.
+	numChunks := 0
+	for _, series := range srv.SeriesSet {
+		numChunks += len(series.Chunks)
+	}
+	assert.Equal(t, 2*5, numChunks)
+
+	require.Len(t, srv.Warnings, 1)
+	assert.Contains(t, srv.Warnings[0].Error(), bkt.slowBlockID)
+	assert.Equal(t, float64(1), promtest.ToFloat64(s.store.metrics.seriesBlocksTimedOut))
+
+	// The slow block should not be reported as queried.
+	require.Len(t, srv.Hints.QueriedBlocks, 5)
+	for _, b := range srv.Hints.QueriedBlocks {
+		assert.NotEqual(t, bkt.slowBlockID, b.Id)
+	}
+}
+
+// slowChunksBucket is a bucket whose reads of the chunks of slowBlockID never complete until the context is canceled.
+type slowChunksBucket struct {
+	objstore.Bucket
+
+	slowBlockID string
+}
+
+func (b *slowChunksBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if b.slowBlockID != "" && strings.HasPrefix(name, path.Join(b.slowBlockID, block.ChunksDirname)) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.Bucket.GetRange(ctx, name, off, length)
+}
+
 func TestBucketStore_LabelNames_e2e(t *testing.T) {
 	foreachStore(t, func(t *testing.T, bkt objstore.Bucket) {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -21,7 +21,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
-	"github.com/prometheus/prometheus/tsdb/hashcache"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/extprom"
@@ -33,6 +32,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/bucket"
 	"github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storegateway/indexcache"
+	"github.com/grafana/mimir/pkg/storegateway/indexheader"
 	"github.com/grafana/mimir/pkg/storegateway/storepb"
 	"github.com/grafana/mimir/pkg/util/gate"
 	util_log "github.com/grafana/mimir/pkg/util/log"
@@ -60,7 +60,10 @@ type BucketStores struct {
 	indexCache indexcache.IndexCache
 
 	// Series hash cache shared across all tenants.
-	seriesHashCache *hashcache.SeriesHashCache
+	seriesHashCache *SeriesHashCache
+
+	// LRU of the loaded index-headers shared across all tenants.
+	indexHeaderLRU *indexheader.ReaderLRU
 
 	// Chunks bytes pool shared across all tenants.
 	chunksPool pool.Bytes
@@ -68,6 +71,15 @@ type BucketStores struct {
 	// Partitioner shared across all tenants.
 	partitioner Partitioner
 
+	// Pre-fetches postings at block load time, shared across all tenants (optional).
+	prewarmCache *BlockPrewarmCache
+
+	// Whether each block queried by a Series() call has its own timeout.
+	perBlockQueryTimeout time.Duration
+
+	// Restricts the tenants whose blocks are loaded and queried.
+	tenantAccessControl *TenantAccessControl
+
 	// Gate used to limit query concurrency across all tenants.
 	queryGate gate.Gate
 
@@ -84,7 +96,12 @@ type BucketStores struct {
 }
 
 // NewBucketStores makes a new BucketStores.
-func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStrategy, bucketClient objstore.Bucket, limits *validation.Overrides, logLevel logging.Level, logger log.Logger, reg prometheus.Registerer) (*BucketStores, error) {
+func NewBucketStores(cfg tsdb.BlocksStorageConfig, gatewayCfg Config, shardingStrategy ShardingStrategy, bucketClient objstore.Bucket, limits *validation.Overrides, logLevel logging.Level, logger log.Logger, reg prometheus.Registerer) (*BucketStores, error) {
+	tenantAccessControl, err := NewTenantAccessControl(gatewayCfg.AllowedTenantsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "create tenant access control")
+	}
+
 	cachingBucket, err := tsdb.CreateCachingBucket(cfg.BucketStore.ChunksCache, cfg.BucketStore.MetadataCache, bucketClient, logger, reg)
 	if err != nil {
 		return nil, errors.Wrapf(err, "create caching bucket")
@@ -101,18 +118,21 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 	queryGate = gate.NewInstrumented(queryGateReg, cfg.BucketStore.MaxConcurrent, queryGate)
 
 	u := &BucketStores{
-		logger:             logger,
-		cfg:                cfg,
-		limits:             limits,
-		bucket:             cachingBucket,
-		shardingStrategy:   shardingStrategy,
-		stores:             map[string]*BucketStore{},
-		logLevel:           logLevel,
-		bucketStoreMetrics: NewBucketStoreMetrics(reg),
-		metaFetcherMetrics: NewMetadataFetcherMetrics(),
-		queryGate:          queryGate,
-		partitioner:        newGapBasedPartitioner(cfg.BucketStore.PartitionerMaxGapBytes, reg),
-		seriesHashCache:    hashcache.NewSeriesHashCache(cfg.BucketStore.SeriesHashCacheMaxBytes),
+		logger:               logger,
+		cfg:                  cfg,
+		limits:               limits,
+		bucket:               cachingBucket,
+		shardingStrategy:     shardingStrategy,
+		stores:               map[string]*BucketStore{},
+		logLevel:             logLevel,
+		bucketStoreMetrics:   NewBucketStoreMetrics(reg),
+		metaFetcherMetrics:   NewMetadataFetcherMetrics(),
+		queryGate:            queryGate,
+		partitioner:          newGapBasedPartitioner(cfg.BucketStore.PartitionerMaxGapBytes, reg),
+		seriesHashCache:      NewSeriesHashCache(gatewayCfg.seriesHashCacheMaxBytes(cfg.BucketStore), reg),
+		indexHeaderLRU:       indexheader.NewReaderLRU(gatewayCfg.MaxIndexHeaderFiles, logger, reg),
+		perBlockQueryTimeout: gatewayCfg.PerBlockQueryTimeout,
+		tenantAccessControl:  tenantAccessControl,
 		syncBackoffConfig: backoff.Config{
 			MinBackoff: 1 * time.Second,
 			MaxBackoff: 10 * time.Second,
@@ -120,6 +140,12 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		},
 	}
 
+	if len(gatewayCfg.PrewarmMatchers) > 0 {
+		if u.prewarmCache, err = NewBlockPrewarmCache(gatewayCfg.PrewarmMatchers, reg); err != nil {
+			return nil, errors.Wrap(err, "create block prewarm cache")
+		}
+	}
+
 	// Register metrics.
 	u.syncTimes = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 		Name:    "cortex_bucket_stores_blocks_sync_seconds",
@@ -232,6 +258,7 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 	if err != nil {
 		return errors.Wrap(err, "unable to check tenants owned by this store-gateway instance")
 	}
+	ownedUserIDs = u.tenantAccessControl.FilterUsers(ownedUserIDs)
 
 	includeUserIDs := make(map[string]struct{}, len(ownedUserIDs))
 	for _, userID := range ownedUserIDs {
@@ -303,6 +330,9 @@ func (u *BucketStores) Series(req *storepb.SeriesRequest, srv storepb.Store_Seri
 	if userID == "" {
 		return fmt.Errorf("no userID")
 	}
+	if err := u.tenantAccessControl.checkQuery(userID); err != nil {
+		return err
+	}
 
 	store := u.getStore(userID)
 	if store == nil {
@@ -324,6 +354,9 @@ func (u *BucketStores) LabelNames(ctx context.Context, req *storepb.LabelNamesRe
 	if userID == "" {
 		return nil, fmt.Errorf("no userID")
 	}
+	if err := u.tenantAccessControl.checkQuery(userID); err != nil {
+		return nil, err
+	}
 
 	store := u.getStore(userID)
 	if store == nil {
@@ -342,6 +375,9 @@ func (u *BucketStores) LabelValues(ctx context.Context, req *storepb.LabelValues
 	if userID == "" {
 		return nil, fmt.Errorf("no userID")
 	}
+	if err := u.tenantAccessControl.checkQuery(userID); err != nil {
+		return nil, err
+	}
 
 	store := u.getStore(userID)
 	if store == nil {
@@ -464,6 +500,13 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 		WithIndexCache(u.indexCache),
 		WithQueryGate(u.queryGate),
 		WithChunkPool(u.chunksPool),
+		WithIndexHeaderLRU(u.indexHeaderLRU),
+	}
+	if u.prewarmCache != nil {
+		bucketStoreOpts = append(bucketStoreOpts, WithBlockPrewarmCache(u.prewarmCache))
+	}
+	if u.perBlockQueryTimeout > 0 {
+		bucketStoreOpts = append(bucketStoreOpts, WithPerBlockQueryTimeout(u.perBlockQueryTimeout))
 	}
 	if u.logLevel.String() == "debug" {
 		bucketStoreOpts = append(bucketStoreOpts, WithDebugLogging())
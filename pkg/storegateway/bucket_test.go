@@ -39,7 +39,6 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/encoding"
-	"github.com/prometheus/prometheus/tsdb/hashcache"
 	"github.com/prometheus/prometheus/tsdb/wal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1047,7 +1046,7 @@ func benchBucketSeries(t test.TB, skipChunk bool, samplesPerSeries, totalSeries
 		false,
 		false,
 		0,
-		hashcache.NewSeriesHashCache(1024*1024),
+		NewSeriesHashCache(1024*1024, nil),
 		NewBucketStoreMetrics(nil),
 		WithLogger(logger),
 		WithChunkPool(chunkPool),
@@ -1253,7 +1252,7 @@ func TestBucketSeries_OneBlock_InMemIndexCacheSegfault(t *testing.T) {
 		bkt:             objstore.WithNoopInstr(bkt),
 		logger:          logger,
 		indexCache:      indexCache,
-		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, indexheader.NewReaderPoolMetrics(nil)),
+		indexReaderPool: indexheader.NewReaderPool(log.NewNopLogger(), false, 0, nil, indexheader.NewReaderPoolMetrics(nil)),
 		metrics:         NewBucketStoreMetrics(nil),
 		blockSet:        &bucketBlockSet{blocks: [][]*bucketBlock{{b1, b2}}},
 		blocks: map[ulid.ULID]*bucketBlock{
@@ -1410,7 +1409,7 @@ func TestSeries_ErrorUnmarshallingRequestHints(t *testing.T) {
 		true,
 		false,
 		0,
-		hashcache.NewSeriesHashCache(1024*1024),
+		NewSeriesHashCache(1024*1024, nil),
 		NewBucketStoreMetrics(nil),
 		WithLogger(logger),
 		WithIndexCache(indexCache),
@@ -1501,7 +1500,7 @@ func TestSeries_BlockWithMultipleChunks(t *testing.T) {
 		true,
 		false,
 		0,
-		hashcache.NewSeriesHashCache(1024*1024),
+		NewSeriesHashCache(1024*1024, nil),
 		NewBucketStoreMetrics(nil),
 		WithLogger(logger),
 		WithIndexCache(indexCache),
@@ -1685,7 +1684,7 @@ func setupStoreForHintsTest(t *testing.T) (test.TB, *BucketStore, []*storepb.Ser
 		true,
 		false,
 		0,
-		hashcache.NewSeriesHashCache(1024*1024),
+		NewSeriesHashCache(1024*1024, nil),
 		NewBucketStoreMetrics(nil),
 		WithLogger(logger),
 		WithIndexCache(indexCache),
@@ -1994,7 +1993,7 @@ func benchmarkBlockSeriesWithConcurrency(b *testing.B, concurrency int, blockMet
 	seriesLimiter := NewSeriesLimiterFactory(0)(nil)
 
 	// Create the series hash cached used when query sharding is enabled.
-	seriesHashCache := hashcache.NewSeriesHashCache(1024 * 1024 * 1024).GetBlockCache(blockMeta.ULID.String())
+	seriesHashCache := NewSeriesHashCache(1024*1024*1024, nil).GetBlockCache(blockMeta.ULID.String())
 
 	// Run multiple workers to execute the queries.
 	wg := sync.WaitGroup{}
@@ -2098,7 +2097,7 @@ func TestBlockSeries_Cache(t *testing.T) {
 		b.indexCache = newInMemoryIndexCache(t)
 
 		sl := NewLimiter(math.MaxUint64, promauto.With(nil).NewCounter(prometheus.CounterOpts{Name: "test"}))
-		shc := hashcache.NewSeriesHashCache(1 << 20).GetBlockCache(b.meta.ULID.String())
+		shc := NewSeriesHashCache(1<<20, nil).GetBlockCache(b.meta.ULID.String())
 
 		testCases := []struct {
 			matchers         []*labels.Matcher
@@ -2416,7 +2415,7 @@ func TestFilterPostingsByCachedShardHash(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			cache := hashcache.NewSeriesHashCache(1024 * 1024).GetBlockCache("test")
+			cache := NewSeriesHashCache(1024*1024, nil).GetBlockCache("test")
 			for _, pair := range testData.cacheEntries {
 				cache.Store(storage.SeriesRef(pair[0]), pair[1])
 			}
@@ -2432,7 +2431,7 @@ func TestFilterPostingsByCachedShardHash_NoAllocations(t *testing.T) {
 	shard := &sharding.ShardSelector{ShardIndex: 0, ShardCount: 2}
 	cacheEntries := [][2]uint64{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 5}}
 
-	cache := hashcache.NewSeriesHashCache(1024 * 1024).GetBlockCache("test")
+	cache := NewSeriesHashCache(1024*1024, nil).GetBlockCache("test")
 	for _, pair := range cacheEntries {
 		cache.Store(storage.SeriesRef(pair[0]), pair[1])
 	}
@@ -2445,7 +2444,7 @@ func TestFilterPostingsByCachedShardHash_NoAllocations(t *testing.T) {
 func BenchmarkFilterPostingsByCachedShardHash_AllPostingsShifted(b *testing.B) {
 	// This benchmark tests the case only the 1st posting is removed
 	// and so all subsequent postings will be shifted.
-	cache := hashcache.NewSeriesHashCache(1024 * 1024).GetBlockCache("test")
+	cache := NewSeriesHashCache(1024*1024, nil).GetBlockCache("test")
 	cache.Store(0, 0)
 	shard := &sharding.ShardSelector{ShardIndex: 1, ShardCount: 2}
 
@@ -2471,7 +2470,7 @@ func BenchmarkFilterPostingsByCachedShardHash_AllPostingsShifted(b *testing.B) {
 
 func BenchmarkFilterPostingsByCachedShardHash_NoPostingsShifted(b *testing.B) {
 	// This benchmark tests the case the output postings is equal to the input one.
-	cache := hashcache.NewSeriesHashCache(1024 * 1024).GetBlockCache("test")
+	cache := NewSeriesHashCache(1024*1024, nil).GetBlockCache("test")
 	shard := &sharding.ShardSelector{ShardIndex: 1, ShardCount: 2}
 
 	// Create a long list of postings.
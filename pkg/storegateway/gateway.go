@@ -13,6 +13,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
@@ -45,17 +46,34 @@ const (
 
 var (
 	// Validation errors.
-	errInvalidTenantShardSize = errors.New("invalid tenant shard size, the value must be greater or equal to 0")
+	errInvalidTenantShardSize     = errors.New("invalid tenant shard size, the value must be greater or equal to 0")
+	errInvalidMaxIndexHeaderFiles = errors.New("invalid max index-header files, the value must be greater or equal to 0")
 )
 
 // Config holds the store gateway config.
 type Config struct {
 	ShardingRing RingConfig `yaml:"sharding_ring" doc:"description=The hash ring configuration."`
+
+	MaxIndexHeaderFiles int `yaml:"max_index_header_files" category:"experimental"`
+
+	PrewarmMatchers flagext.StringSlice `yaml:"prewarm_matchers" category:"experimental"`
+
+	SeriesHashCacheMaxBytes uint64 `yaml:"series_hash_cache_max_bytes" category:"experimental"`
+
+	PerBlockQueryTimeout time.Duration `yaml:"per_block_query_timeout" category:"experimental"`
+
+	AllowedTenantsFile string `yaml:"allowed_tenants" category:"experimental"`
 }
 
 // RegisterFlags registers the Config flags.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.ShardingRing.RegisterFlags(f, logger)
+
+	f.IntVar(&cfg.MaxIndexHeaderFiles, "store-gateway.max-index-header-files", 0, "Max number of index-header files the store-gateway keeps open at the same time, across all tenants. When the limit is reached, the least recently used index-headers are closed and will be re-opened on demand. This option is used only when index-header lazy loading is enabled. 0 to disable the limit.")
+	f.Var(&cfg.PrewarmMatchers, "store-gateway.prewarm-matchers", "Series selector, such as {__name__=\"up\",job=\"api\"}, whose postings are pre-fetched and stored in the index cache when a block is loaded, to reduce the latency of the first queries after a restart. This option can be set multiple times.")
+	f.Uint64Var(&cfg.SeriesHashCacheMaxBytes, "store-gateway.series-hash-cache-max-bytes", 0, "Max size - in bytes - of the in-memory series hash cache. The cache is shared across all tenants and it's used only when query sharding is enabled. The size of each entry accounts for both its key and value. When the limit is reached, the least recently used entries are evicted. 0 to use the deprecated -blocks-storage.bucket-store.series-hash-cache-max-size-bytes, which defaults to 1GiB.")
+	f.DurationVar(&cfg.PerBlockQueryTimeout, "store-gateway.per-block-query-timeout", 0, "Timeout for fetching the series of each block queried by a request. The blocks are queried concurrently, and the timeout is bounded by the request deadline. Blocks timing out are skipped and reported as a warning in the response, instead of failing the request, and are not reported as queried, so that the querier can retry them on another store-gateway. 0 to disable.")
+	f.StringVar(&cfg.AllowedTenantsFile, "store-gateway.allowed-tenants", "", "Path to a file containing the tenant IDs served by this store-gateway, one per line. The store-gateway doesn't load the blocks of the other tenants, even if they're owned by the store-gateway according to the sharding, and rejects their queries with a PermissionDenied gRPC error. Empty lines and lines starting with # are ignored. If empty, all tenants are served.")
 }
 
 // Validate the Config.
@@ -63,10 +81,25 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 	if limits.StoreGatewayTenantShardSize < 0 {
 		return errInvalidTenantShardSize
 	}
+	if cfg.MaxIndexHeaderFiles < 0 {
+		return errInvalidMaxIndexHeaderFiles
+	}
+	if _, err := parsePrewarmMatchers(cfg.PrewarmMatchers); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// seriesHashCacheMaxBytes returns the max size of the series hash cache. The store-gateway option takes
+// precedence whenever it's set, otherwise the deprecated bucket store option is used.
+func (cfg *Config) seriesHashCacheMaxBytes(bucketStoreCfg mimir_tsdb.BucketStoreConfig) uint64 {
+	if cfg.SeriesHashCacheMaxBytes > 0 {
+		return cfg.SeriesHashCacheMaxBytes
+	}
+	return bucketStoreCfg.SeriesHashCacheMaxBytes
+}
+
 // StoreGateway is the Mimir service responsible to expose an API over the bucket
 // where blocks are stored, supporting blocks sharding and replication across a pool
 // of store gateway instances (optional).
@@ -158,7 +191,7 @@ func newStoreGateway(gatewayCfg Config, storageCfg mimir_tsdb.BlocksStorageConfi
 
 	shardingStrategy = NewShuffleShardingStrategy(g.ring, lifecyclerCfg.ID, lifecyclerCfg.Addr, limits, logger)
 
-	g.stores, err = NewBucketStores(storageCfg, shardingStrategy, bucketClient, limits, logLevel, logger, extprom.WrapRegistererWith(prometheus.Labels{"component": "store-gateway"}, reg))
+	g.stores, err = NewBucketStores(storageCfg, gatewayCfg, shardingStrategy, bucketClient, limits, logLevel, logger, extprom.WrapRegistererWith(prometheus.Labels{"component": "store-gateway"}, reg))
 	if err != nil {
 		return nil, errors.Wrap(err, "create bucket stores")
 	}
@@ -184,7 +217,12 @@ func (g *StoreGateway) starting(ctx context.Context) (err error) {
 
 	// First of all we register the instance in the ring and wait
 	// until the lifecycler successfully started.
-	if g.subservices, err = services.NewManager(g.ringLifecycler, g.ring); err != nil {
+	deps := []services.Service{g.ringLifecycler, g.ring}
+	if g.stores.prewarmCache != nil {
+		deps = append(deps, g.stores.prewarmCache)
+	}
+
+	if g.subservices, err = services.NewManager(deps...); err != nil {
 		return errors.Wrap(err, "unable to start store-gateway dependencies")
 	}
 
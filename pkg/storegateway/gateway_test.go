@@ -91,6 +91,24 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestConfig_SeriesHashCacheMaxBytes(t *testing.T) {
+	cfg := Config{}
+	flagext.DefaultValues(&cfg)
+	storageCfg := mimir_tsdb.BlocksStorageConfig{}
+	flagext.DefaultValues(&storageCfg)
+
+	// The deprecated bucket store option default should be used when none is set.
+	assert.Equal(t, uint64(1024*1024*1024), cfg.seriesHashCacheMaxBytes(storageCfg.BucketStore))
+
+	// The deprecated bucket store option should be honored once set.
+	storageCfg.BucketStore.SeriesHashCacheMaxBytes = 100
+	assert.Equal(t, uint64(100), cfg.seriesHashCacheMaxBytes(storageCfg.BucketStore))
+
+	// The store-gateway option should take precedence once set.
+	cfg.SeriesHashCacheMaxBytes = 200
+	assert.Equal(t, uint64(200), cfg.seriesHashCacheMaxBytes(storageCfg.BucketStore))
+}
+
 func TestStoreGateway_InitialSyncWithDefaultShardingEnabled(t *testing.T) {
 	test.VerifyNoLeak(t)
 
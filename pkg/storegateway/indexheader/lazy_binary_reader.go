@@ -80,6 +80,9 @@ type LazyBinaryReader struct {
 	metrics                     *LazyBinaryReaderMetrics
 	onClosed                    func(*LazyBinaryReader)
 
+	// Optional LRU notified when the index-header is loaded and unloaded.
+	lru *ReaderLRU
+
 	readerMx  sync.RWMutex
 	reader    *BinaryReader
 	readerErr error
@@ -156,7 +159,7 @@ func (r *LazyBinaryReader) IndexVersion() (int, error) {
 		return 0, err
 	}
 
-	r.usedAt.Store(time.Now().UnixNano())
+	r.markUsed()
 	return r.reader.IndexVersion()
 }
 
@@ -169,7 +172,7 @@ func (r *LazyBinaryReader) PostingsOffset(name, value string) (index.Range, erro
 		return index.Range{}, err
 	}
 
-	r.usedAt.Store(time.Now().UnixNano())
+	r.markUsed()
 	return r.reader.PostingsOffset(name, value)
 }
 
@@ -182,7 +185,7 @@ func (r *LazyBinaryReader) LookupSymbol(o uint32) (string, error) {
 		return "", err
 	}
 
-	r.usedAt.Store(time.Now().UnixNano())
+	r.markUsed()
 	return r.reader.LookupSymbol(o)
 }
 
@@ -195,7 +198,7 @@ func (r *LazyBinaryReader) LabelValues(name string) ([]string, error) {
 		return nil, err
 	}
 
-	r.usedAt.Store(time.Now().UnixNano())
+	r.markUsed()
 	return r.reader.LabelValues(name)
 }
 
@@ -208,7 +211,7 @@ func (r *LazyBinaryReader) LabelNames() ([]string, error) {
 		return nil, err
 	}
 
-	r.usedAt.Store(time.Now().UnixNano())
+	r.markUsed()
 	return r.reader.LabelNames()
 }
 
@@ -261,9 +264,21 @@ func (r *LazyBinaryReader) load() (returnErr error) {
 	level.Debug(r.logger).Log("msg", "lazy loaded index-header file", "path", r.filepath, "elapsed", time.Since(startTime))
 	r.metrics.loadDuration.Observe(time.Since(startTime).Seconds())
 
+	if r.lru != nil {
+		r.lru.onLoaded(r)
+	}
+
 	return nil
 }
 
+// markUsed updates the last usage time of the reader, and moves it to the front of the LRU.
+func (r *LazyBinaryReader) markUsed() {
+	r.usedAt.Store(time.Now().UnixNano())
+	if r.lru != nil {
+		r.lru.touch(r)
+	}
+}
+
 // unloadIfIdleSince closes underlying BinaryReader if the reader is idle since given time (as unix nano). If idleSince is 0,
 // the check on the last usage is skipped. Calling this function on a already unloaded reader is a no-op.
 func (r *LazyBinaryReader) unloadIfIdleSince(ts int64) error {
@@ -280,6 +295,32 @@ func (r *LazyBinaryReader) unloadIfIdleSince(ts int64) error {
 		return errNotIdle
 	}
 
+	return r.unload()
+}
+
+// unloadIfNotInUse closes underlying BinaryReader if the reader is not currently in use by any
+// Reader function call. Returns true if the reader has been unloaded. Calling this function on an
+// already unloaded reader is a no-op.
+func (r *LazyBinaryReader) unloadIfNotInUse() (bool, error) {
+	if !r.readerMx.TryLock() {
+		return false, nil
+	}
+	defer r.readerMx.Unlock()
+
+	// Nothing to do if already unloaded.
+	if r.reader == nil {
+		return false, nil
+	}
+
+	if err := r.unload(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unload closes underlying BinaryReader. This function MUST be called with the write lock already
+// acquired and a loaded reader.
+func (r *LazyBinaryReader) unload() error {
 	r.metrics.unloadCount.Inc()
 	if err := r.reader.Close(); err != nil {
 		r.metrics.unloadFailedCount.Inc()
@@ -287,6 +328,11 @@ func (r *LazyBinaryReader) unloadIfIdleSince(ts int64) error {
 	}
 
 	r.reader = nil
+
+	if r.lru != nil {
+		r.lru.onUnloaded(r)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexheader
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ReaderLRU keeps track of the lazy readers which currently have their index-header file
+// loaded (open) and, once the number of loaded readers exceeds the configured max, unloads
+// the least recently used ones. An unloaded lazy reader is automatically re-opened upon next
+// usage. A single ReaderLRU can be shared across multiple ReaderPool instances.
+type ReaderLRU struct {
+	maxLoaded int
+	logger    log.Logger
+
+	// loaded maps each loaded reader to its element in the recency list, which is sorted
+	// from the most (front) to the least (back) recently used reader.
+	loadedMx sync.Mutex
+	loaded   map[*LazyBinaryReader]*list.Element
+	recency  *list.List
+
+	opens  prometheus.Counter
+	closes prometheus.Counter
+}
+
+// NewReaderLRU makes a new ReaderLRU. If maxLoaded is <= 0, the number of loaded readers is
+// not limited but opens and closes are still tracked.
+func NewReaderLRU(maxLoaded int, logger log.Logger, reg prometheus.Registerer) *ReaderLRU {
+	return &ReaderLRU{
+		maxLoaded: maxLoaded,
+		logger:    logger,
+		loaded:    map[*LazyBinaryReader]*list.Element{},
+		recency:   list.New(),
+		opens: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_storegateway_index_header_opens_total",
+			Help: "Total number of index-header files opened by the store-gateway.",
+		}),
+		closes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_storegateway_index_header_closes_total",
+			Help: "Total number of index-header files closed by the store-gateway, including the ones closed because the max number of open index-header files has been reached.",
+		}),
+	}
+}
+
+// onLoaded is called by a lazy reader once it has loaded its index-header file. This function is
+// called with the reader's lock held, so it must not try to lock the reader itself.
+func (l *ReaderLRU) onLoaded(r *LazyBinaryReader) {
+	l.opens.Inc()
+
+	// The reader has just been loaded to be used, so it's the most recently used one.
+	r.usedAt.Store(time.Now().UnixNano())
+
+	l.loadedMx.Lock()
+	if elem, ok := l.loaded[r]; ok {
+		l.recency.MoveToFront(elem)
+	} else {
+		l.loaded[r] = l.recency.PushFront(r)
+	}
+	candidates := l.evictionCandidates()
+	l.loadedMx.Unlock()
+
+	// The eviction is done without holding the LRU lock, because unloading a reader
+	// calls back onUnloaded().
+	for _, c := range candidates {
+		if l.numLoaded() <= l.maxLoaded {
+			return
+		}
+
+		if unloaded, err := c.unloadIfNotInUse(); err != nil {
+			level.Warn(l.logger).Log("msg", "failed to close least recently used index-header reader", "path", c.filepath, "err", err)
+		} else if unloaded {
+			level.Debug(l.logger).Log("msg", "closed least recently used index-header reader because the max number of open index-header files has been reached", "path", c.filepath)
+		}
+	}
+}
+
+// onUnloaded is called by a lazy reader once it has unloaded its index-header file.
+func (l *ReaderLRU) onUnloaded(r *LazyBinaryReader) {
+	l.closes.Inc()
+
+	l.loadedMx.Lock()
+	if elem, ok := l.loaded[r]; ok {
+		l.recency.Remove(elem)
+		delete(l.loaded, r)
+	}
+	l.loadedMx.Unlock()
+}
+
+// touch marks the input reader as the most recently used one. It's a no-op if the reader is not loaded.
+func (l *ReaderLRU) touch(r *LazyBinaryReader) {
+	l.loadedMx.Lock()
+	if elem, ok := l.loaded[r]; ok {
+		l.recency.MoveToFront(elem)
+	}
+	l.loadedMx.Unlock()
+}
+
+// evictionCandidates returns the least recently used readers exceeding the limit, sorted from the least
+// to the most recently used. The most recently used reader is never a candidate. Candidates in use are
+// skipped by the caller, and the limit is enforced again the next time a reader is loaded.
+// This function MUST be called with the loadedMx lock held.
+func (l *ReaderLRU) evictionCandidates() []*LazyBinaryReader {
+	if l.maxLoaded <= 0 || len(l.loaded) <= l.maxLoaded {
+		return nil
+	}
+
+	candidates := make([]*LazyBinaryReader, 0, len(l.loaded)-l.maxLoaded)
+	for elem := l.recency.Back(); elem != nil && elem != l.recency.Front() && len(candidates) < cap(candidates); elem = elem.Prev() {
+		candidates = append(candidates, elem.Value.(*LazyBinaryReader))
+	}
+
+	return candidates
+}
+
+// IsFull returns whether the max number of loaded readers has been reached, so that loading
+// another reader would unload the least recently used one.
+func (l *ReaderLRU) IsFull() bool {
+	return l.maxLoaded > 0 && l.numLoaded() >= l.maxLoaded
+}
+
+func (l *ReaderLRU) numLoaded() int {
+	l.loadedMx.Lock()
+	defer l.loadedMx.Unlock()
+
+	return len(l.loaded)
+}
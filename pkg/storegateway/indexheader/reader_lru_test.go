@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package indexheader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storegateway/testhelper"
+)
+
+func TestReaderLRU_ShouldCloseLeastRecentlyUsedReaders(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := os.MkdirTemp("", "test-indexheader")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, bkt.Close()) }()
+
+	// Create blocks.
+	firstBlockID, err := testhelper.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+		{{Name: "a", Value: "2"}},
+	}, 100, 0, 1000, labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+	require.NoError(t, err)
+	require.NoError(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, firstBlockID.String()), metadata.NoneFunc))
+
+	secondBlockID, err := testhelper.CreateBlock(ctx, tmpDir, []labels.Labels{
+		{{Name: "b", Value: "1"}},
+		{{Name: "b", Value: "2"}},
+	}, 100, 1000, 2000, labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+	require.NoError(t, err)
+	require.NoError(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, secondBlockID.String()), metadata.NoneFunc))
+
+	reg := prometheus.NewPedanticRegistry()
+	lru := NewReaderLRU(1, log.NewNopLogger(), reg)
+	pool := NewReaderPool(log.NewNopLogger(), true, 0, lru, NewReaderPoolMetrics(nil))
+	defer pool.Close()
+
+	first, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, firstBlockID, 3, BinaryReaderConfig{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, first.Close()) }()
+
+	second, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, secondBlockID, 3, BinaryReaderConfig{})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, second.Close()) }()
+
+	// Readers are lazy, so nothing has been opened yet.
+	require.Equal(t, 0, lru.numLoaded())
+	require.False(t, lru.IsFull())
+
+	labelNames, err := first.LabelNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, labelNames)
+	require.True(t, isLoaded(first.(*LazyBinaryReader)))
+	require.Equal(t, 1, lru.numLoaded())
+	require.True(t, lru.IsFull())
+
+	// Opening the second reader should close the first one.
+	labelNames, err = second.LabelNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, labelNames)
+	require.False(t, isLoaded(first.(*LazyBinaryReader)))
+	require.True(t, isLoaded(second.(*LazyBinaryReader)))
+	require.Equal(t, 1, lru.numLoaded())
+
+	// The first reader should be re-opened on demand, closing the second one.
+	labelNames, err = first.LabelNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, labelNames)
+	require.True(t, isLoaded(first.(*LazyBinaryReader)))
+	require.False(t, isLoaded(second.(*LazyBinaryReader)))
+	require.Equal(t, 1, lru.numLoaded())
+
+	require.Equal(t, float64(3), promtestutil.ToFloat64(lru.opens))
+	require.Equal(t, float64(2), promtestutil.ToFloat64(lru.closes))
+
+	// An explicit call to Close() should release the reader from the LRU too.
+	require.NoError(t, first.Close())
+	require.Equal(t, 0, lru.numLoaded())
+	require.Equal(t, float64(3), promtestutil.ToFloat64(lru.opens))
+	require.Equal(t, float64(3), promtestutil.ToFloat64(lru.closes))
+}
+
+func TestReaderLRU_ShouldKeepRecentlyUsedReadersLoaded(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := os.MkdirTemp("", "test-indexheader")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, bkt.Close()) }()
+
+	lru := NewReaderLRU(2, log.NewNopLogger(), nil)
+	pool := NewReaderPool(log.NewNopLogger(), true, 0, lru, NewReaderPoolMetrics(nil))
+	defer pool.Close()
+
+	var readers []*LazyBinaryReader
+	for i := 0; i < 3; i++ {
+		blockID, err := testhelper.CreateBlock(ctx, tmpDir, []labels.Labels{
+			{{Name: "a", Value: "1"}},
+		}, 100, int64(i*1000), int64((i+1)*1000), labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+		require.NoError(t, err)
+		require.NoError(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+
+		r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3, BinaryReaderConfig{})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, r.Close()) }()
+		readers = append(readers, r.(*LazyBinaryReader))
+	}
+
+	// Load the first two readers, then use the first one again.
+	for _, r := range []*LazyBinaryReader{readers[0], readers[1], readers[0]} {
+		_, err := r.LabelNames()
+		require.NoError(t, err)
+	}
+
+	// Loading the third reader should close the second one, which is the least recently used.
+	_, err = readers[2].LabelNames()
+	require.NoError(t, err)
+	require.True(t, isLoaded(readers[0]))
+	require.False(t, isLoaded(readers[1]))
+	require.True(t, isLoaded(readers[2]))
+	require.Equal(t, 2, lru.numLoaded())
+}
+
+func TestReaderLRU_ShouldNotLimitLoadedReadersIfMaxIsZero(t *testing.T) {
+	ctx := context.Background()
+
+	tmpDir, err := os.MkdirTemp("", "test-indexheader")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(tmpDir)) }()
+
+	bkt, err := filesystem.NewBucket(filepath.Join(tmpDir, "bkt"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, bkt.Close()) }()
+
+	lru := NewReaderLRU(0, log.NewNopLogger(), nil)
+	pool := NewReaderPool(log.NewNopLogger(), true, 0, lru, NewReaderPoolMetrics(nil))
+	defer pool.Close()
+
+	var readers []Reader
+	for i := 0; i < 3; i++ {
+		blockID, err := testhelper.CreateBlock(ctx, tmpDir, []labels.Labels{
+			{{Name: "a", Value: "1"}},
+		}, 100, int64(i*1000), int64((i+1)*1000), labels.Labels{{Name: "ext1", Value: "1"}}, 124, metadata.NoneFunc)
+		require.NoError(t, err)
+		require.NoError(t, block.Upload(ctx, log.NewNopLogger(), bkt, filepath.Join(tmpDir, blockID.String()), metadata.NoneFunc))
+
+		r, err := pool.NewBinaryReader(ctx, log.NewNopLogger(), bkt, tmpDir, blockID, 3, BinaryReaderConfig{})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, r.Close()) }()
+
+		_, err = r.LabelNames()
+		require.NoError(t, err)
+		readers = append(readers, r)
+	}
+
+	for _, r := range readers {
+		require.True(t, isLoaded(r.(*LazyBinaryReader)))
+	}
+	require.Equal(t, 3, lru.numLoaded())
+	require.Equal(t, float64(3), promtestutil.ToFloat64(lru.opens))
+	require.Equal(t, float64(0), promtestutil.ToFloat64(lru.closes))
+}
+
+func isLoaded(r *LazyBinaryReader) bool {
+	r.readerMx.RLock()
+	defer r.readerMx.RUnlock()
+
+	return r.reader != nil
+}
@@ -41,6 +41,9 @@ type ReaderPool struct {
 	logger                log.Logger
 	metrics               *ReaderPoolMetrics
 
+	// Optional LRU used to limit the number of loaded lazy readers.
+	lru *ReaderLRU
+
 	// Channel used to signal once the pool is closing.
 	close chan struct{}
 
@@ -49,11 +52,13 @@ type ReaderPool struct {
 	lazyReaders   map[*LazyBinaryReader]struct{}
 }
 
-// NewReaderPool makes a new ReaderPool.
-func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, metrics *ReaderPoolMetrics) *ReaderPool {
+// NewReaderPool makes a new ReaderPool. The input lru is optional and, if not nil, it's used
+// to limit the number of lazy readers having the index-header loaded at the same time.
+func NewReaderPool(logger log.Logger, lazyReaderEnabled bool, lazyReaderIdleTimeout time.Duration, lru *ReaderLRU, metrics *ReaderPoolMetrics) *ReaderPool {
 	p := &ReaderPool{
 		logger:                logger,
 		metrics:               metrics,
+		lru:                   lru,
 		lazyReaderEnabled:     lazyReaderEnabled,
 		lazyReaderIdleTimeout: lazyReaderIdleTimeout,
 		lazyReaders:           make(map[*LazyBinaryReader]struct{}),
@@ -87,7 +92,12 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	var err error
 
 	if p.lazyReaderEnabled {
-		reader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, cfg, p.metrics.lazyReader, p.onLazyReaderClosed)
+		var lazyReader *LazyBinaryReader
+		lazyReader, err = NewLazyBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, cfg, p.metrics.lazyReader, p.onLazyReaderClosed)
+		if err == nil {
+			lazyReader.lru = p.lru
+			reader = lazyReader
+		}
 	} else {
 		reader, err = NewBinaryReader(ctx, logger, bkt, dir, id, postingOffsetsInMemSampling, cfg)
 	}
@@ -106,6 +116,11 @@ func (p *ReaderPool) NewBinaryReader(ctx context.Context, logger log.Logger, bkt
 	return reader, err
 }
 
+// LazyReaderEnabled returns whether the readers created by this pool lazy load the index-header.
+func (p *ReaderPool) LazyReaderEnabled() bool {
+	return p.lazyReaderEnabled
+}
+
 // Close the pool and stop checking for idle readers. No reader tracked by this pool
 // will be closed. It's the caller responsibility to close readers.
 func (p *ReaderPool) Close() {
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/storage"
+)
+
+const (
+	// seriesHashCacheStringHeaderSize is the size of the header of the block ID string in the cache key.
+	seriesHashCacheStringHeaderSize = 16
+
+	// seriesHashCacheEntryOverheadBytes is the approximate memory footprint of each cache entry, besides
+	// its key and value: the LRU list pointers, the map slot and the pointer to the entry.
+	seriesHashCacheEntryOverheadBytes = 64
+
+	// seriesHashCacheMinShardSizeBytes is the min max size of each shard of the cache.
+	seriesHashCacheMinShardSizeBytes = 1024 * 1024
+
+	// seriesHashCacheMaxShards is the max number of shards of the cache.
+	seriesHashCacheMaxShards = 64
+)
+
+type seriesHashCacheKey struct {
+	blockID  string
+	seriesID storage.SeriesRef
+}
+
+// size returns the number of bytes of the key.
+func (k seriesHashCacheKey) size() uint64 {
+	return seriesHashCacheStringHeaderSize + uint64(len(k.blockID)) + 8
+}
+
+// SeriesHashCache is a LRU cache mapping the per-block series ID with its labels hash. The cache evicts
+// the least recently used entries once the total byte footprint of its entries exceeds the max size.
+// The entries are split among shards, each one with its own lock and an equal share of the max size,
+// to reduce the lock contention between concurrent queries.
+type SeriesHashCache struct {
+	maxSizeBytes uint64
+	shards       []*seriesHashCacheShard
+
+	evicted prometheus.Counter
+}
+
+// seriesHashCacheShard is a LRU cache holding a subset of the SeriesHashCache entries. The entries are
+// kept in a doubly linked list, from the most to the least recently used, not boxed into interfaces
+// so that looking up an entry doesn't allocate.
+type seriesHashCacheShard struct {
+	maxSizeBytes uint64
+	evicted      prometheus.Counter
+
+	mtx     sync.Mutex
+	entries map[seriesHashCacheKey]*seriesHashCacheEntry
+	head    *seriesHashCacheEntry // Most recently used entry.
+	tail    *seriesHashCacheEntry // Least recently used entry.
+	curSize uint64
+}
+
+type seriesHashCacheEntry struct {
+	key        seriesHashCacheKey
+	hash       uint64
+	prev, next *seriesHashCacheEntry
+}
+
+// NewSeriesHashCache makes a new SeriesHashCache holding up to maxSizeBytes.
+func NewSeriesHashCache(maxSizeBytes uint64, reg prometheus.Registerer) *SeriesHashCache {
+	c := &SeriesHashCache{
+		maxSizeBytes: maxSizeBytes,
+		evicted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_store_series_hash_cache_evicted_total",
+			Help: "Total number of entries evicted from the in-memory series hash cache.",
+		}),
+	}
+
+	// Small caches are not sharded, so that each shard can hold a meaningful number of entries.
+	numShards := maxSizeBytes / seriesHashCacheMinShardSizeBytes
+	if numShards < 1 {
+		numShards = 1
+	} else if numShards > seriesHashCacheMaxShards {
+		numShards = seriesHashCacheMaxShards
+	}
+
+	c.shards = make([]*seriesHashCacheShard, numShards)
+	for i := range c.shards {
+		c.shards[i] = &seriesHashCacheShard{
+			maxSizeBytes: maxSizeBytes / numShards,
+			evicted:      c.evicted,
+			entries:      map[seriesHashCacheKey]*seriesHashCacheEntry{},
+		}
+	}
+
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_bucket_store_series_hash_cache_items",
+		Help: "Current number of entries in the in-memory series hash cache.",
+	}, func() float64 {
+		items, _ := c.stats()
+		return float64(items)
+	})
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_bucket_store_series_hash_cache_size_bytes",
+		Help: "Current byte size of the entries (both key and value) in the in-memory series hash cache.",
+	}, func() float64 {
+		_, size := c.stats()
+		return float64(size)
+	})
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_bucket_store_series_hash_cache_max_size_bytes",
+		Help: "Maximum number of bytes to be held in the in-memory series hash cache.",
+	}, func() float64 {
+		return float64(c.maxSizeBytes)
+	})
+
+	return c
+}
+
+// GetBlockCache returns a reference to the series hash cache for the provided blockID.
+func (c *SeriesHashCache) GetBlockCache(blockID string) *BlockSeriesHashCache {
+	return &BlockSeriesHashCache{cache: c, blockID: blockID, blockIDHash: xxhash.Sum64String(blockID)}
+}
+
+// shard returns the shard holding the entry of the input series of the block.
+func (c *SeriesHashCache) shard(blockIDHash uint64, seriesID storage.SeriesRef) *seriesHashCacheShard {
+	return c.shards[(blockIDHash^uint64(seriesID))%uint64(len(c.shards))]
+}
+
+// stats returns the number of entries and their total byte size.
+func (c *SeriesHashCache) stats() (items int, size uint64) {
+	for _, shard := range c.shards {
+		shard.mtx.Lock()
+		items += len(shard.entries)
+		size += shard.curSize
+		shard.mtx.Unlock()
+	}
+	return items, size
+}
+
+func (c *seriesHashCacheShard) fetch(key seriesHashCacheKey) (uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	c.moveToFront(entry)
+	return entry.hash, true
+}
+
+func (c *seriesHashCacheShard) store(key seriesHashCacheKey, hash uint64) {
+	size := seriesHashCacheEntrySize(key)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if size > c.maxSizeBytes {
+		return
+	}
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+
+	for c.tail != nil && c.curSize+size > c.maxSizeBytes {
+		c.evictOldest()
+	}
+
+	entry := &seriesHashCacheEntry{key: key, hash: hash}
+	c.entries[key] = entry
+	c.pushFront(entry)
+	c.curSize += size
+}
+
+// evictOldest removes the least recently used entry. The caller must hold the lock.
+func (c *seriesHashCacheShard) evictOldest() {
+	entry := c.tail
+	c.unlink(entry)
+	delete(c.entries, entry.key)
+	c.curSize -= seriesHashCacheEntrySize(entry.key)
+	c.evicted.Inc()
+}
+
+func (c *seriesHashCacheShard) moveToFront(entry *seriesHashCacheEntry) {
+	if c.head == entry {
+		return
+	}
+	c.unlink(entry)
+	c.pushFront(entry)
+}
+
+func (c *seriesHashCacheShard) pushFront(entry *seriesHashCacheEntry) {
+	entry.prev = nil
+	entry.next = c.head
+	if c.head != nil {
+		c.head.prev = entry
+	}
+	c.head = entry
+	if c.tail == nil {
+		c.tail = entry
+	}
+}
+
+func (c *seriesHashCacheShard) unlink(entry *seriesHashCacheEntry) {
+	if entry.prev != nil {
+		entry.prev.next = entry.next
+	} else {
+		c.head = entry.next
+	}
+	if entry.next != nil {
+		entry.next.prev = entry.prev
+	} else {
+		c.tail = entry.prev
+	}
+	entry.prev, entry.next = nil, nil
+}
+
+// seriesHashCacheEntrySize returns the approximate byte footprint of the cache entry with the input key.
+func seriesHashCacheEntrySize(key seriesHashCacheKey) uint64 {
+	const valueSize = 8
+	return key.size() + valueSize + seriesHashCacheEntryOverheadBytes
+}
+
+// BlockSeriesHashCache is the view of a SeriesHashCache bounded to a single block.
+type BlockSeriesHashCache struct {
+	cache       *SeriesHashCache
+	blockID     string
+	blockIDHash uint64
+}
+
+// Fetch the hash of the given seriesID from the cache and returns a boolean
+// whether the series was found in the cache or not.
+func (c *BlockSeriesHashCache) Fetch(seriesID storage.SeriesRef) (uint64, bool) {
+	return c.cache.shard(c.blockIDHash, seriesID).fetch(seriesHashCacheKey{blockID: c.blockID, seriesID: seriesID})
+}
+
+// Store the hash of the given seriesID in the cache.
+func (c *BlockSeriesHashCache) Store(seriesID storage.SeriesRef, hash uint64) {
+	c.cache.shard(c.blockIDHash, seriesID).store(seriesHashCacheKey{blockID: c.blockID, seriesID: seriesID}, hash)
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesHashCache_FetchAndStore(t *testing.T) {
+	cache := NewSeriesHashCache(1024*1024, nil)
+	blockA := cache.GetBlockCache("block-a")
+	blockB := cache.GetBlockCache("block-b")
+
+	_, ok := blockA.Fetch(1)
+	assert.False(t, ok)
+
+	blockA.Store(1, 100)
+	blockB.Store(1, 200)
+
+	hash, ok := blockA.Fetch(1)
+	require.True(t, ok)
+	assert.Equal(t, uint64(100), hash)
+
+	hash, ok = blockB.Fetch(1)
+	require.True(t, ok)
+	assert.Equal(t, uint64(200), hash)
+
+	_, ok = blockA.Fetch(2)
+	assert.False(t, ok)
+}
+
+func TestSeriesHashCache_ShouldAccountBothKeyAndValueSize(t *testing.T) {
+	const blockID = "01GC9F7EDRKBDKW0HQGDCHCPQK"
+
+	reg := prometheus.NewPedanticRegistry()
+	cache := NewSeriesHashCache(1024*1024, reg)
+	block := cache.GetBlockCache(blockID)
+
+	block.Store(1, 100)
+	block.Store(2, 200)
+
+	// Storing an entry already in the cache should not change the size.
+	block.Store(2, 200)
+
+	// Each entry is 122 bytes: 16 (string header) + 26 (block ID) + 8 (series ID) + 8 (hash) + 64 (overhead).
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_bucket_store_series_hash_cache_items Current number of entries in the in-memory series hash cache.
+		# TYPE cortex_bucket_store_series_hash_cache_items gauge
+		cortex_bucket_store_series_hash_cache_items 2
+
+		# HELP cortex_bucket_store_series_hash_cache_size_bytes Current byte size of the entries (both key and value) in the in-memory series hash cache.
+		# TYPE cortex_bucket_store_series_hash_cache_size_bytes gauge
+		cortex_bucket_store_series_hash_cache_size_bytes 244
+
+		# HELP cortex_bucket_store_series_hash_cache_max_size_bytes Maximum number of bytes to be held in the in-memory series hash cache.
+		# TYPE cortex_bucket_store_series_hash_cache_max_size_bytes gauge
+		cortex_bucket_store_series_hash_cache_max_size_bytes 1.048576e+06
+
+		# HELP cortex_bucket_store_series_hash_cache_evicted_total Total number of entries evicted from the in-memory series hash cache.
+		# TYPE cortex_bucket_store_series_hash_cache_evicted_total counter
+		cortex_bucket_store_series_hash_cache_evicted_total 0
+	`)))
+}
+
+func TestSeriesHashCache_ShouldEvictLeastRecentlyUsedEntries(t *testing.T) {
+	const blockID = "block"
+	entrySize := seriesHashCacheEntrySize(seriesHashCacheKey{blockID: blockID})
+
+	// The cache can hold up to 3 entries.
+	cache := NewSeriesHashCache(3*entrySize+entrySize/2, nil)
+	block := cache.GetBlockCache(blockID)
+
+	block.Store(1, 100)
+	block.Store(2, 200)
+	block.Store(3, 300)
+
+	// Fetch the 1st entry, so that the 2nd one becomes the least recently used.
+	_, ok := block.Fetch(1)
+	require.True(t, ok)
+
+	block.Store(4, 400)
+
+	_, ok = block.Fetch(2)
+	assert.False(t, ok)
+
+	for _, seriesID := range []storage.SeriesRef{1, 3, 4} {
+		hash, ok := block.Fetch(seriesID)
+		require.True(t, ok)
+		assert.Equal(t, uint64(seriesID)*100, hash)
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(cache.evicted))
+	_, size := cache.stats()
+	assert.Equal(t, 3*entrySize, size)
+}
+
+func TestSeriesHashCache_FetchShouldNotAllocate(t *testing.T) {
+	cache := NewSeriesHashCache(1024*1024, nil)
+	block := cache.GetBlockCache("block")
+	block.Store(1, 100)
+	block.Store(2, 200)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		block.Fetch(1)
+		block.Fetch(2)
+		block.Fetch(3)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestSeriesHashCache_ShouldNotStoreEntriesLargerThanMaxSize(t *testing.T) {
+	cache := NewSeriesHashCache(10, nil)
+	block := cache.GetBlockCache("block")
+
+	block.Store(1, 100)
+
+	_, ok := block.Fetch(1)
+	assert.False(t, ok)
+	_, size := cache.stats()
+	assert.Equal(t, uint64(0), size)
+	assert.Equal(t, float64(0), testutil.ToFloat64(cache.evicted))
+}
+
+func TestSeriesHashCache_ShouldShardLargeCaches(t *testing.T) {
+	tests := map[string]struct {
+		maxSizeBytes   uint64
+		expectedShards int
+	}{
+		"small cache": {
+			maxSizeBytes:   seriesHashCacheMinShardSizeBytes - 1,
+			expectedShards: 1,
+		},
+		"medium cache": {
+			maxSizeBytes:   10 * seriesHashCacheMinShardSizeBytes,
+			expectedShards: 10,
+		},
+		"large cache": {
+			maxSizeBytes:   1024 * seriesHashCacheMinShardSizeBytes,
+			expectedShards: seriesHashCacheMaxShards,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cache := NewSeriesHashCache(testData.maxSizeBytes, nil)
+			require.Len(t, cache.shards, testData.expectedShards)
+
+			// The entries should be spread among the shards.
+			block := cache.GetBlockCache("block")
+			for seriesID := storage.SeriesRef(0); seriesID < 1000; seriesID++ {
+				block.Store(seriesID, uint64(seriesID))
+			}
+
+			items, _ := cache.stats()
+			assert.Equal(t, 1000, items)
+			for _, shard := range cache.shards {
+				assert.NotZero(t, len(shard.entries))
+				assert.LessOrEqual(t, shard.curSize, testData.maxSizeBytes/uint64(testData.expectedShards))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// TenantAccessControl restricts the tenants served by a store-gateway. The store-gateway doesn't load the blocks
+// of the tenants not allowed, even if they're owned by the store-gateway according to the sharding, and rejects
+// their queries.
+type TenantAccessControl struct {
+	allowed *util.AllowedTenants
+}
+
+// NewTenantAccessControl makes a new TenantAccessControl allowing the tenants listed in the input file, one
+// tenant ID per line. Empty lines and lines starting with "#" are ignored. All tenants are allowed if the
+// input path is empty.
+func NewTenantAccessControl(path string) (*TenantAccessControl, error) {
+	if path == "" {
+		return &TenantAccessControl{}, nil
+	}
+
+	tenants, err := readAllowedTenantsFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read allowed tenants file %s", path)
+	}
+	if len(tenants) == 0 {
+		// An empty list would allow all tenants, which is unlikely to be the intended behaviour.
+		return nil, errors.Errorf("the allowed tenants file %s contains no tenants", path)
+	}
+
+	return &TenantAccessControl{allowed: util.NewAllowedTenants(tenants, nil)}, nil
+}
+
+// IsAllowed returns whether the store-gateway serves the input tenant.
+func (a *TenantAccessControl) IsAllowed(userID string) bool {
+	return a.allowed.IsAllowed(userID)
+}
+
+// FilterUsers returns the input tenants which are allowed.
+func (a *TenantAccessControl) FilterUsers(userIDs []string) []string {
+	if a.allowed == nil {
+		return userIDs
+	}
+
+	filtered := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if a.IsAllowed(userID) {
+			filtered = append(filtered, userID)
+		}
+	}
+	return filtered
+}
+
+// checkQuery returns a gRPC PermissionDenied error if the input tenant is not allowed to query the store-gateway.
+func (a *TenantAccessControl) checkQuery(userID string) error {
+	if a.IsAllowed(userID) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "tenant %s is not allowed to query this store-gateway", userID)
+}
+
+func readAllowedTenantsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tenants []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tenants = append(tenants, line)
+	}
+	return tenants, scanner.Err()
+}
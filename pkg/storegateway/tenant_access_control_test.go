@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package storegateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewTenantAccessControl(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "allowed-tenants")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o666))
+		return path
+	}
+
+	t.Run("should allow all tenants if no file is configured", func(t *testing.T) {
+		ac, err := NewTenantAccessControl("")
+		require.NoError(t, err)
+
+		assert.True(t, ac.IsAllowed("user-1"))
+		assert.Equal(t, []string{"user-1", "user-2"}, ac.FilterUsers([]string{"user-1", "user-2"}))
+		assert.NoError(t, ac.checkQuery("user-1"))
+	})
+
+	t.Run("should allow only the tenants listed in the file", func(t *testing.T) {
+		ac, err := NewTenantAccessControl(writeFile(t, "# Team A\nuser-1\n\n  user-3  \n"))
+		require.NoError(t, err)
+
+		assert.True(t, ac.IsAllowed("user-1"))
+		assert.False(t, ac.IsAllowed("user-2"))
+		assert.True(t, ac.IsAllowed("user-3"))
+		assert.False(t, ac.IsAllowed("# Team A"))
+		assert.Equal(t, []string{"user-1", "user-3"}, ac.FilterUsers([]string{"user-1", "user-2", "user-3"}))
+
+		assert.NoError(t, ac.checkQuery("user-1"))
+		assert.Equal(t, codes.PermissionDenied, status.Code(ac.checkQuery("user-2")))
+	})
+
+	t.Run("should fail if the file contains no tenants", func(t *testing.T) {
+		_, err := NewTenantAccessControl(writeFile(t, "# No tenants\n\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "contains no tenants")
+	})
+
+	t.Run("should fail if the file doesn't exist", func(t *testing.T) {
+		_, err := NewTenantAccessControl(filepath.Join(t.TempDir(), "missing"))
+		require.Error(t, err)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+	})
+}
@@ -29,7 +29,7 @@ var (
 		validation.MaxSeriesPerQueryFlag,
 	)
 	MaxChunkBytesHitMsgFormat = globalerror.MaxChunkBytesPerQuery.MessageWithPerTenantLimitConfig(
-		"the query exceeded the aggregated chunks size limit (limit: %d bytes)",
+		"the query exceeded the aggregated chunks size limit (limit: %d bytes, actual: %d bytes)",
 		validation.MaxChunkBytesPerQueryFlag,
 	)
 	MaxChunksPerQueryLimitMsgFormat = globalerror.MaxChunksPerQuery.MessageWithPerTenantLimitConfig(
@@ -109,8 +109,8 @@ func (ql *QueryLimiter) AddChunkBytes(chunkSizeInBytes int) error {
 	if ql.maxChunkBytesPerQuery == 0 {
 		return nil
 	}
-	if ql.chunkBytesCount.Add(int64(chunkSizeInBytes)) > int64(ql.maxChunkBytesPerQuery) {
-		return errors.New(fmt.Sprintf(MaxChunkBytesHitMsgFormat, ql.maxChunkBytesPerQuery))
+	if actual := ql.chunkBytesCount.Add(int64(chunkSizeInBytes)); actual > int64(ql.maxChunkBytesPerQuery) {
+		return errors.New(fmt.Sprintf(MaxChunkBytesHitMsgFormat, ql.maxChunkBytesPerQuery, actual))
 	}
 	return nil
 }
@@ -72,7 +72,7 @@ func TestQueryLimiter_AddChunkBytes(t *testing.T) {
 	err := limiter.AddChunkBytes(100)
 	require.NoError(t, err)
 	err = limiter.AddChunkBytes(1)
-	require.Error(t, err)
+	require.EqualError(t, err, fmt.Sprintf(MaxChunkBytesHitMsgFormat, 100, 101))
 }
 
 func BenchmarkQueryLimiter_AddSeries(b *testing.B) {
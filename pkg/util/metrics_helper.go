@@ -629,6 +629,26 @@ func (r *UserRegistries) RemoveUserRegistry(user string, hard bool) {
 	}
 }
 
+// GatherUser gathers the metrics from the registry of the input user.
+// Returns nil if the user has no registry.
+func (r *UserRegistries) GatherUser(user string) (MetricFamilyMap, error) {
+	var reg *prometheus.Registry
+	for _, entry := range r.Registries() {
+		if entry.user == user && entry.reg != nil {
+			reg = entry.reg
+		}
+	}
+	if reg == nil {
+		return nil, nil
+	}
+
+	m, err := reg.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return NewMetricFamilyMap(m)
+}
+
 // Returns true, if we should keep latest metrics. Returns false if we failed to gather latest metrics,
 // and this can be removed completely.
 func (r *UserRegistries) softRemoveUserRegistry(ur *UserRegistry) bool {
@@ -11,6 +11,7 @@ import (
 	"flag"
 	"fmt"
 	"math"
+	"regexp"
 	"strings"
 	"time"
 
@@ -64,6 +65,65 @@ type ForwardingRule struct {
 // ForwardingRules are keyed by metric names, excluding labels.
 type ForwardingRules map[string]ForwardingRule
 
+// AlertLabelNormalizationRule is a transformation the ruler applies to the label values of the alerts
+// sent to the Alertmanager. The enabled transformations are applied in the order they're defined.
+type AlertLabelNormalizationRule struct {
+	// Labels are the names of the labels to normalize. All labels are normalized if empty.
+	Labels      []string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	TrimSpace   bool     `yaml:"trim_space,omitempty" json:"trim_space,omitempty"`
+	Lowercase   bool     `yaml:"lowercase,omitempty" json:"lowercase,omitempty"`
+	Regex       string   `yaml:"regex,omitempty" json:"regex,omitempty"`
+	Replacement string   `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+
+	// regex is the compiled Regex, set when the rule is unmarshalled.
+	regex *regexp.Regexp
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (r *AlertLabelNormalizationRule) UnmarshalYAML(value *yaml.Node) error {
+	type plain AlertLabelNormalizationRule
+	if err := value.DecodeWithOptions((*plain)(r), yaml.DecodeOptions{KnownFields: true}); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *AlertLabelNormalizationRule) UnmarshalJSON(data []byte) error {
+	type plain AlertLabelNormalizationRule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+func (r *AlertLabelNormalizationRule) validate() error {
+	if r.Regex == "" {
+		return nil
+	}
+	regex, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid alert label normalization regex %q: %w", r.Regex, err)
+	}
+	r.regex = regex
+	return nil
+}
+
+// CompiledRegex returns the compiled Regex, or nil if empty or invalid. The Regex is compiled once when the
+// rule is unmarshalled, and on each call otherwise.
+func (r AlertLabelNormalizationRule) CompiledRegex() *regexp.Regexp {
+	if r.regex != nil || r.Regex == "" {
+		return r.regex
+	}
+	regex, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return nil
+	}
+	return regex
+}
+
 // Limits describe all the limits for users; can be used to describe global default
 // limits via flags, or per-user limits via yaml config.
 type Limits struct {
@@ -85,6 +145,7 @@ type Limits struct {
 	EnforceMetadataMetricName bool                `yaml:"enforce_metadata_metric_name" json:"enforce_metadata_metric_name" category:"advanced"`
 	IngestionTenantShardSize  int                 `yaml:"ingestion_tenant_shard_size" json:"ingestion_tenant_shard_size"`
 	MetricRelabelConfigs      []*relabel.Config   `yaml:"metric_relabel_configs,omitempty" json:"metric_relabel_configs,omitempty" doc:"nocli|description=List of metric relabel configurations. Note that in most situations, it is more effective to use metrics relabeling directly in the Prometheus server, e.g. remote_write.write_relabel_configs." category:"experimental"`
+	PushRequestsDebugLogUntil flagext.Time        `yaml:"push_requests_debug_log_until" json:"push_requests_debug_log_until" doc:"nocli|description=Time until which the push requests of the tenant are written, with the labels, number of samples and sample timestamps of each series, as JSON lines to -distributor.debug-log-file, to debug data loss or duplication. Requires -distributor.debug-log-file to be set. This option can only be set in the runtime config overrides. 0 to disable." category:"experimental"`
 
 	// Ingester enforced limits.
 	// Series
@@ -96,7 +157,8 @@ type Limits struct {
 	// Exemplars
 	MaxGlobalExemplarsPerUser int `yaml:"max_global_exemplars_per_user" json:"max_global_exemplars_per_user" category:"experimental"`
 	// Active series custom trackers
-	ActiveSeriesCustomTrackersConfig activeseries.CustomTrackersConfig `yaml:"active_series_custom_trackers" json:"active_series_custom_trackers" doc:"description=Additional custom trackers for active metrics. If there are active series matching a provided matcher (map value), the count will be exposed in the custom trackers metric labeled using the tracker name (map key). Zero valued counts are not exposed (and removed when they go back to zero)." category:"advanced"`
+	ActiveSeriesCustomTrackersConfig         activeseries.CustomTrackersConfig `yaml:"active_series_custom_trackers" json:"active_series_custom_trackers" doc:"description=Additional custom trackers for active metrics. If there are active series matching a provided matcher (map value), the count will be exposed in the custom trackers metric labeled using the tracker name (map key). Zero valued counts are not exposed (and removed when they go back to zero). A map value can contain multiple matchers separated by a pipe character, in which case the series matching any of them are counted. In YAML, a map value can also be an object with the matcher field and the optional cardinality_limit field, to cap the number of active series counted by the tracker, and expose_histogram and histogram_buckets fields, to also expose the count as a histogram." category:"advanced"`
+	ActiveSeriesCustomTrackersInheritDefault bool                              `yaml:"active_series_custom_trackers_inherit_default" json:"active_series_custom_trackers_inherit_default" category:"experimental"`
 	// Max allowed time window for out-of-order samples.
 	OutOfOrderTimeWindow model.Duration `yaml:"out_of_order_time_window" json:"out_of_order_time_window" category:"experimental"`
 
@@ -115,7 +177,10 @@ type Limits struct {
 	SplitInstantQueriesByInterval  model.Duration `yaml:"split_instant_queries_by_interval" json:"split_instant_queries_by_interval" category:"experimental"`
 
 	// Query-frontend limits.
-	MaxTotalQueryLength model.Duration `yaml:"max_total_query_length,omitempty" json:"max_total_query_length,omitempty" category:"experimental"`
+	MaxTotalQueryLength             model.Duration `yaml:"max_total_query_length,omitempty" json:"max_total_query_length,omitempty" category:"experimental"`
+	MaxConcurrentGoroutinesPerQuery int            `yaml:"max_concurrent_goroutines_per_query" json:"max_concurrent_goroutines_per_query" category:"experimental"`
+	MaxConcurrentSubqueriesPerQuery int            `yaml:"max_concurrent_subqueries_per_query" json:"max_concurrent_subqueries_per_query" category:"experimental"`
+	MaxResponseBodyBytes            int            `yaml:"max_response_body_bytes" json:"max_response_body_bytes" category:"experimental"`
 
 	// Cardinality
 	CardinalityAnalysisEnabled                    bool `yaml:"cardinality_analysis_enabled" json:"cardinality_analysis_enabled"`
@@ -123,12 +188,14 @@ type Limits struct {
 	LabelValuesMaxCardinalityLabelNamesPerRequest int  `yaml:"label_values_max_cardinality_label_names_per_request" json:"label_values_max_cardinality_label_names_per_request"`
 
 	// Ruler defaults and limits.
-	RulerEvaluationDelay                 model.Duration `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
-	RulerTenantShardSize                 int            `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
-	RulerMaxRulesPerRuleGroup            int            `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
-	RulerMaxRuleGroupsPerTenant          int            `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
-	RulerRecordingRulesEvaluationEnabled bool           `yaml:"ruler_recording_rules_evaluation_enabled" json:"ruler_recording_rules_evaluation_enabled" category:"experimental"`
-	RulerAlertingRulesEvaluationEnabled  bool           `yaml:"ruler_alerting_rules_evaluation_enabled" json:"ruler_alerting_rules_evaluation_enabled" category:"experimental"`
+	RulerEvaluationDelay                 model.Duration                `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
+	RulerTenantShardSize                 int                           `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
+	RulerMaxRulesPerRuleGroup            int                           `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
+	RulerMaxRuleGroupsPerTenant          int                           `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerRecordingRulesEvaluationEnabled bool                          `yaml:"ruler_recording_rules_evaluation_enabled" json:"ruler_recording_rules_evaluation_enabled" category:"experimental"`
+	RulerAlertingRulesEvaluationEnabled  bool                          `yaml:"ruler_alerting_rules_evaluation_enabled" json:"ruler_alerting_rules_evaluation_enabled" category:"experimental"`
+	AlertAnnotationTemplates             map[string]string             `yaml:"alert_annotation_templates" json:"alert_annotation_templates" doc:"nocli|description=Named Go template snippets which can be referenced in the annotations of the tenant's alerting rules using {{ template \"<name>\" . }}, for example to share runbook links across many alerting rules." category:"experimental"`
+	RulerAlertLabelNormalization         []AlertLabelNormalizationRule `yaml:"ruler_alert_label_normalization" json:"ruler_alert_label_normalization" doc:"nocli|description=Transformations applied by the ruler to the label values of the tenant's alerts before sending them to the Alertmanager, for example to make the casing and whitespace consistent across rule groups. Each rule can trim whitespace (trim_space), lowercase (lowercase) and replace the matches of a regular expression (regex and replacement) in the values of the listed labels (labels), or of all the labels if none is listed." category:"experimental"`
 
 	// Store-gateway.
 	StoreGatewayTenantShardSize int `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
@@ -160,6 +227,10 @@ type Limits struct {
 	AlertmanagerMaxDispatcherAggregationGroups int `yaml:"alertmanager_max_dispatcher_aggregation_groups" json:"alertmanager_max_dispatcher_aggregation_groups"`
 	AlertmanagerMaxAlertsCount                 int `yaml:"alertmanager_max_alerts_count" json:"alertmanager_max_alerts_count"`
 	AlertmanagerMaxAlertsSizeBytes             int `yaml:"alertmanager_max_alerts_size_bytes" json:"alertmanager_max_alerts_size_bytes"`
+	AlertmanagerMaxUniqueAlertsPerMinute       int `yaml:"alertmanager_max_unique_alerts_per_minute" json:"alertmanager_max_unique_alerts_per_minute" category:"experimental"`
+
+	// flagext.Secret can't be unmarshalled from JSON, so the secret can only be set in YAML.
+	AlertmanagerWebhookSignatureSecret flagext.Secret `yaml:"alertmanager_webhook_signature_secret" json:"-" category:"experimental"`
 
 	ForwardingEndpoint      string          `yaml:"forwarding_endpoint" json:"forwarding_endpoint" doc:"nocli|description=Remote-write endpoint where metrics specified in forwarding_rules are forwarded to. If set, takes precedence over endpoints specified in forwarding rules."`
 	ForwardingDropOlderThan model.Duration  `yaml:"forwarding_drop_older_than" json:"forwarding_drop_older_than" doc:"nocli|description=If set, forwarding drops samples that are older than this duration. If unset or 0, no samples get dropped."`
@@ -192,7 +263,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, MaxMetadataPerUserFlag, 0, "The maximum number of in-memory metrics with metadata per tenant, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, MaxMetadataPerMetricFlag, 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
 	f.IntVar(&l.MaxGlobalExemplarsPerUser, "ingester.max-global-exemplars-per-user", 0, "The maximum number of exemplars in memory, across the cluster. 0 to disable exemplars ingestion.")
-	f.Var(&l.ActiveSeriesCustomTrackersConfig, "ingester.active-series-custom-trackers", "Additional active series metrics, matching the provided matchers. Matchers should be in form <name>:<matcher>, like 'foobar:{foo=\"bar\"}'. Multiple matchers can be provided either providing the flag multiple times or providing multiple semicolon-separated values to a single flag.")
+	f.Var(&l.ActiveSeriesCustomTrackersConfig, "ingester.active-series-custom-trackers", "Additional active series metrics, matching the provided matchers. Matchers should be in form <name>:<matcher>, like 'foobar:{foo=\"bar\"}'. Multiple matchers can be provided either providing the flag multiple times or providing multiple semicolon-separated values to a single flag. Multiple matchers can be provided for the same name separated by |, like 'foobar:{foo=\"bar\"}|{foo=\"baz\"}', to count the series matching any of them.")
+	f.BoolVar(&l.ActiveSeriesCustomTrackersInheritDefault, "ingester.active-series-custom-trackers-inherit-default", false, "When enabled in the overrides of a tenant, the tenant active series custom trackers are added to the default ones instead of replacing them. A tenant custom tracker replaces the default one having the same name.")
 	f.Var(&l.OutOfOrderTimeWindow, "ingester.out-of-order-time-window", "Non-zero value enables out-of-order support for most recent samples that are within the time window in relation to the TSDB's maximum time, i.e., within [db.maxTime-timeWindow, db.maxTime]). The ingester will need more memory as a factor of rate of out-of-order samples being ingested and the number of series that are getting out-of-order samples. A lower TTL of 10 minutes will be set for the query cache entries that overlap with this window.")
 
 	f.IntVar(&l.MaxChunksPerQuery, MaxChunksPerQueryFlag, 2e6, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
@@ -228,6 +300,9 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 
 	// Query-frontend.
 	f.Var(&l.MaxTotalQueryLength, maxTotalQueryLengthFlag, fmt.Sprintf("Limit the total query time range (end - start time). This limit is enforced in the query-frontend on the received query. Defaults to the value of -%s if set to 0.", maxQueryLengthFlag))
+	f.IntVar(&l.MaxConcurrentGoroutinesPerQuery, "query-frontend.max-concurrent-goroutines-per-query", 0, "Maximum number of goroutines that can be spawned by the query-frontend to run in parallel the split (by time) and partial (by shard) queries of a single input query. When the limit is reached, the additional queries are not rejected, but wait to be run by the goroutine that created them. 0 to disable.")
+	f.IntVar(&l.MaxConcurrentSubqueriesPerQuery, "query-frontend.max-concurrent-subqueries-per-query", 0, "Maximum number of partial (by shard) queries of a single input query, run by the query-frontend when the query is sharded, which can be in-flight at the same time. PromQL subqueries are not affected. Unlike -query-frontend.max-concurrent-goroutines-per-query, which runs the additional queries in the goroutine that created them, this limit bounds the in-flight queries: when it is reached, the additional queries are not rejected, but wait until a query completes or the input query times out. 0 to disable.")
+	f.IntVar(&l.MaxResponseBodyBytes, "query-frontend.max-response-body-bytes", 0, "Maximum size, in bytes, of a query response body returned by the query-frontend. When the limit is exceeded, the response is truncated by omitting series, the X-Mimir-Truncated response header is set and a warning with the number of omitted series is added to the response. 0 to disable.")
 
 	// Store-gateway.
 	f.IntVar(&l.StoreGatewayTenantShardSize, "store-gateway.tenant-shard-size", 0, "The tenant's shard size, used when store-gateway sharding is enabled. Value of 0 disables shuffle sharding for the tenant, that is all tenant blocks are sharded across all store-gateway replicas.")
@@ -248,6 +323,8 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.AlertmanagerMaxDispatcherAggregationGroups, "alertmanager.max-dispatcher-aggregation-groups", 0, "Maximum number of aggregation groups in Alertmanager's dispatcher that a tenant can have. Each active aggregation group uses single goroutine. When the limit is reached, dispatcher will not dispatch alerts that belong to additional aggregation groups, but existing groups will keep working properly. 0 = no limit.")
 	f.IntVar(&l.AlertmanagerMaxAlertsCount, "alertmanager.max-alerts-count", 0, "Maximum number of alerts that a single tenant can have. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
 	f.IntVar(&l.AlertmanagerMaxAlertsSizeBytes, "alertmanager.max-alerts-size-bytes", 0, "Maximum total size of alerts that a single tenant can have, alert size is the sum of the bytes of its labels, annotations and generatorURL. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxUniqueAlertsPerMinute, "alertmanager.max-unique-alerts-per-minute", 0, "Maximum number of new unique alerts, identified by their labels, that a single tenant can create per minute, over a sliding window. Alerts exceeding the limit are dropped with a log message and metric increment, while updates of the existing alerts are not limited. 0 = no limit.")
+	f.Var(&l.AlertmanagerWebhookSignatureSecret, "alertmanager.webhook-signature-secret", "Secret used to verify the HMAC-SHA256 signature, in the X-Hub-Signature-256 header, of the webhook requests creating silences in the tenant's Alertmanager, for example to acknowledge alerts from a ticketing system. Requests with a missing or invalid signature are rejected. Empty to disable the verification.")
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -466,6 +543,23 @@ func (o *Overrides) MaxTotalQueryLength(userID string) time.Duration {
 	return t
 }
 
+// MaxConcurrentGoroutinesPerQuery returns the limit to the number of goroutines spawned by the
+// query-frontend to run in parallel the split and partial queries of a single query.
+func (o *Overrides) MaxConcurrentGoroutinesPerQuery(userID string) int {
+	return o.getOverridesForUser(userID).MaxConcurrentGoroutinesPerQuery
+}
+
+// MaxResponseBodyBytes returns the max size, in bytes, of a query response body returned by the query-frontend.
+func (o *Overrides) MaxResponseBodyBytes(userID string) int {
+	return o.getOverridesForUser(userID).MaxResponseBodyBytes
+}
+
+// MaxConcurrentSubqueriesPerQuery returns the limit to the number of in-flight subqueries run by
+// the query-frontend for a single sharded query.
+func (o *Overrides) MaxConcurrentSubqueriesPerQuery(userID string) int {
+	return o.getOverridesForUser(userID).MaxConcurrentSubqueriesPerQuery
+}
+
 // MaxLabelsQueryLength returns the limit of the length (in time) of a label names or values request.
 func (o *Overrides) MaxLabelsQueryLength(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxLabelsQueryLength)
@@ -526,8 +620,14 @@ func (o *Overrides) MaxGlobalExemplarsPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalExemplarsPerUser
 }
 
+// ActiveSeriesCustomTrackersConfig returns the active series custom trackers of the user. If the user
+// overrides inherit the default custom trackers, they're merged with the user ones.
 func (o *Overrides) ActiveSeriesCustomTrackersConfig(userID string) activeseries.CustomTrackersConfig {
-	return o.getOverridesForUser(userID).ActiveSeriesCustomTrackersConfig
+	l := o.getOverridesForUser(userID)
+	if !l.ActiveSeriesCustomTrackersInheritDefault || l == o.defaultLimits {
+		return l.ActiveSeriesCustomTrackersConfig
+	}
+	return activeseries.MergeCustomTrackersConfigs(o.defaultLimits.ActiveSeriesCustomTrackersConfig, l.ActiveSeriesCustomTrackersConfig)
 }
 
 // OutOfOrderTimeWindow returns the out-of-order time window for the user.
@@ -584,6 +684,11 @@ func (o *Overrides) CompactorBlockUploadEnabled(tenantID string) bool {
 	return o.getOverridesForUser(tenantID).CompactorBlockUploadEnabled
 }
 
+// PushRequestsDebugLogUntil returns the time until which the push requests of the given user are debug logged.
+func (o *Overrides) PushRequestsDebugLogUntil(userID string) time.Time {
+	return time.Time(o.getOverridesForUser(userID).PushRequestsDebugLogUntil)
+}
+
 // MetricRelabelConfigs returns the metric relabel configs for a given user.
 func (o *Overrides) MetricRelabelConfigs(userID string) []*relabel.Config {
 	return o.getOverridesForUser(userID).MetricRelabelConfigs
@@ -614,6 +719,16 @@ func (o *Overrides) RulerAlertingRulesEvaluationEnabled(userID string) bool {
 	return o.getOverridesForUser(userID).RulerAlertingRulesEvaluationEnabled
 }
 
+// AlertAnnotationTemplates returns the named template snippets which can be referenced in the annotations of alerting rules for a given user.
+func (o *Overrides) AlertAnnotationTemplates(userID string) map[string]string {
+	return o.getOverridesForUser(userID).AlertAnnotationTemplates
+}
+
+// RulerAlertLabelNormalization returns the transformations applied to the label values of the alerts of a given user.
+func (o *Overrides) RulerAlertLabelNormalization(userID string) []AlertLabelNormalizationRule {
+	return o.getOverridesForUser(userID).RulerAlertLabelNormalization
+}
+
 // StoreGatewayTenantShardSize returns the store-gateway shard size for a given user.
 func (o *Overrides) StoreGatewayTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).StoreGatewayTenantShardSize
@@ -723,6 +838,14 @@ func (o *Overrides) AlertmanagerMaxAlertsSizeBytes(userID string) int {
 	return o.getOverridesForUser(userID).AlertmanagerMaxAlertsSizeBytes
 }
 
+func (o *Overrides) AlertmanagerMaxUniqueAlertsPerMinute(userID string) int {
+	return o.getOverridesForUser(userID).AlertmanagerMaxUniqueAlertsPerMinute
+}
+
+func (o *Overrides) AlertmanagerWebhookSignatureSecret(userID string) string {
+	return o.getOverridesForUser(userID).AlertmanagerWebhookSignatureSecret.String()
+}
+
 func (o *Overrides) ForwardingRules(user string) ForwardingRules {
 	return o.getOverridesForUser(user).ForwardingRules
 }
@@ -580,3 +580,71 @@ func TestCustomTrackerConfigDeserialize(t *testing.T) {
 	assert.False(t, overrides["user"].ActiveSeriesCustomTrackersConfig.Empty())
 	assert.Equal(t, expectedConfig.String(), overrides["user"].ActiveSeriesCustomTrackersConfig.String())
 }
+
+func TestActiveSeriesCustomTrackersConfigInheritDefault(t *testing.T) {
+	mustConfig := func(source map[string]string) activeseries.CustomTrackersConfig {
+		c, err := activeseries.NewCustomTrackersConfig(source)
+		require.NoError(t, err)
+		return c
+	}
+
+	defaults := Limits{
+		ActiveSeriesCustomTrackersConfig: mustConfig(map[string]string{
+			"foo": `{foo="default"}`,
+			"bar": `{bar="default"}`,
+		}),
+	}
+
+	tenantLimits := map[string]*Limits{
+		"replacing": {
+			ActiveSeriesCustomTrackersConfig: mustConfig(map[string]string{"baz": `{baz="tenant"}`}),
+		},
+		"inheriting": {
+			ActiveSeriesCustomTrackersConfig:         mustConfig(map[string]string{"baz": `{baz="tenant"}`, "foo": `{foo="tenant"}`}),
+			ActiveSeriesCustomTrackersInheritDefault: true,
+		},
+		"inheriting-without-trackers": {
+			ActiveSeriesCustomTrackersInheritDefault: true,
+		},
+	}
+
+	tests := map[string]struct {
+		tenantLimits TenantLimits
+		userID       string
+		expected     string
+	}{
+		"should return the default trackers without tenant limits": {
+			userID:   "inheriting",
+			expected: `bar:{bar="default"};foo:{foo="default"}`,
+		},
+		"should return the default trackers for a tenant without overrides": {
+			tenantLimits: NewMockTenantLimits(tenantLimits),
+			userID:       "unknown",
+			expected:     `bar:{bar="default"};foo:{foo="default"}`,
+		},
+		"should replace the default trackers by default": {
+			tenantLimits: NewMockTenantLimits(tenantLimits),
+			userID:       "replacing",
+			expected:     `baz:{baz="tenant"}`,
+		},
+		"should add the tenant trackers to the default ones, with the tenant ones winning on name collision": {
+			tenantLimits: NewMockTenantLimits(tenantLimits),
+			userID:       "inheriting",
+			expected:     `bar:{bar="default"};baz:{baz="tenant"};foo:{foo="tenant"}`,
+		},
+		"should return the default trackers if the tenant has none": {
+			tenantLimits: NewMockTenantLimits(tenantLimits),
+			userID:       "inheriting-without-trackers",
+			expected:     `bar:{bar="default"};foo:{foo="default"}`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ov, err := NewOverrides(defaults, testData.tenantLimits)
+			require.NoError(t, err)
+
+			assert.Equal(t, testData.expected, ov.ActiveSeriesCustomTrackersConfig(testData.userID).String())
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	gokitlog "github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/mimir/pkg/compactor"
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+func main() {
+	cfg := struct {
+		bucket  bucket.Config
+		tenantA string
+		tenantB string
+		minTime flagext.Time
+		maxTime flagext.Time
+		dryRun  bool
+		tempDir string
+	}{}
+
+	logger := gokitlog.NewLogfmtLogger(gokitlog.NewSyncWriter(os.Stderr))
+	cfg.bucket.RegisterFlags(flag.CommandLine, logger)
+	flag.StringVar(&cfg.tenantA, "tenant-a", "", "Tenant whose series are kept (e.g. the global tenant)")
+	flag.StringVar(&cfg.tenantB, "tenant-b", "", "Tenant whose blocks with all series duplicated in tenant-a are marked for deletion")
+	flag.Var(&cfg.minTime, "min-time", "Start of the time range to deduplicate")
+	flag.Var(&cfg.maxTime, "max-time", "End of the time range to deduplicate")
+	flag.BoolVar(&cfg.dryRun, "dry-run", true, "Only report the duplicated blocks, without marking them for deletion")
+	flag.StringVar(&cfg.tempDir, "temp-dir", os.TempDir(), "Directory where the blocks are downloaded")
+	flag.Parse()
+
+	if cfg.tenantA == "" || cfg.tenantB == "" {
+		log.Fatalln("no tenants specified")
+	}
+	if time.Time(cfg.minTime).IsZero() || time.Time(cfg.maxTime).IsZero() {
+		log.Fatalln("no time range specified")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT)
+	defer cancel()
+
+	bkt, err := bucket.NewClient(ctx, cfg.bucket, "bucket", logger, nil)
+	if err != nil {
+		log.Fatalln("failed to create bucket:", err)
+	}
+
+	timeRange := model.Interval{
+		Start: model.TimeFromUnixNano(time.Time(cfg.minTime).UnixNano()),
+		End:   model.TimeFromUnixNano(time.Time(cfg.maxTime).UnixNano()),
+	}
+
+	d := compactor.NewCrossTenantDeduplication(bkt, nil, cfg.dryRun, cfg.tempDir, logger, nil)
+	if err := d.CrossTenantDedup(ctx, cfg.tenantA, cfg.tenantB, timeRange); err != nil {
+		log.Fatalln("failed to deduplicate blocks:", err)
+	}
+}
@@ -344,6 +344,8 @@ func getFieldCustomType(t reflect.Type) (string, bool) {
 		return "string", true
 	case reflect.TypeOf(flagext.CIDRSliceCSV{}).String():
 		return "string", true
+	case reflect.TypeOf(flagext.Time{}).String():
+		return "time", true
 	case reflect.TypeOf([]*relabel.Config{}).String():
 		return "relabel_config...", true
 	case reflect.TypeOf(activeseries.CustomTrackersConfig{}).String():
@@ -424,6 +426,8 @@ func getCustomFieldType(t reflect.Type) (string, bool) {
 		return "string", true
 	case reflect.TypeOf(flagext.CIDRSliceCSV{}).String():
 		return "string", true
+	case reflect.TypeOf(flagext.Time{}).String():
+		return "time", true
 	case reflect.TypeOf([]*relabel.Config{}).String():
 		return "relabel_config...", true
 	case reflect.TypeOf(activeseries.CustomTrackersConfig{}).String():
@@ -463,6 +467,8 @@ func ReflectType(typ string) reflect.Type {
 		return reflect.TypeOf(tsdb.DurationList{})
 	case "map of string to validation.ForwardingRule":
 		return reflect.TypeOf(map[string]validation.ForwardingRule{})
+	case "list of AlertLabelNormalizationRules":
+		return reflect.TypeOf([]validation.AlertLabelNormalizationRule{})
 	default:
 		panic("unknown field type " + typ)
 	}
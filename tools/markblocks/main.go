@@ -3,13 +3,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-kit/log"
@@ -17,6 +23,7 @@ import (
 	dskit_concurrency "github.com/grafana/dskit/concurrency"
 	"github.com/grafana/dskit/flagext"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 
@@ -24,16 +31,40 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 )
 
+// markMode is the operation done on the marks of the blocks.
+type markMode int
+
+const (
+	createMarks markMode = iota
+	deleteMarks
+)
+
+const (
+	tableOutput  = "table"
+	logfmtOutput = "logfmt"
+	jsonOutput   = "json"
+)
+
 type config struct {
 	bucket             bucket.Config
 	tenantID           string
+	tenantsFile        string
 	dryRun             bool
+	verify             bool
 	allowPartialBlocks bool
 	concurrency        int
-
-	mark    string
-	details string
-	blocks  []string
+	unmark             bool
+	list               bool
+	output             string
+	outputFormat       string
+	ageCheck           ageCheckConfig
+
+	mark       string
+	details    string
+	blocks     []string
+	blocksFile string
+	timeFrom   flagext.Time
+	timeTo     flagext.Time
 
 	helpAll bool
 }
@@ -43,14 +74,164 @@ func main() {
 	logger := log.WithPrefix(log.NewLogfmtLogger(os.Stderr), "time", log.DefaultTimestampUTC)
 
 	cfg := parseFlags(logger)
+
+	if cfg.list {
+		if cfg.tenantID == "" {
+			level.Error(logger).Log("msg", "Flag -tenant is required.")
+			os.Exit(1)
+		}
+		if cfg.output != tableOutput && cfg.output != jsonOutput {
+			level.Error(logger).Log("msg", "Invalid -output flag value. Should be table or json.", "value", cfg.output)
+			os.Exit(1)
+		}
+
+		marks, err := listMarks(ctx, createUserBucketWithGlobalMarkers(ctx, logger, cfg.bucket, cfg.tenantID))
+		if err != nil {
+			level.Error(logger).Log("msg", "Can't list marks.", "err", err)
+			os.Exit(1)
+		}
+		if err := printMarks(os.Stdout, marks, cfg.output); err != nil {
+			level.Error(logger).Log("msg", "Can't print marks.", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.outputFormat != logfmtOutput && cfg.outputFormat != jsonOutput {
+		level.Error(logger).Log("msg", "Invalid -output-format flag value. Should be logfmt or json.", "value", cfg.outputFormat)
+		os.Exit(1)
+	}
+
 	marker, filename := createMarker(cfg.mark, logger, cfg.details)
-	ulids := validateTenantAndBlocks(logger, cfg.tenantID, cfg.blocks)
-	uploadMarks(ctx, logger, ulids, marker, filename, cfg.dryRun, cfg.bucket, cfg.tenantID, cfg.allowPartialBlocks, cfg.concurrency)
+
+	tenants := readTenants(logger, cfg.tenantID, cfg.tenantsFile)
+
+	// When selecting the blocks by time range, the blocks are listed for each tenant.
+	var ulids []ulid.ULID
+	if !cfg.timeRangeSet() {
+		blocks := cfg.blocks
+		if cfg.blocksFile != "" {
+			fileBlocks, err := readIDsFile(cfg.blocksFile)
+			if err != nil {
+				level.Error(logger).Log("msg", "Can't read blocks file.", "file", cfg.blocksFile, "err", err)
+				os.Exit(1)
+			}
+			blocks = append(blocks, fileBlocks...)
+		}
+		ulids = validateBlocks(logger, blocks)
+	}
+
+	mode := createMarks
+	if cfg.unmark {
+		mode = deleteMarks
+	}
+
+	var (
+		results       []markResult
+		failedTenants int
+	)
+	for _, tenantID := range tenants {
+		tenantLogger := log.With(logger, "tenant", tenantID)
+
+		tenantULIDs := ulids
+		if cfg.timeRangeSet() {
+			var ok bool
+			if tenantULIDs, ok = blocksWithinTimeRange(ctx, tenantLogger, cfg, tenantID); !ok {
+				failedTenants++
+				continue
+			}
+		}
+		if len(tenantULIDs) == 0 {
+			continue
+		}
+
+		tenantResults, err := uploadMarks(ctx, tenantLogger, mode, tenantID, tenantULIDs, marker, filename, cfg.dryRun, cfg.bucket, cfg.allowPartialBlocks, cfg.concurrency, cfg.ageCheck, cfg.verify)
+		if err != nil {
+			failedTenants++
+		}
+		results = append(results, tenantResults...)
+	}
+
+	logSummary(logger, len(tenants), failedTenants, results)
+
+	if cfg.outputFormat == jsonOutput {
+		if err := printResults(os.Stdout, results); err != nil {
+			level.Error(logger).Log("msg", "Can't print results.", "err", err)
+			os.Exit(1)
+		}
+	}
+	if failedTenants > 0 {
+		os.Exit(1)
+	}
+}
+
+// blocksWithinTimeRange returns the blocks of the tenant within the configured time range, or false
+// if they can't be listed.
+func blocksWithinTimeRange(ctx context.Context, logger log.Logger, cfg config, tenantID string) ([]ulid.ULID, bool) {
+	from, to := time.Time(cfg.timeFrom), time.Time(cfg.timeTo)
+	blocks, err := listBlocksWithinTimeRange(ctx, createBucket(ctx, logger, cfg.bucket), tenantID, from, to, logger)
+	if err != nil {
+		level.Error(logger).Log("msg", "Can't list blocks within the time range.", "err", err)
+		return nil, false
+	}
+	if len(blocks) == 0 {
+		level.Warn(logger).Log("msg", "No blocks found within the time range. Nothing was done.", "from", from.Format(time.RFC3339), "to", to.Format(time.RFC3339))
+		return nil, true
+	}
+
+	level.Info(logger).Log("msg", "Found blocks within the time range.", "from", from.Format(time.RFC3339), "to", to.Format(time.RFC3339), "blocks", len(blocks))
+
+	ulids := make([]ulid.ULID, 0, len(blocks))
+	for _, b := range blocks {
+		ulids = append(ulids, ulid.MustParse(b))
+	}
+	return ulids, true
+}
+
+// logSummary logs the number of tenants processed, and the number of blocks by outcome.
+func logSummary(logger log.Logger, tenants, failedTenants int, results []markResult) {
+	var marked, skipped, errored int
+	for _, r := range results {
+		switch r.Status {
+		case statusUploaded, statusDeleted:
+			marked++
+		case statusSkipped:
+			skipped++
+		case statusError:
+			errored++
+		}
+	}
+
+	level.Info(logger).Log("msg", "Summary.", "tenants", tenants, "failed_tenants", failedTenants, "marked", marked, "skipped", skipped, "errors", errored)
 }
 
 func parseFlags(logger log.Logger) config {
 	var cfg config
+	fullFlagSet := registerFlags(&cfg, logger)
+
+	if err := fullFlagSet.Parse(os.Args[1:]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
+	// See if user did `markblocks -help-all`.
+	if cfg.helpAll {
+		fullFlagSet.Usage()
+		os.Exit(0)
+	}
+	cfg.blocks = fullFlagSet.Args()
+
+	if err := cfg.validateTimeRange(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+// registerFlags registers the flags of the tool into cfg and returns the flag set to parse, which includes
+// the bucket configuration flags.
+func registerFlags(cfg *config, logger log.Logger) *flag.FlagSet {
 	// We define two flag sets, one on basic straightforward flags of this cli, and the other one with all flags,
 	// which includes the bucket configuration flags, as there quite a lot of them and the help output with them
 	// might look a little bit overwhelming at first contact.
@@ -61,19 +242,33 @@ func parseFlags(logger log.Logger) config {
 
 	// We register our basic flags on both basic and full flag set.
 	for _, f := range []*flag.FlagSet{basicFlagSet, fullFlagSet} {
-		f.StringVar(&cfg.tenantID, "tenant", "", "Tenant ID of the owner of the block. Required.")
+		f.StringVar(&cfg.tenantID, "tenant", "", "Tenant ID of the owner of the block. Required, unless -tenants-file is provided.")
+		f.StringVar(&cfg.tenantsFile, "tenants-file", "", "Path to a file containing the IDs of the tenants whose blocks should be marked, one per line. Blank lines and lines starting with # are ignored. The same blocks are marked for each tenant, in addition to the tenant provided by -tenant. Not supported by -list.")
 		f.StringVar(&cfg.mark, "mark", "", "Mark type to create, valid options: deletion, no-compact. Required.")
 		f.BoolVar(&cfg.dryRun, "dry-run", false, "Don't upload the markers generated, just print the intentions.")
+		f.BoolVar(&cfg.verify, "verify", false, "After uploading each mark, read it back from the bucket and fail if its SHA-256 checksum doesn't match the uploaded content.")
 		f.StringVar(&cfg.details, "details", "", "Details field of the uploaded mark. Recommended. (default empty).")
 		f.BoolVar(&cfg.helpAll, "help-all", false, "Show help for all flags, including the bucket backend configuration.")
 		f.BoolVar(&cfg.allowPartialBlocks, "allow-partial", false, "Allow upload of marks into partial blocks (ie. blocks without meta.json). Only useful for deletion mark.")
+		f.BoolVar(&cfg.unmark, "unmark", false, "Remove the existing mark of the type given by -mark from the blocks, instead of creating it.")
+		f.BoolVar(&cfg.list, "list", false, "List all the blocks of the tenant having a deletion or no-compact mark, instead of creating marks.")
+		f.StringVar(&cfg.output, "output", tableOutput, "Output format of -list, valid options: table, json.")
+		f.StringVar(&cfg.outputFormat, "output-format", logfmtOutput, "Output format of the outcome of creating or deleting the marks, valid options: logfmt, json. With json, a JSON array with the status of each block is written to stdout, while the logs are still written to stderr.")
+		f.DurationVar(&cfg.ageCheck.minAge, "min-age", 24*time.Hour, "Minimum age of the blocks to mark for deletion: a warning is logged for each block whose max time, read from its meta.json, is more recent than this. 0 to disable the check.")
+		f.BoolVar(&cfg.ageCheck.strict, "strict", false, "Abort instead of logging a warning when a block to mark for deletion is more recent than -min-age, or its meta.json can't be read.")
+		f.Var(&cfg.timeFrom, "time-from", "Mark all the blocks overlapping the time range starting at this time, in RFC3339 format, according to the tenant bucket index. Requires -time-to. Can't be used together with block IDs or -blocks-file.")
+		f.Var(&cfg.timeTo, "time-to", "Mark all the blocks overlapping the time range ending at this time, in RFC3339 format, according to the tenant bucket index. Requires -time-from. Can't be used together with block IDs or -blocks-file.")
+		f.StringVar(&cfg.blocksFile, "blocks-file", "", "Path to a file containing the IDs of the blocks to mark, one per line. Blank lines and lines starting with # are ignored. The blocks in the file are marked in addition to the ones provided as arguments.")
 	}
 
 	commonUsageHeader := func() {
 		fmt.Println("This tool creates marks for TSDB blocks used by Mimir and uploads them to the specified backend.")
 		fmt.Println("")
 		fmt.Println("Usage:")
-		fmt.Println("        markblocks -tenant <tenant id> -mark <deletion|no-compact> [-details <details message>] [-dry-run] blockID [blockID2 blockID3 ...]")
+		fmt.Println("        markblocks -tenant <tenant id> -mark <deletion|no-compact> [-unmark] [-details <details message>] [-dry-run] [-verify] [-min-age <duration>] [-strict] [-output-format <logfmt|json>] [-blocks-file <path>] [blockID blockID2 ...]")
+		fmt.Println("        markblocks -tenant <tenant id> -mark <deletion|no-compact> [-unmark] [-details <details message>] [-dry-run] -time-from <time> -time-to <time>")
+		fmt.Println("        markblocks -tenants-file <path> -mark <deletion|no-compact> [-unmark] [-details <details message>] [-dry-run] [blockID blockID2 ...]")
+		fmt.Println("        markblocks -tenant <tenant id> -list [-output <table|json>]")
 		fmt.Println("")
 	}
 
@@ -95,40 +290,109 @@ func parseFlags(logger log.Logger) config {
 
 	fullFlagSet.IntVar(&cfg.concurrency, "concurrency", 16, "How many markers to upload concurrently.")
 
-	if err := fullFlagSet.Parse(os.Args[1:]); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	// Transient failures of the bucket operations are retried by the bucket client. Unlike the other
+	// components, the tool retries them by default.
+	cfg.bucket.Retry.MaxAttempts = 3
+	fullFlagSet.Lookup("operation-retry-max-attempts").DefValue = "3"
 
-	// See if user did `markblocks -help-all`.
-	if cfg.helpAll {
-		commonUsageHeader()
-		fullFlagSet.PrintDefaults()
-		os.Exit(0)
+	return fullFlagSet
+}
+
+// timeRangeSet returns true if the blocks to mark are selected by time range.
+func (cfg config) timeRangeSet() bool {
+	return !time.Time(cfg.timeFrom).IsZero() || !time.Time(cfg.timeTo).IsZero()
+}
+
+// validateTimeRange checks that the time range is valid, and the blocks are not also provided by ID.
+func (cfg config) validateTimeRange() error {
+	if !cfg.timeRangeSet() {
+		return nil
 	}
-	cfg.blocks = fullFlagSet.Args()
+	if len(cfg.blocks) > 0 || cfg.blocksFile != "" {
+		return errors.New("-time-from and -time-to can't be used together with block IDs or -blocks-file")
+	}
+	if time.Time(cfg.timeFrom).IsZero() || time.Time(cfg.timeTo).IsZero() {
+		return errors.New("both -time-from and -time-to must be provided")
+	}
+	if !time.Time(cfg.timeFrom).Before(time.Time(cfg.timeTo)) {
+		return errors.New("-time-from must be before -time-to")
+	}
+	return nil
+}
 
-	return cfg
+// readIDsFile returns the block or tenant IDs listed in the file at the input path, one per line.
+// Blank lines and lines starting with # are skipped.
+func readIDsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var blocks []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocks = append(blocks, line)
+	}
+	return blocks, scanner.Err()
 }
 
-func validateTenantAndBlocks(logger log.Logger, tenantID string, blockIDs flagext.StringSlice) []ulid.ULID {
-	if tenantID == "" {
-		level.Error(logger).Log("msg", "Flag -tenant is required.")
+// readTenants returns the tenant provided by -tenant and the ones listed in -tenants-file, without duplicates.
+func readTenants(logger log.Logger, tenantID, tenantsFile string) []string {
+	var ids []string
+	if tenantID != "" {
+		ids = append(ids, tenantID)
+	}
+	if tenantsFile != "" {
+		fileIDs, err := readIDsFile(tenantsFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "Can't read tenants file.", "file", tenantsFile, "err", err)
+			os.Exit(1)
+		}
+		ids = append(ids, fileIDs...)
+	}
+
+	if len(ids) == 0 {
+		level.Error(logger).Log("msg", "Flag -tenant or -tenants-file is required.")
 		os.Exit(1)
 	}
 
+	var tenants []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			level.Warn(logger).Log("msg", "Tenant provided more than once, skipping duplicate.", "tenant", id)
+			continue
+		}
+		seen[id] = true
+		tenants = append(tenants, id)
+	}
+	return tenants
+}
+
+func validateBlocks(logger log.Logger, blockIDs flagext.StringSlice) []ulid.ULID {
 	if len(blockIDs) == 0 {
 		level.Warn(logger).Log("msg", "No blocks were provided. Nothing was done.")
 		os.Exit(0)
 	}
 
 	var ulids []ulid.ULID
+	seen := map[ulid.ULID]bool{}
 	for _, b := range blockIDs {
 		blockID, err := ulid.Parse(b)
 		if err != nil {
 			level.Error(logger).Log("msg", "Can't parse block ID.", "block", b, "err", err)
 			os.Exit(1)
 		}
+		if seen[blockID] {
+			level.Warn(logger).Log("msg", "Block provided more than once, skipping duplicate.", "block", blockID)
+			continue
+		}
+		seen[blockID] = true
 		ulids = append(ulids, blockID)
 	}
 	return ulids
@@ -162,96 +426,357 @@ func createMarker(markType string, logger log.Logger, details string) (func(b ul
 	}
 }
 
+// markStatus is the outcome of creating or deleting the mark of a block.
+type markStatus string
+
+const (
+	statusUploaded markStatus = "uploaded"
+	statusDeleted  markStatus = "deleted"
+	statusSkipped  markStatus = "skipped"
+	statusError    markStatus = "error"
+)
+
+// markResult is the outcome of creating or deleting the mark of a block, as printed in the json output format.
+type markResult struct {
+	Tenant string     `json:"tenant"`
+	Block  ulid.ULID  `json:"block"`
+	Status markStatus `json:"status"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// uploadMarks creates or deletes, depending on the mode, the marks of the input blocks, and returns the outcome
+// for each block. An error is returned if the mark of any block failed to be created or deleted.
 func uploadMarks(
 	ctx context.Context,
 	logger log.Logger,
+	mode markMode,
+	tenantID string,
 	ulids []ulid.ULID,
 	mark func(b ulid.ULID) ([]byte, error),
 	markFilename string,
 	dryRun bool,
 	cfg bucket.Config,
-	tenantID string,
 	allowPartialBlocks bool,
 	concurrency int,
-) {
+	ageCheck ageCheckConfig,
+	verify bool,
+) ([]markResult, error) {
 	userBucketWithGlobalMarkers := createUserBucketWithGlobalMarkers(ctx, logger, cfg, tenantID)
 
-	err := dskit_concurrency.ForEachJob(ctx, len(ulids), concurrency, func(ctx context.Context, idx int) error {
-		b := ulids[idx]
-
-		blockFiles := map[string]bool{}
-		// List all files in the blocks directory. We don't need recursive listing: if any segment
-		// files (chunks/0000xxx) are present, we will find "chunks" during iter.
-		err := userBucketWithGlobalMarkers.Iter(ctx, b.String(), func(fn string) error {
-			if !strings.HasPrefix(fn, b.String()+"/") {
-				return nil
-			}
+	results := make([]markResult, len(ulids))
+	for i, b := range ulids {
+		// Blocks are not processed once a block failed.
+		results[i] = markResult{Tenant: tenantID, Block: b, Status: statusError, Error: "not processed because of a previous error"}
+	}
 
-			fn = strings.TrimPrefix(fn, b.String()+"/")
-			fn = strings.TrimSuffix(fn, "/")
+	err := dskit_concurrency.ForEachJob(ctx, len(ulids), concurrency, func(ctx context.Context, idx int) error {
+		status, err := uploadMark(ctx, logger, mode, ulids[idx], mark, markFilename, dryRun, userBucketWithGlobalMarkers, allowPartialBlocks, ageCheck, verify)
+		results[idx].Status = status
+		results[idx].Error = ""
+		if err != nil {
+			results[idx].Error = err.Error()
+		}
+		return err
+	})
+	return results, err
+}
 
-			blockFiles[fn] = true
+// uploadMark creates or deletes, depending on the mode, the mark of the input block.
+func uploadMark(
+	ctx context.Context,
+	logger log.Logger,
+	mode markMode,
+	b ulid.ULID,
+	mark func(b ulid.ULID) ([]byte, error),
+	markFilename string,
+	dryRun bool,
+	userBucketWithGlobalMarkers objstore.Bucket,
+	allowPartialBlocks bool,
+	ageCheck ageCheckConfig,
+	verify bool,
+) (markStatus, error) {
+	blockFiles := map[string]bool{}
+	// List all files in the blocks directory. We don't need recursive listing: if any segment
+	// files (chunks/0000xxx) are present, we will find "chunks" during iter.
+	err := userBucketWithGlobalMarkers.Iter(ctx, b.String(), func(fn string) error {
+		if !strings.HasPrefix(fn, b.String()+"/") {
 			return nil
-		})
-		if err != nil {
-			if userBucketWithGlobalMarkers.IsObjNotFoundErr(err) {
-				level.Warn(logger).Log("msg", "Block does not exist", "block", b, "err", err)
-				return nil
-			}
+		}
+
+		fn = strings.TrimPrefix(fn, b.String()+"/")
+		fn = strings.TrimSuffix(fn, "/")
 
-			level.Error(logger).Log("msg", "Failed to list files for block.", "block", b, "err", err)
-			return err
+		blockFiles[fn] = true
+		return nil
+	})
+	if err != nil {
+		if userBucketWithGlobalMarkers.IsObjNotFoundErr(err) {
+			level.Warn(logger).Log("msg", "Block does not exist", "block", b, "err", err)
+			return statusSkipped, nil
 		}
 
-		if len(blockFiles) == 0 {
-			level.Warn(logger).Log("msg", "Block does not exist, skipping.", "block", b)
-			return nil
+		level.Error(logger).Log("msg", "Failed to list files for block.", "block", b, "err", err)
+		return statusError, err
+	}
+
+	if len(blockFiles) == 0 {
+		level.Warn(logger).Log("msg", "Block does not exist, skipping.", "block", b)
+		return statusSkipped, nil
+	}
+
+	blockMarkPath := fmt.Sprintf("%s/%s", b, markFilename)
+
+	if mode == deleteMarks {
+		if !blockFiles[markFilename] {
+			level.Warn(logger).Log("msg", "Mark does not exist, skipping.", "block", b, "marker", blockMarkPath)
+			return statusSkipped, nil
 		}
 
-		if !blockFiles[metadata.MetaFilename] && !allowPartialBlocks {
-			level.Warn(logger).Log("msg", "Block's meta.json file does not exist, skipping.", "block", b)
-			return nil
+		if dryRun {
+			level.Info(logger).Log("msg", "Dry-run, not deleting marker.", "block", b, "marker", blockMarkPath)
+			return statusSkipped, nil
 		}
 
-		if blockFiles[markFilename] {
-			level.Warn(logger).Log("msg", "Mark already exists, skipping.", "block", b)
-			return nil
+		if err := userBucketWithGlobalMarkers.Delete(ctx, blockMarkPath); err != nil {
+			level.Error(logger).Log("msg", "Can't delete mark.", "block", b, "err", err)
+			return statusError, err
+		}
+
+		level.Info(logger).Log("msg", "Successfully deleted mark.", "block", b)
+		return statusDeleted, nil
+	}
+
+	if !blockFiles[metadata.MetaFilename] && !allowPartialBlocks {
+		level.Warn(logger).Log("msg", "Block's meta.json file does not exist, skipping.", "block", b)
+		return statusSkipped, nil
+	}
+
+	if blockFiles[markFilename] {
+		level.Warn(logger).Log("msg", "Mark already exists, skipping.", "block", b)
+		return statusSkipped, nil
+	}
+
+	// Protect against marking for deletion a block which may still be written to, eg. because of a mistyped block ID.
+	if markFilename == metadata.DeletionMarkFilename && ageCheck.minAge > 0 && blockFiles[metadata.MetaFilename] {
+		if err := checkBlockAge(ctx, userBucketWithGlobalMarkers, b, ageCheck.minAge, time.Now()); err != nil {
+			if ageCheck.strict {
+				level.Error(logger).Log("msg", "Block age check failed, aborting.", "block", b, "err", err)
+				return statusError, err
+			}
+			level.Warn(logger).Log("msg", "Block age check failed, marking the block anyway. Use -strict to abort instead.", "block", b, "err", err)
 		}
+	}
+
+	data, err := mark(b)
+	if err != nil {
+		level.Error(logger).Log("msg", "Can't create mark.", "block", b, "err", err)
+		return statusError, err
+	}
+
+	if dryRun {
+		level.Info(logger).Log("msg", "Dry-run, not uploading marker.", "block", b, "marker", blockMarkPath, "data", string(data))
+		return statusSkipped, nil
+	}
+
+	if err := userBucketWithGlobalMarkers.Upload(ctx, blockMarkPath, bytes.NewReader(data)); err != nil {
+		level.Error(logger).Log("msg", "Can't upload mark.", "block", b, "err", err)
+		return statusError, err
+	}
+
+	if verify {
+		if err := verifyMark(ctx, userBucketWithGlobalMarkers, blockMarkPath, data); err != nil {
+			level.Error(logger).Log("msg", "Mark verification failed.", "block", b, "err", err)
+			return statusError, err
+		}
+	}
 
-		data, err := mark(b)
+	level.Info(logger).Log("msg", "Successfully uploaded mark.", "block", b)
+	return statusUploaded, nil
+}
+
+// verifyMark reads back the mark with the input name from the bucket, and returns an error if it doesn't
+// exist or its content doesn't match the expected one.
+func verifyMark(ctx context.Context, bkt objstore.BucketReader, name string, expected []byte) error {
+	exists, err := bkt.Exists(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "check mark existence")
+	}
+	if !exists {
+		return errors.New("mark does not exist after upload")
+	}
+
+	r, err := bkt.Get(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "read mark")
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return errors.Wrap(err, "read mark")
+	}
+
+	expectedSum := sha256.Sum256(expected)
+	if actualSum := h.Sum(nil); !bytes.Equal(actualSum, expectedSum[:]) {
+		return errors.Errorf("mark content doesn't match the uploaded one (expected SHA-256 %x, got %x)", expectedSum, actualSum)
+	}
+	return nil
+}
+
+// printResults writes the input results to w as a JSON array.
+func printResults(w io.Writer, results []markResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if results == nil {
+		results = []markResult{}
+	}
+	return enc.Encode(results)
+}
+
+// ageCheckConfig configures the check of the blocks age done before marking them for deletion.
+type ageCheckConfig struct {
+	minAge time.Duration
+	strict bool
+}
+
+// checkBlockAge reads the meta.json of the input block and returns an error if the block max time is
+// within minAge from now, because the block may still be written to, or if the meta.json can't be read.
+func checkBlockAge(ctx context.Context, bkt objstore.BucketReader, blockID ulid.ULID, minAge time.Duration, now time.Time) error {
+	r, err := bkt.Get(ctx, path.Join(blockID.String(), metadata.MetaFilename))
+	if err != nil {
+		return errors.Wrap(err, "read meta.json")
+	}
+	defer r.Close()
+
+	meta := metadata.Meta{}
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return errors.Wrap(err, "decode meta.json")
+	}
+
+	maxTime := time.UnixMilli(meta.MaxTime).UTC()
+	if maxTime.After(now.Add(-minAge)) {
+		return errors.Errorf("block max time %s is within the minimum age %s from now", maxTime.Format(time.RFC3339), minAge)
+	}
+	return nil
+}
+
+// listBlocksWithinTimeRange returns the IDs of the blocks of the tenant overlapping the input time range,
+// according to the tenant bucket index.
+func listBlocksWithinTimeRange(ctx context.Context, bkt objstore.Bucket, tenantID string, from, to time.Time, logger log.Logger) ([]string, error) {
+	idx, err := bucketindex.ReadIndex(ctx, bkt, tenantID, nil, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "read bucket index")
+	}
+
+	var blocks []string
+	for _, b := range idx.Blocks {
+		if b.Within(from.UnixMilli(), to.UnixMilli()) {
+			blocks = append(blocks, b.ID.String())
+		}
+	}
+	sort.Strings(blocks)
+	return blocks, nil
+}
+
+// markInfo describes a mark found in the bucket.
+type markInfo struct {
+	Block   ulid.ULID `json:"block"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Reason  string    `json:"reason,omitempty"`
+	Details string    `json:"details,omitempty"`
+}
+
+// listMarks returns the deletion and no-compact marks found in the block folders of the input
+// user bucket, sorted by block ID and mark type.
+func listMarks(ctx context.Context, userBucket objstore.Bucket) ([]markInfo, error) {
+	var marks []markInfo
+
+	err := userBucket.Iter(ctx, "", func(name string) error {
+		// Skip the marks in the global marks folder, or any other file not in a block folder.
+		blockID, err := ulid.Parse(path.Dir(name))
 		if err != nil {
-			level.Error(logger).Log("msg", "Can't create mark.", "block", b, "err", err)
-			return err
+			return nil
 		}
 
-		blockMarkPath := fmt.Sprintf("%s/%s", b, markFilename)
-		if dryRun {
-			level.Info(logger).Log("msg", "Dry-run, not uploading marker.", "block", b, "marker", blockMarkPath, "data", string(data))
+		filename := path.Base(name)
+		if filename != metadata.DeletionMarkFilename && filename != metadata.NoCompactMarkFilename {
 			return nil
 		}
 
-		if err := userBucketWithGlobalMarkers.Upload(ctx, blockMarkPath, bytes.NewReader(data)); err != nil {
-			level.Error(logger).Log("msg", "Can't upload mark.", "block", b, "err", err)
-			return err
+		r, err := userBucket.Get(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "read mark %s", name)
+		}
+		defer r.Close()
+
+		info := markInfo{Block: blockID}
+		if filename == metadata.DeletionMarkFilename {
+			mark := metadata.DeletionMark{}
+			if err := json.NewDecoder(r).Decode(&mark); err != nil {
+				return errors.Wrapf(err, "decode mark %s", name)
+			}
+			info.Type = "deletion"
+			info.Time = time.Unix(mark.DeletionTime, 0).UTC()
+			info.Details = mark.Details
+		} else {
+			mark := metadata.NoCompactMark{}
+			if err := json.NewDecoder(r).Decode(&mark); err != nil {
+				return errors.Wrapf(err, "decode mark %s", name)
+			}
+			info.Type = "no-compact"
+			info.Time = time.Unix(mark.NoCompactTime, 0).UTC()
+			info.Reason = string(mark.Reason)
+			info.Details = mark.Details
 		}
 
-		level.Info(logger).Log("msg", "Successfully uploaded mark.", "block", b)
+		marks = append(marks, info)
 		return nil
+	}, objstore.WithRecursiveIter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].Block != marks[j].Block {
+			return marks[i].Block.Compare(marks[j].Block) < 0
+		}
+		return marks[i].Type < marks[j].Type
 	})
+	return marks, nil
+}
 
-	if err != nil {
-		os.Exit(1)
+// printMarks writes the input marks to w in the given output format.
+func printMarks(w io.Writer, marks []markInfo, output string) error {
+	if output == jsonOutput {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if marks == nil {
+			marks = []markInfo{}
+		}
+		return enc.Encode(marks)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BLOCK\tMARK\tTIME\tREASON\tDETAILS")
+	for _, m := range marks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.Block, m.Type, m.Time.Format(time.RFC3339), m.Reason, m.Details)
 	}
+	return tw.Flush()
 }
 
-func createUserBucketWithGlobalMarkers(ctx context.Context, logger log.Logger, cfg bucket.Config, tenantID string) objstore.Bucket {
+func createBucket(ctx context.Context, logger log.Logger, cfg bucket.Config) objstore.Bucket {
 	bkt, err := bucket.NewClient(ctx, cfg, "bucket", logger, nil)
 	if err != nil {
 		level.Error(logger).Log("msg", "Can't instantiate bucket.", "err", err)
 		os.Exit(1)
 	}
+	return bkt
+}
+
+func createUserBucketWithGlobalMarkers(ctx context.Context, logger log.Logger, cfg bucket.Config, tenantID string) objstore.Bucket {
 	userBucket := bucketindex.BucketWithGlobalMarkers(
-		bucket.NewUserBucketClient(tenantID, bkt, nil),
+		bucket.NewUserBucketClient(tenantID, createBucket(ctx, logger, cfg), nil),
 	)
 	return userBucket
 }
@@ -0,0 +1,490 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+)
+
+func TestReadIDsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# Blocks with out of order chunks.
+01FSCTA0A4M1YQHZQ4B2VTGS2R
+  01FSCTA0A4M1YQHZQ4B2VTGS2U
+
+# Duplicates are returned as is.
+01FSCTA0A4M1YQHZQ4B2VTGS2R
+`), 0666))
+
+	blocks, err := readIDsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"01FSCTA0A4M1YQHZQ4B2VTGS2R", "01FSCTA0A4M1YQHZQ4B2VTGS2U", "01FSCTA0A4M1YQHZQ4B2VTGS2R"}, blocks)
+
+	_, err = readIDsFile(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
+
+func TestRegisterFlags(t *testing.T) {
+	var cfg config
+	fs := registerFlags(&cfg, log.NewNopLogger())
+
+	require.NoError(t, fs.Parse([]string{
+		"-tenant", "user-1",
+		"-mark", "deletion",
+		"-backend", "filesystem",
+		"-operation-retry-max-attempts", "4",
+		"01FSCTA0A4M1YQHZQ4B2VTGS2R",
+	}))
+
+	assert.Equal(t, "user-1", cfg.tenantID)
+	assert.Equal(t, "deletion", cfg.mark)
+	assert.Equal(t, bucket.Filesystem, cfg.bucket.Backend)
+	assert.Equal(t, 4, cfg.bucket.Retry.MaxAttempts)
+	assert.Equal(t, []string{"01FSCTA0A4M1YQHZQ4B2VTGS2R"}, fs.Args())
+}
+
+func TestRegisterFlags_DefaultRetries(t *testing.T) {
+	var cfg config
+	fs := registerFlags(&cfg, log.NewNopLogger())
+
+	require.NoError(t, fs.Parse([]string{"-tenant", "user-1", "-mark", "deletion", "01FSCTA0A4M1YQHZQ4B2VTGS2R"}))
+	assert.Equal(t, 3, cfg.bucket.Retry.MaxAttempts)
+	assert.Equal(t, "3", fs.Lookup("operation-retry-max-attempts").DefValue)
+}
+
+func TestReadTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# Tenants to clean up.
+tenant-1
+tenant-2
+
+tenant-3
+`), 0666))
+
+	assert.Equal(t, []string{"tenant-1"}, readTenants(log.NewNopLogger(), "tenant-1", ""))
+	assert.Equal(t, []string{"tenant-1", "tenant-2", "tenant-3"}, readTenants(log.NewNopLogger(), "", path))
+
+	// Duplicated tenants are processed once.
+	assert.Equal(t, []string{"tenant-2", "tenant-1", "tenant-3"}, readTenants(log.NewNopLogger(), "tenant-2", path))
+}
+
+func TestLogSummary(t *testing.T) {
+	buf := bytes.Buffer{}
+	logSummary(log.NewLogfmtLogger(&buf), 2, 1, []markResult{
+		{Tenant: "tenant-1", Status: statusUploaded},
+		{Tenant: "tenant-1", Status: statusSkipped},
+		{Tenant: "tenant-2", Status: statusDeleted},
+		{Tenant: "tenant-2", Status: statusError, Error: "permission denied"},
+	})
+	assert.Equal(t, "level=info msg=Summary. tenants=2 failed_tenants=1 marked=2 skipped=1 errors=1\n", buf.String())
+}
+
+func TestConfig_ValidateTimeRange(t *testing.T) {
+	var (
+		from = flagext.Time(time.Date(2022, 3, 30, 8, 0, 0, 0, time.UTC))
+		to   = flagext.Time(time.Date(2022, 3, 30, 10, 0, 0, 0, time.UTC))
+	)
+
+	tests := map[string]struct {
+		cfg         config
+		expectedErr string
+	}{
+		"no time range": {
+			cfg: config{blocks: []string{"01FSCTA0A4M1YQHZQ4B2VTGS2R"}},
+		},
+		"valid time range": {
+			cfg: config{timeFrom: from, timeTo: to},
+		},
+		"time range and block IDs": {
+			cfg:         config{timeFrom: from, timeTo: to, blocks: []string{"01FSCTA0A4M1YQHZQ4B2VTGS2R"}},
+			expectedErr: "can't be used together",
+		},
+		"time range and blocks file": {
+			cfg:         config{timeFrom: from, timeTo: to, blocksFile: "blocks.txt"},
+			expectedErr: "can't be used together",
+		},
+		"only time from": {
+			cfg:         config{timeFrom: from},
+			expectedErr: "both -time-from and -time-to must be provided",
+		},
+		"time from after time to": {
+			cfg:         config{timeFrom: to, timeTo: from},
+			expectedErr: "-time-from must be before -time-to",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := testData.cfg.validateTimeRange()
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestListBlocksWithinTimeRange(t *testing.T) {
+	const tenantID = "tenant-1"
+
+	var (
+		base   = time.Date(2022, 3, 30, 0, 0, 0, 0, time.UTC)
+		block1 = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+		block2 = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2V")
+		block3 = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS7Z")
+	)
+
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, bucketindex.WriteIndex(context.Background(), bkt, tenantID, nil, &bucketindex.Index{
+		Version: bucketindex.IndexVersion1,
+		Blocks: bucketindex.Blocks{
+			{ID: block3, MinTime: base.Add(4 * time.Hour).UnixMilli(), MaxTime: base.Add(6 * time.Hour).UnixMilli()},
+			{ID: block2, MinTime: base.Add(2 * time.Hour).UnixMilli(), MaxTime: base.Add(4 * time.Hour).UnixMilli()},
+			{ID: block1, MinTime: base.UnixMilli(), MaxTime: base.Add(2 * time.Hour).UnixMilli()},
+		},
+	}))
+
+	blocks, err := listBlocksWithinTimeRange(context.Background(), bkt, tenantID, base.Add(time.Hour), base.Add(3*time.Hour), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, []string{block1.String(), block2.String()}, blocks)
+
+	// Block time ranges are half-open, so a block ending at the start of the time range doesn't overlap it.
+	blocks, err = listBlocksWithinTimeRange(context.Background(), bkt, tenantID, base.Add(6*time.Hour), base.Add(7*time.Hour), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+
+	_, err = listBlocksWithinTimeRange(context.Background(), bkt, "tenant-2", base, base.Add(time.Hour), log.NewNopLogger())
+	assert.ErrorIs(t, err, bucketindex.ErrIndexNotFound)
+}
+
+func TestUploadMarks_DeleteMarks(t *testing.T) {
+	const tenantID = "tenant-1"
+
+	var (
+		marked   = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+		unmarked = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2U")
+		missing  = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS7Z")
+	)
+
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dry run: %t", dryRun), func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := bucket.Config{StorageBackendConfig: bucket.StorageBackendConfig{
+				Backend:    bucket.Filesystem,
+				Filesystem: filesystem.Config{Directory: dir},
+			}}
+
+			marker, filename := createMarker("no-compact", log.NewNopLogger(), "")
+			blockMarkPath := filepath.Join(dir, tenantID, marked.String(), metadata.NoCompactMarkFilename)
+			globalMarkPath := filepath.Join(dir, tenantID, "markers", marked.String()+"-"+metadata.NoCompactMarkFilename)
+
+			for _, id := range []ulid.ULID{marked, unmarked} {
+				require.NoError(t, os.MkdirAll(filepath.Join(dir, tenantID, id.String()), 0750))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, tenantID, id.String(), metadata.MetaFilename), []byte("{}"), 0640))
+			}
+			_, err := uploadMarks(context.Background(), log.NewNopLogger(), createMarks, tenantID, []ulid.ULID{marked}, marker, filename, false, cfg, false, 1, ageCheckConfig{}, false)
+			require.NoError(t, err)
+			require.FileExists(t, blockMarkPath)
+			require.FileExists(t, globalMarkPath)
+
+			results, err := uploadMarks(context.Background(), log.NewNopLogger(), deleteMarks, tenantID, []ulid.ULID{marked, unmarked, missing}, marker, filename, dryRun, cfg, false, 1, ageCheckConfig{}, false)
+			require.NoError(t, err)
+
+			expectedStatus := statusDeleted
+			if dryRun {
+				expectedStatus = statusSkipped
+				assert.FileExists(t, blockMarkPath)
+				assert.FileExists(t, globalMarkPath)
+			} else {
+				assert.NoFileExists(t, blockMarkPath)
+				assert.NoFileExists(t, globalMarkPath)
+			}
+			assert.Equal(t, []markResult{
+				{Tenant: tenantID, Block: marked, Status: expectedStatus},
+				{Tenant: tenantID, Block: unmarked, Status: statusSkipped},
+				{Tenant: tenantID, Block: missing, Status: statusSkipped},
+			}, results)
+			assert.FileExists(t, filepath.Join(dir, tenantID, marked.String(), metadata.MetaFilename))
+		})
+	}
+}
+
+func TestUploadMarks_ShouldMarkRecentBlocksForDeletionWhenNotStrict(t *testing.T) {
+	const tenantID = "tenant-1"
+
+	recent := ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+
+	dir := t.TempDir()
+	cfg := bucket.Config{StorageBackendConfig: bucket.StorageBackendConfig{
+		Backend:    bucket.Filesystem,
+		Filesystem: filesystem.Config{Directory: dir},
+	}}
+
+	meta, err := json.Marshal(metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: recent, MaxTime: time.Now().UnixMilli()}})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, tenantID, recent.String()), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tenantID, recent.String(), metadata.MetaFilename), meta, 0640))
+
+	marker, filename := createMarker("deletion", log.NewNopLogger(), "")
+	_, err = uploadMarks(context.Background(), log.NewNopLogger(), createMarks, tenantID, []ulid.ULID{recent}, marker, filename, false, cfg, false, 1, ageCheckConfig{minAge: 24 * time.Hour}, false)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, tenantID, recent.String(), metadata.DeletionMarkFilename))
+}
+
+func TestUploadMarks_ShouldFailMarkingRecentBlocksForDeletionWhenStrict(t *testing.T) {
+	const tenantID = "tenant-1"
+
+	recent := ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+
+	dir := t.TempDir()
+	cfg := bucket.Config{StorageBackendConfig: bucket.StorageBackendConfig{
+		Backend:    bucket.Filesystem,
+		Filesystem: filesystem.Config{Directory: dir},
+	}}
+
+	meta, err := json.Marshal(metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: recent, MaxTime: time.Now().UnixMilli()}})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, tenantID, recent.String()), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tenantID, recent.String(), metadata.MetaFilename), meta, 0640))
+
+	marker, filename := createMarker("deletion", log.NewNopLogger(), "")
+	results, err := uploadMarks(context.Background(), log.NewNopLogger(), createMarks, tenantID, []ulid.ULID{recent}, marker, filename, false, cfg, false, 1, ageCheckConfig{minAge: 24 * time.Hour, strict: true}, false)
+	require.Error(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, statusError, results[0].Status)
+	assert.Contains(t, results[0].Error, "within the minimum age")
+	assert.NoFileExists(t, filepath.Join(dir, tenantID, recent.String(), metadata.DeletionMarkFilename))
+}
+
+func TestUploadMark_Verify(t *testing.T) {
+	block := ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+	marker, filename := createMarker("no-compact", log.NewNopLogger(), "")
+
+	tests := map[string]struct {
+		bucket         func(objstore.Bucket) objstore.Bucket
+		verify         bool
+		expectedStatus markStatus
+		expectedErr    string
+	}{
+		"verification disabled": {
+			bucket:         func(bkt objstore.Bucket) objstore.Bucket { return &corruptingBucket{Bucket: bkt} },
+			expectedStatus: statusUploaded,
+		},
+		"re-read mark matching the uploaded one": {
+			bucket:         func(bkt objstore.Bucket) objstore.Bucket { return bkt },
+			verify:         true,
+			expectedStatus: statusUploaded,
+		},
+		"re-read mark not matching the uploaded one": {
+			bucket:         func(bkt objstore.Bucket) objstore.Bucket { return &corruptingBucket{Bucket: bkt} },
+			verify:         true,
+			expectedStatus: statusError,
+			expectedErr:    "mark content doesn't match the uploaded one",
+		},
+		"mark not found after upload": {
+			bucket:         func(bkt objstore.Bucket) objstore.Bucket { return &corruptingBucket{Bucket: bkt, missing: true} },
+			verify:         true,
+			expectedStatus: statusError,
+			expectedErr:    "mark does not exist after upload",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			require.NoError(t, bkt.Upload(context.Background(), path.Join(block.String(), metadata.MetaFilename), bytes.NewReader([]byte("{}"))))
+
+			status, err := uploadMark(context.Background(), log.NewNopLogger(), createMarks, block, marker, filename, false, testData.bucket(bkt), false, ageCheckConfig{}, testData.verify)
+			if testData.expectedErr != "" {
+				assert.ErrorContains(t, err, testData.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, testData.expectedStatus, status)
+		})
+	}
+}
+
+func TestUploadMark_ShouldNotVerifyOnDryRun(t *testing.T) {
+	block := ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+	marker, filename := createMarker("no-compact", log.NewNopLogger(), "")
+
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(block.String(), metadata.MetaFilename), bytes.NewReader([]byte("{}"))))
+
+	status, err := uploadMark(context.Background(), log.NewNopLogger(), createMarks, block, marker, filename, true, &corruptingBucket{Bucket: bkt, missing: true}, false, ageCheckConfig{}, true)
+	require.NoError(t, err)
+	assert.Equal(t, statusSkipped, status)
+}
+
+// corruptingBucket simulates a bucket not returning the uploaded marks as they were written:
+// Get returns corrupted content, and Exists reports the marks as missing if configured so.
+type corruptingBucket struct {
+	objstore.Bucket
+
+	missing bool
+}
+
+func (b *corruptingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if b.missing {
+		return false, nil
+	}
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *corruptingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(append(content, '\n'))), nil
+}
+
+func TestCheckBlockAge(t *testing.T) {
+	var (
+		now     = time.Now()
+		old     = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+		recent  = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2V")
+		invalid = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS7Z")
+		missing = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS8Z")
+	)
+
+	bkt := objstore.NewInMemBucket()
+	for id, maxTime := range map[ulid.ULID]time.Time{old: now.Add(-25 * time.Hour), recent: now.Add(-23 * time.Hour)} {
+		meta, err := json.Marshal(metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id, MaxTime: maxTime.UnixMilli()}})
+		require.NoError(t, err)
+		require.NoError(t, bkt.Upload(context.Background(), path.Join(id.String(), metadata.MetaFilename), bytes.NewReader(meta)))
+	}
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(invalid.String(), metadata.MetaFilename), bytes.NewReader([]byte("{"))))
+
+	assert.NoError(t, checkBlockAge(context.Background(), bkt, old, 24*time.Hour, now))
+	assert.ErrorContains(t, checkBlockAge(context.Background(), bkt, recent, 24*time.Hour, now), "within the minimum age")
+	assert.NoError(t, checkBlockAge(context.Background(), bkt, recent, 12*time.Hour, now))
+	assert.ErrorContains(t, checkBlockAge(context.Background(), bkt, invalid, 24*time.Hour, now), "decode meta.json")
+	assert.ErrorContains(t, checkBlockAge(context.Background(), bkt, missing, 24*time.Hour, now), "read meta.json")
+}
+
+func TestListMarks(t *testing.T) {
+	const tenantID = "tenant-1"
+
+	var (
+		deleted     = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R")
+		noCompacted = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2V")
+		unmarked    = ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS7Z")
+	)
+
+	dir := t.TempDir()
+	cfg := bucket.Config{StorageBackendConfig: bucket.StorageBackendConfig{
+		Backend:    bucket.Filesystem,
+		Filesystem: filesystem.Config{Directory: dir},
+	}}
+
+	for _, id := range []ulid.ULID{deleted, noCompacted, unmarked} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, tenantID, id.String()), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tenantID, id.String(), metadata.MetaFilename), []byte("{}"), 0640))
+	}
+
+	marker, filename := createMarker("deletion", log.NewNopLogger(), "Corrupted block")
+	_, err := uploadMarks(context.Background(), log.NewNopLogger(), createMarks, tenantID, []ulid.ULID{deleted, noCompacted}, marker, filename, false, cfg, false, 1, ageCheckConfig{}, false)
+	require.NoError(t, err)
+	marker, filename = createMarker("no-compact", log.NewNopLogger(), "Out of order chunks")
+	_, err = uploadMarks(context.Background(), log.NewNopLogger(), createMarks, tenantID, []ulid.ULID{noCompacted}, marker, filename, false, cfg, false, 1, ageCheckConfig{}, false)
+	require.NoError(t, err)
+
+	marks, err := listMarks(context.Background(), createUserBucketWithGlobalMarkers(context.Background(), log.NewNopLogger(), cfg, tenantID))
+	require.NoError(t, err)
+	require.Len(t, marks, 3)
+
+	for _, m := range marks {
+		assert.WithinDuration(t, time.Now(), m.Time, time.Minute)
+	}
+	assert.Equal(t, deleted, marks[0].Block)
+	assert.Equal(t, "deletion", marks[0].Type)
+	assert.Equal(t, "Corrupted block", marks[0].Details)
+	assert.Equal(t, noCompacted, marks[1].Block)
+	assert.Equal(t, "deletion", marks[1].Type)
+	assert.Equal(t, noCompacted, marks[2].Block)
+	assert.Equal(t, "no-compact", marks[2].Type)
+	assert.Equal(t, string(metadata.ManualNoCompactReason), marks[2].Reason)
+	assert.Equal(t, "Out of order chunks", marks[2].Details)
+}
+
+func TestPrintMarks(t *testing.T) {
+	marks := []markInfo{
+		{Block: ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R"), Type: "deletion", Time: time.Unix(1648630241, 0).UTC(), Details: "Corrupted block"},
+		{Block: ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2V"), Type: "no-compact", Time: time.Unix(1648630300, 0).UTC(), Reason: "manual", Details: "Out of order chunks"},
+	}
+
+	t.Run("table", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, printMarks(&buf, marks, tableOutput))
+		assert.Equal(t, `BLOCK                       MARK        TIME                  REASON  DETAILS
+01FSCTA0A4M1YQHZQ4B2VTGS2R  deletion    2022-03-30T08:50:41Z          Corrupted block
+01FSCTA0A4M1YQHZQ4B2VTGS2V  no-compact  2022-03-30T08:51:40Z  manual  Out of order chunks
+`, buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, printMarks(&buf, marks, jsonOutput))
+		assert.JSONEq(t, `[
+			{"block": "01FSCTA0A4M1YQHZQ4B2VTGS2R", "type": "deletion", "time": "2022-03-30T08:50:41Z", "details": "Corrupted block"},
+			{"block": "01FSCTA0A4M1YQHZQ4B2VTGS2V", "type": "no-compact", "time": "2022-03-30T08:51:40Z", "reason": "manual", "details": "Out of order chunks"}
+		]`, buf.String())
+	})
+
+	t.Run("json without marks", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, printMarks(&buf, nil, jsonOutput))
+		assert.JSONEq(t, `[]`, buf.String())
+	})
+}
+
+func TestPrintResults(t *testing.T) {
+	results := []markResult{
+		{Tenant: "tenant-1", Block: ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2R"), Status: statusUploaded},
+		{Tenant: "tenant-2", Block: ulid.MustParse("01FSCTA0A4M1YQHZQ4B2VTGS2V"), Status: statusError, Error: "permission denied"},
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, printResults(&buf, results))
+	assert.JSONEq(t, `[
+		{"tenant": "tenant-1", "block": "01FSCTA0A4M1YQHZQ4B2VTGS2R", "status": "uploaded"},
+		{"tenant": "tenant-2", "block": "01FSCTA0A4M1YQHZQ4B2VTGS2V", "status": "error", "error": "permission denied"}
+	]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, printResults(&buf, nil))
+	assert.JSONEq(t, `[]`, buf.String())
+}